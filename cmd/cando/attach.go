@@ -0,0 +1,343 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"cando/internal/agent"
+	"cando/internal/config"
+	"cando/internal/timefmt"
+)
+
+// attachResumeAttempts is how often a dropped prompt stream is resumed.
+const attachResumeAttempts = 3
+
+// attachClient talks to a running Cando web server.
+type attachClient struct {
+	http      *http.Client
+	baseURL   string
+	workspace string
+	token     string // Bearer token of a headless server
+}
+
+// runAttach implements `cando attach`: list workspaces and sessions or send
+// prompts to a server that is already running, sharing its sessions with
+// the web UI.
+func runAttach(args []string) error {
+	fs := flag.NewFlagSet("attach", flag.ExitOnError)
+	addr := fs.String("addr", "", "Server address, host:port or unix:/path (default: web.socket, else 127.0.0.1:3737)")
+	workspace := fs.String("workspace", "", "Workspace path (default: current directory if registered, else the server's current workspace)")
+	session := fs.String("session", "", "Switch to this session key before prompting")
+	list := fs.Bool("list", false, "List workspaces and sessions and exit")
+	token := fs.String("token", "", "API token of a server started with -headless (default: web.auth_token)")
+	fs.String("profile", "", "Config profile whose settings locate the server (applied before parsing)")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: cando attach [flags] [prompt]\n\nWithout a prompt, reads prompts from stdin until EOF or :quit.\n\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	cfg, err := config.LoadUserConfig()
+	if err != nil {
+		cfg = config.Config{}
+	}
+	target := *addr
+	if target == "" {
+		target = defaultAttachAddr(cfg)
+	}
+	httpClient, baseURL := agent.WebClient(target, cfg.Web.Scheme(), 0)
+	client := &attachClient{http: httpClient, baseURL: baseURL, token: *token}
+	if client.token == "" {
+		client.token = strings.TrimSpace(cfg.Web.AuthToken)
+	}
+
+	if err := client.resolveWorkspace(*workspace); err != nil {
+		return fmt.Errorf("connect to %s: %w", target, err)
+	}
+	if *list {
+		return client.list()
+	}
+	if *session != "" {
+		if err := client.postJSON("/api/state", map[string]string{"action": "switch", "key": *session}, nil); err != nil {
+			return fmt.Errorf("switch session: %w", err)
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if prompt := strings.TrimSpace(strings.Join(fs.Args(), " ")); prompt != "" {
+		return client.prompt(ctx, prompt)
+	}
+
+	scanner := bufio.NewScanner(os.Stdin)
+	for {
+		fmt.Print("> ")
+		if !scanner.Scan() {
+			fmt.Println()
+			return scanner.Err()
+		}
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if line == ":quit" || line == ":exit" {
+			return nil
+		}
+		if err := client.prompt(ctx, line); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		}
+		if ctx.Err() != nil {
+			return nil
+		}
+	}
+}
+
+func defaultAttachAddr(cfg config.Config) string {
+	if cfg.Web.Socket != "" {
+		return "unix:" + cfg.Web.Socket
+	}
+	port := os.Getenv("CANDO_PORT")
+	if port == "" {
+		port = "3737"
+	}
+	return "127.0.0.1:" + port
+}
+
+func (c *attachClient) do(req *http.Request) (*http.Response, error) {
+	if c.workspace != "" {
+		req.Header.Set("X-Workspace", c.workspace)
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return nil, fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	return resp, nil
+}
+
+func (c *attachClient) getJSON(path string, out any) error {
+	req, err := http.NewRequest(http.MethodGet, c.baseURL+path, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+func (c *attachClient) postJSON(path string, body, out any) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, c.baseURL+path, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := c.do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// resolveWorkspace picks the workspace prompts are sent to.
+func (c *attachClient) resolveWorkspace(explicit string) error {
+	var payload struct {
+		Workspaces []agent.Workspace `json:"workspaces"`
+		Current    *agent.Workspace  `json:"current"`
+	}
+	if err := c.getJSON("/api/workspaces", &payload); err != nil {
+		return err
+	}
+	if explicit != "" {
+		abs, err := filepath.Abs(explicit)
+		if err != nil {
+			return err
+		}
+		c.workspace = abs
+		return nil
+	}
+	if cwd, err := os.Getwd(); err == nil {
+		for _, ws := range payload.Workspaces {
+			if filepath.Clean(ws.Path) == cwd {
+				c.workspace = ws.Path
+				return nil
+			}
+		}
+	}
+	if payload.Current != nil {
+		c.workspace = payload.Current.Path
+	}
+	return nil
+}
+
+func (c *attachClient) list() error {
+	var payload struct {
+		Workspaces []agent.Workspace `json:"workspaces"`
+	}
+	if err := c.getJSON("/api/workspaces", &payload); err != nil {
+		return err
+	}
+	fmt.Println("Workspaces:")
+	for _, ws := range payload.Workspaces {
+		marker := " "
+		if ws.Path == c.workspace {
+			marker = "*"
+		}
+		fmt.Printf(" %s %s  %s\n", marker, ws.Name, ws.Path)
+	}
+	if c.workspace == "" {
+		return nil
+	}
+	var session struct {
+		CurrentKey string `json:"current_key"`
+		Sessions   []struct {
+			Key          string    `json:"key"`
+			Title        string    `json:"title"`
+			UpdatedAt    time.Time `json:"updated_at"`
+			MessageCount int       `json:"message_count"`
+		} `json:"sessions"`
+		Running bool `json:"running"`
+	}
+	if err := c.getJSON("/api/session", &session); err != nil {
+		return err
+	}
+	fmt.Printf("\nSessions in %s:\n", c.workspace)
+	for _, s := range session.Sessions {
+		marker := " "
+		if s.Key == session.CurrentKey {
+			marker = "*"
+		}
+		fmt.Printf(" %s %-24s %4d messages  %s", marker, s.Key, s.MessageCount, timefmt.Relative(s.UpdatedAt, time.Now()))
+		if s.Title != "" {
+			fmt.Printf("  %s", s.Title)
+		}
+		fmt.Println()
+	}
+	if session.Running {
+		fmt.Println("\nA turn is running.")
+	}
+	return nil
+}
+
+// prompt streams one prompt, resuming the stream if the connection drops
+// and cancelling the turn on interrupt.
+func (c *attachClient) prompt(ctx context.Context, content string) error {
+	key := make([]byte, 16)
+	rand.Read(key)
+	data, _ := json.Marshal(map[string]string{"content": content, "idempotency_key": hex.EncodeToString(key)})
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+"/api/stream", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	var lastEventID string
+	for attempt := 0; ; attempt++ {
+		resp, err := c.do(req)
+		if err == nil {
+			var done bool
+			done, err = printEvents(resp.Body, &lastEventID)
+			resp.Body.Close()
+			if done {
+				return err
+			}
+		}
+		if ctx.Err() != nil {
+			c.postJSON("/api/cancel", map[string]string{}, nil)
+			fmt.Fprintln(os.Stderr, "\ncancelled")
+			return nil
+		}
+		if lastEventID == "" || attempt >= attachResumeAttempts {
+			if err == nil {
+				err = errors.New("stream ended before the turn completed")
+			}
+			return err
+		}
+		fmt.Fprintln(os.Stderr, "  … connection lost, resuming")
+		req, _ = http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+"/api/stream", nil)
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+}
+
+// printEvents renders SSE events until the turn completes, reporting
+// whether it did and any error the turn ended with.
+func printEvents(body io.Reader, lastEventID *string) (bool, error) {
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if id, ok := strings.CutPrefix(line, "id: "); ok {
+			*lastEventID = id
+			continue
+		}
+		payload, ok := strings.CutPrefix(line, "data: ")
+		if !ok {
+			continue
+		}
+		var event struct {
+			Type string         `json:"type"`
+			Data map[string]any `json:"data"`
+		}
+		if json.Unmarshal([]byte(payload), &event) != nil {
+			continue
+		}
+		text := func(key string) string { s, _ := event.Data[key].(string); return s }
+		switch event.Type {
+		case "assistant_message":
+			if content := strings.TrimSpace(text("content")); content != "" {
+				fmt.Println(content)
+			}
+		case "tool_call_started":
+			args := text("arguments")
+			if len(args) > 80 {
+				args = args[:77] + "..."
+			}
+			fmt.Printf("  → %s %s\n", text("function"), args)
+		case "tool_call_completed":
+			if failed, _ := event.Data["error"].(bool); failed {
+				fmt.Printf("  ✗ %s failed\n", text("function"))
+			}
+		case "status", "request_retry", "model_switch":
+			if msg := text("message"); msg != "" {
+				fmt.Fprintf(os.Stderr, "  … %s\n", msg)
+			}
+		case "provider_error", "error":
+			return true, errors.New(text("message"))
+		case "complete":
+			return true, nil
+		}
+	}
+	return false, scanner.Err()
+}
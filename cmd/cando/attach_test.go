@@ -0,0 +1,244 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeAttachServer answers the endpoints cando attach uses the way the web
+// server does, recording what the client sent.
+type fakeAttachServer struct {
+	workspaces []string
+	current    string
+	stream     func(w http.ResponseWriter, r *http.Request)
+
+	mu        sync.Mutex
+	requests  []string // Method, path and X-Workspace of each request
+	switched  string
+	cancelled bool
+}
+
+func (f *fakeAttachServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Authorization") != "Bearer secret" {
+		http.Error(w, "missing or invalid API token", http.StatusUnauthorized)
+		return
+	}
+	f.mu.Lock()
+	f.requests = append(f.requests, fmt.Sprintf("%s %s %s", r.Method, r.URL.Path, r.Header.Get("X-Workspace")))
+	f.mu.Unlock()
+	switch r.URL.Path {
+	case "/api/workspaces":
+		var list []map[string]string
+		for _, ws := range f.workspaces {
+			list = append(list, map[string]string{"path": ws, "name": filepath.Base(ws)})
+		}
+		json.NewEncoder(w).Encode(map[string]any{"workspaces": list, "current": map[string]string{"path": f.current}})
+	case "/api/session":
+		json.NewEncoder(w).Encode(map[string]any{
+			"current_key": "main",
+			"sessions": []map[string]any{
+				{"key": "main", "title": "Fix the parser", "message_count": 12},
+				{"key": "spike", "message_count": 3},
+			},
+			"running": true,
+		})
+	case "/api/state":
+		var req struct{ Action, Key string }
+		json.NewDecoder(r.Body).Decode(&req)
+		f.mu.Lock()
+		f.switched = req.Action + " " + req.Key
+		f.mu.Unlock()
+		w.Write([]byte("{}"))
+	case "/api/cancel":
+		f.mu.Lock()
+		f.cancelled = true
+		f.mu.Unlock()
+		w.Write([]byte("{}"))
+	case "/api/stream":
+		f.stream(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func newAttachTest(t *testing.T, f *fakeAttachServer) *attachClient {
+	t.Helper()
+	srv := httptest.NewServer(f)
+	t.Cleanup(srv.Close)
+	return &attachClient{http: srv.Client(), baseURL: srv.URL, token: "secret"}
+}
+
+// captureStdout returns what fn prints.
+func captureStdout(t *testing.T, fn func()) string {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = stdout }()
+	done := make(chan string)
+	go func() {
+		data, _ := io.ReadAll(r)
+		done <- string(data)
+	}()
+	fn()
+	w.Close()
+	return <-done
+}
+
+func TestAttachResolveWorkspace(t *testing.T) {
+	registered, other := t.TempDir(), t.TempDir()
+	f := &fakeAttachServer{workspaces: []string{registered, other}, current: other}
+	client := newAttachTest(t, f)
+
+	t.Chdir(registered)
+	if err := client.resolveWorkspace(""); err != nil || client.workspace != registered {
+		t.Errorf("registered cwd = %q, %v; want %s", client.workspace, err, registered)
+	}
+	t.Chdir(t.TempDir())
+	if err := client.resolveWorkspace(""); err != nil || client.workspace != other {
+		t.Errorf("unregistered cwd = %q, %v; want the current workspace %s", client.workspace, err, other)
+	}
+	if err := client.resolveWorkspace("sub"); err != nil || !filepath.IsAbs(client.workspace) || filepath.Base(client.workspace) != "sub" {
+		t.Errorf("explicit = %q, %v", client.workspace, err)
+	}
+
+	client.token = "wrong"
+	if err := client.resolveWorkspace(""); err == nil || !strings.Contains(err.Error(), "401") {
+		t.Errorf("bad token = %v, want a 401", err)
+	}
+}
+
+func TestAttachListAndSwitch(t *testing.T) {
+	ws := t.TempDir()
+	f := &fakeAttachServer{workspaces: []string{ws}, current: ws}
+	client := newAttachTest(t, f)
+	client.workspace = ws
+
+	out := captureStdout(t, func() {
+		if err := client.list(); err != nil {
+			t.Error(err)
+		}
+	})
+	for _, want := range []string{"* " + filepath.Base(ws) + "  " + ws, "* main", "12 messages", "Fix the parser", "  spike", "A turn is running."} {
+		if !strings.Contains(out, want) {
+			t.Errorf("list output lacks %q:\n%s", want, out)
+		}
+	}
+	if err := client.postJSON("/api/state", map[string]string{"action": "switch", "key": "spike"}, nil); err != nil || f.switched != "switch spike" {
+		t.Errorf("switch = %q, %v", f.switched, err)
+	}
+	for _, req := range f.requests {
+		if !strings.HasSuffix(req, " "+ws) {
+			t.Errorf("request %q not scoped to the workspace", req)
+		}
+	}
+}
+
+func TestAttachPromptResumesStream(t *testing.T) {
+	var lastEventIDs []string
+	f := &fakeAttachServer{stream: func(w http.ResponseWriter, r *http.Request) {
+		lastEventIDs = append(lastEventIDs, r.Method+" "+r.Header.Get("Last-Event-ID"))
+		if r.Method == http.MethodPost {
+			var req map[string]string
+			json.NewDecoder(r.Body).Decode(&req)
+			if req["content"] != "fix it" || req["idempotency_key"] == "" {
+				http.Error(w, "bad prompt", http.StatusBadRequest)
+				return
+			}
+			// The connection drops before the turn completes
+			fmt.Fprint(w, "id: 7\ndata: {\"type\":\"assistant_message\",\"data\":{\"content\":\"Looking.\"}}\n\n")
+			return
+		}
+		fmt.Fprint(w, "id: 8\ndata: {\"type\":\"tool_call_started\",\"data\":{\"function\":\"read_file\",\"arguments\":\"{}\"}}\n\n")
+		fmt.Fprint(w, "id: 9\ndata: {\"type\":\"complete\"}\n\n")
+	}}
+	client := newAttachTest(t, f)
+
+	out := captureStdout(t, func() {
+		if err := client.prompt(t.Context(), "fix it"); err != nil {
+			t.Error(err)
+		}
+	})
+	if strings.Join(lastEventIDs, ",") != "POST ,GET 7" {
+		t.Errorf("stream requests = %v, want a POST then a resume from event 7", lastEventIDs)
+	}
+	if !strings.Contains(out, "Looking.") || !strings.Contains(out, "→ read_file {}") {
+		t.Errorf("output = %q", out)
+	}
+}
+
+func TestAttachPromptErrors(t *testing.T) {
+	for _, tc := range []struct {
+		name, body, want string
+	}{
+		{"provider error", "id: 1\ndata: {\"type\":\"provider_error\",\"data\":{\"message\":\"rate limited\"}}\n\n", "rate limited"},
+		{"dropped before any event", "", "stream ended before the turn completed"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			calls := 0
+			f := &fakeAttachServer{stream: func(w http.ResponseWriter, r *http.Request) {
+				calls++
+				fmt.Fprint(w, tc.body)
+			}}
+			client := newAttachTest(t, f)
+			var err error
+			captureStdout(t, func() { err = client.prompt(t.Context(), "hi") })
+			if err == nil || !strings.Contains(err.Error(), tc.want) || calls != 1 {
+				t.Errorf("prompt = %v after %d requests, want %q after 1", err, calls, tc.want)
+			}
+		})
+	}
+
+	// A stream that keeps dropping is resumed attachResumeAttempts times
+	calls := 0
+	f := &fakeAttachServer{stream: func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		fmt.Fprintf(w, "id: %d\ndata: {\"type\":\"status\",\"data\":{}}\n\n", calls)
+	}}
+	client := newAttachTest(t, f)
+	if err := client.prompt(t.Context(), "hi"); err == nil || calls != attachResumeAttempts+1 {
+		t.Errorf("prompt = %v after %d requests, want an error after %d", err, calls, attachResumeAttempts+1)
+	}
+}
+
+func TestAttachPromptCancels(t *testing.T) {
+	f := &fakeAttachServer{}
+	client := newAttachTest(t, f)
+	f.stream = func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "id: 1\ndata: {\"type\":\"status\",\"data\":{}}\n\n")
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	}
+	ctx, cancel := context.WithCancel(t.Context())
+	go func() {
+		for {
+			f.mu.Lock()
+			started := len(f.requests) > 0
+			f.mu.Unlock()
+			if started {
+				cancel()
+				return
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}()
+	if err := client.prompt(ctx, "long job"); err != nil {
+		t.Fatal(err)
+	}
+	if !f.cancelled {
+		t.Error("interrupt did not cancel the turn")
+	}
+}
@@ -0,0 +1,514 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"cando/internal/agent"
+	"cando/internal/config"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	benchTaskFile = "task.yaml"
+	// benchOutputTail is how much agent or verify output a failed task keeps
+	// in the report.
+	benchOutputTail = 2000
+	// benchStopWait is how long a timed-out agent run's children may keep
+	// its output open before the runner stops waiting for them.
+	benchStopWait = 2 * time.Second
+)
+
+// benchTask is a task definition: a task.yaml in its own directory, with an
+// optional workspace/ directory copied into the task's fresh workspace.
+type benchTask struct {
+	Name    string `yaml:"name"`
+	Prompt  string `yaml:"prompt"`
+	Setup   string `yaml:"setup"`   // Shell script run in the workspace before the prompt
+	Verify  string `yaml:"verify"`  // Shell script run afterwards; exit status 0 is success
+	Timeout string `yaml:"timeout"` // Limit for the agent run, e.g. "10m"
+
+	dir string
+}
+
+type benchResult struct {
+	Task         string  `json:"task"`
+	Success      bool    `json:"success"`
+	Requests     int     `json:"requests"` // Model turns
+	Tokens       int     `json:"tokens"`
+	ToolCalls    int     `json:"tool_calls"`
+	WallSeconds  float64 `json:"wall_seconds"`
+	Error        string  `json:"error,omitempty"`
+	VerifyOutput string  `json:"verify_output,omitempty"`
+}
+
+type benchSummary struct {
+	Tasks       int     `json:"tasks"`
+	Passed      int     `json:"passed"`
+	SuccessRate float64 `json:"success_rate"`
+	Requests    int     `json:"requests"`
+	Tokens      int     `json:"tokens"`
+	ToolCalls   int     `json:"tool_calls"`
+	WallSeconds float64 `json:"wall_seconds"`
+}
+
+// benchReport is the JSON file a bench run writes and --compare reads.
+type benchReport struct {
+	Label    string        `json:"label,omitempty"`
+	Provider string        `json:"provider,omitempty"`
+	Model    string        `json:"model,omitempty"`
+	Started  time.Time     `json:"started"`
+	Results  []benchResult `json:"results"`
+	Summary  benchSummary  `json:"summary"`
+}
+
+// runStats is what `cando -p --stats-file` writes for the bench runner.
+type runStats struct {
+	agent.RunUsage
+	Error string `json:"error,omitempty"`
+}
+
+func writeRunStats(path string, usage agent.RunUsage, runErr error) error {
+	stats := runStats{RunUsage: usage}
+	if runErr != nil {
+		stats.Error = runErr.Error()
+	}
+	data, err := json.Marshal(stats)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0o644)
+}
+
+// runBench implements `cando bench`: run every task in a directory against
+// the current configuration, then report and optionally compare results.
+func runBench(args []string) error {
+	fs := flag.NewFlagSet("bench", flag.ExitOnError)
+	out := fs.String("out", "", "Write the JSON report here (default: bench-<time>.json)")
+	compare := fs.String("compare", "", "Compare against an earlier JSON report")
+	label := fs.String("label", "", "Name for this run in reports, e.g. the model or config being tried")
+	timeout := fs.Duration("timeout", 10*time.Minute, "Time limit per agent run unless a task sets its own")
+	filter := fs.String("run", "", "Only run tasks whose name matches this regular expression")
+	keep := fs.Bool("keep", false, "Keep task workspaces instead of deleting them")
+	verbose := fs.Bool("v", false, "Show agent and script output")
+	fs.String("profile", "", "Config profile to benchmark (applied before parsing)")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: cando bench [flags] <tasks-dir>\n\nEach task is a directory with a %s (prompt, setup, verify, timeout)\nand an optional workspace/ directory with the starting files.\n\n", benchTaskFile)
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("a tasks directory is required")
+	}
+
+	tasks, err := loadBenchTasks(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	if *filter != "" {
+		re, err := regexp.Compile(*filter)
+		if err != nil {
+			return fmt.Errorf("invalid -run pattern: %w", err)
+		}
+		kept := tasks[:0]
+		for _, task := range tasks {
+			if re.MatchString(task.Name) {
+				kept = append(kept, task)
+			}
+		}
+		tasks = kept
+	}
+	if len(tasks) == 0 {
+		return errors.New("no tasks to run")
+	}
+	var baseline *benchReport
+	if *compare != "" {
+		if baseline, err = readBenchReport(*compare); err != nil {
+			return err
+		}
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("locate cando binary: %w", err)
+	}
+
+	report := &benchReport{Label: *label, Started: time.Now().UTC()}
+	if cfg, err := config.LoadUserConfig(); err == nil {
+		report.Provider = cfg.Provider
+		report.Model = cfg.Model
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	runner := benchRunner{exe: exe, timeout: *timeout, keep: *keep, verbose: *verbose}
+	for i, task := range tasks {
+		fmt.Printf("[%d/%d] %s ... ", i+1, len(tasks), task.Name)
+		result := runner.run(ctx, task)
+		report.Results = append(report.Results, result)
+		if result.Success {
+			fmt.Printf("ok (%.1fs, %d turns, %d tokens)\n", result.WallSeconds, result.Requests, result.Tokens)
+		} else {
+			fmt.Printf("FAIL (%.1fs) %s\n", result.WallSeconds, result.Error)
+		}
+		if ctx.Err() != nil {
+			fmt.Println("interrupted; reporting the tasks run so far")
+			break
+		}
+	}
+	report.Summary = summarizeBench(report.Results)
+
+	path := *out
+	if path == "" {
+		path = fmt.Sprintf("bench-%s.json", report.Started.Format("20060102-150405"))
+	}
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0o644); err != nil {
+		return fmt.Errorf("write report: %w", err)
+	}
+
+	fmt.Println()
+	printBenchReport(os.Stdout, report, baseline)
+	fmt.Printf("\nReport written to %s\n", path)
+	return nil
+}
+
+// loadBenchTasks reads every task under dir, sorted by name. dir may also be
+// a single task directory.
+func loadBenchTasks(dir string) ([]benchTask, error) {
+	if _, err := os.Stat(filepath.Join(dir, benchTaskFile)); err == nil {
+		task, err := loadBenchTask(dir)
+		if err != nil {
+			return nil, err
+		}
+		return []benchTask{task}, nil
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("read tasks: %w", err)
+	}
+	var tasks []benchTask
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		taskDir := filepath.Join(dir, entry.Name())
+		if _, err := os.Stat(filepath.Join(taskDir, benchTaskFile)); err != nil {
+			continue
+		}
+		task, err := loadBenchTask(taskDir)
+		if err != nil {
+			return nil, err
+		}
+		tasks = append(tasks, task)
+	}
+	sort.Slice(tasks, func(i, j int) bool { return tasks[i].Name < tasks[j].Name })
+	return tasks, nil
+}
+
+func loadBenchTask(dir string) (benchTask, error) {
+	var task benchTask
+	data, err := os.ReadFile(filepath.Join(dir, benchTaskFile))
+	if err != nil {
+		return task, err
+	}
+	if err := yaml.Unmarshal(data, &task); err != nil {
+		return task, fmt.Errorf("%s: %w", filepath.Join(dir, benchTaskFile), err)
+	}
+	task.dir = dir
+	if task.Name == "" {
+		task.Name = filepath.Base(dir)
+	}
+	if strings.TrimSpace(task.Prompt) == "" {
+		return task, fmt.Errorf("task %s has no prompt", task.Name)
+	}
+	if task.Timeout != "" {
+		if _, err := time.ParseDuration(task.Timeout); err != nil {
+			return task, fmt.Errorf("task %s: invalid timeout: %w", task.Name, err)
+		}
+	}
+	return task, nil
+}
+
+type benchRunner struct {
+	exe     string
+	timeout time.Duration
+	keep    bool
+	verbose bool
+}
+
+// run executes one task in a fresh workspace: copy the starting files, run
+// setup, send the prompt to a one-shot cando, then run verify.
+func (b benchRunner) run(ctx context.Context, task benchTask) (result benchResult) {
+	result.Task = task.Name
+	ws, err := os.MkdirTemp("", "cando-bench-")
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	defer func() {
+		if b.keep {
+			fmt.Printf("  workspace kept at %s\n", ws)
+			return
+		}
+		os.RemoveAll(ws)
+		if storage, err := agent.ProjectStorageRoot(ws); err == nil {
+			os.RemoveAll(storage)
+		}
+	}()
+
+	if template := filepath.Join(task.dir, "workspace"); dirExists(template) {
+		if err := copyTree(template, ws); err != nil {
+			result.Error = fmt.Sprintf("copy workspace: %v", err)
+			return result
+		}
+	}
+	if task.Setup != "" {
+		if out, err := b.script(ctx, ws, task.Setup); err != nil {
+			result.Error = fmt.Sprintf("setup: %v", err)
+			result.VerifyOutput = tail(out)
+			return result
+		}
+	}
+
+	timeout := b.timeout
+	if task.Timeout != "" {
+		timeout, _ = time.ParseDuration(task.Timeout)
+	}
+	statsPath := filepath.Join(os.TempDir(), fmt.Sprintf("cando-bench-stats-%d.json", time.Now().UnixNano()))
+	defer os.Remove(statsPath)
+	runCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	cmd := exec.CommandContext(runCtx, b.exe, "-p", task.Prompt, "--sandbox", ws, "--stats-file", statsPath)
+	cmd.Dir = ws
+	cmd.WaitDelay = benchStopWait
+	var output bytes.Buffer
+	cmd.Stdout, cmd.Stderr = b.sink(&output), b.sink(&output)
+	start := time.Now()
+	runErr := cmd.Run()
+	result.WallSeconds = time.Since(start).Seconds()
+
+	var stats runStats
+	if data, err := os.ReadFile(statsPath); err == nil {
+		json.Unmarshal(data, &stats)
+	}
+	result.Requests = stats.Requests
+	result.Tokens = stats.Tokens
+	result.ToolCalls = stats.ToolCalls
+	switch {
+	case runCtx.Err() == context.DeadlineExceeded:
+		result.Error = fmt.Sprintf("agent run exceeded %s", timeout)
+	case stats.Error != "":
+		result.Error = "agent: " + stats.Error
+	case runErr != nil:
+		result.Error = fmt.Sprintf("agent: %v", runErr)
+	}
+	if result.Error != "" {
+		result.VerifyOutput = tail(output.Bytes())
+		return result
+	}
+
+	if task.Verify == "" {
+		result.Success = true
+		return result
+	}
+	out, err := b.script(ctx, ws, task.Verify)
+	if err != nil {
+		result.Error = fmt.Sprintf("verify: %v", err)
+		result.VerifyOutput = tail(out)
+		return result
+	}
+	result.Success = true
+	return result
+}
+
+func (b benchRunner) sink(buf *bytes.Buffer) io.Writer {
+	if b.verbose {
+		return io.MultiWriter(buf, os.Stderr)
+	}
+	return buf
+}
+
+// script runs a setup or verify script with the platform shell.
+func (b benchRunner) script(ctx context.Context, dir, script string) ([]byte, error) {
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "cmd", "/C", script)
+	} else {
+		cmd = exec.CommandContext(ctx, "sh", "-c", script)
+	}
+	cmd.Dir = dir
+	var output bytes.Buffer
+	cmd.Stdout, cmd.Stderr = b.sink(&output), b.sink(&output)
+	err := cmd.Run()
+	return output.Bytes(), err
+}
+
+func tail(out []byte) string {
+	s := strings.TrimSpace(string(out))
+	if len(s) > benchOutputTail {
+		s = "…" + s[len(s)-benchOutputTail:]
+	}
+	return s
+}
+
+func dirExists(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
+}
+
+// copyTree copies the files under src into dst, keeping file modes.
+func copyTree(src, dst string) error {
+	return filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		if d.IsDir() {
+			return os.MkdirAll(target, 0o755)
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(target, data, info.Mode().Perm())
+	})
+}
+
+func summarizeBench(results []benchResult) benchSummary {
+	var sum benchSummary
+	for _, r := range results {
+		sum.Tasks++
+		if r.Success {
+			sum.Passed++
+		}
+		sum.Requests += r.Requests
+		sum.Tokens += r.Tokens
+		sum.ToolCalls += r.ToolCalls
+		sum.WallSeconds += r.WallSeconds
+	}
+	if sum.Tasks > 0 {
+		sum.SuccessRate = float64(sum.Passed) / float64(sum.Tasks)
+	}
+	return sum
+}
+
+func readBenchReport(path string) (*benchReport, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read baseline: %w", err)
+	}
+	var report benchReport
+	if err := json.Unmarshal(data, &report); err != nil {
+		return nil, fmt.Errorf("parse baseline %s: %w", path, err)
+	}
+	return &report, nil
+}
+
+// printBenchReport prints one row per task and a totals row. With a
+// baseline, each number is followed by the earlier run's value.
+func printBenchReport(w io.Writer, report, baseline *benchReport) {
+	before := make(map[string]benchResult)
+	if baseline != nil {
+		for _, r := range baseline.Results {
+			before[r.Task] = r
+		}
+		fmt.Fprintf(w, "Comparing %s against %s\n\n", benchRunName(report), benchRunName(baseline))
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "TASK\tRESULT\tTURNS\tTOKENS\tTOOL CALLS\tWALL")
+	for _, r := range report.Results {
+		prev, ok := before[r.Task]
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", r.Task,
+			compareText(passText(r.Success), passText(prev.Success), ok),
+			compareInt(r.Requests, prev.Requests, ok),
+			compareInt(r.Tokens, prev.Tokens, ok),
+			compareInt(r.ToolCalls, prev.ToolCalls, ok),
+			compareSeconds(r.WallSeconds, prev.WallSeconds, ok))
+	}
+	sum := report.Summary
+	hasBaseline := baseline != nil
+	var prev benchSummary
+	if hasBaseline {
+		prev = baseline.Summary
+	}
+	fmt.Fprintf(tw, "TOTAL\t%s\t%s\t%s\t%s\t%s\n",
+		compareText(fmt.Sprintf("%d/%d (%.0f%%)", sum.Passed, sum.Tasks, sum.SuccessRate*100),
+			fmt.Sprintf("%d/%d (%.0f%%)", prev.Passed, prev.Tasks, prev.SuccessRate*100), hasBaseline),
+		compareInt(sum.Requests, prev.Requests, hasBaseline),
+		compareInt(sum.Tokens, prev.Tokens, hasBaseline),
+		compareInt(sum.ToolCalls, prev.ToolCalls, hasBaseline),
+		compareSeconds(sum.WallSeconds, prev.WallSeconds, hasBaseline))
+	tw.Flush()
+}
+
+func benchRunName(r *benchReport) string {
+	name := r.Label
+	if name == "" {
+		name = strings.Trim(r.Provider+"/"+r.Model, "/")
+	}
+	if name == "" {
+		name = "run"
+	}
+	return fmt.Sprintf("%s (%s)", name, r.Started.Local().Format("2006-01-02 15:04"))
+}
+
+func passText(ok bool) string {
+	if ok {
+		return "pass"
+	}
+	return "fail"
+}
+
+func compareText(now, before string, hasBefore bool) string {
+	if !hasBefore || now == before {
+		return now
+	}
+	return fmt.Sprintf("%s (was %s)", now, before)
+}
+
+func compareInt(now, before int, hasBefore bool) string {
+	if !hasBefore || before == 0 {
+		return fmt.Sprint(now)
+	}
+	return fmt.Sprintf("%d (%+.0f%%)", now, 100*float64(now-before)/float64(before))
+}
+
+func compareSeconds(now, before float64, hasBefore bool) string {
+	if !hasBefore || before == 0 {
+		return fmt.Sprintf("%.1fs", now)
+	}
+	return fmt.Sprintf("%.1fs (%+.0f%%)", now, 100*(now-before)/before)
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeBenchTask(t *testing.T, dir, taskYAML string, files map[string]string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Join(dir, "workspace"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	os.WriteFile(filepath.Join(dir, benchTaskFile), []byte(taskYAML), 0o644)
+	for name, content := range files {
+		os.WriteFile(filepath.Join(dir, "workspace", name), []byte(content), 0o644)
+	}
+}
+
+func TestLoadBenchTasks(t *testing.T) {
+	root := t.TempDir()
+	writeBenchTask(t, filepath.Join(root, "b-fix"), "name: fix-parser\nprompt: Fix it\ntimeout: 2m\n", nil)
+	writeBenchTask(t, filepath.Join(root, "a-add"), "prompt: Add a flag\n", nil)
+	os.MkdirAll(filepath.Join(root, "notes"), 0o755) // No task.yaml: skipped
+
+	tasks, err := loadBenchTasks(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tasks) != 2 || tasks[0].Name != "a-add" || tasks[1].Name != "fix-parser" || tasks[1].Timeout != "2m" {
+		t.Fatalf("tasks = %+v", tasks)
+	}
+	if single, err := loadBenchTasks(filepath.Join(root, "a-add")); err != nil || len(single) != 1 || single[0].Name != "a-add" {
+		t.Errorf("single task dir = %+v, %v", single, err)
+	}
+
+	for yaml, want := range map[string]string{
+		"name: empty\n":                 "has no prompt",
+		"prompt: x\ntimeout: soon\n":    "invalid timeout",
+		"prompt: [unterminated\n":       benchTaskFile,
+		"prompt: x\nsetup: true\n":      "",
+		"prompt: x\nverify: 'exit 0'\n": "",
+		"prompt: x\ntimeout: 1h30m\n":   "",
+		"prompt: '   '\nverify: true\n": "has no prompt",
+	} {
+		dir := filepath.Join(t.TempDir(), "task")
+		writeBenchTask(t, dir, yaml, nil)
+		_, err := loadBenchTasks(dir)
+		if want == "" && err != nil || want != "" && (err == nil || !strings.Contains(err.Error(), want)) {
+			t.Errorf("%q: err = %v, want %q", yaml, err, want)
+		}
+	}
+}
+
+// fakeCando stands in for the cando binary: it acts on the workspace given
+// by --sandbox and writes the --stats-file like `cando -p` does.
+const fakeCando = `#!/bin/sh
+prompt="$2" stats="$6"
+case "$prompt" in
+slow) sleep 30 ;;
+fail) echo '{"requests":1,"tokens":50,"tool_calls":0,"error":"provider unavailable"}' > "$stats"; exit 1 ;;
+*) echo "$prompt" > answer.txt
+   echo '{"requests":3,"tokens":1200,"tool_calls":2}' > "$stats" ;;
+esac
+`
+
+func TestBenchRunner(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake cando is a shell script")
+	}
+	t.Setenv("CANDO_CONFIG_DIR", t.TempDir())
+	exe := filepath.Join(t.TempDir(), "cando")
+	if err := os.WriteFile(exe, []byte(fakeCando), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	runner := benchRunner{exe: exe, timeout: time.Minute}
+
+	cases := []struct {
+		name    string
+		task    benchTask
+		success bool
+		err     string
+		output  string
+	}{
+		{"pass", benchTask{Prompt: "42", Setup: "test -f input.txt && echo ready > setup.txt", Verify: "test -f setup.txt && grep -q 42 answer.txt"}, true, "", ""},
+		{"no verify", benchTask{Prompt: "hi"}, true, "", ""},
+		{"verify fails", benchTask{Prompt: "41", Verify: "echo wrong answer; grep -q 42 answer.txt"}, false, "verify: exit status 1", "wrong answer"},
+		{"setup fails", benchTask{Prompt: "42", Setup: "echo no toolchain >&2; exit 3"}, false, "setup: exit status 3", "no toolchain"},
+		{"agent error", benchTask{Prompt: "fail", Verify: "true"}, false, "agent: provider unavailable", ""},
+		{"timeout", benchTask{Prompt: "slow", Timeout: "100ms"}, false, "agent run exceeded 100ms", ""},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.task.Name = tc.name
+			tc.task.dir = t.TempDir()
+			writeBenchTask(t, tc.task.dir, "prompt: unused\n", map[string]string{"input.txt": "data"})
+			result := runner.run(t.Context(), tc.task)
+			if result.Success != tc.success || result.Error != tc.err || !strings.Contains(result.VerifyOutput, tc.output) {
+				t.Errorf("result = %+v, want success %v, error %q, output containing %q", result, tc.success, tc.err, tc.output)
+			}
+			if tc.name == "timeout" && result.WallSeconds > (benchStopWait+5*time.Second).Seconds() {
+				t.Errorf("timed-out run took %.1fs; its children kept the runner waiting", result.WallSeconds)
+			}
+			if tc.name == "pass" && (result.Requests != 3 || result.Tokens != 1200 || result.ToolCalls != 2 || result.WallSeconds <= 0) {
+				t.Errorf("stats = %+v", result)
+			}
+		})
+	}
+}
+
+func TestPrintBenchReport(t *testing.T) {
+	started := time.Date(2026, 3, 1, 9, 0, 0, 0, time.UTC)
+	baseline := &benchReport{Label: "before", Started: started, Results: []benchResult{
+		{Task: "add-flag", Success: false, Requests: 4, Tokens: 2000, ToolCalls: 5, WallSeconds: 20},
+		{Task: "fix-parser", Success: true, Requests: 2, Tokens: 1000, ToolCalls: 2, WallSeconds: 10},
+	}}
+	baseline.Summary = summarizeBench(baseline.Results)
+	report := &benchReport{Provider: "openrouter", Model: "m1", Started: started, Results: []benchResult{
+		{Task: "add-flag", Success: true, Requests: 2, Tokens: 1000, ToolCalls: 5, WallSeconds: 10},
+		{Task: "fix-parser", Success: true, Requests: 3, Tokens: 1500, ToolCalls: 2, WallSeconds: 10},
+		{Task: "new-task", Success: false, Requests: 1, Tokens: 10, WallSeconds: 1.5, Error: "verify: exit status 1"},
+	}}
+	report.Summary = summarizeBench(report.Results)
+	if sum := report.Summary; sum.Tasks != 3 || sum.Passed != 2 || sum.Tokens != 2510 || sum.WallSeconds != 21.5 || sum.SuccessRate < 0.66 || sum.SuccessRate > 0.67 {
+		t.Errorf("summary = %+v", sum)
+	}
+
+	var out bytes.Buffer
+	printBenchReport(&out, report, baseline)
+	text := out.String()
+	for _, want := range []string{
+		"Comparing openrouter/m1 (",
+		"against before (",
+		"pass (was fail)",
+		"1000 (-50%)",
+		"1500 (+50%)",
+		"10.0s (-50%)",
+		"new-task",
+		"1.5s",
+		"2/3 (67%) (was 1/2 (50%))",
+	} {
+		if !strings.Contains(text, want) {
+			t.Errorf("report lacks %q:\n%s", want, text)
+		}
+	}
+	for _, line := range strings.Split(text, "\n") {
+		if strings.HasPrefix(line, "new-task") && strings.Contains(line, "%") {
+			t.Errorf("task missing from the baseline was compared: %q", line)
+		}
+	}
+
+	out.Reset()
+	printBenchReport(&out, report, nil)
+	if strings.Contains(out.String(), "Comparing") || strings.Contains(out.String(), "was") || !strings.Contains(out.String(), "2/3 (67%)") {
+		t.Errorf("report without baseline:\n%s", out.String())
+	}
+}
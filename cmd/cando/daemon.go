@@ -0,0 +1,301 @@
+package main
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+	"unicode"
+
+	"cando/internal/config"
+)
+
+// daemonEnv marks a process started by `cando daemon`; it writes the PID
+// file and never opens a browser.
+const daemonEnv = "CANDO_DAEMON"
+
+func daemonMode() bool {
+	return os.Getenv(daemonEnv) == "1"
+}
+
+func pidFilePath() string {
+	return filepath.Join(config.GetConfigDir(), "cando.pid")
+}
+
+func daemonLogPath() string {
+	return filepath.Join(config.GetConfigDir(), "daemon.log")
+}
+
+// readPID returns the PID recorded in the PID file when that process is
+// still alive.
+func readPID() (int, bool) {
+	data, err := os.ReadFile(pidFilePath())
+	if err != nil {
+		return 0, false
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil || pid <= 0 {
+		return 0, false
+	}
+	return pid, processAlive(pid)
+}
+
+// writePIDFile records this process and returns a function removing the
+// file again, unless another process has replaced it meanwhile.
+func writePIDFile() (func(), error) {
+	if pid, alive := readPID(); alive && pid != os.Getpid() {
+		return nil, fmt.Errorf("cando daemon already running (pid %d)", pid)
+	}
+	path := pidFilePath()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(path, []byte(strconv.Itoa(os.Getpid())+"\n"), 0o644); err != nil {
+		return nil, err
+	}
+	return func() {
+		if pid, _ := readPID(); pid == os.Getpid() {
+			os.Remove(path)
+		}
+	}, nil
+}
+
+// runDaemon implements `cando daemon <command>`. For "run" it prepares the
+// process and returns false so main continues as a foreground server.
+func runDaemon(args []string) (bool, error) {
+	if len(args) == 0 {
+		return true, errors.New("usage: cando daemon start|stop|status|run|install [server flags]")
+	}
+	command, rest := args[0], args[1:]
+	switch command {
+	case "run":
+		os.Setenv(daemonEnv, "1")
+		os.Args = append([]string{os.Args[0]}, rest...)
+		return false, nil
+	case "start":
+		return true, daemonStart(rest)
+	case "stop":
+		return true, daemonStop()
+	case "status":
+		return true, daemonStatus()
+	case "install":
+		return true, daemonInstall(rest)
+	default:
+		return true, fmt.Errorf("unknown daemon command %q", command)
+	}
+}
+
+// daemonStart re-executes cando in the background with its output appended
+// to daemon.log.
+func daemonStart(serverArgs []string) error {
+	if pid, alive := readPID(); alive {
+		return fmt.Errorf("already running (pid %d)", pid)
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(config.GetConfigDir(), 0o755); err != nil {
+		return err
+	}
+	logFile, err := os.OpenFile(daemonLogPath(), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	defer logFile.Close()
+
+	cmd := exec.Command(exe, serverArgs...)
+	cmd.Env = append(os.Environ(), daemonEnv+"=1")
+	cmd.Stdout = logFile
+	cmd.Stderr = logFile
+	cmd.SysProcAttr = detachedProcAttr()
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("start daemon: %w", err)
+	}
+	exited := make(chan error, 1)
+	go func() { exited <- cmd.Wait() }()
+	select {
+	case err := <-exited:
+		return fmt.Errorf("daemon exited during startup (%v); see %s", err, daemonLogPath())
+	case <-time.After(1500 * time.Millisecond):
+	}
+	fmt.Printf("Cando daemon started (pid %d)\nLogs: %s, %s\n", cmd.Process.Pid, daemonLogPath(), filepath.Join(config.GetConfigDir(), "cando.log"))
+	return nil
+}
+
+func daemonStop() error {
+	pid, alive := readPID()
+	if !alive {
+		os.Remove(pidFilePath())
+		fmt.Println("Cando daemon is not running")
+		return nil
+	}
+	if err := stopProcess(pid); err != nil {
+		return fmt.Errorf("stop pid %d: %w", pid, err)
+	}
+	for deadline := time.Now().Add(10 * time.Second); time.Now().Before(deadline); time.Sleep(200 * time.Millisecond) {
+		if !processAlive(pid) {
+			os.Remove(pidFilePath())
+			fmt.Printf("Cando daemon stopped (pid %d)\n", pid)
+			return nil
+		}
+	}
+	return fmt.Errorf("pid %d did not exit within 10s", pid)
+}
+
+func daemonStatus() error {
+	pid, alive := readPID()
+	if !alive {
+		fmt.Println("Cando daemon is not running")
+		return nil
+	}
+	fmt.Printf("Cando daemon is running (pid %d)\n", pid)
+	return nil
+}
+
+const systemdUnit = `[Unit]
+Description=Cando coding agent
+After=network-online.target
+
+[Service]
+Type=simple
+ExecStart={{systemd .Exe}} daemon run{{range .Args}} {{systemd .}}{{end}}
+Restart=on-failure
+RestartSec=5
+
+[Install]
+WantedBy=default.target
+`
+
+const launchdPlist = `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+  <key>Label</key>
+  <string>{{xml .Label}}</string>
+  <key>ProgramArguments</key>
+  <array>
+    <string>{{xml .Exe}}</string>
+    <string>daemon</string>
+    <string>run</string>{{range .Args}}
+    <string>{{xml .}}</string>{{end}}
+  </array>
+  <key>RunAtLoad</key>
+  <true/>
+  <key>KeepAlive</key>
+  <true/>
+  <key>StandardOutPath</key>
+  <string>{{xml .Log}}</string>
+  <key>StandardErrorPath</key>
+  <string>{{xml .Log}}</string>
+</dict>
+</plist>
+`
+
+// unitFuncs escape values for the unit formats: systemd splits ExecStart
+// on whitespace and expands % specifiers and $ variables, and plist
+// strings are XML text.
+var unitFuncs = template.FuncMap{
+	"systemd": systemdQuote,
+	"xml": func(s string) (string, error) {
+		var b strings.Builder
+		err := xml.EscapeText(&b, []byte(s))
+		return b.String(), err
+	},
+}
+
+// systemdQuote returns s as a single ExecStart word.
+func systemdQuote(s string) string {
+	s = strings.NewReplacer("%", "%%", "$", "$$").Replace(s)
+	if s != "" && !strings.ContainsFunc(s, func(r rune) bool {
+		return unicode.IsSpace(r) || r == '"' || r == '\'' || r == '\\' || r == ';'
+	}) {
+		return s
+	}
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+// renderServiceUnit fills in the systemd unit or launchd plist template.
+func renderServiceUnit(text, exe, label, logPath string, args []string) (string, error) {
+	var out strings.Builder
+	data := map[string]any{"Exe": exe, "Args": args, "Log": logPath, "Label": label}
+	if err := template.Must(template.New("unit").Funcs(unitFuncs).Parse(text)).Execute(&out, data); err != nil {
+		return "", err
+	}
+	return out.String(), nil
+}
+
+// daemonInstall writes a systemd user unit (Linux) or launchd agent
+// (macOS) that runs `cando daemon run` with the given server flags, or
+// prints it with --print.
+func daemonInstall(args []string) error {
+	// --print is ours; every other argument is passed to the server
+	printOnly := false
+	var serverArgs []string
+	for _, arg := range args {
+		if arg == "--print" || arg == "-print" {
+			printOnly = true
+			continue
+		}
+		serverArgs = append(serverArgs, arg)
+	}
+
+	// Each profile gets its own service so they can run side by side
+	name, label := "cando", "dev.cando.agent"
+	if profile := config.ActiveProfile(); profile != "" {
+		name, label = "cando-"+profile, label+"."+profile
+		isProfileFlag := func(arg string) bool {
+			return arg == "--profile" || arg == "-profile" ||
+				strings.HasPrefix(arg, "--profile=") || strings.HasPrefix(arg, "-profile=")
+		}
+		if !slices.ContainsFunc(serverArgs, isProfileFlag) {
+			serverArgs = append([]string{"--profile", profile}, serverArgs...)
+		}
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return err
+	}
+	var path, text, next string
+	switch runtime.GOOS {
+	case "linux":
+		path = filepath.Join(home, ".config", "systemd", "user", name+".service")
+		text = systemdUnit
+		next = "systemctl --user daemon-reload && systemctl --user enable --now " + name + "\n(run `loginctl enable-linger $USER` to keep it running after logout)"
+	case "darwin":
+		path = filepath.Join(home, "Library", "LaunchAgents", label+".plist")
+		text = launchdPlist
+		next = "launchctl load -w " + path
+	default:
+		return fmt.Errorf("service install is not supported on %s; use `cando daemon start`", runtime.GOOS)
+	}
+	unit, err := renderServiceUnit(text, exe, label, daemonLogPath(), serverArgs)
+	if err != nil {
+		return err
+	}
+	if printOnly {
+		fmt.Print(unit)
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, []byte(unit), 0o644); err != nil {
+		return err
+	}
+	fmt.Printf("Wrote %s\nEnable it with:\n  %s\n", path, next)
+	return nil
+}
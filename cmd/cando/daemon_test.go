@@ -0,0 +1,62 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var updateGolden = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+func TestServiceUnitGolden(t *testing.T) {
+	exe := "/opt/My Apps/cando%1"
+	logPath := "/home/dev/.config/cando & co/daemon.log"
+	args := []string{"--profile", "work", "--workspace", "/srv/code <main>", `--title=say "hi"`, "$HOME", ""}
+
+	cases := []struct {
+		golden string
+		text   string
+	}{
+		{"systemd.service.golden", systemdUnit},
+		{"launchd.plist.golden", launchdPlist},
+	}
+	for _, tc := range cases {
+		t.Run(tc.golden, func(t *testing.T) {
+			got, err := renderServiceUnit(tc.text, exe, "dev.cando.agent.work", logPath, args)
+			if err != nil {
+				t.Fatal(err)
+			}
+			path := filepath.Join("testdata", tc.golden)
+			if *updateGolden {
+				if err := os.WriteFile(path, []byte(got), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			want, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != string(want) {
+				t.Errorf("%s mismatch (run with -update to rewrite)\n got:\n%s\nwant:\n%s", tc.golden, got, want)
+			}
+		})
+	}
+}
+
+func TestSystemdQuote(t *testing.T) {
+	cases := map[string]string{
+		"/usr/bin/cando": "/usr/bin/cando",
+		"--port=8080":    "--port=8080",
+		"50%":            "50%%",
+		"$HOME":          "$$HOME",
+		"two words":      `"two words"`,
+		`a"b\c`:          `"a\"b\\c"`,
+		"":               `""`,
+	}
+	for in, want := range cases {
+		if got := systemdQuote(in); got != want {
+			t.Errorf("systemdQuote(%q) = %s, want %s", in, got, want)
+		}
+	}
+}
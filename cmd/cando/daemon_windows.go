@@ -0,0 +1,38 @@
+//go:build windows
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+const (
+	createNewProcessGroup = 0x00000200
+	detachedProcess       = 0x00000008
+)
+
+// detachedProcAttr starts the daemon without a console so it outlives the
+// terminal that launched it.
+func detachedProcAttr() *syscall.SysProcAttr {
+	return &syscall.SysProcAttr{CreationFlags: createNewProcessGroup | detachedProcess}
+}
+
+func processAlive(pid int) bool {
+	proc, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	proc.Release()
+	return true
+}
+
+// stopProcess terminates the daemon; Windows has no SIGTERM equivalent for
+// detached processes.
+func stopProcess(pid int) error {
+	proc, err := os.FindProcess(pid)
+	if err != nil {
+		return err
+	}
+	return proc.Kill()
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"cando/internal/agent"
+	"cando/internal/credentials"
+)
+
+// runDiagnose writes a diagnostics bundle for bug reports. It works without
+// a running server, reading logs and provider errors from the config
+// directory.
+func runDiagnose(args []string) error {
+	fs := flag.NewFlagSet("diagnose", flag.ExitOnError)
+	out := fs.String("out", "", "Write the bundle here (default: cando-diagnostics-<time>.zip)")
+	errorCount := fs.Int("errors", agent.DefaultDiagnosticsErrors, "Number of recent provider errors to include")
+	fs.String("profile", "", "Config profile to diagnose (applied before parsing)")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: cando diagnose [flags]\n\nCollects version and platform details, the config with secrets redacted,\nrecent logs and provider errors into a zip to attach to a bug report.\n\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 0 {
+		fs.Usage()
+		return errors.New("unexpected arguments")
+	}
+
+	opts := agent.DiagnosticsOptions{Version: Version, ProviderErrors: *errorCount}
+	if manager, err := credentials.NewManager(); err == nil {
+		if creds, err := manager.Load(); err == nil {
+			opts.Secrets = agent.CredentialSecrets(creds)
+		}
+	}
+	path := *out
+	if path == "" {
+		path = fmt.Sprintf("cando-diagnostics-%s.zip", time.Now().Format("20060102-150405"))
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	if err := agent.WriteDiagnosticsBundle(f, opts); err != nil {
+		f.Close()
+		os.Remove(path)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	fmt.Printf("Wrote %s\nReview it before sharing: secrets are redacted, but logs can include file names and prompts.\n", path)
+	return nil
+}
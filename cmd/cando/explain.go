@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"cando/internal/agent"
+)
+
+// explainOptions are the flags of `cando explain`.
+type explainOptions struct {
+	out string
+}
+
+// parseExplainArgs parses `cando explain [flags] [dir]` and returns the
+// main flags it stands for. The agent is then set up as for -p, and
+// runExplain runs instead of a prompt.
+func parseExplainArgs(args []string) ([]string, explainOptions, error) {
+	fs := flag.NewFlagSet("explain", flag.ExitOnError)
+	out := fs.String("out", "", "Also write the overview to this file")
+	takeover := fs.Bool("force-takeover", false, "Start even if another Cando instance holds the project lock")
+	fs.String("profile", "", "Config profile to use (applied before parsing)")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: cando explain [flags] [dir]\n\nExplores the workspace (default: current directory) with read-only tools and\nwrites an overview: architecture, entry points, and how to build and test.\nIt is saved in the project's data directory and shown in the web UI.\n\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() > 1 {
+		fs.Usage()
+		return nil, explainOptions{}, errors.New("at most one directory")
+	}
+	dir := "."
+	if fs.NArg() == 1 {
+		dir = fs.Arg(0)
+	}
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		return nil, explainOptions{}, fmt.Errorf("%s is not a directory", dir)
+	}
+	mainArgs := []string{"--sandbox", dir}
+	if *takeover {
+		mainArgs = append(mainArgs, "--force-takeover")
+	}
+	return mainArgs, explainOptions{out: *out}, nil
+}
+
+// runExplain writes the workspace overview and prints it.
+func runExplain(agentInstance *agent.Agent, opts explainOptions) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	overview, path, err := agentInstance.ExplainWorkspace(ctx, func(message string) {
+		fmt.Fprintln(os.Stderr, message)
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Println(overview)
+	fmt.Fprintf(os.Stderr, "Saved to %s\n", path)
+	if opts.out != "" {
+		if err := os.WriteFile(opts.out, []byte(overview+"\n"), 0o644); err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "Wrote %s\n", opts.out)
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"cando/internal/agent"
+	"cando/internal/config"
+)
+
+// runExport implements `cando export`: write a stored session as Markdown
+// or portable JSON. It reads the conversation files, so no server needs to
+// be running.
+func runExport(args []string) error {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	workspace := fs.String("workspace", ".", "Workspace the session belongs to")
+	format := fs.String("format", "markdown", "Output format: markdown or json")
+	out := fs.String("o", "", "Write to this file instead of stdout")
+	fs.String("profile", "", "Config profile whose sessions to read (applied before parsing)")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: cando export [flags] [session]\n\nWithout a session key, exports the most recently updated session.\nMarkdown collapses thinking and tool calls; JSON can be read back with\n`cando import` or the web UI.\n\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() > 1 {
+		fs.Usage()
+		return errors.New("unexpected arguments")
+	}
+
+	root, err := filepath.Abs(*workspace)
+	if err != nil {
+		return err
+	}
+	exp, err := agent.ExportWorkspaceSession(root, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	var data []byte
+	switch *format {
+	case "markdown", "md":
+		data = []byte(exp.Markdown())
+	case "json":
+		if data, err = json.MarshalIndent(exp, "", "  "); err != nil {
+			return err
+		}
+		data = append(data, '\n')
+	default:
+		return fmt.Errorf("unknown format %q", *format)
+	}
+	if *out == "" {
+		_, err = os.Stdout.Write(data)
+		return err
+	}
+	if err := os.WriteFile(*out, data, 0o644); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Exported %s (%d messages) to %s\n", exp.Key, len(exp.Messages), *out)
+	return nil
+}
+
+// runImport implements `cando import`: recreate a session from a JSON
+// export in a workspace. The workspace must not be open in a running Cando,
+// whose web UI imports instead.
+func runImport(args []string) error {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	workspace := fs.String("workspace", ".", "Workspace to create the session in")
+	key := fs.String("key", "", "Session key (default: the exported key, suffixed if taken)")
+	fs.String("profile", "", "Config profile whose sessions to write (applied before parsing)")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: cando import [flags] <file.json|->\n\nReads a session written by `cando export -format json`.\n\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("expected one export file")
+	}
+
+	var data []byte
+	var err error
+	if fs.Arg(0) == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(fs.Arg(0))
+	}
+	if err != nil {
+		return err
+	}
+	exp, err := agent.ParseSessionExport(data)
+	if err != nil {
+		return err
+	}
+	root, err := filepath.Abs(*workspace)
+	if err != nil {
+		return err
+	}
+	if info, err := os.Stat(root); err != nil || !info.IsDir() {
+		return fmt.Errorf("workspace %s is not a directory", root)
+	}
+	cfg, err := config.LoadUserConfig()
+	if err != nil {
+		cfg = config.Config{}
+	}
+	imported, err := agent.ImportWorkspaceSession(cfg, root, exp, *key)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Imported %d messages into session %s of %s\n", len(exp.Messages), imported, root)
+	return nil
+}
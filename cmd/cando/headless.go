@@ -0,0 +1,44 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// headlessToken returns the bearer token for --headless: web.auth_token when
+// set, otherwise a new random token, which the caller prints.
+func headlessToken(configured string) (token string, generated bool, err error) {
+	if token := strings.TrimSpace(configured); token != "" {
+		return token, false, nil
+	}
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		return "", false, fmt.Errorf("generate API token: %w", err)
+	}
+	return hex.EncodeToString(buf), true, nil
+}
+
+// loopbackHost reports whether host only accepts connections from this
+// machine.
+func loopbackHost(host string) bool {
+	if strings.EqualFold(host, "localhost") {
+		return true
+	}
+	ip := net.ParseIP(strings.Trim(host, "[]"))
+	return ip != nil && ip.IsLoopback()
+}
+
+// printAPIToken shows how to authenticate against a headless server. A
+// configured token is not echoed.
+func printAPIToken(token string, generated bool) {
+	switch {
+	case token == "":
+	case generated:
+		fmt.Printf("→ API token: %s\n  Send it as \"Authorization: Bearer <token>\"; set web.auth_token to keep one across restarts\n", token)
+	default:
+		fmt.Println("→ API token: from web.auth_token; send it as \"Authorization: Bearer <token>\"")
+	}
+}
@@ -29,9 +29,15 @@ import (
 	"cando/internal/llm"
 	mockclient "cando/internal/llm/mockclient"
 	"cando/internal/logging"
+	"cando/internal/ollama"
+	"cando/internal/openai"
 	"cando/internal/openrouter"
+	"cando/internal/projectlock"
 	"cando/internal/prompts"
+	"cando/internal/safefile"
 	"cando/internal/state"
+	"cando/internal/testmode"
+	"cando/internal/timefmt"
 	"cando/internal/tooling"
 	"cando/internal/zai"
 
@@ -42,16 +48,85 @@ import (
 var Version = "dev"
 
 func main() {
+	if err := applyProfileFlag(os.Args[1:]); err != nil {
+		fmt.Fprintf(os.Stderr, "cando: %v\n", err)
+		os.Exit(2)
+	}
+	if len(os.Args) > 1 && os.Args[1] == "attach" {
+		if err := runAttach(os.Args[2:]); err != nil {
+			fmt.Fprintf(os.Stderr, "cando attach: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "bench" {
+		if err := runBench(os.Args[2:]); err != nil {
+			fmt.Fprintf(os.Stderr, "cando bench: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "diagnose" {
+		if err := runDiagnose(os.Args[2:]); err != nil {
+			fmt.Fprintf(os.Stderr, "cando diagnose: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+	if len(os.Args) > 1 && (os.Args[1] == "export" || os.Args[1] == "import") {
+		run := runExport
+		if os.Args[1] == "import" {
+			run = runImport
+		}
+		if err := run(os.Args[2:]); err != nil {
+			fmt.Fprintf(os.Stderr, "cando %s: %v\n", os.Args[1], err)
+			os.Exit(1)
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "daemon" {
+		handled, err := runDaemon(os.Args[2:])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "cando daemon: %v\n", err)
+			os.Exit(1)
+		}
+		if handled {
+			return
+		}
+	}
+
+	// `cando explain` sets up the agent as -p does, then writes the overview
+	explainMode := len(os.Args) > 1 && os.Args[1] == "explain"
+	var explainOpts explainOptions
+	if explainMode {
+		args, opts, err := parseExplainArgs(os.Args[2:])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "cando explain: %v\n", err)
+			os.Exit(2)
+		}
+		os.Args, explainOpts = append(os.Args[:1], args...), opts
+	}
+
 	// Parse flags
 	var (
 		sandboxPath  = flag.String("sandbox", "", "Override workspace root/sandbox directory")
 		resumeKey    = flag.String("resume", "", "Resume an existing session key")
 		listSessions = flag.Bool("list-sessions", false, "List stored sessions for this workspace and exit")
 		port         = flag.Int("port", 0, "Port for web UI (default: 3737, beta: 8787)")
+		grpcAddr     = flag.String("grpc", "", "Listen address for the gRPC control API, e.g. 127.0.0.1:3738 (disabled when empty; other than loopback needs -headless)")
+		socketFlag   = flag.String("socket", "", "Serve the web API on this Unix socket instead of TCP (overrides web.socket)")
 		promptFlag   = flag.String("p", "", "Execute a single prompt and exit (non-interactive mode)")
 		setupFlag    = flag.Bool("setup", false, "Run credential setup wizard")
 		versionFlag  = flag.Bool("version", false, "Print version and exit")
+		listProfiles = flag.Bool("list-profiles", false, "List config profiles and exit")
+		takeover     = flag.Bool("force-takeover", false, "Start even if another Cando instance holds the project lock")
+		statsFile    = flag.String("stats-file", "", "With -p, write the run's requests, tokens and tool calls as JSON to this file")
+		demoFlag     = flag.Bool("demo", false, "Serve a read-only demo with a sample project; nothing of yours is read or changed")
+		headlessFlag = flag.Bool("headless", false, "Serve the web API for scripts and CI: no browser, and every request needs the API token")
+		hostFlag     = flag.String("host", "127.0.0.1", "Interface the web server listens on, e.g. 0.0.0.0 for all (other than loopback needs -headless)")
 	)
+	// Applied by applyProfileFlag before parsing; registered for usage output
+	flag.String("profile", "", "Use the named config profile under ~/.cando/profiles (or set "+config.ProfileEnv+")")
 	flag.StringVar(promptFlag, "prompt", "", "Execute a single prompt and exit (non-interactive mode)")
 	flag.Parse()
 
@@ -59,6 +134,10 @@ func main() {
 		fmt.Printf("Cando version %s\n", Version)
 		return
 	}
+	if *listProfiles {
+		printProfileList()
+		return
+	}
 
 	// Handle credential setup
 	if *setupFlag {
@@ -72,10 +151,41 @@ func main() {
 		return
 	}
 
-	// Load credential manager
-	credManager, err := credentials.NewManager()
-	if err != nil {
-		log.Fatalf("Failed to initialize credential manager: %v", err)
+	// A demo runs from a throwaway config directory holding the sample
+	// project, so the user's config, credentials and sessions stay out of it
+	var demoDir string
+	if *demoFlag {
+		if *promptFlag != "" {
+			log.Fatal("--demo serves the web UI and cannot be combined with -p.")
+		}
+		dir, err := os.MkdirTemp("", "cando-demo-")
+		if err != nil {
+			log.Fatalf("Failed to create demo directory: %v", err)
+		}
+		defer os.RemoveAll(dir)
+		os.Setenv("CANDO_CONFIG_DIR", filepath.Join(dir, "config"))
+		project, err := agent.PrepareDemo(dir)
+		if err != nil {
+			log.Fatalf("Failed to prepare demo: %v", err)
+		}
+		*sandboxPath = project
+		*resumeKey = agent.DemoSession
+		demoDir = dir
+	}
+
+	// Load credential manager. Test mode keeps credentials and config in
+	// memory and pins the clock (see internal/testmode).
+	var credManager agent.CredentialManager
+	if testmode.Enabled() {
+		hooks := testmode.Apply(config.DefaultConfig(), nil)
+		defer hooks.Restore()
+		credManager = hooks.Credentials
+	} else {
+		fileManager, err := credentials.NewManager()
+		if err != nil {
+			log.Fatalf("Failed to initialize credential manager: %v", err)
+		}
+		credManager = fileManager
 	}
 
 	creds, err := credManager.Load()
@@ -126,10 +236,29 @@ func main() {
 	// Set the logging package's logger to use the file instead of stdout
 	logging.Logger = logger
 
+	if daemonMode() {
+		removePID, err := writePIDFile()
+		if err != nil {
+			log.Fatalf("%v", err)
+		}
+		defer removePID()
+		logger.Printf("running as daemon (pid %d)", os.Getpid())
+	}
+	if profile := config.ActiveProfile(); profile != "" {
+		logger.Printf("using config profile %s (%s)", profile, configDir)
+	}
+
 	// Determine provider from credentials (may be empty for first-run)
 	activeProvider := strings.ToLower(creds.DefaultProvider)
 	hasCredentials := creds.HasAnyProvider()
 
+	// A local Ollama server works without any credentials
+	if !hasCredentials && ollama.Reachable(cfg.OllamaURL) {
+		hasCredentials = true
+		activeProvider = "ollama"
+		logger.Printf("No credentials configured; using Ollama at %s", cfg.OllamaURL)
+	}
+
 	// Track which provider is being used
 	if hasCredentials && activeProvider != "" {
 		analytics.TrackProvider(activeProvider)
@@ -165,6 +294,17 @@ func main() {
 		if err := os.MkdirAll(dataRoot, 0o755); err != nil {
 			log.Fatalf("Failed to create project storage root: %v", err)
 		}
+		// Listing sessions only reads, so it works next to a running instance
+		if !*listSessions {
+			lock, err := projectlock.AcquireWithin(dataRoot, *takeover, restartLockWait())
+			if err != nil {
+				log.Fatal(err)
+			}
+			defer lock.Release()
+			if lock.Displaced != nil {
+				logger.Printf("WARNING: took over project lock from %s", lock.Displaced)
+			}
+		}
 
 		cfg.ConversationDir = filepath.Join(dataRoot, "conversations")
 		cfg.MemoryStorePath = filepath.Join(dataRoot, "memory.db")
@@ -174,38 +314,42 @@ func main() {
 	// when user selects a workspace via GetOrCreateWorkspaceContext
 
 	prompts.SetMetadata(buildEnvironmentMetadata(absRoot))
+	safefile.SetSync(cfg.IsSyncWritesEnabled())
+
+	// Provider builders, also used by the agent for dynamic reloading
+	providerBuilders := map[string]agent.ProviderBuilder{
+		"zai":        buildZAIRegistration,
+		"openrouter": buildOpenRouterRegistration,
+		"openai":     buildOpenAIRegistration,
+		"azure":      buildAzureRegistration,
+		"ollama":     buildOllamaRegistration,
+	}
 
 	// Build provider registrations using credentials or mock client for tests
 	var client llm.Client
 	mockMode := os.Getenv("CANDO_MOCK_LLM") == "1"
-	if mockMode {
-		logger.Println("CANDO_MOCK_LLM=1 detected; using mock LLM client")
+	if mockMode || demoDir != "" {
+		logger.Println("CANDO_MOCK_LLM=1 or --demo; using mock LLM client")
 		client = mockclient.New()
 		hasCredentials = true
 		activeProvider = "mock"
 	} else if hasCredentials {
-		providerRegs := make([]agent.ProviderRegistration, 0, 2)
-
-		if creds.IsConfigured("zai") {
-			if reg, err := buildZAIRegistration(cfg, creds.GetAPIKey("zai"), logger); err != nil {
-				if activeProvider == "zai" {
-					log.Fatalf("Failed to init Z.AI provider: %v", err)
-				}
-				logger.Printf("Warning: Z.AI provider init failed: %v", err)
-			} else if reg != nil {
-				providerRegs = append(providerRegs, *reg)
+		providerRegs := make([]agent.ProviderRegistration, 0, len(providerBuilders))
+		for _, key := range config.KnownProviders() {
+			build, ok := providerBuilders[key]
+			if !ok || (config.RequiresAPIKey(key) && !creds.IsConfigured(key)) {
+				continue
 			}
-		}
-
-		if creds.IsConfigured("openrouter") {
-			if reg, err := buildOpenRouterRegistration(cfg, creds.GetAPIKey("openrouter"), logger); err != nil {
-				if activeProvider == "openrouter" {
-					log.Fatalf("Failed to init OpenRouter provider: %v", err)
+			reg, err := build(cfg, creds.GetAPIKey(key), logger)
+			if err != nil {
+				if activeProvider == key {
+					log.Fatalf("Failed to init %s provider: %v", key, err)
 				}
-				logger.Printf("Warning: OpenRouter provider init failed: %v", err)
-			} else if reg != nil {
-				providerRegs = append(providerRegs, *reg)
+				logger.Printf("Warning: %s provider init failed: %v", key, err)
+				continue
 			}
+			reg.Scope = creds.GetScope(key)
+			providerRegs = append(providerRegs, *reg)
 		}
 
 		// Select client
@@ -245,25 +389,33 @@ func main() {
 		if states == nil {
 			log.Fatal("--list-sessions requires a workspace. Use --sandbox to specify one.")
 		}
-		keys := states.ListKeys()
-		printSessionList(keys)
+		printSessionList(states.Summaries())
 		return
 	}
 
 	// Set up tools
-	// For web UI without workspace, these will be overridden per-workspace
+	// For web UI without workspace, these will be overridden per-workspace.
+	// Settings that reload read the agent's config, so the tools reach it
+	// through agentInstance, which is set before any tool runs.
+	var agentInstance *agent.Agent
 	toolOpts := tooling.Options{
-		WorkspaceRoot:       absRoot,
-		ShellTimeout:        cfg.ShellTimeout(),
-		BinDir:              globalBinDir(),
-		ExternalData:        true,
-		CredManager:         credManager,
-		ZAIVisionURL:        cfg.ZAIVisionURL,
-		OpenRouterVisionURL: cfg.OpenRouterVisionURL,
+		WorkspaceRoot:         absRoot,
+		ShellTimeout:          cfg.ShellTimeout(),
+		BinDir:                globalBinDir(),
+		ExternalData:          true,
+		CredManager:           credManager,
+		ZAIVisionURL:          cfg.ZAIVisionURL,
+		OpenRouterVisionURL:   cfg.OpenRouterVisionURL,
+		LargeFileLimit:        cfg.LargeFileLimit(),
+		AllowExternalSymlinks: cfg.AllowExternalSymlinks,
+		GitAuthor:             cfg.GitAuthor,
+		ShellSandbox:          func() config.ShellSandbox { return agentInstance.ShellSandbox(absRoot)() },
+		ShellCommands:         func() config.ShellCommandRule { return agentInstance.ShellCommands(absRoot)() },
 	}
 	if dataRoot != "" {
 		toolOpts.PlanPath = filepath.Join(dataRoot, "plan.json")
 		toolOpts.ProcessDir = filepath.Join(dataRoot, "processes")
+		toolOpts.TrashDir = filepath.Join(dataRoot, "trash")
 	}
 	baseTools := tooling.DefaultTools(toolOpts)
 
@@ -285,11 +437,17 @@ func main() {
 		Config:   cfg,
 		Provider: activeProvider,
 		Model:    profileModel,
+		IDSeed:   memoryIDSeed(),
 	})
 	if err != nil {
 		log.Fatalf("Failed to init context profile: %v", err)
 	}
 	allTools := append(baseTools, profile.Tools()...)
+	if absRoot != "" {
+		mcpServers := tooling.ConnectMCPServers(context.Background(), cfg.MCPServersFor(absRoot), absRoot, Version, logger)
+		defer mcpServers.Close()
+		allTools = append(allTools, mcpServers.Tools()...)
+	}
 	tools := tooling.NewRegistry(allTools...)
 
 	// Set tool definitions in profile for compaction calculations
@@ -299,24 +457,68 @@ func main() {
 		setter.SetToolDefinitions(tools.Definitions())
 	}
 
-	// Create agent with provider builders for dynamic reloading
-	providerBuilders := map[string]agent.ProviderBuilder{
-		"zai":        buildZAIRegistration,
-		"openrouter": buildOpenRouterRegistration,
+	// gRPC control API is opt-in: -grpc flag wins over CANDO_GRPC_ADDR
+	grpcListen := strings.TrimSpace(os.Getenv("CANDO_GRPC_ADDR"))
+	if *grpcAddr != "" {
+		grpcListen = *grpcAddr
+	}
+	if demoDir != "" {
+		grpcListen = "" // The control API can send prompts
+	}
+
+	// Headless mode guards the API with a bearer token; without one the
+	// server must stay on loopback
+	host := strings.TrimSpace(*hostFlag)
+	var apiToken string
+	var tokenGenerated bool
+	if *headlessFlag {
+		apiToken, tokenGenerated, err = headlessToken(cfg.Web.AuthToken)
+		if err != nil {
+			log.Fatalf("Headless mode: %v", err)
+		}
+	} else if !loopbackHost(host) {
+		log.Fatalf("-host %s would expose Cando to the network without authentication; add -headless", host)
+	}
+	if grpcListen != "" {
+		grpcHost, _, err := net.SplitHostPort(grpcListen)
+		if err != nil {
+			log.Fatalf("Invalid gRPC address %q: %v", grpcListen, err)
+		}
+		if !loopbackHost(grpcHost) && apiToken == "" {
+			log.Fatalf("-grpc %s would expose the control API to the network without authentication; add -headless", grpcListen)
+		}
 	}
 
-	agentInstance := agent.New(client, cfg, "", states, profile, tools, logger, credManager, agent.Options{
+	agentInstance = agent.New(client, cfg, "", states, profile, tools, logger, credManager, agent.Options{
 		ResumeKey:        strings.TrimSpace(*resumeKey),
 		WorkspaceRoot:    absRoot,
 		ProviderBuilders: providerBuilders,
 		ActiveProvider:   activeProvider,
 		ProfileModel:     profileModel,
 		Version:          Version,
+		GRPCAddr:         grpcListen,
+		ForceTakeover:    *takeover,
+		MemoryIDSeed:     memoryIDSeed(),
+		DemoDir:          demoDir,
+		APIToken:         apiToken,
 	}, toolOpts)
 
+	if explainMode {
+		if err := runExplain(agentInstance, explainOpts); err != nil {
+			log.Fatalf("Explain failed: %v", err)
+		}
+		return
+	}
+
 	// Handle one-shot prompt mode
 	if *promptFlag != "" {
-		if err := runOneShotPrompt(agentInstance, *promptFlag); err != nil {
+		err := runOneShotPrompt(agentInstance, *promptFlag)
+		if *statsFile != "" {
+			if writeErr := writeRunStats(*statsFile, agentInstance.Usage(), err); writeErr != nil {
+				logger.Printf("write run stats: %v", writeErr)
+			}
+		}
+		if err != nil {
 			log.Fatalf("Prompt failed: %v", err)
 		}
 		return
@@ -334,6 +536,30 @@ func main() {
 		cancel()
 	}()
 
+	// A Unix socket replaces the TCP listener; there is no browser to open
+	socket := cfg.Web.Socket
+	if *socketFlag != "" {
+		socket = *socketFlag
+	}
+	if socket != "" {
+		listenAddr := "unix:" + socket
+		if checkExistingInstance("http", listenAddr) {
+			fmt.Printf("Cando is already running on %s\n", socket)
+			return
+		}
+		fmt.Printf("Starting Cando...\n")
+		fmt.Printf("→ Web API: unix socket %s\n", socket)
+		if grpcListen != "" {
+			fmt.Printf("→ gRPC API: %s\n", grpcListen)
+		}
+		printAPIToken(apiToken, tokenGenerated)
+		fmt.Println()
+		if err := agentInstance.RunWeb(ctx, listenAddr); err != nil {
+			log.Fatalf("Web API failed: %v", err)
+		}
+		return
+	}
+
 	// Determine port - beta uses 8787, stable uses 3737
 	listenPort := 3737
 	if exe, err := os.Executable(); err == nil {
@@ -353,28 +579,37 @@ func main() {
 	}
 
 	// Check if port is already in use by another cando instance
-	listenAddr := fmt.Sprintf("127.0.0.1:%d", listenPort)
-	if existingCando := checkExistingInstance(listenAddr); existingCando {
-		fmt.Printf("Cando is already running at http://%s\n", listenAddr)
+	listenAddr := net.JoinHostPort(host, strconv.Itoa(listenPort))
+	scheme := cfg.Web.Scheme()
+	if existingCando := checkExistingInstance(scheme, listenAddr); existingCando {
+		fmt.Printf("Cando is already running at %s://%s\n", scheme, listenAddr)
 		// Don't auto-open browser in dev mode (air handles reloading)
-		if os.Getenv("DEV_MODE") == "" {
+		if os.Getenv("DEV_MODE") == "" && !daemonMode() && !*headlessFlag {
 			fmt.Println("Opening browser...")
-			openBrowser("http://" + listenAddr)
+			openBrowser(scheme + "://" + listenAddr)
 		}
 		return
 	}
 
 	// Find available port if preferred port is taken by something else
-	listenAddr = findAvailablePort(listenPort)
+	listenAddr = findAvailablePort(host, listenPort)
 
 	// Start web UI
 	fmt.Printf("Starting Cando...\n")
-	fmt.Printf("→ Web UI: http://%s\n", listenAddr)
+	if *headlessFlag {
+		fmt.Printf("→ Web API (headless): %s://%s\n", scheme, listenAddr)
+	} else {
+		fmt.Printf("→ Web UI: %s://%s\n", scheme, listenAddr)
+	}
+	if grpcListen != "" {
+		fmt.Printf("→ gRPC API: %s\n", grpcListen)
+	}
+	printAPIToken(apiToken, tokenGenerated)
 	fmt.Println()
 
-	// Auto-open browser (skip in dev mode and when restarting after update)
-	if os.Getenv("DEV_MODE") == "" && os.Getenv("CANDO_RESTARTING") == "" {
-		go openBrowser("http://" + listenAddr)
+	// Auto-open browser (skip in dev mode, headless mode and when restarting after update)
+	if os.Getenv("DEV_MODE") == "" && os.Getenv("CANDO_RESTARTING") == "" && !daemonMode() && !*headlessFlag {
+		go openBrowser(scheme + "://" + listenAddr)
 	}
 
 	if err := agentInstance.RunWeb(ctx, listenAddr); err != nil {
@@ -387,9 +622,9 @@ func runOneShotPrompt(agentInstance *agent.Agent, prompt string) error {
 	return agentInstance.RunOneShot(ctx, prompt)
 }
 
-func findAvailablePort(startPort int) string {
+func findAvailablePort(host string, startPort int) string {
 	for port := startPort; port < startPort+100; port++ {
-		addr := fmt.Sprintf("127.0.0.1:%d", port)
+		addr := net.JoinHostPort(host, strconv.Itoa(port))
 		listener, err := net.Listen("tcp", addr)
 		if err == nil {
 			listener.Close()
@@ -397,14 +632,18 @@ func findAvailablePort(startPort int) string {
 		}
 	}
 	// Fallback to let OS pick
-	return "127.0.0.1:0"
+	return net.JoinHostPort(host, "0")
 }
 
 // checkExistingInstance checks if cando is already running on the given address
-// by calling /api/health endpoint
-func checkExistingInstance(addr string) bool {
+// (host:port or unix:/path) by calling /api/health endpoint
+func checkExistingInstance(scheme, addr string) bool {
 	// First check if port is in use at all
-	conn, err := net.DialTimeout("tcp", addr, 500*time.Millisecond)
+	network, dialAddr := "tcp", addr
+	if path, ok := strings.CutPrefix(addr, "unix:"); ok {
+		network, dialAddr = "unix", path
+	}
+	conn, err := net.DialTimeout(network, dialAddr, 500*time.Millisecond)
 	if err != nil {
 		// Port not in use
 		return false
@@ -412,27 +651,30 @@ func checkExistingInstance(addr string) bool {
 	conn.Close()
 
 	// Port is in use, check if it's cando via health endpoint
-	client := &http.Client{Timeout: 2 * time.Second}
-	resp, err := client.Get("http://" + addr + "/api/health")
+	client, baseURL := agent.WebClient(addr, scheme, 2*time.Second)
+	resp, err := client.Get(baseURL + "/api/health")
 	if err != nil {
 		// Something is on the port but not responding to HTTP
 		return false
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
+	// An unhealthy instance answers 503 but is still running
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusServiceUnavailable {
 		return false
 	}
 
-	// Check response body for cando signature
+	// Check response body for cando signature; an instance running another
+	// profile does not count
 	var health struct {
-		Status string `json:"status"`
+		Status  string `json:"status"`
+		Profile string `json:"profile"`
 	}
 	if err := json.NewDecoder(resp.Body).Decode(&health); err != nil {
 		return false
 	}
 
-	return health.Status == "ok"
+	return health.Status != "" && health.Profile == config.ActiveProfile()
 }
 
 func projectStorageRoot(workspace string) (string, error) {
@@ -440,6 +682,24 @@ func projectStorageRoot(workspace string) (string, error) {
 	return filepath.Join(config.GetConfigDir(), "projects", slug), nil
 }
 
+// memoryIDSeed fixes generated memory IDs in test mode; 0 seeds from the
+// clock.
+func memoryIDSeed() int64 {
+	if testmode.Enabled() {
+		return testmode.Seed
+	}
+	return 0
+}
+
+// restartLockWait is how long to wait for the project lock. After a
+// restart the previous process may still be exiting and holding it.
+func restartLockWait() time.Duration {
+	if os.Getenv("CANDO_RESTARTING") != "" {
+		return 10 * time.Second
+	}
+	return 0
+}
+
 func projectSlug(path string) string {
 	clean := filepath.Clean(path)
 	base := sanitizeSlug(filepath.Base(clean))
@@ -466,14 +726,61 @@ func sanitizeSlug(name string) string {
 	return strings.Trim(b.String(), "-")
 }
 
-func printSessionList(keys []string) {
-	if len(keys) == 0 {
+// applyProfileFlag selects the profile named by --profile before anything
+// reads the config directory, so subcommands such as attach and daemon
+// honour it too. The selection is exported through CANDO_PROFILE, which
+// child processes inherit.
+func applyProfileFlag(args []string) error {
+	for i, arg := range args {
+		if arg == "--" {
+			break
+		}
+		var name string
+		switch {
+		case arg == "--profile" || arg == "-profile":
+			if i+1 >= len(args) {
+				return fmt.Errorf("--profile requires a name")
+			}
+			name = args[i+1]
+		case strings.HasPrefix(arg, "--profile="), strings.HasPrefix(arg, "-profile="):
+			name = arg[strings.Index(arg, "=")+1:]
+		default:
+			continue
+		}
+		if !config.ValidProfileName(name) {
+			return fmt.Errorf("invalid profile name %q (use letters, digits, '.', '_' and '-')", name)
+		}
+		return os.Setenv(config.ProfileEnv, name)
+	}
+	if name := strings.TrimSpace(os.Getenv(config.ProfileEnv)); name != "" && !config.ValidProfileName(name) {
+		return fmt.Errorf("invalid %s %q", config.ProfileEnv, name)
+	}
+	return nil
+}
+
+func printProfileList() {
+	active := config.ActiveProfile()
+	marker := func(name string) string {
+		if name == active {
+			return "*"
+		}
+		return " "
+	}
+	fmt.Printf("%s (default)  %s\n", marker(""), config.BaseConfigDir())
+	for _, name := range config.ListProfiles() {
+		fmt.Printf("%s %s  %s\n", marker(name), name, filepath.Join(config.BaseConfigDir(), "profiles", name))
+	}
+}
+
+func printSessionList(sessions []state.Summary) {
+	if len(sessions) == 0 {
 		fmt.Println("No stored sessions for this workspace yet.")
 		return
 	}
-	fmt.Printf("Stored sessions (%d):\n", len(keys))
-	for i, key := range keys {
-		fmt.Printf("  %d) %s\n", i+1, key)
+	fmt.Printf("Stored sessions (%d):\n", len(sessions))
+	now := time.Now()
+	for i, s := range sessions {
+		fmt.Printf("  %d) %-24s %4d messages  %s\n", i+1, s.Key, s.MessageCount, timefmt.Relative(s.UpdatedAt, now))
 	}
 }
 
@@ -580,6 +887,83 @@ func buildOpenRouterRegistration(cfg config.Config, apiKey string, logger *log.L
 	}, nil
 }
 
+func buildOpenAIRegistration(cfg config.Config, apiKey string, logger *log.Logger) (*agent.ProviderRegistration, error) {
+	if apiKey == "" {
+		return nil, fmt.Errorf("OpenAI API key not configured")
+	}
+	endpoint := cfg.OpenAIBaseURL
+	if endpoint == "" {
+		return nil, fmt.Errorf("OpenAI base URL not configured in config")
+	}
+	client := openai.NewClient(endpoint, apiKey, cfg.RequestTimeout(), logger)
+	model := cfg.ModelFor("openai")
+	logger.Printf("OpenAI provider ready (model %s)", model)
+	return &agent.ProviderRegistration{
+		Option: agent.ProviderOption{
+			Key:    "openai",
+			Label:  fmt.Sprintf("OpenAI · %s", model),
+			Model:  model,
+			Source: "openai",
+		},
+		Client: client,
+	}, nil
+}
+
+func buildAzureRegistration(cfg config.Config, apiKey string, logger *log.Logger) (*agent.ProviderRegistration, error) {
+	if apiKey == "" {
+		return nil, fmt.Errorf("Azure OpenAI API key not configured")
+	}
+	endpoint := cfg.AzureOpenAIEndpoint
+	if endpoint == "" {
+		return nil, fmt.Errorf("Azure OpenAI endpoint not configured (set azure_openai_endpoint in config)")
+	}
+	apiVersion := cfg.AzureOpenAIAPIVersion
+	if apiVersion == "" {
+		apiVersion = config.DefaultConfig().AzureOpenAIAPIVersion
+	}
+	client := openai.NewAzureClient(endpoint, apiKey, apiVersion, cfg.RequestTimeout(), logger)
+	model := cfg.ModelFor("azure")
+	logger.Printf("Azure OpenAI provider ready (deployment %s)", model)
+	return &agent.ProviderRegistration{
+		Option: agent.ProviderOption{
+			Key:    "azure",
+			Label:  fmt.Sprintf("Azure OpenAI · %s", model),
+			Model:  model,
+			Source: "azure",
+		},
+		Client: client,
+	}, nil
+}
+
+// buildOllamaRegistration needs no key; it fails while no server answers.
+// When the configured model is not pulled, the first installed one is used.
+func buildOllamaRegistration(cfg config.Config, _ string, logger *log.Logger) (*agent.ProviderRegistration, error) {
+	baseURL := cfg.OllamaURL
+	if baseURL == "" {
+		baseURL = ollama.DefaultURL
+	}
+	models, err := ollama.InstalledModels(baseURL)
+	if err != nil {
+		return nil, fmt.Errorf("Ollama not reachable at %s: %w", baseURL, err)
+	}
+	model := cfg.ModelFor("ollama")
+	if len(models) > 0 && !ollama.HasModel(models, model) {
+		logger.Printf("Ollama model %s is not installed; using %s", model, models[0].ID)
+		model = models[0].ID
+	}
+	client := ollama.NewClient(baseURL, cfg.RequestTimeout(), logger)
+	logger.Printf("Ollama provider ready at %s (model %s)", baseURL, model)
+	return &agent.ProviderRegistration{
+		Option: agent.ProviderOption{
+			Key:    "ollama",
+			Label:  fmt.Sprintf("Ollama · %s", model),
+			Model:  model,
+			Source: "ollama",
+		},
+		Client: client,
+	}, nil
+}
+
 func providerLabels(regs []agent.ProviderRegistration) string {
 	if len(regs) == 0 {
 		return ""
@@ -0,0 +1,375 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// quickAction is a named operation the UI can list in a command palette and
+// invoke through /api/actions/run without a bespoke endpoint per action.
+type quickAction struct {
+	ID          string        `json:"id"`
+	Label       string        `json:"label"`
+	Description string        `json:"description"`
+	Shortcut    string        `json:"shortcut,omitempty"`
+	Params      []actionParam `json:"params,omitempty"`
+	// Exclusive actions cannot run while a conversation turn is in flight.
+	Exclusive bool `json:"-"`
+	run       func(ctx context.Context, s *webServer, wsCtx *WorkspaceContext, params map[string]any) (any, error)
+}
+
+type actionParam struct {
+	Name        string   `json:"name"`
+	Type        string   `json:"type"` // string | integer | boolean
+	Description string   `json:"description"`
+	Required    bool     `json:"required,omitempty"`
+	Enum        []string `json:"enum,omitempty"`
+}
+
+// errActionInput marks errors caused by bad parameters (HTTP 400).
+var errActionInput = errors.New("invalid action parameters")
+
+// lastTestCommands remembers the most recent test command per workspace,
+// run by run_tests or by the agent's shell tool, so run_tests can rerun it.
+var lastTestCommands = struct {
+	sync.Mutex
+	byWorkspace map[string]string
+}{byWorkspace: make(map[string]string)}
+
+var quickActions = []quickAction{
+	{
+		ID:          "compact",
+		Label:       "Compact conversation",
+		Description: "Summarize older messages to free context, keeping the most recent ones intact.",
+		Shortcut:    "mod+shift+k",
+		Exclusive:   true,
+		Params: []actionParam{
+			{Name: "protect", Type: "integer", Description: "Number of recent messages to keep verbatim (defaults to config)."},
+		},
+		run: runCompactAction,
+	},
+	{
+		ID:          "branch",
+		Label:       "Branch session",
+		Description: "Copy the current session into a new session, optionally only up to a message index.",
+		Shortcut:    "mod+shift+b",
+		Exclusive:   true,
+		Params: []actionParam{
+			{Name: "index", Type: "integer", Description: "Copy messages before this index (defaults to the whole session)."},
+		},
+		run: runBranchAction,
+	},
+	{
+		ID:          "toggle_plan_mode",
+		Label:       "Toggle plan mode",
+		Description: "Switch between plan-only and normal mode for this workspace.",
+		Shortcut:    "mod+shift+p",
+		Params: []actionParam{
+			{Name: "enabled", Type: "boolean", Description: "Set explicitly instead of toggling."},
+		},
+		run: runTogglePlanModeAction,
+	},
+	{
+		ID:          "switch_model",
+		Label:       "Switch model",
+		Description: "Change the main model for a provider (defaults to the active provider).",
+		Shortcut:    "mod+shift+m",
+		Params: []actionParam{
+			{Name: "model", Type: "string", Description: "Model identifier.", Required: true},
+			{Name: "provider", Type: "string", Description: "Provider key (defaults to the active provider)."},
+		},
+		run: runSwitchModelAction,
+	},
+	{
+		ID:          "run_tests",
+		Label:       "Rerun tests",
+		Description: "Run the workspace test command (last used, or detected from project files).",
+		Shortcut:    "mod+shift+t",
+		Params: []actionParam{
+			{Name: "command", Type: "string", Description: "Test command to run instead of the remembered or detected one."},
+		},
+		run: runTestsAction,
+	},
+}
+
+func findQuickAction(id string) *quickAction {
+	for i := range quickActions {
+		if quickActions[i].ID == id {
+			return &quickActions[i]
+		}
+	}
+	return nil
+}
+
+// handleActions lists the available quick actions.
+func (s *webServer) handleActions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.respondError(w, r, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	s.writeJSON(w, r, map[string]any{
+		"actions": quickActions,
+	})
+}
+
+// handleActionRun invokes a quick action by id.
+func (s *webServer) handleActionRun(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		s.respondError(w, r, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	var req struct {
+		ID     string         `json:"id"`
+		Params map[string]any `json:"params"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.respondError(w, r, http.StatusBadRequest, "invalid payload")
+		return
+	}
+	action := findQuickAction(strings.TrimSpace(req.ID))
+	if action == nil {
+		s.respondError(w, r, http.StatusNotFound, fmt.Sprintf("unknown action %q", req.ID))
+		return
+	}
+	if req.Params == nil {
+		req.Params = map[string]any{}
+	}
+	for _, param := range action.Params {
+		if _, ok := req.Params[param.Name]; param.Required && !ok {
+			s.respondError(w, r, http.StatusBadRequest, fmt.Sprintf("%s is required", param.Name))
+			return
+		}
+	}
+
+	workspace := s.getWorkspaceFromRequest(r)
+	if workspace == "" || !s.workspaceExists(workspace) {
+		s.respondError(w, r, http.StatusBadRequest, "select a workspace first")
+		return
+	}
+	wsCtx, err := s.agent.GetOrCreateWorkspaceContext(workspace)
+	if err != nil {
+		s.respondError(w, r, http.StatusInternalServerError, fmt.Sprintf("get workspace context: %v", err))
+		return
+	}
+	if action.Exclusive && wsCtx.HasInFlightRequest() {
+		s.respondError(w, r, http.StatusConflict, "another request is already running")
+		return
+	}
+
+	result, err := action.run(r.Context(), s, wsCtx, req.Params)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, errActionInput) {
+			status = http.StatusBadRequest
+		}
+		s.respondError(w, r, status, err.Error())
+		return
+	}
+	s.writeJSON(w, r, map[string]any{
+		"id":     action.ID,
+		"result": result,
+	})
+}
+
+func runCompactAction(ctx context.Context, s *webServer, wsCtx *WorkspaceContext, params map[string]any) (any, error) {
+	command := ":compact"
+	if _, ok := params["protect"]; ok {
+		protect, ok := actionIntParam(params, "protect")
+		if !ok || protect < 0 {
+			return nil, fmt.Errorf("%w: protect must be a non-negative integer", errActionInput)
+		}
+		command = fmt.Sprintf(":compact %d", protect)
+	}
+	var events []map[string]any
+	collect := func(eventType string, data any) error {
+		events = append(events, map[string]any{"type": eventType, "data": data})
+		return nil
+	}
+	if err := s.handleCompactCommand(ctx, command, wsCtx, collect); err != nil {
+		return nil, err
+	}
+	return map[string]any{"events": events}, nil
+}
+
+func runBranchAction(_ context.Context, s *webServer, wsCtx *WorkspaceContext, params map[string]any) (any, error) {
+	index := len(wsCtx.states.Current().Messages())
+	if _, ok := params["index"]; ok {
+		var valid bool
+		if index, valid = actionIntParam(params, "index"); !valid {
+			return nil, fmt.Errorf("%w: index must be an integer", errActionInput)
+		}
+	}
+	from := wsCtx.states.CurrentKey()
+	newKey, err := branchSession(wsCtx.states, index)
+	if err != nil {
+		return nil, err
+	}
+	recordBranchActivity(wsCtx, from, newKey, index, s.logger)
+	return map[string]any{"new_session_key": newKey}, nil
+}
+
+func runTogglePlanModeAction(_ context.Context, _ *webServer, wsCtx *WorkspaceContext, params map[string]any) (any, error) {
+	if raw, ok := params["enabled"]; ok {
+		enabled, isBool := raw.(bool)
+		if !isBool {
+			return nil, fmt.Errorf("%w: enabled must be a boolean", errActionInput)
+		}
+		wsCtx.planMode.Store(enabled)
+		return map[string]any{"plan_mode": enabled}, nil
+	}
+	// Two toggles at once must both take effect
+	enabled := !wsCtx.planMode.Load()
+	for !wsCtx.planMode.CompareAndSwap(!enabled, enabled) {
+		enabled = !wsCtx.planMode.Load()
+	}
+	return map[string]any{"plan_mode": enabled}, nil
+}
+
+func runSwitchModelAction(_ context.Context, s *webServer, _ *WorkspaceContext, params map[string]any) (any, error) {
+	model, _ := params["model"].(string)
+	model = strings.TrimSpace(model)
+	if model == "" {
+		return nil, fmt.Errorf("%w: model is required", errActionInput)
+	}
+	provider, _ := params["provider"].(string)
+	provider = strings.TrimSpace(provider)
+	if provider == "" {
+		provider = s.agent.ActiveProviderKey()
+	}
+	if provider == "" {
+		return nil, fmt.Errorf("%w: no active provider", errActionInput)
+	}
+	if err := s.updateProviderModel(provider, "main", model); err != nil {
+		return nil, err
+	}
+	return map[string]any{"provider": provider, "model": model}, nil
+}
+
+func runTestsAction(ctx context.Context, _ *webServer, wsCtx *WorkspaceContext, params map[string]any) (any, error) {
+	command, _ := params["command"].(string)
+	command = strings.TrimSpace(command)
+	if command == "" {
+		lastTestCommands.Lock()
+		command = lastTestCommands.byWorkspace[wsCtx.root]
+		lastTestCommands.Unlock()
+	}
+	if command == "" {
+		command = detectTestCommand(wsCtx.root)
+	}
+	if command == "" {
+		return nil, fmt.Errorf("%w: no test command detected; pass one with the command parameter", errActionInput)
+	}
+
+	shell, ok := wsCtx.tools.Lookup("shell")
+	if !ok {
+		return nil, errors.New("shell tool is not available")
+	}
+	output, err := shell.Call(ctx, map[string]any{
+		"command":         command,
+		"timeout_seconds": 300,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	lastTestCommands.Lock()
+	lastTestCommands.byWorkspace[wsCtx.root] = command
+	lastTestCommands.Unlock()
+
+	var result map[string]any
+	if err := json.Unmarshal([]byte(output), &result); err != nil {
+		return map[string]any{"command": command, "output": output}, nil
+	}
+	result["command"] = command
+	return result, nil
+}
+
+// rememberTestCommand records a shell tool call that ran the workspace's
+// tests from its root, so run_tests reruns what the agent last ran.
+func rememberTestCommand(root string, args map[string]any) {
+	if dir, _ := args["workdir"].(string); dir != "" && filepath.Clean(dir) != "." && filepath.Clean(dir) != filepath.Clean(root) {
+		return
+	}
+	var command string
+	switch v := args["command"].(type) {
+	case string:
+		command = strings.TrimSpace(v)
+	case []any:
+		parts := make([]string, 0, len(v))
+		for _, part := range v {
+			parts = append(parts, fmt.Sprint(part))
+		}
+		command = strings.Join(parts, " ")
+	}
+	if !isTestCommand(command) {
+		return
+	}
+	lastTestCommands.Lock()
+	lastTestCommands.byWorkspace[root] = command
+	lastTestCommands.Unlock()
+}
+
+// isTestCommand reports whether command runs a test suite: a test runner
+// such as pytest, a build tool's test command such as go test or npm run
+// test, or python -m pytest.
+func isTestCommand(command string) bool {
+	words := strings.Fields(command)
+	if len(words) == 0 {
+		return false
+	}
+	switch filepath.Base(words[0]) {
+	case "pytest", "jest", "vitest", "rspec", "phpunit", "tox":
+		return true
+	case "go", "cargo", "npm", "yarn", "pnpm", "bun", "make", "mvn", "gradle", "gradlew", "dotnet", "mix":
+		args := words[1:]
+		if len(args) > 0 && args[0] == "run" {
+			args = args[1:]
+		}
+		return len(args) > 0 && (args[0] == "test" || args[0] == "tests")
+	case "python", "python3":
+		return len(words) > 2 && words[1] == "-m" && (words[2] == "pytest" || words[2] == "unittest")
+	}
+	return false
+}
+
+// detectTestCommand guesses the project's test command from marker files.
+func detectTestCommand(root string) string {
+	markers := []struct {
+		file    string
+		command string
+	}{
+		{"go.mod", "go test ./..."},
+		{"Cargo.toml", "cargo test"},
+		{"package.json", "npm test"},
+		{"pyproject.toml", "pytest"},
+		{"pytest.ini", "pytest"},
+		{"Makefile", "make test"},
+	}
+	for _, marker := range markers {
+		if _, err := os.Stat(filepath.Join(root, marker.file)); err == nil {
+			return marker.command
+		}
+	}
+	return ""
+}
+
+func actionIntParam(params map[string]any, key string) (int, bool) {
+	switch v := params[key].(type) {
+	case float64:
+		if v != float64(int(v)) {
+			return 0, false
+		}
+		return int(v), true
+	case int:
+		return v, true
+	default:
+		return 0, false
+	}
+}
@@ -0,0 +1,131 @@
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"cando/internal/llm"
+	"cando/internal/state"
+)
+
+func TestQuickActionHandlers(t *testing.T) {
+	configDir := t.TempDir()
+	t.Setenv("CANDO_CONFIG_DIR", configDir)
+	workspace := t.TempDir()
+	manager := &WorkspaceManager{filePath: filepath.Join(configDir, "workspaces.json")}
+	if _, err := manager.Add(workspace); err != nil {
+		t.Fatal(err)
+	}
+	s := &webServer{
+		agent:            newTestAgent(t, newScriptedClient(), baseTestConfig(workspace)),
+		logger:           log.New(io.Discard, "", 0),
+		workspaceManager: manager,
+	}
+	wsCtx, err := s.agent.GetOrCreateWorkspaceContext(workspace)
+	if err != nil {
+		t.Fatal(err)
+	}
+	run := func(ws, body string) (*httptest.ResponseRecorder, map[string]any) {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		s.handleActionRun(rec, httptest.NewRequest(http.MethodPost, "/api/actions/run?"+url.Values{"workspace": {ws}}.Encode(), strings.NewReader(body)))
+		var resp struct {
+			Result map[string]any `json:"result"`
+		}
+		json.Unmarshal(rec.Body.Bytes(), &resp)
+		return rec, resp.Result
+	}
+
+	rec := httptest.NewRecorder()
+	s.handleActions(rec, httptest.NewRequest(http.MethodGet, "/api/actions", nil))
+	if !strings.Contains(rec.Body.String(), `"id":"toggle_plan_mode"`) || strings.Contains(rec.Body.String(), "exclusive") {
+		t.Errorf("actions = %s", rec.Body.String())
+	}
+
+	for _, tc := range []struct {
+		ws, body string
+		want     int
+	}{
+		{workspace, `{"id":"nope"}`, http.StatusNotFound},
+		{workspace, `{"id":"switch_model"}`, http.StatusBadRequest},
+		{workspace, `{"id":"toggle_plan_mode","params":{"enabled":"yes"}}`, http.StatusBadRequest},
+		{workspace, `{"id":"branch","params":{"index":1.5}}`, http.StatusBadRequest},
+		{t.TempDir(), `{"id":"toggle_plan_mode"}`, http.StatusBadRequest},
+	} {
+		if rec, _ := run(tc.ws, tc.body); rec.Code != tc.want {
+			t.Errorf("%s = %d %s, want %d", tc.body, rec.Code, rec.Body.String(), tc.want)
+		}
+	}
+
+	if _, result := run(workspace, `{"id":"toggle_plan_mode"}`); result["plan_mode"] != true || !wsCtx.planMode.Load() {
+		t.Errorf("toggle = %v", result)
+	}
+	if _, result := run(workspace, `{"id":"toggle_plan_mode"}`); result["plan_mode"] != false || wsCtx.planMode.Load() {
+		t.Errorf("toggle back = %v", result)
+	}
+	if _, result := run(workspace, `{"id":"toggle_plan_mode","params":{"enabled":true}}`); result["plan_mode"] != true || !wsCtx.planMode.Load() {
+		t.Errorf("enable = %v", result)
+	}
+
+	// run_tests remembers a command it was given and reruns it
+	if rec, result := run(workspace, `{"id":"run_tests","params":{"command":"echo tests passed"}}`); rec.Code != http.StatusOK || result["command"] != "echo tests passed" {
+		t.Fatalf("run_tests = %d %s", rec.Code, rec.Body.String())
+	}
+	if _, result := run(workspace, `{"id":"run_tests"}`); result["command"] != "echo tests passed" || !strings.Contains(fmt.Sprint(result), "tests passed\n") {
+		t.Errorf("rerun = %v", result)
+	}
+}
+
+func TestShellToolTestsAreRemembered(t *testing.T) {
+	t.Setenv("CANDO_CONFIG_DIR", t.TempDir())
+	workspace := t.TempDir()
+	os.WriteFile(filepath.Join(workspace, "Makefile"), []byte("test:\n\t@echo ok\n"), 0o644)
+	client := newScriptedClient(llm.ChatResponse{
+		Choices: []llm.ChatChoice{{
+			Message: state.Message{
+				Role: "assistant",
+				ToolCalls: []state.ToolCall{{
+					ID:       "call-1",
+					Type:     "function",
+					Function: state.FunctionCall{Name: "shell", Arguments: `{"command":"make test"}`},
+				}},
+			},
+			FinishReason: "tool_calls",
+		}},
+	}, llm.ChatResponse{
+		Choices: []llm.ChatChoice{{Message: state.Message{Role: "assistant", Content: "tests pass"}, FinishReason: "stop"}},
+	})
+	agent := newTestAgent(t, client, baseTestConfig(workspace))
+	if _, _, err := agent.respond(t.Context(), "run the tests"); err != nil {
+		t.Fatal(err)
+	}
+	lastTestCommands.Lock()
+	got := lastTestCommands.byWorkspace[workspace]
+	lastTestCommands.Unlock()
+	if got != "make test" {
+		t.Errorf("remembered %q, want make test", got)
+	}
+
+	for command, want := range map[string]bool{
+		"go test ./...":           true,
+		"npm run test -- --watch": true,
+		"python3 -m pytest -q":    true,
+		"pytest tests/":           true,
+		"go build ./...":          false,
+		"npm install":             false,
+		"echo test":               false,
+	} {
+		if got := isTestCommand(command); got != want {
+			t.Errorf("isTestCommand(%q) = %v, want %v", command, got, want)
+		}
+	}
+}
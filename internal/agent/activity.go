@@ -0,0 +1,237 @@
+package agent
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	activityFile         = "activity.jsonl"
+	activityDefaultLimit = 50
+	activityMaxLimit     = 500
+	// activityKeepEntries is how many entries survive compaction; the file
+	// is rewritten once it holds twice as many.
+	activityKeepEntries = 5000
+	activityPromptChars = 160
+)
+
+// Activity kinds shown in the workspace timeline.
+const (
+	activityPrompt          = "prompt"
+	activityFilesChanged    = "files_changed"
+	activityProcessStarted  = "process_started"
+	activityPathDeleted     = "path_deleted"
+	activitySessionBranched = "session_branched"
+	activityChangesResolved = "changes_resolved"
+	activityFilesUploaded   = "files_uploaded"
+)
+
+// activityMu serializes writes to workspace activity feeds.
+var activityMu sync.Mutex
+
+// activityEntry is one line of a workspace's activity.jsonl: a user-level
+// event such as a prompt run or a session branched, as opposed to the
+// per-turn metrics kept in the turn log.
+type activityEntry struct {
+	ID      int64          `json:"id"` // Unix nanoseconds; increases with time
+	Time    time.Time      `json:"time"`
+	Kind    string         `json:"kind"`
+	Session string         `json:"session,omitempty"`
+	Summary string         `json:"summary"`
+	Details map[string]any `json:"details,omitempty"`
+}
+
+func activityPath(workspaceRoot string) (string, error) {
+	storageRoot, err := ProjectStorageRoot(workspaceRoot)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(storageRoot, activityFile), nil
+}
+
+// lastActivityID keeps IDs unique when two entries share a timestamp.
+var lastActivityID int64
+
+// recordActivity appends an entry to the workspace activity feed. Failures
+// are logged and otherwise ignored: the feed is informational.
+func recordActivity(workspaceRoot string, entry activityEntry, logger *log.Logger) {
+	if workspaceRoot == "" {
+		return
+	}
+	if err := appendActivity(workspaceRoot, entry); err != nil && logger != nil {
+		logger.Printf("[ws:%s] activity write failed: %v", workspaceRoot, err)
+	}
+}
+
+func appendActivity(workspaceRoot string, entry activityEntry) error {
+	path, err := activityPath(workspaceRoot)
+	if err != nil {
+		return err
+	}
+	activityMu.Lock()
+	defer activityMu.Unlock()
+
+	now := time.Now().UTC()
+	entry.Time = now
+	entry.ID = max(now.UnixNano(), lastActivityID+1)
+	lastActivityID = entry.ID
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(append(data, '\n'))
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return compactActivityLocked(path)
+}
+
+// compactActivityLocked drops the oldest entries once the feed holds twice
+// activityKeepEntries lines.
+func compactActivityLocked(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	lines := bytes.Count(data, []byte{'\n'})
+	if lines <= 2*activityKeepEntries {
+		return nil
+	}
+	drop := lines - activityKeepEntries
+	for i := 0; i < drop; i++ {
+		data = data[bytes.IndexByte(data, '\n')+1:]
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// readActivity returns up to limit entries older than before (all when
+// before is 0), newest first, optionally filtered by kind. more reports
+// whether older matching entries remain.
+func readActivity(workspaceRoot string, before int64, limit int, kind string) (entries []activityEntry, more bool, err error) {
+	path, err := activityPath(workspaceRoot)
+	if err != nil {
+		return nil, false, err
+	}
+	activityMu.Lock()
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		activityMu.Unlock()
+		return []activityEntry{}, false, nil
+	}
+	if err != nil {
+		activityMu.Unlock()
+		return nil, false, err
+	}
+	var all []activityEntry
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var entry activityEntry
+		if json.Unmarshal(scanner.Bytes(), &entry) != nil {
+			continue
+		}
+		if (before == 0 || entry.ID < before) && (kind == "" || entry.Kind == kind) {
+			all = append(all, entry)
+		}
+	}
+	f.Close()
+	activityMu.Unlock()
+	if err := scanner.Err(); err != nil {
+		return nil, false, err
+	}
+
+	entries = make([]activityEntry, 0, min(limit, len(all)))
+	for i := len(all) - 1; i >= 0 && len(entries) < limit; i-- {
+		entries = append(entries, all[i])
+	}
+	return entries, len(all) > len(entries), nil
+}
+
+// recordBranchActivity notes a session branched from another.
+func recordBranchActivity(wsCtx *WorkspaceContext, from, to string, index int, logger *log.Logger) {
+	recordActivity(wsCtx.root, activityEntry{
+		Kind:    activitySessionBranched,
+		Session: to,
+		Summary: fmt.Sprintf("Branched %s from %s at message %d", to, from, index),
+		Details: map[string]any{"from": from, "to": to, "index": index},
+	}, logger)
+}
+
+// truncatePrompt shortens a prompt for the feed, keeping the first line.
+func truncatePrompt(prompt string) string {
+	prompt = strings.TrimSpace(prompt)
+	if first, _, found := strings.Cut(prompt, "\n"); found {
+		prompt = strings.TrimSpace(first) + " …"
+	}
+	if len(prompt) > activityPromptChars {
+		prompt = prompt[:activityPromptChars] + "…"
+	}
+	return prompt
+}
+
+// handleActivity serves the workspace activity feed, newest first.
+// Query parameters: limit, before (an entry id, for the next page) and kind.
+func (s *webServer) handleActivity(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.respondError(w, r, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	workspace := s.getWorkspaceFromRequest(r)
+	if workspace == "" || !s.workspaceExists(workspace) {
+		s.respondError(w, r, http.StatusBadRequest, "select a workspace first")
+		return
+	}
+	query := r.URL.Query()
+	limit := activityDefaultLimit
+	if raw := query.Get("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n <= 0 {
+			s.respondError(w, r, http.StatusBadRequest, "limit must be a positive integer")
+			return
+		}
+		limit = min(n, activityMaxLimit)
+	}
+	var before int64
+	if raw := query.Get("before"); raw != "" {
+		n, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || n <= 0 {
+			s.respondError(w, r, http.StatusBadRequest, "before must be an entry id")
+			return
+		}
+		before = n
+	}
+	entries, more, err := readActivity(workspace, before, limit, strings.TrimSpace(query.Get("kind")))
+	if err != nil {
+		s.respondError(w, r, http.StatusInternalServerError, fmt.Sprintf("read activity: %v", err))
+		return
+	}
+	payload := map[string]any{"entries": entries}
+	if more && len(entries) > 0 {
+		payload["next_before"] = entries[len(entries)-1].ID
+	}
+	s.writeJSON(w, r, payload)
+}
@@ -0,0 +1,72 @@
+package agent
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestActivityPagination(t *testing.T) {
+	t.Setenv("CANDO_CONFIG_DIR", t.TempDir())
+	workspace := t.TempDir()
+
+	entries, more, err := readActivity(workspace, 0, 10, "")
+	if err != nil || len(entries) != 0 || more {
+		t.Fatalf("empty feed = %v, %v, %v", entries, more, err)
+	}
+
+	for i := 0; i < 5; i++ {
+		kind := activityPrompt
+		if i%2 == 1 {
+			kind = activityFilesChanged
+		}
+		if err := appendActivity(workspace, activityEntry{Kind: kind, Summary: fmt.Sprintf("event %d", i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	page, more, err := readActivity(workspace, 0, 2, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page) != 2 || !more || page[0].Summary != "event 4" || page[1].Summary != "event 3" {
+		t.Fatalf("first page = %+v, more=%v", page, more)
+	}
+	if page[0].ID <= page[1].ID {
+		t.Errorf("ids not increasing: %d, %d", page[1].ID, page[0].ID)
+	}
+
+	rest, more, err := readActivity(workspace, page[1].ID, 10, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rest) != 3 || more || rest[0].Summary != "event 2" || rest[2].Summary != "event 0" {
+		t.Fatalf("second page = %+v, more=%v", rest, more)
+	}
+
+	changed, _, err := readActivity(workspace, 0, 10, activityFilesChanged)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changed) != 2 || changed[0].Summary != "event 3" || changed[1].Summary != "event 1" {
+		t.Errorf("filtered = %+v", changed)
+	}
+}
+
+func TestStartedProcess(t *testing.T) {
+	tests := []struct {
+		function string
+		args     map[string]any
+		want     string
+	}{
+		{"background_process", map[string]any{"action": "start", "command": []any{"npm", "run", "dev"}}, "npm run dev"},
+		{"background_process", map[string]any{"action": "stop", "id": "1"}, ""},
+		{"shell", map[string]any{"command": "make serve", "background": true}, "make serve"},
+		{"shell", map[string]any{"command": "make test"}, ""},
+	}
+	for _, tt := range tests {
+		got, ok := startedProcess(tt.function, tt.args)
+		if got != tt.want || ok != (tt.want != "") {
+			t.Errorf("startedProcess(%s, %v) = %q, %v; want %q", tt.function, tt.args, got, ok, tt.want)
+		}
+	}
+}
@@ -16,6 +16,7 @@ import (
 	"sync"
 	"sync/atomic"
 	"time"
+	"unicode/utf8"
 
 	prompt "github.com/c-bata/go-prompt"
 	"github.com/charmbracelet/glamour"
@@ -26,8 +27,11 @@ import (
 	"cando/internal/credentials"
 	"cando/internal/llm"
 	"cando/internal/logging"
+	"cando/internal/projectlock"
 	"cando/internal/prompts"
 	"cando/internal/state"
+	"cando/internal/timefmt"
+	"cando/internal/tokenizer"
 	"cando/internal/tooling"
 )
 
@@ -37,11 +41,20 @@ var commandSuggestions = []prompt.Suggest{
 	{Text: ":use", Description: "switch to an existing state"},
 	{Text: ":new", Description: "create and switch to a blank state"},
 	{Text: ":clear", Description: "wipe the current state's history"},
+	{Text: ":rename", Description: "set the current state's title (:rename <title>)"},
+	{Text: ":usage", Description: "show the tokens and cost of the current state"},
+	{Text: ":budget", Description: "show or change the current state's budget (:budget [continue|reset|hard_usd=5 ...])"},
 	{Text: ":drop", Description: "delete a stored state"},
 	{Text: ":tools", Description: "list registered tools"},
 	{Text: ":memories", Description: "inspect stored memories"},
 	{Text: ":compact", Description: "force a compaction pass (:compact [protect_count])"},
+	{Text: ":ingest", Description: "learn project facts from README, docs/ and ADRs"},
+	{Text: ":explain", Description: "explore the workspace and write an onboarding overview"},
+	{Text: ":export-knowledge", Description: "write project facts and memories to a file"},
+	{Text: ":import-knowledge", Description: "merge project facts and memories from a file"},
 	{Text: ":thinking", Description: "toggle thinking mode (:thinking on|off)"},
+	{Text: ":thinking-mode", Description: "keep, hide or discard this session's reasoning"},
+	{Text: ":revert", Description: "undo file changes of a turn or the conversation (:revert [last|n|all] [force])"},
 	{Text: ":reload", Description: "reload config (optionally provide path)"},
 	{Text: ":quit", Description: "exit the program"},
 	{Text: ":exit", Description: "exit the program"},
@@ -76,9 +89,26 @@ type WorkspaceContext struct {
 	states         *state.Manager
 	tools          *tooling.Registry
 	profile        contextprofile.Profile
+	mcpServers     *tooling.MCPServers // Connections behind the registry's mcp_ tools
 	root           string
-	planMode       bool // When true, LLM is instructed to only plan/analyze, not make changes
-	previewEnabled bool // When true, preview_file tool shows content in preview pane
+	planMode       atomic.Bool // When set, the LLM is instructed to only plan/analyze, not make changes
+	previewEnabled bool        // When true, preview_file tool shows content in preview pane
+
+	terminalMu      sync.Mutex
+	terminalRecords []*terminalRecord // User terminal commands not yet shown to the agent
+
+	recentMu    sync.Mutex
+	recentFiles map[string][]recentFile // Session key -> files its tools touched, newest first
+
+	requests requestTracker // Provider call in flight and tokens used by the workspace's turns
+
+	storageLock *projectlock.Lock // Held while the context uses the project storage
+
+	lastUsed atomic.Int64 // Unix nanoseconds of the last lookup or turn
+	turns    atomic.Int32 // Turns running in the context; never evicted while set
+	holds    atomic.Int32 // Terminals, sockets and task runs using the context; never evicted while set
+
+	submitMu sync.Mutex // Orders the busy check and start of submitted turns
 }
 
 // loadProjectInstructions reads the project instructions file for a workspace.
@@ -265,27 +295,10 @@ func (e *projectFactsExtractor) ExtractFacts(ctx context.Context, messages []sta
 		return fmt.Errorf("no response from LLM")
 	}
 
-	// Parse JSON response
-	responseText := strings.TrimSpace(resp.Choices[0].Message.Content)
-	var newFacts []string
-	if err := json.Unmarshal([]byte(responseText), &newFacts); err != nil {
-		// Try to extract JSON from response if it has extra text
-		start := strings.Index(responseText, "[")
-		end := strings.LastIndex(responseText, "]")
-		if start >= 0 && end > start {
-			if err := json.Unmarshal([]byte(responseText[start:end+1]), &newFacts); err != nil {
-				e.logger.Printf("failed to parse facts response: %v", err)
-				return nil // Don't fail on parse errors
-			}
-		} else {
-			e.logger.Printf("failed to parse facts response: %v", err)
-			return nil
-		}
-	}
-
-	// Limit to ~200 facts max
-	if len(newFacts) > 200 {
-		newFacts = newFacts[:200]
+	newFacts, err := parseFactsResponse(resp.Choices[0].Message.Content)
+	if err != nil {
+		e.logger.Printf("failed to parse facts response: %v", err)
+		return nil // Don't fail on parse errors
 	}
 
 	// Save updated facts
@@ -297,10 +310,35 @@ func (e *projectFactsExtractor) ExtractFacts(ctx context.Context, messages []sta
 	return nil
 }
 
+// maxProjectFacts caps the stored project facts.
+const maxProjectFacts = 200
+
+// parseFactsResponse decodes the JSON fact array returned by the model,
+// tolerating extra text around it, and caps it at maxProjectFacts.
+func parseFactsResponse(text string) ([]string, error) {
+	responseText := strings.TrimSpace(text)
+	var facts []string
+	if err := json.Unmarshal([]byte(responseText), &facts); err != nil {
+		// Try to extract JSON from response if it has extra text
+		start := strings.Index(responseText, "[")
+		end := strings.LastIndex(responseText, "]")
+		if start < 0 || end <= start {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(responseText[start:end+1]), &facts); err != nil {
+			return nil, err
+		}
+	}
+	if len(facts) > maxProjectFacts {
+		facts = facts[:maxProjectFacts]
+	}
+	return facts, nil
+}
+
 // Agent wires the CLI, state machine, tools, and LLM client together.
 type Agent struct {
 	client           llm.Client
-	cfg              config.Config
+	cfg              *runtimeConfig
 	cfgPath          string
 	providerCtrl     ProviderSwitcher
 	states           *state.Manager // Default workspace state (for CLI mode)
@@ -312,8 +350,7 @@ type Agent struct {
 	providerBuilders map[string]ProviderBuilder
 	isTTY            bool
 	render           *glamour.TermRenderer
-	requestCancelMu  sync.Mutex
-	requestCancel    context.CancelFunc
+	requests         requestTracker // Provider calls of CLI turns; web turns use their workspace's
 	planMu           sync.RWMutex
 	lastPlan         *planSnapshot
 	sessionOnce      sync.Once
@@ -322,10 +359,27 @@ type Agent struct {
 	tokenMu          sync.RWMutex
 	workspaceRoot    string // Default workspace (for CLI mode)
 	totalTokens      int
+	totalRequests    int // Provider requests, guarded by tokenMu like totalTokens
+	totalToolCalls   int
 	toolOpts         tooling.Options // Original tool options for workspace switching
 	activeProvider   string          // Provider name for creating workspace profiles
 	profileModel     string          // Model name for creating workspace profiles
 	version          string          // Application version for update checks
+	grpcAddr         string          // Listen address for the gRPC control API (empty disables it)
+	apiToken         string          // Bearer token required by the web server (headless mode)
+	freeModels       freeModelRotator
+	quota            quotaCache     // Provider account status for usage surfacing
+	costs            costTracker    // Request costs per provider since startup
+	approvals        approvalBroker // Tool calls waiting for approval in the web UI
+	handoffs         handoffBroker  // Interactive commands handed to the user
+
+	forceTakeover bool              // Ignore project locks held by other instances
+	memoryIDSeed  int64             // Passed to workspace profiles for reproducible memory IDs
+	storageLock   *projectlock.Lock // Project lock for the CLI workspace after a switch
+	warmup        warmupTracker     // Startup provider checks, reported by /api/health
+	demoDir       string            // Temporary directory of a read-only demo; empty outside demo mode
+
+	onSessionTitled func(workspace, key, title string) // Set by the web server to tell clients
 
 	// Multi-workspace support for web mode
 	workspacesMu      sync.RWMutex
@@ -348,6 +402,11 @@ type Options struct {
 	ActiveProvider   string // Provider name for creating workspace profiles
 	ProfileModel     string // Model name for creating workspace profiles
 	Version          string // Application version for update checks
+	GRPCAddr         string // Listen address for the gRPC control API (empty disables it)
+	ForceTakeover    bool   // Use project storage even when another instance holds its lock
+	MemoryIDSeed     int64  // Seeds memory IDs in workspace profiles; 0 seeds from the clock
+	DemoDir          string // Serve a read-only demo from this directory (see PrepareDemo)
+	APIToken         string // Bearer token every web request must carry (empty disables the check)
 }
 
 // New returns a fully wired Agent ready for the REPL loop.
@@ -364,7 +423,7 @@ func New(client llm.Client, cfg config.Config, cfgPath string, mgr *state.Manage
 
 	agent := &Agent{
 		client:            client,
-		cfg:               cfg,
+		cfg:               newRuntimeConfig(cfg),
 		cfgPath:           cfgPath,
 		providerCtrl:      providerCtrlForClient(client),
 		states:            mgr,
@@ -382,22 +441,41 @@ func New(client llm.Client, cfg config.Config, cfgPath string, mgr *state.Manage
 		activeProvider:    opts.ActiveProvider,
 		profileModel:      opts.ProfileModel,
 		version:           opts.Version,
+		grpcAddr:          strings.TrimSpace(opts.GRPCAddr),
+		apiToken:          strings.TrimSpace(opts.APIToken),
+		forceTakeover:     opts.ForceTakeover,
+		memoryIDSeed:      opts.MemoryIDSeed,
+		demoDir:           opts.DemoDir,
 		workspaceContexts: make(map[string]*WorkspaceContext),
 	}
 
 	if agent.providerCtrl != nil {
 		if opt := agent.providerCtrl.ActiveProvider(); opt.Model != "" {
-			agent.cfg.Model = opt.Model
+			agent.cfg.Update(func(c *config.Config) { c.Model = opt.Model })
 		}
 	}
 
 	if agent.states != nil {
 		agent.states.SetSystemPrompt(agent.systemPrompt)
 	}
+	// Workspace registries offer interactive commands while the config allows them
+	agent.toolOpts.ShellInteractive = func() bool { return agent.cfg.Load().ShellInteractive }
 
 	return agent
 }
 
+// ShellSandbox returns the shell_sandbox setting of workspace as it is at
+// each call, so tools pick up config reloads.
+func (a *Agent) ShellSandbox(workspace string) func() config.ShellSandbox {
+	return func() config.ShellSandbox { return a.cfg.Load().ShellSandboxFor(workspace) }
+}
+
+// ShellCommands returns the shell_commands rule of workspace as it is at
+// each call.
+func (a *Agent) ShellCommands(workspace string) func() config.ShellCommandRule {
+	return func() config.ShellCommandRule { return a.cfg.Load().ShellCommandsFor(workspace) }
+}
+
 func providerCtrlForClient(client llm.Client) ProviderSwitcher {
 	if client == nil {
 		return nil
@@ -412,6 +490,7 @@ func providerCtrlForClient(client llm.Client) ProviderSwitcher {
 func (a *Agent) Run(ctx context.Context) error {
 	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
+	a.startWarmup(ctx)
 
 	tracker := newInterruptTracker(2 * time.Second)
 	if a.isTTY {
@@ -449,13 +528,13 @@ func (a *Agent) reloadConfig(path string) error {
 		logging.ErrorLog("failed to reload config from %s: %v", path, err)
 		return err
 	}
-	if !strings.EqualFold(newCfg.Provider, a.cfg.Provider) {
-		return fmt.Errorf("provider changes require restart (current %s vs %s)", a.cfg.Provider, newCfg.Provider)
+	if !strings.EqualFold(newCfg.Provider, a.cfg.Load().Provider) {
+		return fmt.Errorf("provider changes require restart (current %s vs %s)", a.cfg.Load().Provider, newCfg.Provider)
 	}
-	if !strings.EqualFold(newCfg.ContextProfile, a.cfg.ContextProfile) {
+	if !strings.EqualFold(newCfg.ContextProfile, a.cfg.Load().ContextProfile) {
 		fmt.Println("Warning: context_profile changes require restart to take effect.")
 	}
-	if newCfg.WorkspaceRoot != a.cfg.WorkspaceRoot {
+	if newCfg.WorkspaceRoot != a.cfg.Load().WorkspaceRoot {
 		fmt.Println("Warning: workspace_root changes require restart.")
 	}
 	if reloader, ok := a.profile.(contextprofile.ConfigReloadable); ok {
@@ -464,7 +543,7 @@ func (a *Agent) reloadConfig(path string) error {
 			return err
 		}
 	}
-	a.cfg = newCfg
+	a.cfg.Store(newCfg)
 	a.cfgPath = path
 	logging.UserLog("Config reloaded from %s", path)
 	return nil
@@ -480,10 +559,10 @@ func (a *Agent) runPrompt(ctx context.Context, cancel context.CancelFunc, tracke
 
 	current := a.states.Current()
 	if msgs := current.Messages(); len(msgs) > 0 {
-		fmt.Printf("(loaded %d conversation messages totaling %d chars)\n", len(msgs), conversationCharCount(msgs))
+		fmt.Printf("(loaded %d conversation messages totaling %d tokens)\n", len(msgs), a.contextTokens(msgs))
 	}
 
-	history := loadInputHistory(a.cfg.HistoryPath)
+	history := loadInputHistory(a.cfg.Load().HistoryPath)
 
 	var restore func()
 	if fd := int(os.Stdin.Fd()); term.IsTerminal(fd) {
@@ -535,7 +614,7 @@ func (a *Agent) runPrompt(ctx context.Context, cancel context.CancelFunc, tracke
 			prompt.KeyBind{
 				Key: prompt.ControlC,
 				Fn: func(buf *prompt.Buffer) {
-					if a.cancelInFlightRequest() {
+					if a.requests.cancelRequest() {
 						fmt.Println("\n(Current request cancelled.)")
 						return
 					}
@@ -562,7 +641,7 @@ func (a *Agent) runPrompt(ctx context.Context, cancel context.CancelFunc, tracke
 			prompt.KeyBind{
 				Key: prompt.Escape,
 				Fn: func(buf *prompt.Buffer) {
-					if a.cancelInFlightRequest() {
+					if a.requests.cancelRequest() {
 						fmt.Println("\n(Request cancelled.)")
 					}
 				},
@@ -684,15 +763,54 @@ func (a *Agent) handleLine(ctx context.Context, input string) bool {
 
 func (a *Agent) respond(ctx context.Context, userInput string) (string, string, error) {
 	conv := a.states.Current()
+	if err := a.checkSessionBudget(conv, true); err != nil {
+		return "", "", err
+	}
+	a.rolloverSession(a.states, conv, nil)
+	turnID := turnIDFrom(ctx)
+	conv.BeginTurn(turnID)
+	defer conv.EndTurn()
 	conv.Append(state.Message{Role: "user", Content: userInput})
 	if err := a.states.Save(conv); err != nil {
 		return "", "", fmt.Errorf("save conversation: %w", err)
 	}
-	return a.respondLoopCLI(ctx, conv, a.states)
-}
+	if a.workspaceRoot == "" {
+		return a.respondLoopCLI(ctx, conv, a.states, nil)
+	}
+	// Record the turn like web turns, so :revert can undo its file changes
+	// and its tool-call graph can be fetched
+	recorder := newTurnRecorder(&WorkspaceContext{root: a.workspaceRoot, states: a.states}, turnID, userInput, a.requests.totalTokens(), a.logger)
+	graph := newToolGraphRecorder(a.workspaceRoot, turnID, conv.Key(), userInput, a.logger)
+	reply, finishReason, err := a.respondLoopCLI(ctx, conv, a.states, graph.Wrap(recorder.Wrap(nil)))
+	recorder.Finish(a.requests.totalTokens(), err)
+	graph.Finish()
+	if err == nil {
+		go a.titleSession(a.states, conv, a.workspaceRoot)
+	}
+	return reply, finishReason, err
+}
+
+// respondLoopCLI runs a terminal turn. callback only observes tool calls;
+// output goes to the terminal.
+func (a *Agent) respondLoopCLI(ctx context.Context, conv *state.Conversation, stateManager *state.Manager, callback StreamCallback) (string, string, error) {
+	// One config snapshot per turn, so settings changed mid-turn apply to the next one
+	cfg := a.cfg.Load()
+	budget := newTurnBudget(cfg)
+	ctx, cancelBudget := budget.withDeadline(ctx)
+	defer cancelBudget()
+	pins := tooling.NewPinnedFiles()
+	ctx = tooling.WithPinnedFiles(ctx, pins)
+	if a.isTTY {
+		ctx = tooling.WithApprover(ctx, a.approveInTerminal)
+	}
 
-func (a *Agent) respondLoopCLI(ctx context.Context, conv *state.Conversation, stateManager *state.Manager) (string, string, error) {
 	for {
+		if err := a.checkSessionBudget(conv, false); err != nil {
+			return "", "", err
+		}
+		if err := stateManager.Repair(conv); err != nil {
+			return "", "", fmt.Errorf("save conversation: %w", err)
+		}
 		prepared, err := a.profile.Prepare(ctx, conv)
 		if err != nil {
 			logging.DevLog("context profile prepare failed: %v", err)
@@ -706,11 +824,17 @@ func (a *Agent) respondLoopCLI(ctx context.Context, conv *state.Conversation, st
 		if len(messages) == 0 {
 			messages = conv.Messages()
 		}
+		messages = injectPinnedFiles(messages, pins)
+		messages = budget.prepare(messages, nil, a.logger.Printf)
+		messages = a.lintRequest(messages)
+		if conv.ThinkingMode() == state.ThinkingDiscard {
+			messages = state.StripThinking(messages)
+		}
 
 		// Inject hidden ultrathink message when force thinking is enabled
 		// Only inject for user messages, not for tool call response rounds
 		requestMessages := messages
-		if a.cfg.ForceThinking && len(messages) > 0 && messages[len(messages)-1].Role == "user" {
+		if cfg.ForceThinking && len(messages) > 0 && messages[len(messages)-1].Role == "user" {
 			requestMessages = make([]state.Message, len(messages), len(messages)+1)
 			copy(requestMessages, messages)
 			requestMessages = append(requestMessages, state.Message{
@@ -719,28 +843,32 @@ func (a *Agent) respondLoopCLI(ctx context.Context, conv *state.Conversation, st
 			})
 		}
 
-		totalChars := conversationCharCount(messages)
-		logging.DevLog("invoking provider with %d messages (~%d chars)", len(messages), totalChars)
-		fmt.Printf("(context size: %d chars)\n", totalChars)
+		contextTokens := a.contextTokens(messages)
+		logging.DevLog("invoking provider with %d messages (~%d tokens)", len(messages), contextTokens)
+		fmt.Printf("(context size: %d tokens)\n", contextTokens)
 		req := llm.ChatRequest{
 			Model:       a.getActiveModel(),
 			Messages:    requestMessages,
 			Tools:       a.tools.Definitions(),
-			Temperature: a.cfg.Temperature,
+			Temperature: cfg.Temperature,
 			Thinking: func() *llm.ThinkingOptions {
-				if !a.cfg.ThinkingEnabled {
+				if !cfg.ThinkingEnabled {
 					return nil
 				}
 				return &llm.ThinkingOptions{Type: "enabled"}
 			}(),
 		}
+		a.applyModelCapabilities(&req)
 
 		reqCtx, reqCancel := context.WithCancel(ctx)
-		a.setInFlightCancel(reqCancel)
-		resp, err := a.callProviderWithRetry(reqCtx, req, nil)
-		a.clearInFlightCancel()
+		a.requests.begin(reqCancel)
+		resp, err := a.callProviderWithRetry(reqCtx, req, nil, deltasOff)
+		a.requests.end()
 		reqCancel()
 		if err != nil {
+			if stopErr := budget.stopped(ctx); stopErr != nil {
+				return "", "", stopErr
+			}
 			if errors.Is(err, context.Canceled) {
 				fmt.Println("(request cancelled)")
 				return "", "", nil
@@ -751,13 +879,21 @@ func (a *Agent) respondLoopCLI(ctx context.Context, conv *state.Conversation, st
 		if resp.Usage != nil {
 			logging.DevLog("token usage: prompt=%d completion=%d total=%d",
 				resp.Usage.PromptTokens, resp.Usage.CompletionTokens, resp.Usage.TotalTokens)
-			a.addTokens(resp.Usage.TotalTokens)
 		}
+		a.countRequest(&a.requests, resp)
+		a.recordUsage(conv, a.ActiveProviderKey(), req.Model, resp.Usage)
+		a.warnSessionBudget(conv, nil)
 		if len(resp.Choices) == 0 {
 			return "", "", fmt.Errorf("no choices returned")
 		}
 
 		choice := resp.Choices[0]
+
+		// Enforce the content policy before output reaches the terminal or tools
+		if err := a.enforceContentPolicy(ctx, conv, stateManager, choice.Message, a.workspaceRoot, nil); err != nil {
+			return "", "", err
+		}
+
 		if len(choice.Message.ToolCalls) > 0 {
 			// Tool calls will be processed separately
 		}
@@ -777,7 +913,15 @@ func (a *Agent) respondLoopCLI(ctx context.Context, conv *state.Conversation, st
 			return choice.Message.Content, choice.FinishReason, nil
 		}
 
-		if err := a.processToolCallsWithCallback(ctx, conv, choice.Message.ToolCalls, nil, stateManager, a.tools, false); err != nil {
+		if callback != nil {
+			for _, toolCall := range choice.Message.ToolCalls {
+				callback("tool_call_started", toolCallStartedPayload(a.tools, toolCall))
+			}
+		}
+		if err := a.processToolCallsWithCallback(ctx, conv, choice.Message.ToolCalls, callback, stateManager, a.tools, false, a.workspaceRoot); err != nil {
+			if stopErr := budget.stopped(ctx); stopErr != nil {
+				return "", "", stopErr
+			}
 			return "", "", err
 		}
 		if mutated, err := a.profile.AfterResponse(ctx, conv); err != nil {
@@ -792,14 +936,49 @@ func (a *Agent) respondLoopCLI(ctx context.Context, conv *state.Conversation, st
 
 type StreamCallback func(eventType string, data any) error
 
+// visibleThinking returns thinking unless the session hides or discards
+// reasoning.
+func visibleThinking(conv *state.Conversation, thinking string) string {
+	if !conv.ThinkingMode().Visible() {
+		return ""
+	}
+	return thinking
+}
+
 // respondWithCallbacksForWorkspace executes a conversation turn using a specific workspace context
 func (a *Agent) respondWithCallbacksForWorkspace(ctx context.Context, userInput string, callback StreamCallback, wsCtx *WorkspaceContext) (string, string, error) {
+	defer wsCtx.beginTurn()()
 	conv := wsCtx.states.Current()
+	if err := a.checkSessionBudget(conv, true); err != nil {
+		return "", "", err
+	}
+	a.rolloverSession(wsCtx.states, conv, callback)
+	turnID := turnIDFrom(ctx)
+	conv.BeginTurn(turnID)
+	defer conv.EndTurn()
+	if activity := wsCtx.takeTerminalActivity(); activity != "" {
+		conv.Append(state.Message{Role: "user", Content: activity})
+	}
 	conv.Append(state.Message{Role: "user", Content: userInput})
 	if err := wsCtx.states.Save(conv); err != nil {
 		return "", "", fmt.Errorf("save conversation: %w", err)
 	}
 
+	// Record files changed, tests and commands run for the turn log and summary
+	recorder := newTurnRecorder(wsCtx, turnID, userInput, wsCtx.TotalTokens(), a.logger)
+	callback = recorder.Wrap(callback)
+
+	// Record how the turn's tool calls depend on each other
+	graph := newToolGraphRecorder(wsCtx.root, turnID, conv.Key(), userInput, a.logger)
+	callback = graph.Wrap(callback)
+
+	// Track milestones (tool counts, plan steps, long turns) around the stream
+	milestones := newMilestoneTracker(ctx, wsCtx, a.logger, callback)
+	callback = milestones.Callback()
+
+	// Remember files read and edited so later turns can skip re-reading them
+	callback = trackRecentFiles(wsCtx, conv.Key(), callback)
+
 	// Wire up compaction event callback if profile supports it
 	if emitter, ok := wsCtx.profile.(contextprofile.CompactionEventEmitter); ok {
 		emitter.SetCompactionCallback(callback)
@@ -808,12 +987,31 @@ func (a *Agent) respondWithCallbacksForWorkspace(ctx context.Context, userInput
 
 	// Inject preview state into context for preview_file tool
 	ctx = tooling.WithPreviewState(ctx, wsCtx.previewEnabled)
+	// Tools set to ask in tool_permissions wait for an answer on /api/tool-approval
+	ctx = tooling.WithApprover(ctx, a.approvals.approver(wsCtx.root, turnID, callback))
+	// Interactive shell commands run in a terminal the web UI attaches to
+	if callback != nil {
+		ctx = tooling.WithInteractiveRunner(ctx, a.handoffs.runner(wsCtx.root, turnID, callback))
+	}
+	// Provider calls register with the workspace, so other workspaces keep running
+	ctx = withRequestTracker(ctx, &wsCtx.requests)
 
-	return a.respondLoop(ctx, conv, wsCtx.states, wsCtx.tools, wsCtx.profile, callback, wsCtx.root, wsCtx.planMode)
+	reply, thinking, err := a.respondLoop(ctx, conv, wsCtx.states, wsCtx.tools, wsCtx.profile, callback, wsCtx.root, wsCtx.planMode.Load())
+	milestones.Finish(err)
+	recorder.Finish(wsCtx.TotalTokens(), err)
+	graph.Finish()
+	if err == nil {
+		go a.titleSession(wsCtx.states, conv, wsCtx.root)
+	}
+	return reply, thinking, err
 }
 
 func (a *Agent) respondWithCallbacks(ctx context.Context, userInput string, callback StreamCallback) (string, string, error) {
 	conv := a.states.Current()
+	if err := a.checkSessionBudget(conv, true); err != nil {
+		return "", "", err
+	}
+	a.rolloverSession(a.states, conv, callback)
 	conv.Append(state.Message{Role: "user", Content: userInput})
 	if err := a.states.Save(conv); err != nil {
 		return "", "", fmt.Errorf("save conversation: %w", err)
@@ -829,11 +1027,48 @@ func (a *Agent) respondWithCallbacks(ctx context.Context, userInput string, call
 }
 
 func (a *Agent) respondLoop(ctx context.Context, conv *state.Conversation, stateManager *state.Manager, tools *tooling.Registry, profile contextprofile.Profile, callback StreamCallback, workspaceRoot string, planMode bool) (string, string, error) {
-	// Load project instructions and facts once per conversation turn
-	projectInstructions := loadProjectInstructions(workspaceRoot)
-	projectFacts := loadProjectFacts(workspaceRoot)
+	// Load config, project instructions and facts once per conversation turn
+	cfg := a.cfg.Load()
+	requests := a.requestTrackerFor(ctx)
+	sysCtx := systemContext{
+		instructions: loadProjectInstructions(workspaceRoot),
+		facts:        loadProjectFacts(workspaceRoot),
+		repoMap:      a.loadRepoMap(workspaceRoot, conv, cfg.RepoMapBudget()),
+		recentFiles:  a.loadRecentFilesHint(workspaceRoot, conv),
+		bugHunt:      a.loadBugHuntContext(ctx, workspaceRoot, conv),
+	}
+	if cfg.IsProjectProfileEnabled() {
+		sysCtx.profile = loadProjectProfile(workspaceRoot)
+	}
+	if notes := sysCtx.fit(cfg.SystemPromptBudget(a.ActiveProviderKey(), a.getActiveModel())); len(notes) > 0 {
+		a.logger.Printf("[agent] system prompt budget: %s", strings.Join(notes, "; "))
+		if callback != nil {
+			callback("status", map[string]any{
+				"message": "Project context trimmed to fit the system prompt budget: " + strings.Join(notes, "; "),
+			})
+		}
+	}
+
+	// Files pinned by the user or with pin_file are resent until the turn ends
+	pins, ok := tooling.PinnedFilesFromContext(ctx)
+	if !ok {
+		pins = tooling.NewPinnedFiles()
+		ctx = tooling.WithPinnedFiles(ctx, pins)
+	}
+
+	budget := newTurnBudget(cfg)
+	ctx, cancelBudget := budget.withDeadline(ctx)
+	defer cancelBudget()
 
 	for {
+		// The session's hard budget is checked before every provider call
+		if err := a.checkSessionBudget(conv, false); err != nil {
+			return "", "", err
+		}
+		// Fix histories left broken by a crash or edit before the provider sees them
+		if err := stateManager.Repair(conv); err != nil {
+			return "", "", fmt.Errorf("save conversation: %w", err)
+		}
 		prepared, err := profile.Prepare(ctx, conv)
 		if err != nil {
 			a.logger.Printf("context profile prepare failed: %v", err)
@@ -849,18 +1084,29 @@ func (a *Agent) respondLoop(ctx context.Context, conv *state.Conversation, state
 		}
 
 		// Inject project instructions and facts into system message
-		messages = injectProjectInstructions(messages, projectInstructions)
-		messages = injectProjectFacts(messages, projectFacts)
+		messages = injectProjectInstructions(messages, sysCtx.instructions)
+		messages = injectProjectFacts(messages, sysCtx.facts)
+		messages = injectProjectProfile(messages, sysCtx.profile)
+		messages = injectRepoMap(messages, sysCtx.repoMap)
+		messages = injectRecentFiles(messages, sysCtx.recentFiles)
+		messages = injectBugHunt(messages, sysCtx.bugHunt)
+		messages = injectEditorSelection(messages, editorSelectionFrom(ctx))
+		messages = injectPinnedFiles(messages, pins)
 
 		// Inject plan mode hint if enabled
 		if planMode {
 			messages = injectPlanModeHint(messages)
 		}
+		messages = budget.prepare(messages, callback, a.logger.Printf)
+		messages = a.lintRequest(messages)
+		if conv.ThinkingMode() == state.ThinkingDiscard {
+			messages = state.StripThinking(messages)
+		}
 
 		// Inject hidden ultrathink message when force thinking is enabled
 		// Only inject for user messages, not for tool call response rounds
 		requestMessages := messages
-		if a.cfg.ForceThinking && len(messages) > 0 && messages[len(messages)-1].Role == "user" {
+		if cfg.ForceThinking && len(messages) > 0 && messages[len(messages)-1].Role == "user" {
 			requestMessages = make([]state.Message, len(messages), len(messages)+1)
 			copy(requestMessages, messages)
 			requestMessages = append(requestMessages, state.Message{
@@ -869,27 +1115,31 @@ func (a *Agent) respondLoop(ctx context.Context, conv *state.Conversation, state
 			})
 		}
 
-		totalChars := conversationCharCount(messages)
-		a.logger.Printf("[agent] invoking provider with %d messages (~%d chars)", len(messages), totalChars)
+		contextTokens := a.contextTokens(messages)
+		a.logger.Printf("[agent] invoking provider with %d messages (~%d tokens)", len(messages), contextTokens)
 		req := llm.ChatRequest{
 			Model:       a.getActiveModel(),
 			Messages:    requestMessages,
 			Tools:       tools.Definitions(),
-			Temperature: a.cfg.Temperature,
+			Temperature: cfg.Temperature,
 			Thinking: func() *llm.ThinkingOptions {
-				if !a.cfg.ThinkingEnabled {
+				if !cfg.ThinkingEnabled {
 					return nil
 				}
 				return &llm.ThinkingOptions{Type: "enabled"}
 			}(),
 		}
+		a.applyModelCapabilities(&req)
 
 		reqCtx, reqCancel := context.WithCancel(ctx)
-		a.setInFlightCancel(reqCancel)
-		resp, err := a.callProviderWithRetry(reqCtx, req, callback)
-		a.clearInFlightCancel()
+		requests.begin(reqCancel)
+		resp, err := a.callProviderWithRetry(reqCtx, req, callback, a.deltaModeFor(conv, callback))
+		requests.end()
 		reqCancel()
 		if err != nil {
+			if stopErr := budget.stopped(ctx); stopErr != nil {
+				return "", "", stopErr
+			}
 			if errors.Is(err, context.Canceled) {
 				return "", "", nil
 			}
@@ -899,13 +1149,30 @@ func (a *Agent) respondLoop(ctx context.Context, conv *state.Conversation, state
 		if resp.Usage != nil {
 			logging.DevLog("token usage: prompt=%d completion=%d total=%d",
 				resp.Usage.PromptTokens, resp.Usage.CompletionTokens, resp.Usage.TotalTokens)
-			a.addTokens(resp.Usage.TotalTokens)
 		}
+		a.countRequest(requests, resp)
+		var cost *requestCost
+		if price, actual, ok := a.recordUsage(conv, a.ActiveProviderKey(), req.Model, resp.Usage); ok {
+			cost = &requestCost{
+				Model:           req.Model,
+				ProjectedUSD:    price.projected(contextTokens),
+				ActualUSD:       actual,
+				SessionUSD:      a.costs.total(a.ActiveProviderKey()),
+				ConversationUSD: conv.Usage().CostUSD,
+			}
+		}
+		a.warnSessionBudget(conv, callback)
 		if len(resp.Choices) == 0 {
 			return "", "", fmt.Errorf("no choices returned")
 		}
 
 		choice := resp.Choices[0]
+
+		// Enforce the content policy before output reaches the UI or tools
+		if err := a.enforceContentPolicy(ctx, conv, stateManager, choice.Message, workspaceRoot, callback); err != nil {
+			return "", "", err
+		}
+
 		if len(choice.Message.ToolCalls) > 0 {
 			// Tool calls will be processed separately
 		}
@@ -920,14 +1187,21 @@ func (a *Agent) respondLoop(ctx context.Context, conv *state.Conversation, state
 				activeModel := a.getActiveModel()
 				eventData := map[string]any{
 					"content":              choice.Message.Content,
-					"thinking":             choice.Message.Thinking,
+					"thinking":             visibleThinking(conv, choice.Message.Thinking),
 					"context_chars":        conversationCharCount(conv.Messages()),
-					"total_tokens":         a.getTotalTokens(),
+					"context_tokens":       a.contextTokens(conv.Messages()),
+					"total_tokens":         requests.totalTokens(),
 					"context_limit_tokens": config.GetModelContextLength(activeProvider.Key, activeModel),
 				}
 				if resp.Usage != nil {
 					eventData["usage"] = resp.Usage
 				}
+				if cost != nil {
+					eventData["cost"] = cost
+				}
+				if citations := extractCitations(workspaceRoot, choice.Message.Content, cfg.AllowExternalSymlinks); len(citations) > 0 {
+					eventData["citations"] = citations
+				}
 				callback("assistant_message", eventData)
 			}
 			if mutated, err := profile.AfterResponse(ctx, conv); err != nil {
@@ -942,7 +1216,8 @@ func (a *Agent) respondLoop(ctx context.Context, conv *state.Conversation, state
 					activeModel := a.getActiveModel()
 					callback("context_update", map[string]any{
 						"context_chars":        conversationCharCount(conv.Messages()),
-						"total_tokens":         a.getTotalTokens(),
+						"context_tokens":       a.contextTokens(conv.Messages()),
+						"total_tokens":         requests.totalTokens(),
 						"context_limit_tokens": config.GetModelContextLength(activeProvider.Key, activeModel),
 					})
 				}
@@ -956,28 +1231,34 @@ func (a *Agent) respondLoop(ctx context.Context, conv *state.Conversation, state
 			activeModel := a.getActiveModel()
 			eventData := map[string]any{
 				"content":              choice.Message.Content,
-				"thinking":             choice.Message.Thinking,
+				"thinking":             visibleThinking(conv, choice.Message.Thinking),
 				"context_chars":        conversationCharCount(conv.Messages()),
-				"total_tokens":         a.getTotalTokens(),
+				"context_tokens":       a.contextTokens(conv.Messages()),
+				"total_tokens":         requests.totalTokens(),
 				"context_limit_tokens": config.GetModelContextLength(activeProvider.Key, activeModel),
 			}
 			if resp.Usage != nil {
 				eventData["usage"] = resp.Usage
 			}
+			if cost != nil {
+				eventData["cost"] = cost
+			}
+			if citations := extractCitations(workspaceRoot, choice.Message.Content, cfg.AllowExternalSymlinks); len(citations) > 0 {
+				eventData["citations"] = citations
+			}
 			callback("assistant_message", eventData)
 		}
 
 		if callback != nil {
 			for _, toolCall := range choice.Message.ToolCalls {
-				callback("tool_call_started", map[string]any{
-					"id":        toolCall.ID,
-					"function":  toolCall.Function.Name,
-					"arguments": toolCall.Function.Arguments,
-				})
+				callback("tool_call_started", toolCallStartedPayload(tools, toolCall))
 			}
 		}
 
-		if err := a.processToolCallsWithCallback(ctx, conv, choice.Message.ToolCalls, callback, stateManager, tools, planMode); err != nil {
+		if err := a.processToolCallsWithCallback(ctx, conv, choice.Message.ToolCalls, callback, stateManager, tools, planMode, workspaceRoot); err != nil {
+			if stopErr := budget.stopped(ctx); stopErr != nil {
+				return "", "", stopErr
+			}
 			return "", "", err
 		}
 		if mutated, err := profile.AfterResponse(ctx, conv); err != nil {
@@ -992,7 +1273,8 @@ func (a *Agent) respondLoop(ctx context.Context, conv *state.Conversation, state
 				activeModel := a.getActiveModel()
 				callback("context_update", map[string]any{
 					"context_chars":        conversationCharCount(conv.Messages()),
-					"total_tokens":         a.getTotalTokens(),
+					"context_tokens":       a.contextTokens(conv.Messages()),
+					"total_tokens":         requests.totalTokens(),
 					"context_limit_tokens": config.GetModelContextLength(activeProvider.Key, activeModel),
 				})
 			}
@@ -1001,138 +1283,354 @@ func (a *Agent) respondLoop(ctx context.Context, conv *state.Conversation, state
 }
 
 func (a *Agent) processToolCalls(ctx context.Context, conv *state.Conversation, calls []state.ToolCall) error {
-	return a.processToolCallsWithCallback(ctx, conv, calls, nil, a.states, a.tools, false)
+	return a.processToolCallsWithCallback(ctx, conv, calls, nil, a.states, a.tools, false, a.workspaceRoot)
+}
+
+// toolCallStartedPayload describes a call about to run. Calls that edit
+// files carry the diffs they would make, so the UI can show them up front.
+func toolCallStartedPayload(tools *tooling.Registry, call state.ToolCall) map[string]any {
+	payload := map[string]any{
+		"id":        call.ID,
+		"function":  call.Function.Name,
+		"arguments": call.Function.Arguments,
+	}
+	tool, ok := tools.Lookup(call.Function.Name)
+	if !ok {
+		return payload
+	}
+	var args map[string]any
+	if json.Unmarshal([]byte(call.Function.Arguments), &args) != nil {
+		return payload
+	}
+	if diffs := tooling.PreviewDiffs(tool, args); len(diffs) > 0 {
+		payload["diffs"] = diffs
+	}
+	return payload
 }
 
 // blockedToolsInPlanMode lists tools that are not allowed when plan mode is enabled
 var blockedToolsInPlanMode = map[string]bool{
-	"write_file": true,
-	"edit_file":  true,
+	"write_file":  true,
+	"edit_file":   true,
+	"rename_path": true,
+	"delete_path": true,
+	"git_commit":  true,
+}
+
+// parallelSafeTools only read, so consecutive calls to them from one
+// assistant message may run concurrently.
+var parallelSafeTools = map[string]bool{
+	"read_file":                 true,
+	"list_directory":            true,
+	"glob":                      true,
+	"grep":                      true,
+	"repo_map":                  true,
+	"git_status":                true,
+	"git_diff":                  true,
+	"git_log":                   true,
+	"git_history":               true,
+	"web_fetch_json":            true,
+	"current_datetime":          true,
+	"current_working_directory": true,
+}
+
+// toolRun is one tool call on its way from the assistant message to a tool
+// result in the conversation.
+type toolRun struct {
+	call    state.ToolCall
+	tool    tooling.Tool
+	args    map[string]any
+	start   time.Time
+	changes []tooling.FileChange
+	result  string
+	err     error
+	// resolved is set when the call was answered without running the tool;
+	// blocked marks answers the UI shows as refused.
+	resolved bool
+	blocked  bool
+	done     chan struct{}
+}
+
+// processToolCallsWithCallback runs the calls of one assistant message and
+// appends their results in the order of the calls. Consecutive calls to
+// parallelSafeTools run concurrently, bounded by config.ToolCallWorkers;
+// any other call runs alone once the calls before it have finished.
+func (a *Agent) processToolCallsWithCallback(ctx context.Context, conv *state.Conversation, calls []state.ToolCall, callback StreamCallback, stateManager *state.Manager, tools *tooling.Registry, planMode bool, workspaceRoot string) error {
+	workers := a.cfg.Load().ToolCallWorkers()
+	for len(calls) > 0 {
+		n := 1
+		if workers > 1 && parallelSafeTools[calls[0].Function.Name] {
+			for n < len(calls) && parallelSafeTools[calls[n].Function.Name] {
+				n++
+			}
+		}
+		if err := a.runToolBatch(ctx, conv, calls[:n], workers, callback, stateManager, tools, planMode, workspaceRoot); err != nil {
+			return err
+		}
+		calls = calls[n:]
+	}
+	return nil
 }
 
-func (a *Agent) processToolCallsWithCallback(ctx context.Context, conv *state.Conversation, calls []state.ToolCall, callback StreamCallback, stateManager *state.Manager, tools *tooling.Registry, planMode bool) error {
-	for _, call := range calls {
-		// Block editing tools in plan mode
-		if planMode && blockedToolsInPlanMode[call.Function.Name] {
-			msg := fmt.Sprintf("Tool '%s' is blocked: Plan mode is enabled. The user wants you to only analyze and plan, not make changes. Ask them to disable plan mode if they want you to implement changes.", call.Function.Name)
-			logging.UserLog("plan mode: blocked %s", call.Function.Name)
-			conv.Append(state.Message{Role: "tool", Name: call.Function.Name, Content: msg, ToolCallID: call.ID})
-			if callback != nil {
-				callback("tool_call_completed", map[string]any{
-					"id":       call.ID,
-					"function": call.Function.Name,
-					"result":   msg,
-					"error":    true,
-					"blocked":  true,
-				})
-			}
-			if err := stateManager.Save(conv); err != nil {
-				return fmt.Errorf("save blocked tool result: %w", err)
-			}
+// runToolBatch checks and authorizes the calls in order, runs the approved
+// ones with up to workers at a time, and records each result as soon as it
+// and the results before it are ready.
+func (a *Agent) runToolBatch(ctx context.Context, conv *state.Conversation, calls []state.ToolCall, workers int, callback StreamCallback, stateManager *state.Manager, tools *tooling.Registry, planMode bool, workspaceRoot string) error {
+	runs := make([]*toolRun, len(calls))
+	for i, call := range calls {
+		runs[i] = a.prepareToolRun(ctx, call, tools, planMode, workspaceRoot)
+	}
+	sem := make(chan struct{}, workers)
+	for _, run := range runs {
+		if run.resolved {
 			continue
 		}
-
-		tool, ok := tools.Lookup(call.Function.Name)
-		if !ok {
-			msg := fmt.Sprintf("tool %s not registered", call.Function.Name)
-			logging.ErrorLog(msg)
-			conv.Append(state.Message{Role: "tool", Name: call.Function.Name, Content: msg, ToolCallID: call.ID})
+		run.done = make(chan struct{})
+		if len(runs) == 1 {
+			a.executeToolRun(ctx, conv, run, callback)
 			continue
 		}
-		var args map[string]any
-		if call.Function.Arguments != "" {
-			if err := json.Unmarshal([]byte(call.Function.Arguments), &args); err != nil {
-				msg := fmt.Sprintf("invalid args for %s: %v", call.Function.Name, err)
-				logging.ErrorLog(msg)
-				conv.Append(state.Message{Role: "tool", Name: call.Function.Name, Content: msg, ToolCallID: call.ID})
-				continue
+		go func() {
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			a.executeToolRun(ctx, conv, run, callback)
+		}()
+	}
+	for i, run := range runs {
+		if run.done != nil {
+			<-run.done
+		}
+		if err := a.finishToolRun(ctx, conv, run, callback, stateManager, tools, workspaceRoot); err != nil {
+			// Let the calls still running finish before the turn moves on
+			for _, rest := range runs[i+1:] {
+				if rest.done != nil {
+					<-rest.done
+				}
 			}
-		} else {
-			args = map[string]any{}
+			return err
 		}
-		start := time.Now()
-		// For recall_memory, pass conversation via context so tool can expand in-place
-		// For update_plan, pass session storage path so plan is session-specific
-		toolCtx := ctx
-		if call.Function.Name == "recall_memory" {
-			toolCtx = contextprofile.WithConversation(ctx, conv)
-		} else if call.Function.Name == "update_plan" {
-			toolCtx = tooling.WithSessionStorage(ctx, conv.StoragePath())
-		}
-		// Provide user feedback for long-running tools
-		logging.UserLog("Executing tool: %s", call.Function.Name)
-
-		result, err := tool.Call(toolCtx, args)
-		if err != nil {
-			result = fmt.Sprintf("tool error: %v", err)
-			dur := time.Since(start).Round(time.Millisecond)
-			logging.ErrorLog("tool %s failed after %s: %v", call.Function.Name, dur, err)
-		} else {
-			dur := time.Since(start).Round(time.Millisecond)
-			originalLen := len(result)
-			logging.DevLog("tool %s completed: %d bytes in %s", call.Function.Name, originalLen, dur)
-
-			// Hard limit: truncate any tool result exceeding 50KB
-			const maxToolResultSize = 50000
-			if originalLen > maxToolResultSize {
-				result = result[:maxToolResultSize] + fmt.Sprintf("\n\n[TRUNCATED: Tool result too large (%d chars). Showing first %d chars. Use more specific filters, smaller ranges, or pagination.]", originalLen, maxToolResultSize)
-				logging.DevLog("tool %s result truncated from %d to %d bytes", call.Function.Name, originalLen, len(result))
-			}
+	}
+	return nil
+}
+
+// prepareToolRun looks up the tool and its arguments and asks for
+// permission. Calls that may not run come back resolved with the message
+// the model gets instead.
+func (a *Agent) prepareToolRun(ctx context.Context, call state.ToolCall, tools *tooling.Registry, planMode bool, workspaceRoot string) *toolRun {
+	run := &toolRun{call: call}
+	// Block editing tools in plan mode, and every tool in a demo
+	if a.demoDir != "" || (planMode && blockedToolsInPlanMode[call.Function.Name]) {
+		msg := fmt.Sprintf("Tool '%s' is blocked: Plan mode is enabled. The user wants you to only analyze and plan, not make changes. Ask them to disable plan mode if they want you to implement changes.", call.Function.Name)
+		mode := "plan mode"
+		if a.demoDir != "" {
+			msg = fmt.Sprintf("Tool '%s' is blocked: this is a read-only demo.", call.Function.Name)
+			mode = "demo"
+		}
+		logging.UserLog("%s: blocked %s", mode, call.Function.Name)
+		run.result, run.resolved, run.blocked = msg, true, true
+		return run
+	}
+
+	tool, ok := tools.Lookup(call.Function.Name)
+	if !ok {
+		run.result, run.resolved = fmt.Sprintf("tool %s not registered", call.Function.Name), true
+		logging.ErrorLog(run.result)
+		return run
+	}
+	args := map[string]any{}
+	if call.Function.Arguments != "" {
+		if err := json.Unmarshal([]byte(call.Function.Arguments), &args); err != nil {
+			run.result, run.resolved = fmt.Sprintf("invalid args for %s: %v", call.Function.Name, err), true
+			logging.ErrorLog(run.result)
+			return run
+		}
+	}
+	permission := a.cfg.Load().ToolPermissionFor(workspaceRoot, call.Function.Name)
+	if err := tooling.Authorize(ctx, permission, tooling.ApprovalRequest{
+		ID:        call.ID,
+		Tool:      call.Function.Name,
+		Arguments: args,
+		Summary:   tooling.SummarizeCall(call.Function.Name, args),
+	}); err != nil {
+		logging.UserLog("tool permission: %s not run: %v", call.Function.Name, err)
+		run.result, run.resolved, run.blocked = fmt.Sprintf("Tool '%s' was not run: %v", call.Function.Name, err), true, true
+		return run
+	}
+	run.tool, run.args = tool, args
+	return run
+}
+
+// executeToolRun calls the tool and stores its result in run. It may run
+// concurrently with other parallelSafeTools calls, so it must not touch
+// the conversation beyond what the tool itself does, or send events other
+// than the tool_output chunks of the shell tool, which never runs in
+// parallel.
+func (a *Agent) executeToolRun(ctx context.Context, conv *state.Conversation, run *toolRun, callback StreamCallback) {
+	defer close(run.done)
+	name := run.call.Function.Name
+	run.start = time.Now()
+	// For recall_memory, pass conversation via context so tool can expand in-place
+	// For update_plan, pass session storage path so plan is session-specific
+	// For analyze_large_file, pass the summary model to read windows with
+	toolCtx := ctx
+	if name == "recall_memory" {
+		toolCtx = contextprofile.WithConversation(ctx, conv)
+	} else if name == "update_plan" {
+		toolCtx = tooling.WithSessionStorage(ctx, conv.StoragePath())
+	} else if name == tooling.AnalyzeFileToolName {
+		toolCtx = tooling.WithSummarizer(ctx, a.analyzeFileWindow)
+	}
+	if callback != nil && !parallelSafeTools[name] {
+		toolCtx = tooling.WithOutputStream(toolCtx, func(stream, chunk string) {
+			callback("tool_output", map[string]any{
+				"id":       run.call.ID,
+				"function": name,
+				"stream":   stream,
+				"chunk":    chunk,
+			})
+		})
+	}
+	// Provide user feedback for long-running tools
+	logging.UserLog("Executing tool: %s", name)
+
+	// Capture edited files first so the completed event can carry the diff
+	if previewer, ok := run.tool.(tooling.ChangePreviewer); ok && callback != nil {
+		run.changes, _ = previewer.PreviewChanges(run.args)
+	}
+
+	result, err := run.tool.Call(toolCtx, run.args)
+	dur := time.Since(run.start).Round(time.Millisecond)
+	if err != nil {
+		result = fmt.Sprintf("tool error: %v", err)
+		logging.ErrorLog("tool %s failed after %s: %v", name, dur, err)
+	} else {
+		originalLen := len(result)
+		logging.DevLog("tool %s completed: %d bytes in %s", name, originalLen, dur)
+
+		// Hard limit: truncate any tool result exceeding 50KB
+		const maxToolResultSize = 50000
+		if originalLen > maxToolResultSize {
+			result = result[:maxToolResultSize] + fmt.Sprintf("\n\n[TRUNCATED: Tool result too large (%d chars). Showing first %d chars. Use more specific filters, smaller ranges, or pagination.]", originalLen, maxToolResultSize)
+			logging.DevLog("tool %s result truncated from %d to %d bytes", name, originalLen, len(result))
+		}
+	}
+	run.result, run.err = result, err
+}
+
+// finishToolRun appends the run's result to the conversation, sends its
+// events and saves the session.
+func (a *Agent) finishToolRun(ctx context.Context, conv *state.Conversation, run *toolRun, callback StreamCallback, stateManager *state.Manager, tools *tooling.Registry, workspaceRoot string) error {
+	call := run.call
+	if run.resolved {
+		conv.Append(state.Message{Role: "tool", Name: call.Function.Name, Content: run.result, ToolCallID: call.ID})
+		if !run.blocked {
+			return nil
 		}
-		conv.Append(state.Message{Role: "tool", Name: call.Function.Name, Content: result, ToolCallID: call.ID})
 		if callback != nil {
 			callback("tool_call_completed", map[string]any{
-				"id":            call.ID,
-				"function":      call.Function.Name,
-				"result":        result,
-				"error":         err != nil,
-				"context_chars": conversationCharCount(conv.Messages()),
-				"total_tokens":  a.getTotalTokens(),
+				"id":       call.ID,
+				"function": call.Function.Name,
+				"result":   run.result,
+				"error":    true,
+				"blocked":  true,
 			})
 		}
-		if err == nil && call.Function.Name == "update_plan" {
-			a.handlePlanToolResult(args, result)
-			if callback != nil {
-				callback("plan_update", map[string]any{
-					"plan": result,
-				})
+		if err := stateManager.Save(conv); err != nil {
+			return fmt.Errorf("save refused tool result: %w", err)
+		}
+		return nil
+	}
+
+	result, err := run.result, run.err
+	if err == nil {
+		result += a.captionToolImages(ctx, call.Function.Name, result, run.start, tools, workspaceRoot, callback)
+	}
+	conv.Append(state.Message{Role: "tool", Name: call.Function.Name, Content: result, ToolCallID: call.ID})
+	if callback != nil {
+		payload := map[string]any{
+			"id":             call.ID,
+			"function":       call.Function.Name,
+			"result":         result,
+			"error":          err != nil,
+			"context_chars":  conversationCharCount(conv.Messages()),
+			"context_tokens": a.contextTokens(conv.Messages()),
+			"total_tokens":   a.requestTrackerFor(ctx).totalTokens(),
+		}
+		if err == nil && len(run.changes) > 0 {
+			if diffs := tooling.AppliedDiffs(run.changes); len(diffs) > 0 {
+				payload["diffs"] = diffs
 			}
 		}
-		// Emit preview event when preview_file tool is called successfully
-		if err == nil && call.Function.Name == "preview_file" {
-			var previewResult map[string]any
-			if jsonErr := json.Unmarshal([]byte(result), &previewResult); jsonErr == nil {
-				if previewEnabled, ok := previewResult["preview_enabled"].(bool); ok && previewEnabled {
-					if callback != nil {
-						callback("preview", map[string]any{
-							"path":  previewResult["path"],
-							"title": previewResult["title"],
-						})
-					}
+		callback("tool_call_completed", payload)
+	}
+	if err == nil && call.Function.Name == "update_plan" {
+		a.handlePlanToolResult(run.args, result)
+		if callback != nil {
+			callback("plan_update", map[string]any{
+				"plan": result,
+			})
+		}
+	}
+	if err == nil && call.Function.Name == "shell" {
+		rememberTestCommand(workspaceRoot, run.args)
+	}
+	if err == nil && call.Function.Name == tooling.StatusReportToolName && callback != nil {
+		if report, ok := tooling.ParseStatusReport(result); ok {
+			callback("status_report", report)
+		}
+	}
+	// Emit preview event when preview_file tool is called successfully
+	if err == nil && call.Function.Name == "preview_file" {
+		var previewResult map[string]any
+		if jsonErr := json.Unmarshal([]byte(result), &previewResult); jsonErr == nil {
+			if previewEnabled, ok := previewResult["preview_enabled"].(bool); ok && previewEnabled {
+				if callback != nil {
+					callback("preview", map[string]any{
+						"path":  previewResult["path"],
+						"title": previewResult["title"],
+					})
 				}
 			}
 		}
-		if err := stateManager.Save(conv); err != nil {
-			return fmt.Errorf("save tool result: %w", err)
-		}
+	}
+	if err := stateManager.Save(conv); err != nil {
+		return fmt.Errorf("save tool result: %w", err)
 	}
 	return nil
 }
 
-func (a *Agent) callProviderWithRetry(ctx context.Context, req llm.ChatRequest, callback StreamCallback) (llm.ChatResponse, error) {
-	const (
-		maxRetries   = 5
-		initialDelay = time.Second
-		maxDelay     = 16 * time.Second
-	)
-	delay := initialDelay
+func (a *Agent) callProviderWithRetry(ctx context.Context, req llm.ChatRequest, callback StreamCallback, mode deltaMode) (llm.ChatResponse, error) {
+	policy := a.cfg.Load().RetryPolicyFor(a.ActiveProviderKey())
+	plan := newRetryPlan(policy)
+	maxRetries := policy.MaxAttempts
 	var lastErr error
+	var freePool []string
+	freeModel := ""
+	if a.freeModeActive() {
+		freePool = freeModelPool(openRouterModelsJSON())
+		freeModel = a.freeModels.pick(a.configuredModel(), freePool, time.Now())
+	}
+	baseMessages := req.Messages
 	for attempt := 1; attempt <= maxRetries; attempt++ {
-		chatCtx, chatCancel := context.WithCancel(ctx)
+		callCtx := ctx
+		if freeModel != "" {
+			req.Model = freeModel
+			callCtx = withModelOverride(ctx, freeModel)
+		}
+		chatCtx, chatCancel := context.WithCancel(callCtx)
 		start := time.Now()
-		resp, err := a.client.Chat(chatCtx, req)
+		stopHeartbeat := startProviderHeartbeat(callback, attempt, maxRetries, req.Model)
+		deltas := &deltaBatcher{callback: callback, mode: mode, attempt: attempt}
+		resp, err := llm.ChatStream(chatCtx, a.client, req, deltas.onDelta())
+		deltas.flush()
+		stopHeartbeat()
 		elapsed := time.Since(start).Round(time.Millisecond)
 		chatCancel()
+		if err == nil {
+			if err = llm.ValidateResponse(a.ActiveProviderKey(), resp); err != nil {
+				a.logger.Printf("[agent] rejected provider response: %v", err)
+			}
+		}
 		logging.DevLog("provider call finished: err=%v (attempt %d/%d, duration=%s)", err, attempt, maxRetries, elapsed)
 		if err == nil {
 			logging.DevLog("provider call succeeded in %s (attempt %d/%d)", elapsed, attempt, maxRetries)
@@ -1141,28 +1639,49 @@ func (a *Agent) callProviderWithRetry(ctx context.Context, req llm.ChatRequest,
 		if errors.Is(err, context.Canceled) || ctx.Err() != nil {
 			return llm.ChatResponse{}, context.Canceled
 		}
+		a.recordProviderError(err, req.Model)
 
 		// Check if this is a structured ProviderError
 		if pe, ok := llm.IsProviderError(err); ok {
+			// Free mode: move to another free model instead of waiting out the limit
+			if freeModel != "" && pe.Type == llm.ErrorTypeRateLimit && attempt < maxRetries {
+				until := time.Now().Add(freeModelCooldown)
+				if pe.ResetAt != nil {
+					until = *pe.ResetAt
+				}
+				if next := a.freeModels.rotate(freeModel, until, freePool, time.Now()); next != "" {
+					a.logger.Printf("[agent] free model %s rate-limited; switching to %s", freeModel, next)
+					if callback != nil {
+						callback("model_switch", map[string]any{
+							"from":   freeModel,
+							"to":     next,
+							"reason": fmt.Sprintf("%s is rate-limited (%s); switched to another free model", freeModel, pe.Message),
+						})
+					}
+					freeModel = next
+					lastErr = err
+					continue
+				}
+			}
+
 			// Non-retryable errors: emit event and return immediately
-			if !pe.Retryable {
+			if !plan.shouldRetry(err) {
 				a.logger.Printf("[agent] provider error (non-retryable): %s", pe.Error())
 				if callback != nil {
 					callback("provider_error", buildProviderErrorPayload(pe))
 				}
 				return llm.ChatResponse{}, err
 			}
-
-			// Use provider-specified retry delay if available and longer than current
-			if pe.RetryAfter != nil && *pe.RetryAfter > delay {
-				delay = *pe.RetryAfter
-			}
+		} else if !plan.shouldRetry(err) {
+			return llm.ChatResponse{}, err
 		}
 
 		lastErr = err
 		if attempt == maxRetries {
 			break
 		}
+		req.Messages = retryMessages(baseMessages, err)
+		delay := plan.nextDelay(err)
 		a.logger.Printf("[agent] retrying provider call (attempt %d/%d) after %v", attempt+1, maxRetries, err)
 		if callback != nil {
 			callback("request_retry", map[string]any{
@@ -1181,14 +1700,25 @@ func (a *Agent) callProviderWithRetry(ctx context.Context, req llm.ChatRequest,
 			return llm.ChatResponse{}, context.Canceled
 		case <-timer.C:
 		}
-		delay *= 2
-		if delay > maxDelay {
-			delay = maxDelay
-		}
 	}
 	return llm.ChatResponse{}, lastErr
 }
 
+// retryMessages tells the model why its last reply was rejected, so the
+// retry does not repeat it. Other failures resend the request unchanged.
+func retryMessages(messages []state.Message, err error) []state.Message {
+	pe, ok := llm.IsProviderError(err)
+	if !ok || pe.Type != llm.ErrorTypeInvalidResponse {
+		return messages
+	}
+	out := make([]state.Message, len(messages), len(messages)+1)
+	copy(out, messages)
+	return append(out, state.Message{
+		Role:    "user",
+		Content: fmt.Sprintf("Your previous reply was discarded (%s). Answer again, with valid and complete tool call arguments if you call tools.", pe.Message),
+	})
+}
+
 // buildProviderErrorPayload creates the SSE event payload for provider errors
 func buildProviderErrorPayload(pe *llm.ProviderError) map[string]any {
 	payload := map[string]any{
@@ -1199,58 +1729,75 @@ func buildProviderErrorPayload(pe *llm.ProviderError) map[string]any {
 		"retryable": pe.Retryable,
 	}
 	if pe.ResetAt != nil {
-		payload["reset_at"] = pe.ResetAt.Format("15:04:05")
-		payload["reset_at_full"] = pe.ResetAt.Format(time.RFC3339)
+		payload["reset_at"] = timefmt.Format(*pe.ResetAt)
+		payload["reset_at_ms"] = timefmt.Millis(*pe.ResetAt)
 	}
 	return payload
 }
 
-func (a *Agent) setInFlightCancel(cancel context.CancelFunc) {
-	a.requestCancelMu.Lock()
-	a.requestCancel = cancel
-	a.requestCancelMu.Unlock()
+func (a *Agent) getTotalTokens() int {
+	a.tokenMu.RLock()
+	defer a.tokenMu.RUnlock()
+	return a.totalTokens
 }
 
-func (a *Agent) clearInFlightCancel() {
-	a.requestCancelMu.Lock()
-	a.requestCancel = nil
-	a.requestCancelMu.Unlock()
+// RunUsage totals the provider requests an agent has made since it started.
+type RunUsage struct {
+	Requests  int `json:"requests"`
+	Tokens    int `json:"tokens"`
+	ToolCalls int `json:"tool_calls"`
 }
 
-func (a *Agent) addTokens(tokens int) {
+// countRequest adds a provider response to the agent's totals and to the
+// tracker of the workspace it was made for.
+func (a *Agent) countRequest(requests *requestTracker, resp llm.ChatResponse) {
+	requests.count(resp)
 	a.tokenMu.Lock()
-	a.totalTokens += tokens
-	a.tokenMu.Unlock()
+	defer a.tokenMu.Unlock()
+	a.totalRequests++
+	if resp.Usage != nil {
+		a.totalTokens += resp.Usage.TotalTokens
+	}
+	if len(resp.Choices) > 0 {
+		a.totalToolCalls += len(resp.Choices[0].Message.ToolCalls)
+	}
 }
 
-func (a *Agent) getTotalTokens() int {
+// Usage returns the requests, tokens and tool calls used so far.
+func (a *Agent) Usage() RunUsage {
 	a.tokenMu.RLock()
 	defer a.tokenMu.RUnlock()
-	return a.totalTokens
+	return RunUsage{Requests: a.totalRequests, Tokens: a.totalTokens, ToolCalls: a.totalToolCalls}
 }
 
-func (a *Agent) cancelInFlightRequest() bool {
-	a.requestCancelMu.Lock()
-	cancel := a.requestCancel
-	a.requestCancel = nil
-	a.requestCancelMu.Unlock()
-	if cancel != nil {
-		cancel()
-		return true
-	}
-	return false
-}
-
-// CancelRequest exposes cancellation to the web UI.
+// CancelRequest cancels the provider calls running in any workspace. Web
+// handlers cancel a single workspace with WorkspaceContext.CancelRequest.
 func (a *Agent) CancelRequest() bool {
-	return a.cancelInFlightRequest()
+	cancelled := a.requests.cancelRequest()
+	a.workspacesMu.RLock()
+	defer a.workspacesMu.RUnlock()
+	for _, wsCtx := range a.workspaceContexts {
+		if wsCtx.CancelRequest() {
+			cancelled = true
+		}
+	}
+	return cancelled
 }
 
-// HasInFlightRequest reports whether a provider call is still running.
+// HasInFlightRequest reports whether a provider call is running in any
+// workspace.
 func (a *Agent) HasInFlightRequest() bool {
-	a.requestCancelMu.Lock()
-	defer a.requestCancelMu.Unlock()
-	return a.requestCancel != nil
+	if a.requests.running() {
+		return true
+	}
+	a.workspacesMu.RLock()
+	defer a.workspacesMu.RUnlock()
+	for _, wsCtx := range a.workspaceContexts {
+		if wsCtx.HasInFlightRequest() {
+			return true
+		}
+	}
+	return false
 }
 
 func (a *Agent) ensureSessionSelected() error {
@@ -1417,7 +1964,7 @@ func (a *Agent) printPlanSnapshot(header string, plan *planSnapshot) {
 		fmt.Println(header)
 	}
 	if !plan.UpdatedAt.IsZero() {
-		fmt.Printf("  Last updated: %s\n", plan.UpdatedAt.Format(time.RFC822))
+		fmt.Printf("  Last updated: %s\n", timefmt.Relative(plan.UpdatedAt, time.Now()))
 	}
 	if len(plan.Steps) == 0 {
 		fmt.Println("  (No plan steps recorded.)")
@@ -1515,13 +2062,23 @@ func (a *Agent) handleCommand(cmd string) bool {
   :use <key>     switch to an existing state (creates if missing)
   :new <key>     create and switch to a blank state
   :clear         wipe the current state's history
+  :rename [title]  set the current state's title shown in session lists (none clears it)
+  :usage         show the current state's tokens and cost per provider
+  :budget [continue|reset|limit=value ...]  show the current state's budget, go on past its hard limit,
+                 restore the configured limits, or set soft_tokens, hard_tokens, soft_usd, hard_usd
  :drop <key>    delete a stored state
  :tools         list registered tools
   :memories [n]  show up to n stored memory summaries (default 5)
   :thinking ...  toggle thinking mode (:thinking on|off)
+  :thinking-mode [collapse|hide|discard]  show, hide or stop storing this session's reasoning
   :reload [file] reload configuration from disk (default current config)
+  :revert [last|n|all] [force]  list turns that changed files, or undo one turn or the whole conversation
   :compact [n]   force compaction (ignores thresholds), protecting latest n messages (default config)
   :plan          show the most recent plan snapshot (via update_plan tool)
+  :ingest        seed project facts and memories from README, docs/ and ADRs
+  :explain       explore the workspace and save an overview (architecture, entry points, build and test)
+  :export-knowledge [file]  write project facts and memories (default cando-knowledge.json)
+  :import-knowledge [file]  merge project facts and memories from an export
   :quit          exit the program`)
 	case ":states":
 		keys := a.states.ListKeys()
@@ -1529,6 +2086,11 @@ func (a *Agent) handleCommand(cmd string) bool {
 			fmt.Println("No states yet. Use :new <name> to create one.")
 			return false
 		}
+		for i, key := range keys {
+			if conv, ok := a.states.Get(key); ok && conv.Title() != "" {
+				keys[i] = fmt.Sprintf("%s (%s)", key, conv.Title())
+			}
+		}
 		fmt.Printf("States: %s\n", strings.Join(keys, ", "))
 	case ":use":
 		if len(parts) < 2 {
@@ -1558,6 +2120,30 @@ func (a *Agent) handleCommand(cmd string) bool {
 			return false
 		}
 		fmt.Println("Cleared current state.")
+	case ":rename":
+		title := strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(cmd), ":rename"))
+		if utf8.RuneCountInString(title) > maxSessionTitleRunes {
+			fmt.Printf("Titles are at most %d characters.\n", maxSessionTitleRunes)
+			return false
+		}
+		conv := a.states.Current()
+		conv.SetTitle(title)
+		if err := a.states.Save(conv); err != nil {
+			fmt.Printf("Rename failed: %v\n", err)
+			return false
+		}
+		if title == "" {
+			fmt.Printf("Removed the title of %s\n", conv.Key())
+		} else {
+			fmt.Printf("Renamed %s to %q\n", conv.Key(), title)
+		}
+	case ":usage":
+		printUsage(os.Stdout, a.states.Current(), a.states.Summaries())
+	case ":budget":
+		if err := a.budgetCommand(parts[1:]); err != nil {
+			fmt.Println(err)
+			return false
+		}
 	case ":drop":
 		if len(parts) < 2 {
 			fmt.Println(":drop requires a key")
@@ -1591,7 +2177,7 @@ func (a *Agent) handleCommand(cmd string) bool {
 			return false
 		}
 
-		target := a.cfg.ContextProtectRecent
+		target := a.cfg.Load().ContextProtectRecent
 		if len(parts) >= 2 {
 			val, err := strconv.Atoi(parts[1])
 			if err != nil || val < 0 {
@@ -1601,7 +2187,7 @@ func (a *Agent) handleCommand(cmd string) bool {
 			target = val
 		}
 		setter.SetProtectedRecent(target)
-		defer setter.SetProtectedRecent(a.cfg.ContextProtectRecent)
+		defer setter.SetProtectedRecent(a.cfg.Load().ContextProtectRecent)
 
 		// Force compaction regardless of threshold
 		forcer.ForceCompaction()
@@ -1622,6 +2208,69 @@ func (a *Agent) handleCommand(cmd string) bool {
 		} else {
 			fmt.Println("Compaction executed, but no messages qualified for summarization.")
 		}
+	case ":ingest":
+		root := a.workspaceRoot
+		if root == "" {
+			root = a.cfg.Load().WorkspaceRoot
+		}
+		result, err := a.ingestProjectDocs(context.Background(), root, a.profile, func(message string) {
+			fmt.Println(message)
+		})
+		if err != nil {
+			fmt.Printf("Ingest failed: %v\n", err)
+			return false
+		}
+		fmt.Println(formatIngestResult(result))
+	case ":explain":
+		if a.workspaceRoot == "" {
+			fmt.Println("Explain needs a workspace. Start with --sandbox.")
+			return false
+		}
+		overview, path, err := a.ExplainWorkspace(context.Background(), func(message string) {
+			fmt.Println(message)
+		})
+		if err != nil {
+			fmt.Printf("Explain failed: %v\n", err)
+			return false
+		}
+		a.printResponse(overview)
+		fmt.Printf("Saved to %s\n", path)
+	case ":export-knowledge", ":import-knowledge":
+		root := a.workspaceRoot
+		if root == "" {
+			root = a.cfg.Load().WorkspaceRoot
+		}
+		path := knowledgePath(root, strings.Join(parts[1:], " "))
+		if parts[0] == ":export-knowledge" {
+			archive, err := exportKnowledge(root, a.profile)
+			if err == nil {
+				err = writeKnowledgeFile(path, archive)
+			}
+			if err != nil {
+				fmt.Printf("Export failed: %v\n", err)
+				return false
+			}
+			fmt.Printf("Exported %d facts and %d memories to %s\n", len(archive.Facts), len(archive.Memories), path)
+			return false
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			fmt.Printf("Import failed: %v\n", err)
+			return false
+		}
+		archive, err := parseKnowledgeArchive(data)
+		if err != nil {
+			fmt.Printf("Import failed: %v\n", err)
+			return false
+		}
+		result, err := importKnowledge(root, a.profile, archive)
+		if err != nil {
+			fmt.Printf("Import failed: %v\n", err)
+			return false
+		}
+		fmt.Println(formatKnowledgeImport(result))
+	case ":revert":
+		a.revertCommand(parts[1:])
 	case ":plan":
 		if err := a.showPlan(context.Background()); err != nil {
 			fmt.Printf("Plan fetch failed: %v\n", err)
@@ -1656,12 +2305,12 @@ func (a *Agent) handleCommand(cmd string) bool {
 			if entry.Pinned {
 				flag = " [PINNED]"
 			}
-			fmt.Printf("- %s%s | last access %s | %s\n", entry.ID, flag, entry.LastAccess.Format(time.RFC822), entry.Summary)
+			fmt.Printf("- %s%s | last access %s | %s\n", entry.ID, flag, timefmt.Relative(entry.LastAccess, time.Now()), entry.Summary)
 		}
 	case ":thinking":
 		if len(parts) == 1 {
 			state := "off"
-			if a.cfg.ThinkingEnabled {
+			if a.cfg.Load().ThinkingEnabled {
 				state = "on"
 			}
 			fmt.Printf("Thinking is %s\n", state)
@@ -1669,14 +2318,14 @@ func (a *Agent) handleCommand(cmd string) bool {
 		}
 		switch strings.ToLower(parts[1]) {
 		case "on":
-			a.cfg.ThinkingEnabled = true
-			if err := config.Save(a.cfg); err != nil {
+			updated := a.cfg.Update(func(c *config.Config) { c.ThinkingEnabled = true })
+			if err := config.Save(updated); err != nil {
 				fmt.Printf("Failed to save config: %v\n", err)
 			}
 			fmt.Println("Thinking enabled.")
 		case "off":
-			a.cfg.ThinkingEnabled = false
-			if err := config.Save(a.cfg); err != nil {
+			updated := a.cfg.Update(func(c *config.Config) { c.ThinkingEnabled = false })
+			if err := config.Save(updated); err != nil {
 				fmt.Printf("Failed to save config: %v\n", err)
 			}
 			fmt.Println("Thinking disabled.")
@@ -1684,6 +2333,23 @@ func (a *Agent) handleCommand(cmd string) bool {
 			fmt.Println("Usage: :thinking on|off")
 			return false
 		}
+	case ":thinking-mode":
+		conv := a.states.Current()
+		if len(parts) == 1 {
+			fmt.Printf("Thinking mode for this session is %s\n", conv.ThinkingMode())
+			return false
+		}
+		mode, err := state.ParseThinkingMode(strings.ToLower(parts[1]))
+		if err != nil {
+			fmt.Println(err)
+			return false
+		}
+		conv.SetThinkingMode(mode)
+		if err := a.states.Save(conv); err != nil {
+			fmt.Printf("Failed to save session: %v\n", err)
+			return false
+		}
+		fmt.Printf("Thinking mode set to %s.\n", mode)
 	case ":reload":
 		path := a.cfgPath
 		if len(parts) >= 2 {
@@ -1726,6 +2392,40 @@ func (a *Agent) printResponse(text string) {
 	fmt.Print(strings.TrimRight(rendered, "\n") + "\n")
 }
 
+// rolloverSession archives the older history of an oversized session to a
+// linked part before a turn starts, keeping session files quick to load and
+// save.
+func (a *Agent) rolloverSession(states *state.Manager, conv *state.Conversation, callback StreamCallback) {
+	maxMessages, maxBytes := a.cfg.Load().SessionLimits()
+	archive, err := states.Rollover(conv, state.RolloverLimits{MaxMessages: maxMessages, MaxBytes: maxBytes})
+	if err != nil {
+		a.logger.Printf("[agent] rollover of %s failed: %v", conv.Key(), err)
+		return
+	}
+	if archive != "" && callback != nil {
+		callback("session_rolled_over", map[string]any{
+			"session": conv.Key(),
+			"archive": archive,
+		})
+	}
+}
+
+// lintRequest repairs the structure of the messages about to be sent.
+// Compaction can drop a tool call while keeping its result, or the reverse,
+// even when the stored conversation is sound.
+func (a *Agent) lintRequest(messages []state.Message) []state.Message {
+	repaired, fixes := state.Lint(messages)
+	for _, fix := range fixes {
+		a.logger.Printf("[agent] repaired request: %s", fix)
+	}
+	return repaired
+}
+
+// contextTokens counts messages in the tokens of the active model.
+func (a *Agent) contextTokens(messages []state.Message) int {
+	return tokenizer.CountMessages(tokenizer.For(a.ActiveProviderKey(), a.getActiveModel()), messages)
+}
+
 func conversationCharCount(messages []state.Message) int {
 	// Marshal messages to JSON for accurate size measurement
 	msgData, err := json.Marshal(messages)
@@ -1749,7 +2449,7 @@ func (a *Agent) getActiveModel() string {
 			return opt.Model
 		}
 	}
-	return a.cfg.Model
+	return a.cfg.Load().Model
 }
 
 func (a *Agent) ProviderOptions() []ProviderOption {
@@ -1766,10 +2466,12 @@ func (a *Agent) ActiveProviderKey() string {
 	return a.providerCtrl.ActiveProvider().Key
 }
 
-func (a *Agent) UpdateSystemPrompt(userPrompt string) {
+// UpdateSystemPrompt applies a new user system prompt to every workspace and
+// returns the updated config for saving.
+func (a *Agent) UpdateSystemPrompt(userPrompt string) config.Config {
 	// Extract only the user's portion, stripping base prompt if present
 	userOnly := prompts.ExtractUserPortion(userPrompt)
-	a.cfg.SystemPrompt = userOnly
+	updated := a.cfg.Update(func(c *config.Config) { c.SystemPrompt = userOnly })
 	combined := prompts.Combine(userOnly)
 	a.systemPrompt = combined
 	if a.states != nil {
@@ -1780,6 +2482,7 @@ func (a *Agent) UpdateSystemPrompt(userPrompt string) {
 		ctx.states.SetSystemPrompt(combined)
 	}
 	a.workspacesMu.Unlock()
+	return updated
 }
 
 func (a *Agent) SetActiveProvider(key string) error {
@@ -1790,7 +2493,7 @@ func (a *Agent) SetActiveProvider(key string) error {
 		return err
 	}
 	if opt := a.providerCtrl.ActiveProvider(); opt.Model != "" {
-		a.cfg.Model = opt.Model
+		a.cfg.Update(func(c *config.Config) { c.Model = opt.Model })
 	}
 	return nil
 }
@@ -1808,16 +2511,18 @@ func (a *Agent) ReloadProviders() error {
 	}
 
 	// Build provider registrations
+	cfg := a.cfg.Load()
 	var providerRegs []ProviderRegistration
 	for providerKey, builder := range a.providerBuilders {
-		if creds.IsConfigured(providerKey) {
+		if creds.IsConfigured(providerKey) || !config.RequiresAPIKey(providerKey) {
 			apiKey := creds.GetAPIKey(providerKey)
-			reg, err := builder(a.cfg, apiKey, a.logger)
+			reg, err := builder(cfg, apiKey, a.logger)
 			if err != nil {
 				a.logger.Printf("Warning: %s provider init failed: %v", providerKey, err)
 				continue
 			}
 			if reg != nil {
+				reg.Scope = creds.GetScope(providerKey)
 				providerRegs = append(providerRegs, *reg)
 			}
 		}
@@ -1845,22 +2550,18 @@ func (a *Agent) ReloadProviders() error {
 
 	// Update model in config if active provider has one
 	if opt := a.providerCtrl.ActiveProvider(); opt.Model != "" {
-		a.cfg.Model = opt.Model
+		a.cfg.Update(func(c *config.Config) { c.Model = opt.Model })
 	}
 
 	a.logger.Printf("Providers reloaded: %d configured", len(providerRegs))
+	a.startWarmup(context.Background())
 	return nil
 }
 
 // SwitchWorkspace changes the active workspace by reinitializing state and tooling
 func (a *Agent) SwitchWorkspace(newRoot string) error {
 	// Cancel any in-flight request
-	a.requestCancelMu.Lock()
-	if a.requestCancel != nil {
-		a.requestCancel()
-		a.requestCancel = nil
-	}
-	a.requestCancelMu.Unlock()
+	a.requests.cancelRequest()
 
 	// Resolve absolute path
 	absRoot, err := filepath.Abs(newRoot)
@@ -1884,12 +2585,18 @@ func (a *Agent) SwitchWorkspace(newRoot string) error {
 		return fmt.Errorf("create data root: %w", err)
 	}
 
+	lock, err := a.lockStorage(dataRoot)
+	if err != nil {
+		return err
+	}
+
 	// Create new conversation directory
 	conversationDir := filepath.Join(dataRoot, "conversations")
 
 	// Create new state manager
 	newStates, err := state.NewManager(a.systemPrompt, conversationDir, a.logger)
 	if err != nil {
+		lock.Release()
 		return fmt.Errorf("create state manager: %w", err)
 	}
 
@@ -1898,6 +2605,9 @@ func (a *Agent) SwitchWorkspace(newRoot string) error {
 	newToolOpts.WorkspaceRoot = absRoot
 	newToolOpts.PlanPath = filepath.Join(dataRoot, "plan.json")
 	newToolOpts.ProcessDir = filepath.Join(dataRoot, "processes")
+	newToolOpts.TrashDir = filepath.Join(dataRoot, "trash")
+	newToolOpts.ShellSandbox = a.ShellSandbox(absRoot)
+	newToolOpts.ShellCommands = a.ShellCommands(absRoot)
 
 	// Create new tooling registry
 	newTools := tooling.NewRegistry(tooling.DefaultTools(newToolOpts)...)
@@ -1907,6 +2617,8 @@ func (a *Agent) SwitchWorkspace(newRoot string) error {
 	a.tools = newTools
 	a.workspaceRoot = absRoot
 	a.toolOpts = newToolOpts
+	a.storageLock.Release()
+	a.storageLock = lock
 
 	// Clear last plan since it's from old workspace
 	a.planMu.Lock()
@@ -1929,6 +2641,12 @@ func (a *Agent) GetOrCreateWorkspaceContext(workspacePath string) (*WorkspaceCon
 	a.workspacesMu.RLock()
 	if ctx, exists := a.workspaceContexts[absRoot]; exists {
 		a.workspacesMu.RUnlock()
+		// Another instance took the storage over: stay off it, without
+		// releasing the lock, which would let this instance take it back
+		if err := ctx.storageLock.Check(); err != nil {
+			return nil, err
+		}
+		ctx.touch()
 		return ctx, nil
 	}
 	a.workspacesMu.RUnlock()
@@ -1939,6 +2657,10 @@ func (a *Agent) GetOrCreateWorkspaceContext(workspacePath string) (*WorkspaceCon
 
 	// Double-check after acquiring write lock
 	if ctx, exists := a.workspaceContexts[absRoot]; exists {
+		if err := ctx.storageLock.Check(); err != nil {
+			return nil, err
+		}
+		ctx.touch()
 		return ctx, nil
 	}
 
@@ -1958,6 +2680,17 @@ func (a *Agent) GetOrCreateWorkspaceContext(workspacePath string) (*WorkspaceCon
 		return nil, fmt.Errorf("create data root: %w", err)
 	}
 
+	lock, err := a.lockStorage(dataRoot)
+	if err != nil {
+		return nil, err
+	}
+	created := false
+	defer func() {
+		if !created {
+			lock.Release()
+		}
+	}()
+
 	// Create conversation directory
 	conversationDir := filepath.Join(dataRoot, "conversations")
 
@@ -1972,17 +2705,20 @@ func (a *Agent) GetOrCreateWorkspaceContext(workspacePath string) (*WorkspaceCon
 	newToolOpts.WorkspaceRoot = absRoot
 	newToolOpts.PlanPath = filepath.Join(dataRoot, "plan.json")
 	newToolOpts.ProcessDir = filepath.Join(dataRoot, "processes")
+	newToolOpts.TrashDir = filepath.Join(dataRoot, "trash")
+	newToolOpts.ShellSandbox = a.ShellSandbox(absRoot)
+	newToolOpts.ShellCommands = a.ShellCommands(absRoot)
 
 	// Create tooling registry
 	newTools := tooling.NewRegistry(tooling.DefaultTools(newToolOpts)...)
 
 	// Create workspace-specific config with correct memory store path
-	workspaceCfg := a.cfg
+	workspaceCfg := a.cfg.Load()
 	workspaceCfg.MemoryStorePath = filepath.Join(dataRoot, "memory.db")
 	workspaceCfg.ConversationDir = conversationDir
 
 	// Create workspace-specific profile
-	profileType := a.cfg.ContextProfile
+	profileType := workspaceCfg.ContextProfile
 	// Check if client exists (avoid creating memory profile without credentials)
 	if a.client == nil {
 		profileType = "default"
@@ -1993,6 +2729,7 @@ func (a *Agent) GetOrCreateWorkspaceContext(workspacePath string) (*WorkspaceCon
 		Config:   workspaceCfg,
 		Provider: a.activeProvider,
 		Model:    a.profileModel,
+		IDSeed:   a.memoryIDSeed,
 	})
 	if err != nil {
 		return nil, fmt.Errorf("create workspace profile: %w", err)
@@ -2008,8 +2745,10 @@ func (a *Agent) GetOrCreateWorkspaceContext(workspacePath string) (*WorkspaceCon
 		})
 	}
 
-	// Add profile tools to registry
+	// Add profile and MCP server tools to registry
+	mcpServers := tooling.ConnectMCPServers(context.Background(), workspaceCfg.MCPServersFor(absRoot), absRoot, a.version, a.logger)
 	allTools := append(tooling.DefaultTools(newToolOpts), workspaceProfile.Tools()...)
+	allTools = append(allTools, mcpServers.Tools()...)
 	newTools = tooling.NewRegistry(allTools...)
 
 	// Set tool definitions in profile for compaction calculations
@@ -2024,11 +2763,18 @@ func (a *Agent) GetOrCreateWorkspaceContext(workspacePath string) (*WorkspaceCon
 		states:         newStates,
 		tools:          newTools,
 		profile:        workspaceProfile,
+		mcpServers:     mcpServers,
 		root:           absRoot,
 		previewEnabled: true, // Preview pane enabled by default
+		storageLock:    lock,
 	}
+	ctx.touch()
 	a.workspaceContexts[absRoot] = ctx
+	created = true
 
 	a.logger.Printf("Created workspace context: %s (storage: %s)", absRoot, dataRoot)
+	for _, evicted := range a.evictIdleWorkspacesLocked(absRoot) {
+		a.closeWorkspaceContext(evicted)
+	}
 	return ctx, nil
 }
@@ -70,6 +70,7 @@ func baseTestConfig(workspace string) config.Config {
 		ContextMessagePercent: 0.5,
 		ContextTotalPercent:   0.5,
 		SummaryModel:          "mock-summary",
+		SessionTitles:         new(bool), // Titling would take replies meant for the turn
 		WorkspaceRoot:         workspace,
 		ConversationDir:       filepath.Join(workspace, "conversations"),
 		MemoryStorePath:       filepath.Join(workspace, "memory.db"),
@@ -309,8 +310,8 @@ func TestAgentProviderSwitching(t *testing.T) {
 	if agent.ActiveProviderKey() != "beta" {
 		t.Fatalf("Active provider not updated; got %s", agent.ActiveProviderKey())
 	}
-	if agent.cfg.Model != "model-beta" {
-		t.Fatalf("config model not updated; got %s", agent.cfg.Model)
+	if agent.cfg.Load().Model != "model-beta" {
+		t.Fatalf("config model not updated; got %s", agent.cfg.Load().Model)
 	}
 
 	if err := agent.RunOneShot(context.Background(), "world"); err != nil {
@@ -0,0 +1,92 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"cando/internal/tooling"
+)
+
+const (
+	// maxAutoCaptions bounds vision calls per tool result.
+	maxAutoCaptions = 2
+	// maxAutoCaptionBytes matches the vision tool's upload limit.
+	maxAutoCaptionBytes = 5 * 1024 * 1024
+	autoCaptionPrompt   = "Describe this image for a developer who cannot see it: what it shows, any visible text, numbers, errors or UI state. Be concise."
+)
+
+// imagePathPattern matches file paths with an image extension in tool output.
+var imagePathPattern = regexp.MustCompile(`(?i)[\w./\\~-]+\.(png|jpe?g|gif|webp)\b`)
+
+// createdImages returns workspace-relative paths of images mentioned in a
+// tool result that were written while the tool ran. Images that merely
+// appear in listings or search results predate the call and are ignored.
+func createdImages(result, workspaceRoot string, since time.Time) []string {
+	var paths []string
+	seen := make(map[string]bool)
+	for _, match := range imagePathPattern.FindAllString(result, -1) {
+		abs := match
+		if !filepath.IsAbs(abs) {
+			abs = filepath.Join(workspaceRoot, abs)
+		}
+		rel, err := filepath.Rel(workspaceRoot, filepath.Clean(abs))
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) || seen[rel] {
+			continue
+		}
+		seen[rel] = true
+		info, err := os.Stat(abs)
+		if err != nil || !info.Mode().IsRegular() || info.Size() > maxAutoCaptionBytes {
+			continue
+		}
+		// Allow for coarse filesystem timestamps
+		if info.ModTime().Before(since.Add(-2 * time.Second)) {
+			continue
+		}
+		paths = append(paths, rel)
+		if len(paths) == maxAutoCaptions {
+			break
+		}
+	}
+	return paths
+}
+
+// captionToolImages describes images a tool produced (screenshots, charts)
+// with the vision model and returns the captions to append to its result,
+// so the model need not call analyze_image itself.
+func (a *Agent) captionToolImages(ctx context.Context, toolName, result string, started time.Time, tools *tooling.Registry, workspaceRoot string, callback StreamCallback) string {
+	if toolName == "analyze_image" || workspaceRoot == "" || !a.cfg.Load().IsVisionAutoCaptionEnabled() {
+		return ""
+	}
+	vision, ok := tools.Lookup("analyze_image")
+	if !ok {
+		return ""
+	}
+	var captions []string
+	for _, path := range createdImages(result, workspaceRoot, started) {
+		if callback != nil {
+			callback("status", map[string]any{"message": "Describing " + path + "..."})
+		}
+		out, err := vision.Call(ctx, map[string]any{"image_path": path, "prompt": autoCaptionPrompt})
+		if err != nil {
+			a.logger.Printf("[vision] auto-caption of %s failed: %v", path, err)
+			continue
+		}
+		var parsed struct {
+			Analysis string `json:"analysis"`
+		}
+		if json.Unmarshal([]byte(out), &parsed) != nil || strings.TrimSpace(parsed.Analysis) == "" {
+			continue
+		}
+		captions = append(captions, fmt.Sprintf("- %s: %s", path, strings.TrimSpace(parsed.Analysis)))
+	}
+	if len(captions) == 0 {
+		return ""
+	}
+	return "\n\n[Image descriptions generated by the vision model]\n" + strings.Join(captions, "\n")
+}
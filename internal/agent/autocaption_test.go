@@ -0,0 +1,42 @@
+package agent
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestCreatedImages(t *testing.T) {
+	root := t.TempDir()
+	write := func(rel string, mod time.Time) {
+		path := filepath.Join(root, rel)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte("img"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, mod, mod); err != nil {
+			t.Fatal(err)
+		}
+	}
+	started := time.Now()
+	write("old.png", started.Add(-time.Hour))
+	write("out/chart.PNG", started.Add(time.Second))
+	write("shot.jpeg", started.Add(time.Second))
+
+	result := "listing: old.png\nsaved out/chart.PNG and " + filepath.Join(root, "shot.jpeg") +
+		"\nmissing.png ../outside.png out/chart.PNG"
+	got := createdImages(result, root, started)
+	want := []string{filepath.Join("out", "chart.PNG"), "shot.jpeg"}
+	if !slices.Equal(got, want) {
+		t.Errorf("createdImages = %v, want %v", got, want)
+	}
+
+	write("third.gif", started.Add(time.Second))
+	if got := createdImages(result+" third.gif", root, started); len(got) != maxAutoCaptions {
+		t.Errorf("expected at most %d images, got %v", maxAutoCaptions, got)
+	}
+}
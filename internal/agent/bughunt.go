@@ -0,0 +1,119 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"cando/internal/githistory"
+	"cando/internal/state"
+)
+
+const (
+	// bugHuntMaxFiles caps the files whose history seeds a turn.
+	bugHuntMaxFiles = 5
+	// bugHuntCommits is how many commits the seed lists.
+	bugHuntCommits = 10
+	// bugHuntTimeout bounds the git calls made before the turn starts.
+	bugHuntTimeout = 3 * time.Second
+)
+
+// bugHuntPathPattern matches file-like tokens in a prompt: paths, bare file
+// names and the file part of stack trace locations such as agent.go:120.
+var bugHuntPathPattern = regexp.MustCompile(`[\w./-]*\w\.[A-Za-z]\w{0,7}\b`)
+
+// loadBugHuntContext lists the recent commits touching the files the
+// turn's prompt names, or the files the session touched lately when it names
+// none. It returns "" unless bug-hunt mode is on.
+func (a *Agent) loadBugHuntContext(ctx context.Context, workspaceRoot string, conv *state.Conversation) string {
+	if workspaceRoot == "" || !a.cfg.Load().BugHunt {
+		return ""
+	}
+	ctx, cancel := context.WithTimeout(ctx, bugHuntTimeout)
+	defer cancel()
+
+	prompt := ""
+	messages := conv.Messages()
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messages[i].Role == "user" {
+			prompt = messages[i].Content
+			break
+		}
+	}
+	files := bugHuntFiles(ctx, workspaceRoot, prompt)
+	if len(files) == 0 {
+		a.workspacesMu.RLock()
+		wsCtx := a.workspaceContexts[workspaceRoot]
+		a.workspacesMu.RUnlock()
+		if wsCtx != nil {
+			files = wsCtx.recentFilePaths(conv.Key(), bugHuntMaxFiles)
+		}
+	}
+	if len(files) == 0 {
+		return ""
+	}
+
+	commits, err := githistory.Log(ctx, workspaceRoot, githistory.LogOptions{Paths: files, Limit: bugHuntCommits})
+	if err != nil {
+		if !errors.Is(err, githistory.ErrNotRepository) {
+			a.logger.Printf("[bughunt] %s: %v", workspaceRoot, err)
+		}
+		return ""
+	}
+	if len(commits) == 0 {
+		return ""
+	}
+	return "Files: " + strings.Join(files, ", ") + "\n" + strings.TrimSuffix(githistory.FormatLog(commits), "\n")
+}
+
+// bugHuntFiles returns the workspace files a prompt mentions, relative to
+// the root. Bare file names are matched to the one tracked file with that
+// name, if there is exactly one.
+func bugHuntFiles(ctx context.Context, root, prompt string) []string {
+	var files []string
+	seen := make(map[string]bool)
+	for _, token := range bugHuntPathPattern.FindAllString(prompt, -1) {
+		if len(files) == bugHuntMaxFiles {
+			break
+		}
+		rel, err := lexicalRelPath(root, token)
+		if err != nil {
+			continue
+		}
+		if info, err := os.Stat(filepath.Join(root, filepath.FromSlash(rel))); err != nil || info.IsDir() {
+			found, ok := githistory.FindFile(ctx, root, token)
+			if !ok {
+				continue
+			}
+			rel = found
+		}
+		if !seen[rel] {
+			seen[rel] = true
+			files = append(files, rel)
+		}
+	}
+	return files
+}
+
+// injectBugHunt appends the bug-hunt history seed to the system message.
+func injectBugHunt(messages []state.Message, seed string) []state.Message {
+	if seed == "" || len(messages) == 0 {
+		return messages
+	}
+
+	// Make a copy to avoid modifying the original
+	result := make([]state.Message, len(messages))
+	copy(result, messages)
+
+	for i, msg := range result {
+		if msg.Role == "system" {
+			result[i].Content = msg.Content + "\n\n---\nBug hunt: recent commits touching the files in question. Regressions are usually explained by recent changes; check these first and use the git_history tool to blame lines or show a commit's patch:\n" + seed
+			break
+		}
+	}
+	return result
+}
@@ -0,0 +1,44 @@
+package agent
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"cando/internal/state"
+)
+
+func TestBugHuntFiles(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	root := t.TempDir()
+	for _, rel := range []string{"internal/parse/lexer.go", "cmd/main.go", "README.md"} {
+		abs := filepath.Join(root, rel)
+		os.MkdirAll(filepath.Dir(abs), 0o755)
+		if err := os.WriteFile(abs, []byte("x\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, args := range [][]string{{"init", "-q"}, {"add", "."}} {
+		if out, err := exec.Command("git", append([]string{"-C", root}, args...)...).CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, out)
+		}
+	}
+
+	prompt := "Since yesterday cmd/main.go panics:\n  at lexer.go:42\n  at cmd/main.go:10\nSee example.com and ../secret.txt, e.g. README.md."
+	got := bugHuntFiles(context.Background(), root, prompt)
+	want := []string{"cmd/main.go", "internal/parse/lexer.go", "README.md"}
+	if !slices.Equal(got, want) {
+		t.Errorf("files = %v, want %v", got, want)
+	}
+
+	messages := injectBugHunt([]state.Message{{Role: "system", Content: "base"}, {Role: "user", Content: "hi"}}, "Files: cmd/main.go\nabc1234 2025-01-01 Ada: Break main")
+	if !strings.HasPrefix(messages[0].Content, "base\n\n---\nBug hunt:") || !strings.HasSuffix(messages[0].Content, "Ada: Break main") {
+		t.Errorf("system message = %q", messages[0].Content)
+	}
+}
@@ -0,0 +1,203 @@
+package agent
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// errChangedSinceTurn is returned when a file was edited after the turn
+// that changed it; reverting would discard those edits.
+var errChangedSinceTurn = errors.New("file changed since the turn; pass force to revert anyway")
+
+// changeView is one file of the latest turn as listed by /api/changes.
+type changeView struct {
+	fileChange
+	Revertable    bool `json:"revertable"`
+	ModifiedSince bool `json:"modified_since,omitempty"`
+}
+
+// changesView lists the latest turn's changes for the current session.
+func changesView(root string, changes *turnChanges) map[string]any {
+	return map[string]any{
+		"turn_id": changes.Summary.TurnID,
+		"session": changes.Summary.Session,
+		"time":    changes.Summary.Time,
+		"files":   changeViews(root, changes.Summary.Files, changes.Snapshots),
+		"summary": changes.Summary,
+	}
+}
+
+// changeViews pairs a turn's files with their snapshots. snapshots[i] holds
+// the original of files[i].
+func changeViews(root string, changes []fileChange, snapshots []*fileSnapshot) []changeView {
+	files := make([]changeView, 0, len(changes))
+	for i, change := range changes {
+		view := changeView{fileChange: change}
+		if i < len(snapshots) {
+			snap := snapshots[i]
+			view.Revertable = !snap.TooLarge && change.Resolution == ""
+			view.ModifiedSince = snap.AfterHash != "" && currentHash(root, snap.Path) != snap.AfterHash
+		}
+		files = append(files, view)
+	}
+	return files
+}
+
+func currentHash(root, rel string) string {
+	data, err := os.ReadFile(filepath.Join(root, filepath.FromSlash(rel)))
+	return contentHash(data, err == nil)
+}
+
+// revertSnapshot restores a file to its content before the turn.
+func revertSnapshot(root string, snap *fileSnapshot, force bool) error {
+	if snap.TooLarge {
+		return fmt.Errorf("%s is too large to revert automatically", snap.Path)
+	}
+	if !force && snap.AfterHash != "" && currentHash(root, snap.Path) != snap.AfterHash {
+		return errChangedSinceTurn
+	}
+	abs := filepath.Join(root, filepath.FromSlash(snap.Path))
+	if !snap.Existed {
+		if err := os.Remove(abs); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	mode := os.FileMode(0o644)
+	if info, err := os.Stat(abs); err == nil {
+		mode = info.Mode().Perm()
+	}
+	if err := os.MkdirAll(filepath.Dir(abs), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(abs, snap.Content, mode)
+}
+
+// handleChanges lists the files the current session's latest turn changed
+// (GET) and keeps or rolls them back one at a time (POST {"path", "action":
+// "accept"|"revert", "force"}). An empty path applies the action to every
+// unresolved file.
+func (s *webServer) handleChanges(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		s.respondError(w, r, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	workspace := s.getWorkspaceFromRequest(r)
+	if workspace == "" || !s.workspaceExists(workspace) {
+		s.respondError(w, r, http.StatusBadRequest, "select a workspace first")
+		return
+	}
+	wsCtx, err := s.agent.GetOrCreateWorkspaceContext(workspace)
+	if err != nil {
+		s.respondError(w, r, http.StatusInternalServerError, fmt.Sprintf("get workspace context: %v", err))
+		return
+	}
+	changes, err := loadTurnChanges(wsCtx.root, wsCtx.states.CurrentKey())
+	if err != nil {
+		s.respondError(w, r, http.StatusInternalServerError, fmt.Sprintf("load turn changes: %v", err))
+		return
+	}
+	if changes == nil {
+		changes = &turnChanges{Summary: turnSummary{Session: wsCtx.states.CurrentKey(), Files: []fileChange{}}}
+	}
+	if r.Method == http.MethodGet {
+		s.writeJSON(w, r, changesView(wsCtx.root, changes))
+		return
+	}
+
+	var req struct {
+		Path   string `json:"path"`
+		Action string `json:"action"`
+		Force  bool   `json:"force"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.respondError(w, r, http.StatusBadRequest, "invalid payload")
+		return
+	}
+	if req.Action != "accept" && req.Action != "revert" {
+		s.respondError(w, r, http.StatusBadRequest, "action must be accept or revert")
+		return
+	}
+	if !s.claimWorkspace(w, r, workspace) {
+		return
+	}
+	if wsCtx.HasInFlightRequest() {
+		s.respondError(w, r, http.StatusConflict, "wait for the running turn to finish")
+		return
+	}
+	target := ""
+	if strings.TrimSpace(req.Path) != "" {
+		if target, err = workspaceRelPath(wsCtx.root, req.Path, s.agent.cfg.Load().AllowExternalSymlinks); err != nil {
+			s.respondError(w, r, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	matched := false
+	var resolved []string
+	for i := range changes.Summary.Files {
+		change := &changes.Summary.Files[i]
+		if target != "" && change.Path != target {
+			continue
+		}
+		if change.Resolution != "" || i >= len(changes.Snapshots) {
+			if target != "" {
+				s.respondError(w, r, http.StatusConflict, fmt.Sprintf("%s was already %s", change.Path, change.Resolution))
+				return
+			}
+			continue
+		}
+		matched = true
+		if req.Action == "revert" {
+			if err := revertSnapshot(wsCtx.root, changes.Snapshots[i], req.Force); err != nil {
+				status := http.StatusInternalServerError
+				if errors.Is(err, errChangedSinceTurn) {
+					status = http.StatusConflict
+				}
+				s.respondError(w, r, status, fmt.Sprintf("%s: %v", change.Path, err))
+				return
+			}
+			change.Resolution = "reverted"
+			s.agent.logger.Printf("[ws:%s] reverted %s from turn %s", wsCtx.root, change.Path, changes.Summary.TurnID)
+		} else {
+			change.Resolution = "accepted"
+		}
+		resolved = append(resolved, change.Path)
+		// Save after each file so a later failure keeps earlier resolutions
+		if err := saveTurnChanges(wsCtx.root, *changes); err != nil {
+			s.respondError(w, r, http.StatusInternalServerError, fmt.Sprintf("save turn changes: %v", err))
+			return
+		}
+	}
+	if len(resolved) > 0 {
+		verb := "Kept"
+		if req.Action == "revert" {
+			verb = "Reverted"
+		}
+		summary := fmt.Sprintf("%s %s", verb, resolved[0])
+		if len(resolved) > 1 {
+			summary = fmt.Sprintf("%s %d files", verb, len(resolved))
+		}
+		if req.Action == "revert" {
+			if err := markCheckpointReverted(wsCtx.root, changes.Summary.Session, changes.Summary.TurnID, resolved); err != nil {
+				s.agent.logger.Printf("[ws:%s] checkpoint update failed: %v", wsCtx.root, err)
+			}
+		}
+		recordActivity(wsCtx.root, activityEntry{
+			Kind:    activityChangesResolved,
+			Session: changes.Summary.Session,
+			Summary: summary,
+			Details: map[string]any{"action": req.Action, "paths": resolved, "turn_id": changes.Summary.TurnID},
+		}, s.logger)
+	}
+	if target != "" && !matched {
+		s.respondError(w, r, http.StatusNotFound, fmt.Sprintf("%s was not changed in the last turn", target))
+		return
+	}
+	s.writeJSON(w, r, changesView(wsCtx.root, changes))
+}
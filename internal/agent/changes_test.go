@@ -0,0 +1,48 @@
+package agent
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRevertSnapshot(t *testing.T) {
+	root := t.TempDir()
+	path := func(name string) string { return filepath.Join(root, name) }
+	if err := os.WriteFile(path("kept.txt"), []byte("original\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	modified := takeSnapshot(root, "kept.txt")
+	added := takeSnapshot(root, "new.txt")
+
+	// The turn edits one file and creates another
+	os.WriteFile(path("kept.txt"), []byte("agent edit\n"), 0o600)
+	os.WriteFile(path("new.txt"), []byte("created\n"), 0o644)
+	for _, snap := range []*fileSnapshot{modified, added} {
+		if _, ok := diffSnapshot(root, snap); !ok {
+			t.Fatalf("%s not reported as changed", snap.Path)
+		}
+	}
+
+	// A later edit blocks the revert unless forced
+	os.WriteFile(path("kept.txt"), []byte("user edit\n"), 0o600)
+	if err := revertSnapshot(root, modified, false); !errors.Is(err, errChangedSinceTurn) {
+		t.Fatalf("revert over later edit = %v, want errChangedSinceTurn", err)
+	}
+	if err := revertSnapshot(root, modified, true); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := os.ReadFile(path("kept.txt"))
+	info, _ := os.Stat(path("kept.txt"))
+	if string(data) != "original\n" || info.Mode().Perm() != 0o600 {
+		t.Errorf("reverted file = %q mode %v", data, info.Mode().Perm())
+	}
+
+	if err := revertSnapshot(root, added, false); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path("new.txt")); !os.IsNotExist(err) {
+		t.Errorf("reverting an added file should delete it, stat err = %v", err)
+	}
+}
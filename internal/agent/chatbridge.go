@@ -0,0 +1,288 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"cando/internal/chatbridge"
+	"cando/internal/config"
+	"cando/internal/llm"
+	"cando/internal/state"
+)
+
+// Reconnect backoff for chat bridge connections.
+const (
+	chatBridgeRetryMin = 5 * time.Second
+	chatBridgeRetryMax = 5 * time.Minute
+)
+
+// chatRelay forwards messages from one chat bot into a workspace session and
+// posts the reply, plus any file changes as diff snippets, back to the thread.
+type chatRelay struct {
+	web *webServer
+	bot chatbridge.Bot
+	cfg config.ChatBridge
+}
+
+// startChatBridges connects every configured chat bot. Each bridge runs in
+// the background and reconnects with backoff until ctx is cancelled.
+func (s *webServer) startChatBridges(ctx context.Context) {
+	for _, cfg := range s.agent.cfg.Load().ChatBridges {
+		bot, err := chatbridge.New(cfg.Platform, os.ExpandEnv(cfg.BotToken), os.ExpandEnv(cfg.AppToken))
+		if err != nil {
+			s.logger.Printf("[chat] %v", err)
+			continue
+		}
+		relay := &chatRelay{web: s, bot: bot, cfg: cfg}
+		go relay.run(ctx)
+		s.logger.Printf("[chat] %s bridge started for %s", cfg.Platform, cfg.Workspace)
+	}
+}
+
+func (r *chatRelay) run(ctx context.Context) {
+	delay := chatBridgeRetryMin
+	for {
+		started := time.Now()
+		err := r.bot.Run(ctx, func(msg chatbridge.Message) {
+			go r.handle(ctx, msg)
+		})
+		if ctx.Err() != nil {
+			return
+		}
+		// A connection that stayed up for a while resets the backoff
+		if time.Since(started) > chatBridgeRetryMax {
+			delay = chatBridgeRetryMin
+		}
+		r.web.logger.Printf("[chat] %s bridge disconnected: %v (retrying in %s)", r.bot.Platform(), err, delay)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+		delay = min(delay*2, chatBridgeRetryMax)
+	}
+}
+
+func (r *chatRelay) handle(ctx context.Context, msg chatbridge.Message) {
+	if !r.accepts(msg) {
+		return
+	}
+	s := r.web
+	wsCtx, err := r.workspaceContext()
+	if err != nil {
+		r.post(ctx, msg, fmt.Sprintf("Error: %v", err))
+		return
+	}
+
+	if strings.EqualFold(msg.Text, "!cancel") {
+		if wsCtx.CancelRequest() {
+			r.post(ctx, msg, "Cancelled the running request.")
+		} else {
+			r.post(ctx, msg, "Nothing is running.")
+		}
+		return
+	}
+
+	// Take the workspace lock like a browser tab would, so a chat prompt
+	// cannot slip in while someone works in the web UI
+	client := "chat:" + r.bot.Platform()
+	if s.locks != nil {
+		held, ok := s.locks.claim(wsCtx.root, client, r.bot.Platform()+" bridge", false, time.Now())
+		if !ok {
+			idle := time.Since(held.LastSeen).Round(time.Second)
+			r.post(ctx, msg, fmt.Sprintf("This workspace is in use in the Cando web UI (active %s ago). Try again later.", idle))
+			return
+		}
+		defer s.locks.release(wsCtx.root, client)
+	}
+	s.logger.Printf("[chat] [ws:%s] %s prompt from %s", wsCtx.root, r.bot.Platform(), msg.User)
+
+	changes := &chatChangeCollector{}
+	var reply string
+	var replyMu sync.Mutex
+	observe := func(eventType string, data any) error {
+		payload, ok := data.(map[string]any)
+		switch {
+		case !ok:
+		case eventType == "assistant_message":
+			// The last message of the turn is its reply
+			replyMu.Lock()
+			reply, _ = payload["content"].(string)
+			replyMu.Unlock()
+		case eventType == "tool_approval_required":
+			// Approvals are answered in the web UI; say why the turn is waiting
+			r.post(ctx, msg, fmt.Sprintf("Waiting for approval to run %v: %v. Approve or reject it in the Cando web UI.", payload["tool"], payload["summary"]))
+		}
+		return changes.observe(eventType, data)
+	}
+
+	// Run through the prompt queue, so the prompt waits for turns started
+	// elsewhere instead of running next to them
+	busy := s.workspaceBusy(wsCtx)
+	done := make(chan error, 1)
+	_, position, err := s.enqueue(wsCtx, queuedPrompt{Content: msg.Text, observe: observe, done: done})
+	if err != nil {
+		r.post(ctx, msg, fmt.Sprintf("Error: %v", err))
+		return
+	}
+	if busy || position > 1 {
+		r.post(ctx, msg, fmt.Sprintf("Cando is busy; your prompt is queued at position %d. Send `!cancel` to stop the running prompt.", position))
+	}
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		return
+	}
+
+	for _, snippet := range changes.snippets {
+		if postErr := r.bot.PostSnippet(ctx, msg, snippet.title, "diff", snippet.diff); postErr != nil {
+			s.logger.Printf("[chat] %s snippet failed: %v", r.bot.Platform(), postErr)
+		}
+	}
+	if err != nil {
+		if pe, ok := llm.IsProviderError(err); ok {
+			r.post(ctx, msg, fmt.Sprintf("Provider error (%s): %s", pe.Provider, pe.Error()))
+			return
+		}
+		r.post(ctx, msg, fmt.Sprintf("Error: %v", err))
+		return
+	}
+	replyMu.Lock()
+	defer replyMu.Unlock()
+	if strings.TrimSpace(reply) == "" {
+		reply = "(no reply)"
+	}
+	r.post(ctx, msg, reply)
+}
+
+// accepts reports whether msg comes from the bridge's channel and one of its
+// allowed users; an empty setting accepts any.
+func (r *chatRelay) accepts(msg chatbridge.Message) bool {
+	if r.cfg.Channel != "" && msg.Channel != r.cfg.Channel {
+		return false
+	}
+	return len(r.cfg.AllowedUsers) == 0 || slices.Contains(r.cfg.AllowedUsers, msg.User)
+}
+
+// workspaceContext resolves the bridge's workspace and selects its session,
+// creating the session on first use.
+func (r *chatRelay) workspaceContext() (*WorkspaceContext, error) {
+	wsCtx, err := r.web.agent.GetOrCreateWorkspaceContext(r.cfg.Workspace)
+	if err != nil {
+		return nil, err
+	}
+	key := strings.TrimSpace(r.cfg.Session)
+	if key == "" || wsCtx.states.CurrentKey() == key {
+		return wsCtx, nil
+	}
+	if _, err := wsCtx.states.Use(key); err != nil {
+		if !errors.Is(err, state.ErrUnknownState) {
+			return nil, err
+		}
+		if _, err := wsCtx.states.NewState(key); err != nil {
+			return nil, fmt.Errorf("create session %s: %w", key, err)
+		}
+	}
+	return wsCtx, nil
+}
+
+func (r *chatRelay) post(ctx context.Context, msg chatbridge.Message, text string) {
+	if err := r.bot.Post(ctx, msg, text); err != nil {
+		r.web.logger.Printf("[chat] %s post failed: %v", r.bot.Platform(), err)
+	}
+}
+
+type chatSnippet struct {
+	title string
+	diff  string
+}
+
+// chatChangeCollector turns successful file-editing tool calls from a turn
+// into diff snippets.
+type chatChangeCollector struct {
+	mu       sync.Mutex
+	pending  map[string]map[string]any // tool call ID -> arguments
+	snippets []chatSnippet
+}
+
+func (c *chatChangeCollector) observe(eventType string, data any) error {
+	payload, ok := data.(map[string]any)
+	if !ok {
+		return nil
+	}
+	id, _ := payload["id"].(string)
+	function, _ := payload["function"].(string)
+	if function != "edit_file" && function != "write_file" && function != "apply_patch" {
+		return nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	switch eventType {
+	case "tool_call_started":
+		raw, _ := payload["arguments"].(string)
+		var args map[string]any
+		if err := json.Unmarshal([]byte(raw), &args); err != nil {
+			return nil
+		}
+		if c.pending == nil {
+			c.pending = make(map[string]map[string]any)
+		}
+		c.pending[id] = args
+	case "tool_call_completed":
+		args := c.pending[id]
+		delete(c.pending, id)
+		if failed, _ := payload["error"].(bool); failed || args == nil {
+			return nil
+		}
+		if snippet, ok := toolChangeSnippet(function, args); ok {
+			c.snippets = append(c.snippets, snippet)
+		}
+	}
+	return nil
+}
+
+// toolChangeSnippet renders the change a file tool made as a diff.
+func toolChangeSnippet(function string, args map[string]any) (chatSnippet, bool) {
+	path, _ := args["path"].(string)
+	switch function {
+	case "edit_file":
+		oldString, _ := args["old_string"].(string)
+		newString, _ := args["new_string"].(string)
+		var b strings.Builder
+		fmt.Fprintf(&b, "--- a/%s\n+++ b/%s\n", path, path)
+		for _, line := range strings.Split(oldString, "\n") {
+			b.WriteString("-" + line + "\n")
+		}
+		for _, line := range strings.Split(newString, "\n") {
+			b.WriteString("+" + line + "\n")
+		}
+		return chatSnippet{title: "Edited " + path, diff: b.String()}, true
+	case "write_file":
+		content, _ := args["content"].(string)
+		mode, _ := args["mode"].(string)
+		if mode == "" {
+			mode = "append"
+		}
+		var b strings.Builder
+		fmt.Fprintf(&b, "+++ b/%s (%s)\n", path, mode)
+		for _, line := range strings.Split(strings.TrimSuffix(content, "\n"), "\n") {
+			b.WriteString("+" + line + "\n")
+		}
+		return chatSnippet{title: "Wrote " + path, diff: b.String()}, true
+	case "apply_patch":
+		patch, _ := args["patch"].(string)
+		if strings.TrimSpace(patch) == "" {
+			return chatSnippet{}, false
+		}
+		return chatSnippet{title: "Applied patch", diff: patch}, true
+	}
+	return chatSnippet{}, false
+}
@@ -0,0 +1,148 @@
+package agent
+
+import (
+	"context"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"cando/internal/chatbridge"
+	"cando/internal/config"
+)
+
+func TestChatChangeCollectorBuildsDiffSnippets(t *testing.T) {
+	c := &chatChangeCollector{}
+	c.observe("tool_call_started", map[string]any{
+		"id":        "call-1",
+		"function":  "edit_file",
+		"arguments": `{"path":"main.go","old_string":"a := 1","new_string":"a := 2"}`,
+	})
+	c.observe("tool_call_started", map[string]any{
+		"id":        "call-2",
+		"function":  "write_file",
+		"arguments": `{"path":"notes.txt","content":"hello"}`,
+	})
+	c.observe("tool_call_completed", map[string]any{"id": "call-1", "function": "edit_file", "error": false})
+	c.observe("tool_call_completed", map[string]any{"id": "call-2", "function": "write_file", "error": true})
+
+	if len(c.snippets) != 1 {
+		t.Fatalf("expected only the successful edit, got %d snippets", len(c.snippets))
+	}
+	snippet := c.snippets[0]
+	if snippet.title != "Edited main.go" {
+		t.Fatalf("unexpected title %q", snippet.title)
+	}
+	if !strings.Contains(snippet.diff, "-a := 1\n") || !strings.Contains(snippet.diff, "+a := 2\n") {
+		t.Fatalf("unexpected diff:\n%s", snippet.diff)
+	}
+}
+
+// recordingBot collects what a relay posts.
+type recordingBot struct {
+	mu    sync.Mutex
+	posts []string
+}
+
+func (b *recordingBot) Platform() string { return "slack" }
+
+func (b *recordingBot) Run(ctx context.Context, handle func(chatbridge.Message)) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func (b *recordingBot) Post(ctx context.Context, msg chatbridge.Message, text string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.posts = append(b.posts, text)
+	return nil
+}
+
+func (b *recordingBot) PostSnippet(ctx context.Context, msg chatbridge.Message, title, lang, content string) error {
+	return nil
+}
+
+func (b *recordingBot) posted() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]string(nil), b.posts...)
+}
+
+func TestChatRelayQueuesBehindRunningTurn(t *testing.T) {
+	configDir := t.TempDir()
+	t.Setenv("CANDO_CONFIG_DIR", configDir)
+	workspace := t.TempDir()
+	cfg := baseTestConfig(workspace)
+	client := &gatedClient{release: make(chan struct{})}
+	multi, err := NewMultiProviderClient("mock", []ProviderRegistration{
+		{Option: ProviderOption{Key: "mock", Label: "Mock", Model: cfg.Model}, Client: client},
+	})
+	if err != nil {
+		t.Fatalf("multi provider: %v", err)
+	}
+	agent := newTestAgent(t, multi, cfg)
+	s := &webServer{
+		agent:       agent,
+		logger:      log.New(io.Discard, "", 0),
+		submissions: newIdempotencyStore(),
+		streams:     newTurnStreams(),
+		prompts:     newPromptQueues(),
+		locks:       newSessionLocks(),
+	}
+	wsCtx, err := agent.GetOrCreateWorkspaceContext(workspace)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bot := &recordingBot{}
+	relay := &chatRelay{web: s, bot: bot, cfg: config.ChatBridge{Workspace: workspace, AllowedUsers: []string{"U1"}}}
+	ctx := context.Background()
+
+	relay.handle(ctx, chatbridge.Message{User: "U2", Text: "rm -rf everything"})
+	if posts := bot.posted(); len(posts) != 0 {
+		t.Fatalf("relayed a message from a user not on allowed_users: %q", posts)
+	}
+
+	// A turn started from the web UI holds the model
+	first := make(chan error, 1)
+	go func() {
+		first <- s.executeTurn(ctx, httptest.NewRequest(http.MethodPost, "/api/stream", nil), wsCtx, "first", newTurnID(), func(string, any) error { return nil })
+	}()
+	deadline := time.Now().Add(5 * time.Second)
+	for !wsCtx.HasInFlightRequest() {
+		if time.Now().After(deadline) {
+			t.Fatal("first turn never started")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	handled := make(chan struct{})
+	go func() {
+		defer close(handled)
+		relay.handle(ctx, chatbridge.Message{User: "U1", Text: "from chat"})
+	}()
+	for len(bot.posted()) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("chat prompt was neither queued nor answered")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if posts := bot.posted(); !strings.Contains(posts[0], "queued at position 1") {
+		t.Fatalf("posts = %q, want the prompt queued", posts)
+	}
+
+	close(client.release)
+	if err := <-first; err != nil {
+		t.Fatalf("first turn: %v", err)
+	}
+	<-handled
+	if seen := client.seen(); len(seen) != 2 || seen[0] != "first" || seen[1] != "from chat" {
+		t.Fatalf("prompts ran as %q", seen)
+	}
+	if posts := bot.posted(); posts[len(posts)-1] != "ok" {
+		t.Fatalf("posts = %q, want the reply last", posts)
+	}
+}
@@ -0,0 +1,440 @@
+package agent
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	checkpointsDir = "checkpoints"
+	// maxCheckpoints bounds the turns kept per session; the oldest go first.
+	maxCheckpoints = 200
+)
+
+var errCheckpointNotFound = errors.New("no such checkpoint")
+
+// checkpoint records the files one turn changed and their originals, so the
+// turn can be undone later. turnChanges keeps only a session's latest turn;
+// checkpoints keep every turn that changed files.
+type checkpoint struct {
+	ID        string          `json:"id"`
+	Prompt    string          `json:"prompt,omitempty"`
+	Summary   turnSummary     `json:"summary"`
+	Snapshots []*fileSnapshot `json:"snapshots"`
+}
+
+// checkpointView is a checkpoint as listed by /api/checkpoints and :revert.
+type checkpointView struct {
+	ID         string       `json:"id"`
+	TurnID     string       `json:"turn_id,omitempty"`
+	Time       time.Time    `json:"time"`
+	Prompt     string       `json:"prompt,omitempty"`
+	Files      []changeView `json:"files"`
+	Insertions int          `json:"insertions"`
+	Deletions  int          `json:"deletions"`
+	Reverted   bool         `json:"reverted"` // Every file was reverted
+}
+
+func (cp *checkpoint) view(root string) checkpointView {
+	view := checkpointView{
+		ID:         cp.ID,
+		TurnID:     cp.Summary.TurnID,
+		Time:       cp.Summary.Time,
+		Prompt:     cp.Prompt,
+		Files:      changeViews(root, cp.Summary.Files, cp.Snapshots),
+		Insertions: cp.Summary.Insertions,
+		Deletions:  cp.Summary.Deletions,
+		Reverted:   len(cp.Summary.Files) > 0,
+	}
+	for _, change := range cp.Summary.Files {
+		if change.Resolution != "reverted" {
+			view.Reverted = false
+		}
+	}
+	return view
+}
+
+func checkpointDir(workspaceRoot, session string) (string, error) {
+	storageRoot, err := ProjectStorageRoot(workspaceRoot)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(storageRoot, checkpointsDir, generateSlug(session)), nil
+}
+
+// saveCheckpoint writes cp, assigning its ID on first save, and drops the
+// session's oldest checkpoints beyond maxCheckpoints.
+func saveCheckpoint(workspaceRoot string, cp *checkpoint) error {
+	dir, err := checkpointDir(workspaceRoot, cp.Summary.Session)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	fresh := cp.ID == ""
+	if fresh {
+		// Fixed-width nanoseconds, so file names sort by time
+		cp.ID = fmt.Sprintf("%019d", cp.Summary.Time.UnixNano())
+	}
+	data, err := json.Marshal(cp)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(dir, cp.ID+".json"), data, 0o644); err != nil {
+		return err
+	}
+	if fresh {
+		names := checkpointFiles(dir)
+		for len(names) > maxCheckpoints {
+			os.Remove(filepath.Join(dir, names[0]))
+			names = names[1:]
+		}
+	}
+	return nil
+}
+
+// checkpointFiles lists the checkpoint files in dir, oldest first.
+func checkpointFiles(dir string) []string {
+	entries, _ := os.ReadDir(dir)
+	var names []string
+	for _, entry := range entries {
+		if name := entry.Name(); strings.HasSuffix(name, ".json") && !entry.IsDir() {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// loadCheckpoints returns the session's checkpoints, newest first.
+// Unreadable files are skipped.
+func loadCheckpoints(workspaceRoot, session string) ([]*checkpoint, error) {
+	dir, err := checkpointDir(workspaceRoot, session)
+	if err != nil {
+		return nil, err
+	}
+	names := checkpointFiles(dir)
+	checkpoints := make([]*checkpoint, 0, len(names))
+	for i := len(names) - 1; i >= 0; i-- {
+		data, err := os.ReadFile(filepath.Join(dir, names[i]))
+		if err != nil {
+			continue
+		}
+		var cp checkpoint
+		if json.Unmarshal(data, &cp) != nil || cp.ID+".json" != names[i] {
+			continue
+		}
+		checkpoints = append(checkpoints, &cp)
+	}
+	return checkpoints, nil
+}
+
+// selectCheckpoints picks what to revert from checkpoints (newest first):
+// "all" for the whole session, "last" for the latest turn that still has
+// unreverted files, a 1-based position in the list, a checkpoint ID or a
+// turn ID.
+func selectCheckpoints(checkpoints []*checkpoint, ref string) ([]*checkpoint, error) {
+	ref = strings.TrimSpace(ref)
+	switch ref {
+	case "all":
+		return checkpoints, nil
+	case "", "last":
+		for _, cp := range checkpoints {
+			for _, change := range cp.Summary.Files {
+				if change.Resolution != "reverted" {
+					return []*checkpoint{cp}, nil
+				}
+			}
+		}
+		return nil, fmt.Errorf("%w: nothing left to revert", errCheckpointNotFound)
+	}
+	if n, err := strconv.Atoi(ref); err == nil && n >= 1 && n <= len(checkpoints) {
+		return []*checkpoint{checkpoints[n-1]}, nil
+	}
+	for _, cp := range checkpoints {
+		if cp.ID == ref || (cp.Summary.TurnID != "" && cp.Summary.TurnID == ref) {
+			return []*checkpoint{cp}, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %s", errCheckpointNotFound, ref)
+}
+
+// checkpointRevert reports what revertCheckpoints restored.
+type checkpointRevert struct {
+	Reverted []string `json:"reverted"`
+	Skipped  []string `json:"skipped,omitempty"` // Too large to restore
+}
+
+// revertCheckpoints restores the files changed by checkpoints, which must
+// be ordered newest first, to their content before those turns. Unless
+// force is set, every file is checked before any is written, and a file
+// edited after the turn that changed it fails the whole revert with
+// errChangedSinceTurn. Checkpoints are saved after each file, so a failure
+// part way keeps the files already restored marked as reverted.
+func revertCheckpoints(root string, checkpoints []*checkpoint, force bool) (checkpointRevert, error) {
+	result := checkpointRevert{Reverted: []string{}}
+	if !force {
+		// Walking newest first, a file must still hold what each turn left
+		// behind once the newer turns are undone
+		expected := make(map[string]string)
+		var changed []string
+		for _, cp := range checkpoints {
+			for i, change := range cp.Summary.Files {
+				if change.Resolution == "reverted" || i >= len(cp.Snapshots) || cp.Snapshots[i].TooLarge {
+					continue
+				}
+				snap := cp.Snapshots[i]
+				hash, seen := expected[snap.Path]
+				if !seen {
+					hash = currentHash(root, snap.Path)
+				}
+				if snap.AfterHash != "" && hash != snap.AfterHash {
+					changed = appendUnique(changed, snap.Path)
+				}
+				expected[snap.Path] = contentHash(snap.Content, snap.Existed)
+			}
+		}
+		if len(changed) > 0 {
+			return result, fmt.Errorf("%s: %w", strings.Join(changed, ", "), errChangedSinceTurn)
+		}
+	}
+	for _, cp := range checkpoints {
+		for i := range cp.Summary.Files {
+			change := &cp.Summary.Files[i]
+			if change.Resolution == "reverted" || i >= len(cp.Snapshots) {
+				continue
+			}
+			if cp.Snapshots[i].TooLarge {
+				result.Skipped = appendUnique(result.Skipped, change.Path)
+				continue
+			}
+			if err := revertSnapshot(root, cp.Snapshots[i], true); err != nil {
+				return result, fmt.Errorf("%s: %w", change.Path, err)
+			}
+			change.Resolution = "reverted"
+			result.Reverted = appendUnique(result.Reverted, change.Path)
+			if err := saveCheckpoint(root, cp); err != nil {
+				return result, fmt.Errorf("save checkpoint: %w", err)
+			}
+		}
+	}
+	if len(checkpoints) > 0 {
+		markTurnChangesReverted(root, checkpoints[0].Summary.Session, checkpoints)
+	}
+	return result, nil
+}
+
+// markTurnChangesReverted carries reverts made through checkpoints over to
+// the session's latest turn record, so /api/changes does not offer them again.
+func markTurnChangesReverted(root, session string, checkpoints []*checkpoint) {
+	latest, err := loadTurnChanges(root, session)
+	if err != nil || latest == nil {
+		return
+	}
+	for _, cp := range checkpoints {
+		if cp.Summary.TurnID != latest.Summary.TurnID {
+			continue
+		}
+		for i, change := range cp.Summary.Files {
+			if change.Resolution == "reverted" && i < len(latest.Summary.Files) && latest.Summary.Files[i].Path == change.Path {
+				latest.Summary.Files[i].Resolution = "reverted"
+			}
+		}
+		saveTurnChanges(root, *latest)
+	}
+}
+
+// markCheckpointReverted records files reverted through /api/changes on the
+// turn's checkpoint.
+func markCheckpointReverted(root, session, turnID string, paths []string) error {
+	checkpoints, err := loadCheckpoints(root, session)
+	if err != nil {
+		return err
+	}
+	for _, cp := range checkpoints {
+		if cp.Summary.TurnID != turnID {
+			continue
+		}
+		for i := range cp.Summary.Files {
+			for _, path := range paths {
+				if cp.Summary.Files[i].Path == path {
+					cp.Summary.Files[i].Resolution = "reverted"
+				}
+			}
+		}
+		return saveCheckpoint(root, cp)
+	}
+	return nil
+}
+
+// formatCheckpoints lists checkpoints for the terminal, numbered for :revert.
+func formatCheckpoints(root string, checkpoints []*checkpoint) string {
+	if len(checkpoints) == 0 {
+		return "No file changes recorded in this conversation."
+	}
+	var b strings.Builder
+	b.WriteString("File changes by turn, newest first:\n")
+	for i, cp := range checkpoints {
+		view := cp.view(root)
+		status := ""
+		if view.Reverted {
+			status = " [reverted]"
+		}
+		fmt.Fprintf(&b, "  %d. %s  %d file(s) +%d -%d%s  %s\n", i+1, cp.Summary.Time.Local().Format("2006-01-02 15:04"), len(view.Files), view.Insertions, view.Deletions, status, cp.Prompt)
+	}
+	b.WriteString("Use :revert <n>, :revert last or :revert all; add force to overwrite later edits.")
+	return b.String()
+}
+
+// revertCommand runs :revert [last|<n>|<id>|all] [force] for the CLI.
+func (a *Agent) revertCommand(args []string) {
+	root := a.workspaceRoot
+	if root == "" {
+		root = a.cfg.Load().WorkspaceRoot
+	}
+	session := a.states.CurrentKey()
+	checkpoints, err := loadCheckpoints(root, session)
+	if err != nil {
+		fmt.Printf("Revert failed: %v\n", err)
+		return
+	}
+	if len(args) == 0 {
+		fmt.Println(formatCheckpoints(root, checkpoints))
+		return
+	}
+	force := len(args) > 1 && args[1] == "force"
+	selected, err := selectCheckpoints(checkpoints, args[0])
+	if err != nil {
+		fmt.Printf("Revert failed: %v\n", err)
+		return
+	}
+	result, err := revertCheckpoints(root, selected, force)
+	if len(result.Reverted) > 0 {
+		fmt.Printf("Reverted %s\n", strings.Join(result.Reverted, ", "))
+		a.recordRevertActivity(root, session, args[0], result)
+	}
+	if len(result.Skipped) > 0 {
+		fmt.Printf("Skipped files too large to restore: %s\n", strings.Join(result.Skipped, ", "))
+	}
+	if err != nil {
+		if errors.Is(err, errChangedSinceTurn) {
+			fmt.Printf("Revert refused: %v (:revert %s force)\n", err, args[0])
+			return
+		}
+		fmt.Printf("Revert failed: %v\n", err)
+		return
+	}
+	if len(result.Reverted) == 0 && len(result.Skipped) == 0 {
+		fmt.Println("Nothing to revert: those changes were already reverted.")
+	}
+}
+
+func (a *Agent) recordRevertActivity(root, session, ref string, result checkpointRevert) {
+	summary := fmt.Sprintf("Reverted %d files", len(result.Reverted))
+	if len(result.Reverted) == 1 {
+		summary = "Reverted " + result.Reverted[0]
+	}
+	recordActivity(root, activityEntry{
+		Kind:    activityChangesResolved,
+		Session: session,
+		Summary: summary,
+		Details: map[string]any{"action": "revert", "paths": result.Reverted, "checkpoint": ref},
+	}, a.logger)
+}
+
+// handleCheckpoints lists the file changes of every turn in a session (GET,
+// query parameter session, default the current one) and reverts one turn
+// or the whole session (POST {"session", "checkpoint": "last" | "all" | id
+// or turn ID, "force"}).
+func (s *webServer) handleCheckpoints(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		s.respondError(w, r, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	workspace := s.getWorkspaceFromRequest(r)
+	if workspace == "" || !s.workspaceExists(workspace) {
+		s.respondError(w, r, http.StatusBadRequest, "select a workspace first")
+		return
+	}
+	wsCtx, err := s.agent.GetOrCreateWorkspaceContext(workspace)
+	if err != nil {
+		s.respondError(w, r, http.StatusInternalServerError, fmt.Sprintf("get workspace context: %v", err))
+		return
+	}
+	var req struct {
+		Session    string `json:"session"`
+		Checkpoint string `json:"checkpoint"`
+		Force      bool   `json:"force"`
+	}
+	req.Session = r.URL.Query().Get("session")
+	if r.Method == http.MethodPost {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			s.respondError(w, r, http.StatusBadRequest, "invalid payload")
+			return
+		}
+	}
+	if req.Session == "" {
+		req.Session = wsCtx.states.CurrentKey()
+	}
+	checkpoints, err := loadCheckpoints(wsCtx.root, req.Session)
+	if err != nil {
+		s.respondError(w, r, http.StatusInternalServerError, fmt.Sprintf("load checkpoints: %v", err))
+		return
+	}
+	list := func() map[string]any {
+		views := make([]checkpointView, 0, len(checkpoints))
+		for _, cp := range checkpoints {
+			views = append(views, cp.view(wsCtx.root))
+		}
+		return map[string]any{"session": req.Session, "checkpoints": views}
+	}
+	if r.Method == http.MethodGet {
+		s.writeJSON(w, r, list())
+		return
+	}
+
+	if strings.TrimSpace(req.Checkpoint) == "" {
+		s.respondError(w, r, http.StatusBadRequest, `checkpoint required: "last", "all" or a checkpoint or turn ID`)
+		return
+	}
+	if !s.claimWorkspace(w, r, workspace) {
+		return
+	}
+	if wsCtx.HasInFlightRequest() {
+		s.respondError(w, r, http.StatusConflict, "wait for the running turn to finish")
+		return
+	}
+	selected, err := selectCheckpoints(checkpoints, req.Checkpoint)
+	if err != nil {
+		s.respondError(w, r, http.StatusNotFound, err.Error())
+		return
+	}
+	result, err := revertCheckpoints(wsCtx.root, selected, req.Force)
+	if len(result.Reverted) > 0 {
+		s.agent.logger.Printf("[ws:%s] reverted %s (checkpoint %s)", wsCtx.root, strings.Join(result.Reverted, ", "), req.Checkpoint)
+		s.agent.recordRevertActivity(wsCtx.root, req.Session, req.Checkpoint, result)
+	}
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, errChangedSinceTurn) {
+			status = http.StatusConflict
+		}
+		s.respondError(w, r, status, err.Error())
+		return
+	}
+	response := list()
+	response["reverted"] = result.Reverted
+	if len(result.Skipped) > 0 {
+		response["skipped"] = result.Skipped
+	}
+	s.writeJSON(w, r, response)
+}
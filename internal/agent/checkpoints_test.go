@@ -0,0 +1,90 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"cando/internal/llm"
+	"cando/internal/state"
+)
+
+func TestCheckpointsRevertTurnsAndConversation(t *testing.T) {
+	t.Setenv("CANDO_CONFIG_DIR", t.TempDir())
+	workspace := t.TempDir()
+	write := func(rel, content string) {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(workspace, rel), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	read := func(rel string) string {
+		data, err := os.ReadFile(filepath.Join(workspace, rel))
+		if err != nil {
+			return "<missing>"
+		}
+		return string(data)
+	}
+	write("a.txt", "v0\n")
+
+	done := llm.ChatResponse{Choices: []llm.ChatChoice{{Message: state.Message{Role: "assistant", Content: "done"}, FinishReason: "stop"}}}
+	client := newScriptedClient(
+		callReply("write_file", `{"path":"a.txt","content":"v1\n"}`),
+		callReply("write_file", `{"path":"b.txt","content":"new\n"}`),
+		done,
+		callReply("write_file", `{"path":"a.txt","content":"v2\n"}`),
+		done,
+	)
+	agent := newTestAgent(t, client, baseTestConfig(workspace))
+	for _, prompt := range []string{"first", "second"} {
+		if err := agent.RunOneShot(context.Background(), prompt); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	session := agent.states.CurrentKey()
+	checkpoints, err := loadCheckpoints(workspace, session)
+	if err != nil || len(checkpoints) != 2 {
+		t.Fatalf("checkpoints = %d, %v", len(checkpoints), err)
+	}
+	if checkpoints[0].Prompt != "second" || len(checkpoints[1].Summary.Files) != 2 {
+		t.Fatalf("checkpoints out of order: %q, %+v", checkpoints[0].Prompt, checkpoints[1].Summary.Files)
+	}
+
+	// write_file appends, so a.txt now holds v0, v1 and v2. An edit after
+	// the turns refuses the whole revert and writes nothing.
+	write("a.txt", "mine\n")
+	all, _ := selectCheckpoints(checkpoints, "all")
+	if _, err := revertCheckpoints(workspace, all, false); !errors.Is(err, errChangedSinceTurn) {
+		t.Fatalf("revert over a later edit: %v", err)
+	}
+	if read("b.txt") != "new\n" {
+		t.Fatal("refused revert changed files")
+	}
+	write("a.txt", "v0\nv1\nv2\n")
+
+	last, err := selectCheckpoints(checkpoints, "last")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result, err := revertCheckpoints(workspace, last, false); err != nil || len(result.Reverted) != 1 || read("a.txt") != "v0\nv1\n" {
+		t.Fatalf("revert last = %+v, %v, a.txt %q", result, err, read("a.txt"))
+	}
+
+	// The conversation revert skips the turn already undone
+	checkpoints, _ = loadCheckpoints(workspace, session)
+	if !checkpoints[0].view(workspace).Reverted {
+		t.Error("reverted turn not marked")
+	}
+	if result, err := revertCheckpoints(workspace, checkpoints, false); err != nil || len(result.Reverted) != 2 {
+		t.Fatalf("revert all = %+v, %v", result, err)
+	}
+	if read("a.txt") != "v0\n" || read("b.txt") != "<missing>" {
+		t.Errorf("after revert all: a.txt %q, b.txt %q", read("a.txt"), read("b.txt"))
+	}
+	if _, err := selectCheckpoints(checkpoints, "last"); !errors.Is(err, errCheckpointNotFound) {
+		t.Errorf("nothing left to revert: %v", err)
+	}
+}
@@ -0,0 +1,33 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+
+	"cando/internal/llm"
+	"cando/internal/prompts"
+	"cando/internal/state"
+)
+
+// analyzeFileWindow runs one window of analyze_large_file on the summary
+// model, which is cheaper and leaves the main conversation untouched.
+func (a *Agent) analyzeFileWindow(ctx context.Context, prompt string) (string, error) {
+	if a.client == nil {
+		return "", fmt.Errorf("no provider configured")
+	}
+	resp, err := a.client.Chat(ctx, llm.ChatRequest{
+		Model: a.cfg.Load().SummaryModelFor(a.ActiveProviderKey()),
+		Messages: []state.Message{
+			{Role: "system", Content: prompts.ChunkAnalysis()},
+			{Role: "user", Content: prompt},
+		},
+		Temperature: 0.2,
+	})
+	if err != nil {
+		return "", err
+	}
+	if err := llm.ValidateResponse(a.ActiveProviderKey(), resp); err != nil {
+		return "", err
+	}
+	return resp.Choices[0].Message.Content, nil
+}
@@ -0,0 +1,108 @@
+package agent
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	// maxCitations caps the references checked per answer.
+	maxCitations = 50
+	// maxCitedFileBytes skips line validation for files too large to be
+	// source code worth linking.
+	maxCitedFileBytes = 8 << 20
+)
+
+// citationPattern matches path:line and path:start-end references. The path
+// needs a slash or an extension so times like 10:30 are not mistaken for one.
+var citationPattern = regexp.MustCompile(`([\w.\-/]*\w\.[A-Za-z0-9_]+|[\w.\-]+(?:/[\w.\-]+)+):(\d+)(?:-(\d+))?\b`)
+
+// citation is a file and line range the assistant referenced, checked
+// against the workspace.
+type citation struct {
+	Text  string `json:"text"` // As written in the answer, so the UI can link it in place
+	Path  string `json:"path"` // Relative to the workspace root, slash-separated
+	Start int    `json:"start"`
+	End   int    `json:"end"` // Equal to Start for single-line references
+}
+
+// extractCitations finds the path:line references in content that point at
+// existing files and lines inside root. References to missing files, lines
+// past the end of a file or paths outside the workspace, also through a
+// symlink unless allowExternal is set, are dropped.
+func extractCitations(root, content string, allowExternal bool) []citation {
+	if root == "" || content == "" {
+		return nil
+	}
+	var citations []citation
+	seen := make(map[string]bool)
+	lineCounts := make(map[string]int)
+	for _, match := range citationPattern.FindAllStringSubmatch(content, -1) {
+		if len(citations) == maxCitations {
+			break
+		}
+		text := match[0]
+		if seen[text] {
+			continue
+		}
+		seen[text] = true
+
+		start, err := strconv.Atoi(match[2])
+		if err != nil || start < 1 {
+			continue
+		}
+		end := start
+		if match[3] != "" {
+			if end, err = strconv.Atoi(match[3]); err != nil || end < start {
+				continue
+			}
+		}
+		rel, err := workspaceRelPath(root, strings.TrimPrefix(match[1], "./"), allowExternal)
+		if err != nil || rel == "." {
+			continue
+		}
+		lines, ok := lineCounts[rel]
+		if !ok {
+			lines = citedFileLines(root, rel)
+			lineCounts[rel] = lines
+		}
+		if start > lines {
+			continue
+		}
+		citations = append(citations, citation{Text: text, Path: rel, Start: start, End: min(end, lines)})
+	}
+	return citations
+}
+
+// citedFileLines returns the number of lines in the workspace file rel, or
+// 0 when it is missing, not a regular file, too large or resolves outside
+// the workspace through a symlink.
+func citedFileLines(root, rel string) int {
+	full := filepath.Join(root, filepath.FromSlash(rel))
+	resolved, err := filepath.EvalSymlinks(full)
+	if err != nil {
+		return 0
+	}
+	if resolvedRoot, err := filepath.EvalSymlinks(root); err == nil {
+		if _, err := lexicalRelPath(resolvedRoot, resolved); err != nil {
+			return 0
+		}
+	}
+	info, err := os.Stat(resolved)
+	if err != nil || !info.Mode().IsRegular() || info.Size() > maxCitedFileBytes {
+		return 0
+	}
+	data, err := os.ReadFile(resolved)
+	if err != nil || len(data) == 0 {
+		return 0
+	}
+	lines := bytes.Count(data, []byte{'\n'})
+	if data[len(data)-1] != '\n' {
+		lines++
+	}
+	return lines
+}
@@ -0,0 +1,36 @@
+package agent
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestExtractCitations(t *testing.T) {
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "pkg"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "pkg", "util.go"), []byte("package pkg\n\nfunc A() {}\n\nfunc B() {}\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "main.go"), []byte("package main"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	content := "See `pkg/util.go:3` and `pkg/util.go:3-9`, also ./main.go:1. " +
+		"Ignore missing.go:4, main.go:2, ../outside.go:1, pkg/util.go:3 (repeat) and the 10:30 meeting."
+	got := extractCitations(root, content, false)
+	want := []citation{
+		{Text: "pkg/util.go:3", Path: "pkg/util.go", Start: 3, End: 3},
+		{Text: "pkg/util.go:3-9", Path: "pkg/util.go", Start: 3, End: 5},
+		{Text: "./main.go:1", Path: "main.go", Start: 1, End: 1},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("citations = %+v, want %+v", got, want)
+	}
+	if got := extractCitations("", content, false); got != nil {
+		t.Fatalf("expected no citations without a workspace, got %+v", got)
+	}
+}
@@ -0,0 +1,145 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"slices"
+	"time"
+
+	"cando/internal/config"
+	"cando/internal/contextprofile"
+)
+
+// configPollInterval is how often the config file is checked for changes.
+// Polling keeps the watcher portable and dependency-free; edits show up
+// within a couple of seconds.
+const configPollInterval = 2 * time.Second
+
+// providerConfigFields are the reloadable fields baked into provider
+// clients, which are rebuilt when any of them changes.
+var providerConfigFields = []string{
+	"model", "summary_model", "vl_model", "provider_models", "provider_summary_models",
+	"provider_vl_models", "temperature", "request_timeout_seconds", "thinking_enabled",
+	"force_thinking", "openrouter_free_mode", "retry_policies",
+}
+
+// configChange describes a reload for the config_changed event.
+type configChange struct {
+	Path            string   `json:"path"`
+	Changed         []string `json:"changed"`
+	RestartRequired []string `json:"restart_required,omitempty"`
+}
+
+// reloadProfiles pushes the current config into every context profile.
+func (a *Agent) reloadProfiles() error {
+	return a.reloadProfilesWith(a.cfg.Load())
+}
+
+func (a *Agent) reloadProfilesWith(cfg config.Config) error {
+	a.workspacesMu.RLock()
+	for _, wsCtx := range a.workspaceContexts {
+		if reloadable, ok := wsCtx.profile.(contextprofile.ConfigReloadable); ok {
+			if err := reloadable.ReloadConfig(cfg); err != nil {
+				a.workspacesMu.RUnlock()
+				return fmt.Errorf("reload workspace profile: %w", err)
+			}
+		}
+	}
+	a.workspacesMu.RUnlock()
+
+	// Also reload the default profile used in CLI mode
+	if reloadable, ok := a.profile.(contextprofile.ConfigReloadable); ok {
+		if err := reloadable.ReloadConfig(cfg); err != nil {
+			return fmt.Errorf("reload profile: %w", err)
+		}
+	}
+	return nil
+}
+
+// hotReloadConfig loads path and applies its hot-reloadable fields to the
+// running agent. Fields that need a restart are reported but left alone.
+func (a *Agent) hotReloadConfig(path string) (configChange, error) {
+	next, err := config.Load(path)
+	if err != nil {
+		return configChange{}, err
+	}
+	var changed, restart []string
+	a.cfg.Update(func(c *config.Config) { changed, restart = c.ApplyReloadable(next) })
+	change := configChange{Path: path, Changed: changed, RestartRequired: restart}
+	if len(changed) == 0 {
+		return change, nil
+	}
+	if err := a.reloadProfiles(); err != nil {
+		return change, err
+	}
+	if slices.ContainsFunc(changed, func(field string) bool { return slices.Contains(providerConfigFields, field) }) {
+		if err := a.ReloadProviders(); err != nil {
+			return change, fmt.Errorf("reload providers: %w", err)
+		}
+	}
+	return change, nil
+}
+
+// followConfig keeps context profiles in step with every config update,
+// including ones made through handlers that do not reload profiles
+// themselves (model and thinking toggles).
+func (a *Agent) followConfig(ctx context.Context) {
+	updates, stop := a.cfg.Subscribe()
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+	go func() {
+		for cfg := range updates {
+			if err := a.reloadProfilesWith(cfg); err != nil {
+				a.logger.Printf("[config] %v", err)
+			}
+		}
+	}()
+}
+
+// startConfigWatcher polls the user config file and hot-reloads it when it
+// changes, broadcasting config_changed to connected UIs. Invalid edits are
+// logged and skipped, so the running config stays in effect.
+func (s *webServer) startConfigWatcher(ctx context.Context) {
+	path := config.UserConfigPath()
+	stamp := func() (time.Time, int64) {
+		info, err := os.Stat(path)
+		if err != nil {
+			return time.Time{}, -1
+		}
+		return info.ModTime(), info.Size()
+	}
+	go func() {
+		lastMod, lastSize := stamp()
+		var lastRestart []string
+		ticker := time.NewTicker(configPollInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			mod, size := stamp()
+			if size < 0 || (mod.Equal(lastMod) && size == lastSize) {
+				continue
+			}
+			lastMod, lastSize = mod, size
+
+			change, err := s.agent.hotReloadConfig(path)
+			if err != nil {
+				s.logger.Printf("[config] reload of %s failed: %v", path, err)
+				continue
+			}
+			// Saves made through the UI reload to the same values
+			if len(change.Changed) == 0 && slices.Equal(change.RestartRequired, lastRestart) {
+				continue
+			}
+			lastRestart = change.RestartRequired
+			s.logger.Printf("[config] reloaded %s: changed %v, restart required for %v", path, change.Changed, change.RestartRequired)
+			s.events.publish("config_changed", change)
+		}
+	}()
+}
@@ -0,0 +1,256 @@
+package agent
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"cando/internal/prompts"
+	"cando/internal/state"
+)
+
+// Demo mode serves Cando read-only for presentations and shared instances:
+// a sample project and session in a temporary directory, no mutating
+// requests or tools, and real paths masked in every API response.
+
+//go:embed demo
+var demoFiles embed.FS
+
+const (
+	DemoSession = "demo"           // Key of the bundled sample session
+	demoProject = "sample-project" // Directory of the sample project
+	demoMask    = "~/cando-demo"   // How the demo directory appears in responses
+)
+
+// demoReadPaths are what a demo serves: the UI itself and the read
+// endpoints that stay within the sample project and its throwaway config
+// directory. A path ending in / covers everything below it. Anything not
+// listed, including endpoints added later, is refused until it is vetted
+// here; the host shell, file browser, logs, editor bridge and updates
+// stay out, and so does the WebSocket transport, which takes prompts over
+// a GET upgrade.
+var demoReadPaths = map[string]bool{
+	"/":                         true,
+	"/sessions":                 true,
+	"/app.css":                  true,
+	"/app.js":                   true,
+	"/alpine.js":                true,
+	"/lucide.js":                true,
+	"/bell.wav":                 true,
+	"/openrouter-models.json":   true,
+	"/openai-models.json":       true,
+	"/ollama-models.json":       true,
+	"/api/session":              true,
+	"/api/session/lock":         true,
+	"/api/session/export":       true,
+	"/api/session/budget":       true,
+	"/api/stream":               true,
+	"/api/events":               true,
+	"/api/state":                true,
+	"/api/turns":                true,
+	"/api/turns/":               true,
+	"/api/overview":             true,
+	"/api/changes":              true,
+	"/api/checkpoints":          true,
+	"/api/activity":             true,
+	"/api/feedback":             true,
+	"/api/tasks":                true,
+	"/api/usage":                true,
+	"/api/processes":            true,
+	"/api/processes/logs":       true,
+	"/api/thinking":             true,
+	"/api/system-prompt":        true,
+	"/api/prompt-queue":         true,
+	"/api/compaction-history":   true,
+	"/api/credentials":          true,
+	"/api/config":               true,
+	"/api/workspaces":           true,
+	"/api/workspaces/active":    true,
+	"/api/project/instructions": true,
+	"/api/plan-mode":            true,
+	"/api/files":                true,
+	"/api/files/tree":           true,
+	"/api/files/read":           true,
+	"/api/files/download":       true,
+	"/api/preview":              true,
+	"/api/preview/":             true,
+	"/api/preview-enabled":      true,
+	"/api/actions":              true,
+	"/api/notifications":        true,
+	"/api/digest":               true,
+	"/api/models/metadata":      true,
+	"/api/search/global":        true,
+	"/api/health":               true,
+	"/api/csrf":                 true,
+}
+
+// PrepareDemo copies the sample project into dir, stores the sample session
+// with it and makes it the current workspace. CANDO_CONFIG_DIR must already
+// point inside dir so the user's own workspaces and sessions stay untouched.
+// It returns the project's path.
+func PrepareDemo(dir string) (string, error) {
+	project := filepath.Join(dir, demoProject)
+	err := fs.WalkDir(demoFiles, "demo/workspace", func(name string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(project, filepath.FromSlash(strings.TrimPrefix(name, "demo/workspace")))
+		if entry.IsDir() {
+			return os.MkdirAll(target, 0o755)
+		}
+		data, err := demoFiles.ReadFile(name)
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(target, data, 0o644)
+	})
+	if err != nil {
+		return "", fmt.Errorf("copy sample project: %w", err)
+	}
+
+	wsMgr, err := NewWorkspaceManager()
+	if err != nil {
+		return "", err
+	}
+	if _, err := wsMgr.Add(project); err != nil {
+		return "", err
+	}
+	if err := wsMgr.SetCurrent(project); err != nil {
+		return "", err
+	}
+
+	storageRoot, err := ProjectStorageRoot(project)
+	if err != nil {
+		return "", err
+	}
+	states, err := state.NewManager(prompts.Combine(""), filepath.Join(storageRoot, "conversations"), nil)
+	if err != nil {
+		return "", err
+	}
+	data, err := demoFiles.ReadFile(path.Join("demo", "session.json"))
+	if err != nil {
+		return "", err
+	}
+	var messages []state.Message
+	if err := json.Unmarshal(data, &messages); err != nil {
+		return "", fmt.Errorf("parse sample session: %w", err)
+	}
+	conv, err := states.EnsureState(DemoSession)
+	if err != nil {
+		return "", err
+	}
+	for _, msg := range messages {
+		conv.Append(msg)
+	}
+	if err := states.Save(conv); err != nil {
+		return "", err
+	}
+	return project, nil
+}
+
+// demoAllowed reports whether a demo serves the request: reads only, and
+// only of the paths in demoReadPaths.
+func demoAllowed(r *http.Request) bool {
+	if isMutating(r.Method) {
+		return false
+	}
+	name := path.Clean("/" + r.URL.Path)
+	if demoReadPaths[name] {
+		return true
+	}
+	for dir := path.Dir(name); dir != "/"; dir = path.Dir(dir) {
+		if demoReadPaths[dir+"/"] {
+			return true
+		}
+	}
+	return false
+}
+
+// demoReplacer masks the demo directory and the home directory, both as
+// written and as JSON-escaped.
+func demoReplacer(demoDir string) *strings.Replacer {
+	var pairs []string
+	add := func(real, masked string) {
+		if real == "" || real == string(filepath.Separator) {
+			return
+		}
+		pairs = append(pairs, real, masked)
+		quoted, _ := json.Marshal(real)
+		maskedQuoted, _ := json.Marshal(masked)
+		if escaped := string(quoted[1 : len(quoted)-1]); escaped != real {
+			pairs = append(pairs, escaped, string(maskedQuoted[1:len(maskedQuoted)-1]))
+		}
+	}
+	add(demoDir, demoMask)
+	if home, err := os.UserHomeDir(); err == nil {
+		add(home, "~")
+	}
+	return strings.NewReplacer(pairs...)
+}
+
+// unmaskDemoPath turns a masked workspace path sent back by the UI into the
+// real one.
+func (s *webServer) unmaskDemoPath(workspace string) string {
+	if s.agent == nil || s.agent.demoDir == "" {
+		return workspace
+	}
+	if rest, ok := strings.CutPrefix(workspace, demoMask); ok {
+		return s.agent.demoDir + rest
+	}
+	return workspace
+}
+
+// demoGuard rejects what a demo does not serve and masks paths in API
+// responses. Outside demo mode it returns next unchanged.
+func (s *webServer) demoGuard(next http.Handler) http.Handler {
+	if s.agent.demoDir == "" {
+		return next
+	}
+	replacer := demoReplacer(s.agent.demoDir)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !demoAllowed(r) {
+			s.respondError(w, r, http.StatusForbidden, "this is a read-only demo")
+			return
+		}
+		if strings.HasPrefix(r.URL.Path, "/api/") {
+			w = &demoMaskWriter{ResponseWriter: w, replacer: replacer}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// demoMaskWriter masks paths in each write. Callers write whole JSON
+// documents or SSE events, so a path is never split across writes.
+type demoMaskWriter struct {
+	http.ResponseWriter
+	replacer *strings.Replacer
+}
+
+func (w *demoMaskWriter) WriteHeader(status int) {
+	w.Header().Del("Content-Length") // Masking changes the length
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *demoMaskWriter) Write(p []byte) (int, error) {
+	w.Header().Del("Content-Length")
+	if _, err := w.ResponseWriter.Write([]byte(w.replacer.Replace(string(p)))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (w *demoMaskWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *demoMaskWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,18 @@
+import unittest
+
+import todo
+
+
+class CompleteTest(unittest.TestCase):
+    def test_marks_item_done(self):
+        items = []
+        todo.add(items, "Water the plants")
+        self.assertTrue(todo.complete(items, 1)["done"])
+
+    def test_unknown_id(self):
+        with self.assertRaises(KeyError):
+            todo.complete([], 7)
+
+
+if __name__ == "__main__":
+    unittest.main()
@@ -0,0 +1,55 @@
+"""A tiny command-line todo list stored in todo.json."""
+
+import json
+import sys
+from pathlib import Path
+
+STORE = Path("todo.json")
+
+
+def load():
+    if not STORE.exists():
+        return []
+    return json.loads(STORE.read_text())
+
+
+def save(items):
+    STORE.write_text(json.dumps(items, indent=2))
+
+
+def add(items, title):
+    items.append({"id": len(items) + 1, "title": title, "done": False})
+    return items[-1]
+
+
+def complete(items, item_id):
+    for item in items:
+        if item["id"] == item_id:
+            item["done"] = True
+            return item
+    raise KeyError(f"no todo with id {item_id}")
+
+
+def main(argv):
+    items = load()
+    command = argv[1] if len(argv) > 1 else "list"
+    if command == "add":
+        print("added", add(items, " ".join(argv[2:]))["id"])
+    elif command == "done":
+        try:
+            complete(items, int(argv[2]))
+        except (IndexError, ValueError):
+            print("usage: todo.py done <id>")
+            return 2
+        except KeyError as err:
+            print(err.args[0])
+            return 1
+    else:
+        for item in items:
+            print(f"[{'x' if item['done'] else ' '}] {item['id']}. {item['title']}")
+    save(items)
+    return 0
+
+
+if __name__ == "__main__":
+    sys.exit(main(sys.argv))
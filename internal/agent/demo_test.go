@@ -0,0 +1,93 @@
+package agent
+
+import (
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"cando/internal/state"
+)
+
+func TestPrepareDemo(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("CANDO_CONFIG_DIR", filepath.Join(dir, "config"))
+	project, err := PrepareDemo(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(project, "todo.py")); err != nil {
+		t.Errorf("sample project not copied: %v", err)
+	}
+	wsMgr, err := NewWorkspaceManager()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if current := wsMgr.Current(); current == nil || current.Path != project {
+		t.Errorf("current workspace = %+v, want %s", current, project)
+	}
+
+	storageRoot, _ := ProjectStorageRoot(project)
+	states, err := state.NewManager("", filepath.Join(storageRoot, "conversations"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conv, ok := states.Get(DemoSession)
+	if !ok {
+		t.Fatalf("sample session missing; have %v", states.ListKeys())
+	}
+	messages := conv.Messages()
+	if last := messages[len(messages)-1]; last.Role != "assistant" || !strings.Contains(last.Content, "Both tests pass") {
+		t.Errorf("last message = %+v", last)
+	}
+}
+
+func TestDemoGuard(t *testing.T) {
+	demoDir := filepath.Join(t.TempDir(), "cando-demo-1")
+	s := &webServer{agent: &Agent{demoDir: demoDir}, logger: log.New(io.Discard, "", 0)}
+	handler := s.demoGuard(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.writeJSON(w, r, map[string]string{"workspace": s.getWorkspaceFromRequest(r)})
+	}))
+
+	for _, tc := range []struct {
+		method, path string
+		want         int
+	}{
+		{http.MethodGet, "/api/session", http.StatusOK},
+		{http.MethodPost, "/api/prompt", http.StatusForbidden},
+		{http.MethodDelete, "/api/feedback", http.StatusForbidden},
+		{http.MethodGet, "/api/ws", http.StatusForbidden},
+		{http.MethodGet, "/api/terminal", http.StatusForbidden},
+		{http.MethodGet, "/api/browse", http.StatusForbidden},
+		{http.MethodGet, "/api/turns/t1/graph", http.StatusOK},
+		{http.MethodGet, "/app.js", http.StatusOK},
+		{http.MethodGet, "/api/update-check", http.StatusForbidden},
+		{http.MethodGet, "/api/editor/commands", http.StatusForbidden},
+		{http.MethodGet, "/api/diagnostics/bundle", http.StatusForbidden},
+		{http.MethodGet, "/api/unvetted-endpoint", http.StatusForbidden},
+		{http.MethodGet, "/api/turns/../terminal", http.StatusForbidden},
+	} {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(tc.method, tc.path, nil))
+		if rec.Code != tc.want {
+			t.Errorf("%s %s = %d, want %d", tc.method, tc.path, rec.Code, tc.want)
+		}
+	}
+
+	// The masked path the UI sends back reaches handlers unmasked and is
+	// masked again on the way out
+	req := httptest.NewRequest(http.MethodGet, "/api/session", nil)
+	req.Header.Set("X-Workspace", demoMask+"/sample-project")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if body := rec.Body.String(); strings.Contains(body, demoDir) || !strings.Contains(body, demoMask+"/sample-project") {
+		t.Errorf("body = %s", body)
+	}
+	if got := s.unmaskDemoPath(demoMask + "/sample-project"); got != demoDir+"/sample-project" {
+		t.Errorf("unmasked = %q", got)
+	}
+}
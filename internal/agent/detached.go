@@ -0,0 +1,389 @@
+package agent
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	detachedTurnsDir  = "turns" // Under the workspace storage root
+	detachedTurnsList = 50      // Records returned by GET /api/turns
+)
+
+// Detached turn states.
+const (
+	turnRunning     = "running"
+	turnDone        = "done"
+	turnFailed      = "failed"
+	turnInterrupted = "interrupted" // Server stopped before the turn ended
+)
+
+// turnRecord describes a detached turn. It is stored next to the turn's
+// event log so results survive the request and the server process.
+type turnRecord struct {
+	ID         string    `json:"id"`
+	Workspace  string    `json:"workspace"`
+	Session    string    `json:"session"`
+	Prompt     string    `json:"prompt"`
+	Status     string    `json:"status"`
+	Error      string    `json:"error,omitempty"`
+	Events     int       `json:"events"`
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at,omitempty"`
+	Seen       bool      `json:"seen"` // Result shown in the UI
+}
+
+// turnJournal persists a detached turn's record and events.
+type turnJournal struct {
+	mu     sync.Mutex
+	dir    string
+	record turnRecord
+	events *os.File
+}
+
+func detachedTurnsPath(workspaceRoot string) (string, error) {
+	storageRoot, err := ProjectStorageRoot(workspaceRoot)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(storageRoot, detachedTurnsDir), nil
+}
+
+func openTurnJournal(record turnRecord) (*turnJournal, error) {
+	dir, err := detachedTurnsPath(record.Workspace)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(filepath.Join(dir, record.ID+".events.jsonl"), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	j := &turnJournal{dir: dir, record: record, events: f}
+	if err := j.save(); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return j, nil
+}
+
+// event appends one event envelope to the log.
+func (j *turnJournal) event(payload []byte) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if _, err := j.events.Write(append(payload, '\n')); err == nil {
+		j.record.Events++
+	}
+}
+
+// close records the outcome and closes the event log.
+func (j *turnJournal) close(turnErr error) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.record.Status = turnDone
+	if turnErr != nil {
+		j.record.Status = turnFailed
+		j.record.Error = turnErr.Error()
+	}
+	j.record.FinishedAt = time.Now().UTC()
+	j.events.Close()
+	return j.save()
+}
+
+func (j *turnJournal) save() error {
+	return writeTurnRecord(j.dir, j.record)
+}
+
+func writeTurnRecord(dir string, record turnRecord) error {
+	data, err := json.MarshalIndent(record, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := filepath.Join(dir, record.ID+".json.tmp")
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(dir, record.ID+".json"))
+}
+
+// loadTurnRecords returns the workspace's detached turns, newest first.
+// Records left running by an earlier process are reported as interrupted.
+func loadTurnRecords(workspaceRoot string, live func(id string) bool) ([]turnRecord, error) {
+	dir, err := detachedTurnsPath(workspaceRoot)
+	if err != nil {
+		return nil, err
+	}
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	records := make([]turnRecord, 0, len(paths))
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		var record turnRecord
+		if json.Unmarshal(data, &record) != nil {
+			continue
+		}
+		if record.Status == turnRunning && !live(record.ID) {
+			record.Status = turnInterrupted
+		}
+		records = append(records, record)
+	}
+	sort.Slice(records, func(i, k int) bool { return records[i].StartedAt.After(records[k].StartedAt) })
+	return records, nil
+}
+
+// readTurnEvents returns the persisted event envelopes of a detached turn.
+func readTurnEvents(workspaceRoot, id string) ([]json.RawMessage, error) {
+	dir, err := detachedTurnsPath(workspaceRoot)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(filepath.Join(dir, id+".events.jsonl"))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var events []json.RawMessage
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 4*1024*1024)
+	for scanner.Scan() {
+		events = append(events, json.RawMessage(append([]byte(nil), scanner.Bytes()...)))
+	}
+	return events, scanner.Err()
+}
+
+// validTurnID guards record paths built from request parameters.
+func validTurnID(id string) bool {
+	return strings.HasPrefix(id, "turn-") && !strings.ContainsAny(id, `/\.`)
+}
+
+// startDetachedTurn runs a prompt in the background, independent of any
+// client connection, persisting its events for later pickup.
+func (s *webServer) startDetachedTurn(r *http.Request, wsCtx *WorkspaceContext, content, session, key string) (string, error) {
+	return s.runDetachedTurn(r, wsCtx, content, session, func(_ string, turnErr error) {
+		s.submissions.finish(wsCtx.root, session, key, turnErr)
+	})
+}
+
+// runDetachedTurn starts a detached turn and calls done with its outcome
+// once the turn has ended and its journal and stream are closed.
+func (s *webServer) runDetachedTurn(r *http.Request, wsCtx *WorkspaceContext, content, session string, done func(turnID string, turnErr error)) (string, error) {
+	turnID := newTurnID()
+	journal, err := openTurnJournal(turnRecord{
+		ID:        turnID,
+		Workspace: wsCtx.root,
+		Session:   session,
+		Prompt:    content,
+		Status:    turnRunning,
+		StartedAt: time.Now().UTC(),
+	})
+	if err != nil {
+		return "", fmt.Errorf("open turn journal: %w", err)
+	}
+	stream := s.streams.start(turnID, wsCtx.root)
+	sendEvent := func(eventType string, data any) error {
+		payload, err := json.Marshal(map[string]any{"type": eventType, "data": data, "turn_id": turnID})
+		if err != nil {
+			return err
+		}
+		stream.append(payload)
+		journal.event(payload)
+		return nil
+	}
+	// The request ends as soon as we reply; keep a copy for error logging
+	detachedReq := r.Clone(context.Background())
+	go func() {
+		sendEvent("turn_started", map[string]any{"turn_id": turnID, "session": session, "detached": true})
+		turnErr := s.executeTurn(context.Background(), detachedReq, wsCtx, content, turnID, sendEvent)
+		if err := journal.close(turnErr); err != nil {
+			s.logger.Printf("[ws:%s] save detached turn %s: %v", wsCtx.root, turnID, err)
+		}
+		stream.finish()
+		done(turnID, turnErr)
+		s.advancePrompts(wsCtx)
+	}()
+	return turnID, nil
+}
+
+// unseenTurns returns finished detached turns the UI has not shown yet.
+func (s *webServer) unseenTurns(workspaceRoot string) []turnRecord {
+	records, err := loadTurnRecords(workspaceRoot, s.turnIsLive)
+	if err != nil {
+		return nil
+	}
+	var unseen []turnRecord
+	for _, record := range records {
+		if record.Status != turnRunning && !record.Seen {
+			unseen = append(unseen, record)
+		}
+	}
+	return unseen
+}
+
+func (s *webServer) turnIsLive(id string) bool {
+	if s.streams == nil {
+		return false
+	}
+	stream, ok := s.streams.get(id)
+	return ok && !stream.isDone()
+}
+
+// handleTurns starts detached turns (POST) and lists them or returns one
+// with its events (GET ?id=).
+func (s *webServer) handleTurns(w http.ResponseWriter, r *http.Request) {
+	workspace := s.getWorkspaceFromRequest(r)
+	if workspace == "" || !s.workspaceExists(workspace) {
+		s.respondError(w, r, http.StatusBadRequest, "select a workspace first")
+		return
+	}
+	wsCtx, err := s.agent.GetOrCreateWorkspaceContext(workspace)
+	if err != nil {
+		s.respondError(w, r, http.StatusInternalServerError, fmt.Sprintf("get workspace context: %v", err))
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		if id := r.URL.Query().Get("id"); id != "" {
+			s.writeTurn(w, r, wsCtx.root, id)
+			return
+		}
+		records, err := loadTurnRecords(wsCtx.root, s.turnIsLive)
+		if err != nil {
+			s.respondError(w, r, http.StatusInternalServerError, fmt.Sprintf("list turns: %v", err))
+			return
+		}
+		if len(records) > detachedTurnsList {
+			records = records[:detachedTurnsList]
+		}
+		s.writeJSON(w, r, map[string]any{"turns": records})
+	case http.MethodPost:
+		var req struct {
+			Content        string `json:"content"`
+			IdempotencyKey string `json:"idempotency_key,omitempty"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			s.respondError(w, r, http.StatusBadRequest, "invalid payload")
+			return
+		}
+		content := strings.TrimSpace(req.Content)
+		if content == "" {
+			s.respondError(w, r, http.StatusBadRequest, "content is required")
+			return
+		}
+		if wsCtx.HasInFlightRequest() {
+			s.respondError(w, r, http.StatusConflict, "another request is already running")
+			return
+		}
+		if !s.claimWorkspace(w, r, workspace) {
+			return
+		}
+		key := idempotencyKey(r, req.IdempotencyKey)
+		session := wsCtx.states.Current().Key()
+		if status, ok := s.submissions.begin(wsCtx.root, session, key); !ok {
+			s.respondError(w, r, http.StatusConflict, fmt.Sprintf("this prompt was already submitted (%s)", status))
+			return
+		}
+		turnID, err := s.startDetachedTurn(r, wsCtx, content, session, key)
+		if err != nil {
+			s.submissions.finish(wsCtx.root, session, key, err)
+			s.respondError(w, r, http.StatusInternalServerError, err.Error())
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(map[string]string{"turn_id": turnID, "status": turnRunning})
+	default:
+		s.respondError(w, r, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+func (s *webServer) writeTurn(w http.ResponseWriter, r *http.Request, workspaceRoot, id string) {
+	if !validTurnID(id) {
+		s.respondError(w, r, http.StatusBadRequest, "invalid turn id")
+		return
+	}
+	records, err := loadTurnRecords(workspaceRoot, s.turnIsLive)
+	if err != nil {
+		s.respondError(w, r, http.StatusInternalServerError, fmt.Sprintf("load turn: %v", err))
+		return
+	}
+	for _, record := range records {
+		if record.ID != id {
+			continue
+		}
+		events, err := readTurnEvents(workspaceRoot, id)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			s.respondError(w, r, http.StatusInternalServerError, fmt.Sprintf("read turn events: %v", err))
+			return
+		}
+		s.writeJSON(w, r, map[string]any{"turn": record, "events": events})
+		return
+	}
+	s.respondError(w, r, http.StatusNotFound, "turn not found")
+}
+
+// handleTurnsSeen marks finished detached turns as shown so they are not
+// announced again on the next load.
+func (s *webServer) handleTurnsSeen(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		s.respondError(w, r, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	var req struct {
+		IDs []string `json:"ids"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.respondError(w, r, http.StatusBadRequest, "invalid payload")
+		return
+	}
+	workspace := s.getWorkspaceFromRequest(r)
+	if workspace == "" || !s.workspaceExists(workspace) {
+		s.respondError(w, r, http.StatusBadRequest, "select a workspace first")
+		return
+	}
+	wsCtx, err := s.agent.GetOrCreateWorkspaceContext(workspace)
+	if err != nil {
+		s.respondError(w, r, http.StatusInternalServerError, fmt.Sprintf("get workspace context: %v", err))
+		return
+	}
+	dir, err := detachedTurnsPath(wsCtx.root)
+	if err != nil {
+		s.respondError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	wanted := make(map[string]bool, len(req.IDs))
+	for _, id := range req.IDs {
+		wanted[id] = true
+	}
+	records, _ := loadTurnRecords(wsCtx.root, s.turnIsLive)
+	marked := 0
+	for _, record := range records {
+		if !wanted[record.ID] || record.Seen || record.Status == turnRunning {
+			continue
+		}
+		record.Seen = true
+		if err := writeTurnRecord(dir, record); err != nil {
+			s.respondError(w, r, http.StatusInternalServerError, fmt.Sprintf("update turn: %v", err))
+			return
+		}
+		marked++
+	}
+	s.writeJSON(w, r, map[string]int{"marked": marked})
+}
@@ -0,0 +1,37 @@
+package agent
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestTurnJournalPersistsRecordAndEvents(t *testing.T) {
+	t.Setenv("CANDO_CONFIG_DIR", t.TempDir())
+	workspace := t.TempDir()
+
+	journal, err := openTurnJournal(turnRecord{ID: "turn-1-0001", Workspace: workspace, Status: turnRunning, StartedAt: time.Now()})
+	if err != nil {
+		t.Fatalf("open journal: %v", err)
+	}
+	journal.event([]byte(`{"type":"turn_started"}`))
+	journal.event([]byte(`{"type":"complete"}`))
+
+	// Not live and not closed: an earlier process died mid-turn
+	records, err := loadTurnRecords(workspace, func(string) bool { return false })
+	if err != nil || len(records) != 1 || records[0].Status != turnInterrupted {
+		t.Fatalf("expected interrupted record, got %+v (%v)", records, err)
+	}
+
+	if err := journal.close(errors.New("provider down")); err != nil {
+		t.Fatalf("close journal: %v", err)
+	}
+	records, _ = loadTurnRecords(workspace, func(string) bool { return false })
+	if records[0].Status != turnFailed || records[0].Error != "provider down" || records[0].Events != 2 {
+		t.Fatalf("unexpected record after close: %+v", records[0])
+	}
+	events, err := readTurnEvents(workspace, "turn-1-0001")
+	if err != nil || len(events) != 2 || string(events[1]) != `{"type":"complete"}` {
+		t.Fatalf("unexpected events: %q (%v)", events, err)
+	}
+}
@@ -0,0 +1,359 @@
+package agent
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"cando/internal/config"
+	"cando/internal/credentials"
+	"cando/internal/llm"
+	"cando/internal/safefile"
+	"cando/internal/timefmt"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// providerErrorsFile keeps recent provider failures under the config
+	// directory, so bundles made without a running server still have them.
+	providerErrorsFile = "provider-errors.jsonl"
+	// providerErrorsKeep is how many records survive when the file is trimmed.
+	providerErrorsKeep = 100
+	// DefaultDiagnosticsErrors is how many provider errors a bundle includes
+	// unless told otherwise.
+	DefaultDiagnosticsErrors = 20
+	// diagnosticsLogTail is how much of the end of each log a bundle keeps.
+	diagnosticsLogTail = 2 << 20
+)
+
+// diagnosticsLogs are the logs under the config directory added to bundles.
+var diagnosticsLogs = []string{"cando.log", "daemon.log"}
+
+// secretKeyPattern matches config keys whose values are secrets.
+var secretKeyPattern = regexp.MustCompile(`(?i)(password|secret|token|api_?key|credentials?)$`)
+
+// secretValuePattern matches well-known API key and token formats in free
+// text such as logs.
+var secretValuePattern = regexp.MustCompile(`\b(sk-[A-Za-z0-9_\-]{8,}|xox[abpr]-[A-Za-z0-9\-]{8,}|xapp-[A-Za-z0-9\-]{8,})|(?i:bearer)\s+[A-Za-z0-9._~+/\-]{8,}=*`)
+
+const redacted = "[redacted]"
+
+// providerErrorRecord is one failed provider call.
+type providerErrorRecord struct {
+	Time      time.Time `json:"time"`
+	Provider  string    `json:"provider"`
+	Model     string    `json:"model,omitempty"`
+	Type      string    `json:"type,omitempty"`
+	Code      string    `json:"code,omitempty"`
+	Message   string    `json:"message"`
+	Retryable bool      `json:"retryable"`
+}
+
+var providerErrorsMu sync.Mutex
+
+// recordProviderError appends a failed provider call to provider-errors.jsonl,
+// trimming the file to the newest records once it doubles in size.
+func (a *Agent) recordProviderError(err error, model string) {
+	record := providerErrorRecord{Time: time.Now(), Provider: a.ActiveProviderKey(), Model: model, Message: err.Error()}
+	if pe, ok := llm.IsProviderError(err); ok {
+		record.Provider = pe.Provider
+		record.Type, record.Code, record.Message, record.Retryable = string(pe.Type), pe.Code, pe.Message, pe.Retryable
+	}
+	line, marshalErr := json.Marshal(record)
+	if marshalErr != nil {
+		return
+	}
+
+	providerErrorsMu.Lock()
+	defer providerErrorsMu.Unlock()
+	path := filepath.Join(config.GetConfigDir(), providerErrorsFile)
+	records := readProviderErrorLines(path)
+	records = append(records, string(line))
+	if len(records) <= 2*providerErrorsKeep {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+		if err != nil {
+			a.logger.Printf("[diagnostics] record provider error: %v", err)
+			return
+		}
+		defer f.Close()
+		_, _ = f.Write(append(line, '\n'))
+		return
+	}
+	records = records[len(records)-providerErrorsKeep:]
+	if err := safefile.Write(path, []byte(strings.Join(records, "\n")+"\n"), 0o600); err != nil {
+		a.logger.Printf("[diagnostics] trim provider errors: %v", err)
+	}
+}
+
+func readProviderErrorLines(path string) []string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	var lines []string
+	for _, line := range strings.Split(string(data), "\n") {
+		if strings.TrimSpace(line) != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+// recentProviderErrors returns up to n of the newest provider errors.
+func recentProviderErrors(n int) []providerErrorRecord {
+	providerErrorsMu.Lock()
+	lines := readProviderErrorLines(filepath.Join(config.GetConfigDir(), providerErrorsFile))
+	providerErrorsMu.Unlock()
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	records := make([]providerErrorRecord, 0, len(lines))
+	for _, line := range lines {
+		var record providerErrorRecord
+		if json.Unmarshal([]byte(line), &record) == nil {
+			records = append(records, record)
+		}
+	}
+	return records
+}
+
+// DiagnosticsOptions selects what goes into a diagnostics bundle.
+type DiagnosticsOptions struct {
+	Version        string
+	ProviderErrors int            // Newest provider errors to include (0 = DefaultDiagnosticsErrors)
+	Secrets        []string       // Literal values to redact everywhere, such as API keys
+	Extra          map[string]any // More JSON files to add, by file name
+}
+
+// CredentialSecrets returns the API keys in creds, for DiagnosticsOptions.Secrets.
+func CredentialSecrets(creds *credentials.Credentials) []string {
+	if creds == nil {
+		return nil
+	}
+	var secrets []string
+	for _, provider := range creds.Providers {
+		if provider.APIKey != "" {
+			secrets = append(secrets, provider.APIKey)
+		}
+	}
+	return secrets
+}
+
+// WriteDiagnosticsBundle writes a zip for bug reports: version and platform
+// details, the config with secrets redacted, the end of each log and the
+// newest provider errors. Credentials are never included, and the API keys
+// in opts.Secrets are scrubbed from every file.
+func WriteDiagnosticsBundle(w io.Writer, opts DiagnosticsOptions) error {
+	if opts.ProviderErrors <= 0 {
+		opts.ProviderErrors = DefaultDiagnosticsErrors
+	}
+	redact := newRedactor(opts.Secrets)
+	zw := zip.NewWriter(w)
+	add := func(name string, data []byte) error {
+		fw, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: time.Now()})
+		if err != nil {
+			return err
+		}
+		_, err = fw.Write(data)
+		return err
+	}
+	addJSON := func(name string, v any) error {
+		data, err := json.MarshalIndent(v, "", "  ")
+		if err != nil {
+			return fmt.Errorf("encode %s: %w", name, err)
+		}
+		return add(name, redact(data))
+	}
+
+	executable, _ := os.Executable()
+	info := map[string]any{
+		"generated_at": timefmt.Format(time.Now()),
+		"version":      opts.Version,
+		"go_version":   runtime.Version(),
+		"os":           runtime.GOOS,
+		"arch":         runtime.GOARCH,
+		"cpus":         runtime.NumCPU(),
+		"profile":      config.ActiveProfile(),
+		"config_dir":   config.GetConfigDir(),
+		"executable":   executable,
+	}
+	if err := addJSON("info.json", info); err != nil {
+		return err
+	}
+
+	configPath := config.UserConfigPath()
+	if data, err := os.ReadFile(configPath); err == nil {
+		if err := add("config.yaml", redact(redactConfig(data))); err != nil {
+			return err
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		if err := add("config.yaml", []byte(fmt.Sprintf("# could not read %s: %v\n", configPath, err))); err != nil {
+			return err
+		}
+	}
+
+	for _, name := range diagnosticsLogs {
+		data, err := readTail(filepath.Join(config.GetConfigDir(), name), diagnosticsLogTail)
+		if err != nil {
+			continue
+		}
+		if err := add("logs/"+name, redact(data)); err != nil {
+			return err
+		}
+	}
+
+	if err := addJSON("provider_errors.json", recentProviderErrors(opts.ProviderErrors)); err != nil {
+		return err
+	}
+	names := make([]string, 0, len(opts.Extra))
+	for name := range opts.Extra {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		if err := addJSON(name, opts.Extra[name]); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+// newRedactor returns a function that scrubs the given secrets and
+// well-known key formats from text.
+func newRedactor(secrets []string) func([]byte) []byte {
+	var pairs []string
+	for _, secret := range secrets {
+		if len(secret) >= 8 {
+			pairs = append(pairs, secret, redacted)
+		}
+	}
+	replacer := strings.NewReplacer(pairs...)
+	return func(data []byte) []byte {
+		text := replacer.Replace(string(data))
+		return []byte(secretValuePattern.ReplaceAllString(text, redacted))
+	}
+}
+
+// redactConfig blanks the values of secret-looking keys in a YAML config.
+// Configs that do not parse are returned with only line-based redaction.
+func redactConfig(data []byte) []byte {
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return redactConfigLines(data)
+	}
+	redactNode(&root)
+	var out bytes.Buffer
+	enc := yaml.NewEncoder(&out)
+	enc.SetIndent(2)
+	if err := enc.Encode(&root); err != nil {
+		return redactConfigLines(data)
+	}
+	return out.Bytes()
+}
+
+func redactNode(node *yaml.Node) {
+	if node.Kind == yaml.MappingNode {
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			if value.Kind == yaml.ScalarNode && value.Value != "" && secretKeyPattern.MatchString(key.Value) {
+				value.Value, value.Tag, value.Style = redacted, "!!str", 0
+				continue
+			}
+			redactNode(value)
+		}
+		return
+	}
+	for _, child := range node.Content {
+		redactNode(child)
+	}
+}
+
+// redactConfigLines blanks "key: value" lines with secret-looking keys.
+func redactConfigLines(data []byte) []byte {
+	var out bytes.Buffer
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1<<20)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if key, _, ok := strings.Cut(line, ":"); ok && secretKeyPattern.MatchString(strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(key), "- "))) {
+			line = key + ": " + redacted
+		}
+		out.WriteString(line)
+		out.WriteByte('\n')
+	}
+	return out.Bytes()
+}
+
+// readTail returns up to limit bytes from the end of the file at path,
+// starting at a line boundary when it had to cut.
+func readTail(path string, limit int64) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	offset := max(info.Size()-limit, 0)
+	data := make([]byte, info.Size()-offset)
+	if _, err := f.ReadAt(data, offset); err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	if offset > 0 {
+		if i := bytes.IndexByte(data, '\n'); i >= 0 {
+			data = data[i+1:]
+		}
+	}
+	return data, nil
+}
+
+// handleDiagnosticsBundle serves a diagnostics zip, adding the server's
+// health report. ?errors=N sets how many provider errors to include.
+func (s *webServer) handleDiagnosticsBundle(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.respondError(w, r, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	opts := DiagnosticsOptions{Version: s.agent.version}
+	opts.ProviderErrors, _ = strconv.Atoi(r.URL.Query().Get("errors"))
+	if s.agent.credManager != nil {
+		if creds, err := s.agent.credManager.Load(); err == nil {
+			opts.Secrets = CredentialSecrets(creds)
+		}
+	}
+	opts.Extra = map[string]any{
+		"health.json": map[string]any{
+			"warmup":    s.agent.warmup.Report(),
+			"providers": s.agent.providerHealth(),
+			"disk":      checkDiskHealth(config.GetConfigDir()),
+			"processes": s.agent.processHealth(),
+		},
+	}
+
+	var buf bytes.Buffer
+	if err := WriteDiagnosticsBundle(&buf, opts); err != nil {
+		s.respondError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	name := fmt.Sprintf("cando-diagnostics-%s.zip", time.Now().Format("20060102-150405"))
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name))
+	_, _ = w.Write(buf.Bytes())
+}
@@ -0,0 +1,680 @@
+package agent
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"cando/internal/config"
+)
+
+const (
+	turnLogFile         = "turn_log.jsonl"
+	digestStateFile     = "digest_state.json"
+	defaultDigestWindow = 24 * time.Hour
+	defaultSMTPPort     = 587
+)
+
+// testCommandPattern recognises shell commands that run a test suite.
+var testCommandPattern = regexp.MustCompile(`\b(go test|cargo test|npm (run )?test|yarn test|pnpm test|pytest|make test|jest|vitest|mvn test|gradle test)\b`)
+
+// turnLogMu serializes appends to workspace turn logs.
+var turnLogMu sync.Mutex
+
+// turnLogEntry is one line of a workspace's turn_log.jsonl, recorded after
+// every conversation turn and used to build activity digests.
+type turnLogEntry struct {
+	Time         time.Time `json:"time"`
+	Session      string    `json:"session"`
+	Status       string    `json:"status"` // done | error
+	DurationSecs int       `json:"duration_seconds"`
+	FilesChanged []string  `json:"files_changed,omitempty"`
+	TestsRun     []string  `json:"tests_run,omitempty"`
+	Tokens       int       `json:"tokens"`
+	Insertions   int       `json:"insertions,omitempty"`
+	Deletions    int       `json:"deletions,omitempty"`
+	Commands     int       `json:"commands,omitempty"`
+}
+
+// turnRecorder watches a turn's tool events, snapshots files before edit
+// tools change them, and when the turn ends appends a turn log entry and
+// emits the turn's diff summary.
+type turnRecorder struct {
+	wsCtx       *WorkspaceContext
+	turnID      string
+	prompt      string
+	logger      *log.Logger
+	start       time.Time
+	startTokens int
+	next        StreamCallback
+
+	mu        sync.Mutex
+	pending   map[string]map[string]any // tool call ID -> arguments
+	files     []string
+	tests     []string
+	commands  []string
+	snapshots []*fileSnapshot
+	snapped   map[string]bool
+	gitBefore map[string]string // Dirty files before the first command ran
+	gitProbed bool
+}
+
+func newTurnRecorder(wsCtx *WorkspaceContext, turnID, prompt string, tokens int, logger *log.Logger) *turnRecorder {
+	return &turnRecorder{
+		wsCtx:       wsCtx,
+		turnID:      turnID,
+		prompt:      prompt,
+		logger:      logger,
+		start:       time.Now(),
+		startTokens: tokens,
+		pending:     make(map[string]map[string]any),
+		snapped:     make(map[string]bool),
+	}
+}
+
+// Wrap returns a callback that records tool activity and forwards to next.
+// Recording happens even without a stream so turn summaries stay complete.
+func (r *turnRecorder) Wrap(next StreamCallback) StreamCallback {
+	r.next = next
+	return func(eventType string, data any) error {
+		r.observe(eventType, data)
+		if next == nil {
+			return nil
+		}
+		return next(eventType, data)
+	}
+}
+
+func (r *turnRecorder) observe(eventType string, data any) {
+	payload, ok := data.(map[string]any)
+	if !ok {
+		return
+	}
+	id, _ := payload["id"].(string)
+	function, _ := payload["function"].(string)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	switch eventType {
+	case "tool_call_started":
+		raw, _ := payload["arguments"].(string)
+		var args map[string]any
+		if json.Unmarshal([]byte(raw), &args) == nil {
+			r.pending[id] = args
+		}
+		// Snapshot before the tool runs; the first snapshot in a turn wins
+		for _, path := range editedPaths(function, args) {
+			rel, err := lexicalRelPath(r.wsCtx.root, path)
+			if err != nil || r.snapped[rel] {
+				continue
+			}
+			r.snapped[rel] = true
+			r.snapshots = append(r.snapshots, takeSnapshot(r.wsCtx.root, rel))
+		}
+		if function == "shell" || function == "background_process" {
+			if !r.gitProbed {
+				r.gitProbed = true
+				r.gitBefore = gitDirtyFiles(r.wsCtx.root)
+			}
+		}
+	case "tool_call_completed":
+		args := r.pending[id]
+		delete(r.pending, id)
+		if failed, _ := payload["error"].(bool); failed || args == nil {
+			return
+		}
+		for _, path := range editedPaths(function, args) {
+			r.files = appendUnique(r.files, path)
+		}
+		if function == "shell" {
+			command := commandText(args["command"])
+			if command != "" {
+				r.commands = append(r.commands, command)
+			}
+			if testCommandPattern.MatchString(command) {
+				r.tests = append(r.tests, command)
+			}
+		}
+		if function == "delete_path" {
+			r.recordDeletionLocked(args, payload["result"])
+		}
+		if command, ok := startedProcess(function, args); ok {
+			recordActivity(r.wsCtx.root, activityEntry{
+				Kind:    activityProcessStarted,
+				Session: r.wsCtx.states.CurrentKey(),
+				Summary: "Started " + command,
+				Details: map[string]any{"command": command},
+			}, r.logger)
+		}
+	}
+}
+
+// Finish appends the turn to the workspace log and, when files changed,
+// emits a turn_summary event and stores the originals with the session.
+func (r *turnRecorder) Finish(tokens int, turnErr error) {
+	logger := r.logger
+	r.mu.Lock()
+	session := r.wsCtx.states.CurrentKey()
+	summary, snapshots := r.summarizeLocked(session)
+	entry := turnLogEntry{
+		Time:         time.Now().UTC(),
+		Session:      session,
+		Status:       "done",
+		DurationSecs: int(time.Since(r.start).Seconds()),
+		FilesChanged: r.files,
+		TestsRun:     r.tests,
+		Tokens:       max(tokens-r.startTokens, 0),
+		Insertions:   summary.Insertions,
+		Deletions:    summary.Deletions,
+		Commands:     len(r.commands),
+	}
+	for _, change := range summary.Files {
+		if change.Source == "shell" {
+			entry.FilesChanged = appendUnique(entry.FilesChanged, change.Path)
+		}
+	}
+	r.mu.Unlock()
+	if turnErr != nil {
+		entry.Status = "error"
+	}
+	if err := appendTurnLog(r.wsCtx.root, entry); err != nil && logger != nil {
+		logger.Printf("[ws:%s] turn log write failed: %v", r.wsCtx.root, err)
+	}
+	r.recordTurnActivity(entry, summary)
+
+	if len(summary.Files) == 0 && len(summary.Commands) == 0 {
+		return
+	}
+	if len(summary.Files) > 0 {
+		if err := saveTurnChanges(r.wsCtx.root, turnChanges{Summary: summary, Snapshots: snapshots}); err != nil && logger != nil {
+			logger.Printf("[ws:%s] turn changes write failed: %v", r.wsCtx.root, err)
+		}
+		cp := &checkpoint{Prompt: truncatePrompt(r.prompt), Summary: summary, Snapshots: snapshots}
+		if err := saveCheckpoint(r.wsCtx.root, cp); err != nil && logger != nil {
+			logger.Printf("[ws:%s] checkpoint write failed: %v", r.wsCtx.root, err)
+		}
+	}
+	if r.next != nil {
+		r.next("turn_summary", summary)
+	}
+}
+
+// recordTurnActivity adds the prompt, and the files it changed if any, to
+// the workspace activity feed.
+func (r *turnRecorder) recordTurnActivity(entry turnLogEntry, summary turnSummary) {
+	if prompt := truncatePrompt(r.prompt); prompt != "" {
+		recordActivity(r.wsCtx.root, activityEntry{
+			Kind:    activityPrompt,
+			Session: entry.Session,
+			Summary: prompt,
+			Details: map[string]any{
+				"turn_id":          r.turnID,
+				"status":           entry.Status,
+				"duration_seconds": entry.DurationSecs,
+				"files":            len(summary.Files),
+				"commands":         entry.Commands,
+			},
+		}, r.logger)
+	}
+	if len(summary.Files) == 0 {
+		return
+	}
+	paths := make([]string, 0, len(summary.Files))
+	for _, change := range summary.Files {
+		paths = append(paths, change.Path)
+	}
+	noun := "files"
+	if len(paths) == 1 {
+		noun = "file"
+	}
+	recordActivity(r.wsCtx.root, activityEntry{
+		Kind:    activityFilesChanged,
+		Session: entry.Session,
+		Summary: fmt.Sprintf("Changed %d %s (+%d -%d)", len(paths), noun, summary.Insertions, summary.Deletions),
+		Details: map[string]any{
+			"turn_id":    r.turnID,
+			"paths":      paths,
+			"insertions": summary.Insertions,
+			"deletions":  summary.Deletions,
+		},
+	}, r.logger)
+}
+
+// recordDeletionLocked adds a delete_path call to the activity feed with the
+// trash id needed to restore it.
+func (r *turnRecorder) recordDeletionLocked(args map[string]any, result any) {
+	var entry struct {
+		ID   string `json:"id"`
+		Path string `json:"path"`
+		Type string `json:"type"`
+	}
+	raw, _ := result.(string)
+	if action, _ := args["action"].(string); (action != "" && action != "delete") || json.Unmarshal([]byte(raw), &entry) != nil || entry.ID == "" {
+		return
+	}
+	recordActivity(r.wsCtx.root, activityEntry{
+		Kind:    activityPathDeleted,
+		Session: r.wsCtx.states.CurrentKey(),
+		Summary: fmt.Sprintf("Deleted %s %s (moved to trash)", entry.Type, entry.Path),
+		Details: map[string]any{"path": entry.Path, "trash_id": entry.ID},
+	}, r.logger)
+}
+
+// commandText returns a shell command given as a string or an argv array.
+func commandText(raw any) string {
+	switch v := raw.(type) {
+	case string:
+		return strings.TrimSpace(v)
+	case []any:
+		parts := make([]string, 0, len(v))
+		for _, part := range v {
+			if s, ok := part.(string); ok {
+				parts = append(parts, s)
+			}
+		}
+		return strings.TrimSpace(strings.Join(parts, " "))
+	}
+	return ""
+}
+
+// startedProcess reports the command of a tool call that launched a
+// background process.
+func startedProcess(function string, args map[string]any) (string, bool) {
+	switch function {
+	case "background_process":
+		if action, _ := args["action"].(string); action != "start" {
+			return "", false
+		}
+	case "shell":
+		if background, _ := args["background"].(bool); !background {
+			return "", false
+		}
+	default:
+		return "", false
+	}
+	command := commandText(args["command"])
+	return command, command != ""
+}
+
+// summarizeLocked diffs the turn's snapshots against the files on disk.
+// Only snapshots of files that actually changed are returned.
+func (r *turnRecorder) summarizeLocked(session string) (turnSummary, []*fileSnapshot) {
+	summary := turnSummary{
+		TurnID:   r.turnID,
+		Session:  session,
+		Time:     time.Now().UTC(),
+		Files:    []fileChange{},
+		Commands: r.commands,
+	}
+	snapshots := r.snapshots
+	if r.gitBefore != nil {
+		snapshots = append(snapshots, shellSnapshots(r.wsCtx.root, r.gitBefore, r.snapped)...)
+	}
+	var changed []*fileSnapshot
+	for _, snap := range snapshots {
+		change, ok := diffSnapshot(r.wsCtx.root, snap)
+		if !ok {
+			continue
+		}
+		summary.Files = append(summary.Files, change)
+		summary.Insertions += change.Insertions
+		summary.Deletions += change.Deletions
+		changed = append(changed, snap)
+	}
+	return summary, changed
+}
+
+// patchFilePaths extracts file paths from *** Add/Update/Delete File headers.
+func patchFilePaths(patch string) []string {
+	var paths []string
+	for _, line := range strings.Split(patch, "\n") {
+		for _, prefix := range []string{"*** Add File: ", "*** Update File: ", "*** Delete File: "} {
+			if strings.HasPrefix(line, prefix) {
+				paths = append(paths, strings.TrimSpace(strings.TrimPrefix(line, prefix)))
+			}
+		}
+	}
+	return paths
+}
+
+func appendUnique(list []string, value string) []string {
+	for _, existing := range list {
+		if existing == value {
+			return list
+		}
+	}
+	return append(list, value)
+}
+
+func appendTurnLog(workspaceRoot string, entry turnLogEntry) error {
+	storageRoot, err := ProjectStorageRoot(workspaceRoot)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	turnLogMu.Lock()
+	defer turnLogMu.Unlock()
+	if err := os.MkdirAll(storageRoot, 0o755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(filepath.Join(storageRoot, turnLogFile), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = f.Write(append(data, '\n'))
+	return err
+}
+
+// readTurnLog returns the workspace's turn log entries in [since, until).
+func readTurnLog(workspaceRoot string, since, until time.Time) ([]turnLogEntry, error) {
+	storageRoot, err := ProjectStorageRoot(workspaceRoot)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(filepath.Join(storageRoot, turnLogFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []turnLogEntry
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var entry turnLogEntry
+		if json.Unmarshal(scanner.Bytes(), &entry) != nil {
+			continue
+		}
+		if entry.Time.Before(since) || !entry.Time.Before(until) {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	return entries, scanner.Err()
+}
+
+// workspaceDigest summarizes one workspace's activity over a digest window.
+type workspaceDigest struct {
+	Workspace    string   `json:"workspace"`
+	Name         string   `json:"name"`
+	Turns        int      `json:"turns"`
+	FailedTurns  int      `json:"failed_turns"`
+	Sessions     []string `json:"sessions"`
+	FilesChanged []string `json:"files_changed"`
+	TestsRun     []string `json:"tests_run"`
+	Tokens       int      `json:"tokens"`
+}
+
+// buildDigest aggregates turn logs per workspace, skipping idle workspaces.
+func buildDigest(workspaces []Workspace, since, until time.Time) []workspaceDigest {
+	var digests []workspaceDigest
+	for _, ws := range workspaces {
+		entries, err := readTurnLog(ws.Path, since, until)
+		if err != nil || len(entries) == 0 {
+			continue
+		}
+		digest := workspaceDigest{Workspace: ws.Path, Name: ws.Name}
+		for _, entry := range entries {
+			digest.Turns++
+			if entry.Status == "error" {
+				digest.FailedTurns++
+			}
+			if entry.Session != "" {
+				digest.Sessions = appendUnique(digest.Sessions, entry.Session)
+			}
+			for _, path := range entry.FilesChanged {
+				digest.FilesChanged = appendUnique(digest.FilesChanged, path)
+			}
+			for _, command := range entry.TestsRun {
+				digest.TestsRun = appendUnique(digest.TestsRun, command)
+			}
+			digest.Tokens += entry.Tokens
+		}
+		sort.Strings(digest.FilesChanged)
+		digests = append(digests, digest)
+	}
+	return digests
+}
+
+// renderDigest formats digests as a plain-text email body.
+func renderDigest(digests []workspaceDigest, since, until time.Time) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Cando activity from %s to %s\n", since.Local().Format("2006-01-02 15:04"), until.Local().Format("2006-01-02 15:04"))
+	if len(digests) == 0 {
+		b.WriteString("\nNo agent activity in this period.\n")
+		return b.String()
+	}
+	for _, d := range digests {
+		fmt.Fprintf(&b, "\n== %s (%s)\n", d.Name, d.Workspace)
+		fmt.Fprintf(&b, "Turns: %d", d.Turns)
+		if d.FailedTurns > 0 {
+			fmt.Fprintf(&b, " (%d failed)", d.FailedTurns)
+		}
+		fmt.Fprintf(&b, "\nSessions: %s\n", strings.Join(d.Sessions, ", "))
+		fmt.Fprintf(&b, "Tokens used: %d\n", d.Tokens)
+		if len(d.FilesChanged) > 0 {
+			fmt.Fprintf(&b, "Files changed (%d):\n", len(d.FilesChanged))
+			for _, path := range d.FilesChanged {
+				fmt.Fprintf(&b, "  - %s\n", path)
+			}
+		}
+		if len(d.TestsRun) > 0 {
+			b.WriteString("Tests run:\n")
+			for _, command := range d.TestsRun {
+				fmt.Fprintf(&b, "  - %s\n", command)
+			}
+		}
+	}
+	return b.String()
+}
+
+// sendDigestEmail delivers body over SMTP. Port 465 uses implicit TLS; other
+// ports upgrade with STARTTLS when the server offers it.
+func sendDigestEmail(cfg config.DigestConfig, subject, body string) error {
+	port := cfg.SMTPPort
+	if port == 0 {
+		port = defaultSMTPPort
+	}
+	addr := net.JoinHostPort(cfg.SMTPHost, strconv.Itoa(port))
+	var auth smtp.Auth
+	if cfg.SMTPUsername != "" {
+		auth = smtp.PlainAuth("", cfg.SMTPUsername, os.ExpandEnv(cfg.SMTPPassword), cfg.SMTPHost)
+	}
+
+	var msg strings.Builder
+	fmt.Fprintf(&msg, "From: %s\r\n", cfg.From)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(cfg.To, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", subject)
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\nContent-Type: text/plain; charset=utf-8\r\n\r\n")
+	msg.WriteString(strings.ReplaceAll(body, "\n", "\r\n"))
+
+	if port != 465 {
+		return smtp.SendMail(addr, auth, cfg.From, cfg.To, []byte(msg.String()))
+	}
+
+	conn, err := tls.Dial("tcp", addr, &tls.Config{ServerName: cfg.SMTPHost})
+	if err != nil {
+		return fmt.Errorf("smtp connect: %w", err)
+	}
+	client, err := smtp.NewClient(conn, cfg.SMTPHost)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("smtp handshake: %w", err)
+	}
+	defer client.Close()
+	if auth != nil {
+		if err := client.Auth(auth); err != nil {
+			return fmt.Errorf("smtp auth: %w", err)
+		}
+	}
+	if err := client.Mail(cfg.From); err != nil {
+		return err
+	}
+	for _, to := range cfg.To {
+		if err := client.Rcpt(to); err != nil {
+			return err
+		}
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write([]byte(msg.String())); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+// digestState remembers when the last digest went out so restarts neither
+// skip nor repeat a period.
+type digestState struct {
+	LastSent time.Time `json:"last_sent"`
+}
+
+func digestStatePath() string {
+	return filepath.Join(config.GetConfigDir(), digestStateFile)
+}
+
+func loadDigestState() digestState {
+	var st digestState
+	if data, err := os.ReadFile(digestStatePath()); err == nil {
+		_ = json.Unmarshal(data, &st)
+	}
+	return st
+}
+
+func saveDigestState(st digestState) error {
+	data, err := json.MarshalIndent(st, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(digestStatePath()), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(digestStatePath(), data, 0o644)
+}
+
+// sendDigest builds and emails the digest for activity since the last one.
+func (s *webServer) sendDigest(now time.Time) error {
+	since := loadDigestState().LastSent
+	if since.IsZero() || now.Sub(since) > 7*defaultDigestWindow {
+		since = now.Add(-defaultDigestWindow)
+	}
+	digests := buildDigest(s.workspaceManager.List(), since, now)
+	subject := fmt.Sprintf("Cando digest for %s", now.Local().Format("Mon Jan 2"))
+	if err := sendDigestEmail(s.agent.cfg.Load().Digest, subject, renderDigest(digests, since, now)); err != nil {
+		return err
+	}
+	return saveDigestState(digestState{LastSent: now})
+}
+
+// nextDigestTime returns the next occurrence of hour (local time) after now.
+func nextDigestTime(now time.Time, hour int) time.Time {
+	next := time.Date(now.Year(), now.Month(), now.Day(), hour, 0, 0, 0, now.Location())
+	if !next.After(now) {
+		next = next.AddDate(0, 0, 1)
+	}
+	return next
+}
+
+// startDigestScheduler sends the daily digest at the configured hour until
+// ctx is cancelled. A digest missed while Cando was down goes out at startup.
+func (s *webServer) startDigestScheduler(ctx context.Context) {
+	if !s.agent.cfg.Load().Digest.Enabled {
+		return
+	}
+	go func() {
+		hour := s.agent.cfg.Load().Digest.Hour
+		if last := loadDigestState().LastSent; !last.IsZero() && time.Now().After(nextDigestTime(last, hour)) {
+			if err := s.sendDigest(time.Now()); err != nil {
+				s.logger.Printf("[digest] send failed: %v", err)
+			}
+		}
+		for {
+			timer := time.NewTimer(time.Until(nextDigestTime(time.Now(), hour)))
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			case <-timer.C:
+			}
+			if err := s.sendDigest(time.Now()); err != nil {
+				s.logger.Printf("[digest] send failed: %v", err)
+			} else {
+				s.logger.Printf("[digest] sent to %s", strings.Join(s.agent.cfg.Load().Digest.To, ", "))
+			}
+		}
+	}()
+}
+
+// handleDigest previews the activity digest (GET, optional ?hours=N) or
+// sends it immediately (POST).
+func (s *webServer) handleDigest(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		window := defaultDigestWindow
+		if raw := r.URL.Query().Get("hours"); raw != "" {
+			hours, err := strconv.Atoi(raw)
+			if err != nil || hours <= 0 {
+				s.respondError(w, r, http.StatusBadRequest, "hours must be a positive integer")
+				return
+			}
+			window = time.Duration(hours) * time.Hour
+		}
+		now := time.Now()
+		since := now.Add(-window)
+		digests := buildDigest(s.workspaceManager.List(), since, now)
+		s.writeJSON(w, r, map[string]any{
+			"since":      since,
+			"until":      now,
+			"workspaces": digests,
+			"text":       renderDigest(digests, since, now),
+		})
+
+	case http.MethodPost:
+		cfg := s.agent.cfg.Load().Digest
+		if strings.TrimSpace(cfg.SMTPHost) == "" || len(cfg.To) == 0 {
+			s.respondError(w, r, http.StatusBadRequest, "configure digest smtp_host and to in config.yaml first")
+			return
+		}
+		if err := s.sendDigest(time.Now()); err != nil {
+			var netErr net.Error
+			status := http.StatusInternalServerError
+			if errors.As(err, &netErr) {
+				status = http.StatusBadGateway
+			}
+			s.respondError(w, r, status, fmt.Sprintf("send digest: %v", err))
+			return
+		}
+		s.writeJSON(w, r, map[string]string{"status": "sent"})
+
+	default:
+		s.respondError(w, r, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
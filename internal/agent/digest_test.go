@@ -0,0 +1,41 @@
+package agent
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBuildDigestAggregatesTurnLog(t *testing.T) {
+	t.Setenv("CANDO_CONFIG_DIR", t.TempDir())
+	workspace := t.TempDir()
+	now := time.Now().UTC()
+
+	entries := []turnLogEntry{
+		{Time: now.Add(-48 * time.Hour), Session: "old", Status: "done", FilesChanged: []string{"stale.go"}, Tokens: 999},
+		{Time: now.Add(-2 * time.Hour), Session: "s1", Status: "done", FilesChanged: []string{"b.go", "a.go"}, TestsRun: []string{"go test ./..."}, Tokens: 100},
+		{Time: now.Add(-1 * time.Hour), Session: "s1", Status: "error", FilesChanged: []string{"a.go"}, Tokens: 50},
+	}
+	for _, entry := range entries {
+		if err := appendTurnLog(workspace, entry); err != nil {
+			t.Fatalf("append turn log: %v", err)
+		}
+	}
+
+	digests := buildDigest([]Workspace{{Path: workspace, Name: "demo"}}, now.Add(-24*time.Hour), now)
+	if len(digests) != 1 {
+		t.Fatalf("expected one workspace digest, got %d", len(digests))
+	}
+	d := digests[0]
+	if d.Turns != 2 || d.FailedTurns != 1 || d.Tokens != 150 {
+		t.Fatalf("unexpected totals: %+v", d)
+	}
+	if strings.Join(d.FilesChanged, ",") != "a.go,b.go" || len(d.TestsRun) != 1 {
+		t.Fatalf("unexpected files/tests: %+v", d)
+	}
+
+	text := renderDigest(digests, now.Add(-24*time.Hour), now)
+	if !strings.Contains(text, "Turns: 2 (1 failed)") || strings.Contains(text, "stale.go") {
+		t.Fatalf("unexpected digest text:\n%s", text)
+	}
+}
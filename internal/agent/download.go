@@ -0,0 +1,165 @@
+package agent
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"cando/internal/ignore"
+	"cando/internal/tooling"
+)
+
+const (
+	// maxDownloadZipBytes and maxDownloadZipFiles bound a zipped directory,
+	// counted before compression.
+	maxDownloadZipBytes = 512 << 20
+	maxDownloadZipFiles = 20000
+)
+
+// downloadSkipFile reports files left out of zipped directories because
+// they usually hold secrets, even where no .gitignore names them. Asking for
+// one by path still downloads it.
+func downloadSkipFile(name string) bool {
+	return name == ".env" || strings.HasPrefix(name, ".env.") || strings.HasSuffix(name, ".pem") || strings.HasSuffix(name, ".key")
+}
+
+// handleFilesDownload sends a workspace file as an attachment, or a
+// directory as a zip. Query parameters: workspace and path (empty for the
+// whole workspace).
+func (s *webServer) handleFilesDownload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.respondError(w, r, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	workspace := s.getWorkspaceFromRequest(r)
+	if workspace == "" {
+		s.respondError(w, r, http.StatusBadRequest, "workspace required")
+		return
+	}
+	rel := r.URL.Query().Get("path")
+	fullPath, ok := s.workspaceFilePath(w, r, workspace, rel, true)
+	if !ok {
+		return
+	}
+	info, err := os.Stat(fullPath)
+	if err != nil {
+		s.respondError(w, r, http.StatusNotFound, "path not found")
+		return
+	}
+
+	if !info.IsDir() {
+		if !info.Mode().IsRegular() {
+			s.respondError(w, r, http.StatusBadRequest, "not a regular file")
+			return
+		}
+		f, err := os.Open(fullPath)
+		if err != nil {
+			s.respondError(w, r, http.StatusInternalServerError, fmt.Sprintf("open file: %v", err))
+			return
+		}
+		defer f.Close()
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", info.Name()))
+		http.ServeContent(w, r, info.Name(), info.ModTime(), f)
+		return
+	}
+
+	root, _ := tooling.ResolveWithin(workspace, "", s.agent.cfg.Load().AllowExternalSymlinks)
+	files, err := collectDownloadFiles(root, fullPath)
+	if err != nil {
+		s.respondError(w, r, http.StatusRequestEntityTooLarge, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", info.Name()+".zip"))
+	// Headers are sent with the first byte, so later failures can only
+	// cut the archive short; a truncated zip fails to open rather than
+	// passing for a complete one.
+	zw := zip.NewWriter(w)
+	for _, name := range files {
+		if err := addZipFile(zw, fullPath, name); err != nil {
+			s.logRequestError(r, http.StatusInternalServerError, fmt.Sprintf("zip %s: %v", name, err))
+			return
+		}
+	}
+	if err := zw.Close(); err != nil {
+		s.logRequestError(r, http.StatusInternalServerError, fmt.Sprintf("zip: %v", err))
+	}
+}
+
+// collectDownloadFiles lists the regular files under dir, as slash-separated
+// paths relative to it. Like the file search, it leaves out what the
+// workspace's .gitignore files and ignore.DefaultDirs exclude, read from
+// root, as well as downloadSkipFile. Symlinks are not followed. It fails
+// once the directory exceeds the zip limits.
+func collectDownloadFiles(root, dir string) ([]string, error) {
+	base, err := filepath.Rel(root, dir)
+	if err != nil || base == ".." || strings.HasPrefix(base, ".."+string(filepath.Separator)) {
+		root, base = dir, "." // Outside the workspace through an allowed symlink
+	}
+	matcher := ignore.New(root)
+	var files []string
+	var total int64
+	err = filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil // Unreadable entries are left out
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return nil
+		}
+		if d.IsDir() {
+			if p != dir && matcher.Ignored(rel, true) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() || downloadSkipFile(d.Name()) || matcher.Ignored(rel, false) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		total += info.Size()
+		if total > maxDownloadZipBytes || len(files) >= maxDownloadZipFiles {
+			return fmt.Errorf("directory is over the download limit of %d MB or %d files; download a smaller folder", maxDownloadZipBytes>>20, maxDownloadZipFiles)
+		}
+		rel, err = filepath.Rel(dir, p)
+		if err != nil {
+			return nil
+		}
+		files = append(files, filepath.ToSlash(rel))
+		return nil
+	})
+	return files, err
+}
+
+func addZipFile(zw *zip.Writer, dir, name string) error {
+	f, err := os.Open(filepath.Join(dir, filepath.FromSlash(name)))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	header, err := zip.FileInfoHeader(info)
+	if err != nil {
+		return err
+	}
+	header.Name = path.Clean(name)
+	header.Method = zip.Deflate
+	dst, err := zw.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(dst, f)
+	return err
+}
@@ -0,0 +1,136 @@
+package agent
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"cando/internal/config"
+)
+
+func TestFilesDownload(t *testing.T) {
+	configDir := t.TempDir()
+	t.Setenv("CANDO_CONFIG_DIR", configDir)
+	workspace := t.TempDir()
+	manager := &WorkspaceManager{filePath: filepath.Join(configDir, "workspaces.json")}
+	if _, err := manager.Add(workspace); err != nil {
+		t.Fatal(err)
+	}
+	s := &webServer{
+		agent:            &Agent{cfg: newRuntimeConfig(config.Config{})},
+		logger:           log.New(io.Discard, "", 0),
+		workspaceManager: manager,
+	}
+	for name, content := range map[string]string{
+		"dist/app.js":                "console.log(1)",
+		"dist/assets/logo.svg":       "<svg/>",
+		"dist/.env":                  "TOKEN=secret",
+		"dist/node_modules/x/a.js":   "dep",
+		"report.md":                  "# Report",
+		"dist/.git/config":           "[core]",
+		"dist/assets/nested/deep.md": "deep",
+		".gitignore":                 "*.map\n/dist/tmp/\n",
+		"dist/.gitignore":            "cache/\n",
+		"dist/app.js.map":            "{}",
+		"dist/tmp/scratch.txt":       "scratch",
+		"dist/assets/cache/x.bin":    "cached",
+	} {
+		path := filepath.Join(workspace, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	download := func(path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		q := url.Values{"workspace": {workspace}, "path": {path}}
+		s.handleFilesDownload(rec, httptest.NewRequest(http.MethodGet, "/api/files/download?"+q.Encode(), nil))
+		return rec
+	}
+
+	rec := download("report.md")
+	if rec.Code != http.StatusOK || rec.Body.String() != "# Report" || rec.Header().Get("Content-Disposition") != `attachment; filename="report.md"` {
+		t.Fatalf("file = %d %q %v", rec.Code, rec.Body.String(), rec.Header())
+	}
+
+	rec = download("dist")
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Disposition") != `attachment; filename="dist.zip"` {
+		t.Fatalf("dir = %d %v", rec.Code, rec.Header())
+	}
+	archive, err := zip.NewReader(bytes.NewReader(rec.Body.Bytes()), int64(rec.Body.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, f := range archive.File {
+		names = append(names, f.Name)
+	}
+	slices.Sort(names)
+	if !slices.Equal(names, []string{".gitignore", "app.js", "assets/logo.svg", "assets/nested/deep.md"}) {
+		t.Errorf("zip entries = %v", names)
+	}
+
+	if rec := download("../outside"); rec.Code != http.StatusForbidden {
+		t.Errorf("outside workspace = %d", rec.Code)
+	}
+	if rec := download("missing.txt"); rec.Code != http.StatusNotFound {
+		t.Errorf("missing = %d", rec.Code)
+	}
+}
+
+func TestFileSearchSkipsIgnoredFiles(t *testing.T) {
+	configDir := t.TempDir()
+	t.Setenv("CANDO_CONFIG_DIR", configDir)
+	workspace := t.TempDir()
+	manager := &WorkspaceManager{filePath: filepath.Join(configDir, "workspaces.json")}
+	if _, err := manager.Add(workspace); err != nil {
+		t.Fatal(err)
+	}
+	s := &webServer{
+		agent:            &Agent{cfg: newRuntimeConfig(config.Config{})},
+		logger:           log.New(io.Discard, "", 0),
+		workspaceManager: manager,
+	}
+	for name, content := range map[string]string{
+		".gitignore":           "*.gen.go\ntmp/\n",
+		"main.go":              "package main",
+		"api.gen.go":           "package main",
+		"tmp/main_old.go":      "package main",
+		"cmd/tool/main.go":     "package main",
+		"cmd/tool/.gitignore":  "!keep.gen.go\n",
+		"cmd/tool/keep.gen.go": "package main",
+	} {
+		path := filepath.Join(workspace, filepath.FromSlash(name))
+		os.MkdirAll(filepath.Dir(path), 0o755)
+		os.WriteFile(path, []byte(content), 0o644)
+	}
+
+	rec := httptest.NewRecorder()
+	q := url.Values{"workspace": {workspace}, "q": {".go"}}
+	s.handleFileSearch(rec, httptest.NewRequest(http.MethodGet, "/api/files?"+q.Encode(), nil))
+	var found []struct {
+		Path string `json:"path"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &found); err != nil {
+		t.Fatalf("search = %d %s", rec.Code, rec.Body.String())
+	}
+	var paths []string
+	for _, f := range found {
+		paths = append(paths, filepath.ToSlash(f.Path))
+	}
+	slices.Sort(paths)
+	if want := []string{"cmd/tool/keep.gen.go", "cmd/tool/main.go", "main.go"}; !slices.Equal(paths, want) {
+		t.Errorf("search = %v, want %v", paths, want)
+	}
+}
@@ -0,0 +1,380 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"cando/internal/state"
+	"cando/internal/tooling"
+)
+
+const (
+	// maxEditorCommands caps the per-workspace command queue so an editor that
+	// never polls cannot grow it without bound.
+	maxEditorCommands = 100
+
+	// editorPollWindow is how long after its last poll an editor counts as
+	// connected, so the UI only offers commands someone will pick up.
+	editorPollWindow = 30 * time.Second
+
+	// maxEditorSelectionChars caps the selected text added to the system
+	// message.
+	maxEditorSelectionChars = 16000
+)
+
+// editorSelection is the file/selection an editor extension pushed to Cando.
+type editorSelection struct {
+	Path      string    `json:"path"` // Relative to workspace root
+	StartLine int       `json:"start_line,omitempty"`
+	EndLine   int       `json:"end_line,omitempty"`
+	Text      string    `json:"text,omitempty"`
+	Language  string    `json:"language,omitempty"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// editorCommand is queued by the web UI (or agent) for the editor to execute.
+type editorCommand struct {
+	ID        int64     `json:"id"`
+	Type      string    `json:"type"` // "open_file" or "apply_diff"
+	Path      string    `json:"path"`
+	Line      int       `json:"line,omitempty"`
+	Column    int       `json:"column,omitempty"`
+	Diff      string    `json:"diff,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// editorBridge holds editor state per workspace root.
+type editorBridge struct {
+	mu         sync.Mutex
+	selections map[string]*editorSelection
+	commands   map[string][]editorCommand
+	polled     map[string]time.Time // Last command poll per workspace
+	nextID     int64
+}
+
+func newEditorBridge() *editorBridge {
+	return &editorBridge{
+		selections: make(map[string]*editorSelection),
+		commands:   make(map[string][]editorCommand),
+		polled:     make(map[string]time.Time),
+	}
+}
+
+func (b *editorBridge) setSelection(workspace string, sel *editorSelection) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if sel == nil {
+		delete(b.selections, workspace)
+		return
+	}
+	b.selections[workspace] = sel
+}
+
+func (b *editorBridge) selection(workspace string) *editorSelection {
+	if b == nil {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.selections[workspace]
+}
+
+// connected reports whether an editor polled the workspace's commands
+// recently.
+func (b *editorBridge) connected(workspace string, now time.Time) bool {
+	if b == nil {
+		return false
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	polled, ok := b.polled[workspace]
+	return ok && now.Sub(polled) < editorPollWindow
+}
+
+func (b *editorBridge) enqueue(workspace string, cmd editorCommand) editorCommand {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.nextID++
+	cmd.ID = b.nextID
+	cmd.CreatedAt = time.Now()
+	queue := append(b.commands[workspace], cmd)
+	if len(queue) > maxEditorCommands {
+		queue = queue[len(queue)-maxEditorCommands:]
+	}
+	b.commands[workspace] = queue
+	return cmd
+}
+
+// drain returns and removes all pending commands for a workspace and
+// records the poll.
+func (b *editorBridge) drain(workspace string) []editorCommand {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.polled[workspace] = time.Now()
+	queue := b.commands[workspace]
+	delete(b.commands, workspace)
+	if queue == nil {
+		return []editorCommand{}
+	}
+	return queue
+}
+
+// editorWorkspace resolves and validates the workspace for an editor
+// request. The bridge keys its state by the absolute root, as turns see it.
+func (s *webServer) editorWorkspace(w http.ResponseWriter, r *http.Request) (string, bool) {
+	workspace := s.getWorkspaceFromRequest(r)
+	if workspace == "" || !s.workspaceExists(workspace) {
+		s.respondError(w, r, http.StatusBadRequest, "select a workspace first")
+		return "", false
+	}
+	root, err := filepath.Abs(workspace)
+	if err != nil {
+		s.respondError(w, r, http.StatusBadRequest, fmt.Sprintf("invalid workspace: %v", err))
+		return "", false
+	}
+	return root, true
+}
+
+// workspaceRelPath converts a client-supplied path (absolute or relative)
+// into a path relative to the workspace root. It resolves symlinks with
+// tooling.ResolveWithin, so a link inside the workspace cannot lead out of
+// it unless allowExternal is set.
+func workspaceRelPath(workspace, path string, allowExternal bool) (string, error) {
+	path = strings.TrimSpace(path)
+	if path == "" {
+		return "", fmt.Errorf("path is required")
+	}
+	root, err := tooling.ResolveWithin(workspace, "", allowExternal)
+	if err != nil {
+		return "", err
+	}
+	full, err := tooling.ResolveWithin(workspace, path, allowExternal)
+	if err != nil {
+		return "", err
+	}
+	rel, err := filepath.Rel(root, full)
+	if err != nil {
+		return "", err
+	}
+	return filepath.ToSlash(rel), nil
+}
+
+// lexicalRelPath returns path relative to root without touching the disk,
+// or an error when it lies outside. It only normalizes paths the tools
+// already resolved, for display and bookkeeping; client paths go through
+// workspaceRelPath.
+func lexicalRelPath(root, path string) (string, error) {
+	path = strings.TrimSpace(path)
+	if path == "" {
+		return "", fmt.Errorf("path is required")
+	}
+	root = filepath.Clean(root)
+	full := path
+	if !filepath.IsAbs(full) {
+		full = filepath.Join(root, full)
+	}
+	rel, err := filepath.Rel(root, filepath.Clean(full))
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("path traversal not allowed")
+	}
+	return filepath.ToSlash(rel), nil
+}
+
+// editorPath resolves a path sent to the editor endpoints.
+func (s *webServer) editorPath(workspace, path string) (string, error) {
+	return workspaceRelPath(workspace, path, s.agent.cfg.Load().AllowExternalSymlinks)
+}
+
+type editorSelectionKey struct{}
+
+// withEditorSelection hands the workspace's editor selection to the turn,
+// which adds it to the system message.
+func (s *webServer) withEditorSelection(ctx context.Context, root string) context.Context {
+	sel := s.editor.selection(root)
+	if sel == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, editorSelectionKey{}, sel)
+}
+
+func editorSelectionFrom(ctx context.Context) *editorSelection {
+	sel, _ := ctx.Value(editorSelectionKey{}).(*editorSelection)
+	return sel
+}
+
+// injectEditorSelection appends the file and selection the user's editor
+// pushed to the system message.
+func injectEditorSelection(messages []state.Message, sel *editorSelection) []state.Message {
+	if sel == nil || len(messages) == 0 {
+		return messages
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "\n\n---\nThe user's editor has %s open", sel.Path)
+	switch {
+	case sel.StartLine > 0 && sel.EndLine > sel.StartLine:
+		fmt.Fprintf(&b, ", lines %d-%d selected", sel.StartLine, sel.EndLine)
+	case sel.StartLine > 0:
+		fmt.Fprintf(&b, " at line %d", sel.StartLine)
+	}
+	if text := sel.Text; strings.TrimSpace(text) != "" {
+		truncated := ""
+		if len(text) > maxEditorSelectionChars {
+			text, truncated = text[:maxEditorSelectionChars], "\n[selection truncated]"
+		}
+		fmt.Fprintf(&b, ". The selected text:\n```%s\n%s\n```%s", sel.Language, strings.TrimSuffix(text, "\n"), truncated)
+	}
+	b.WriteString("\nWhen the user says \"this\" or \"here\" without naming a file, they likely mean it.")
+
+	// Make a copy to avoid modifying the original
+	result := make([]state.Message, len(messages))
+	copy(result, messages)
+	for i, msg := range result {
+		if msg.Role == "system" {
+			result[i].Content = msg.Content + b.String()
+			break
+		}
+	}
+	return result
+}
+
+// handleEditorSelection stores (POST), returns (GET) or clears (DELETE) the
+// selection pushed by an editor extension.
+func (s *webServer) handleEditorSelection(w http.ResponseWriter, r *http.Request) {
+	workspace, ok := s.editorWorkspace(w, r)
+	if !ok {
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		s.writeJSON(w, r, map[string]any{
+			"selection": s.editor.selection(workspace),
+		})
+	case http.MethodPost:
+		var req editorSelection
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			s.respondError(w, r, http.StatusBadRequest, "invalid payload")
+			return
+		}
+		rel, err := s.editorPath(workspace, req.Path)
+		if err != nil {
+			s.respondError(w, r, http.StatusBadRequest, err.Error())
+			return
+		}
+		if req.StartLine < 0 || (req.EndLine != 0 && req.EndLine < req.StartLine) {
+			s.respondError(w, r, http.StatusBadRequest, "invalid line range")
+			return
+		}
+		req.Path = rel
+		req.UpdatedAt = time.Now()
+		s.editor.setSelection(workspace, &req)
+		s.publishEditorSelection(workspace)
+		s.writeJSON(w, r, map[string]any{
+			"selection": &req,
+		})
+	case http.MethodDelete:
+		s.editor.setSelection(workspace, nil)
+		s.publishEditorSelection(workspace)
+		s.writeJSON(w, r, map[string]any{
+			"status": "cleared",
+		})
+	default:
+		s.respondError(w, r, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+// publishEditorSelection tells open pages that the selection changed, so
+// they show what the next prompt will include.
+func (s *webServer) publishEditorSelection(workspace string) {
+	s.events.publish("editor_selection_changed", map[string]any{"workspace": workspace, "selection": s.editor.selection(workspace)})
+}
+
+// handleEditorOpen queues a request for the editor to open a file at a line.
+func (s *webServer) handleEditorOpen(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		s.respondError(w, r, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	workspace, ok := s.editorWorkspace(w, r)
+	if !ok {
+		return
+	}
+	var req struct {
+		Path   string `json:"path"`
+		Line   int    `json:"line"`
+		Column int    `json:"column"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.respondError(w, r, http.StatusBadRequest, "invalid payload")
+		return
+	}
+	rel, err := s.editorPath(workspace, req.Path)
+	if err != nil {
+		s.respondError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	cmd := s.editor.enqueue(workspace, editorCommand{
+		Type:   "open_file",
+		Path:   rel,
+		Line:   req.Line,
+		Column: req.Column,
+	})
+	s.writeJSON(w, r, cmd)
+}
+
+// handleEditorDiff queues a unified diff for the editor to apply to its buffer.
+func (s *webServer) handleEditorDiff(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		s.respondError(w, r, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	workspace, ok := s.editorWorkspace(w, r)
+	if !ok {
+		return
+	}
+	var req struct {
+		Path string `json:"path"`
+		Diff string `json:"diff"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.respondError(w, r, http.StatusBadRequest, "invalid payload")
+		return
+	}
+	if strings.TrimSpace(req.Diff) == "" {
+		s.respondError(w, r, http.StatusBadRequest, "diff is required")
+		return
+	}
+	rel, err := s.editorPath(workspace, req.Path)
+	if err != nil {
+		s.respondError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	cmd := s.editor.enqueue(workspace, editorCommand{
+		Type: "apply_diff",
+		Path: rel,
+		Diff: req.Diff,
+	})
+	s.writeJSON(w, r, cmd)
+}
+
+// handleEditorCommands is polled by the editor extension; it returns and
+// clears the pending command queue for the workspace.
+func (s *webServer) handleEditorCommands(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.respondError(w, r, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	workspace, ok := s.editorWorkspace(w, r)
+	if !ok {
+		return
+	}
+	s.writeJSON(w, r, map[string]any{
+		"workspace": workspace,
+		"commands":  s.editor.drain(workspace),
+	})
+}
@@ -0,0 +1,117 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"cando/internal/config"
+	"cando/internal/state"
+)
+
+func TestEditorBridgeHandlers(t *testing.T) {
+	configDir := t.TempDir()
+	t.Setenv("CANDO_CONFIG_DIR", configDir)
+	workspace := t.TempDir()
+	manager := &WorkspaceManager{filePath: filepath.Join(configDir, "workspaces.json")}
+	if _, err := manager.Add(workspace); err != nil {
+		t.Fatal(err)
+	}
+	s := &webServer{
+		agent:            &Agent{cfg: newRuntimeConfig(config.Config{})},
+		logger:           log.New(io.Discard, "", 0),
+		workspaceManager: manager,
+		editor:           newEditorBridge(),
+	}
+	os.MkdirAll(filepath.Join(workspace, "src"), 0o755)
+	os.WriteFile(filepath.Join(workspace, "src", "main.go"), []byte("package main\n"), 0o644)
+	outside := t.TempDir()
+	os.WriteFile(filepath.Join(outside, "secret.txt"), []byte("secret"), 0o644)
+	if err := os.Symlink(outside, filepath.Join(workspace, "escape")); err != nil {
+		t.Skipf("symlinks unavailable: %v", err)
+	}
+
+	call := func(handler http.HandlerFunc, method, path, body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path+"?"+url.Values{"workspace": {workspace}}.Encode(), strings.NewReader(body))
+		handler(rec, req)
+		return rec
+	}
+
+	rec := call(s.handleEditorSelection, http.MethodPost, "/api/editor/selection",
+		`{"path":"`+filepath.Join(workspace, "src", "main.go")+`","start_line":1,"end_line":1,"text":"package main","language":"go"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("push selection = %d %s", rec.Code, rec.Body.String())
+	}
+	var got struct {
+		Selection *editorSelection `json:"selection"`
+	}
+	rec = call(s.handleEditorSelection, http.MethodGet, "/api/editor/selection", "")
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil || got.Selection == nil || got.Selection.Path != "src/main.go" {
+		t.Fatalf("get selection = %s (%v)", rec.Body.String(), err)
+	}
+
+	// Paths outside the workspace are refused, also through a symlink
+	for _, path := range []string{"../etc/passwd", "escape/secret.txt", filepath.Join(workspace, "escape", "secret.txt")} {
+		body, _ := json.Marshal(map[string]any{"path": path})
+		if rec := call(s.handleEditorSelection, http.MethodPost, "/api/editor/selection", string(body)); rec.Code != http.StatusBadRequest {
+			t.Errorf("selection %s = %d, want 400", path, rec.Code)
+		}
+		body, _ = json.Marshal(map[string]any{"path": path, "diff": "@@ -1 +1 @@\n-a\n+b\n"})
+		if rec := call(s.handleEditorDiff, http.MethodPost, "/api/editor/diff", string(body)); rec.Code != http.StatusBadRequest {
+			t.Errorf("diff %s = %d, want 400", path, rec.Code)
+		}
+	}
+
+	// The selection is added to the system message of turns in the workspace
+	root, _ := filepath.Abs(workspace)
+	ctx := s.withEditorSelection(context.Background(), root)
+	messages := injectEditorSelection([]state.Message{{Role: "system", Content: "base"}, {Role: "user", Content: "fix this"}}, editorSelectionFrom(ctx))
+	if system := messages[0].Content; !strings.Contains(system, "src/main.go") || !strings.Contains(system, "```go\npackage main\n```") {
+		t.Errorf("system message = %q", system)
+	}
+
+	// Commands queue until the editor polls; the poll marks it connected
+	if s.editor.connected(root, time.Now()) {
+		t.Fatal("editor connected before its first poll")
+	}
+	if rec := call(s.handleEditorOpen, http.MethodPost, "/api/editor/open", `{"path":"src/main.go","line":3}`); rec.Code != http.StatusOK {
+		t.Fatalf("open = %d %s", rec.Code, rec.Body.String())
+	}
+	if rec := call(s.handleEditorDiff, http.MethodPost, "/api/editor/diff", `{"path":"src/main.go"}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("diff without a diff = %d, want 400", rec.Code)
+	}
+	var polled struct {
+		Commands []editorCommand `json:"commands"`
+	}
+	rec = call(s.handleEditorCommands, http.MethodGet, "/api/editor/commands", "")
+	if err := json.Unmarshal(rec.Body.Bytes(), &polled); err != nil || len(polled.Commands) != 1 || polled.Commands[0].Type != "open_file" || polled.Commands[0].Line != 3 {
+		t.Fatalf("commands = %s (%v)", rec.Body.String(), err)
+	}
+	if !s.editor.connected(root, time.Now()) {
+		t.Error("editor not connected after polling")
+	}
+	rec = call(s.handleEditorCommands, http.MethodGet, "/api/editor/commands", "")
+	if err := json.Unmarshal(rec.Body.Bytes(), &polled); err != nil || len(polled.Commands) != 0 {
+		t.Errorf("commands after drain = %s", rec.Body.String())
+	}
+
+	if rec := call(s.handleEditorSelection, http.MethodDelete, "/api/editor/selection", ""); rec.Code != http.StatusOK {
+		t.Fatalf("clear = %d", rec.Code)
+	}
+	if s.editor.selection(root) != nil {
+		t.Error("selection kept after DELETE")
+	}
+	if ctx := s.withEditorSelection(context.Background(), root); editorSelectionFrom(ctx) != nil {
+		t.Error("cleared selection still added to turns")
+	}
+}
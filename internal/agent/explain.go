@@ -0,0 +1,253 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"cando/internal/llm"
+	"cando/internal/prompts"
+	"cando/internal/repomap"
+	"cando/internal/state"
+	"cando/internal/tooling"
+)
+
+const (
+	// overviewFile holds the onboarding overview in the project storage root.
+	overviewFile = "overview.md"
+	// explainMaxRounds bounds the exploration; the last round must answer.
+	explainMaxRounds     = 12
+	explainRepoMapTokens = 2048
+	// explainMaxResultChars caps each tool result the explorer sees.
+	explainMaxResultChars = 12000
+)
+
+// explainTools are the read-only tools the explorer may call.
+var explainTools = map[string]bool{
+	"read_file": true, "list_directory": true, "glob": true, "grep": true,
+	"repo_map": true, "git_log": true,
+}
+
+const explainWrapUpHint = "You are out of exploration rounds. Write the overview now from what you have learned, without tool calls."
+
+// projectOverview is the stored onboarding overview, served by /api/overview.
+type projectOverview struct {
+	Markdown  string    `json:"markdown"`
+	Generated time.Time `json:"generated"`
+}
+
+// explainWorkspace explores root with read-only tools for a bounded number
+// of rounds and saves the resulting overview document. It runs outside the
+// conversation, so the session's history is left alone.
+func (a *Agent) explainWorkspace(ctx context.Context, root string, tools *tooling.Registry, progress func(string)) (string, error) {
+	if progress == nil {
+		progress = func(string) {}
+	}
+	if a.client == nil {
+		return "", errors.New("no provider configured")
+	}
+	if root == "" {
+		return "", errors.New("explain needs a workspace")
+	}
+
+	var definitions []tooling.ToolDefinition
+	for _, def := range tools.Definitions() {
+		if explainTools[def.Function.Name] {
+			definitions = append(definitions, def)
+		}
+	}
+	messages := []state.Message{
+		{Role: "system", Content: prompts.Explain()},
+		{Role: "user", Content: explainSeed(root)},
+	}
+
+	progress("Exploring the repository...")
+	for round := 1; round <= explainMaxRounds; round++ {
+		last := round == explainMaxRounds
+		req := llm.ChatRequest{Model: a.getActiveModel(), Messages: messages, Temperature: 0.2}
+		if last {
+			req.Messages = append(messages, state.Message{Role: "user", Content: explainWrapUpHint})
+		} else {
+			req.Tools = definitions
+		}
+		a.applyModelCapabilities(&req)
+		resp, err := a.client.Chat(ctx, req)
+		if err != nil {
+			return "", fmt.Errorf("explain: %w", err)
+		}
+		if err := llm.ValidateResponse(a.ActiveProviderKey(), resp); err != nil {
+			return "", fmt.Errorf("explain: %w", err)
+		}
+		msg := resp.Choices[0].Message
+		if len(msg.ToolCalls) == 0 || last {
+			overview := strings.TrimSpace(msg.Content)
+			if overview == "" {
+				return "", errors.New("explain: the model returned an empty overview")
+			}
+			if err := saveOverview(root, overview); err != nil {
+				return "", fmt.Errorf("save overview: %w", err)
+			}
+			return overview, nil
+		}
+
+		messages = append(messages, state.Message{Role: "assistant", Content: msg.Content, ToolCalls: msg.ToolCalls})
+		for _, call := range msg.ToolCalls {
+			result := a.explainToolCall(ctx, root, tools, call, round, progress)
+			messages = append(messages, state.Message{Role: "tool", Name: call.Function.Name, Content: result, ToolCallID: call.ID})
+		}
+	}
+	return "", errors.New("explain: no overview after the last round")
+}
+
+// explainToolCall runs one exploration call and returns its result for the
+// model. Refusals and failures are results too, so the model can go on.
+func (a *Agent) explainToolCall(ctx context.Context, root string, tools *tooling.Registry, call state.ToolCall, round int, progress func(string)) string {
+	name := call.Function.Name
+	if !explainTools[name] {
+		return fmt.Sprintf("Tool '%s' is not available while exploring; only read-only tools are.", name)
+	}
+	tool, ok := tools.Lookup(name)
+	if !ok {
+		return fmt.Sprintf("tool %s not registered", name)
+	}
+	args := map[string]any{}
+	if call.Function.Arguments != "" {
+		if err := json.Unmarshal([]byte(call.Function.Arguments), &args); err != nil {
+			return fmt.Sprintf("invalid args for %s: %v", name, err)
+		}
+	}
+	summary := tooling.SummarizeCall(name, args)
+	progress(fmt.Sprintf("Exploring (%d/%d): %s", round, explainMaxRounds, summary))
+	permission := a.cfg.Load().ToolPermissionFor(root, name)
+	if err := tooling.Authorize(ctx, permission, tooling.ApprovalRequest{ID: call.ID, Tool: name, Arguments: args, Summary: summary}); err != nil {
+		return fmt.Sprintf("Tool '%s' was not run: %v", name, err)
+	}
+	result, err := tool.Call(ctx, args)
+	if err != nil {
+		return fmt.Sprintf("tool error: %v", err)
+	}
+	if len(result) > explainMaxResultChars {
+		result = result[:explainMaxResultChars] + "\n\n[TRUNCATED: read a narrower range for the rest]"
+	}
+	return result
+}
+
+// explainSeed is the explorer's first message: what is known about the
+// workspace without any tool calls.
+func explainSeed(root string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Explain the repository in %s.\n", filepath.Base(root))
+	if profile := loadProjectProfile(root); profile != "" {
+		fmt.Fprintf(&b, "\nProject profile:\n%s\n", profile)
+	}
+	m := repomap.ForRoot(root)
+	if err := m.Refresh(); err == nil {
+		if rendered := m.Render(repomap.Options{MaxTokens: explainRepoMapTokens}); rendered != "" {
+			fmt.Fprintf(&b, "\nRepository map:\n%s\n", rendered)
+		}
+	}
+	return b.String()
+}
+
+func overviewPath(workspaceRoot string) (string, error) {
+	storageRoot, err := ProjectStorageRoot(workspaceRoot)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(storageRoot, overviewFile), nil
+}
+
+func saveOverview(workspaceRoot, markdown string) error {
+	path, err := overviewPath(workspaceRoot)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, []byte(markdown+"\n"), 0o644)
+}
+
+// loadOverview returns the stored overview, or nil when the workspace has
+// not been explained yet.
+func loadOverview(workspaceRoot string) (*projectOverview, error) {
+	path, err := overviewPath(workspaceRoot)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	return &projectOverview{Markdown: strings.TrimSpace(string(data)), Generated: info.ModTime().UTC()}, nil
+}
+
+// ExplainWorkspace writes the onboarding overview for the agent's workspace
+// and returns it with the path it was saved to. Used by `cando explain`.
+func (a *Agent) ExplainWorkspace(ctx context.Context, progress func(string)) (string, string, error) {
+	overview, err := a.explainWorkspace(ctx, a.workspaceRoot, a.tools, progress)
+	if err != nil {
+		return "", "", err
+	}
+	path, err := overviewPath(a.workspaceRoot)
+	return overview, path, err
+}
+
+// handleExplainCommand runs :explain for the web UI, streaming progress as
+// status events and sending the overview as the reply.
+func (s *webServer) handleExplainCommand(ctx context.Context, wsCtx *WorkspaceContext, sendEvent func(string, any) error) error {
+	progress := func(message string) {
+		sendEvent("status", map[string]any{"message": message})
+	}
+	overview, err := s.agent.explainWorkspace(ctx, wsCtx.root, wsCtx.tools, progress)
+	if err != nil {
+		return err
+	}
+	sendEvent("assistant_message", map[string]any{
+		"content": overview,
+		"role":    "assistant",
+	})
+	return nil
+}
+
+// handleOverview serves GET /api/overview: the workspace's onboarding
+// overview, or 404 before :explain has run.
+func (s *webServer) handleOverview(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.respondError(w, r, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	workspace := s.getWorkspaceFromRequest(r)
+	if workspace == "" || !s.workspaceExists(workspace) {
+		s.respondError(w, r, http.StatusBadRequest, "select a workspace first")
+		return
+	}
+	wsCtx, err := s.agent.GetOrCreateWorkspaceContext(workspace)
+	if err != nil {
+		s.respondError(w, r, http.StatusInternalServerError, fmt.Sprintf("get workspace context: %v", err))
+		return
+	}
+	overview, err := loadOverview(wsCtx.root)
+	if err != nil {
+		s.respondError(w, r, http.StatusInternalServerError, fmt.Sprintf("read overview: %v", err))
+		return
+	}
+	if overview == nil {
+		s.respondError(w, r, http.StatusNotFound, "this workspace has not been explained yet; run :explain")
+		return
+	}
+	s.writeJSON(w, r, overview)
+}
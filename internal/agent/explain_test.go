@@ -0,0 +1,90 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"cando/internal/llm"
+	"cando/internal/state"
+)
+
+func TestExplainWorkspace(t *testing.T) {
+	configDir := t.TempDir()
+	t.Setenv("CANDO_CONFIG_DIR", configDir)
+	workspace := t.TempDir()
+	if err := os.WriteFile(filepath.Join(workspace, "README.md"), []byte("# Demo\nRun make test.\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	explore := llm.ChatResponse{Choices: []llm.ChatChoice{{
+		Message: state.Message{Role: "assistant", ToolCalls: []state.ToolCall{
+			{ID: "call-1", Type: "function", Function: state.FunctionCall{Name: "read_file", Arguments: `{"path":"README.md"}`}},
+			{ID: "call-2", Type: "function", Function: state.FunctionCall{Name: "write_file", Arguments: `{"path":"README.md","content":"x"}`}},
+		}},
+		FinishReason: "tool_calls",
+	}}}
+	var requests []llm.ChatRequest
+	client := newScriptedClient()
+	client.responder = func(req llm.ChatRequest) llm.ChatResponse {
+		requests = append(requests, req)
+		if len(requests) == 1 {
+			return explore
+		}
+		return llm.ChatResponse{Choices: []llm.ChatChoice{{Message: state.Message{Role: "assistant", Content: "# Demo\n\n## Build and test\n`make test` (README.md)"}, FinishReason: "stop"}}}
+	}
+	agent := newTestAgent(t, client, baseTestConfig(workspace))
+
+	var progress []string
+	overview, path, err := agent.ExplainWorkspace(context.Background(), func(message string) {
+		progress = append(progress, message)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(overview, "make test") || len(requests) != 2 {
+		t.Fatalf("overview %q after %d requests", overview, len(requests))
+	}
+	for _, def := range requests[0].Tools {
+		if !explainTools[def.Function.Name] {
+			t.Errorf("explorer was offered %s", def.Function.Name)
+		}
+	}
+	// The read ran; the write was refused and left the file alone
+	results := requests[1].Messages[len(requests[1].Messages)-2:]
+	if !strings.Contains(results[0].Content, "Run make test") || !strings.Contains(results[1].Content, "not available") {
+		t.Errorf("tool results = %+v", results)
+	}
+	if data, _ := os.ReadFile(filepath.Join(workspace, "README.md")); string(data) != "# Demo\nRun make test.\n" {
+		t.Errorf("README changed: %q", data)
+	}
+	if len(progress) < 2 {
+		t.Errorf("progress = %q", progress)
+	}
+	if len(agent.states.Current().Messages()) > 1 {
+		t.Error("explain wrote to the conversation")
+	}
+
+	saved, err := os.ReadFile(path)
+	if err != nil || strings.TrimSpace(string(saved)) != overview {
+		t.Fatalf("saved overview %q, %v", saved, err)
+	}
+	manager := &WorkspaceManager{filePath: filepath.Join(configDir, "workspaces.json")}
+	if _, err := manager.Add(workspace); err != nil {
+		t.Fatal(err)
+	}
+	s := &webServer{agent: agent, logger: log.New(io.Discard, "", 0), workspaceManager: manager}
+	rec := httptest.NewRecorder()
+	s.handleOverview(rec, httptest.NewRequest(http.MethodGet, "/api/overview?workspace="+workspace, nil))
+	var got projectOverview
+	if rec.Code != http.StatusOK || json.Unmarshal(rec.Body.Bytes(), &got) != nil || got.Markdown != overview {
+		t.Errorf("overview = %d %s", rec.Code, rec.Body.String())
+	}
+}
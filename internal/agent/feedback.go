@@ -0,0 +1,344 @@
+package agent
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"cando/internal/safefile"
+	"cando/internal/state"
+)
+
+const (
+	feedbackFile = "feedback.jsonl"
+	// feedbackExcerptChars caps each message in a stored transcript excerpt.
+	feedbackExcerptChars = 4000
+	// feedbackCommentChars caps the free-text comment.
+	feedbackCommentChars = 2000
+)
+
+// Feedback ratings.
+const (
+	feedbackUp   = "up"
+	feedbackDown = "down"
+)
+
+// feedbackMu serializes access to workspace feedback files.
+var feedbackMu sync.Mutex
+
+// feedbackEntry is one rating of an assistant turn, kept in the workspace's
+// feedback.jsonl. Nothing is sent anywhere; teams export the file to mine
+// failure cases.
+type feedbackEntry struct {
+	Time    time.Time         `json:"time"`
+	Session string            `json:"session"`
+	TurnID  string            `json:"turn_id"`
+	Rating  string            `json:"rating"` // up | down
+	Comment string            `json:"comment,omitempty"`
+	Prompt  string            `json:"prompt,omitempty"`  // First line of the turn's prompt
+	Excerpt []feedbackMessage `json:"excerpt,omitempty"` // Redacted turn transcript, when the user chose to include it
+}
+
+// feedbackMessage is one message of a feedback transcript excerpt.
+type feedbackMessage struct {
+	Role    string   `json:"role"`
+	Content string   `json:"content,omitempty"`
+	Tools   []string `json:"tools,omitempty"` // Names of the tools the message called
+}
+
+func feedbackPath(workspaceRoot string) (string, error) {
+	storageRoot, err := ProjectStorageRoot(workspaceRoot)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(storageRoot, feedbackFile), nil
+}
+
+// readFeedbackLocked returns the workspace's feedback, oldest first.
+func readFeedbackLocked(path string) ([]feedbackEntry, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var entries []feedbackEntry
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64*1024), 8*1024*1024)
+	for scanner.Scan() {
+		var entry feedbackEntry
+		if json.Unmarshal(scanner.Bytes(), &entry) == nil {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, scanner.Err()
+}
+
+func writeFeedbackLocked(path string, entries []feedbackEntry) error {
+	var buf bytes.Buffer
+	for _, entry := range entries {
+		data, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		buf.Write(data)
+		buf.WriteByte('\n')
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	return safefile.Write(path, buf.Bytes(), 0o644)
+}
+
+// updateFeedback applies change to the workspace's feedback and saves it.
+func updateFeedback(workspaceRoot string, change func([]feedbackEntry) []feedbackEntry) error {
+	path, err := feedbackPath(workspaceRoot)
+	if err != nil {
+		return err
+	}
+	feedbackMu.Lock()
+	defer feedbackMu.Unlock()
+	entries, err := readFeedbackLocked(path)
+	if err != nil {
+		return err
+	}
+	return writeFeedbackLocked(path, change(entries))
+}
+
+// loadFeedback returns the workspace's feedback, oldest first.
+func loadFeedback(workspaceRoot string) ([]feedbackEntry, error) {
+	path, err := feedbackPath(workspaceRoot)
+	if err != nil {
+		return nil, err
+	}
+	feedbackMu.Lock()
+	defer feedbackMu.Unlock()
+	return readFeedbackLocked(path)
+}
+
+// sessionFeedback maps the session's rated turn IDs to their ratings, for
+// the session payload.
+func sessionFeedback(workspaceRoot, session string) map[string]string {
+	entries, err := loadFeedback(workspaceRoot)
+	if err != nil {
+		return nil
+	}
+	var ratings map[string]string
+	for _, entry := range entries {
+		if entry.Session != session {
+			continue
+		}
+		if ratings == nil {
+			ratings = make(map[string]string)
+		}
+		ratings[entry.TurnID] = entry.Rating
+	}
+	return ratings
+}
+
+// turnMessages returns the messages of a turn, or nil when the turn has no
+// assistant reply in them.
+func turnMessages(messages []state.Message, turnID string) []state.Message {
+	var turn []state.Message
+	answered := false
+	for _, msg := range messages {
+		if msg.TurnID != turnID {
+			continue
+		}
+		turn = append(turn, msg)
+		answered = answered || msg.Role == "assistant"
+	}
+	if !answered {
+		return nil
+	}
+	return turn
+}
+
+// feedbackExcerpt builds a transcript excerpt of a turn with secrets and
+// reasoning removed and long contents truncated.
+func feedbackExcerpt(turn []state.Message, redact func([]byte) []byte) []feedbackMessage {
+	excerpt := make([]feedbackMessage, 0, len(turn))
+	for _, msg := range turn {
+		content := string(redact([]byte(msg.Content)))
+		if len(content) > feedbackExcerptChars {
+			content = content[:feedbackExcerptChars] + "…"
+		}
+		entry := feedbackMessage{Role: msg.Role, Content: content}
+		for _, call := range msg.ToolCalls {
+			entry.Tools = append(entry.Tools, call.Function.Name)
+		}
+		if msg.Role == "tool" && msg.Name != "" {
+			entry.Tools = []string{msg.Name}
+		}
+		excerpt = append(excerpt, entry)
+	}
+	return excerpt
+}
+
+// handleFeedback records, lists and removes ratings of assistant turns.
+//
+//	POST   {"session", "turn_id", "rating": "up"|"down", "comment", "include_transcript"}
+//	GET    ?rating=down lists the workspace's feedback, newest first
+//	DELETE ?session=&turn_id= removes a rating
+//
+// session defaults to the current one. Rating a turn again replaces the
+// earlier rating.
+func (s *webServer) handleFeedback(w http.ResponseWriter, r *http.Request) {
+	workspace := s.getWorkspaceFromRequest(r)
+	if workspace == "" || !s.workspaceExists(workspace) {
+		s.respondError(w, r, http.StatusBadRequest, "select a workspace first")
+		return
+	}
+	wsCtx, err := s.agent.GetOrCreateWorkspaceContext(workspace)
+	if err != nil {
+		s.respondError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		entries, err := loadFeedback(wsCtx.root)
+		if err != nil {
+			s.respondError(w, r, http.StatusInternalServerError, err.Error())
+			return
+		}
+		rating := r.URL.Query().Get("rating")
+		list := make([]feedbackEntry, 0, len(entries))
+		for i := len(entries) - 1; i >= 0; i-- {
+			if rating == "" || entries[i].Rating == rating {
+				list = append(list, entries[i])
+			}
+		}
+		s.writeJSON(w, r, map[string]any{"feedback": list})
+
+	case http.MethodPost:
+		var req struct {
+			Session           string `json:"session"`
+			TurnID            string `json:"turn_id"`
+			Rating            string `json:"rating"`
+			Comment           string `json:"comment"`
+			IncludeTranscript bool   `json:"include_transcript"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			s.respondError(w, r, http.StatusBadRequest, "invalid payload")
+			return
+		}
+		if req.Rating != feedbackUp && req.Rating != feedbackDown {
+			s.respondError(w, r, http.StatusBadRequest, `rating must be "up" or "down"`)
+			return
+		}
+		conv, ok := s.sessionOrCurrent(wsCtx, req.Session)
+		if !ok {
+			s.respondError(w, r, http.StatusNotFound, "session not found")
+			return
+		}
+		turn := turnMessages(conv.Messages(), req.TurnID)
+		if req.TurnID == "" || turn == nil {
+			s.respondError(w, r, http.StatusNotFound, "no assistant reply for that turn in the session")
+			return
+		}
+
+		entry := feedbackEntry{
+			Time:    time.Now(),
+			Session: conv.Key(),
+			TurnID:  req.TurnID,
+			Rating:  req.Rating,
+			Comment: strings.TrimSpace(req.Comment),
+		}
+		if len(entry.Comment) > feedbackCommentChars {
+			entry.Comment = entry.Comment[:feedbackCommentChars] + "…"
+		}
+		if turn[0].Role == "user" {
+			entry.Prompt = truncatePrompt(turn[0].Content)
+		}
+		if req.IncludeTranscript {
+			var secrets []string
+			if s.agent.credManager != nil {
+				if creds, err := s.agent.credManager.Load(); err == nil {
+					secrets = CredentialSecrets(creds)
+				}
+			}
+			entry.Excerpt = feedbackExcerpt(turn, newRedactor(secrets))
+		}
+		err := updateFeedback(wsCtx.root, func(entries []feedbackEntry) []feedbackEntry {
+			entries = removeFeedback(entries, entry.Session, entry.TurnID)
+			return append(entries, entry)
+		})
+		if err != nil {
+			s.respondError(w, r, http.StatusInternalServerError, err.Error())
+			return
+		}
+		s.writeJSON(w, r, map[string]any{"feedback": entry})
+
+	case http.MethodDelete:
+		conv, ok := s.sessionOrCurrent(wsCtx, r.URL.Query().Get("session"))
+		if !ok {
+			s.respondError(w, r, http.StatusNotFound, "session not found")
+			return
+		}
+		turnID := r.URL.Query().Get("turn_id")
+		err := updateFeedback(wsCtx.root, func(entries []feedbackEntry) []feedbackEntry {
+			return removeFeedback(entries, conv.Key(), turnID)
+		})
+		if err != nil {
+			s.respondError(w, r, http.StatusInternalServerError, err.Error())
+			return
+		}
+		s.writeJSON(w, r, map[string]string{"status": "removed"})
+
+	default:
+		s.respondError(w, r, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+// handleFeedbackExport downloads the workspace's feedback as JSON Lines.
+func (s *webServer) handleFeedbackExport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.respondError(w, r, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	workspace := s.getWorkspaceFromRequest(r)
+	if workspace == "" || !s.workspaceExists(workspace) {
+		s.respondError(w, r, http.StatusBadRequest, "select a workspace first")
+		return
+	}
+	entries, err := loadFeedback(workspace)
+	if err != nil {
+		s.respondError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", "cando-feedback-"+filepath.Base(workspace)+".jsonl"))
+	enc := json.NewEncoder(w)
+	for _, entry := range entries {
+		if err := enc.Encode(entry); err != nil {
+			return
+		}
+	}
+}
+
+// sessionOrCurrent returns the named session, or the current one for "".
+func (s *webServer) sessionOrCurrent(wsCtx *WorkspaceContext, key string) (*state.Conversation, bool) {
+	if key == "" {
+		return wsCtx.states.Current(), true
+	}
+	return wsCtx.states.Get(key)
+}
+
+func removeFeedback(entries []feedbackEntry, session, turnID string) []feedbackEntry {
+	kept := entries[:0]
+	for _, entry := range entries {
+		if entry.Session != session || entry.TurnID != turnID {
+			kept = append(kept, entry)
+		}
+	}
+	return kept
+}
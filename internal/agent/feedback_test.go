@@ -0,0 +1,90 @@
+package agent
+
+import (
+	"strings"
+	"testing"
+
+	"cando/internal/state"
+)
+
+func TestFeedbackUpsertAndRemove(t *testing.T) {
+	t.Setenv("CANDO_CONFIG_DIR", t.TempDir())
+	workspace := t.TempDir()
+
+	rate := func(session, turnID, rating string) {
+		t.Helper()
+		err := updateFeedback(workspace, func(entries []feedbackEntry) []feedbackEntry {
+			entries = removeFeedback(entries, session, turnID)
+			return append(entries, feedbackEntry{Session: session, TurnID: turnID, Rating: rating})
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	rate("main", "t1", feedbackUp)
+	rate("main", "t2", feedbackDown)
+	rate("other", "t1", feedbackDown)
+	rate("main", "t1", feedbackDown) // Re-rating replaces the earlier entry
+
+	entries, err := loadFeedback(workspace)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 3 {
+		t.Fatalf("entries = %+v", entries)
+	}
+	got := sessionFeedback(workspace, "main")
+	if len(got) != 2 || got["t1"] != feedbackDown || got["t2"] != feedbackDown {
+		t.Errorf("main ratings = %v", got)
+	}
+
+	err = updateFeedback(workspace, func(entries []feedbackEntry) []feedbackEntry {
+		return removeFeedback(entries, "main", "t1")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := sessionFeedback(workspace, "main"); len(got) != 1 || got["t2"] != feedbackDown {
+		t.Errorf("after removal = %v", got)
+	}
+	if got := sessionFeedback(workspace, "other"); got["t1"] != feedbackDown {
+		t.Errorf("other session lost its rating: %v", got)
+	}
+}
+
+func TestFeedbackExcerpt(t *testing.T) {
+	messages := []state.Message{
+		{Role: "user", Content: "earlier", TurnID: "t0"},
+		{Role: "assistant", Content: "earlier reply", TurnID: "t0"},
+		{Role: "user", Content: "deploy it", TurnID: "t1"},
+		{Role: "assistant", Thinking: "private", TurnID: "t1", ToolCalls: []state.ToolCall{
+			{ID: "c1", Function: state.FunctionCall{Name: "shell"}},
+		}},
+		{Role: "tool", Name: "shell", Content: "token sk-abcdefghijklmnopqrstuvwx " + strings.Repeat("x", feedbackExcerptChars), TurnID: "t1"},
+		{Role: "assistant", Content: "Done.", TurnID: "t1"},
+		{Role: "user", Content: "unanswered", TurnID: "t2"},
+	}
+
+	if turn := turnMessages(messages, "t2"); turn != nil {
+		t.Errorf("turn without a reply = %+v", turn)
+	}
+	turn := turnMessages(messages, "t1")
+	if len(turn) != 4 {
+		t.Fatalf("turn = %+v", turn)
+	}
+
+	excerpt := feedbackExcerpt(turn, newRedactor(nil))
+	if len(excerpt) != 4 || excerpt[0].Content != "deploy it" || excerpt[3].Content != "Done." {
+		t.Fatalf("excerpt = %+v", excerpt)
+	}
+	if len(excerpt[1].Tools) != 1 || excerpt[1].Tools[0] != "shell" || excerpt[1].Content != "" {
+		t.Errorf("tool call message = %+v", excerpt[1])
+	}
+	tool := excerpt[2].Content
+	if strings.Contains(tool, "sk-abcdefghijklmnopqrstuvwx") {
+		t.Error("secret not redacted")
+	}
+	if len(tool) > feedbackExcerptChars+len("…") {
+		t.Errorf("tool output not truncated: %d bytes", len(tool))
+	}
+}
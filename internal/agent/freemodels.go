@@ -0,0 +1,139 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+)
+
+// freeModelCooldown is how long a rate-limited free model is skipped when
+// OpenRouter does not say when its limit resets.
+const freeModelCooldown = 10 * time.Minute
+
+// freeModelPreferences lists preferred free text models, best first. Mirrors
+// free-model-prefs.json; other free models follow in weekly-popularity order.
+var freeModelPreferences = []string{
+	"deepseek/deepseek-chat-v3-0324:free",
+	"qwen/qwen3-coder:free",
+	"z-ai/glm-4.5-air:free",
+	"x-ai/grok-4.1-fast:free",
+}
+
+// freeModelPool returns the free text models in the OpenRouter models cache,
+// preferred models first.
+func freeModelPool(modelsJSON []byte) []string {
+	var models []struct {
+		ID string `json:"id"`
+	}
+	if err := json.Unmarshal(modelsJSON, &models); err != nil {
+		return nil
+	}
+	available := make(map[string]bool)
+	var ordered []string
+	for _, m := range models {
+		if strings.HasSuffix(m.ID, ":free") && !available[m.ID] {
+			available[m.ID] = true
+			ordered = append(ordered, m.ID)
+		}
+	}
+	pool := make([]string, 0, len(ordered))
+	for _, id := range freeModelPreferences {
+		if available[id] {
+			pool = append(pool, id)
+			delete(available, id)
+		}
+	}
+	for _, id := range ordered {
+		if available[id] {
+			pool = append(pool, id)
+		}
+	}
+	return pool
+}
+
+// freeModelRotator picks the free model for each request in OpenRouter free
+// mode and skips models that were recently rate-limited.
+type freeModelRotator struct {
+	mu       sync.Mutex
+	limited  map[string]time.Time // model -> skip until
+	selected string               // Last model rotated to
+}
+
+// pick returns the model to use: the configured model while it is free and
+// not rate-limited, otherwise the last rotation target or the first usable
+// model in the pool.
+func (r *freeModelRotator) pick(configured string, pool []string, now time.Time) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, candidate := range []string{configured, r.selected} {
+		if strings.HasSuffix(candidate, ":free") && !r.isLimited(candidate, now) {
+			return candidate
+		}
+	}
+	for _, candidate := range pool {
+		if !r.isLimited(candidate, now) {
+			return candidate
+		}
+	}
+	return ""
+}
+
+// rotate marks model rate-limited until the given time and returns the next
+// usable model from the pool, or "" when every free model is limited.
+func (r *freeModelRotator) rotate(model string, until time.Time, pool []string, now time.Time) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.limited == nil {
+		r.limited = make(map[string]time.Time)
+	}
+	r.limited[model] = until
+	for _, candidate := range pool {
+		if candidate != model && !r.isLimited(candidate, now) {
+			r.selected = candidate
+			return candidate
+		}
+	}
+	return ""
+}
+
+func (r *freeModelRotator) isLimited(model string, now time.Time) bool {
+	until, ok := r.limited[model]
+	if !ok {
+		return false
+	}
+	if now.After(until) {
+		delete(r.limited, model)
+		return false
+	}
+	return true
+}
+
+// freeModeActive reports whether requests should be routed to free models.
+func (a *Agent) freeModeActive() bool {
+	return a.cfg.Load().OpenRouterFreeMode && a.ActiveProviderKey() == "openrouter"
+}
+
+// configuredModel is the model selected for the active provider.
+func (a *Agent) configuredModel() string {
+	if a.providerCtrl != nil {
+		if model := a.providerCtrl.ActiveProvider().Model; model != "" {
+			return model
+		}
+	}
+	return a.cfg.Load().Model
+}
+
+type modelOverrideKey struct{}
+
+// withModelOverride makes the provider client send req to model instead of
+// the active provider's configured model.
+func withModelOverride(ctx context.Context, model string) context.Context {
+	return context.WithValue(ctx, modelOverrideKey{}, model)
+}
+
+func modelOverride(ctx context.Context) string {
+	model, _ := ctx.Value(modelOverrideKey{}).(string)
+	return model
+}
@@ -0,0 +1,80 @@
+package agent
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"cando/internal/llm"
+	"cando/internal/state"
+)
+
+// rateLimitedClient fails requests for limited models with a 429.
+type rateLimitedClient struct {
+	mu      sync.Mutex
+	limited map[string]bool
+	models  []string
+}
+
+func (c *rateLimitedClient) Chat(_ context.Context, req llm.ChatRequest) (llm.ChatResponse, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.models = append(c.models, req.Model)
+	if c.limited[req.Model] {
+		pe := llm.NewProviderError("openrouter", llm.ErrorTypeRateLimit, "429", "rate limited")
+		pe.Retryable = true
+		return llm.ChatResponse{}, pe
+	}
+	return llm.ChatResponse{Choices: []llm.ChatChoice{{Message: state.Message{Role: "assistant", Content: "ok"}}}}, nil
+}
+
+func TestFreeModeRotatesOnRateLimit(t *testing.T) {
+	orModelCache.mu.Lock()
+	saved, savedAt := orModelCache.data, orModelCache.fetchedAt
+	orModelCache.data = []byte(`[{"id":"paid/model"},{"id":"other/model:free"},{"id":"qwen/qwen3-coder:free"}]`)
+	orModelCache.fetchedAt = time.Now()
+	orModelCache.mu.Unlock()
+	t.Cleanup(func() {
+		orModelCache.mu.Lock()
+		orModelCache.data, orModelCache.fetchedAt = saved, savedAt
+		orModelCache.mu.Unlock()
+	})
+
+	inner := &rateLimitedClient{limited: map[string]bool{"qwen/qwen3-coder:free": true}}
+	client, err := NewMultiProviderClient("openrouter", []ProviderRegistration{
+		{Option: ProviderOption{Key: "openrouter", Model: "paid/model"}, Client: inner},
+	})
+	if err != nil {
+		t.Fatalf("new client: %v", err)
+	}
+	workspace := t.TempDir()
+	cfg := baseTestConfig(workspace)
+	cfg.OpenRouterFreeMode = true
+	agent := newTestAgent(t, client, cfg)
+
+	var switches []map[string]any
+	callback := func(event string, data any) error {
+		if event == "model_switch" {
+			switches = append(switches, data.(map[string]any))
+		}
+		return nil
+	}
+	if _, err := agent.callProviderWithRetry(context.Background(), llm.ChatRequest{}, callback, deltasOff); err != nil {
+		t.Fatalf("call failed: %v", err)
+	}
+	if len(inner.models) != 2 || inner.models[0] != "qwen/qwen3-coder:free" || inner.models[1] != "other/model:free" {
+		t.Fatalf("unexpected models requested: %v", inner.models)
+	}
+	if len(switches) != 1 || switches[0]["to"] != "other/model:free" {
+		t.Fatalf("expected one model_switch event, got %v", switches)
+	}
+
+	// The limited model stays skipped for later requests
+	if _, err := agent.callProviderWithRetry(context.Background(), llm.ChatRequest{}, callback, deltasOff); err != nil {
+		t.Fatalf("second call failed: %v", err)
+	}
+	if got := inner.models[len(inner.models)-1]; got != "other/model:free" || len(inner.models) != 3 {
+		t.Fatalf("expected rotated model to be reused, got %v", inner.models)
+	}
+}
@@ -0,0 +1,451 @@
+package agent
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"cando/internal/controlpb"
+	"cando/internal/state"
+)
+
+// controlServer exposes the web API over gRPC for editor plugins and other
+// typed clients. It shares the web server's workspace manager so both
+// transports see the same workspace list.
+type controlServer struct {
+	controlpb.UnimplementedControlServer
+	web *webServer
+}
+
+// startGRPC starts the control API on addr and returns the server so the
+// caller can stop it during shutdown.
+func (s *webServer) startGRPC(addr string) (*grpc.Server, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("listen grpc: %w", err)
+	}
+	server := grpc.NewServer(s.grpcGuards()...)
+	controlpb.RegisterControlServer(server, &controlServer{web: s})
+	go func() {
+		if err := server.Serve(listener); err != nil && !errors.Is(err, grpc.ErrServerStopped) {
+			s.logger.Printf("grpc server stopped: %v", err)
+		}
+	}()
+	s.logger.Printf("gRPC control API listening on %s", listener.Addr().String())
+	return server, nil
+}
+
+// grpcGuards returns the server options that put every call through
+// authorizeRPC, the gRPC counterpart of the web server's request guards.
+func (s *webServer) grpcGuards() []grpc.ServerOption {
+	return []grpc.ServerOption{
+		grpc.UnaryInterceptor(func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+			if err := s.authorizeRPC(ctx); err != nil {
+				return nil, err
+			}
+			return handler(ctx, req)
+		}),
+		grpc.StreamInterceptor(func(srv any, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+			if err := s.authorizeRPC(stream.Context()); err != nil {
+				return err
+			}
+			return handler(srv, stream)
+		}),
+	}
+}
+
+// authorizeRPC applies the checks of requireAPIToken, guardRequests and
+// limitRequests to a call: the headless API token must be sent as
+// "authorization: Bearer <token>" metadata, without one the :authority must
+// pass hostAllowed, and the caller shares the per-client web.rate_limit
+// budget with its HTTP requests.
+func (s *webServer) authorizeRPC(ctx context.Context) error {
+	md, _ := metadata.FromIncomingContext(ctx)
+	web := s.agent.cfg.Load().Web
+	if token := s.agent.apiToken; token != "" {
+		var given string
+		if values := md.Get("authorization"); len(values) > 0 {
+			given, _ = strings.CutPrefix(values[0], "Bearer ")
+		}
+		if subtle.ConstantTimeCompare([]byte(strings.TrimSpace(given)), []byte(token)) != 1 {
+			return status.Error(codes.Unauthenticated, "missing or invalid API token")
+		}
+	} else if authority := md.Get(":authority"); len(authority) > 0 && !hostAllowed(authority[0], web.AllowedHosts) {
+		return status.Error(codes.PermissionDenied, "host not allowed; add it to web.allowed_hosts")
+	}
+	if perMinute := web.RequestsPerMinute(); perMinute > 0 && s.limiter != nil {
+		client := "grpc"
+		if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+			client = p.Addr.String()
+			if host, _, err := net.SplitHostPort(client); err == nil {
+				client = host
+			}
+		}
+		if ok, retryAfter, first := s.limiter.allow(client, perMinute); !ok {
+			message := fmt.Sprintf("too many requests; retry in %ds", int(math.Ceil(retryAfter.Seconds())))
+			if first {
+				s.logger.Printf("[ERROR] grpc remote=%s: %s", client, message)
+			}
+			return status.Error(codes.ResourceExhausted, message)
+		}
+	}
+	return nil
+}
+
+// resolveWorkspace mirrors getWorkspaceFromRequest: an explicit path wins,
+// otherwise the workspace currently selected in the UI is used.
+func (c *controlServer) resolveWorkspace(path string) (string, error) {
+	workspace := strings.TrimSpace(path)
+	if workspace == "" && c.web.workspaceManager != nil {
+		if current := c.web.workspaceManager.Current(); current != nil {
+			workspace = current.Path
+		}
+	}
+	if workspace == "" || !c.web.workspaceExists(workspace) {
+		return "", status.Error(codes.FailedPrecondition, "select a workspace first")
+	}
+	return workspace, nil
+}
+
+func (c *controlServer) workspaceContext(path string) (*WorkspaceContext, string, error) {
+	workspace, err := c.resolveWorkspace(path)
+	if err != nil {
+		return nil, "", err
+	}
+	wsCtx, err := c.web.agent.GetOrCreateWorkspaceContext(workspace)
+	if err != nil {
+		return nil, "", status.Errorf(codes.Internal, "get workspace context: %v", err)
+	}
+	return wsCtx, workspace, nil
+}
+
+func (c *controlServer) session(ctx context.Context, workspace string) (*controlpb.Session, error) {
+	payload, err := c.web.buildSessionPayload(ctx, workspace)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "build session: %v", err)
+	}
+	return &controlpb.Session{
+		Workspace:          workspace,
+		CurrentKey:         payload.CurrentKey,
+		Sessions:           sessionSummariesToProto(payload.Sessions),
+		Messages:           messagesToProto(payload.Messages),
+		Running:            payload.Running,
+		PlanMode:           payload.PlanMode,
+		Model:              payload.Model,
+		Provider:           payload.CurrentProvider,
+		TotalTokens:        int64(payload.TotalTokens),
+		ContextChars:       int64(payload.ContextChars),
+		ContextLimitTokens: int64(payload.ContextLimitTokens),
+	}, nil
+}
+
+func (c *controlServer) ListSessions(_ context.Context, req *controlpb.ListSessionsRequest) (*controlpb.ListSessionsResponse, error) {
+	wsCtx, _, err := c.workspaceContext(req.GetWorkspace())
+	if err != nil {
+		return nil, err
+	}
+	return &controlpb.ListSessionsResponse{
+		CurrentKey: wsCtx.states.Current().Key(),
+		Sessions:   sessionSummariesToProto(wsCtx.states.Summaries()),
+	}, nil
+}
+
+func (c *controlServer) GetSession(ctx context.Context, req *controlpb.GetSessionRequest) (*controlpb.Session, error) {
+	workspace, err := c.resolveWorkspace(req.GetWorkspace())
+	if err != nil {
+		return nil, err
+	}
+	return c.session(ctx, workspace)
+}
+
+func (c *controlServer) NewSession(ctx context.Context, req *controlpb.SessionKeyRequest) (*controlpb.Session, error) {
+	return c.sessionAction(ctx, req, func(states *state.Manager, key string) error {
+		_, err := states.NewState(key)
+		return err
+	})
+}
+
+func (c *controlServer) SwitchSession(ctx context.Context, req *controlpb.SessionKeyRequest) (*controlpb.Session, error) {
+	return c.sessionAction(ctx, req, func(states *state.Manager, key string) error {
+		_, err := states.EnsureState(key)
+		return err
+	})
+}
+
+func (c *controlServer) DeleteSession(ctx context.Context, req *controlpb.SessionKeyRequest) (*controlpb.Session, error) {
+	return c.sessionAction(ctx, req, func(states *state.Manager, key string) error {
+		return states.Delete(key)
+	})
+}
+
+func (c *controlServer) ClearSession(ctx context.Context, req *controlpb.GetSessionRequest) (*controlpb.Session, error) {
+	wsCtx, workspace, err := c.workspaceContext(req.GetWorkspace())
+	if err != nil {
+		return nil, err
+	}
+	if err := wsCtx.states.ClearCurrent(); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	return c.session(ctx, workspace)
+}
+
+// sessionAction applies a keyed state operation, matching /api/state.
+func (c *controlServer) sessionAction(ctx context.Context, req *controlpb.SessionKeyRequest, apply func(*state.Manager, string) error) (*controlpb.Session, error) {
+	key := strings.TrimSpace(req.GetKey())
+	if key == "" {
+		return nil, status.Error(codes.InvalidArgument, "key is required")
+	}
+	wsCtx, workspace, err := c.workspaceContext(req.GetWorkspace())
+	if err != nil {
+		return nil, err
+	}
+	if err := apply(wsCtx.states, key); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	return c.session(ctx, workspace)
+}
+
+// SendPrompt runs a prompt through the same flow as /api/stream and streams
+// its events. A prompt sent while a turn runs is queued; the stream then
+// carries a single queued event.
+func (c *controlServer) SendPrompt(req *controlpb.PromptRequest, stream controlpb.Control_SendPromptServer) error {
+	content := strings.TrimSpace(req.GetContent())
+	if content == "" {
+		return status.Error(codes.InvalidArgument, "content is required")
+	}
+	wsCtx, workspace, err := c.workspaceContext(req.GetWorkspace())
+	if err != nil {
+		return err
+	}
+	key := strings.TrimSpace(req.GetIdempotencyKey())
+	if len(key) > idempotencyMaxKeyLen {
+		key = key[:idempotencyMaxKeyLen]
+	}
+	t, err := c.web.submitTurn(wsCtx, turnSubmission{
+		workspace: workspace,
+		content:   content,
+		key:       key,
+		clientID:  grpcClientID,
+		label:     "gRPC client",
+		takeover:  req.GetTakeover(),
+	})
+	var rejected *submitError
+	if errors.As(err, &rejected) {
+		return status.Error(submitErrorCode(rejected.status), rejected.message)
+	}
+	if t.queued {
+		value, err := toProtoValue(map[string]any{"queued": t.item, "position": t.position})
+		if err != nil {
+			return status.Errorf(codes.Internal, "encode queued event: %v", err)
+		}
+		return stream.Send(&controlpb.Event{Type: "queued", Data: value})
+	}
+
+	// Events are buffered like /api/stream's; once a send fails the turn
+	// keeps running for the reconnect grace period and then stops.
+	var sendErr error
+	c.web.runTurn(stream.Context(), t, func(_ int, payload []byte) {
+		if sendErr != nil {
+			return
+		}
+		var event struct {
+			Type string          `json:"type"`
+			Data json.RawMessage `json:"data"`
+		}
+		if sendErr = json.Unmarshal(payload, &event); sendErr != nil {
+			return
+		}
+		value := &structpb.Value{}
+		if sendErr = value.UnmarshalJSON(event.Data); sendErr != nil {
+			return
+		}
+		sendErr = stream.Send(&controlpb.Event{Type: event.Type, Data: value})
+	})
+	return sendErr
+}
+
+// grpcClientID holds the workspace lock for prompts sent over gRPC.
+const grpcClientID = "grpc"
+
+// submitErrorCode maps the HTTP status of a rejected submission to a gRPC
+// code.
+func submitErrorCode(httpStatus int) codes.Code {
+	switch httpStatus {
+	case http.StatusLocked:
+		return codes.FailedPrecondition
+	case http.StatusConflict:
+		return codes.Aborted
+	case http.StatusBadRequest:
+		return codes.InvalidArgument
+	default:
+		return codes.Internal
+	}
+}
+
+// CancelPrompt cancels the provider call running in the request's
+// workspace, or the one selected in the UI when it names none.
+func (c *controlServer) CancelPrompt(_ context.Context, req *controlpb.CancelPromptRequest) (*controlpb.CancelPromptResponse, error) {
+	wsCtx, _, err := c.workspaceContext(req.GetWorkspace())
+	if err != nil {
+		return nil, err
+	}
+	return &controlpb.CancelPromptResponse{
+		Cancelled: wsCtx.CancelRequest(),
+		Running:   wsCtx.HasInFlightRequest(),
+	}, nil
+}
+
+func (c *controlServer) ListTools(_ context.Context, req *controlpb.ListToolsRequest) (*controlpb.ListToolsResponse, error) {
+	wsCtx, _, err := c.workspaceContext(req.GetWorkspace())
+	if err != nil {
+		return nil, err
+	}
+	defs := wsCtx.tools.Definitions()
+	tools := make([]*controlpb.Tool, 0, len(defs))
+	for _, def := range defs {
+		params, err := toProtoStruct(def.Function.Parameters)
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "encode %s parameters: %v", def.Function.Name, err)
+		}
+		tools = append(tools, &controlpb.Tool{
+			Name:        def.Function.Name,
+			Description: def.Function.Description,
+			Parameters:  params,
+		})
+	}
+	return &controlpb.ListToolsResponse{Tools: tools}, nil
+}
+
+func (c *controlServer) ListWorkspaces(context.Context, *controlpb.ListWorkspacesRequest) (*controlpb.ListWorkspacesResponse, error) {
+	if c.web.workspaceManager == nil {
+		return nil, status.Error(codes.Internal, "workspace manager not initialized")
+	}
+	return c.workspaceList(), nil
+}
+
+func (c *controlServer) AddWorkspace(_ context.Context, req *controlpb.WorkspacePathRequest) (*controlpb.Workspace, error) {
+	if c.web.workspaceManager == nil {
+		return nil, status.Error(codes.Internal, "workspace manager not initialized")
+	}
+	if req.GetPath() == "" {
+		return nil, status.Error(codes.InvalidArgument, "path is required")
+	}
+	workspace, err := c.web.workspaceManager.Add(req.GetPath())
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "failed to add workspace: %v", err)
+	}
+	return workspaceToProto(workspace), nil
+}
+
+func (c *controlServer) RemoveWorkspace(_ context.Context, req *controlpb.WorkspacePathRequest) (*controlpb.ListWorkspacesResponse, error) {
+	if c.web.workspaceManager == nil {
+		return nil, status.Error(codes.Internal, "workspace manager not initialized")
+	}
+	if req.GetPath() == "" {
+		return nil, status.Error(codes.InvalidArgument, "path is required")
+	}
+	if err := c.web.workspaceManager.Remove(req.GetPath()); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "failed to remove workspace: %v", err)
+	}
+	return c.workspaceList(), nil
+}
+
+func (c *controlServer) workspaceList() *controlpb.ListWorkspacesResponse {
+	list := c.web.workspaceManager.List()
+	resp := &controlpb.ListWorkspacesResponse{
+		Workspaces: make([]*controlpb.Workspace, 0, len(list)),
+		Current:    workspaceToProto(c.web.workspaceManager.Current()),
+	}
+	for i := range list {
+		resp.Workspaces = append(resp.Workspaces, workspaceToProto(&list[i]))
+	}
+	return resp
+}
+
+func workspaceToProto(ws *Workspace) *controlpb.Workspace {
+	if ws == nil {
+		return nil
+	}
+	return &controlpb.Workspace{
+		Path:  ws.Path,
+		Slug:  ws.Slug,
+		Name:  ws.Name,
+		Added: timestamppb.New(ws.Added),
+	}
+}
+
+func sessionSummariesToProto(summaries []state.Summary) []*controlpb.SessionSummary {
+	out := make([]*controlpb.SessionSummary, 0, len(summaries))
+	for _, summary := range summaries {
+		out = append(out, &controlpb.SessionSummary{
+			Key:          summary.Key,
+			CreatedAt:    timestamppb.New(summary.CreatedAt),
+			UpdatedAt:    timestamppb.New(summary.UpdatedAt),
+			MessageCount: int32(summary.MessageCount),
+		})
+	}
+	return out
+}
+
+func messagesToProto(messages []state.Message) []*controlpb.Message {
+	out := make([]*controlpb.Message, 0, len(messages))
+	for _, msg := range messages {
+		pm := &controlpb.Message{
+			Role:       msg.Role,
+			Content:    msg.Content,
+			Name:       msg.Name,
+			ToolCallId: msg.ToolCallID,
+			Thinking:   msg.Thinking,
+		}
+		for _, call := range msg.ToolCalls {
+			pm.ToolCalls = append(pm.ToolCalls, &controlpb.ToolCall{
+				Id:        call.ID,
+				Type:      call.Type,
+				Name:      call.Function.Name,
+				Arguments: call.Function.Arguments,
+			})
+		}
+		out = append(out, pm)
+	}
+	return out
+}
+
+// toProtoValue converts an event payload via its JSON encoding so structs,
+// typed slices and maps all arrive exactly as the SSE stream renders them.
+func toProtoValue(data any) (*structpb.Value, error) {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	value := &structpb.Value{}
+	if err := value.UnmarshalJSON(raw); err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+func toProtoStruct(data map[string]any) (*structpb.Struct, error) {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	out := &structpb.Struct{}
+	if err := out.UnmarshalJSON(raw); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
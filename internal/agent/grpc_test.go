@@ -0,0 +1,249 @@
+package agent
+
+import (
+	"context"
+	"io"
+	"log"
+	"net"
+	"path/filepath"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	"cando/internal/controlpb"
+	"cando/internal/llm"
+	"cando/internal/state"
+)
+
+func TestControlServerPromptStream(t *testing.T) {
+	configDir := t.TempDir()
+	t.Setenv("CANDO_CONFIG_DIR", configDir)
+	workspace := t.TempDir()
+	cfg := baseTestConfig(workspace)
+	scripted := newScriptedClient(llm.ChatResponse{
+		Choices: []llm.ChatChoice{
+			{Message: state.Message{Role: "assistant", Content: "hi there"}, FinishReason: "stop"},
+		},
+	})
+	// Streaming callbacks read the active provider, so wrap like main does
+	client, err := NewMultiProviderClient("mock", []ProviderRegistration{
+		{Option: ProviderOption{Key: "mock", Label: "Mock", Model: cfg.Model}, Client: scripted},
+	})
+	if err != nil {
+		t.Fatalf("multi provider: %v", err)
+	}
+	agent := newTestAgent(t, client, cfg)
+	web := &webServer{
+		agent:            agent,
+		logger:           log.New(io.Discard, "", 0),
+		workspaceManager: &WorkspaceManager{filePath: filepath.Join(configDir, "workspaces.json")},
+		submissions:      newIdempotencyStore(),
+		streams:          newTurnStreams(),
+	}
+
+	listener := bufconn.Listen(1 << 20)
+	server := grpc.NewServer()
+	controlpb.RegisterControlServer(server, &controlServer{web: web})
+	go server.Serve(listener)
+	defer server.Stop()
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) { return listener.Dial() }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+	rpc := controlpb.NewControlClient(conn)
+	ctx := context.Background()
+
+	if _, err := rpc.GetSession(ctx, &controlpb.GetSessionRequest{}); err == nil {
+		t.Fatalf("expected error without a workspace")
+	}
+	if _, err := rpc.AddWorkspace(ctx, &controlpb.WorkspacePathRequest{Path: workspace}); err != nil {
+		t.Fatalf("add workspace: %v", err)
+	}
+	list, err := rpc.ListWorkspaces(ctx, &controlpb.ListWorkspacesRequest{})
+	if err != nil {
+		t.Fatalf("list workspaces: %v", err)
+	}
+	if list.GetCurrent().GetPath() != workspace {
+		t.Fatalf("expected current workspace %s, got %+v", workspace, list.GetCurrent())
+	}
+
+	tools, err := rpc.ListTools(ctx, &controlpb.ListToolsRequest{Workspace: workspace})
+	if err != nil {
+		t.Fatalf("list tools: %v", err)
+	}
+	if len(tools.GetTools()) == 0 || tools.GetTools()[0].GetParameters() == nil {
+		t.Fatalf("expected tool definitions with parameters, got %+v", tools.GetTools())
+	}
+
+	prompt := func(req *controlpb.PromptRequest) []*controlpb.Event {
+		stream, err := rpc.SendPrompt(ctx, req)
+		if err != nil {
+			t.Fatalf("send prompt: %v", err)
+		}
+		var events []*controlpb.Event
+		for {
+			event, err := stream.Recv()
+			if err == io.EOF {
+				return events
+			}
+			if err != nil {
+				t.Fatalf("recv: %v", err)
+			}
+			events = append(events, event)
+		}
+	}
+	events := prompt(&controlpb.PromptRequest{Content: "hello", IdempotencyKey: "k1"})
+	if len(events) == 0 || events[0].GetType() != "turn_started" || events[len(events)-1].GetType() != "complete" {
+		t.Fatalf("expected turn_started ... complete, got %v", events)
+	}
+	if web.streams.active(workspace) != nil {
+		t.Fatalf("turn stream still active after the turn")
+	}
+
+	// Resending the key replays nothing, as on /api/stream
+	events = prompt(&controlpb.PromptRequest{Content: "hello", IdempotencyKey: "k1"})
+	if len(events) != 1 || events[0].GetData().GetStructValue().GetFields()["status"].GetStringValue() != "duplicate" {
+		t.Fatalf("expected a single duplicate completion, got %v", events)
+	}
+
+	session, err := rpc.GetSession(ctx, &controlpb.GetSessionRequest{Workspace: workspace})
+	if err != nil {
+		t.Fatalf("get session: %v", err)
+	}
+	msgs := session.GetMessages()
+	if len(msgs) == 0 || msgs[len(msgs)-1].GetContent() != "hi there" {
+		t.Fatalf("expected assistant reply in session, got %+v", msgs)
+	}
+}
+
+func TestControlServerGuards(t *testing.T) {
+	configDir := t.TempDir()
+	t.Setenv("CANDO_CONFIG_DIR", configDir)
+	cfg := baseTestConfig(t.TempDir())
+	cfg.Web.RateLimit = 12 // A burst of two calls
+	web := &webServer{
+		agent:            newTestAgent(t, newScriptedClient(), cfg),
+		logger:           log.New(io.Discard, "", 0),
+		limiter:          newRateLimiter(),
+		workspaceManager: &WorkspaceManager{filePath: filepath.Join(configDir, "workspaces.json")},
+	}
+
+	listener := bufconn.Listen(1 << 20)
+	server := grpc.NewServer(web.grpcGuards()...)
+	controlpb.RegisterControlServer(server, &controlServer{web: web})
+	go server.Serve(listener)
+	defer server.Stop()
+
+	dial := func(target string) controlpb.ControlClient {
+		conn, err := grpc.NewClient("passthrough:///"+target,
+			grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) { return listener.Dial() }),
+			grpc.WithTransportCredentials(insecure.NewCredentials()),
+		)
+		if err != nil {
+			t.Fatalf("dial: %v", err)
+		}
+		t.Cleanup(func() { conn.Close() })
+		return controlpb.NewControlClient(conn)
+	}
+	ctx := context.Background()
+
+	if _, err := dial("evil.example:3738").ListWorkspaces(ctx, &controlpb.ListWorkspacesRequest{}); status.Code(err) != codes.PermissionDenied {
+		t.Fatalf("rebound host: err = %v, want PermissionDenied", err)
+	}
+	rpc := dial("localhost:3738")
+	for i := 0; i < 2; i++ {
+		if _, err := rpc.ListWorkspaces(ctx, &controlpb.ListWorkspacesRequest{}); err != nil {
+			t.Fatalf("call %d: %v", i, err)
+		}
+	}
+	if _, err := rpc.ListWorkspaces(ctx, &controlpb.ListWorkspacesRequest{}); status.Code(err) != codes.ResourceExhausted {
+		t.Fatalf("over the rate limit: err = %v, want ResourceExhausted", err)
+	}
+}
+
+func TestControlServerRequiresAPIToken(t *testing.T) {
+	configDir := t.TempDir()
+	t.Setenv("CANDO_CONFIG_DIR", configDir)
+	agent := newTestAgent(t, newScriptedClient(), baseTestConfig(t.TempDir()))
+	agent.apiToken = "s3cret"
+	web := &webServer{
+		agent:            agent,
+		logger:           log.New(io.Discard, "", 0),
+		workspaceManager: &WorkspaceManager{filePath: filepath.Join(configDir, "workspaces.json")},
+	}
+
+	listener := bufconn.Listen(1 << 20)
+	server := grpc.NewServer(web.grpcGuards()...)
+	controlpb.RegisterControlServer(server, &controlServer{web: web})
+	go server.Serve(listener)
+	defer server.Stop()
+
+	// Authenticated calls may use any host name, as over HTTP
+	conn, err := grpc.NewClient("passthrough:///build-box:3738",
+		grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) { return listener.Dial() }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+	rpc := controlpb.NewControlClient(conn)
+
+	for _, md := range []metadata.MD{nil, metadata.Pairs("authorization", "Bearer wrong")} {
+		ctx := metadata.NewOutgoingContext(context.Background(), md)
+		if _, err := rpc.ListWorkspaces(ctx, &controlpb.ListWorkspacesRequest{}); status.Code(err) != codes.Unauthenticated {
+			t.Fatalf("metadata %v: err = %v, want Unauthenticated", md, err)
+		}
+	}
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer s3cret")
+	if _, err := rpc.ListWorkspaces(ctx, &controlpb.ListWorkspacesRequest{}); err != nil {
+		t.Fatalf("authenticated call: %v", err)
+	}
+}
+
+func TestControlServerCancelPromptNamesWorkspace(t *testing.T) {
+	configDir := t.TempDir()
+	t.Setenv("CANDO_CONFIG_DIR", configDir)
+	first, second := t.TempDir(), t.TempDir()
+	web := &webServer{
+		agent:            newTestAgent(t, newScriptedClient(), baseTestConfig(first)),
+		logger:           log.New(io.Discard, "", 0),
+		workspaceManager: &WorkspaceManager{filePath: filepath.Join(configDir, "workspaces.json")},
+	}
+	control := &controlServer{web: web}
+	ctx := context.Background()
+	contexts := map[string]*WorkspaceContext{}
+	for _, path := range []string{first, second} {
+		if _, err := web.workspaceManager.Add(path); err != nil {
+			t.Fatalf("add workspace: %v", err)
+		}
+		wsCtx, err := web.agent.GetOrCreateWorkspaceContext(path)
+		if err != nil {
+			t.Fatalf("workspace context: %v", err)
+		}
+		_, cancel := context.WithCancel(ctx)
+		wsCtx.requests.begin(cancel)
+		contexts[path] = wsCtx
+	}
+
+	resp, err := control.CancelPrompt(ctx, &controlpb.CancelPromptRequest{Workspace: first})
+	if err != nil {
+		t.Fatalf("cancel: %v", err)
+	}
+	if !resp.GetCancelled() || resp.GetRunning() {
+		t.Fatalf("cancel first = %+v, want cancelled and not running", resp)
+	}
+	if !contexts[second].HasInFlightRequest() {
+		t.Fatalf("cancelling one workspace cancelled the other")
+	}
+}
@@ -0,0 +1,355 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/websocket"
+
+	"cando/internal/tooling"
+)
+
+const (
+	handoffOutputLimit = 8000 // Characters of terminal output returned to the model
+	handoffDrainWait   = time.Second
+)
+
+// handoffTimeout is how long a command handed to the user may run before
+// it is stopped, so a forgotten terminal cannot hold a turn forever.
+var handoffTimeout = 15 * time.Minute
+
+// handoff is a shell command running in a PTY for the user to complete.
+// The web UI attaches to it through /api/terminal?handoff=<id>.
+type handoff struct {
+	ID           string    `json:"id"`
+	Workspace    string    `json:"workspace"`
+	TurnID       string    `json:"turn_id,omitempty"`
+	Command      []string  `json:"command"`
+	Instructions string    `json:"instructions,omitempty"`
+	StartedAt    time.Time `json:"started_at"`
+
+	ptmx *os.File
+	end  chan struct{} // Closed when the user ends the step
+	once sync.Once
+
+	mu     sync.Mutex
+	output []byte // Latest terminalTranscriptLimit bytes of raw output
+	base   int    // Offset of output[0] in everything written
+	done   bool
+	code   int           // Exit code once done
+	notify chan struct{} // Closed and replaced on every change
+}
+
+func (h *handoff) write(p []byte) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.output = append(h.output, p...)
+	if over := len(h.output) - terminalTranscriptLimit; over > 0 {
+		h.output = h.output[over:]
+		h.base += over
+	}
+	h.broadcast()
+}
+
+func (h *handoff) finish(code int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.done = true
+	h.code = code
+	h.broadcast()
+}
+
+func (h *handoff) broadcast() {
+	close(h.notify)
+	h.notify = make(chan struct{})
+}
+
+// since returns the output after offset from, the offset to read from next,
+// whether the command has ended, and a channel closed on the next change.
+// Output that was dropped from the front is skipped.
+func (h *handoff) since(from int) ([]byte, int, bool, <-chan struct{}) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	start := max(from-h.base, 0)
+	chunk := append([]byte(nil), h.output[start:]...)
+	return chunk, h.base + len(h.output), h.done, h.notify
+}
+
+func (h *handoff) exitCode() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.code
+}
+
+// transcript returns the output without escape codes, keeping the end.
+func (h *handoff) transcript() string {
+	h.mu.Lock()
+	raw := string(h.output)
+	h.mu.Unlock()
+	clean := strings.TrimSpace(strings.ReplaceAll(ansiEscapePattern.ReplaceAllString(raw, ""), "\r", ""))
+	if len(clean) > handoffOutputLimit {
+		clean = "...\n" + clean[len(clean)-handoffOutputLimit:]
+	}
+	return clean
+}
+
+// handoffBroker tracks the commands handed to the user. The zero value is
+// ready to use.
+type handoffBroker struct {
+	mu      sync.Mutex
+	pending map[string]*handoff
+}
+
+// runner returns a tooling.InteractiveRunner for turns in workspace. Each
+// command is announced with an interactive_handoff event and stays listed on
+// /api/handoff until it exits, the user ends it, or handoffTimeout passes.
+func (b *handoffBroker) runner(workspace, turnID string, callback StreamCallback) tooling.InteractiveRunner {
+	return func(ctx context.Context, req tooling.InteractiveRequest) (tooling.InteractiveResult, error) {
+		args := req.Args
+		if len(args) == 0 {
+			args = req.Command
+		}
+		cmd := exec.Command(args[0], args[1:]...)
+		cmd.Dir = req.Dir
+		cmd.Env = req.Env
+		ptmx, err := startPTY(cmd, 100, 30)
+		if err != nil {
+			return tooling.InteractiveResult{}, fmt.Errorf("start terminal: %w", err)
+		}
+		defer ptmx.Close()
+		h := &handoff{
+			ID:           newApprovalID(),
+			Workspace:    workspace,
+			TurnID:       turnID,
+			Command:      req.Command,
+			Instructions: req.Instructions,
+			StartedAt:    time.Now(),
+			ptmx:         ptmx,
+			end:          make(chan struct{}),
+			notify:       make(chan struct{}),
+		}
+		b.mu.Lock()
+		if b.pending == nil {
+			b.pending = make(map[string]*handoff)
+		}
+		b.pending[h.ID] = h
+		b.mu.Unlock()
+		defer func() {
+			b.mu.Lock()
+			delete(b.pending, h.ID)
+			b.mu.Unlock()
+		}()
+
+		drained := make(chan struct{})
+		go func() {
+			defer close(drained)
+			buf := make([]byte, 4096)
+			for {
+				n, err := ptmx.Read(buf)
+				if n > 0 {
+					h.write(buf[:n])
+				}
+				if err != nil {
+					return
+				}
+			}
+		}()
+		exited := make(chan error, 1)
+		go func() { exited <- cmd.Wait() }()
+
+		if callback != nil {
+			_ = callback("interactive_handoff", map[string]any{
+				"id":           h.ID,
+				"command":      h.Command,
+				"instructions": h.Instructions,
+				"timeout_ms":   handoffTimeout.Milliseconds(),
+			})
+		}
+		timer := time.NewTimer(handoffTimeout)
+		defer timer.Stop()
+		endedBy := "exit"
+		var waitErr error
+		select {
+		case waitErr = <-exited:
+		case <-h.end:
+			endedBy = "user"
+		case <-timer.C:
+			endedBy = "timeout"
+		case <-ctx.Done():
+			endedBy = "cancelled"
+		}
+		if endedBy != "exit" {
+			if req.Stop != nil {
+				_ = req.Stop()
+			}
+			_ = cmd.Process.Kill()
+			waitErr = <-exited
+		}
+		// Keep what the command printed last before the PTY closes
+		select {
+		case <-drained:
+		case <-time.After(handoffDrainWait):
+		}
+		exitCode := 0
+		if waitErr != nil {
+			exitCode = -1
+			var exitErr *exec.ExitError
+			if errors.As(waitErr, &exitErr) {
+				exitCode = exitErr.ExitCode()
+			}
+		}
+		h.finish(exitCode)
+		if callback != nil {
+			_ = callback("interactive_handoff_finished", map[string]any{
+				"id":        h.ID,
+				"exit_code": exitCode,
+				"ended_by":  endedBy,
+			})
+		}
+		if endedBy == "cancelled" {
+			return tooling.InteractiveResult{}, ctx.Err()
+		}
+		return tooling.InteractiveResult{Output: h.transcript(), ExitCode: exitCode, EndedBy: endedBy}, nil
+	}
+}
+
+func (b *handoffBroker) get(id string) *handoff {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.pending[id]
+}
+
+// list returns the commands waiting for the user in workspace, oldest first.
+func (b *handoffBroker) list(workspace string) []*handoff {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	out := []*handoff{}
+	for _, h := range b.pending {
+		if h.Workspace == workspace {
+			out = append(out, h)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].StartedAt.Before(out[j].StartedAt) })
+	return out
+}
+
+// endStep stops the command id on the user's behalf. It reports false when
+// no such command is running.
+func (b *handoffBroker) endStep(id string) bool {
+	h := b.get(id)
+	if h == nil {
+		return false
+	}
+	h.once.Do(func() { close(h.end) })
+	return true
+}
+
+// handleHandoff lists the commands handed to the user in a workspace (GET)
+// and ends one of them (POST {"id"}), returning control to the agent.
+func (s *webServer) handleHandoff(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		workspace := s.getWorkspaceFromRequest(r)
+		if workspace == "" {
+			s.respondError(w, r, http.StatusBadRequest, "workspace required")
+			return
+		}
+		root, err := filepath.Abs(workspace)
+		if err != nil {
+			s.respondError(w, r, http.StatusBadRequest, fmt.Sprintf("invalid workspace: %v", err))
+			return
+		}
+		s.writeJSON(w, r, map[string]any{"pending": s.agent.handoffs.list(root)})
+	case http.MethodPost:
+		var body struct {
+			ID string `json:"id"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			s.respondError(w, r, http.StatusBadRequest, fmt.Sprintf("invalid body: %v", err))
+			return
+		}
+		if body.ID == "" {
+			s.respondError(w, r, http.StatusBadRequest, "id required")
+			return
+		}
+		if !s.agent.handoffs.endStep(body.ID) {
+			s.respondError(w, r, http.StatusNotFound, "no command is waiting for that hand-off; it may have finished")
+			return
+		}
+		s.writeJSON(w, r, map[string]any{"status": "ok"})
+	default:
+		s.respondError(w, r, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+// serveHandoff connects a terminal socket to a handed-off command: its
+// output so far and from then on as binary frames, and the user's input
+// and resizes to its PTY. Closing the socket leaves the command running,
+// so a reloaded page can attach again.
+func (s *webServer) serveHandoff(ws *websocket.Conn, h *handoff) {
+	defer ws.Close()
+	var sendMu sync.Mutex
+	send := func(fn func() error) error {
+		sendMu.Lock()
+		defer sendMu.Unlock()
+		return fn()
+	}
+	if err := send(func() error { return websocket.JSON.Send(ws, terminalMessage{Type: "ready", ID: h.ID}) }); err != nil {
+		return
+	}
+
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			var raw string
+			if err := websocket.Message.Receive(ws, &raw); err != nil {
+				return
+			}
+			var msg terminalMessage
+			if err := json.Unmarshal([]byte(raw), &msg); err != nil {
+				msg = terminalMessage{Type: "input", Data: raw}
+			}
+			switch msg.Type {
+			case "input":
+				_, _ = h.ptmx.Write([]byte(msg.Data))
+			case "resize":
+				if msg.Cols > 0 && msg.Rows > 0 {
+					_ = resizeTerminal(h.ptmx, msg.Cols, msg.Rows)
+				}
+			}
+		}
+	}()
+
+	offset := 0
+	for {
+		chunk, next, done, changed := h.since(offset)
+		offset = next
+		if len(chunk) > 0 {
+			if err := send(func() error { return websocket.Message.Send(ws, chunk) }); err != nil {
+				return
+			}
+		}
+		if done {
+			send(func() error {
+				return websocket.JSON.Send(ws, terminalMessage{Type: "exit", ID: h.ID, Code: h.exitCode()})
+			})
+			return
+		}
+		select {
+		case <-changed:
+		case <-closed:
+			return
+		}
+	}
+}
@@ -0,0 +1,116 @@
+//go:build !windows
+
+package agent
+
+import (
+	"context"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"cando/internal/tooling"
+)
+
+func TestHandoffRunnerUserAnswersPrompt(t *testing.T) {
+	var b handoffBroker
+	var mu sync.Mutex
+	var events []string
+	started := make(chan string, 1)
+	callback := func(eventType string, data any) error {
+		mu.Lock()
+		events = append(events, eventType)
+		mu.Unlock()
+		if eventType == "interactive_handoff" {
+			started <- data.(map[string]any)["id"].(string)
+		}
+		return nil
+	}
+	run := b.runner("/ws", "turn-1", callback)
+
+	type outcome struct {
+		res tooling.InteractiveResult
+		err error
+	}
+	done := make(chan outcome, 1)
+	go func() {
+		res, err := run(context.Background(), tooling.InteractiveRequest{
+			Command: []string{"sh", "-c", `printf 'name? '; read name; echo "hi $name"`},
+			Dir:     t.TempDir(),
+			Env:     os.Environ(),
+		})
+		done <- outcome{res, err}
+	}()
+
+	id := <-started
+	if got := b.list("/ws"); len(got) != 1 || got[0].ID != id {
+		t.Fatalf("pending hand-offs = %+v, want %s", got, id)
+	}
+	if got := b.list("/other"); len(got) != 0 {
+		t.Fatalf("other workspace sees %d hand-offs", len(got))
+	}
+	if _, err := b.get(id).ptmx.Write([]byte("bob\r")); err != nil {
+		t.Fatalf("write input: %v", err)
+	}
+
+	select {
+	case out := <-done:
+		if out.err != nil {
+			t.Fatalf("runner: %v", out.err)
+		}
+		if out.res.EndedBy != "exit" || out.res.ExitCode != 0 {
+			t.Fatalf("result = %+v, want a clean exit", out.res)
+		}
+		if !strings.Contains(out.res.Output, "hi bob") {
+			t.Fatalf("output = %q, want the answer echoed", out.res.Output)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("command did not finish after the answer")
+	}
+	if b.get(id) != nil {
+		t.Fatal("finished hand-off still pending")
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(events) != 2 || events[1] != "interactive_handoff_finished" {
+		t.Fatalf("events = %v", events)
+	}
+}
+
+func TestHandoffRunnerEndedByUser(t *testing.T) {
+	var b handoffBroker
+	started := make(chan string, 1)
+	run := b.runner("/ws", "", func(eventType string, data any) error {
+		if eventType == "interactive_handoff" {
+			started <- data.(map[string]any)["id"].(string)
+		}
+		return nil
+	})
+
+	done := make(chan tooling.InteractiveResult, 1)
+	go func() {
+		res, _ := run(context.Background(), tooling.InteractiveRequest{
+			Command: []string{"sleep", "30"},
+			Dir:     t.TempDir(),
+			Env:     os.Environ(),
+		})
+		done <- res
+	}()
+
+	id := <-started
+	if !b.endStep(id) {
+		t.Fatal("endStep did not find the hand-off")
+	}
+	select {
+	case res := <-done:
+		if res.EndedBy != "user" {
+			t.Fatalf("EndedBy = %q, want user", res.EndedBy)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("ending the step did not stop the command")
+	}
+	if b.endStep(id) {
+		t.Fatal("endStep succeeded after the command finished")
+	}
+}
@@ -0,0 +1,266 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"cando/internal/config"
+	"cando/internal/contextprofile"
+	"cando/internal/tooling"
+)
+
+const (
+	// healthCacheTTL is how long disk and memory store checks are reused,
+	// so frequent monitoring probes stay cheap.
+	healthCacheTTL = 30 * time.Second
+	// integrityCheckTimeout bounds the memory store checks of one probe.
+	integrityCheckTimeout = 5 * time.Second
+	// Free space on the storage volume below which health degrades, and
+	// below which sessions and memories may fail to save.
+	diskLowBytes      = 1 << 30
+	diskCriticalBytes = 100 << 20
+)
+
+// Health states, from best to worst.
+const (
+	healthOK        = "ok"
+	healthDegraded  = "degraded"
+	healthUnhealthy = "unhealthy"
+)
+
+// worseHealth returns the worse of two health states.
+func worseHealth(a, b string) string {
+	rank := map[string]int{healthOK: 0, healthDegraded: 1, healthUnhealthy: 2}
+	if rank[b] > rank[a] {
+		return b
+	}
+	return a
+}
+
+// subsystemHealth is the part every subsystem check reports.
+type subsystemHealth struct {
+	Status string `json:"status"`
+	Detail string `json:"detail,omitempty"`
+}
+
+type providerHealth struct {
+	subsystemHealth
+	Configured int `json:"configured"`
+	Reachable  int `json:"reachable"` // Answered the warm-up check; see warmup for details
+}
+
+type diskHealth struct {
+	subsystemHealth
+	Path       string `json:"path"`
+	FreeBytes  uint64 `json:"free_bytes"`
+	TotalBytes uint64 `json:"total_bytes"`
+}
+
+type memoryStoreHealth struct {
+	subsystemHealth
+	Checked int      `json:"checked"`           // Memory stores of loaded workspaces
+	Damaged []string `json:"damaged,omitempty"` // Workspaces whose store failed the check
+}
+
+type processHealth struct {
+	subsystemHealth
+	Running int `json:"running"` // Background processes started by tools
+}
+
+type versionHealth struct {
+	subsystemHealth
+	Current         string `json:"current"`
+	Latest          string `json:"latest,omitempty"` // From the last update check
+	UpdateAvailable bool   `json:"update_available"`
+}
+
+// healthChecks are the subsystem results in the /api/health payload.
+type healthChecks struct {
+	Providers   providerHealth    `json:"providers"`
+	Disk        diskHealth        `json:"disk"`
+	MemoryStore memoryStoreHealth `json:"memory_store"`
+	Processes   processHealth     `json:"processes"`
+	Version     versionHealth     `json:"version"`
+}
+
+// healthCache holds the checks that touch the disk.
+type healthCache struct {
+	mu        sync.Mutex
+	checkedAt time.Time
+	disk      diskHealth
+	memory    memoryStoreHealth
+}
+
+// handleHealth reports overall and per-subsystem health. The status is the
+// worst of the subsystems; unhealthy answers 503 so monitors can alert on
+// the status code alone. ?refresh=1 skips the cached disk and memory store
+// checks.
+func (s *webServer) handleHealth(w http.ResponseWriter, r *http.Request) {
+	s.health.mu.Lock()
+	if r.URL.Query().Get("refresh") == "1" || time.Since(s.health.checkedAt) > healthCacheTTL {
+		s.health.disk = checkDiskHealth(config.GetConfigDir())
+		ctx, cancel := context.WithTimeout(r.Context(), integrityCheckTimeout)
+		s.health.memory = s.agent.checkMemoryStores(ctx)
+		cancel()
+		s.health.checkedAt = time.Now()
+	}
+	checks := healthChecks{
+		Providers:   s.agent.providerHealth(),
+		Disk:        s.health.disk,
+		MemoryStore: s.health.memory,
+		Processes:   s.agent.processHealth(),
+		Version:     s.agent.versionHealth(),
+	}
+	s.health.mu.Unlock()
+
+	status := healthOK
+	for _, check := range []subsystemHealth{
+		checks.Providers.subsystemHealth, checks.Disk.subsystemHealth, checks.MemoryStore.subsystemHealth,
+		checks.Processes.subsystemHealth, checks.Version.subsystemHealth,
+	} {
+		status = worseHealth(status, check.Status)
+	}
+	health := map[string]any{
+		"status":  status,
+		"ready":   s.agent.warmup.Ready(),
+		"warmup":  s.agent.warmup.Report(),
+		"version": s.agent.version,
+		"checks":  checks,
+	}
+	if profile := config.ActiveProfile(); profile != "" {
+		health["profile"] = profile
+	}
+	if status == healthUnhealthy {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	s.writeJSON(w, r, health)
+}
+
+// providerHealth summarizes the last warm-up: degraded when a provider
+// failed its check, unhealthy when none of them answered.
+func (a *Agent) providerHealth() providerHealth {
+	health := providerHealth{subsystemHealth: subsystemHealth{Status: healthOK}}
+	keys := a.warmupProviderKeys()
+	health.Configured = len(keys)
+	if len(keys) == 0 {
+		health.Status, health.Detail = healthDegraded, "no providers configured"
+		return health
+	}
+	report := a.warmup.Report()
+	switch report.State {
+	case warmupPending, warmupRunning:
+		health.Detail = "warm-up in progress"
+		return health
+	case warmupOff:
+		health.Detail = "warm-up disabled; providers not checked"
+		return health
+	}
+	checked := 0
+	for _, result := range report.Providers {
+		if result.Skipped {
+			continue
+		}
+		checked++
+		if result.OK {
+			health.Reachable++
+		}
+	}
+	switch {
+	case checked > 0 && health.Reachable == 0:
+		health.Status, health.Detail = healthUnhealthy, "no provider answered"
+	case health.Reachable < checked:
+		health.Status, health.Detail = healthDegraded, fmt.Sprintf("%d of %d providers failed their check", checked-health.Reachable, checked)
+	}
+	return health
+}
+
+// checkDiskHealth reports free space on the volume holding the storage root.
+func checkDiskHealth(root string) diskHealth {
+	health := diskHealth{subsystemHealth: subsystemHealth{Status: healthOK}, Path: root}
+	free, total, err := diskSpace(root)
+	if err != nil {
+		health.Status, health.Detail = healthDegraded, err.Error()
+		return health
+	}
+	health.FreeBytes, health.TotalBytes = free, total
+	switch {
+	case free < diskCriticalBytes:
+		health.Status, health.Detail = healthUnhealthy, "storage volume is almost full"
+	case free < diskLowBytes:
+		health.Status, health.Detail = healthDegraded, "storage volume is low on space"
+	}
+	return health
+}
+
+// checkMemoryStores runs the integrity check of every loaded memory store.
+// A damaged store degrades health: sessions keep working, but recall and
+// compaction may not.
+func (a *Agent) checkMemoryStores(ctx context.Context) memoryStoreHealth {
+	health := memoryStoreHealth{subsystemHealth: subsystemHealth{Status: healthOK}}
+	stores := make(map[contextprofile.IntegrityChecker]string) // Store -> workspace root
+	add := func(root string, profile contextprofile.Profile) {
+		if checker, ok := profile.(contextprofile.IntegrityChecker); ok {
+			stores[checker] = root
+		}
+	}
+	add(a.workspaceRoot, a.profile)
+	a.workspacesMu.RLock()
+	for root, wsCtx := range a.workspaceContexts {
+		add(root, wsCtx.profile)
+	}
+	a.workspacesMu.RUnlock()
+
+	for checker, root := range stores {
+		health.Checked++
+		if err := checker.CheckIntegrity(ctx); err != nil {
+			a.logger.Printf("[health] %v", err)
+			health.Damaged = append(health.Damaged, root)
+		}
+	}
+	slices.Sort(health.Damaged)
+	if len(health.Damaged) > 0 {
+		health.Status, health.Detail = healthDegraded, "memory store failed its integrity check"
+	}
+	return health
+}
+
+// processHealth counts the background processes tools have running.
+func (a *Agent) processHealth() processHealth {
+	health := processHealth{subsystemHealth: subsystemHealth{Status: healthOK}}
+	seen := make(map[*tooling.Registry]bool)
+	count := func(tools *tooling.Registry) {
+		if tools == nil || seen[tools] {
+			return
+		}
+		seen[tools] = true
+		if tool, ok := tools.Lookup("background_process"); ok {
+			if processes, ok := tool.(*tooling.BackgroundProcessTool); ok {
+				health.Running += processes.Running()
+			}
+		}
+	}
+	count(a.tools)
+	a.workspacesMu.RLock()
+	for _, wsCtx := range a.workspaceContexts {
+		count(wsCtx.tools)
+	}
+	a.workspacesMu.RUnlock()
+	return health
+}
+
+// versionHealth reports the running version and the latest one seen by the
+// last update check, without contacting GitHub.
+func (a *Agent) versionHealth() versionHealth {
+	health := versionHealth{subsystemHealth: subsystemHealth{Status: healthOK}, Current: a.version}
+	if state, err := config.LoadUpdateState(); err == nil {
+		health.Latest = state.LatestVersion
+	}
+	isDev := a.version == "" || a.version == "dev"
+	health.UpdateAvailable = !isDev && health.Latest != "" && compareVersions(health.Latest, a.version) > 0
+	return health
+}
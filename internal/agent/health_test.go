@@ -0,0 +1,68 @@
+package agent
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestProviderHealthFollowsWarmup(t *testing.T) {
+	client, err := NewMultiProviderClient("zai", []ProviderRegistration{
+		{Option: ProviderOption{Key: "zai", Label: "A", Model: "m"}, Client: newScriptedClient()},
+		{Option: ProviderOption{Key: "openrouter", Label: "B", Model: "m"}, Client: newScriptedClient()},
+	})
+	if err != nil {
+		t.Fatalf("new client: %v", err)
+	}
+	agent := newTestAgent(t, client, baseTestConfig(t.TempDir()))
+
+	if health := agent.providerHealth(); health.Status != healthOK || health.Configured != 2 {
+		t.Fatalf("pending warm-up should not degrade health: %+v", health)
+	}
+	agent.warmup.finish(agent.warmup.begin(), []warmupResult{
+		{Provider: "zai", OK: true},
+		{Provider: "openrouter", Error: "401"},
+	}, false)
+	if health := agent.providerHealth(); health.Status != healthDegraded || health.Reachable != 1 {
+		t.Fatalf("one failing provider should degrade health: %+v", health)
+	}
+	agent.warmup.finish(agent.warmup.begin(), []warmupResult{
+		{Provider: "zai", Error: "timeout"},
+		{Provider: "openrouter", Error: "401"},
+	}, false)
+	if health := agent.providerHealth(); health.Status != healthUnhealthy {
+		t.Fatalf("no reachable provider should be unhealthy: %+v", health)
+	}
+}
+
+func TestHealthEndpointReportsSubsystems(t *testing.T) {
+	configDir := t.TempDir()
+	t.Setenv("CANDO_CONFIG_DIR", configDir)
+	agent := newTestAgent(t, newScriptedClient(), baseTestConfig(t.TempDir()))
+	agent.version = "1.2.0"
+	s := newWebServer(agent, "127.0.0.1:0")
+
+	rec := httptest.NewRecorder()
+	s.handleHealth(rec, httptest.NewRequest(http.MethodGet, "/api/health", nil))
+	var health struct {
+		Status string       `json:"status"`
+		Checks healthChecks `json:"checks"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&health); err != nil {
+		t.Fatal(err)
+	}
+	// No providers are registered, so the agent cannot answer prompts
+	if health.Status != healthDegraded || health.Checks.Providers.Status != healthDegraded {
+		t.Fatalf("status = %q, providers = %+v", health.Status, health.Checks.Providers)
+	}
+	if rec.Code != http.StatusOK {
+		t.Fatalf("degraded health should still answer 200, got %d", rec.Code)
+	}
+	if health.Checks.Disk.Path != configDir || health.Checks.Disk.TotalBytes == 0 {
+		t.Fatalf("disk check = %+v", health.Checks.Disk)
+	}
+	if health.Checks.Version.Current != "1.2.0" || health.Checks.Processes.Running != 0 {
+		t.Fatalf("version = %+v, processes = %+v", health.Checks.Version, health.Checks.Processes)
+	}
+}
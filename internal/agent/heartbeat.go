@@ -0,0 +1,49 @@
+package agent
+
+import (
+	"sync"
+	"time"
+)
+
+// providerHeartbeatInterval is how often a heartbeat event is emitted while a
+// provider call is in flight.
+var providerHeartbeatInterval = 5 * time.Second
+
+// startProviderHeartbeat emits heartbeat events until stop is called, so the
+// UI can tell a slow model from a hung request. stop waits for the emitter to
+// exit, keeping callback use single-threaded once the call returns.
+func startProviderHeartbeat(callback StreamCallback, attempt, maxAttempts int, model string) (stop func()) {
+	if callback == nil {
+		return func() {}
+	}
+	start := time.Now()
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(providerHeartbeatInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				elapsed := time.Since(start)
+				callback("heartbeat", map[string]any{
+					"elapsed_ms":   elapsed.Milliseconds(),
+					"attempt":      attempt,
+					"max_attempts": maxAttempts,
+					"model":        model,
+				})
+			}
+		}
+	}()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			close(done)
+			wg.Wait()
+		})
+	}
+}
@@ -0,0 +1,56 @@
+package agent
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"cando/internal/llm"
+	"cando/internal/state"
+)
+
+// slowClient answers after a delay.
+type slowClient struct {
+	delay time.Duration
+}
+
+func (c slowClient) Chat(ctx context.Context, _ llm.ChatRequest) (llm.ChatResponse, error) {
+	select {
+	case <-time.After(c.delay):
+		return llm.ChatResponse{Choices: []llm.ChatChoice{{Message: state.Message{Role: "assistant", Content: "done"}, FinishReason: "stop"}}}, nil
+	case <-ctx.Done():
+		return llm.ChatResponse{}, ctx.Err()
+	}
+}
+
+func TestProviderCallEmitsHeartbeats(t *testing.T) {
+	saved := providerHeartbeatInterval
+	providerHeartbeatInterval = 10 * time.Millisecond
+	t.Cleanup(func() { providerHeartbeatInterval = saved })
+
+	agent := newTestAgent(t, slowClient{delay: 55 * time.Millisecond}, baseTestConfig(t.TempDir()))
+	var beats []map[string]any
+	callback := func(event string, data any) error {
+		if event == "heartbeat" {
+			beats = append(beats, data.(map[string]any))
+		}
+		return nil
+	}
+	if _, err := agent.callProviderWithRetry(context.Background(), llm.ChatRequest{Model: "m"}, callback, deltasOff); err != nil {
+		t.Fatalf("call failed: %v", err)
+	}
+	if len(beats) < 2 {
+		t.Fatalf("expected heartbeats during the call, got %d", len(beats))
+	}
+	last := beats[len(beats)-1]
+	if last["attempt"] != 1 || last["elapsed_ms"].(int64) < 20 {
+		t.Fatalf("unexpected heartbeat payload: %v", last)
+	}
+
+	// No heartbeats after the call returned
+	count := len(beats)
+	time.Sleep(30 * time.Millisecond)
+	if len(beats) != count {
+		t.Fatalf("heartbeat emitted after the provider call finished")
+	}
+}
@@ -0,0 +1,88 @@
+package agent
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	idempotencyTTL       = 15 * time.Minute
+	idempotencyMaxKeyLen = 128
+)
+
+// Idempotency states for a submitted prompt.
+const (
+	submissionRunning = "running"
+	submissionDone    = "done"
+	submissionFailed  = "failed"
+)
+
+// idempotencyStore remembers recent prompt submissions per workspace and
+// session so a resubmitted prompt does not start a second turn.
+type idempotencyStore struct {
+	mu      sync.Mutex
+	entries map[string]*submission
+}
+
+type submission struct {
+	status  string
+	created time.Time
+}
+
+func newIdempotencyStore() *idempotencyStore {
+	return &idempotencyStore{entries: make(map[string]*submission)}
+}
+
+// idempotencyKey reads the client key from the request body value or the
+// Idempotency-Key header.
+func idempotencyKey(r *http.Request, bodyKey string) string {
+	key := strings.TrimSpace(bodyKey)
+	if key == "" {
+		key = strings.TrimSpace(r.Header.Get("Idempotency-Key"))
+	}
+	if len(key) > idempotencyMaxKeyLen {
+		key = key[:idempotencyMaxKeyLen]
+	}
+	return key
+}
+
+// begin records a submission. When the key was already seen it returns the
+// earlier submission's status and false; failed submissions may be retried.
+func (s *idempotencyStore) begin(workspace, session, key string) (string, bool) {
+	if key == "" {
+		return "", true
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	for k, entry := range s.entries {
+		if now.Sub(entry.created) > idempotencyTTL {
+			delete(s.entries, k)
+		}
+	}
+	id := workspace + "\x00" + session + "\x00" + key
+	if entry, ok := s.entries[id]; ok && entry.status != submissionFailed {
+		return entry.status, false
+	}
+	s.entries[id] = &submission{status: submissionRunning, created: now}
+	return "", true
+}
+
+// finish records the outcome of a submission started with begin.
+func (s *idempotencyStore) finish(workspace, session, key string, err error) {
+	if key == "" {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entry, ok := s.entries[workspace+"\x00"+session+"\x00"+key]
+	if !ok {
+		return
+	}
+	entry.status = submissionDone
+	if err != nil {
+		entry.status = submissionFailed
+	}
+}
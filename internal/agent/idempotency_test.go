@@ -0,0 +1,32 @@
+package agent
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestIdempotencyStoreDropsResubmissions(t *testing.T) {
+	store := newIdempotencyStore()
+	if _, ok := store.begin("/ws", "s1", "k1"); !ok {
+		t.Fatalf("first submission rejected")
+	}
+	if status, ok := store.begin("/ws", "s1", "k1"); ok || status != submissionRunning {
+		t.Fatalf("duplicate while running: ok=%v status=%q", ok, status)
+	}
+	if _, ok := store.begin("/ws", "s2", "k1"); !ok {
+		t.Fatalf("keys are scoped per session")
+	}
+	store.finish("/ws", "s1", "k1", nil)
+	if status, ok := store.begin("/ws", "s1", "k1"); ok || status != submissionDone {
+		t.Fatalf("duplicate after completion: ok=%v status=%q", ok, status)
+	}
+
+	store.begin("/ws", "s1", "k2")
+	store.finish("/ws", "s1", "k2", errors.New("provider down"))
+	if _, ok := store.begin("/ws", "s1", "k2"); !ok {
+		t.Fatalf("failed submissions should be retryable")
+	}
+	if _, ok := store.begin("/ws", "s1", ""); !ok {
+		t.Fatalf("requests without a key are never deduplicated")
+	}
+}
@@ -0,0 +1,107 @@
+package agent
+
+import (
+	"context"
+	"sync"
+
+	"cando/internal/llm"
+)
+
+// requestTracker holds the provider call running in one workspace, so it can
+// be cancelled without touching turns in other workspaces, and the tokens
+// and requests used there.
+type requestTracker struct {
+	mu        sync.Mutex
+	cancel    context.CancelFunc
+	tokens    int
+	requests  int
+	toolCalls int
+}
+
+type requestTrackerKey struct{}
+
+// withRequestTracker makes the turn's provider calls register with t.
+func withRequestTracker(ctx context.Context, t *requestTracker) context.Context {
+	return context.WithValue(ctx, requestTrackerKey{}, t)
+}
+
+// requestTrackerFor returns the tracker of the turn's workspace, or the
+// agent's own for CLI turns.
+func (a *Agent) requestTrackerFor(ctx context.Context) *requestTracker {
+	if t, ok := ctx.Value(requestTrackerKey{}).(*requestTracker); ok && t != nil {
+		return t
+	}
+	return &a.requests
+}
+
+func (t *requestTracker) begin(cancel context.CancelFunc) {
+	t.mu.Lock()
+	t.cancel = cancel
+	t.mu.Unlock()
+}
+
+func (t *requestTracker) end() {
+	t.mu.Lock()
+	t.cancel = nil
+	t.mu.Unlock()
+}
+
+// cancelRequest cancels the running provider call and reports whether there
+// was one.
+func (t *requestTracker) cancelRequest() bool {
+	t.mu.Lock()
+	cancel := t.cancel
+	t.cancel = nil
+	t.mu.Unlock()
+	if cancel != nil {
+		cancel()
+		return true
+	}
+	return false
+}
+
+func (t *requestTracker) running() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.cancel != nil
+}
+
+func (t *requestTracker) count(resp llm.ChatResponse) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.requests++
+	if resp.Usage != nil {
+		t.tokens += resp.Usage.TotalTokens
+	}
+	if len(resp.Choices) > 0 {
+		t.toolCalls += len(resp.Choices[0].Message.ToolCalls)
+	}
+}
+
+func (t *requestTracker) totalTokens() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.tokens
+}
+
+func (t *requestTracker) usage() RunUsage {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return RunUsage{Requests: t.requests, Tokens: t.tokens, ToolCalls: t.toolCalls}
+}
+
+// CancelRequest cancels the provider call running in the workspace.
+func (c *WorkspaceContext) CancelRequest() bool {
+	return c.requests.cancelRequest()
+}
+
+// HasInFlightRequest reports whether a provider call is running in the
+// workspace.
+func (c *WorkspaceContext) HasInFlightRequest() bool {
+	return c.requests.running()
+}
+
+// TotalTokens returns the tokens used by turns in the workspace.
+func (c *WorkspaceContext) TotalTokens() int {
+	return c.requests.totalTokens()
+}
@@ -0,0 +1,44 @@
+package agent
+
+import (
+	"context"
+	"testing"
+
+	"cando/internal/llm"
+)
+
+func TestInFlightRequestsArePerWorkspace(t *testing.T) {
+	a := &Agent{workspaceContexts: map[string]*WorkspaceContext{}}
+	wsA := &WorkspaceContext{root: "/a"}
+	wsB := &WorkspaceContext{root: "/b"}
+	a.workspaceContexts["/a"], a.workspaceContexts["/b"] = wsA, wsB
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	requests := a.requestTrackerFor(withRequestTracker(ctx, &wsA.requests))
+	requests.begin(cancel)
+	if !wsA.HasInFlightRequest() || wsB.HasInFlightRequest() {
+		t.Fatalf("running request not scoped to its workspace: a=%v b=%v", wsA.HasInFlightRequest(), wsB.HasInFlightRequest())
+	}
+	if !a.HasInFlightRequest() {
+		t.Fatalf("agent should report a request running in any workspace")
+	}
+	if wsB.CancelRequest() || ctx.Err() != nil {
+		t.Fatalf("cancelling another workspace touched the running request")
+	}
+
+	a.countRequest(requests, llm.ChatResponse{Usage: &llm.Usage{TotalTokens: 120}})
+	if wsA.TotalTokens() != 120 || wsB.TotalTokens() != 0 || a.Usage().Tokens != 120 {
+		t.Fatalf("tokens not counted per workspace: a=%d b=%d total=%d", wsA.TotalTokens(), wsB.TotalTokens(), a.Usage().Tokens)
+	}
+
+	if !wsA.CancelRequest() || ctx.Err() == nil {
+		t.Fatalf("request not cancelled")
+	}
+	if a.HasInFlightRequest() {
+		t.Fatalf("cancelled request still reported as running")
+	}
+	if a.requestTrackerFor(context.Background()) != &a.requests {
+		t.Fatalf("CLI turns should use the agent's tracker")
+	}
+}
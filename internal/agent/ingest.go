@@ -0,0 +1,232 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"cando/internal/contextprofile"
+	"cando/internal/llm"
+	"cando/internal/prompts"
+	"cando/internal/state"
+)
+
+// Limits for :ingest so large doc trees stay within a few model calls.
+const (
+	ingestMaxFiles     = 60
+	ingestMaxFileBytes = 30 * 1024
+	ingestMaxTotal     = 300 * 1024
+	ingestBatchChars   = 24 * 1024 // Document text per facts-extraction call
+)
+
+var (
+	// ingestRootFiles are top-level documents read when present.
+	ingestRootFiles = []string{"README.md", "README.rst", "README.txt", "README", "ARCHITECTURE.md", "CONTRIBUTING.md"}
+	// ingestDirs are walked recursively for documentation and ADRs.
+	ingestDirs = []string{"docs", "doc", "adr", "adrs", "decisions", "architecture"}
+	ingestExts = map[string]bool{".md": true, ".markdown": true, ".rst": true, ".txt": true, ".adoc": true}
+)
+
+// ingestDoc is a documentation file read for ingestion.
+type ingestDoc struct {
+	Path      string // Relative to the workspace root
+	Content   string
+	Truncated bool
+}
+
+// ingestResult reports what :ingest stored.
+type ingestResult struct {
+	Files    []string `json:"files"`
+	Memories int      `json:"memories"`
+	Facts    int      `json:"facts"`
+}
+
+// collectIngestDocs finds README, docs/ and ADR files under root, applying
+// the per-file and total size limits.
+func collectIngestDocs(root string) ([]ingestDoc, error) {
+	var paths []string
+	for _, name := range ingestRootFiles {
+		if info, err := os.Stat(filepath.Join(root, name)); err == nil && info.Mode().IsRegular() {
+			paths = append(paths, name)
+		}
+	}
+	seen := make(map[string]bool)
+	for _, dir := range ingestDirs {
+		base := filepath.Join(root, dir)
+		if info, err := os.Stat(base); err != nil || !info.IsDir() {
+			continue
+		}
+		var found []string
+		_ = filepath.WalkDir(base, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return nil
+			}
+			if d.IsDir() {
+				if path != base && (strings.HasPrefix(d.Name(), ".") || d.Name() == "node_modules") {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if !d.Type().IsRegular() || !ingestExts[strings.ToLower(filepath.Ext(path))] {
+				return nil
+			}
+			rel, err := filepath.Rel(root, path)
+			if err == nil && !seen[rel] {
+				seen[rel] = true
+				found = append(found, rel)
+			}
+			return nil
+		})
+		sort.Strings(found)
+		paths = append(paths, found...)
+	}
+
+	var docs []ingestDoc
+	total := 0
+	for _, rel := range paths {
+		if len(docs) >= ingestMaxFiles || total >= ingestMaxTotal {
+			break
+		}
+		data, err := os.ReadFile(filepath.Join(root, rel))
+		if err != nil {
+			continue
+		}
+		content := strings.TrimSpace(string(data))
+		if content == "" {
+			continue
+		}
+		doc := ingestDoc{Path: filepath.ToSlash(rel)}
+		limit := min(ingestMaxFileBytes, ingestMaxTotal-total)
+		if len(content) > limit {
+			content = content[:limit]
+			doc.Truncated = true
+		}
+		doc.Content = content
+		total += len(content)
+		docs = append(docs, doc)
+	}
+	return docs, nil
+}
+
+// ingestProjectDocs reads the workspace's documentation, stores each file as
+// a recallable memory (when the profile supports it) and merges facts
+// extracted by the summary model into project_facts.json.
+func (a *Agent) ingestProjectDocs(ctx context.Context, root string, profile contextprofile.Profile, progress func(string)) (*ingestResult, error) {
+	if progress == nil {
+		progress = func(string) {}
+	}
+	docs, err := collectIngestDocs(root)
+	if err != nil {
+		return nil, err
+	}
+	if len(docs) == 0 {
+		return nil, errors.New("no README, docs/ or ADR files found in the workspace")
+	}
+	result := &ingestResult{}
+	for _, doc := range docs {
+		result.Files = append(result.Files, doc.Path)
+	}
+
+	if seeder, ok := profile.(contextprofile.MemorySeeder); ok {
+		for _, doc := range docs {
+			progress(fmt.Sprintf("Summarizing %s...", doc.Path))
+			if _, err := seeder.SeedMemory(ctx, doc.Path, doc.Content); err != nil {
+				if ctx.Err() != nil {
+					return nil, ctx.Err()
+				}
+				a.logger.Printf("ingest: memory for %s failed: %v", doc.Path, err)
+				continue
+			}
+			result.Memories++
+		}
+	}
+
+	facts := loadProjectFacts(root)
+	model := a.cfg.Load().SummaryModelFor(a.ActiveProviderKey())
+	batches := batchIngestDocs(docs)
+	for i, batch := range batches {
+		progress(fmt.Sprintf("Extracting project facts (%d/%d)...", i+1, len(batches)))
+		merged, err := a.extractDocFacts(ctx, model, batch, facts)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			return nil, err
+		}
+		facts = merged
+	}
+	if err := saveProjectFacts(root, facts); err != nil {
+		return nil, fmt.Errorf("save project facts: %w", err)
+	}
+	result.Facts = len(facts)
+	return result, nil
+}
+
+// batchIngestDocs groups documents into prompt-sized chunks of text.
+func batchIngestDocs(docs []ingestDoc) []string {
+	var batches []string
+	var current strings.Builder
+	for _, doc := range docs {
+		section := fmt.Sprintf("=== %s ===\n%s\n\n", doc.Path, doc.Content)
+		if current.Len() > 0 && current.Len()+len(section) > ingestBatchChars {
+			batches = append(batches, current.String())
+			current.Reset()
+		}
+		current.WriteString(section)
+	}
+	if current.Len() > 0 {
+		batches = append(batches, current.String())
+	}
+	return batches
+}
+
+func (a *Agent) extractDocFacts(ctx context.Context, model, documents string, existing []string) ([]string, error) {
+	existingJSON, _ := json.Marshal(existing)
+	resp, err := a.client.Chat(ctx, llm.ChatRequest{
+		Model: model,
+		Messages: []state.Message{
+			{Role: "system", Content: prompts.DocsIngest()},
+			{Role: "user", Content: fmt.Sprintf("Documents:\n%s\nExisting facts:\n%s", documents, string(existingJSON))},
+		},
+		Temperature: 0.3,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("facts extraction LLM call failed: %w", err)
+	}
+	if len(resp.Choices) == 0 {
+		return nil, fmt.Errorf("no response from LLM")
+	}
+	facts, err := parseFactsResponse(resp.Choices[0].Message.Content)
+	if err != nil {
+		return nil, fmt.Errorf("parse facts response: %w", err)
+	}
+	return facts, nil
+}
+
+// handleIngestCommand runs :ingest for the web UI, streaming progress as
+// status events.
+func (s *webServer) handleIngestCommand(ctx context.Context, wsCtx *WorkspaceContext, sendEvent func(string, any) error) error {
+	progress := func(message string) {
+		sendEvent("status", map[string]any{"message": message})
+	}
+	result, err := s.agent.ingestProjectDocs(ctx, wsCtx.root, wsCtx.profile, progress)
+	if err != nil {
+		return fmt.Errorf("ingest failed: %w", err)
+	}
+	sendEvent("assistant_message", map[string]any{
+		"content": formatIngestResult(result),
+		"role":    "assistant",
+	})
+	return nil
+}
+
+func formatIngestResult(result *ingestResult) string {
+	return fmt.Sprintf("✓ Ingested %d documents (%s): %d memories stored, %d project facts saved.",
+		len(result.Files), strings.Join(result.Files, ", "), result.Memories, result.Facts)
+}
@@ -0,0 +1,55 @@
+package agent
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"cando/internal/contextprofile"
+	"cando/internal/llm"
+	"cando/internal/state"
+)
+
+func TestIngestProjectDocsSeedsFacts(t *testing.T) {
+	t.Setenv("CANDO_CONFIG_DIR", t.TempDir())
+	workspace := t.TempDir()
+	files := map[string]string{
+		"README.md":                   "# Demo\nRun `make dev` to start.",
+		"docs/adr/0001-use-sqlite.md": "We use SQLite because deployments are single-node.",
+		"docs/.drafts/secret.md":      "ignored",
+		"docs/diagram.png":            "binary",
+	}
+	for name, content := range files {
+		path := filepath.Join(workspace, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	client := newScriptedClient(llm.ChatResponse{
+		Choices: []llm.ChatChoice{{Message: state.Message{
+			Role:    "assistant",
+			Content: "Here you go:\n[\"Start the dev server with make dev\", \"SQLite is used because deployments are single-node\"]",
+		}}},
+	})
+	agent := newTestAgent(t, client, baseTestConfig(workspace))
+
+	profile, err := contextprofile.New("default", contextprofile.Dependencies{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := agent.ingestProjectDocs(t.Context(), workspace, profile, nil)
+	if err != nil {
+		t.Fatalf("ingest: %v", err)
+	}
+	if strings.Join(result.Files, ",") != "README.md,docs/adr/0001-use-sqlite.md" {
+		t.Fatalf("unexpected files: %v", result.Files)
+	}
+	if result.Facts != 2 || len(loadProjectFacts(workspace)) != 2 {
+		t.Fatalf("expected 2 facts saved, got %d", result.Facts)
+	}
+}
@@ -0,0 +1,224 @@
+package agent
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"cando/internal/contextprofile"
+)
+
+const (
+	knowledgeFormat  = "cando-knowledge"
+	knowledgeVersion = 1
+	// knowledgeFile is where :export-knowledge writes by default. It sits in
+	// the workspace so it can be committed and follow the repository.
+	knowledgeFile     = "cando-knowledge.json"
+	maxKnowledgeBytes = 64 << 20
+)
+
+// knowledgeArchive is the portable form of a workspace's project facts and
+// memories.
+type knowledgeArchive struct {
+	Format     string                        `json:"format"`
+	Version    int                           `json:"version"`
+	ExportedAt time.Time                     `json:"exported_at"`
+	Workspace  string                        `json:"workspace,omitempty"` // Folder name, informational only
+	Facts      []string                      `json:"facts"`
+	Memories   []contextprofile.MemoryRecord `json:"memories"`
+}
+
+type knowledgeImportResult struct {
+	Facts           int `json:"facts"`            // New facts added
+	Memories        int `json:"memories"`         // New memories added
+	SkippedMemories int `json:"skipped_memories"` // Not imported because the profile keeps no memories
+}
+
+// exportKnowledge collects the project facts and, when the profile keeps
+// them, the memories of the workspace at root.
+func exportKnowledge(root string, profile contextprofile.Profile) (*knowledgeArchive, error) {
+	archive := &knowledgeArchive{
+		Format:     knowledgeFormat,
+		Version:    knowledgeVersion,
+		ExportedAt: time.Now().UTC(),
+		Workspace:  filepath.Base(root),
+		Facts:      loadProjectFacts(root),
+		Memories:   []contextprofile.MemoryRecord{},
+	}
+	if archive.Facts == nil {
+		archive.Facts = []string{}
+	}
+	if porter, ok := profile.(contextprofile.MemoryPorter); ok {
+		memories, err := porter.ExportMemories()
+		if err != nil {
+			return nil, fmt.Errorf("export memories: %w", err)
+		}
+		archive.Memories = append(archive.Memories, memories...)
+	}
+	return archive, nil
+}
+
+// parseKnowledgeArchive decodes and checks an exported archive.
+func parseKnowledgeArchive(data []byte) (*knowledgeArchive, error) {
+	var archive knowledgeArchive
+	if err := json.Unmarshal(data, &archive); err != nil {
+		return nil, fmt.Errorf("parse knowledge archive: %w", err)
+	}
+	if archive.Format != knowledgeFormat {
+		return nil, errors.New("not a Cando knowledge archive")
+	}
+	if archive.Version > knowledgeVersion {
+		return nil, fmt.Errorf("knowledge archive version %d is newer than this Cando supports (%d)", archive.Version, knowledgeVersion)
+	}
+	return &archive, nil
+}
+
+// importKnowledge merges an archive into the workspace at root. Facts
+// already known (ignoring case and spacing) and memories with existing IDs
+// are skipped, so importing the same archive twice changes nothing.
+func importKnowledge(root string, profile contextprofile.Profile, archive *knowledgeArchive) (knowledgeImportResult, error) {
+	var result knowledgeImportResult
+	facts, added := mergeFacts(loadProjectFacts(root), archive.Facts)
+	if added > 0 {
+		if err := saveProjectFacts(root, facts); err != nil {
+			return result, fmt.Errorf("save project facts: %w", err)
+		}
+	}
+	result.Facts = added
+
+	if len(archive.Memories) == 0 {
+		return result, nil
+	}
+	porter, ok := profile.(contextprofile.MemoryPorter)
+	if !ok {
+		result.SkippedMemories = len(archive.Memories)
+		return result, nil
+	}
+	n, err := porter.ImportMemories(archive.Memories)
+	result.Memories = n
+	if err != nil {
+		return result, fmt.Errorf("import memories: %w", err)
+	}
+	return result, nil
+}
+
+// mergeFacts appends the incoming facts that existing lacks and returns the
+// merged list with the number added.
+func mergeFacts(existing, incoming []string) ([]string, int) {
+	seen := make(map[string]bool, len(existing))
+	for _, fact := range existing {
+		seen[factKey(fact)] = true
+	}
+	merged := append([]string(nil), existing...)
+	added := 0
+	for _, fact := range incoming {
+		fact = strings.TrimSpace(fact)
+		key := factKey(fact)
+		if key == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		merged = append(merged, fact)
+		added++
+	}
+	return merged, added
+}
+
+func factKey(fact string) string {
+	return strings.ToLower(strings.Join(strings.Fields(fact), " "))
+}
+
+func formatKnowledgeImport(result knowledgeImportResult) string {
+	msg := fmt.Sprintf("Imported %d new facts and %d new memories.", result.Facts, result.Memories)
+	if result.SkippedMemories > 0 {
+		msg += fmt.Sprintf(" Skipped %d memories: the current context profile does not store memories.", result.SkippedMemories)
+	}
+	return msg
+}
+
+// knowledgePath resolves the file argument of :export-knowledge and
+// :import-knowledge against the workspace.
+func knowledgePath(root, arg string) string {
+	if arg == "" {
+		arg = knowledgeFile
+	}
+	if filepath.IsAbs(arg) {
+		return arg
+	}
+	return filepath.Join(root, arg)
+}
+
+func writeKnowledgeFile(path string, archive *knowledgeArchive) error {
+	data, err := json.MarshalIndent(archive, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o644)
+}
+
+// handleKnowledgeExport serves the workspace's facts and memories as a
+// downloadable archive.
+func (s *webServer) handleKnowledgeExport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.respondError(w, r, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	workspace := s.getWorkspaceFromRequest(r)
+	if workspace == "" || !s.workspaceExists(workspace) {
+		s.respondError(w, r, http.StatusBadRequest, "select a workspace first")
+		return
+	}
+	wsCtx, err := s.agent.GetOrCreateWorkspaceContext(workspace)
+	if err != nil {
+		s.respondError(w, r, http.StatusInternalServerError, fmt.Sprintf("get workspace context: %v", err))
+		return
+	}
+	archive, err := exportKnowledge(wsCtx.root, wsCtx.profile)
+	if err != nil {
+		s.respondError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", knowledgeFile))
+	s.writeJSON(w, r, archive)
+}
+
+// handleKnowledgeImport merges an uploaded archive into the workspace.
+func (s *webServer) handleKnowledgeImport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		s.respondError(w, r, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	workspace := s.getWorkspaceFromRequest(r)
+	if workspace == "" || !s.workspaceExists(workspace) {
+		s.respondError(w, r, http.StatusBadRequest, "select a workspace first")
+		return
+	}
+	wsCtx, err := s.agent.GetOrCreateWorkspaceContext(workspace)
+	if err != nil {
+		s.respondError(w, r, http.StatusInternalServerError, fmt.Sprintf("get workspace context: %v", err))
+		return
+	}
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxKnowledgeBytes))
+	if err != nil {
+		s.respondError(w, r, http.StatusRequestEntityTooLarge, "archive too large")
+		return
+	}
+	archive, err := parseKnowledgeArchive(data)
+	if err != nil {
+		s.respondError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	result, err := importKnowledge(wsCtx.root, wsCtx.profile, archive)
+	if err != nil {
+		s.respondError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	s.logger.Printf("[ws:%s] imported knowledge: %s", workspace, formatKnowledgeImport(result))
+	s.writeJSON(w, r, result)
+}
@@ -0,0 +1,64 @@
+package agent
+
+import (
+	"encoding/json"
+	"testing"
+
+	"cando/internal/contextprofile"
+)
+
+func TestKnowledgeRoundTrip(t *testing.T) {
+	t.Setenv("CANDO_CONFIG_DIR", t.TempDir())
+	src := t.TempDir()
+	dst := t.TempDir()
+	if err := saveProjectFacts(src, []string{"Uses Go 1.24", "Tests live next to the code"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := saveProjectFacts(dst, []string{"tests  live next to the CODE", "Deploys with make release"}); err != nil {
+		t.Fatal(err)
+	}
+	profile, err := contextprofile.New("default", contextprofile.Dependencies{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	archive, err := exportKnowledge(src, profile)
+	if err != nil {
+		t.Fatalf("export: %v", err)
+	}
+	archive.Memories = []contextprofile.MemoryRecord{{ID: "mem-1", Content: "x"}}
+	data, err := json.Marshal(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := parseKnowledgeArchive(data)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+
+	result, err := importKnowledge(dst, profile, parsed)
+	if err != nil {
+		t.Fatalf("import: %v", err)
+	}
+	if result.Facts != 1 || result.SkippedMemories != 1 {
+		t.Fatalf("unexpected result %+v", result)
+	}
+	facts := loadProjectFacts(dst)
+	if len(facts) != 3 || facts[2] != "Uses Go 1.24" {
+		t.Fatalf("unexpected merged facts %q", facts)
+	}
+
+	again, err := importKnowledge(dst, profile, parsed)
+	if err != nil || again.Facts != 0 {
+		t.Fatalf("second import should add nothing, got %+v (%v)", again, err)
+	}
+}
+
+func TestParseKnowledgeArchiveRejectsOtherFiles(t *testing.T) {
+	if _, err := parseKnowledgeArchive([]byte(`{"facts":["a"]}`)); err == nil {
+		t.Fatal("expected an error for a file without the archive format")
+	}
+	if _, err := parseKnowledgeArchive([]byte(`{"format":"cando-knowledge","version":99}`)); err == nil {
+		t.Fatal("expected an error for a newer archive version")
+	}
+}
@@ -0,0 +1,20 @@
+package agent
+
+import (
+	"os"
+	"testing"
+)
+
+// TestMain points the config directory at a temporary one, so tests that do
+// not set CANDO_CONFIG_DIR themselves never write logs or provider error
+// records into the user's ~/.cando.
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "cando-agent-test-")
+	if err != nil {
+		panic(err)
+	}
+	os.Setenv("CANDO_CONFIG_DIR", dir)
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
@@ -0,0 +1,32 @@
+package agent
+
+import (
+	"fmt"
+	"net/http"
+
+	"cando/internal/tooling"
+)
+
+// handleMCP reports the workspace's MCP servers and the tools each one
+// contributed.
+func (s *webServer) handleMCP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.respondError(w, r, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	workspace := s.getWorkspaceFromRequest(r)
+	if workspace == "" {
+		s.respondError(w, r, http.StatusBadRequest, "workspace required")
+		return
+	}
+	wsCtx, err := s.agent.GetOrCreateWorkspaceContext(workspace)
+	if err != nil {
+		s.respondError(w, r, http.StatusInternalServerError, fmt.Sprintf("failed to get workspace: %v", err))
+		return
+	}
+	servers := wsCtx.mcpServers.Status()
+	if servers == nil {
+		servers = []tooling.MCPServerStatus{}
+	}
+	s.writeJSON(w, r, map[string]any{"servers": servers})
+}
@@ -0,0 +1,331 @@
+package agent
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"cando/internal/tooling"
+)
+
+// Default milestone thresholds, used when a workspace has no override.
+const (
+	defaultLongTurnMinutes    = 10
+	defaultToolMilestoneEvery = 10
+	webhookTimeout            = 10 * time.Second
+)
+
+// Milestone kinds emitted as "milestone" stream events.
+const (
+	milestoneFirstToolCall     = "first_tool_call"
+	milestoneToolsExecuted     = "tools_executed"
+	milestonePlanStepCompleted = "plan_step_completed"
+	milestoneTurnLongRunning   = "turn_long_running"
+	milestoneTurnCompleted     = "turn_completed"
+)
+
+// notificationSettings configures milestone thresholds and the optional
+// webhook for one workspace. Stored as notifications.json in project storage.
+type notificationSettings struct {
+	WebhookURL         string   `json:"webhook_url"`
+	LongTurnMinutes    int      `json:"long_turn_minutes"`
+	ToolMilestoneEvery int      `json:"tool_milestone_every"`
+	WebhookEvents      []string `json:"webhook_events"`
+}
+
+func defaultNotificationSettings() notificationSettings {
+	return notificationSettings{
+		LongTurnMinutes:    defaultLongTurnMinutes,
+		ToolMilestoneEvery: defaultToolMilestoneEvery,
+		WebhookEvents:      []string{milestoneTurnLongRunning, milestoneTurnCompleted},
+	}
+}
+
+func notificationSettingsPath(workspaceRoot string) (string, error) {
+	storageRoot, err := ProjectStorageRoot(workspaceRoot)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(storageRoot, "notifications.json"), nil
+}
+
+// loadNotificationSettings returns the workspace settings, falling back to
+// defaults when the file is missing or unreadable.
+func loadNotificationSettings(workspaceRoot string) notificationSettings {
+	settings := defaultNotificationSettings()
+	if workspaceRoot == "" {
+		return settings
+	}
+	path, err := notificationSettingsPath(workspaceRoot)
+	if err != nil {
+		return settings
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return settings
+	}
+	if err := json.Unmarshal(content, &settings); err != nil {
+		return defaultNotificationSettings()
+	}
+	if settings.LongTurnMinutes <= 0 {
+		settings.LongTurnMinutes = defaultLongTurnMinutes
+	}
+	if settings.ToolMilestoneEvery <= 0 {
+		settings.ToolMilestoneEvery = defaultToolMilestoneEvery
+	}
+	return settings
+}
+
+func saveNotificationSettings(workspaceRoot string, settings notificationSettings) error {
+	path, err := notificationSettingsPath(workspaceRoot)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(settings, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0o644)
+}
+
+// milestoneTracker watches a turn's events and emits milestone events to the
+// stream and, for selected kinds, to the workspace webhook.
+type milestoneTracker struct {
+	settings  notificationSettings
+	workspace string
+	logger    *log.Logger
+	callback  StreamCallback
+	start     time.Time
+
+	mu             sync.Mutex // Serializes callback use across the timer goroutine
+	toolCalls      int
+	completedSteps map[string]bool
+	ticker         *time.Ticker
+	done           chan struct{}
+}
+
+func newMilestoneTracker(ctx context.Context, wsCtx *WorkspaceContext, logger *log.Logger, callback StreamCallback) *milestoneTracker {
+	t := &milestoneTracker{
+		settings:       loadNotificationSettings(wsCtx.root),
+		workspace:      wsCtx.root,
+		logger:         logger,
+		callback:       callback,
+		start:          time.Now(),
+		completedSteps: make(map[string]bool),
+		done:           make(chan struct{}),
+	}
+
+	// Seed with steps already completed so only new completions are reported
+	toolCtx := tooling.WithSessionStorage(ctx, wsCtx.states.Current().StoragePath())
+	if plan, err := fetchPlanSnapshotFromTools(toolCtx, wsCtx.tools); err == nil && plan != nil {
+		for _, step := range plan.Steps {
+			if step.Status == "completed" {
+				t.completedSteps[step.Step] = true
+			}
+		}
+	}
+
+	interval := time.Duration(t.settings.LongTurnMinutes) * time.Minute
+	t.ticker = time.NewTicker(interval)
+	go func() {
+		for {
+			select {
+			case <-t.ticker.C:
+				t.mu.Lock()
+				t.emitLocked(milestoneTurnLongRunning, fmt.Sprintf("Turn still running after %s", t.elapsed()), nil)
+				t.mu.Unlock()
+			case <-t.done:
+				return
+			}
+		}
+	}()
+	return t
+}
+
+// Callback returns a StreamCallback that forwards events and records
+// milestones. It stays nil when there is neither a stream nor a webhook.
+func (t *milestoneTracker) Callback() StreamCallback {
+	if t.callback == nil && t.settings.WebhookURL == "" {
+		return nil
+	}
+	return func(eventType string, data any) error {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		var err error
+		if t.callback != nil {
+			err = t.callback(eventType, data)
+		}
+		t.observeLocked(eventType, data)
+		return err
+	}
+}
+
+func (t *milestoneTracker) observeLocked(eventType string, data any) {
+	switch eventType {
+	case "tool_call_started":
+		t.toolCalls++
+		if t.toolCalls == 1 {
+			t.emitLocked(milestoneFirstToolCall, "Agent started using tools", nil)
+		} else if t.toolCalls%t.settings.ToolMilestoneEvery == 0 {
+			t.emitLocked(milestoneToolsExecuted, fmt.Sprintf("%d tool calls executed", t.toolCalls), nil)
+		}
+	case "plan_update":
+		payload, ok := data.(map[string]any)
+		if !ok {
+			return
+		}
+		raw, _ := payload["plan"].(string)
+		plan, err := parsePlanSnapshot(raw)
+		if err != nil {
+			return
+		}
+		for _, step := range plan.Steps {
+			if step.Status == "completed" && !t.completedSteps[step.Step] {
+				t.completedSteps[step.Step] = true
+				t.emitLocked(milestonePlanStepCompleted, "Plan step completed: "+step.Step, map[string]any{"step": step.Step})
+			}
+		}
+	}
+}
+
+// Finish stops the timer and reports completion for turns that ran long.
+func (t *milestoneTracker) Finish(turnErr error) {
+	t.ticker.Stop()
+	close(t.done)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if time.Since(t.start) < time.Duration(t.settings.LongTurnMinutes)*time.Minute {
+		return
+	}
+	status := "done"
+	message := fmt.Sprintf("Turn finished after %s", t.elapsed())
+	if turnErr != nil {
+		status = "error"
+		message = fmt.Sprintf("Turn failed after %s: %v", t.elapsed(), turnErr)
+	}
+	t.emitLocked(milestoneTurnCompleted, message, map[string]any{"status": status})
+}
+
+func (t *milestoneTracker) elapsed() time.Duration {
+	return time.Since(t.start).Round(time.Second)
+}
+
+func (t *milestoneTracker) emitLocked(kind, message string, extra map[string]any) {
+	payload := map[string]any{
+		"kind":            kind,
+		"message":         message,
+		"elapsed_seconds": int(time.Since(t.start).Seconds()),
+		"tool_calls":      t.toolCalls,
+	}
+	for k, v := range extra {
+		payload[k] = v
+	}
+	if t.callback != nil {
+		if err := t.callback("milestone", payload); err != nil && t.logger != nil {
+			t.logger.Printf("[ws:%s] milestone %s event failed: %v", t.workspace, kind, err)
+		}
+	}
+	if t.settings.WebhookURL != "" && t.wantsWebhook(kind) {
+		go postMilestoneWebhook(t.settings.WebhookURL, t.workspace, payload, t.logger)
+	}
+}
+
+func (t *milestoneTracker) wantsWebhook(kind string) bool {
+	for _, k := range t.settings.WebhookEvents {
+		if k == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// postMilestoneWebhook sends a milestone to a Slack/Discord-compatible
+// incoming webhook ("text" for Slack, "content" for Discord).
+func postMilestoneWebhook(webhookURL, workspace string, payload map[string]any, logger *log.Logger) {
+	text := fmt.Sprintf("[cando] %s: %s", filepath.Base(workspace), payload["message"])
+	body, err := json.Marshal(map[string]any{
+		"text":      text,
+		"content":   text,
+		"workspace": workspace,
+		"milestone": payload,
+	})
+	if err != nil {
+		return
+	}
+	client := &http.Client{Timeout: webhookTimeout}
+	resp, err := client.Post(webhookURL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		if logger != nil {
+			logger.Printf("[ws:%s] milestone webhook failed: %v", workspace, err)
+		}
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 && logger != nil {
+		logger.Printf("[ws:%s] milestone webhook returned %s", workspace, resp.Status)
+	}
+}
+
+// handleNotifications reads (GET) or updates (POST) the workspace's milestone
+// notification settings.
+func (s *webServer) handleNotifications(w http.ResponseWriter, r *http.Request) {
+	workspace := s.getWorkspaceFromRequest(r)
+	if workspace == "" || !s.workspaceExists(workspace) {
+		s.respondError(w, r, http.StatusBadRequest, "select a workspace first")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		s.writeJSON(w, r, loadNotificationSettings(workspace))
+
+	case http.MethodPost:
+		var req notificationSettings
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			s.respondError(w, r, http.StatusBadRequest, "invalid request body")
+			return
+		}
+		req.WebhookURL = strings.TrimSpace(req.WebhookURL)
+		if req.WebhookURL != "" {
+			parsed, err := url.Parse(req.WebhookURL)
+			if err != nil || (parsed.Scheme != "https" && parsed.Scheme != "http") || parsed.Host == "" {
+				s.respondError(w, r, http.StatusBadRequest, "webhook_url must be an http(s) URL")
+				return
+			}
+		}
+		if req.LongTurnMinutes < 0 || req.ToolMilestoneEvery < 0 {
+			s.respondError(w, r, http.StatusBadRequest, "thresholds must be positive")
+			return
+		}
+		if req.LongTurnMinutes == 0 {
+			req.LongTurnMinutes = defaultLongTurnMinutes
+		}
+		if req.ToolMilestoneEvery == 0 {
+			req.ToolMilestoneEvery = defaultToolMilestoneEvery
+		}
+		if req.WebhookEvents == nil {
+			req.WebhookEvents = defaultNotificationSettings().WebhookEvents
+		}
+		if err := saveNotificationSettings(workspace, req); err != nil {
+			s.respondError(w, r, http.StatusInternalServerError, fmt.Sprintf("failed to save notification settings: %v", err))
+			return
+		}
+		s.writeJSON(w, r, req)
+
+	default:
+		s.respondError(w, r, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
@@ -0,0 +1,36 @@
+package agent
+
+import (
+	"testing"
+)
+
+func TestMilestoneTrackerEmitsToolAndPlanMilestones(t *testing.T) {
+	var kinds []string
+	tracker := &milestoneTracker{
+		settings:       notificationSettings{LongTurnMinutes: 10, ToolMilestoneEvery: 2},
+		completedSteps: map[string]bool{"already done": true},
+		callback: func(eventType string, data any) error {
+			if eventType == "milestone" {
+				kinds = append(kinds, data.(map[string]any)["kind"].(string))
+			}
+			return nil
+		},
+	}
+	cb := tracker.Callback()
+	for i := 0; i < 3; i++ {
+		cb("tool_call_started", map[string]any{})
+	}
+	cb("plan_update", map[string]any{
+		"plan": `{"steps":[{"step":"already done","status":"completed"},{"step":"write code","status":"completed"},{"step":"test","status":"pending"}]}`,
+	})
+
+	want := []string{milestoneFirstToolCall, milestoneToolsExecuted, milestonePlanStepCompleted}
+	if len(kinds) != len(want) {
+		t.Fatalf("expected milestones %v, got %v", want, kinds)
+	}
+	for i := range want {
+		if kinds[i] != want[i] {
+			t.Fatalf("expected milestones %v, got %v", want, kinds)
+		}
+	}
+}
@@ -0,0 +1,182 @@
+package agent
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"cando/internal/config"
+	"cando/internal/logging"
+	"cando/internal/safefile"
+)
+
+// OpenRouter models cache. The transformed list is kept in memory and in
+// <config dir>/cache, so a restart serves the last list at once. A stale
+// list is still served while a background fetch replaces it.
+const (
+	openrouterModelsURL     = "https://openrouter.ai/api/frontend/models/find?order=top-weekly"
+	openrouterCacheDuration = 15 * time.Minute
+	openrouterFetchTimeout  = 10 * time.Second
+	openrouterRetryInterval = time.Minute // Between background fetches after a failure
+	openrouterCacheFile     = "openrouter-models.json"
+)
+
+type openrouterModelCache struct {
+	data        []byte
+	fetchedAt   time.Time
+	loaded      bool          // Disk copy read
+	attemptedAt time.Time     // Last fetch started
+	inflight    chan struct{} // Closed when the running fetch ends
+	lastErr     error         // Outcome of the last fetch
+	mu          sync.RWMutex
+}
+
+var orModelCache = &openrouterModelCache{}
+
+// fetchModelList fetches the transformed list; tests replace it.
+var fetchModelList = fetchOpenRouterModels
+
+// cachedModelList is the on-disk form of the cache.
+type cachedModelList struct {
+	FetchedAt time.Time       `json:"fetched_at"`
+	Models    json.RawMessage `json:"models"`
+}
+
+func openrouterModelCachePath() string {
+	return filepath.Join(config.GetConfigDir(), "cache", openrouterCacheFile)
+}
+
+// loadLocked reads the disk copy once. It only replaces what is in memory
+// when it is newer, e.g. written by another instance.
+func (c *openrouterModelCache) loadLocked() {
+	if c.loaded {
+		return
+	}
+	c.loaded = true
+	data, _, err := safefile.Read(openrouterModelCachePath(), safefile.ValidJSON)
+	if err != nil {
+		return
+	}
+	var cached cachedModelList
+	if err := json.Unmarshal(data, &cached); err != nil || len(cached.Models) == 0 {
+		return
+	}
+	if cached.FetchedAt.After(c.fetchedAt) {
+		c.data, c.fetchedAt = cached.Models, cached.FetchedAt
+		logging.DevLog("openrouter models: loaded disk cache from %s", cached.FetchedAt.Format(time.RFC3339))
+	}
+}
+
+// refresh fetches the list and stores it in memory and on disk. A caller
+// arriving while a fetch runs waits for that fetch instead of starting
+// another. It returns the cached list and the fetch error.
+func (c *openrouterModelCache) refresh() ([]byte, error) {
+	c.mu.Lock()
+	if wait := c.inflight; wait != nil {
+		c.mu.Unlock()
+		<-wait
+		c.mu.RLock()
+		defer c.mu.RUnlock()
+		return c.data, c.lastErr
+	}
+	done := make(chan struct{})
+	c.inflight = done
+	c.attemptedAt = time.Now()
+	c.mu.Unlock()
+
+	logging.DevLog("openrouter models: fetching from API...")
+	data, err := fetchModelList()
+	fetchedAt := time.Now()
+	if err == nil {
+		if saveErr := saveModelCache(data, fetchedAt); saveErr != nil {
+			logging.ErrorLog("openrouter models: save cache: %v", saveErr)
+		}
+	} else {
+		logging.DevLog("openrouter models: fetch failed: %v", err)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.inflight = nil
+	c.lastErr = err
+	close(done)
+	if err == nil {
+		c.data, c.fetchedAt = data, fetchedAt
+	}
+	return c.data, err
+}
+
+// saveModelCache writes the list atomically, so instances sharing the
+// config directory never read a partial file.
+func saveModelCache(models []byte, fetchedAt time.Time) error {
+	data, err := json.Marshal(cachedModelList{FetchedAt: fetchedAt.UTC(), Models: models})
+	if err != nil {
+		return err
+	}
+	path := openrouterModelCachePath()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	return safefile.Write(path, data, 0o644)
+}
+
+// openRouterModelsJSON returns the cached models, refreshing them in the
+// background once stale. Only an empty cache waits for the API.
+// Fallback chain: cache (memory, then disk) -> fetch API -> embedded JSON
+func openRouterModelsJSON() []byte {
+	orModelCache.mu.Lock()
+	orModelCache.loadLocked()
+	data, fetchedAt := orModelCache.data, orModelCache.fetchedAt
+	retry := orModelCache.inflight == nil && time.Since(orModelCache.attemptedAt) >= openrouterRetryInterval
+	orModelCache.mu.Unlock()
+
+	if len(data) == 0 {
+		if data, err := orModelCache.refresh(); err == nil && len(data) > 0 {
+			return data
+		}
+		logging.DevLog("openrouter models: returning embedded fallback (%d bytes)", len(openrouterModels))
+		return openrouterModels
+	}
+	if time.Since(fetchedAt) >= openrouterCacheDuration && retry {
+		logging.DevLog("openrouter models: cache stale, refreshing in background")
+		go orModelCache.refresh()
+	}
+	return data
+}
+
+func (s *webServer) handleOpenRouterModels(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	data := openRouterModelsJSON()
+	_, _ = w.Write(data)
+}
+
+// handleOpenRouterModelsRefresh refetches the model list now (POST).
+func (s *webServer) handleOpenRouterModelsRefresh(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		s.respondError(w, r, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	orModelCache.mu.Lock()
+	orModelCache.loadLocked()
+	orModelCache.mu.Unlock()
+	data, err := orModelCache.refresh()
+	if err != nil {
+		s.respondError(w, r, http.StatusBadGateway, "refresh models: "+err.Error())
+		return
+	}
+	var models []json.RawMessage
+	_ = json.Unmarshal(data, &models)
+	orModelCache.mu.RLock()
+	fetchedAt := orModelCache.fetchedAt
+	orModelCache.mu.RUnlock()
+	s.writeJSON(w, r, modelCacheStatus{Count: len(models), FetchedAt: fetchedAt})
+}
+
+// modelCacheStatus answers a model list refresh.
+type modelCacheStatus struct {
+	Count     int       `json:"count"`
+	FetchedAt time.Time `json:"fetched_at"`
+}
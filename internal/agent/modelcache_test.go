@@ -0,0 +1,103 @@
+package agent
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestOpenRouterModelCachePersists(t *testing.T) {
+	t.Setenv("CANDO_CONFIG_DIR", t.TempDir())
+	savedCache, savedFetch := orModelCache, fetchModelList
+	t.Cleanup(func() { orModelCache, fetchModelList = savedCache, savedFetch })
+
+	var fetches atomic.Int32
+	list := `[{"id":"a/one"}]`
+	fetchModelList = func() ([]byte, error) {
+		fetches.Add(1)
+		return []byte(list), nil
+	}
+
+	// Nothing cached yet: the first caller waits for the API
+	orModelCache = &openrouterModelCache{}
+	if got := string(openRouterModelsJSON()); got != list {
+		t.Fatalf("first load = %s", got)
+	}
+	if _, err := os.Stat(openrouterModelCachePath()); err != nil {
+		t.Fatalf("cache not written: %v", err)
+	}
+
+	// After a restart the disk copy is served without a fetch
+	orModelCache = &openrouterModelCache{}
+	fetchModelList = func() ([]byte, error) { return nil, errors.New("offline") }
+	if got := string(openRouterModelsJSON()); got != list {
+		t.Fatalf("after restart = %s", got)
+	}
+	if fetches.Load() != 1 {
+		t.Fatalf("fetches = %d, want 1", fetches.Load())
+	}
+
+	// A stale copy is served at once and replaced in the background
+	if err := saveModelCache([]byte(list), time.Now().Add(-time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	orModelCache = &openrouterModelCache{}
+	release := make(chan struct{})
+	fetchModelList = func() ([]byte, error) {
+		<-release
+		return []byte(`[{"id":"b/two"}]`), nil
+	}
+	if got := string(openRouterModelsJSON()); got != list {
+		t.Fatalf("stale load = %s", got)
+	}
+	close(release)
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		orModelCache.mu.RLock()
+		got := string(orModelCache.data)
+		orModelCache.mu.RUnlock()
+		if got == `[{"id":"b/two"}]` {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("background refresh did not land: %s", got)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestOpenRouterModelsRefreshEndpoint(t *testing.T) {
+	t.Setenv("CANDO_CONFIG_DIR", t.TempDir())
+	savedCache, savedFetch := orModelCache, fetchModelList
+	t.Cleanup(func() { orModelCache, fetchModelList = savedCache, savedFetch })
+	orModelCache = &openrouterModelCache{data: []byte(`[]`), fetchedAt: time.Now(), loaded: true}
+	fetchModelList = func() ([]byte, error) { return []byte(`[{"id":"a/one"},{"id":"b/two"}]`), nil }
+
+	s := &webServer{logger: log.New(io.Discard, "", 0)}
+	rec := httptest.NewRecorder()
+	s.handleOpenRouterModelsRefresh(rec, httptest.NewRequest(http.MethodPost, "/api/openrouter-models/refresh", nil))
+	var status struct {
+		Count       int   `json:"count"`
+		FetchedAtMs int64 `json:"fetched_at_ms"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &status); err != nil || rec.Code != http.StatusOK {
+		t.Fatalf("refresh = %d %s", rec.Code, rec.Body.String())
+	}
+	if status.Count != 2 || status.FetchedAtMs == 0 {
+		t.Errorf("status = %+v", status)
+	}
+
+	fetchModelList = func() ([]byte, error) { return nil, errors.New("offline") }
+	rec = httptest.NewRecorder()
+	s.handleOpenRouterModelsRefresh(rec, httptest.NewRequest(http.MethodPost, "/api/openrouter-models/refresh", nil))
+	if rec.Code != http.StatusBadGateway {
+		t.Errorf("failed refresh = %d", rec.Code)
+	}
+}
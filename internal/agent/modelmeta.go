@@ -0,0 +1,107 @@
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"cando/internal/config"
+	"cando/internal/llm"
+)
+
+// applyModelCapabilities drops request features the active model is known
+// not to support, according to the user's model metadata.
+func (a *Agent) applyModelCapabilities(req *llm.ChatRequest) {
+	meta, ok := config.LookupModelMetadata(a.ActiveProviderKey(), req.Model)
+	if !ok {
+		return
+	}
+	if meta.SupportsTools != nil && !*meta.SupportsTools {
+		req.Tools = nil
+	}
+	if meta.SupportsThinking != nil && !*meta.SupportsThinking {
+		req.Thinking = nil
+	}
+}
+
+// handleModelMetadata manages the user's model metadata (models.yaml).
+// GET returns the user entries, or the merged entry for ?key=provider/model.
+// POST {"key", "metadata"} adds or replaces an entry; DELETE ?key= removes
+// one. Compaction thresholds are recomputed after each change.
+func (s *webServer) handleModelMetadata(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		if key := strings.TrimSpace(r.URL.Query().Get("key")); key != "" {
+			provider, model, ok := strings.Cut(key, "/")
+			if !ok {
+				s.respondError(w, r, http.StatusBadRequest, "key must be provider/model")
+				return
+			}
+			meta, found := config.LookupModelMetadata(provider, model)
+			s.writeJSON(w, r, map[string]any{
+				"key":            config.ModelMetadataKey(provider, model),
+				"metadata":       meta,
+				"known":          found,
+				"context_length": config.GetModelContextLength(provider, model),
+			})
+			return
+		}
+		entries, err := config.LoadModelMetadata()
+		if err != nil {
+			s.respondError(w, r, http.StatusInternalServerError, err.Error())
+			return
+		}
+		s.writeJSON(w, r, map[string]any{"models": entries, "path": config.ModelMetadataPath()})
+	case http.MethodPost:
+		var req struct {
+			Key      string               `json:"key"`
+			Metadata config.ModelMetadata `json:"metadata"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			s.respondError(w, r, http.StatusBadRequest, "invalid payload")
+			return
+		}
+		provider, model, ok := strings.Cut(strings.TrimSpace(req.Key), "/")
+		if !ok || provider == "" || model == "" {
+			s.respondError(w, r, http.StatusBadRequest, "key must be provider/model")
+			return
+		}
+		if err := req.Metadata.Validate(); err != nil {
+			s.respondError(w, r, http.StatusBadRequest, err.Error())
+			return
+		}
+		s.updateModelMetadata(w, r, func(entries map[string]config.ModelMetadata) {
+			entries[config.ModelMetadataKey(provider, model)] = req.Metadata
+		})
+	case http.MethodDelete:
+		key := strings.ToLower(strings.TrimSpace(r.URL.Query().Get("key")))
+		if key == "" {
+			s.respondError(w, r, http.StatusBadRequest, "key is required")
+			return
+		}
+		s.updateModelMetadata(w, r, func(entries map[string]config.ModelMetadata) {
+			delete(entries, key)
+		})
+	default:
+		s.respondError(w, r, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+func (s *webServer) updateModelMetadata(w http.ResponseWriter, r *http.Request, edit func(map[string]config.ModelMetadata)) {
+	entries, err := config.LoadModelMetadata()
+	if err != nil {
+		s.respondError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	edit(entries)
+	if err := config.SaveModelMetadata(entries); err != nil {
+		s.respondError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if err := s.agent.reloadProfiles(); err != nil {
+		s.respondError(w, r, http.StatusInternalServerError, fmt.Sprintf("failed to %v", err))
+		return
+	}
+	s.writeJSON(w, r, map[string]any{"models": entries})
+}
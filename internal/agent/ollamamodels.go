@@ -0,0 +1,17 @@
+package agent
+
+import (
+	"net/http"
+
+	"cando/internal/ollama"
+)
+
+// handleOllamaModels lists the models pulled on the local Ollama server for
+// the model picker, or none while it is not running.
+func (s *webServer) handleOllamaModels(w http.ResponseWriter, r *http.Request) {
+	models, err := ollama.InstalledModels(s.agent.cfg.Load().OllamaURL)
+	if err != nil {
+		models = []ollama.Model{}
+	}
+	s.writeJSON(w, r, models)
+}
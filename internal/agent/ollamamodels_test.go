@@ -0,0 +1,79 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"cando/internal/config"
+	"cando/internal/llm"
+	"cando/internal/ollama"
+	"cando/internal/state"
+)
+
+// fakeOllama answers the model list and chat endpoints of an Ollama server.
+func fakeOllama(t *testing.T) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/tags":
+			_, _ = io.WriteString(w, `{"models":[
+				{"name":"qwen2.5-coder:7b","details":{"families":["qwen2"],"parameter_size":"7.6B"}},
+				{"name":"llava:latest","details":{"families":["llama","clip"],"parameter_size":"7B"}}]}`)
+		case "/v1/chat/completions":
+			if auth := r.Header.Get("Authorization"); auth != "" {
+				t.Errorf("authorization sent to Ollama: %q", auth)
+			}
+			_, _ = io.WriteString(w, `{"choices":[{"message":{"role":"assistant","content":"local"},"finish_reason":"stop"}]}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestOllamaModelsAndChat(t *testing.T) {
+	srv := fakeOllama(t)
+
+	models, err := ollama.InstalledModels(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(models) != 2 || models[0].Name != "qwen2.5-coder:7b (7.6B)" || len(models[0].Capabilities) != 1 || len(models[1].Capabilities) != 2 {
+		t.Errorf("models = %+v", models)
+	}
+	if !ollama.HasModel(models, "llava") || !ollama.HasModel(models, "qwen2.5-coder:7b") || ollama.HasModel(models, "qwen2.5-coder") {
+		t.Error("HasModel should match untagged names to :latest only")
+	}
+
+	client := ollama.NewClient(srv.URL, time.Second, log.New(io.Discard, "", 0))
+	resp, err := client.Chat(context.Background(), llm.ChatRequest{Model: "qwen2.5-coder:7b", Messages: []state.Message{{Role: "user", Content: "hi"}}})
+	if err != nil || resp.Choices[0].Message.Content != "local" {
+		t.Fatalf("chat = %+v, %v", resp, err)
+	}
+
+	s := &webServer{agent: &Agent{cfg: newRuntimeConfig(config.Config{OllamaURL: srv.URL})}, logger: log.New(io.Discard, "", 0)}
+	rec := httptest.NewRecorder()
+	s.handleOllamaModels(rec, httptest.NewRequest(http.MethodGet, "/ollama-models.json", nil))
+	var listed []ollama.Model
+	if err := json.Unmarshal(rec.Body.Bytes(), &listed); err != nil || len(listed) != 2 {
+		t.Errorf("listed = %s", rec.Body.String())
+	}
+
+	// No server: an empty list, not an error
+	s.agent.cfg = newRuntimeConfig(config.Config{OllamaURL: "http://127.0.0.1:1"})
+	rec = httptest.NewRecorder()
+	s.handleOllamaModels(rec, httptest.NewRequest(http.MethodGet, "/ollama-models.json", nil))
+	if rec.Code != http.StatusOK || rec.Body.String() != "[]\n" {
+		t.Errorf("without server = %d %q", rec.Code, rec.Body.String())
+	}
+	if config.RequiresAPIKey("ollama") || !config.RequiresAPIKey("openai") {
+		t.Error("only Ollama should work without a key")
+	}
+}
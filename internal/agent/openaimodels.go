@@ -0,0 +1,87 @@
+package agent
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"cando/internal/logging"
+	"cando/internal/openai"
+)
+
+// openAIFallbackModels fill the OpenAI model picker before a key is set or
+// when the model list cannot be fetched.
+var openAIFallbackModels = []string{"gpt-4.1", "gpt-4.1-mini", "gpt-4.1-nano", "gpt-4o", "gpt-4o-mini", "o3", "o4-mini"}
+
+// openAIModelCache keeps the account's model list, per key, as long as the
+// OpenRouter list.
+var openAIModelCache struct {
+	mu        sync.Mutex
+	apiKey    string
+	models    []openai.Model
+	fetchedAt time.Time
+}
+
+// handleOpenAIModels lists models for the OpenAI and Azure pickers, in the
+// shape of openrouter-models.json. ?provider=azure lists the configured
+// deployments, which an Azure key cannot enumerate.
+func (s *webServer) handleOpenAIModels(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Query().Get("provider") == "azure" {
+		s.writeJSON(w, r, s.azureDeployments())
+		return
+	}
+	s.writeJSON(w, r, s.openAIModels(r.Context()))
+}
+
+func (s *webServer) openAIModels(ctx context.Context) []openai.Model {
+	apiKey := ""
+	if s.agent.credManager != nil {
+		if creds, err := s.agent.credManager.Load(); err == nil {
+			apiKey = creds.GetAPIKey("openai")
+		}
+	}
+	if apiKey == "" {
+		return modelEntries(openAIFallbackModels)
+	}
+
+	openAIModelCache.mu.Lock()
+	defer openAIModelCache.mu.Unlock()
+	if openAIModelCache.apiKey == apiKey && time.Since(openAIModelCache.fetchedAt) < openrouterCacheDuration {
+		return openAIModelCache.models
+	}
+	cfg := s.agent.cfg.Load()
+	ctx, cancel := context.WithTimeout(ctx, openrouterFetchTimeout)
+	defer cancel()
+	models, err := openai.NewClient(cfg.OpenAIBaseURL, apiKey, openrouterFetchTimeout, s.logger).ListModels(ctx)
+	if err != nil || len(models) == 0 {
+		logging.DevLog("openai models: fetch failed: %v", err)
+		if openAIModelCache.apiKey == apiKey && len(openAIModelCache.models) > 0 {
+			return openAIModelCache.models
+		}
+		return modelEntries(openAIFallbackModels)
+	}
+	openAIModelCache.apiKey, openAIModelCache.models, openAIModelCache.fetchedAt = apiKey, models, time.Now()
+	return models
+}
+
+// azureDeployments lists the deployment names set for the Azure provider.
+func (s *webServer) azureDeployments() []openai.Model {
+	cfg := s.agent.cfg.Load()
+	var names []string
+	for _, name := range []string{cfg.ModelFor("azure"), cfg.SummaryModelFor("azure"), cfg.VLModelFor("azure")} {
+		if name != "" && !slices.Contains(names, name) {
+			names = append(names, name)
+		}
+	}
+	return modelEntries(names)
+}
+
+func modelEntries(ids []string) []openai.Model {
+	models := make([]openai.Model, 0, len(ids))
+	for _, id := range ids {
+		models = append(models, openai.ModelEntry(id))
+	}
+	return models
+}
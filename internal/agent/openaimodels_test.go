@@ -0,0 +1,99 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"cando/internal/config"
+	"cando/internal/llm"
+	"cando/internal/openai"
+	"cando/internal/state"
+)
+
+func TestAzureClientRequest(t *testing.T) {
+	var gotPath, gotKey, gotAuth string
+	var body map[string]any
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath, gotKey, gotAuth = r.URL.RequestURI(), r.Header.Get("api-key"), r.Header.Get("Authorization")
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		_, _ = io.WriteString(w, `{"choices":[{"message":{"role":"assistant","content":"hi"},"finish_reason":"stop"}]}`)
+	}))
+	defer srv.Close()
+
+	client := openai.NewAzureClient(srv.URL+"/", "secret", "2024-10-21", time.Second, log.New(io.Discard, "", 0))
+	resp, err := client.Chat(context.Background(), llm.ChatRequest{
+		Model:       "o3-mini",
+		Temperature: 0.7,
+		Messages:    []state.Message{{Role: "user", Content: "hello", Thinking: "dropped"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Choices[0].Message.Content != "hi" {
+		t.Errorf("response = %+v", resp)
+	}
+	if gotPath != "/openai/deployments/o3-mini/chat/completions?api-version=2024-10-21" {
+		t.Errorf("path = %s", gotPath)
+	}
+	if gotKey != "secret" || gotAuth != "" {
+		t.Errorf("api-key = %q, authorization = %q", gotKey, gotAuth)
+	}
+	// Reasoning models reject a custom temperature
+	if _, ok := body["temperature"]; ok {
+		t.Errorf("temperature sent for a reasoning model: %v", body)
+	}
+	if _, ok := body["messages"].([]any)[0].(map[string]any)["thinking"]; ok {
+		t.Errorf("thinking sent to OpenAI: %v", body["messages"])
+	}
+}
+
+func TestOpenAIClientErrors(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer sk-test" {
+			t.Errorf("authorization = %q", r.Header.Get("Authorization"))
+		}
+		w.WriteHeader(http.StatusTooManyRequests)
+		_, _ = io.WriteString(w, `{"error":{"message":"You exceeded your current quota","type":"insufficient_quota","code":"insufficient_quota"}}`)
+	}))
+	defer srv.Close()
+
+	client := openai.NewClient(srv.URL, "sk-test", time.Second, log.New(io.Discard, "", 0))
+	_, err := client.Chat(context.Background(), llm.ChatRequest{Model: "gpt-4.1"})
+	pe, ok := llm.IsProviderError(err)
+	if !ok || pe.Type != llm.ErrorTypeInsufficientCredit || pe.Retryable {
+		t.Errorf("error = %v", err)
+	}
+}
+
+func TestOpenAIModelsListsAzureDeployments(t *testing.T) {
+	cfg := config.Config{ProviderModels: map[string]string{"azure": "prod-gpt41"}, ProviderSummaryModels: map[string]string{"azure": "prod-gpt41"}}
+	s := &webServer{agent: &Agent{cfg: newRuntimeConfig(cfg)}, logger: log.New(io.Discard, "", 0)}
+
+	rec := httptest.NewRecorder()
+	s.handleOpenAIModels(rec, httptest.NewRequest(http.MethodGet, "/openai-models.json?provider=azure", nil))
+	var models []openai.Model
+	if err := json.Unmarshal(rec.Body.Bytes(), &models); err != nil {
+		t.Fatal(err)
+	}
+	if len(models) < 1 || models[0].ID != "prod-gpt41" {
+		t.Errorf("deployments = %+v", models)
+	}
+	for _, m := range models[1:] {
+		if m.ID == "prod-gpt41" {
+			t.Errorf("deployment listed twice: %+v", models)
+		}
+	}
+
+	// Without a key the picker offers the built-in list
+	rec = httptest.NewRecorder()
+	s.handleOpenAIModels(rec, httptest.NewRequest(http.MethodGet, "/openai-models.json", nil))
+	if err := json.Unmarshal(rec.Body.Bytes(), &models); err != nil || len(models) != len(openAIFallbackModels) {
+		t.Errorf("fallback = %+v (%v)", models, err)
+	}
+}
@@ -0,0 +1,103 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"cando/internal/state"
+	"cando/internal/tooling"
+)
+
+// overlapTool records how many of its calls run at once.
+type overlapTool struct {
+	name         string
+	active, peak *atomic.Int32
+	sawOthers    atomic.Bool
+}
+
+func (t *overlapTool) Definition() tooling.ToolDefinition {
+	return tooling.ToolDefinition{Type: "function", Function: tooling.ToolFunction{Name: t.name}}
+}
+
+func (t *overlapTool) Call(_ context.Context, args map[string]any) (string, error) {
+	n := t.active.Add(1)
+	defer t.active.Add(-1)
+	if n > 1 {
+		t.sawOthers.Store(true)
+	}
+	for {
+		peak := t.peak.Load()
+		if n <= peak || t.peak.CompareAndSwap(peak, n) {
+			break
+		}
+	}
+	time.Sleep(30 * time.Millisecond)
+	return fmt.Sprintf("%s %v", t.name, args["id"]), nil
+}
+
+func TestParallelToolCalls(t *testing.T) {
+	workspace := t.TempDir()
+	cfg := baseTestConfig(workspace)
+	cfg.ParallelToolCalls = 2
+	agent := newTestAgent(t, newScriptedClient(), cfg)
+
+	var active, peak atomic.Int32
+	grep := &overlapTool{name: "grep", active: &active, peak: &peak}
+	shell := &overlapTool{name: "shell", active: &active, peak: &peak}
+	tools := tooling.NewRegistry(grep, shell)
+
+	var calls []state.ToolCall
+	for i, name := range []string{"grep", "grep", "grep", "shell", "grep"} {
+		calls = append(calls, state.ToolCall{ID: fmt.Sprintf("call-%d", i), Type: "function", Function: state.FunctionCall{Name: name, Arguments: fmt.Sprintf(`{"id":%d}`, i)}})
+	}
+	var mu sync.Mutex
+	var completed []string
+	callback := func(eventType string, data any) error {
+		if eventType == "tool_call_completed" {
+			mu.Lock()
+			completed = append(completed, data.(map[string]any)["id"].(string))
+			mu.Unlock()
+		}
+		return nil
+	}
+
+	conv := agent.states.Current()
+	if err := agent.processToolCallsWithCallback(context.Background(), conv, calls, callback, agent.states, tools, false, workspace); err != nil {
+		t.Fatal(err)
+	}
+	if peak.Load() != 2 {
+		t.Errorf("peak concurrency = %d, want the configured 2", peak.Load())
+	}
+	if shell.sawOthers.Load() {
+		t.Error("shell ran alongside read-only calls")
+	}
+
+	var results []string
+	for _, msg := range conv.Messages() {
+		if msg.Role == "tool" {
+			results = append(results, msg.ToolCallID+": "+msg.Content)
+		}
+	}
+	want := []string{"call-0: grep 0", "call-1: grep 1", "call-2: grep 2", "call-3: shell 3", "call-4: grep 4"}
+	if fmt.Sprint(results) != fmt.Sprint(want) {
+		t.Errorf("results = %q", results)
+	}
+	if fmt.Sprint(completed) != "[call-0 call-1 call-2 call-3 call-4]" {
+		t.Errorf("completed events = %q", completed)
+	}
+
+	// With parallel calls off, nothing overlaps
+	cfg.ParallelToolCalls = -1
+	agent.cfg.Store(cfg)
+	peak.Store(0)
+	if err := agent.processToolCallsWithCallback(context.Background(), conv, calls[:3], nil, agent.states, tools, false, workspace); err != nil {
+		t.Fatal(err)
+	}
+	if peak.Load() != 1 {
+		t.Errorf("peak concurrency = %d with parallel calls off", peak.Load())
+	}
+}
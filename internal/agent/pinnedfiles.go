@@ -0,0 +1,87 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"cando/internal/state"
+	"cando/internal/tooling"
+)
+
+// renderPinnedFiles formats the working set with its current content.
+func renderPinnedFiles(pins *tooling.PinnedFiles) string {
+	files := pins.Contents()
+	if len(files) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	for _, f := range files {
+		if f.Note != "" {
+			fmt.Fprintf(&b, "\n### %s (%s)\n", f.Path, f.Note)
+		} else {
+			fmt.Fprintf(&b, "\n### %s\n", f.Path)
+		}
+		if f.Content != "" || f.Note == "" {
+			fmt.Fprintf(&b, "```\n%s\n```\n", strings.TrimSuffix(f.Content, "\n"))
+		}
+	}
+	return strings.TrimPrefix(b.String(), "\n")
+}
+
+// injectPinnedFiles appends the turn's pinned files to the system message.
+// They are read again for every provider call, so the model always sees the
+// latest content.
+func injectPinnedFiles(messages []state.Message, pins *tooling.PinnedFiles) []state.Message {
+	if pins == nil || len(messages) == 0 {
+		return messages
+	}
+	rendered := renderPinnedFiles(pins)
+	if rendered == "" {
+		return messages
+	}
+
+	// Make a copy to avoid modifying the original
+	result := make([]state.Message, len(messages))
+	copy(result, messages)
+
+	for i, msg := range result {
+		if msg.Role == "system" {
+			result[i].Content = msg.Content + "\n\n---\nPinned files for this turn, as they are on disk right now. Do not read_file them; edits you make show up here on the next request:\n" + rendered
+			break
+		}
+	}
+	return result
+}
+
+// userPins builds the working set for files the user pinned with a prompt.
+// It returns nil when there are none.
+func (s *webServer) userPins(workspace string, paths []string) (*tooling.PinnedFiles, error) {
+	if len(paths) == 0 {
+		return nil, nil
+	}
+	allowExternal := s.agent.cfg.Load().AllowExternalSymlinks
+	pins := tooling.NewPinnedFiles()
+	for _, path := range paths {
+		rel, err := workspaceRelPath(workspace, path, allowExternal)
+		if err != nil {
+			return nil, fmt.Errorf("pin %s: %w", path, err)
+		}
+		abs, err := tooling.ResolveWithin(workspace, rel, allowExternal)
+		if err != nil {
+			return nil, fmt.Errorf("pin %s: %w", path, err)
+		}
+		if err := pins.Pin(abs, rel); err != nil {
+			return nil, fmt.Errorf("pin %s: %w", path, err)
+		}
+	}
+	return pins, nil
+}
+
+// withUserPins hands pins to the turn when the user pinned any files.
+func withUserPins(ctx context.Context, pins *tooling.PinnedFiles) context.Context {
+	if pins == nil {
+		return ctx
+	}
+	return tooling.WithPinnedFiles(ctx, pins)
+}
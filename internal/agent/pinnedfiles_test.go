@@ -0,0 +1,93 @@
+package agent
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"cando/internal/llm"
+	"cando/internal/state"
+	"cando/internal/tooling"
+)
+
+func callReply(name, args string) llm.ChatResponse {
+	return llm.ChatResponse{Choices: []llm.ChatChoice{{
+		Message: state.Message{Role: "assistant", ToolCalls: []state.ToolCall{{
+			ID: "call-" + name, Type: "function", Function: state.FunctionCall{Name: name, Arguments: args},
+		}}},
+		FinishReason: "tool_calls",
+	}}}
+}
+
+func TestPinnedFilesRefreshEachCall(t *testing.T) {
+	workspace := t.TempDir()
+	notes := filepath.Join(workspace, "notes.txt")
+	if err := os.WriteFile(notes, []byte("version one\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	var systems []string
+	client := newScriptedClient(callReply(tooling.PinFileToolName, `{"path":"notes.txt"}`))
+	client.responder = func(req llm.ChatRequest) llm.ChatResponse {
+		systems = append(systems, req.Messages[0].Content)
+		if len(systems) == 1 {
+			// Another tool changes the file between provider calls
+			if err := os.WriteFile(notes, []byte("version two\n"), 0o644); err != nil {
+				t.Error(err)
+			}
+			return callReply("current_datetime", `{}`)
+		}
+		return llm.ChatResponse{Choices: []llm.ChatChoice{{Message: state.Message{Role: "assistant", Content: "done"}, FinishReason: "stop"}}}
+	}
+	agent := newTestAgent(t, client, baseTestConfig(workspace))
+	if err := agent.RunOneShot(context.Background(), "tidy notes"); err != nil {
+		t.Fatal(err)
+	}
+	if len(systems) != 2 {
+		t.Fatalf("provider calls after pinning = %d", len(systems))
+	}
+	if !strings.Contains(systems[0], "### notes.txt\n```\nversion one\n```") {
+		t.Errorf("first call does not carry the pinned file:\n%s", systems[0])
+	}
+	if !strings.Contains(systems[1], "version two") || strings.Contains(systems[1], "version one") {
+		t.Errorf("second call has a stale copy:\n%s", systems[1])
+	}
+}
+
+func TestPinLimits(t *testing.T) {
+	workspace := t.TempDir()
+	write := func(name string, size int) string {
+		path := filepath.Join(workspace, name)
+		if err := os.WriteFile(path, []byte(strings.Repeat("x", size)), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	pins := tooling.NewPinnedFiles()
+	if err := pins.Pin(write("big.txt", tooling.MaxPinnedFileBytes+1), "big.txt"); err == nil {
+		t.Error("pinned a file over the size limit")
+	}
+	if err := pins.Pin(write("bin.dat", 0)+"x", "missing"); err == nil {
+		t.Error("pinned a missing file")
+	}
+	for i := range 3 {
+		name := string(rune('a'+i)) + ".txt"
+		if err := pins.Pin(write(name, tooling.MaxPinnedFileBytes), name); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := pins.Pin(write("d.txt", 10), "d.txt"); err == nil || !strings.Contains(err.Error(), "working set") {
+		t.Errorf("total limit: %v", err)
+	}
+	a := filepath.Join(workspace, "a.txt")
+	if !pins.Unpin(a) || pins.Unpin(a) {
+		t.Error("unpin should report whether the file was pinned")
+	}
+	if err := os.Remove(filepath.Join(workspace, "b.txt")); err != nil {
+		t.Fatal(err)
+	}
+	if got := renderPinnedFiles(pins); !strings.HasPrefix(got, "### b.txt (deleted)\n\n### c.txt\n```\nxxx") {
+		t.Errorf("rendered = %.80q", got)
+	}
+}
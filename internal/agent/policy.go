@@ -0,0 +1,177 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"cando/internal/config"
+	"cando/internal/llm"
+	"cando/internal/prompts"
+	"cando/internal/state"
+)
+
+const (
+	policyViolationLog    = "policy_violations.jsonl"
+	policyExcerptChars    = 200
+	policyModerationChars = 12 * 1024 // Output chars sent to the moderation model
+)
+
+var policyLogMu sync.Mutex
+
+// PolicyViolationError halts a turn whose assistant output broke the
+// configured content policy.
+type PolicyViolationError struct {
+	Rule    string // e.g. pattern:..., keyword:..., moderation:...
+	excerpt string // Offending text, logged but not shown
+}
+
+func (e *PolicyViolationError) Error() string {
+	return fmt.Sprintf("response blocked by content policy (%s)", e.Rule)
+}
+
+// policyText joins the parts of an assistant message that reach the UI or
+// tools: visible content and tool call arguments.
+func policyText(msg state.Message) string {
+	parts := []string{msg.Content}
+	for _, call := range msg.ToolCalls {
+		parts = append(parts, call.Function.Name+" "+call.Function.Arguments)
+	}
+	return strings.Join(parts, "\n")
+}
+
+// matchContentPolicy applies the regex and keyword rules, returning the rule
+// that matched and the matching excerpt.
+func matchContentPolicy(policy config.ContentPolicy, text string) (rule, excerpt string) {
+	for _, pattern := range policy.BlockPatterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			continue // Rejected by config validation; skip if loaded another way
+		}
+		if loc := re.FindStringIndex(text); loc != nil {
+			return "pattern:" + pattern, policyExcerpt(text, loc[0], loc[1])
+		}
+	}
+	lower := strings.ToLower(text)
+	for _, keyword := range policy.BlockKeywords {
+		keyword = strings.ToLower(strings.TrimSpace(keyword))
+		if keyword == "" {
+			continue
+		}
+		if idx := strings.Index(lower, keyword); idx >= 0 {
+			return "keyword:" + keyword, policyExcerpt(text, idx, idx+len(keyword))
+		}
+	}
+	return "", ""
+}
+
+func policyExcerpt(text string, start, end int) string {
+	from := max(start-policyExcerptChars/2, 0)
+	to := min(end+policyExcerptChars/2, len(text))
+	return strings.ToValidUTF8(text[from:to], "")
+}
+
+// checkContentPolicy returns a violation for msg, or nil when the policy is
+// disabled or the output passes every rule.
+func (a *Agent) checkContentPolicy(ctx context.Context, msg state.Message) *PolicyViolationError {
+	policy := a.cfg.Load().ContentPolicy
+	if !policy.Enabled {
+		return nil
+	}
+	text := policyText(msg)
+	if strings.TrimSpace(text) == "" {
+		return nil
+	}
+	rule, excerpt := matchContentPolicy(policy, text)
+	if rule == "" && policy.ModerationModel != "" {
+		rule, excerpt = a.moderateOutput(ctx, policy, text)
+	}
+	if rule == "" {
+		return nil
+	}
+	return &PolicyViolationError{Rule: rule, excerpt: excerpt}
+}
+
+// moderateOutput asks the moderation model to classify text.
+func (a *Agent) moderateOutput(ctx context.Context, policy config.ContentPolicy, text string) (rule, excerpt string) {
+	if len(text) > policyModerationChars {
+		text = strings.ToValidUTF8(text[:policyModerationChars], "")
+	}
+	resp, err := a.client.Chat(ctx, llm.ChatRequest{
+		Model: policy.ModerationModel,
+		Messages: []state.Message{
+			{Role: "system", Content: prompts.Moderation()},
+			{Role: "user", Content: text},
+		},
+		Temperature: 0,
+	})
+	if err != nil || len(resp.Choices) == 0 {
+		a.logger.Printf("[policy] moderation call failed: %v", err)
+		if policy.ModerationFailClosed {
+			return "moderation:unavailable", ""
+		}
+		return "", ""
+	}
+	verdict := strings.TrimSpace(resp.Choices[0].Message.Content)
+	if len(verdict) < 5 || !strings.EqualFold(verdict[:5], "BLOCK") {
+		return "", ""
+	}
+	reason := strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(verdict[5:]), ":"))
+	if reason == "" {
+		reason = "flagged"
+	}
+	return "moderation:" + reason, policyExcerpt(text, 0, 0)
+}
+
+// enforceContentPolicy checks an assistant message and, on a violation,
+// records a placeholder instead of the output and returns the violation so
+// the turn halts.
+func (a *Agent) enforceContentPolicy(ctx context.Context, conv *state.Conversation, stateManager *state.Manager, msg state.Message, workspaceRoot string, callback StreamCallback) error {
+	violation := a.checkContentPolicy(ctx, msg)
+	if violation == nil {
+		return nil
+	}
+	a.logPolicyViolation(workspaceRoot, violation)
+	conv.Append(state.Message{Role: "assistant", Content: "[Response withheld: blocked by content policy]"})
+	if err := stateManager.Save(conv); err != nil {
+		return fmt.Errorf("save conversation: %w", err)
+	}
+	if callback != nil {
+		callback("policy_violation", map[string]any{"rule": violation.Rule})
+	}
+	return violation
+}
+
+// logPolicyViolation records a blocked response in the global violation log.
+func (a *Agent) logPolicyViolation(workspaceRoot string, violation *PolicyViolationError) {
+	a.logger.Printf("[policy] [ws:%s] blocked assistant output: %s", workspaceRoot, violation.Rule)
+
+	entry, err := json.Marshal(map[string]any{
+		"time":      time.Now().UTC(),
+		"workspace": workspaceRoot,
+		"rule":      violation.Rule,
+		"excerpt":   violation.excerpt,
+	})
+	if err != nil {
+		return
+	}
+	policyLogMu.Lock()
+	defer policyLogMu.Unlock()
+	path := filepath.Join(config.GetConfigDir(), policyViolationLog)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		a.logger.Printf("[policy] write violation log failed: %v", err)
+		return
+	}
+	defer f.Close()
+	_, _ = f.Write(append(entry, '\n'))
+}
@@ -0,0 +1,56 @@
+package agent
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"cando/internal/config"
+	"cando/internal/llm"
+	"cando/internal/state"
+)
+
+func TestContentPolicyHaltsTurn(t *testing.T) {
+	configDir := t.TempDir()
+	t.Setenv("CANDO_CONFIG_DIR", configDir)
+	workspace := t.TempDir()
+
+	client := newScriptedClient(llm.ChatResponse{
+		Choices: []llm.ChatChoice{{
+			Message: state.Message{
+				Role: "assistant",
+				ToolCalls: []state.ToolCall{{
+					ID:       "call-1",
+					Type:     "function",
+					Function: state.FunctionCall{Name: "shell", Arguments: `{"command":"cat /etc/Shadow"}`},
+				}},
+			},
+			FinishReason: "tool_calls",
+		}},
+	})
+	cfg := baseTestConfig(workspace)
+	cfg.ContentPolicy = config.ContentPolicy{
+		Enabled:       true,
+		BlockPatterns: []string{`AKIA[0-9A-Z]{16}`},
+		BlockKeywords: []string{"/etc/shadow"},
+	}
+	agent := newTestAgent(t, client, cfg)
+
+	_, _, err := agent.respond(t.Context(), "show me the password file")
+	var violation *PolicyViolationError
+	if !errors.As(err, &violation) || violation.Rule != "keyword:/etc/shadow" {
+		t.Fatalf("expected keyword violation, got %v", err)
+	}
+
+	messages := agent.states.Current().Messages()
+	last := messages[len(messages)-1]
+	if len(last.ToolCalls) != 0 || !strings.Contains(last.Content, "blocked by content policy") {
+		t.Fatalf("expected placeholder instead of blocked output, got %+v", last)
+	}
+	logData, err := os.ReadFile(filepath.Join(configDir, policyViolationLog))
+	if err != nil || !strings.Contains(string(logData), "cat /etc/Shadow") {
+		t.Fatalf("expected violation logged with excerpt, got %q (%v)", logData, err)
+	}
+}
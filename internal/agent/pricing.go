@@ -0,0 +1,169 @@
+package agent
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"sync"
+
+	"cando/internal/config"
+	"cando/internal/llm"
+	"cando/internal/state"
+)
+
+// modelPrice is a model's price in USD per token.
+type modelPrice struct {
+	Prompt     float64 `json:"prompt"`
+	Completion float64 `json:"completion"`
+}
+
+// requestCost is the cost of one provider request, attached to
+// assistant_message events as "cost".
+type requestCost struct {
+	Model        string  `json:"model"`
+	ProjectedUSD float64 `json:"projected_usd"`        // Prompt cost estimated before sending
+	ActualUSD    float64 `json:"actual_usd,omitempty"` // From the usage the provider reported
+	SessionUSD   float64 `json:"session_usd"`          // Running total for the provider since startup
+	// ConversationUSD is the running total of the conversation, which is
+	// persisted with it.
+	ConversationUSD float64 `json:"conversation_usd"`
+}
+
+// zaiPricing is Z.AI's pay-as-you-go pricing in USD per million tokens,
+// keyed by model. GLM Coding Plan subscriptions are billed a flat fee;
+// subscribers can zero these out with pricing in models.yaml.
+var zaiPricing = map[string]struct{ prompt, completion float64 }{
+	"glm-4.6":       {0.6, 2.2},
+	"glm-4.5":       {0.6, 2.2},
+	"glm-4.5-x":     {2.2, 8.9},
+	"glm-4.5-air":   {0.2, 1.1},
+	"glm-4.5-airx":  {1.1, 4.5},
+	"glm-4.5-flash": {0, 0},
+	"glm-4.5v":      {0.6, 1.8},
+}
+
+// parseModelPricing reads per-model pricing from the OpenRouter models
+// JSON. Prices are decimal strings in USD per token; unparsable or
+// negative prices (OpenRouter uses -1 for variable pricing) are skipped.
+func parseModelPricing(modelsJSON []byte) map[string]modelPrice {
+	var models []struct {
+		ID      string `json:"id"`
+		Pricing struct {
+			Prompt     string `json:"prompt"`
+			Completion string `json:"completion"`
+		} `json:"pricing"`
+	}
+	if err := json.Unmarshal(modelsJSON, &models); err != nil {
+		return nil
+	}
+	prices := make(map[string]modelPrice, len(models))
+	for _, m := range models {
+		prompt, err1 := strconv.ParseFloat(strings.TrimSpace(m.Pricing.Prompt), 64)
+		completion, err2 := strconv.ParseFloat(strings.TrimSpace(m.Pricing.Completion), 64)
+		if err1 != nil || err2 != nil || prompt < 0 || completion < 0 {
+			continue
+		}
+		prices[m.ID] = modelPrice{Prompt: prompt, Completion: completion}
+	}
+	return prices
+}
+
+// openRouterPrices caches the parsed pricing of the current models JSON.
+var openRouterPrices struct {
+	mu     sync.Mutex
+	source []byte
+	prices map[string]modelPrice
+}
+
+// openRouterPricing returns pricing for the OpenRouter models, reparsing
+// only when the models cache has been refreshed.
+func openRouterPricing() map[string]modelPrice {
+	data := openRouterModelsJSON()
+	openRouterPrices.mu.Lock()
+	defer openRouterPrices.mu.Unlock()
+	same := len(data) == len(openRouterPrices.source) && len(data) > 0 && &data[0] == &openRouterPrices.source[0]
+	if !same {
+		openRouterPrices.source = data
+		openRouterPrices.prices = parseModelPricing(data)
+	}
+	return openRouterPrices.prices
+}
+
+// modelPricing returns the price of a provider's model when known. Pricing
+// in the user's model metadata wins over the OpenRouter models list, which
+// also prices OpenAI's models.
+func (a *Agent) modelPricing(provider, model string) (modelPrice, bool) {
+	if meta, ok := config.LookupModelMetadata(provider, model); ok && meta.Pricing != nil {
+		return modelPrice{
+			Prompt:     meta.Pricing.PromptPerMillion / 1e6,
+			Completion: meta.Pricing.CompletionPerMillion / 1e6,
+		}, true
+	}
+	switch strings.ToLower(provider) {
+	case "zai":
+		perMillion, ok := zaiPricing[strings.ToLower(model)]
+		return modelPrice{Prompt: perMillion.prompt / 1e6, Completion: perMillion.completion / 1e6}, ok
+	case "openrouter":
+	case "openai":
+		// OpenRouter passes OpenAI's prices through under openai/
+		model = "openai/" + model
+	default:
+		return modelPrice{}, false
+	}
+	price, ok := openRouterPricing()[model]
+	return price, ok
+}
+
+// projected estimates the prompt cost of a request of the given size.
+func (p modelPrice) projected(promptTokens int) float64 {
+	return float64(promptTokens) * p.Prompt
+}
+
+// actual prices reported token usage.
+func (p modelPrice) actual(usage *llm.Usage) float64 {
+	if usage == nil {
+		return 0
+	}
+	return float64(usage.PromptTokens)*p.Prompt + float64(usage.CompletionTokens)*p.Completion
+}
+
+// recordUsage adds the usage a provider reported for one request to conv
+// and its cost to the totals since startup. It returns the model's price
+// and the request's cost; ok is false when the model has no known pricing.
+func (a *Agent) recordUsage(conv *state.Conversation, provider, model string, usage *llm.Usage) (price modelPrice, usd float64, ok bool) {
+	price, ok = a.modelPricing(provider, model)
+	if ok {
+		usd = price.actual(usage)
+		a.costs.add(provider, usd)
+	}
+	if usage != nil {
+		request := state.UsageTotals{Requests: 1, PromptTokens: usage.PromptTokens, CompletionTokens: usage.CompletionTokens, CostUSD: usd}
+		if !ok {
+			request.Unpriced = 1
+		}
+		conv.AddUsage(provider, request)
+	}
+	return price, usd, ok
+}
+
+// costTracker sums actual request costs per provider since startup.
+type costTracker struct {
+	mu    sync.Mutex
+	spent map[string]float64
+}
+
+func (c *costTracker) add(provider string, usd float64) float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.spent == nil {
+		c.spent = make(map[string]float64)
+	}
+	c.spent[provider] += usd
+	return c.spent[provider]
+}
+
+func (c *costTracker) total(provider string) float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.spent[provider]
+}
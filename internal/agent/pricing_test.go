@@ -0,0 +1,67 @@
+package agent
+
+import (
+	"math"
+	"testing"
+
+	"cando/internal/llm"
+)
+
+func TestParseModelPricing(t *testing.T) {
+	prices := parseModelPricing([]byte(`[
+		{"id": "a/paid", "pricing": {"prompt": "0.000003", "completion": "0.000015"}},
+		{"id": "a/free:free", "pricing": {"prompt": "0", "completion": "0"}},
+		{"id": "a/variable", "pricing": {"prompt": "-1", "completion": "-1"}},
+		{"id": "a/missing", "pricing": {}}
+	]`))
+	if len(prices) != 2 {
+		t.Fatalf("parsed %d models, want 2: %v", len(prices), prices)
+	}
+	paid := prices["a/paid"]
+	if paid.Prompt != 0.000003 || paid.Completion != 0.000015 {
+		t.Errorf("a/paid = %+v", paid)
+	}
+
+	if got := paid.projected(1000); math.Abs(got-0.003) > 1e-12 {
+		t.Errorf("projected = %v, want 0.003", got)
+	}
+	if got := paid.actual(&llm.Usage{PromptTokens: 1000, CompletionTokens: 100}); math.Abs(got-0.0045) > 1e-12 {
+		t.Errorf("actual = %v, want 0.0045", got)
+	}
+	if got := paid.actual(nil); got != 0 {
+		t.Errorf("actual without usage = %v", got)
+	}
+
+	var costs costTracker
+	costs.add("openrouter", 0.5)
+	if got := costs.add("openrouter", 0.25); got != 0.75 {
+		t.Errorf("running total = %v, want 0.75", got)
+	}
+	if got := costs.total("zai"); got != 0 {
+		t.Errorf("untracked provider total = %v", got)
+	}
+}
+
+func TestRecordUsage(t *testing.T) {
+	a := newTestAgent(t, newScriptedClient(), baseTestConfig(t.TempDir()))
+	conv := a.states.Current()
+
+	price, usd, ok := a.recordUsage(conv, "zai", "GLM-4.6", &llm.Usage{PromptTokens: 1000, CompletionTokens: 100})
+	if !ok || price.Prompt != 0.6/1e6 || math.Abs(usd-0.00082) > 1e-12 {
+		t.Fatalf("zai glm-4.6 = %+v, %v, %v", price, usd, ok)
+	}
+	if _, _, ok := a.recordUsage(conv, "ollama", "llama3", &llm.Usage{PromptTokens: 500, CompletionTokens: 50}); ok {
+		t.Fatalf("local model priced")
+	}
+
+	report := newUsageReport(a.states.Summaries())
+	if report.Total.Requests != 2 || report.Total.PromptTokens != 1500 || report.Total.Unpriced != 1 {
+		t.Errorf("total = %+v", report.Total)
+	}
+	if zai := report.Providers["zai"]; math.Abs(zai.CostUSD-0.00082) > 1e-12 || len(report.Sessions) != 1 {
+		t.Errorf("report = %+v", report)
+	}
+	if got := a.costs.total("zai"); math.Abs(got-0.00082) > 1e-12 {
+		t.Errorf("since-startup total = %v", got)
+	}
+}
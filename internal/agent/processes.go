@@ -0,0 +1,136 @@
+package agent
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"cando/internal/tooling"
+)
+
+// processTool returns the background_process tool of the request's
+// workspace, writing an error response when there is none.
+func (s *webServer) processTool(w http.ResponseWriter, r *http.Request) (*tooling.BackgroundProcessTool, bool) {
+	workspace := s.getWorkspaceFromRequest(r)
+	if workspace == "" || !s.workspaceExists(workspace) {
+		s.respondError(w, r, http.StatusBadRequest, "select a workspace first")
+		return nil, false
+	}
+	wsCtx, err := s.agent.GetOrCreateWorkspaceContext(workspace)
+	if err != nil {
+		s.respondError(w, r, http.StatusInternalServerError, fmt.Sprintf("get workspace context: %v", err))
+		return nil, false
+	}
+	tool, ok := wsCtx.tools.Lookup("background_process")
+	processes, isProcessTool := tool.(*tooling.BackgroundProcessTool)
+	if !ok || !isProcessTool {
+		s.respondError(w, r, http.StatusNotFound, "background processes are not available")
+		return nil, false
+	}
+	return processes, true
+}
+
+// handleProcesses lists the background jobs the agent started in the
+// workspace, newest first.
+func (s *webServer) handleProcesses(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.respondError(w, r, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	processes, ok := s.processTool(w, r)
+	if !ok {
+		return
+	}
+	list, err := processes.List()
+	if err != nil {
+		s.respondError(w, r, http.StatusInternalServerError, fmt.Sprintf("list processes: %v", err))
+		return
+	}
+	s.writeJSON(w, r, map[string]any{"processes": list})
+}
+
+// handleProcessLogs returns a job's output:
+// ?job_id=<id>&stream=stdout|stderr&tail_lines=<n>&grep=<text>.
+// tail_lines defaults to 200; 0 returns everything.
+func (s *webServer) handleProcessLogs(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.respondError(w, r, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	processes, ok := s.processTool(w, r)
+	if !ok {
+		return
+	}
+	query := r.URL.Query()
+	jobID := strings.TrimSpace(query.Get("job_id"))
+	if jobID == "" {
+		s.respondError(w, r, http.StatusBadRequest, "job_id is required")
+		return
+	}
+	stream := strings.ToLower(strings.TrimSpace(query.Get("stream")))
+	switch stream {
+	case "":
+		stream = "stdout"
+	case "stdout", "stderr":
+	default:
+		s.respondError(w, r, http.StatusBadRequest, "stream must be stdout or stderr")
+		return
+	}
+	tail := 200
+	if raw := strings.TrimSpace(query.Get("tail_lines")); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 0 {
+			s.respondError(w, r, http.StatusBadRequest, "tail_lines must be a number >= 0")
+			return
+		}
+		tail = n
+	}
+	lines, err := processes.Logs(jobID, stream, tail, query.Get("grep"))
+	if err != nil {
+		s.respondError(w, r, processErrorStatus(err), err.Error())
+		return
+	}
+	s.writeJSON(w, r, map[string]any{"job_id": jobID, "stream": stream, "lines": lines})
+}
+
+// handleProcessKill stops a running job: POST {"job_id": ...}.
+func (s *webServer) handleProcessKill(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		s.respondError(w, r, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	var req struct {
+		JobID string `json:"job_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || strings.TrimSpace(req.JobID) == "" {
+		s.respondError(w, r, http.StatusBadRequest, "job_id is required")
+		return
+	}
+	processes, ok := s.processTool(w, r)
+	if !ok {
+		return
+	}
+	if !s.claimWorkspace(w, r, s.getWorkspaceFromRequest(r)) {
+		return
+	}
+	if err := processes.Kill(req.JobID); err != nil {
+		s.respondError(w, r, processErrorStatus(err), err.Error())
+		return
+	}
+	s.logger.Printf("[ws:%s] killed background job %s", s.getWorkspaceFromRequest(r), req.JobID)
+	s.writeJSON(w, r, map[string]any{"job_id": req.JobID, "status": "killed"})
+}
+
+func processErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		return http.StatusNotFound
+	case errors.Is(err, tooling.ErrProcessNotRunning):
+		return http.StatusConflict
+	}
+	return http.StatusInternalServerError
+}
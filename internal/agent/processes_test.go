@@ -0,0 +1,96 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"cando/internal/tooling"
+)
+
+func TestProcessEndpoints(t *testing.T) {
+	configDir := t.TempDir()
+	t.Setenv("CANDO_CONFIG_DIR", configDir)
+	workspace := t.TempDir()
+	agent := newTestAgent(t, newScriptedClient(), baseTestConfig(t.TempDir()))
+	manager := &WorkspaceManager{filePath: filepath.Join(configDir, "workspaces.json")}
+	if _, err := manager.Add(workspace); err != nil {
+		t.Fatal(err)
+	}
+	s := &webServer{agent: agent, logger: log.New(io.Discard, "", 0), workspaceManager: manager}
+	wsCtx, err := agent.GetOrCreateWorkspaceContext(workspace)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tool, _ := wsCtx.tools.Lookup("background_process")
+	started, err := tool.Call(context.Background(), map[string]any{
+		"action":  "start",
+		"command": []string{"/bin/sh", "-c", "echo serving on :3000; exec sleep 30"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var job struct {
+		ID string `json:"job_id"`
+	}
+	json.Unmarshal([]byte(started), &job)
+
+	list := func() []tooling.ProcessInfo {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		s.handleProcesses(rec, httptest.NewRequest(http.MethodGet, "/api/processes?workspace="+workspace, nil))
+		var body struct {
+			Processes []tooling.ProcessInfo `json:"processes"`
+		}
+		if rec.Code != http.StatusOK || json.Unmarshal(rec.Body.Bytes(), &body) != nil || len(body.Processes) != 1 {
+			t.Fatalf("list = %d: %s", rec.Code, rec.Body.String())
+		}
+		return body.Processes
+	}
+	if got := list()[0]; got.ID != job.ID || got.Status != "running" {
+		t.Fatalf("process = %+v", got)
+	}
+
+	logs := func(jobID string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		s.handleProcessLogs(rec, httptest.NewRequest(http.MethodGet, "/api/processes/logs?workspace="+workspace+"&job_id="+jobID, nil))
+		return rec
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for !strings.Contains(logs(job.ID).Body.String(), "serving on :3000") {
+		if time.Now().After(deadline) {
+			t.Fatalf("logs = %s", logs(job.ID).Body.String())
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if rec := logs("..%2F..%2Fetc"); rec.Code != http.StatusNotFound {
+		t.Errorf("logs outside the process dir = %d: %s", rec.Code, rec.Body.String())
+	}
+
+	kill := func() int {
+		rec := httptest.NewRecorder()
+		body := strings.NewReader(`{"job_id":"` + job.ID + `"}`)
+		s.handleProcessKill(rec, httptest.NewRequest(http.MethodPost, "/api/processes/kill?workspace="+workspace, body))
+		return rec.Code
+	}
+	if code := kill(); code != http.StatusOK {
+		t.Fatalf("kill = %d", code)
+	}
+	deadline = time.Now().Add(2 * time.Second)
+	for list()[0].Status != "killed" {
+		if time.Now().After(deadline) {
+			t.Fatalf("process after kill = %+v", list()[0])
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if code := kill(); code != http.StatusConflict {
+		t.Errorf("second kill = %d", code)
+	}
+}
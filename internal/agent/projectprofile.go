@@ -0,0 +1,311 @@
+package agent
+
+import (
+	"encoding/json"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"cando/internal/repomap"
+	"cando/internal/state"
+)
+
+const (
+	// maxProfileEntries bounds the tree walk so huge repos stay fast.
+	maxProfileEntries = 5000
+	maxProfileDepth   = 4
+	// projectProfileTTL is how long a detected profile is reused before the
+	// tree is scanned again.
+	projectProfileTTL = 10 * time.Minute
+	maxProfileItems   = 6
+)
+
+var profileLanguages = map[string]string{
+	".go": "Go", ".py": "Python", ".js": "JavaScript", ".jsx": "JavaScript",
+	".mjs": "JavaScript", ".ts": "TypeScript", ".tsx": "TypeScript", ".rs": "Rust",
+	".java": "Java", ".kt": "Kotlin", ".swift": "Swift", ".rb": "Ruby",
+	".php": "PHP", ".cs": "C#", ".c": "C", ".h": "C", ".cpp": "C++", ".cc": "C++",
+	".hpp": "C++", ".scala": "Scala", ".ex": "Elixir", ".exs": "Elixir",
+	".dart": "Dart", ".lua": "Lua", ".zig": "Zig", ".sh": "Shell",
+	".vue": "Vue", ".svelte": "Svelte",
+}
+
+// profileMarkers maps well-known files to the package manager or build
+// tool they imply.
+var profileMarkers = map[string]string{
+	"go.mod": "Go modules", "Cargo.toml": "Cargo", "package-lock.json": "npm",
+	"pnpm-lock.yaml": "pnpm", "yarn.lock": "yarn", "bun.lockb": "bun", "bun.lock": "bun",
+	"pyproject.toml": "pyproject", "requirements.txt": "pip", "Pipfile": "Pipenv",
+	"poetry.lock": "Poetry", "uv.lock": "uv", "Gemfile": "Bundler", "composer.json": "Composer",
+	"pom.xml": "Maven", "build.gradle": "Gradle", "build.gradle.kts": "Gradle",
+	"mix.exs": "Mix", "pubspec.yaml": "pub", "CMakeLists.txt": "CMake", "Makefile": "Make",
+	"Taskfile.yml": "Task", "justfile": "just", "Dockerfile": "Docker",
+	"docker-compose.yml": "Docker Compose", "compose.yaml": "Docker Compose", "flake.nix": "Nix",
+}
+
+// profileFrameworkFiles are files whose presence alone names a framework.
+var profileFrameworkFiles = map[string]string{
+	"next.config.js": "Next.js", "next.config.mjs": "Next.js", "next.config.ts": "Next.js",
+	"nuxt.config.ts": "Nuxt", "vite.config.ts": "Vite", "vite.config.js": "Vite",
+	"angular.json": "Angular", "svelte.config.js": "SvelteKit", "manage.py": "Django",
+	"tailwind.config.js": "Tailwind", "tailwind.config.ts": "Tailwind",
+	"astro.config.mjs": "Astro", "remix.config.js": "Remix",
+}
+
+// profileDependencies maps dependency names found in manifests to frameworks.
+var profileDependencies = map[string]string{
+	"react": "React", "vue": "Vue", "svelte": "Svelte", "express": "Express",
+	"fastify": "Fastify", "@nestjs/core": "NestJS", "electron": "Electron",
+	"jest": "Jest", "vitest": "Vitest", "django": "Django", "flask": "Flask",
+	"fastapi": "FastAPI", "pytest": "pytest", "github.com/gin-gonic/gin": "Gin",
+	"github.com/labstack/echo": "Echo", "github.com/gofiber/fiber": "Fiber",
+	"google.golang.org/grpc": "gRPC", "github.com/spf13/cobra": "Cobra",
+	"actix-web": "Actix", "axum": "Axum", "tokio": "Tokio", "rails": "Rails",
+	"spring-boot": "Spring Boot", "laravel/framework": "Laravel",
+}
+
+// profileEntryPoints are paths that usually start the program.
+var profileEntryPoints = []string{
+	"main.go", "src/main.rs", "src/lib.rs", "main.py", "app.py", "manage.py",
+	"src/index.ts", "src/index.js", "src/main.ts", "src/main.tsx", "index.js",
+	"server.js", "app.js", "src/App.tsx", "src/main/java", "lib/main.dart",
+	"config/routes.rb", "Program.cs",
+}
+
+type projectProfile struct {
+	Languages   []string
+	Tools       []string
+	Frameworks  []string
+	EntryPoints []string
+	Truncated   bool
+	detectedAt  time.Time
+}
+
+// projectProfiles caches detected profiles per workspace root.
+var projectProfiles struct {
+	mu      sync.Mutex
+	entries map[string]projectProfile
+}
+
+// loadProjectProfile returns the compact project profile for a workspace,
+// scanning the tree on first use and again once the cached one is stale.
+func loadProjectProfile(workspaceRoot string) string {
+	if workspaceRoot == "" {
+		return ""
+	}
+	projectProfiles.mu.Lock()
+	cached, ok := projectProfiles.entries[workspaceRoot]
+	projectProfiles.mu.Unlock()
+	if ok && time.Since(cached.detectedAt) < projectProfileTTL {
+		return cached.String()
+	}
+	profile := detectProjectProfile(workspaceRoot)
+	projectProfiles.mu.Lock()
+	if projectProfiles.entries == nil {
+		projectProfiles.entries = make(map[string]projectProfile)
+	}
+	projectProfiles.entries[workspaceRoot] = profile
+	projectProfiles.mu.Unlock()
+	return profile.String()
+}
+
+// detectProjectProfile walks the top levels of a workspace and infers its
+// languages, package managers, frameworks and entry points from file
+// extensions, marker files and manifest dependencies.
+func detectProjectProfile(root string) projectProfile {
+	profile := projectProfile{detectedAt: time.Now()}
+	langCounts := make(map[string]int)
+	tools := make(map[string]bool)
+	frameworks := make(map[string]bool)
+	var manifests []string
+	var cmdMains []string
+	entries := 0
+
+	_ = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		rel, _ := filepath.Rel(root, path)
+		if rel == "." {
+			return nil
+		}
+		entries++
+		if entries > maxProfileEntries {
+			profile.Truncated = true
+			return filepath.SkipAll
+		}
+		depth := strings.Count(rel, string(filepath.Separator))
+		name := d.Name()
+		if d.IsDir() {
+			if repomap.SkipDir(name) || depth >= maxProfileDepth {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if lang, ok := profileLanguages[strings.ToLower(filepath.Ext(name))]; ok {
+			langCounts[lang]++
+		}
+		if depth <= 1 {
+			if tool, ok := profileMarkers[name]; ok {
+				tools[tool] = true
+			}
+			if fw, ok := profileFrameworkFiles[name]; ok {
+				frameworks[fw] = true
+			}
+			switch name {
+			case "package.json", "go.mod", "Cargo.toml", "requirements.txt", "pyproject.toml", "Gemfile", "composer.json", "pom.xml":
+				manifests = append(manifests, path)
+			}
+		}
+		if rel == filepath.Join(".github", "workflows") || strings.HasPrefix(rel, filepath.Join(".github", "workflows")+string(filepath.Separator)) {
+			tools["GitHub Actions"] = true
+		}
+		// Go programs conventionally live in cmd/<name>/main.go
+		if name == "main.go" && depth == 2 && strings.HasPrefix(rel, "cmd"+string(filepath.Separator)) {
+			cmdMains = append(cmdMains, filepath.ToSlash(rel))
+		}
+		return nil
+	})
+
+	for _, manifest := range manifests {
+		for _, fw := range manifestFrameworks(manifest) {
+			frameworks[fw] = true
+		}
+	}
+	for _, entry := range profileEntryPoints {
+		if _, err := os.Stat(filepath.Join(root, filepath.FromSlash(entry))); err == nil {
+			profile.EntryPoints = append(profile.EntryPoints, entry)
+		}
+	}
+	sort.Strings(cmdMains)
+	profile.EntryPoints = append(profile.EntryPoints, cmdMains...)
+
+	profile.Languages = rankedLanguages(langCounts)
+	profile.Tools = sortedKeys(tools)
+	profile.Frameworks = sortedKeys(frameworks)
+	return profile
+}
+
+// manifestFrameworks returns the frameworks a manifest depends on. Outside
+// package.json the manifest is split into tokens rather than parsed, which
+// covers go.mod, Cargo.toml, requirements.txt, Gemfile and pom.xml alike.
+func manifestFrameworks(path string) []string {
+	data, err := os.ReadFile(path)
+	if err != nil || len(data) > 1<<20 {
+		return nil
+	}
+	deps := make(map[string]bool)
+	if filepath.Base(path) == "package.json" {
+		var pkg struct {
+			Dependencies    map[string]any `json:"dependencies"`
+			DevDependencies map[string]any `json:"devDependencies"`
+		}
+		if json.Unmarshal(data, &pkg) != nil {
+			return nil
+		}
+		for dep := range pkg.Dependencies {
+			deps[dep] = true
+		}
+		for dep := range pkg.DevDependencies {
+			deps[dep] = true
+		}
+	} else {
+		tokens := strings.FieldsFunc(strings.ToLower(string(data)), func(r rune) bool {
+			return strings.ContainsRune(" \t\r\n\"'=<>~^,[]{};:!()", r)
+		})
+		for _, token := range tokens {
+			deps[token] = true
+		}
+	}
+	var found []string
+	for dep, fw := range profileDependencies {
+		if deps[dep] {
+			found = append(found, fw)
+			continue
+		}
+		if filepath.Base(path) == "package.json" {
+			continue
+		}
+		// Versioned Go paths (echo/v4) and artifact variants (spring-boot-starter-web)
+		for token := range deps {
+			if strings.HasPrefix(token, dep+"/") || strings.HasPrefix(token, dep+"-") {
+				found = append(found, fw)
+				break
+			}
+		}
+	}
+	return found
+}
+
+// rankedLanguages orders languages by file count, dropping the long tail.
+func rankedLanguages(counts map[string]int) []string {
+	langs := make([]string, 0, len(counts))
+	for lang := range counts {
+		langs = append(langs, lang)
+	}
+	sort.Slice(langs, func(i, j int) bool {
+		if counts[langs[i]] != counts[langs[j]] {
+			return counts[langs[i]] > counts[langs[j]]
+		}
+		return langs[i] < langs[j]
+	})
+	if len(langs) > maxProfileItems {
+		langs = langs[:maxProfileItems]
+	}
+	return langs
+}
+
+func sortedKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for k := range set {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// String renders the profile as a few short lines for the system message.
+func (p projectProfile) String() string {
+	var b strings.Builder
+	line := func(label string, items []string) {
+		if len(items) == 0 {
+			return
+		}
+		if len(items) > maxProfileItems*2 {
+			items = items[:maxProfileItems*2]
+		}
+		b.WriteString("- " + label + ": " + strings.Join(items, ", ") + "\n")
+	}
+	line("Languages (by file count)", p.Languages)
+	line("Build/package tools", p.Tools)
+	line("Frameworks/libraries", p.Frameworks)
+	line("Entry points", p.EntryPoints)
+	if b.Len() > 0 && p.Truncated {
+		b.WriteString("- (large tree; only the first entries were scanned)\n")
+	}
+	return b.String()
+}
+
+// injectProjectProfile appends the detected project profile to the system
+// message so the model can skip the usual exploration calls.
+func injectProjectProfile(messages []state.Message, profile string) []state.Message {
+	if profile == "" || len(messages) == 0 {
+		return messages
+	}
+
+	// Make a copy to avoid modifying the original
+	result := make([]state.Message, len(messages))
+	copy(result, messages)
+
+	for i, msg := range result {
+		if msg.Role == "system" {
+			result[i].Content = msg.Content + "\n\n---\nProject Profile (detected automatically; verify before relying on details):\n" + profile
+			break
+		}
+	}
+	return result
+}
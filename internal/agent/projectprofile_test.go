@@ -0,0 +1,59 @@
+package agent
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestDetectProjectProfile(t *testing.T) {
+	root := t.TempDir()
+	files := map[string]string{
+		"go.mod":                   "module example\n\nrequire (\n\tgithub.com/labstack/echo/v4 v4.11.0\n\tgoogle.golang.org/grpc v1.60.0\n)\n",
+		"cmd/server/main.go":       "package main",
+		"internal/api/api.go":      "package api",
+		"internal/api/routes.go":   "package api",
+		"web/package.json":         `{"dependencies": {"react": "^18.0.0"}, "devDependencies": {"vitest": "^1.0.0"}}`,
+		"web/src/App.tsx":          "",
+		"node_modules/x/index.js":  "",
+		"node_modules/y/index.js":  "",
+		"node_modules/z/index.js":  "",
+		".github/workflows/ci.yml": "",
+		"Makefile":                 "build:\n\tgo build ./...\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	profile := detectProjectProfile(root)
+	if len(profile.Languages) != 2 || profile.Languages[0] != "Go" || profile.Languages[1] != "TypeScript" {
+		t.Errorf("languages = %v, want [Go TypeScript] (node_modules skipped)", profile.Languages)
+	}
+	for _, tool := range []string{"Go modules", "Make", "GitHub Actions"} {
+		if !slices.Contains(profile.Tools, tool) {
+			t.Errorf("tools %v missing %s", profile.Tools, tool)
+		}
+	}
+	for _, fw := range []string{"Echo", "gRPC", "React", "Vitest"} {
+		if !slices.Contains(profile.Frameworks, fw) {
+			t.Errorf("frameworks %v missing %s", profile.Frameworks, fw)
+		}
+	}
+	if !slices.Contains(profile.EntryPoints, "cmd/server/main.go") {
+		t.Errorf("entry points = %v, want cmd/server/main.go", profile.EntryPoints)
+	}
+	if text := profile.String(); !strings.Contains(text, "- Languages (by file count): Go, TypeScript\n") {
+		t.Errorf("unexpected rendering:\n%s", text)
+	}
+	if got := detectProjectProfile(t.TempDir()).String(); got != "" {
+		t.Errorf("empty workspace profile = %q, want empty", got)
+	}
+}
@@ -0,0 +1,352 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"cando/internal/tooling"
+)
+
+const (
+	// promptQueueLimit caps the prompts waiting in one session.
+	promptQueueLimit = 20
+	// promptBusyRetry is how often a waiting queue checks again for turns
+	// that were not started from the web UI, such as gRPC or chat turns.
+	promptBusyRetry = 2 * time.Second
+)
+
+// errPromptDropped is the result of a queued prompt removed before it ran.
+var errPromptDropped = errors.New("the queued prompt was cancelled before it ran")
+
+// queuedPrompt is a prompt accepted while its workspace was running a turn.
+type queuedPrompt struct {
+	ID       string    `json:"id"`
+	Content  string    `json:"content"`
+	Session  string    `json:"session"`
+	QueuedAt time.Time `json:"queued_at"`
+
+	key     string               // Idempotency key; a resubmission returns the queued entry
+	pins    *tooling.PinnedFiles // Pinned files sent with the prompt
+	observe StreamCallback       // Also sees the turn's events, such as a chat bridge waiting for the reply
+	done    chan<- error         // Receives the turn's result; buffered by the sender
+}
+
+// promptQueues holds the prompts waiting in each workspace's sessions. They
+// are kept in memory only: a restart drops them, like a running turn.
+type promptQueues struct {
+	mu      sync.Mutex
+	nextID  int
+	pending map[string][]queuedPrompt // Workspace root -> prompts in submission order
+	running map[string]string         // Workspace root -> ID of the queued prompt being run
+	retries map[string]bool           // Workspace roots with a busy retry scheduled
+}
+
+func newPromptQueues() *promptQueues {
+	return &promptQueues{pending: make(map[string][]queuedPrompt), running: make(map[string]string), retries: make(map[string]bool)}
+}
+
+// enqueue adds a prompt to the end of a session's queue and returns it with
+// its position in that session, counting from 1.
+func (q *promptQueues) enqueue(root string, item queuedPrompt) (queuedPrompt, int, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	waiting := 0
+	for _, queued := range q.pending[root] {
+		if queued.Session != item.Session {
+			continue
+		}
+		waiting++
+		if item.key != "" && queued.key == item.key {
+			return queued, waiting, nil
+		}
+	}
+	if waiting >= promptQueueLimit {
+		return item, 0, fmt.Errorf("%d prompts are already queued in this session", waiting)
+	}
+	q.nextID++
+	item.ID = fmt.Sprintf("queued-%d", q.nextID)
+	item.QueuedAt = time.Now()
+	q.pending[root] = append(q.pending[root], item)
+	return item, waiting + 1, nil
+}
+
+// waiting reports whether prompts are queued in a session.
+func (q *promptQueues) waiting(root, session string) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return slices.ContainsFunc(q.pending[root], func(p queuedPrompt) bool { return p.Session == session })
+}
+
+// list returns a session's queued prompts in the order they will run.
+func (q *promptQueues) list(root, session string) []queuedPrompt {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	var items []queuedPrompt
+	for _, item := range q.pending[root] {
+		if item.Session == session {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// remove drops queued prompts: the one with id, or every prompt of session
+// when id is empty. It returns how many were removed.
+func (q *promptQueues) remove(root, session, id string) int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	before := len(q.pending[root])
+	q.pending[root] = slices.DeleteFunc(q.pending[root], func(p queuedPrompt) bool {
+		drop := p.ID == id || id == "" && p.Session == session
+		if drop && p.done != nil {
+			p.done <- errPromptDropped
+		}
+		return drop
+	})
+	return before - len(q.pending[root])
+}
+
+// take removes and returns the first prompt queued in session, marking it
+// as running, unless a queued prompt is already running in the workspace.
+func (q *promptQueues) take(root, session string) (queuedPrompt, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.running[root] != "" {
+		return queuedPrompt{}, false
+	}
+	i := slices.IndexFunc(q.pending[root], func(p queuedPrompt) bool { return p.Session == session })
+	if i < 0 {
+		return queuedPrompt{}, false
+	}
+	item := q.pending[root][i]
+	q.pending[root] = slices.Delete(q.pending[root], i, i+1)
+	q.running[root] = item.ID
+	return item, true
+}
+
+func (q *promptQueues) finish(root string) {
+	q.mu.Lock()
+	delete(q.running, root)
+	q.mu.Unlock()
+}
+
+// scheduleRetry reports whether the caller should schedule a busy retry for
+// the workspace; only one is pending at a time.
+func (q *promptQueues) scheduleRetry(root string) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.retries[root] {
+		return false
+	}
+	q.retries[root] = true
+	return true
+}
+
+func (q *promptQueues) retried(root string) {
+	q.mu.Lock()
+	delete(q.retries, root)
+	q.mu.Unlock()
+}
+
+func (q *promptQueues) runningIn(root string) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.running[root] != ""
+}
+
+// workspaceBusy reports whether a turn is running in the workspace, so a
+// new prompt has to wait.
+func (s *webServer) workspaceBusy(wsCtx *WorkspaceContext) bool {
+	return wsCtx.turns.Load() > 0 || wsCtx.HasInFlightRequest() || (s.prompts != nil && s.prompts.runningIn(wsCtx.root))
+}
+
+// queuePromptIfBusy queues content when the workspace is running a turn or
+// the session already has prompts waiting, so prompts run in the order they
+// were sent. It reports whether the prompt was queued; the caller replies
+// with queued and stops.
+func (s *webServer) queuePromptIfBusy(wsCtx *WorkspaceContext, content, key string, pins *tooling.PinnedFiles) (item queuedPrompt, position int, queued bool, err error) {
+	if s.prompts == nil {
+		return item, 0, false, nil
+	}
+	if !s.workspaceBusy(wsCtx) && !s.prompts.waiting(wsCtx.root, wsCtx.states.Current().Key()) {
+		return item, 0, false, nil
+	}
+	item, position, err = s.enqueuePrompt(wsCtx, content, key, pins)
+	return item, position, err == nil, err
+}
+
+// enqueuePrompt queues content in the workspace's current session and
+// starts it right away when nothing is running.
+func (s *webServer) enqueuePrompt(wsCtx *WorkspaceContext, content, key string, pins *tooling.PinnedFiles) (queuedPrompt, int, error) {
+	return s.enqueue(wsCtx, queuedPrompt{Content: content, key: key, pins: pins})
+}
+
+// enqueue queues item in the workspace's current session like
+// enqueuePrompt, for callers that follow the turn through item.observe and
+// item.done.
+func (s *webServer) enqueue(wsCtx *WorkspaceContext, item queuedPrompt) (queuedPrompt, int, error) {
+	item.Session = wsCtx.states.Current().Key()
+	item, position, err := s.prompts.enqueue(wsCtx.root, item)
+	if err != nil {
+		return item, 0, err
+	}
+	s.logger.Printf("[ws:%s] prompt %s queued at position %d", wsCtx.root, item.ID, position)
+	s.events.publish("prompt_queue_changed", map[string]any{"workspace": wsCtx.root, "id": item.ID, "status": "queued"})
+	s.advancePrompts(wsCtx)
+	return item, position, nil
+}
+
+// writeQueued replies to a prompt that was queued.
+func (s *webServer) writeQueued(w http.ResponseWriter, r *http.Request, item queuedPrompt, position int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]any{"queued": item, "position": position})
+}
+
+// advancePrompts runs the next prompt queued in the workspace's current
+// session once no turn is running there. Prompts of other sessions wait
+// until their session is current again. Web turns call it when they end;
+// other turns are noticed by a retry.
+func (s *webServer) advancePrompts(wsCtx *WorkspaceContext) {
+	if s.prompts == nil {
+		return
+	}
+	session := wsCtx.states.Current().Key()
+	if !s.prompts.waiting(wsCtx.root, session) {
+		return
+	}
+	if wsCtx.turns.Load() > 0 || wsCtx.HasInFlightRequest() {
+		if s.prompts.scheduleRetry(wsCtx.root) {
+			time.AfterFunc(promptBusyRetry, func() {
+				s.prompts.retried(wsCtx.root)
+				s.advancePrompts(wsCtx)
+			})
+		}
+		return
+	}
+	item, ok := s.prompts.take(wsCtx.root, session)
+	if !ok {
+		return
+	}
+	s.runQueuedPrompt(wsCtx, item)
+}
+
+// runQueuedPrompt runs a queued prompt like a streamed one, so the UI
+// follows it through active_turn, then moves on to the next.
+func (s *webServer) runQueuedPrompt(wsCtx *WorkspaceContext, item queuedPrompt) {
+	turnID := newTurnID()
+	stream := s.streams.start(turnID, wsCtx.root)
+	req, _ := http.NewRequestWithContext(context.Background(), http.MethodPost, "/api/prompt-queue", nil)
+	req.Header.Set("X-Workspace", wsCtx.root)
+	sendEvent := func(eventType string, data any) error {
+		if item.observe != nil {
+			item.observe(eventType, data)
+		}
+		_, _, err := s.recordEvent(req, stream, eventType, data)
+		return err
+	}
+	s.events.publish("prompt_queue_changed", map[string]any{"workspace": wsCtx.root, "id": item.ID, "status": "running", "turn_id": turnID})
+	go func() {
+		sendEvent("turn_started", map[string]any{"turn_id": turnID, "session": item.Session, "queued_id": item.ID})
+		turnErr := s.executeTurn(withUserPins(context.Background(), item.pins), req, wsCtx, item.Content, turnID, sendEvent)
+		stream.finish()
+		s.prompts.finish(wsCtx.root)
+		if turnErr != nil {
+			s.logger.Printf("[ws:%s] queued prompt %s: %v", wsCtx.root, item.ID, turnErr)
+		}
+		if item.done != nil {
+			item.done <- turnErr
+		}
+		s.advancePrompts(wsCtx)
+	}()
+}
+
+// handlePromptQueue lists the current session's queued prompts (GET) and
+// changes the queue (POST). POST takes an action:
+//
+//	add     {content, idempotency_key, pinned_files} queues a prompt behind the
+//	        running turn and replies 202 like a prompt sent while busy
+//	cancel  {id} drops a queued prompt
+//	clear   drops every prompt queued in the session
+func (s *webServer) handlePromptQueue(w http.ResponseWriter, r *http.Request) {
+	workspace := s.getWorkspaceFromRequest(r)
+	if workspace == "" || !s.workspaceExists(workspace) {
+		s.respondError(w, r, http.StatusBadRequest, "select a workspace first")
+		return
+	}
+	wsCtx, err := s.agent.GetOrCreateWorkspaceContext(workspace)
+	if err != nil {
+		s.respondError(w, r, http.StatusInternalServerError, fmt.Sprintf("get workspace context: %v", err))
+		return
+	}
+	session := wsCtx.states.Current().Key()
+
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		var req struct {
+			Action         string   `json:"action"`
+			ID             string   `json:"id"`
+			Content        string   `json:"content"`
+			IdempotencyKey string   `json:"idempotency_key,omitempty"`
+			PinnedFiles    []string `json:"pinned_files,omitempty"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			s.respondError(w, r, http.StatusBadRequest, "invalid payload")
+			return
+		}
+		if !s.claimWorkspace(w, r, workspace) {
+			return
+		}
+		switch req.Action {
+		case "add":
+			content := strings.TrimSpace(req.Content)
+			if content == "" {
+				s.respondError(w, r, http.StatusBadRequest, "content is required")
+				return
+			}
+			pins, err := s.userPins(wsCtx.root, req.PinnedFiles)
+			if err != nil {
+				s.respondError(w, r, http.StatusBadRequest, err.Error())
+				return
+			}
+			item, position, err := s.enqueuePrompt(wsCtx, content, idempotencyKey(r, req.IdempotencyKey), pins)
+			if err != nil {
+				s.respondError(w, r, http.StatusConflict, err.Error())
+				return
+			}
+			s.writeQueued(w, r, item, position)
+			return
+		case "cancel":
+			if strings.TrimSpace(req.ID) == "" {
+				s.respondError(w, r, http.StatusBadRequest, "id required")
+				return
+			}
+			if s.prompts.remove(wsCtx.root, session, req.ID) == 0 {
+				s.respondError(w, r, http.StatusNotFound, "no queued prompt with that id; it may have started already")
+				return
+			}
+		case "clear":
+			s.prompts.remove(wsCtx.root, session, "")
+		default:
+			s.respondError(w, r, http.StatusBadRequest, fmt.Sprintf("unknown action %q", req.Action))
+			return
+		}
+		s.events.publish("prompt_queue_changed", map[string]any{"workspace": wsCtx.root, "id": req.ID, "status": "cancelled"})
+	default:
+		s.respondError(w, r, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	queued := s.prompts.list(wsCtx.root, session)
+	if queued == nil {
+		queued = []queuedPrompt{}
+	}
+	s.writeJSON(w, r, map[string]any{"session": session, "queued": queued})
+}
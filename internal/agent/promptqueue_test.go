@@ -0,0 +1,145 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"cando/internal/llm"
+	"cando/internal/state"
+)
+
+// gatedClient holds its first reply until release is closed and records
+// the last user message of every request.
+type gatedClient struct {
+	release chan struct{}
+	once    sync.Once
+	mu      sync.Mutex
+	prompts []string
+}
+
+func (c *gatedClient) Chat(ctx context.Context, req llm.ChatRequest) (llm.ChatResponse, error) {
+	var first bool
+	c.once.Do(func() { first = true })
+	if first {
+		select {
+		case <-c.release:
+		case <-ctx.Done():
+			return llm.ChatResponse{}, ctx.Err()
+		}
+	}
+	c.mu.Lock()
+	for i := len(req.Messages) - 1; i >= 0; i-- {
+		if req.Messages[i].Role == "user" {
+			c.prompts = append(c.prompts, req.Messages[i].Content)
+			break
+		}
+	}
+	c.mu.Unlock()
+	return llm.ChatResponse{Choices: []llm.ChatChoice{{
+		Message:      state.Message{Role: "assistant", Content: "ok"},
+		FinishReason: "stop",
+	}}}, nil
+}
+
+func (c *gatedClient) seen() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]string(nil), c.prompts...)
+}
+
+func TestPromptsQueueBehindRunningTurn(t *testing.T) {
+	configDir := t.TempDir()
+	t.Setenv("CANDO_CONFIG_DIR", configDir)
+	workspace := t.TempDir()
+	cfg := baseTestConfig(workspace)
+	client := &gatedClient{release: make(chan struct{})}
+	// Streaming callbacks read the active provider, so wrap like main does
+	multi, err := NewMultiProviderClient("mock", []ProviderRegistration{
+		{Option: ProviderOption{Key: "mock", Label: "Mock", Model: cfg.Model}, Client: client},
+	})
+	if err != nil {
+		t.Fatalf("multi provider: %v", err)
+	}
+	agent := newTestAgent(t, multi, cfg)
+	manager := &WorkspaceManager{filePath: filepath.Join(configDir, "workspaces.json")}
+	if _, err := manager.Add(workspace); err != nil {
+		t.Fatal(err)
+	}
+	s := &webServer{
+		agent:            agent,
+		logger:           log.New(io.Discard, "", 0),
+		workspaceManager: manager,
+		submissions:      newIdempotencyStore(),
+		streams:          newTurnStreams(),
+		prompts:          newPromptQueues(),
+	}
+	wsCtx, err := agent.GetOrCreateWorkspaceContext(workspace)
+	if err != nil {
+		t.Fatal(err)
+	}
+	post := func(path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, path+"?workspace="+workspace, strings.NewReader(body))
+		rec := httptest.NewRecorder()
+		switch path {
+		case "/api/stream":
+			s.handleStream(rec, req)
+		default:
+			s.handlePromptQueue(rec, req)
+		}
+		return rec
+	}
+
+	first := make(chan *httptest.ResponseRecorder)
+	go func() { first <- post("/api/stream", `{"content":"first"}`) }()
+	deadline := time.Now().Add(5 * time.Second)
+	for !wsCtx.HasInFlightRequest() {
+		if time.Now().After(deadline) {
+			t.Fatal("first turn never started")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	rec := post("/api/stream", `{"content":"second"}`)
+	var queued struct {
+		Queued   queuedPrompt `json:"queued"`
+		Position int          `json:"position"`
+	}
+	if rec.Code != http.StatusAccepted || json.Unmarshal(rec.Body.Bytes(), &queued) != nil || queued.Position != 1 {
+		t.Fatalf("follow-up not queued: %d %s", rec.Code, rec.Body.String())
+	}
+	if rec := post("/api/prompt-queue", `{"action":"add","content":"third"}`); rec.Code != http.StatusAccepted {
+		t.Fatalf("add = %d %s", rec.Code, rec.Body.String())
+	}
+	listed := s.prompts.list(wsCtx.root, wsCtx.states.CurrentKey())
+	if len(listed) != 2 || listed[0].Content != "second" || listed[1].Content != "third" {
+		t.Fatalf("queue = %+v", listed)
+	}
+	if rec := post("/api/prompt-queue", `{"action":"cancel","id":"`+listed[1].ID+`"}`); rec.Code != http.StatusOK {
+		t.Fatalf("cancel = %d %s", rec.Code, rec.Body.String())
+	}
+
+	close(client.release)
+	<-first
+	for len(client.seen()) < 2 {
+		if time.Now().After(deadline) {
+			t.Fatalf("queued prompt never ran; seen %q", client.seen())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	time.Sleep(50 * time.Millisecond) // A cancelled prompt would run now
+	if seen := client.seen(); len(seen) != 2 || seen[0] != "first" || seen[1] != "second" {
+		t.Fatalf("prompts ran as %q", seen)
+	}
+	if left := s.prompts.list(wsCtx.root, wsCtx.states.CurrentKey()); len(left) != 0 {
+		t.Fatalf("queue not drained: %+v", left)
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"strings"
 	"sync"
 
+	"cando/internal/credentials"
 	"cando/internal/llm"
 )
 
@@ -22,6 +23,7 @@ type ProviderOption struct {
 type ProviderRegistration struct {
 	Option ProviderOption
 	Client llm.Client
+	Scope  credentials.Scope // Models the provider's key may be used with
 }
 
 // ProviderSwitcher exposes the ability to switch between providers/models at runtime.
@@ -40,6 +42,7 @@ type multiProviderClient struct {
 type providerEntry struct {
 	option ProviderOption
 	client llm.Client
+	scope  credentials.Scope
 }
 
 // NewMultiProviderClient builds a Chat client capable of switching between the registered providers.
@@ -59,6 +62,7 @@ func NewMultiProviderClient(defaultKey string, regs []ProviderRegistration) (llm
 		entries[key] = providerEntry{
 			option: reg.Option,
 			client: reg.Client,
+			scope:  reg.Scope,
 		}
 	}
 	active := defaultKey
@@ -75,14 +79,24 @@ func NewMultiProviderClient(defaultKey string, regs []ProviderRegistration) (llm
 }
 
 func (m *multiProviderClient) Chat(ctx context.Context, req llm.ChatRequest) (llm.ChatResponse, error) {
+	return m.ChatStream(ctx, req, nil)
+}
+
+// ChatStream streams from the active provider when it supports streaming.
+func (m *multiProviderClient) ChatStream(ctx context.Context, req llm.ChatRequest, onDelta func(llm.Delta)) (llm.ChatResponse, error) {
 	entry, err := m.activeEntry()
 	if err != nil {
 		return llm.ChatResponse{}, err
 	}
-	if entry.option.Model != "" {
+	if model := modelOverride(ctx); model != "" {
+		req.Model = model
+	} else if entry.option.Model != "" {
 		req.Model = entry.option.Model
 	}
-	return entry.client.Chat(ctx, req)
+	if err := entry.scope.Check(req.Model); err != nil {
+		return llm.ChatResponse{}, llm.NewProviderError(entry.option.Key, llm.ErrorTypeScope, "scope", err.Error())
+	}
+	return llm.ChatStream(ctx, entry.client, req, onDelta)
 }
 
 func (m *multiProviderClient) activeEntry() (providerEntry, error) {
@@ -128,3 +142,16 @@ func (m *multiProviderClient) SetActiveProvider(key string) error {
 	m.activeKey = key
 	return nil
 }
+
+// accountReporter returns the registered provider's client when it can
+// report account usage.
+func (m *multiProviderClient) accountReporter(key string) (llm.AccountReporter, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	entry, ok := m.entries[key]
+	if !ok {
+		return nil, false
+	}
+	reporter, ok := entry.client.(llm.AccountReporter)
+	return reporter, ok
+}
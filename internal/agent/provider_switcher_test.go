@@ -0,0 +1,57 @@
+package agent
+
+import (
+	"context"
+	"testing"
+
+	"cando/internal/credentials"
+	"cando/internal/llm"
+)
+
+func TestMultiProviderClientEnforcesKeyScope(t *testing.T) {
+	free := newScriptedClient(llm.ChatResponse{})
+	full := newScriptedClient(llm.ChatResponse{})
+	client, err := NewMultiProviderClient("openrouter", []ProviderRegistration{
+		{
+			Option: ProviderOption{Key: "openrouter", Model: "deepseek/deepseek-chat"},
+			Client: free,
+			Scope:  credentials.Scope{FreeModelsOnly: true},
+		},
+		{
+			Option: ProviderOption{Key: "zai", Model: "glm-4.6"},
+			Client: full,
+		},
+	})
+	if err != nil {
+		t.Fatalf("new client: %v", err)
+	}
+
+	_, err = client.Chat(context.Background(), llm.ChatRequest{})
+	pe, ok := llm.IsProviderError(err)
+	if !ok || pe.Type != llm.ErrorTypeScope || pe.Retryable {
+		t.Fatalf("expected non-retryable scope error, got %v", err)
+	}
+	if free.callCount != 0 {
+		t.Fatalf("out-of-scope request reached the provider")
+	}
+
+	if err := client.(ProviderSwitcher).SetActiveProvider("zai"); err != nil {
+		t.Fatalf("switch provider: %v", err)
+	}
+	if _, err := client.Chat(context.Background(), llm.ChatRequest{}); err != nil {
+		t.Fatalf("unscoped key rejected request: %v", err)
+	}
+}
+
+func TestScopeCheck(t *testing.T) {
+	scope := credentials.Scope{AllowedModels: []string{"z-ai/*", "qwen/*"}, DeniedModels: []string{"qwen/qwen3-max"}}
+	if err := scope.Check("z-ai/glm-4.6"); err != nil {
+		t.Fatalf("allowed model rejected: %v", err)
+	}
+	if err := scope.Check("qwen/qwen3-max"); err == nil {
+		t.Fatalf("denied model accepted")
+	}
+	if err := scope.Check("openai/gpt-5"); err == nil {
+		t.Fatalf("model outside allow list accepted")
+	}
+}
@@ -0,0 +1,150 @@
+package agent
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"cando/internal/llm"
+)
+
+const (
+	quotaCacheTTL      = 5 * time.Minute
+	quotaFetchTimeout  = 10 * time.Second
+	quotaErrorCacheTTL = time.Minute // Back off from failing account endpoints
+)
+
+// quotaEntry is the last account lookup for one provider.
+type quotaEntry struct {
+	status    *llm.AccountStatus
+	err       string
+	checkedAt time.Time
+	fetching  bool
+}
+
+// quotaCache keeps provider account status so session payloads never block
+// on account endpoints.
+type quotaCache struct {
+	mu      sync.Mutex
+	entries map[string]*quotaEntry
+}
+
+// accountReporterFor returns the account reporter for a provider key.
+func (a *Agent) accountReporterFor(key string) (llm.AccountReporter, bool) {
+	if multi, ok := a.client.(*multiProviderClient); ok {
+		return multi.accountReporter(key)
+	}
+	reporter, ok := a.client.(llm.AccountReporter)
+	return reporter, ok
+}
+
+// providerAccountStatus returns the provider's account status, querying the
+// provider when the cached value is stale or refresh is set.
+func (a *Agent) providerAccountStatus(ctx context.Context, key string, refresh bool) (*llm.AccountStatus, string) {
+	reporter, ok := a.accountReporterFor(key)
+	if !ok {
+		return nil, "usage reporting not supported"
+	}
+	a.quota.mu.Lock()
+	if a.quota.entries == nil {
+		a.quota.entries = make(map[string]*quotaEntry)
+	}
+	entry := a.quota.entries[key]
+	if entry != nil && !refresh && entry.fresh(time.Now()) {
+		status, errMsg := entry.status, entry.err
+		a.quota.mu.Unlock()
+		return status, errMsg
+	}
+	a.quota.mu.Unlock()
+
+	fetchCtx, cancel := context.WithTimeout(ctx, quotaFetchTimeout)
+	defer cancel()
+	status, err := reporter.AccountStatus(fetchCtx)
+	result := &quotaEntry{status: status, checkedAt: time.Now()}
+	if err != nil {
+		result.err = err.Error()
+		a.logger.Printf("[quota] %s account lookup failed: %v", key, err)
+	}
+	a.quota.mu.Lock()
+	a.quota.entries[key] = result
+	a.quota.mu.Unlock()
+	return result.status, result.err
+}
+
+// cachedAccountStatus returns the last known status without blocking and
+// refreshes it in the background when stale.
+func (a *Agent) cachedAccountStatus(key string) *llm.AccountStatus {
+	if _, ok := a.accountReporterFor(key); !ok {
+		return nil
+	}
+	a.quota.mu.Lock()
+	defer a.quota.mu.Unlock()
+	if a.quota.entries == nil {
+		a.quota.entries = make(map[string]*quotaEntry)
+	}
+	entry := a.quota.entries[key]
+	if entry == nil {
+		entry = &quotaEntry{}
+		a.quota.entries[key] = entry
+	}
+	if !entry.fetching && !entry.fresh(time.Now()) {
+		entry.fetching = true
+		go a.providerAccountStatus(context.Background(), key, true)
+	}
+	return entry.status
+}
+
+func (e *quotaEntry) fresh(now time.Time) bool {
+	if e.checkedAt.IsZero() {
+		return false
+	}
+	ttl := quotaCacheTTL
+	if e.err != "" {
+		ttl = quotaErrorCacheTTL
+	}
+	return now.Sub(e.checkedAt) < ttl
+}
+
+// handleProviderUsage reports remaining quota or credit for every configured
+// provider. ?refresh=1 bypasses the cache.
+func (s *webServer) handleProviderUsage(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.respondError(w, r, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	refresh := r.URL.Query().Get("refresh") == "1"
+
+	type providerUsage struct {
+		Key     string             `json:"key"`
+		Label   string             `json:"label"`
+		Active  bool               `json:"active"`
+		Account *llm.AccountStatus `json:"account,omitempty"`
+		Error   string             `json:"error,omitempty"`
+		// Pricing of the provider's current model, when known
+		Pricing        *modelPrice `json:"pricing,omitempty"`
+		SessionCostUSD float64     `json:"session_cost_usd"`
+	}
+	var options []ProviderOption
+	if s.agent.providerCtrl != nil {
+		options = s.agent.providerCtrl.ProviderOptions()
+	}
+	active := s.agent.ActiveProviderKey()
+	usage := make([]providerUsage, 0, len(options))
+	for _, opt := range options {
+		status, errMsg := s.agent.providerAccountStatus(r.Context(), opt.Key, refresh)
+		entry := providerUsage{
+			Key:            opt.Key,
+			Label:          opt.Label,
+			Active:         opt.Key == active,
+			Account:        status,
+			Error:          errMsg,
+			SessionCostUSD: s.agent.costs.total(opt.Key),
+		}
+		if price, ok := s.agent.modelPricing(opt.Key, opt.Model); ok {
+			entry.Pricing = &price
+		}
+		usage = append(usage, entry)
+	}
+	s.writeJSON(w, r, map[string]any{"providers": usage})
+}
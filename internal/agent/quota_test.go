@@ -0,0 +1,48 @@
+package agent
+
+import (
+	"context"
+	"testing"
+
+	"cando/internal/llm"
+)
+
+// accountClient is a chat client that also reports account usage.
+type accountClient struct {
+	*scriptedClient
+	calls int
+}
+
+func (c *accountClient) AccountStatus(context.Context) (*llm.AccountStatus, error) {
+	c.calls++
+	status := &llm.AccountStatus{Provider: "openrouter", Unit: "usd"}
+	status.SetLimit(10, 9.5)
+	return status, nil
+}
+
+func TestProviderAccountStatusCachesLookups(t *testing.T) {
+	inner := &accountClient{scriptedClient: newScriptedClient()}
+	client, err := NewMultiProviderClient("openrouter", []ProviderRegistration{
+		{Option: ProviderOption{Key: "openrouter", Model: "m"}, Client: inner},
+	})
+	if err != nil {
+		t.Fatalf("new client: %v", err)
+	}
+	agent := newTestAgent(t, client, baseTestConfig(t.TempDir()))
+
+	status, errMsg := agent.providerAccountStatus(context.Background(), "openrouter", false)
+	if errMsg != "" || status == nil {
+		t.Fatalf("lookup failed: %q", errMsg)
+	}
+	if !status.Low || status.Remaining == nil || *status.Remaining != 0.5 {
+		t.Fatalf("expected low remaining credit, got %+v", status)
+	}
+	agent.providerAccountStatus(context.Background(), "openrouter", false)
+	if inner.calls != 1 {
+		t.Fatalf("expected cached status, provider queried %d times", inner.calls)
+	}
+	agent.providerAccountStatus(context.Background(), "openrouter", true)
+	if inner.calls != 2 {
+		t.Fatalf("refresh should query the provider again")
+	}
+}
@@ -0,0 +1,151 @@
+package agent
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// endpointLimits are per-minute budgets for mutating requests to endpoints
+// that start turns, write to disk or restart the server. They apply per
+// client on top of web.rate_limit.
+var endpointLimits = map[string]int{
+	"/api/stream":             30,
+	"/api/prompt":             30,
+	"/api/turns":              30,
+	"/api/tasks":              60,
+	"/api/update":             6,
+	"/api/restart":            6,
+	"/api/knowledge/import":   10,
+	"/api/diagnostics/bundle": 10,
+	"/api/feedback":           60,
+	"/api/telemetry":          60,
+	"/api/files/save":         120,
+	"/api/files/create":       120,
+	"/api/files/upload":       60,
+}
+
+// ownBodyLimit lists endpoints that enforce a larger body limit themselves.
+var ownBodyLimit = map[string]bool{
+	"/api/knowledge/import": true,
+	"/api/files/upload":     true,
+}
+
+// bucketIdle is how long an unused bucket is kept. A bucket idle this long
+// has refilled completely, so dropping it changes nothing.
+const bucketIdle = 10 * time.Minute
+
+type tokenBucket struct {
+	tokens  float64
+	last    time.Time
+	limited bool // Rejections are logged once per run of them
+}
+
+// rateLimiter keeps a token bucket per client address and scope. Buckets
+// hold ten seconds' worth of requests, so short bursts such as a page load
+// pass.
+type rateLimiter struct {
+	mu        sync.Mutex
+	buckets   map[string]*tokenBucket
+	now       func() time.Time
+	lastSweep time.Time
+}
+
+func newRateLimiter() *rateLimiter {
+	return &rateLimiter{buckets: make(map[string]*tokenBucket), now: time.Now}
+}
+
+// allow takes a token from the bucket for key. When the bucket is empty it
+// returns how long until the next token, and whether this is the first
+// rejection since the last allowed request.
+func (l *rateLimiter) allow(key string, perMinute int) (ok bool, retryAfter time.Duration, first bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	if now.Sub(l.lastSweep) > time.Minute {
+		for k, b := range l.buckets {
+			if now.Sub(b.last) > bucketIdle {
+				delete(l.buckets, k)
+			}
+		}
+		l.lastSweep = now
+	}
+	rate := float64(perMinute) / 60 // Tokens per second
+	burst := math.Max(1, float64(perMinute)/6)
+	b, exists := l.buckets[key]
+	if !exists {
+		b = &tokenBucket{tokens: burst, last: now}
+		l.buckets[key] = b
+	}
+	b.tokens = math.Min(burst, b.tokens+now.Sub(b.last).Seconds()*rate)
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		b.limited = false
+		return true, 0, false
+	}
+	first = !b.limited
+	b.limited = true
+	return false, time.Duration((1 - b.tokens) / rate * float64(time.Second)), first
+}
+
+// clientAddress identifies the client a request is counted against. The
+// peer address is used as is; forwarding headers are not trusted.
+func clientAddress(r *http.Request) string {
+	if viaUnixSocket(r) {
+		return "unix"
+	}
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+	return r.RemoteAddr
+}
+
+// limitRequests applies web.rate_limit per client, the tighter
+// endpointLimits, and web.max_body_mb to request bodies.
+func (s *webServer) limitRequests(limiter *rateLimiter, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		web := s.agent.cfg.Load().Web
+		if perMinute := web.RequestsPerMinute(); perMinute > 0 {
+			client := clientAddress(r)
+			if !s.takeToken(w, r, limiter, client, perMinute) {
+				return
+			}
+			if endpoint, ok := endpointLimits[r.URL.Path]; ok && isMutating(r.Method) {
+				if !s.takeToken(w, r, limiter, client+" "+r.URL.Path, min(endpoint, perMinute)) {
+					return
+				}
+			}
+		}
+		if limit := web.MaxBodyBytes(); limit > 0 && isMutating(r.Method) && !ownBodyLimit[r.URL.Path] {
+			if r.ContentLength > limit {
+				s.respondError(w, r, http.StatusRequestEntityTooLarge, fmt.Sprintf("request body over %d MB; raise web.max_body_mb", limit>>20))
+				return
+			}
+			r.Body = http.MaxBytesReader(w, r.Body, limit)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *webServer) takeToken(w http.ResponseWriter, r *http.Request, limiter *rateLimiter, key string, perMinute int) bool {
+	ok, retryAfter, first := limiter.allow(key, perMinute)
+	if ok {
+		return true
+	}
+	seconds := int(math.Ceil(retryAfter.Seconds()))
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	message := fmt.Sprintf("too many requests; retry in %ds", seconds)
+	// Log the start of a run of rejections, not each one, so a client
+	// hammering the server cannot fill the log
+	if first {
+		s.respondError(w, r, http.StatusTooManyRequests, message)
+	} else {
+		http.Error(w, message, http.StatusTooManyRequests)
+	}
+	return false
+}
@@ -0,0 +1,98 @@
+package agent
+
+import (
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRateLimiterRefills(t *testing.T) {
+	limiter := newRateLimiter()
+	now := time.Unix(0, 0)
+	limiter.now = func() time.Time { return now }
+
+	// 60 per minute allows a burst of 10, then one a second
+	for i := range 10 {
+		if ok, _, _ := limiter.allow("a", 60); !ok {
+			t.Fatalf("request %d of the burst rejected", i)
+		}
+	}
+	ok, retry, first := limiter.allow("a", 60)
+	if ok || !first || retry != time.Second {
+		t.Fatalf("after burst: ok=%v retry=%s first=%v", ok, retry, first)
+	}
+	if _, _, first := limiter.allow("a", 60); first {
+		t.Error("second rejection reported as first")
+	}
+	if ok, _, _ := limiter.allow("b", 60); !ok {
+		t.Error("clients share a bucket")
+	}
+	now = now.Add(1500 * time.Millisecond)
+	if ok, _, _ := limiter.allow("a", 60); !ok {
+		t.Error("bucket did not refill")
+	}
+	now = now.Add(bucketIdle + 2*time.Minute)
+	limiter.allow("c", 60)
+	if _, kept := limiter.buckets["a"]; kept {
+		t.Error("idle bucket not swept")
+	}
+}
+
+func TestLimitRequests(t *testing.T) {
+	cfg := baseTestConfig(t.TempDir())
+	cfg.Web.MaxBodyMB = 1
+	s := &webServer{agent: &Agent{cfg: newRuntimeConfig(cfg)}, logger: log.New(io.Discard, "", 0)}
+	handler := s.limitRequests(newRateLimiter(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, err := io.ReadAll(r.Body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		}
+	}))
+	send := func(method, path, remote string, body io.Reader) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, body)
+		req.RemoteAddr = remote
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// /api/stream allows 30 a minute, a burst of 5
+	for range 5 {
+		if rec := send(http.MethodPost, "/api/stream", "10.0.0.1:5000", nil); rec.Code != http.StatusOK {
+			t.Fatalf("stream = %d", rec.Code)
+		}
+	}
+	rec := send(http.MethodPost, "/api/stream", "10.0.0.1:5001", nil)
+	if rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") != "2" {
+		t.Fatalf("sixth stream = %d, Retry-After %q", rec.Code, rec.Header().Get("Retry-After"))
+	}
+	if rec := send(http.MethodGet, "/api/stream", "10.0.0.1:5000", nil); rec.Code != http.StatusOK {
+		t.Errorf("reads of a limited endpoint = %d", rec.Code)
+	}
+	if rec := send(http.MethodPost, "/api/stream", "10.0.0.2:5000", nil); rec.Code != http.StatusOK {
+		t.Errorf("other client = %d", rec.Code)
+	}
+
+	big := strings.Repeat("x", 1<<20+1)
+	if rec := send(http.MethodPost, "/api/files/save", "10.0.0.3:5000", strings.NewReader(big)); rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("oversized body = %d", rec.Code)
+	}
+	req := httptest.NewRequest(http.MethodPost, "/api/files/save", io.NopCloser(strings.NewReader(big)))
+	req.ContentLength = -1 // Chunked: only the reader catches it
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("oversized chunked body = %d", rec.Code)
+	}
+
+	cfg.Web.RateLimit = -1
+	s.agent.cfg = newRuntimeConfig(cfg)
+	for range 20 {
+		if rec := send(http.MethodPost, "/api/stream", "10.0.0.1:5000", nil); rec.Code != http.StatusOK {
+			t.Fatalf("limits disabled: %d", rec.Code)
+		}
+	}
+}
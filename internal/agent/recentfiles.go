@@ -0,0 +1,176 @@
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+
+	"cando/internal/state"
+)
+
+const (
+	// maxRecentFiles is how many files are remembered per session.
+	maxRecentFiles = 20
+	// recentFilesShown is how many are listed in the system message.
+	recentFilesShown = 12
+)
+
+// recentFile is a file a session's tools read or changed.
+type recentFile struct {
+	Path   string `json:"path"`
+	Action string `json:"action"` // read | edited | moved | deleted
+}
+
+// noteRecentFile moves path to the front of the session's recent files.
+func (w *WorkspaceContext) noteRecentFile(session, path, action string) {
+	w.recentMu.Lock()
+	defer w.recentMu.Unlock()
+	if w.recentFiles == nil {
+		w.recentFiles = make(map[string][]recentFile)
+	}
+	files := []recentFile{{Path: path, Action: action}}
+	for _, f := range w.recentFiles[session] {
+		if f.Path != path && len(files) < maxRecentFiles {
+			files = append(files, f)
+		}
+	}
+	w.recentFiles[session] = files
+}
+
+// recentFilesHint renders the session's recent files for the system message.
+func (w *WorkspaceContext) recentFilesHint(session string) string {
+	w.recentMu.Lock()
+	files := w.recentFiles[session]
+	w.recentMu.Unlock()
+	if len(files) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	for i, f := range files {
+		if i == recentFilesShown {
+			break
+		}
+		fmt.Fprintf(&b, "- %s (%s)\n", f.Path, f.Action)
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// recentFilePaths returns up to n of the session's recent files, newest
+// first, leaving out deleted ones.
+func (w *WorkspaceContext) recentFilePaths(session string, n int) []string {
+	w.recentMu.Lock()
+	defer w.recentMu.Unlock()
+	var paths []string
+	for _, f := range w.recentFiles[session] {
+		if len(paths) == n {
+			break
+		}
+		if f.Action != "deleted" {
+			paths = append(paths, f.Path)
+		}
+	}
+	return paths
+}
+
+// trackRecentFiles wraps a stream callback to note the files successful
+// read and edit tool calls touch.
+func trackRecentFiles(wsCtx *WorkspaceContext, session string, next StreamCallback) StreamCallback {
+	var mu sync.Mutex
+	pending := make(map[string]map[string]any)
+	return func(eventType string, data any) error {
+		if payload, ok := data.(map[string]any); ok {
+			id, _ := payload["id"].(string)
+			mu.Lock()
+			switch eventType {
+			case "tool_call_started":
+				raw, _ := payload["arguments"].(string)
+				var args map[string]any
+				if json.Unmarshal([]byte(raw), &args) == nil {
+					pending[id] = args
+				}
+			case "tool_call_completed":
+				args := pending[id]
+				delete(pending, id)
+				failed, _ := payload["error"].(bool)
+				function, _ := payload["function"].(string)
+				if !failed {
+					for _, f := range touchedFiles(wsCtx.root, function, args) {
+						wsCtx.noteRecentFile(session, f.Path, f.Action)
+					}
+				}
+			}
+			mu.Unlock()
+		}
+		if next == nil {
+			return nil
+		}
+		return next(eventType, data)
+	}
+}
+
+// touchedFiles returns the workspace-relative files a tool call read or
+// changed.
+func touchedFiles(root, function string, args map[string]any) []recentFile {
+	var files []recentFile
+	add := func(path, action string) {
+		if rel, err := lexicalRelPath(root, path); err == nil {
+			files = append(files, recentFile{Path: rel, Action: action})
+		}
+	}
+	path, _ := args["path"].(string)
+	action, _ := args["action"].(string)
+	paths := editedPaths(function, args)
+	switch {
+	case function == "read_file" || function == "preview_file" || function == "notebook" && action == "read":
+		if path != "" {
+			add(path, "read")
+		}
+	case function == "delete_path" && len(paths) == 1:
+		add(paths[0], "deleted")
+	case function == "rename_path" && len(paths) == 2:
+		if from, err := lexicalRelPath(root, paths[0]); err == nil {
+			add(paths[1], "moved from "+from)
+		}
+	default:
+		for _, p := range paths {
+			add(p, "edited")
+		}
+	}
+	return files
+}
+
+// injectRecentFiles appends the session's recently touched files to the
+// system message.
+func injectRecentFiles(messages []state.Message, hint string) []state.Message {
+	if hint == "" || len(messages) == 0 {
+		return messages
+	}
+
+	// Make a copy to avoid modifying the original
+	result := make([]state.Message, len(messages))
+	copy(result, messages)
+
+	for i, msg := range result {
+		if msg.Role == "system" {
+			result[i].Content = msg.Content + "\n\n---\nRecently touched files in this session (newest first). Reuse what you already know about them; re-read one only if you need content that is no longer in the conversation or it may have changed since:\n" + hint
+			break
+		}
+	}
+	return result
+}
+
+// loadRecentFilesHint returns the recent files of the workspace's current
+// session, or "" when there is no workspace context or the hint is disabled.
+func (a *Agent) loadRecentFilesHint(workspaceRoot string, conv *state.Conversation) string {
+	if workspaceRoot == "" || !a.cfg.Load().IsRecentFilesHintEnabled() {
+		return ""
+	}
+	a.workspacesMu.RLock()
+	wsCtx := a.workspaceContexts[workspaceRoot]
+	a.workspacesMu.RUnlock()
+	if wsCtx == nil {
+		return ""
+	}
+	return wsCtx.recentFilesHint(conv.Key())
+}
@@ -0,0 +1,38 @@
+package agent
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestTrackRecentFiles(t *testing.T) {
+	wsCtx := &WorkspaceContext{root: "/work"}
+	callback := trackRecentFiles(wsCtx, "main", nil)
+	call := func(id, function string, args map[string]any, failed bool) {
+		raw, _ := json.Marshal(args)
+		callback("tool_call_started", map[string]any{"id": id, "function": function, "arguments": string(raw)})
+		callback("tool_call_completed", map[string]any{"id": id, "function": function, "error": failed})
+	}
+
+	call("1", "read_file", map[string]any{"path": "a.go"}, false)
+	call("2", "edit_file", map[string]any{"path": "/work/b.go"}, false)
+	call("3", "read_file", map[string]any{"path": "missing.go"}, true)
+	call("4", "rename_path", map[string]any{"from": "c.go", "to": "d/c.go"}, false)
+	call("5", "read_file", map[string]any{"path": "../outside.go"}, false)
+	call("6", "write_file", map[string]any{"path": "a.go", "content": "x"}, false)
+
+	want := "- a.go (edited)\n- d/c.go (moved from c.go)\n- b.go (edited)"
+	if got := wsCtx.recentFilesHint("main"); got != want {
+		t.Errorf("hint =\n%s\nwant\n%s", got, want)
+	}
+	if got := wsCtx.recentFilesHint("other"); got != "" {
+		t.Errorf("other session hint = %q", got)
+	}
+
+	for i := 0; i < maxRecentFiles+5; i++ {
+		wsCtx.noteRecentFile("main", string(rune('a'+i))+".txt", "read")
+	}
+	if n := len(wsCtx.recentFiles["main"]); n != maxRecentFiles {
+		t.Errorf("kept %d files, want %d", n, maxRecentFiles)
+	}
+}
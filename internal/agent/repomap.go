@@ -0,0 +1,47 @@
+package agent
+
+import (
+	"cando/internal/repomap"
+	"cando/internal/state"
+)
+
+// loadRepoMap renders the workspace's repository map within budget,
+// ranking files and symbols named in the latest user message first.
+func (a *Agent) loadRepoMap(workspaceRoot string, conv *state.Conversation, budget int) string {
+	if workspaceRoot == "" || budget <= 0 {
+		return ""
+	}
+	m := repomap.ForRoot(workspaceRoot)
+	if err := m.Refresh(); err != nil {
+		a.logger.Printf("[repomap] refresh %s failed: %v", workspaceRoot, err)
+		return ""
+	}
+	focus := ""
+	messages := conv.Messages()
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messages[i].Role == "user" {
+			focus = messages[i].Content
+			break
+		}
+	}
+	return m.Render(repomap.Options{MaxTokens: budget, Focus: focus})
+}
+
+// injectRepoMap appends the repository map to the system message.
+func injectRepoMap(messages []state.Message, repoMap string) []state.Message {
+	if repoMap == "" || len(messages) == 0 {
+		return messages
+	}
+
+	// Make a copy to avoid modifying the original
+	result := make([]state.Message, len(messages))
+	copy(result, messages)
+
+	for i, msg := range result {
+		if msg.Role == "system" {
+			result[i].Content = msg.Content + "\n\n---\nRepository Map (most referenced files and their definitions; use the repo_map tool for more):\n" + repoMap
+			break
+		}
+	}
+	return result
+}
@@ -0,0 +1,90 @@
+package agent
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"cando/internal/config"
+	"cando/internal/llm"
+	"cando/internal/state"
+)
+
+func toolCallReply(finish string, args ...string) llm.ChatResponse {
+	msg := state.Message{Role: "assistant"}
+	for i, a := range args {
+		msg.ToolCalls = append(msg.ToolCalls, state.ToolCall{
+			ID:       string(rune('a' + i)),
+			Type:     "function",
+			Function: state.FunctionCall{Name: "read_file", Arguments: a},
+		})
+	}
+	return llm.ChatResponse{Choices: []llm.ChatChoice{{Message: msg, FinishReason: finish}}}
+}
+
+func TestValidateResponse(t *testing.T) {
+	textReply := func(content, finish string) llm.ChatResponse {
+		return llm.ChatResponse{Choices: []llm.ChatChoice{{Message: state.Message{Role: "assistant", Content: content}, FinishReason: finish}}}
+	}
+	for _, tc := range []struct {
+		name    string
+		resp    llm.ChatResponse
+		invalid string
+	}{
+		{"answer", textReply("done", "stop"), ""},
+		{"empty stop", textReply(" \n", "stop"), "empty reply"},
+		{"no choices", llm.ChatResponse{}, "no choices"},
+		{"distinct calls", toolCallReply("tool_calls", `{"path":"a.go"}`, `{"path":"b.go"}`), ""},
+		{"no arguments", toolCallReply("tool_calls", ""), ""},
+		{"duplicate calls", toolCallReply("tool_calls", `{"path":"a.go"}`, `{ "path": "a.go" }`), "repeated"},
+		{"truncated", toolCallReply("length", `{"path":"a.`), "cut off"},
+		{"malformed", toolCallReply("tool_calls", `{"path":}`), "malformed"},
+	} {
+		err := llm.ValidateResponse("test", tc.resp)
+		if tc.invalid == "" {
+			if err != nil {
+				t.Errorf("%s: unexpected error %v", tc.name, err)
+			}
+			continue
+		}
+		pe, ok := llm.IsProviderError(err)
+		if !ok || pe.Type != llm.ErrorTypeInvalidResponse || !pe.Retryable || !strings.Contains(pe.Message, tc.invalid) {
+			t.Errorf("%s: error = %v", tc.name, err)
+		}
+	}
+}
+
+func TestInvalidResponseIsRetriedWithReason(t *testing.T) {
+	cfg := baseTestConfig(t.TempDir())
+	cfg.RetryPolicies = config.RetryPolicies{"default": {MaxAttempts: 3, BaseDelayMs: 1, MaxDelayMs: 1}}
+	var requests []llm.ChatRequest
+	client := newScriptedClient(toolCallReply("tool_calls", `{"path":"a.go"}`, `{"path":"a.go"}`))
+	client.responder = func(req llm.ChatRequest) llm.ChatResponse {
+		requests = append(requests, req)
+		return toolCallReply("tool_calls", `{"path":"a.go"}`)
+	}
+	agent := newTestAgent(t, client, cfg)
+
+	var retries int
+	callback := func(event string, data any) error {
+		if event == "request_retry" {
+			retries++
+		}
+		return nil
+	}
+	question := []state.Message{{Role: "user", Content: "read a.go"}}
+	resp, err := agent.callProviderWithRetry(context.Background(), llm.ChatRequest{Messages: question}, callback, deltasOff)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Choices[0].Message.ToolCalls) != 1 || retries != 1 {
+		t.Fatalf("response = %+v after %d retries", resp.Choices[0].Message, retries)
+	}
+	// The retry explains the rejection without touching the caller's messages
+	if len(requests) != 1 || len(requests[0].Messages) != 2 || !strings.Contains(requests[0].Messages[1].Content, "repeated") {
+		t.Errorf("retry request = %+v", requests)
+	}
+	if len(question) != 1 {
+		t.Errorf("caller messages changed: %+v", question)
+	}
+}
@@ -0,0 +1,56 @@
+package agent
+
+import (
+	"math/rand/v2"
+	"slices"
+	"time"
+
+	"cando/internal/config"
+	"cando/internal/llm"
+)
+
+// retryPlan applies a provider's retry policy to failed calls.
+type retryPlan struct {
+	policy  config.RetryPolicy
+	backoff time.Duration
+}
+
+func newRetryPlan(policy config.RetryPolicy) *retryPlan {
+	return &retryPlan{policy: policy, backoff: time.Duration(policy.BaseDelayMs) * time.Millisecond}
+}
+
+// errorClass names the failure for retry_on matching: the provider error
+// type, or "network" for transport failures.
+func errorClass(err error) string {
+	if pe, ok := llm.IsProviderError(err); ok {
+		return string(pe.Type)
+	}
+	return "network"
+}
+
+// shouldRetry reports whether err is retried. Without retry_on, provider
+// errors follow their own classification and transport errors are retried.
+func (p *retryPlan) shouldRetry(err error) bool {
+	if len(p.policy.RetryOn) > 0 {
+		return slices.Contains(p.policy.RetryOn, errorClass(err))
+	}
+	if pe, ok := llm.IsProviderError(err); ok {
+		return pe.Retryable
+	}
+	return true
+}
+
+// nextDelay returns the wait before the next attempt: the jittered backoff,
+// or the provider's Retry-After when longer. The backoff doubles up to the
+// cap after each call.
+func (p *retryPlan) nextDelay(err error) time.Duration {
+	delay := p.backoff
+	if p.policy.Jitter > 0 {
+		delay += time.Duration((rand.Float64()*2 - 1) * p.policy.Jitter * float64(delay))
+	}
+	if pe, ok := llm.IsProviderError(err); ok && pe.RetryAfter != nil && *pe.RetryAfter > delay {
+		delay = *pe.RetryAfter
+	}
+	p.backoff = min(p.backoff*2, time.Duration(p.policy.MaxDelayMs)*time.Millisecond)
+	return max(delay, 0)
+}
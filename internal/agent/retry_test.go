@@ -0,0 +1,45 @@
+package agent
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"cando/internal/config"
+	"cando/internal/llm"
+)
+
+func TestRetryPlanHonorsPolicyAndRetryAfter(t *testing.T) {
+	cfg := config.Config{RetryPolicies: config.RetryPolicies{
+		"default":    {MaxAttempts: 3},
+		"openrouter": {BaseDelayMs: 100, MaxDelayMs: 300, RetryOn: []string{"rate_limit", "network"}},
+	}}
+	policy := cfg.RetryPolicyFor("openrouter")
+	if policy.MaxAttempts != 3 || policy.BaseDelayMs != 100 || policy.MaxDelayMs != 300 {
+		t.Fatalf("unexpected merged policy: %+v", policy)
+	}
+	plan := newRetryPlan(policy)
+
+	down := llm.NewProviderError("openrouter", llm.ErrorTypeProviderDown, "503", "down")
+	down.Retryable = true
+	if plan.shouldRetry(down) {
+		t.Fatalf("provider_down is not in retry_on")
+	}
+	if !plan.shouldRetry(errors.New("connection reset")) {
+		t.Fatalf("network errors are in retry_on")
+	}
+
+	limited := llm.NewProviderError("openrouter", llm.ErrorTypeRateLimit, "429", "slow down")
+	limited.ApplyRetryAfter(http.Header{"Retry-After": []string{"2"}})
+	if got := plan.nextDelay(limited); got != 2*time.Second {
+		t.Fatalf("expected Retry-After delay, got %s", got)
+	}
+	if got := plan.nextDelay(errors.New("x")); got != 200*time.Millisecond {
+		t.Fatalf("expected doubled backoff, got %s", got)
+	}
+	plan.nextDelay(errors.New("x"))
+	if got := plan.nextDelay(errors.New("x")); got != 300*time.Millisecond {
+		t.Fatalf("expected capped backoff, got %s", got)
+	}
+}
@@ -0,0 +1,85 @@
+package agent
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"cando/internal/config"
+)
+
+// runtimeConfig holds the agent's live configuration. Readers get immutable
+// snapshots without locking; writers go through Update, which copies the
+// current snapshot, applies the change and publishes the result. A turn
+// loads one snapshot up front so a settings change made mid-turn cannot
+// leave it half old, half new.
+type runtimeConfig struct {
+	current atomic.Pointer[config.Config]
+
+	mu          sync.Mutex // Serializes writers and guards subscribers
+	subscribers map[int]chan config.Config
+	nextID      int
+}
+
+func newRuntimeConfig(cfg config.Config) *runtimeConfig {
+	rc := &runtimeConfig{subscribers: make(map[int]chan config.Config)}
+	snapshot := cfg.Clone()
+	rc.current.Store(&snapshot)
+	return rc
+}
+
+// Load returns the current snapshot. Its maps and slices are shared with
+// other readers and must not be modified; use Update to change settings.
+func (rc *runtimeConfig) Load() config.Config {
+	return *rc.current.Load()
+}
+
+// Update applies fn to a private copy of the current config, publishes it
+// and returns the new snapshot, which callers can hand to config.Save.
+func (rc *runtimeConfig) Update(fn func(*config.Config)) config.Config {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	next := rc.current.Load().Clone()
+	fn(&next)
+	rc.publishLocked(next)
+	return next
+}
+
+// Store replaces the config wholesale, as after reloading it from disk.
+func (rc *runtimeConfig) Store(cfg config.Config) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	rc.publishLocked(cfg.Clone())
+}
+
+func (rc *runtimeConfig) publishLocked(next config.Config) {
+	rc.current.Store(&next)
+	for _, ch := range rc.subscribers {
+		// Each channel holds at most the latest snapshot; a slow subscriber
+		// skips intermediate versions instead of blocking writers.
+		select {
+		case <-ch:
+		default:
+		}
+		ch <- next
+	}
+}
+
+// Subscribe returns a channel that receives each newly published snapshot
+// and a function that stops delivery and closes the channel.
+func (rc *runtimeConfig) Subscribe() (<-chan config.Config, func()) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	id := rc.nextID
+	rc.nextID++
+	ch := make(chan config.Config, 1)
+	rc.subscribers[id] = ch
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			rc.mu.Lock()
+			defer rc.mu.Unlock()
+			delete(rc.subscribers, id)
+			close(ch)
+		})
+	}
+}
@@ -0,0 +1,64 @@
+package agent
+
+import (
+	"sync"
+	"testing"
+
+	"cando/internal/config"
+)
+
+func TestRuntimeConfigUpdateLeavesSnapshotsAlone(t *testing.T) {
+	rc := newRuntimeConfig(config.DefaultConfig())
+	before := rc.Load()
+
+	updated := rc.Update(func(c *config.Config) {
+		c.ProviderModels["example"] = "glm-4.6"
+		c.ThinkingEnabled = !c.ThinkingEnabled
+	})
+	if _, ok := before.ProviderModels["example"]; ok {
+		t.Fatal("update modified a snapshot taken before it")
+	}
+	if got := rc.Load(); got.ProviderModels["example"] != "glm-4.6" || got.ThinkingEnabled != updated.ThinkingEnabled {
+		t.Fatalf("update not published: %+v", got.ProviderModels)
+	}
+}
+
+func TestRuntimeConfigSubscribe(t *testing.T) {
+	rc := newRuntimeConfig(config.DefaultConfig())
+	updates, stop := rc.Subscribe()
+
+	// A subscriber that has not caught up only sees the latest snapshot
+	rc.Update(func(c *config.Config) { c.Temperature = 0.1 })
+	rc.Update(func(c *config.Config) { c.Temperature = 0.2 })
+	if got := <-updates; got.Temperature != 0.2 {
+		t.Fatalf("expected the latest snapshot, got temperature %v", got.Temperature)
+	}
+
+	stop()
+	rc.Update(func(c *config.Config) { c.Temperature = 0.3 })
+	if _, ok := <-updates; ok {
+		t.Fatal("expected the channel to be closed after stop")
+	}
+	stop()
+}
+
+func TestRuntimeConfigConcurrentAccess(t *testing.T) {
+	rc := newRuntimeConfig(config.DefaultConfig())
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			rc.Update(func(c *config.Config) { c.ProviderModels["example"] = "m"; c.RequestTimeoutSeconds++ })
+		}()
+		go func() {
+			defer wg.Done()
+			for range rc.Load().ProviderModels {
+			}
+		}()
+	}
+	wg.Wait()
+	if got := rc.Load().RequestTimeoutSeconds; got != config.DefaultConfig().RequestTimeoutSeconds+8 {
+		t.Fatalf("lost updates: timeout %d", got)
+	}
+}
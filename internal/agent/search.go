@@ -0,0 +1,259 @@
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"cando/internal/state"
+)
+
+const (
+	globalSearchMinQuery     = 2
+	globalSearchDefaultLimit = 20 // Matches per workspace
+	globalSearchMaxLimit     = 200
+	globalSearchSnippetChars = 80 // Context on each side of a match
+)
+
+// searchSettings holds per-workspace search preferences, stored as
+// search.json in project storage.
+type searchSettings struct {
+	ExcludeFromGlobal bool `json:"exclude_from_global"`
+}
+
+func searchSettingsPath(workspaceRoot string) (string, error) {
+	storageRoot, err := ProjectStorageRoot(workspaceRoot)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(storageRoot, "search.json"), nil
+}
+
+func loadSearchSettings(workspaceRoot string) searchSettings {
+	var settings searchSettings
+	path, err := searchSettingsPath(workspaceRoot)
+	if err != nil {
+		return settings
+	}
+	if content, err := os.ReadFile(path); err == nil {
+		_ = json.Unmarshal(content, &settings)
+	}
+	return settings
+}
+
+func saveSearchSettings(workspaceRoot string, settings searchSettings) error {
+	path, err := searchSettingsPath(workspaceRoot)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(settings, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0o644)
+}
+
+// searchMatch is one hit in a conversation message or project fact.
+type searchMatch struct {
+	Kind         string `json:"kind"` // message | fact
+	Session      string `json:"session,omitempty"`
+	MessageIndex int    `json:"message_index,omitempty"`
+	Role         string `json:"role,omitempty"`
+	Snippet      string `json:"snippet"`
+	UpdatedAt    string `json:"updated_at,omitempty"`
+}
+
+// workspaceSearchResult groups matches for one workspace.
+type workspaceSearchResult struct {
+	Workspace string        `json:"workspace"`
+	Name      string        `json:"name"`
+	Matches   []searchMatch `json:"matches"`
+	Truncated bool          `json:"truncated,omitempty"`
+}
+
+// searchWorkspace scans a workspace's project facts and stored conversations
+// for query (case-insensitive), returning at most limit matches.
+func searchWorkspace(ws Workspace, query string, limit int) (workspaceSearchResult, error) {
+	result := workspaceSearchResult{Workspace: ws.Path, Name: ws.Name}
+	needle := strings.ToLower(query)
+	add := func(match searchMatch) bool {
+		if len(result.Matches) >= limit {
+			result.Truncated = true
+			return false
+		}
+		result.Matches = append(result.Matches, match)
+		return true
+	}
+
+	for _, fact := range loadProjectFacts(ws.Path) {
+		if snippet, ok := matchSnippet(fact, needle); ok {
+			if !add(searchMatch{Kind: "fact", Snippet: snippet}) {
+				return result, nil
+			}
+		}
+	}
+
+	storageRoot, err := ProjectStorageRoot(ws.Path)
+	if err != nil {
+		return result, err
+	}
+	conversationDir := filepath.Join(storageRoot, "conversations")
+	if _, err := os.Stat(conversationDir); err != nil {
+		return result, nil
+	}
+	// Conversations are saved on every append, so disk is authoritative
+	states, err := state.NewManager("", conversationDir, nil)
+	if err != nil {
+		return result, err
+	}
+	summaries := states.Summaries() // Most recently updated first
+	for _, summary := range summaries {
+		conv, ok := states.Get(summary.Key)
+		if !ok {
+			continue
+		}
+		for i, msg := range conv.Messages() {
+			if msg.Role == "system" {
+				continue
+			}
+			snippet, ok := matchSnippet(msg.Content, needle)
+			if !ok {
+				continue
+			}
+			match := searchMatch{
+				Kind:         "message",
+				Session:      summary.Key,
+				MessageIndex: i,
+				Role:         msg.Role,
+				Snippet:      snippet,
+				UpdatedAt:    summary.UpdatedAt.Format(time.RFC3339),
+			}
+			if !add(match) {
+				return result, nil
+			}
+		}
+	}
+	return result, nil
+}
+
+// matchSnippet returns the text around the first occurrence of needle
+// (already lower-cased).
+func matchSnippet(text, needle string) (string, bool) {
+	idx := strings.Index(strings.ToLower(text), needle)
+	if idx < 0 {
+		return "", false
+	}
+	start := max(idx-globalSearchSnippetChars, 0)
+	end := min(idx+len(needle)+globalSearchSnippetChars, len(text))
+	// Avoid cutting multi-byte characters
+	for start > 0 && !isRuneStart(text[start]) {
+		start--
+	}
+	for end < len(text) && !isRuneStart(text[end]) {
+		end++
+	}
+	snippet := strings.Join(strings.Fields(text[start:end]), " ")
+	if start > 0 {
+		snippet = "…" + snippet
+	}
+	if end < len(text) {
+		snippet += "…"
+	}
+	return snippet, true
+}
+
+func isRuneStart(b byte) bool {
+	return b&0xC0 != 0x80
+}
+
+// handleGlobalSearch searches conversations and project facts across all
+// registered workspaces, skipping those that opted out.
+func (s *webServer) handleGlobalSearch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.respondError(w, r, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
+	if len(query) < globalSearchMinQuery {
+		s.respondError(w, r, http.StatusBadRequest, fmt.Sprintf("query must be at least %d characters", globalSearchMinQuery))
+		return
+	}
+	limit := globalSearchDefaultLimit
+	if raw := r.URL.Query().Get("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n <= 0 {
+			s.respondError(w, r, http.StatusBadRequest, "limit must be a positive integer")
+			return
+		}
+		limit = min(n, globalSearchMaxLimit)
+	}
+
+	results := []workspaceSearchResult{}
+	total := 0
+	var skipped []string
+	for _, ws := range s.workspaceManager.List() {
+		if loadSearchSettings(ws.Path).ExcludeFromGlobal {
+			skipped = append(skipped, ws.Path)
+			continue
+		}
+		result, err := searchWorkspace(ws, query, limit)
+		if err != nil {
+			s.logger.Printf("[ws:%s] global search failed: %v", ws.Path, err)
+			continue
+		}
+		if len(result.Matches) == 0 {
+			continue
+		}
+		total += len(result.Matches)
+		results = append(results, result)
+	}
+	sort.SliceStable(results, func(i, j int) bool {
+		return len(results[i].Matches) > len(results[j].Matches)
+	})
+
+	s.writeJSON(w, r, map[string]any{
+		"query":      query,
+		"total":      total,
+		"workspaces": results,
+		"excluded":   skipped,
+	})
+}
+
+// handleSearchSettings reads (GET) or updates (POST) the workspace's global
+// search opt-out.
+func (s *webServer) handleSearchSettings(w http.ResponseWriter, r *http.Request) {
+	workspace := s.getWorkspaceFromRequest(r)
+	if workspace == "" || !s.workspaceExists(workspace) {
+		s.respondError(w, r, http.StatusBadRequest, "select a workspace first")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		s.writeJSON(w, r, loadSearchSettings(workspace))
+
+	case http.MethodPost:
+		var req searchSettings
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			s.respondError(w, r, http.StatusBadRequest, "invalid request body")
+			return
+		}
+		if err := saveSearchSettings(workspace, req); err != nil {
+			s.respondError(w, r, http.StatusInternalServerError, fmt.Sprintf("failed to save search settings: %v", err))
+			return
+		}
+		s.writeJSON(w, r, req)
+
+	default:
+		s.respondError(w, r, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
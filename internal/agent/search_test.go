@@ -0,0 +1,54 @@
+package agent
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"cando/internal/state"
+)
+
+func TestSearchWorkspaceFindsMessagesAndFacts(t *testing.T) {
+	t.Setenv("CANDO_CONFIG_DIR", t.TempDir())
+	workspace := t.TempDir()
+
+	if err := saveProjectFacts(workspace, []string{"Uses PostgreSQL for persistence", "Deploys with Helm"}); err != nil {
+		t.Fatalf("save facts: %v", err)
+	}
+	storageRoot, err := ProjectStorageRoot(workspace)
+	if err != nil {
+		t.Fatalf("storage root: %v", err)
+	}
+	states, err := state.NewManager("system", filepath.Join(storageRoot, "conversations"), nil)
+	if err != nil {
+		t.Fatalf("state manager: %v", err)
+	}
+	conv, err := states.NewState("db-choice")
+	if err != nil {
+		t.Fatalf("new state: %v", err)
+	}
+	conv.Append(state.Message{Role: "user", Content: "Why did we pick postgresql over sqlite?"})
+	conv.Append(state.Message{Role: "assistant", Content: "Unrelated answer"})
+	if err := states.Save(conv); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+
+	result, err := searchWorkspace(Workspace{Path: workspace, Name: "demo"}, "PostgreSQL", 10)
+	if err != nil {
+		t.Fatalf("search: %v", err)
+	}
+	if len(result.Matches) != 2 {
+		t.Fatalf("expected fact and message matches, got %+v", result.Matches)
+	}
+	if result.Matches[0].Kind != "fact" || result.Matches[1].Session != "db-choice" || result.Matches[1].MessageIndex != 1 {
+		t.Fatalf("unexpected matches: %+v", result.Matches)
+	}
+	if !strings.Contains(result.Matches[1].Snippet, "postgresql over sqlite") {
+		t.Fatalf("unexpected snippet %q", result.Matches[1].Snippet)
+	}
+
+	limited, _ := searchWorkspace(Workspace{Path: workspace, Name: "demo"}, "postgresql", 1)
+	if len(limited.Matches) != 1 || !limited.Truncated {
+		t.Fatalf("expected truncated single match, got %+v", limited)
+	}
+}
@@ -0,0 +1,96 @@
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// serverEventKeepAlive is how often an idle /api/events stream gets a
+// comment line so proxies keep it open.
+const serverEventKeepAlive = 30 * time.Second
+
+// eventHub fans out server-wide events (not tied to a turn) to every
+// connected UI.
+type eventHub struct {
+	mu   sync.Mutex
+	subs map[chan []byte]struct{}
+}
+
+func newEventHub() *eventHub {
+	return &eventHub{subs: make(map[chan []byte]struct{})}
+}
+
+func (h *eventHub) subscribe() chan []byte {
+	ch := make(chan []byte, 16)
+	h.mu.Lock()
+	h.subs[ch] = struct{}{}
+	h.mu.Unlock()
+	return ch
+}
+
+func (h *eventHub) unsubscribe(ch chan []byte) {
+	h.mu.Lock()
+	delete(h.subs, ch)
+	h.mu.Unlock()
+}
+
+// publish sends an event to all subscribers. Slow subscribers miss events
+// rather than blocking the publisher.
+func (h *eventHub) publish(eventType string, data any) {
+	if h == nil {
+		return
+	}
+	payload, err := json.Marshal(map[string]any{"type": eventType, "data": data})
+	if err != nil {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for ch := range h.subs {
+		select {
+		case ch <- payload:
+		default:
+		}
+	}
+}
+
+// handleEvents streams server-wide events such as config_changed.
+func (s *webServer) handleEvents(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.respondError(w, r, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok || s.events == nil {
+		s.respondError(w, r, http.StatusInternalServerError, "streaming unsupported")
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	fmt.Fprint(w, ": connected\n\n")
+	flusher.Flush()
+
+	ch := s.events.subscribe()
+	defer s.events.unsubscribe(ch)
+	ticker := time.NewTicker(serverEventKeepAlive)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case payload := <-ch:
+			if _, err := fmt.Fprintf(w, "data: %s\n\n", payload); err != nil {
+				return
+			}
+		case <-ticker.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+		}
+		flusher.Flush()
+	}
+}
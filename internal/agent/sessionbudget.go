@@ -0,0 +1,256 @@
+package agent
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"cando/internal/state"
+)
+
+// SessionBudgetError stops a turn before its next provider call once the
+// session reached its hard budget. The user has to confirm, with
+// /api/session/budget or :budget continue, before the session goes on.
+type SessionBudgetError struct {
+	Session string
+	Limits  state.Budget
+	Spent   state.UsageTotals
+	// BeforePrompt is set when the turn stopped before its prompt was
+	// added to the session, so it can be sent again after confirming.
+	BeforePrompt bool
+}
+
+func (e *SessionBudgetError) Error() string {
+	return fmt.Sprintf("session %s reached its hard budget (%s); confirm to continue", e.Session, describeBudgetUse(e.Limits, e.Spent, true))
+}
+
+// sessionBudget returns the limits that apply to conv: its own, else the
+// configured default.
+func (a *Agent) sessionBudget(conv *state.Conversation) state.Budget {
+	if limits := conv.Budget().Limits; limits != nil {
+		return *limits
+	}
+	return a.cfg.Load().SessionBudget
+}
+
+// checkSessionBudget returns a *SessionBudgetError when conv is at its
+// hard budget.
+func (a *Agent) checkSessionBudget(conv *state.Conversation, beforePrompt bool) error {
+	limits := a.sessionBudget(conv)
+	spent := conv.Budget().Spent(conv.Usage())
+	if !limits.HardReached(spent) {
+		return nil
+	}
+	return &SessionBudgetError{Session: conv.Key(), Limits: limits, Spent: spent, BeforePrompt: beforePrompt}
+}
+
+// warnSessionBudget reports the soft budget the first time a request takes
+// conv past it, as a budget_warning event or, without a callback, on the
+// terminal.
+func (a *Agent) warnSessionBudget(conv *state.Conversation, callback StreamCallback) {
+	budget := conv.Budget()
+	limits := a.sessionBudget(conv)
+	spent := budget.Spent(conv.Usage())
+	if budget.Warned || !limits.SoftReached(spent) {
+		return
+	}
+	conv.MarkBudgetWarned()
+	message := fmt.Sprintf("Session %s passed its soft budget (%s).", conv.Key(), describeBudgetUse(limits, spent, false))
+	a.logger.Printf("[agent] %s", message)
+	if callback == nil {
+		fmt.Println(message)
+		return
+	}
+	callback("budget_warning", map[string]any{
+		"session": conv.Key(),
+		"message": message,
+		"limits":  limits,
+		"spent":   spent,
+	})
+}
+
+// describeBudgetUse lists spent against the soft or hard limits that are set.
+func describeBudgetUse(limits state.Budget, spent state.UsageTotals, hard bool) string {
+	tokenLimit, usdLimit := limits.SoftTokens, limits.SoftUSD
+	if hard {
+		tokenLimit, usdLimit = limits.HardTokens, limits.HardUSD
+	}
+	var parts []string
+	if tokenLimit > 0 {
+		parts = append(parts, fmt.Sprintf("%d of %d tokens", spent.PromptTokens+spent.CompletionTokens, tokenLimit))
+	}
+	if usdLimit > 0 {
+		parts = append(parts, fmt.Sprintf("$%.4f of $%.2f", spent.CostUSD, usdLimit))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// sessionBudgetPayload describes a session's budget for the API.
+func (a *Agent) sessionBudgetPayload(conv *state.Conversation) map[string]any {
+	budget := conv.Budget()
+	return map[string]any{
+		"session":    conv.Key(),
+		"limits":     a.sessionBudget(conv),
+		"overridden": budget.Limits != nil,
+		"default":    a.cfg.Load().SessionBudget,
+		"spent":      budget.Spent(conv.Usage()),
+		"warned":     budget.Warned,
+	}
+}
+
+// handleSessionBudget shows a session's budget (GET) or changes it (POST):
+// "set" overrides the limits, "reset" restores the configured ones and
+// "continue" confirms going on past the hard limit with a fresh allowance.
+func (s *webServer) handleSessionBudget(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		s.respondError(w, r, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	workspace := s.getWorkspaceFromRequest(r)
+	if workspace == "" || !s.workspaceExists(workspace) {
+		s.respondError(w, r, http.StatusBadRequest, "select a workspace first")
+		return
+	}
+	wsCtx, err := s.agent.GetOrCreateWorkspaceContext(workspace)
+	if err != nil {
+		s.respondError(w, r, http.StatusInternalServerError, fmt.Sprintf("get workspace context: %v", err))
+		return
+	}
+	if r.Method == http.MethodGet {
+		conv, ok := s.sessionOrCurrent(wsCtx, strings.TrimSpace(r.URL.Query().Get("key")))
+		if !ok || conv == nil {
+			s.respondError(w, r, http.StatusNotFound, "unknown session")
+			return
+		}
+		s.writeJSON(w, r, s.agent.sessionBudgetPayload(conv))
+		return
+	}
+
+	var req struct {
+		Key    string        `json:"key,omitempty"`
+		Action string        `json:"action"`
+		Limits *state.Budget `json:"limits,omitempty"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.respondError(w, r, http.StatusBadRequest, "invalid payload")
+		return
+	}
+	if !s.claimWorkspace(w, r, workspace) {
+		return
+	}
+	conv, ok := s.sessionOrCurrent(wsCtx, strings.TrimSpace(req.Key))
+	if !ok || conv == nil {
+		s.respondError(w, r, http.StatusNotFound, "unknown session")
+		return
+	}
+	switch req.Action {
+	case "set":
+		if req.Limits == nil {
+			s.respondError(w, r, http.StatusBadRequest, "limits are required")
+			return
+		}
+		if err := req.Limits.Validate(); err != nil {
+			s.respondError(w, r, http.StatusBadRequest, err.Error())
+			return
+		}
+		conv.SetBudgetLimits(req.Limits)
+	case "reset":
+		conv.SetBudgetLimits(nil)
+	case "continue":
+		conv.ContinuePastBudget()
+	default:
+		s.respondError(w, r, http.StatusBadRequest, "action must be set, reset or continue")
+		return
+	}
+	if err := wsCtx.states.Save(conv); err != nil {
+		s.respondError(w, r, http.StatusInternalServerError, fmt.Sprintf("save session: %v", err))
+		return
+	}
+	s.logger.Printf("[ws:%s] session %s budget: %s", workspace, conv.Key(), req.Action)
+	s.writeJSON(w, r, s.agent.sessionBudgetPayload(conv))
+}
+
+// budgetExceededPayload is the budget_exceeded event ending a turn stopped
+// by err, or nil when err is not a budget stop.
+func budgetExceededPayload(err error) map[string]any {
+	var budgetErr *SessionBudgetError
+	if !errors.As(err, &budgetErr) {
+		return nil
+	}
+	return map[string]any{
+		"session":       budgetErr.Session,
+		"message":       budgetErr.Error(),
+		"limits":        budgetErr.Limits,
+		"spent":         budgetErr.Spent,
+		"before_prompt": budgetErr.BeforePrompt,
+	}
+}
+
+// budgetCommand implements :budget for the current session.
+func (a *Agent) budgetCommand(args []string) error {
+	conv := a.states.Current()
+	switch {
+	case len(args) == 0:
+	case len(args) == 1 && args[0] == "continue":
+		conv.ContinuePastBudget()
+	case len(args) == 1 && args[0] == "reset":
+		conv.SetBudgetLimits(nil)
+	default:
+		limits, err := parseBudgetArgs(a.sessionBudget(conv), args)
+		if err != nil {
+			return err
+		}
+		conv.SetBudgetLimits(&limits)
+	}
+	if len(args) > 0 {
+		if err := a.states.Save(conv); err != nil {
+			return fmt.Errorf("save session: %w", err)
+		}
+	}
+	limits := a.sessionBudget(conv)
+	spent := conv.Budget().Spent(conv.Usage())
+	if limits == (state.Budget{}) {
+		fmt.Printf("Session %s has no budget; used %s.\n", conv.Key(), formatUsageTotals(spent))
+		return nil
+	}
+	fmt.Printf("Session %s budget: soft %s, hard %s.\n", conv.Key(),
+		orUnlimited(describeBudgetUse(limits, spent, false)), orUnlimited(describeBudgetUse(limits, spent, true)))
+	return nil
+}
+
+// parseBudgetArgs applies limit=value arguments to limits.
+func parseBudgetArgs(limits state.Budget, args []string) (state.Budget, error) {
+	for _, arg := range args {
+		name, value, ok := strings.Cut(arg, "=")
+		if !ok {
+			return limits, fmt.Errorf("usage: :budget [continue|reset|soft_tokens=N hard_tokens=N soft_usd=X hard_usd=X]")
+		}
+		var err error
+		switch name {
+		case "soft_tokens":
+			limits.SoftTokens, err = strconv.Atoi(value)
+		case "hard_tokens":
+			limits.HardTokens, err = strconv.Atoi(value)
+		case "soft_usd":
+			limits.SoftUSD, err = strconv.ParseFloat(value, 64)
+		case "hard_usd":
+			limits.HardUSD, err = strconv.ParseFloat(value, 64)
+		default:
+			return limits, fmt.Errorf("unknown budget limit %q", name)
+		}
+		if err != nil {
+			return limits, fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	return limits, limits.Validate()
+}
+
+func orUnlimited(text string) string {
+	if text == "" {
+		return "unlimited"
+	}
+	return text
+}
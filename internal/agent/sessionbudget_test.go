@@ -0,0 +1,83 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"cando/internal/llm"
+	"cando/internal/state"
+)
+
+func TestSessionBudgetStopsAtHardLimit(t *testing.T) {
+	configDir := t.TempDir()
+	t.Setenv("CANDO_CONFIG_DIR", configDir)
+	cfg := baseTestConfig(t.TempDir())
+	cfg.SessionBudget = state.Budget{SoftTokens: 100, HardTokens: 150}
+	workspace := t.TempDir()
+	reply := func(prompt, completion int) llm.ChatResponse {
+		return llm.ChatResponse{
+			Choices: []llm.ChatChoice{{Message: state.Message{Role: "assistant", Content: "done"}, FinishReason: "stop"}},
+			Usage:   &llm.Usage{PromptTokens: prompt, CompletionTokens: completion, TotalTokens: prompt + completion},
+		}
+	}
+	client, err := NewMultiProviderClient("mock", []ProviderRegistration{
+		{Option: ProviderOption{Key: "mock", Label: "Mock", Model: cfg.Model}, Client: newScriptedClient(reply(80, 30), reply(40, 10), reply(5, 5))},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	agent := newTestAgent(t, client, cfg)
+	manager := &WorkspaceManager{filePath: filepath.Join(configDir, "workspaces.json")}
+	if _, err := manager.Add(workspace); err != nil {
+		t.Fatal(err)
+	}
+	s := &webServer{agent: agent, logger: log.New(io.Discard, "", 0), workspaceManager: manager}
+	wsCtx, err := agent.GetOrCreateWorkspaceContext(workspace)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var warnings int
+	callback := func(eventType string, data any) error {
+		if eventType == "budget_warning" {
+			warnings++
+		}
+		return nil
+	}
+
+	for _, prompt := range []string{"first", "second"} {
+		if _, _, err := agent.respondWithCallbacksForWorkspace(context.Background(), prompt, callback, wsCtx); err != nil {
+			t.Fatalf("%s turn: %v", prompt, err)
+		}
+	}
+	if warnings != 1 {
+		t.Errorf("budget warnings = %d, want 1", warnings)
+	}
+
+	// Past the hard limit the prompt is refused before it joins the session
+	conv := wsCtx.states.Current()
+	count := len(conv.Messages())
+	_, _, err = agent.respondWithCallbacksForWorkspace(context.Background(), "third", callback, wsCtx)
+	var budgetErr *SessionBudgetError
+	if !errors.As(err, &budgetErr) || !budgetErr.BeforePrompt || budgetErr.Spent.PromptTokens != 120 {
+		t.Fatalf("third turn error = %v", err)
+	}
+	if len(conv.Messages()) != count {
+		t.Error("refused prompt was added to the session")
+	}
+
+	rec := httptest.NewRecorder()
+	s.handleSessionBudget(rec, httptest.NewRequest(http.MethodPost, "/api/session/budget?workspace="+workspace, strings.NewReader(`{"action":"continue"}`)))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"spent":{"requests":0`) {
+		t.Fatalf("continue = %d: %s", rec.Code, rec.Body.String())
+	}
+	if _, _, err := agent.respondWithCallbacksForWorkspace(context.Background(), "third", callback, wsCtx); err != nil {
+		t.Fatalf("turn after confirming: %v", err)
+	}
+}
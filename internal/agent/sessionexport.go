@@ -0,0 +1,353 @@
+package agent
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"cando/internal/clock"
+	"cando/internal/config"
+	"cando/internal/projectlock"
+	"cando/internal/prompts"
+	"cando/internal/state"
+)
+
+const (
+	// sessionExportVersion is written to every JSON export; imports reject
+	// newer versions rather than guess at their meaning.
+	sessionExportVersion = 1
+
+	// maxSessionImportBytes bounds an uploaded session export.
+	maxSessionImportBytes = 32 << 20
+)
+
+// SessionExport is the portable form of a conversation. System messages are
+// left out: they belong to the workspace the session came from, and an
+// import gets the system prompt of its new workspace.
+type SessionExport struct {
+	Version    int             `json:"version"`
+	Key        string          `json:"key"`
+	Title      string          `json:"title,omitempty"`
+	Workspace  string          `json:"workspace,omitempty"` // Directory name only, not the full path
+	CreatedAt  time.Time       `json:"created_at"`
+	ExportedAt time.Time       `json:"exported_at"`
+	Messages   []state.Message `json:"messages"`
+}
+
+// newSessionExport captures conv for export from the workspace at root.
+func newSessionExport(conv *state.Conversation, root string) SessionExport {
+	exp := SessionExport{
+		Version:    sessionExportVersion,
+		Key:        conv.Key(),
+		Title:      conv.Title(),
+		Workspace:  filepath.Base(root),
+		CreatedAt:  conv.CreatedAt(),
+		ExportedAt: clock.Now(),
+		Messages:   []state.Message{},
+	}
+	for _, msg := range conv.Messages() {
+		if msg.Role != "system" {
+			exp.Messages = append(exp.Messages, msg)
+		}
+	}
+	return exp
+}
+
+// ParseSessionExport decodes and validates a JSON export. Broken tool call
+// pairings are repaired the same way stored conversations are on load.
+func ParseSessionExport(data []byte) (SessionExport, error) {
+	var exp SessionExport
+	if err := json.Unmarshal(data, &exp); err != nil {
+		return SessionExport{}, fmt.Errorf("invalid session export: %w", err)
+	}
+	if exp.Version < 1 || exp.Version > sessionExportVersion {
+		return SessionExport{}, fmt.Errorf("unsupported session export version %d", exp.Version)
+	}
+	messages := make([]state.Message, 0, len(exp.Messages))
+	for i, msg := range exp.Messages {
+		switch msg.Role {
+		case "system":
+			continue
+		case "user", "assistant", "tool":
+			messages = append(messages, msg)
+		default:
+			return SessionExport{}, fmt.Errorf("message %d has unknown role %q", i, msg.Role)
+		}
+	}
+	if len(messages) == 0 {
+		return SessionExport{}, errors.New("session export has no messages")
+	}
+	exp.Messages, _ = state.Lint(messages)
+	exp.Title = truncateTitle(strings.TrimSpace(exp.Title), maxSessionTitleRunes)
+	return exp, nil
+}
+
+// Markdown renders the export for reading and sharing. Thinking and tool
+// calls, together with their results, are collapsed into <details> blocks
+// so the conversation itself stays readable.
+func (exp SessionExport) Markdown() string {
+	results := make(map[string]state.Message)
+	for _, msg := range exp.Messages {
+		if msg.Role == "tool" && msg.ToolCallID != "" {
+			results[msg.ToolCallID] = msg
+		}
+	}
+
+	var b strings.Builder
+	heading := exp.Title
+	if heading == "" {
+		heading = exp.Key
+	}
+	fmt.Fprintf(&b, "# %s\n\n", heading)
+	source := ""
+	if exp.Workspace != "" {
+		source = " from " + exp.Workspace
+	}
+	fmt.Fprintf(&b, "_Exported%s on %s._\n", source, exp.ExportedAt.UTC().Format("2006-01-02 15:04 UTC"))
+
+	rendered := make(map[string]bool)
+	lastRole := ""
+	for _, msg := range exp.Messages {
+		switch msg.Role {
+		case "user", "assistant":
+			// A tool loop is one assistant reply, so it gets one heading
+			if msg.Role != lastRole {
+				if msg.Role == "user" {
+					b.WriteString("\n## User\n")
+				} else {
+					b.WriteString("\n## Assistant\n")
+				}
+				lastRole = msg.Role
+			}
+			if thinking := strings.TrimSpace(msg.Thinking); thinking != "" {
+				fmt.Fprintf(&b, "\n<details>\n<summary>Thinking</summary>\n\n%s\n\n</details>\n", thinking)
+			}
+			if content := strings.TrimSpace(msg.Content); content != "" {
+				fmt.Fprintf(&b, "\n%s\n", content)
+			}
+			for _, call := range msg.ToolCalls {
+				result, ok := results[call.ID]
+				writeToolCallMarkdown(&b, call, result, ok)
+				rendered[call.ID] = ok
+			}
+		case "tool":
+			if rendered[msg.ToolCallID] {
+				continue
+			}
+			fmt.Fprintf(&b, "\n<details>\n<summary>Tool result: %s</summary>\n\n%s</details>\n", msg.Name, markdownFence(msg.Content, ""))
+		}
+	}
+	return b.String()
+}
+
+// writeToolCallMarkdown writes one collapsed tool call with its result.
+func writeToolCallMarkdown(b *strings.Builder, call state.ToolCall, result state.Message, answered bool) {
+	fmt.Fprintf(b, "\n<details>\n<summary>Tool call: %s</summary>\n\n", call.Function.Name)
+	args := call.Function.Arguments
+	var indented bytes.Buffer
+	if json.Indent(&indented, []byte(args), "", "  ") == nil {
+		args = indented.String()
+	}
+	if strings.TrimSpace(args) != "" && strings.TrimSpace(args) != "{}" {
+		b.WriteString(markdownFence(args, "json"))
+		b.WriteString("\n")
+	}
+	if answered {
+		b.WriteString("Result:\n\n")
+		b.WriteString(markdownFence(result.Content, ""))
+	} else {
+		b.WriteString("_No result recorded._\n")
+	}
+	b.WriteString("\n</details>\n")
+}
+
+// markdownFence wraps text in a code fence longer than any backtick run it
+// contains.
+func markdownFence(text, lang string) string {
+	fence := "```"
+	for strings.Contains(text, fence) {
+		fence += "`"
+	}
+	return fence + lang + "\n" + strings.TrimRight(text, "\n") + "\n" + fence + "\n"
+}
+
+// importSession recreates exp as a new conversation in states and makes it
+// current. The key defaults to the exported one; either gets a numeric
+// suffix when already taken.
+func importSession(states *state.Manager, exp SessionExport, key string) (*state.Conversation, error) {
+	key = strings.TrimSpace(key)
+	if key == "" {
+		key = strings.TrimSpace(exp.Key)
+	}
+	if key == "" {
+		key = "imported"
+	}
+	unique := key
+	for i := 2; ; i++ {
+		if _, exists := states.Get(unique); !exists {
+			break
+		}
+		unique = fmt.Sprintf("%s-%d", key, i)
+	}
+	conv, err := states.NewState(unique)
+	if err != nil {
+		return nil, err
+	}
+	// Keep the system prompt the new conversation was created with
+	messages := conv.Messages()
+	conv.ReplaceMessages(append(messages, exp.Messages...))
+	conv.SetTitle(exp.Title)
+	if err := states.Save(conv); err != nil {
+		return nil, err
+	}
+	return conv, nil
+}
+
+// storedStates opens the conversations under a workspace's storage root
+// directly, for the CLI which runs without a server.
+func storedStates(storageRoot, systemPrompt string) (*state.Manager, error) {
+	return state.NewManager(systemPrompt, filepath.Join(storageRoot, "conversations"), nil)
+}
+
+// ExportWorkspaceSession reads a session of a workspace from disk. An empty
+// key exports the most recently updated session.
+func ExportWorkspaceSession(workspace, key string) (SessionExport, error) {
+	storageRoot, err := ProjectStorageRoot(workspace)
+	if err != nil {
+		return SessionExport{}, err
+	}
+	if _, err := os.Stat(filepath.Join(storageRoot, "conversations")); err != nil {
+		return SessionExport{}, fmt.Errorf("no sessions stored for %s", workspace)
+	}
+	// Conversations are saved on every append, so disk is authoritative
+	states, err := storedStates(storageRoot, "")
+	if err != nil {
+		return SessionExport{}, err
+	}
+	if key == "" {
+		summaries := states.Summaries() // Most recently updated first
+		if len(summaries) == 0 {
+			return SessionExport{}, fmt.Errorf("no sessions stored for %s", workspace)
+		}
+		key = summaries[0].Key
+	}
+	conv, ok := states.Get(key)
+	if !ok {
+		return SessionExport{}, fmt.Errorf("%w: %s", state.ErrUnknownState, key)
+	}
+	return newSessionExport(conv, workspace), nil
+}
+
+// ImportWorkspaceSession writes exp into a workspace's storage as a new
+// session and returns its key. It takes the project lock, so it fails while
+// a running Cando has the workspace open; import through its web UI then.
+func ImportWorkspaceSession(cfg config.Config, workspace string, exp SessionExport, key string) (string, error) {
+	storageRoot, err := ProjectStorageRoot(workspace)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(storageRoot, 0o755); err != nil {
+		return "", err
+	}
+	lock, err := projectlock.Acquire(storageRoot, false)
+	if err != nil {
+		var locked *projectlock.LockedError
+		if errors.As(err, &locked) {
+			return "", fmt.Errorf("%w; import through the web UI of that instance instead", err)
+		}
+		return "", err
+	}
+	defer lock.Release()
+	states, err := storedStates(storageRoot, prompts.Combine(strings.TrimSpace(cfg.SystemPrompt)))
+	if err != nil {
+		return "", err
+	}
+	conv, err := importSession(states, exp, key)
+	if err != nil {
+		return "", err
+	}
+	return conv.Key(), nil
+}
+
+// handleSessionExport downloads a session of the workspace, the current one
+// unless key is given, as Markdown (the default) or JSON.
+func (s *webServer) handleSessionExport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.respondError(w, r, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	workspace := s.getWorkspaceFromRequest(r)
+	if workspace == "" || !s.workspaceExists(workspace) {
+		s.respondError(w, r, http.StatusBadRequest, "select a workspace first")
+		return
+	}
+	wsCtx, err := s.agent.GetOrCreateWorkspaceContext(workspace)
+	if err != nil {
+		s.respondError(w, r, http.StatusInternalServerError, fmt.Sprintf("get workspace context: %v", err))
+		return
+	}
+	conv, ok := s.sessionOrCurrent(wsCtx, strings.TrimSpace(r.URL.Query().Get("key")))
+	if !ok || conv == nil {
+		s.respondError(w, r, http.StatusNotFound, "unknown session")
+		return
+	}
+	exp := newSessionExport(conv, wsCtx.root)
+	switch format := r.URL.Query().Get("format"); format {
+	case "", "markdown", "md":
+		w.Header().Set("Content-Type", "text/markdown; charset=utf-8")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", exp.Key+".md"))
+		io.WriteString(w, exp.Markdown())
+	case "json":
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", exp.Key+".json"))
+		s.writeJSON(w, r, exp)
+	default:
+		s.respondError(w, r, http.StatusBadRequest, fmt.Sprintf("unknown format %q", format))
+	}
+}
+
+// handleSessionImport recreates an uploaded JSON export as a new session of
+// the workspace and switches to it. The key query parameter overrides the
+// exported name.
+func (s *webServer) handleSessionImport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		s.respondError(w, r, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	workspace := s.getWorkspaceFromRequest(r)
+	if workspace == "" || !s.workspaceExists(workspace) {
+		s.respondError(w, r, http.StatusBadRequest, "select a workspace first")
+		return
+	}
+	wsCtx, err := s.agent.GetOrCreateWorkspaceContext(workspace)
+	if err != nil {
+		s.respondError(w, r, http.StatusInternalServerError, fmt.Sprintf("get workspace context: %v", err))
+		return
+	}
+	if !s.claimWorkspace(w, r, workspace) {
+		return
+	}
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxSessionImportBytes))
+	if err != nil {
+		s.respondError(w, r, http.StatusRequestEntityTooLarge, "session export too large")
+		return
+	}
+	exp, err := ParseSessionExport(data)
+	if err != nil {
+		s.respondError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	conv, err := importSession(wsCtx.states, exp, r.URL.Query().Get("key"))
+	if err != nil {
+		s.respondError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	s.logger.Printf("[ws:%s] imported session %q as %q (%d messages)", workspace, exp.Key, conv.Key(), len(exp.Messages))
+	s.writeSessionPayload(w, r)
+}
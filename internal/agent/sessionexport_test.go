@@ -0,0 +1,72 @@
+package agent
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"cando/internal/state"
+)
+
+func TestSessionExportRoundTrip(t *testing.T) {
+	source, err := state.NewManager("source prompt", t.TempDir(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conv, err := source.NewState("bug-report")
+	if err != nil {
+		t.Fatal(err)
+	}
+	conv.Append(state.Message{Role: "user", Content: "Why does the build fail?"})
+	conv.Append(state.Message{Role: "assistant", Thinking: "check the log", ToolCalls: []state.ToolCall{{
+		ID: "call-1", Type: "function",
+		Function: state.FunctionCall{Name: "read_file", Arguments: `{"path":"build.log"}`},
+	}}})
+	conv.Append(state.Message{Role: "tool", ToolCallID: "call-1", Name: "read_file", Content: "error: ```missing``` import"})
+	conv.Append(state.Message{Role: "assistant", Content: "An import is missing."})
+
+	exp := newSessionExport(conv, "/home/dev/project")
+	md := exp.Markdown()
+	for _, want := range []string{"# bug-report", "from project", "## User", "<summary>Thinking</summary>", "<summary>Tool call: read_file</summary>", "````\nerror: ```missing``` import\n````", "An import is missing."} {
+		if !strings.Contains(md, want) {
+			t.Errorf("markdown missing %q:\n%s", want, md)
+		}
+	}
+	if strings.Count(md, "## Assistant") != 1 || strings.Contains(md, "source prompt") || strings.Contains(md, "/home/dev") {
+		t.Errorf("markdown should have one assistant heading and no system prompt or path:\n%s", md)
+	}
+
+	data, err := json.Marshal(exp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := ParseSessionExport(data)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	target, err := state.NewManager("target prompt", t.TempDir(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := target.NewState("bug-report"); err != nil {
+		t.Fatal(err)
+	}
+	imported, err := importSession(target, parsed, "")
+	if err != nil {
+		t.Fatalf("import: %v", err)
+	}
+	if imported.Key() != "bug-report-2" || target.CurrentKey() != "bug-report-2" {
+		t.Fatalf("imported as %q (current %q), want bug-report-2", imported.Key(), target.CurrentKey())
+	}
+	messages := imported.Messages()
+	if len(messages) != 5 || messages[0].Content != "target prompt" || messages[3].ToolCallID != "call-1" {
+		t.Fatalf("imported messages = %+v", messages)
+	}
+
+	if _, err := ParseSessionExport([]byte(`{"version":2,"messages":[{"role":"user","content":"hi"}]}`)); err == nil {
+		t.Errorf("newer export version accepted")
+	}
+	if _, err := ParseSessionExport([]byte(`{"version":1,"messages":[{"role":"system","content":"x"}]}`)); err == nil {
+		t.Errorf("export without messages accepted")
+	}
+}
@@ -0,0 +1,162 @@
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// sessionLockTTL is how long a tab keeps control of a workspace without
+// heartbeats or requests before another tab may claim it.
+const sessionLockTTL = 45 * time.Second
+
+// sessionLock reports which browser tab controls a workspace's sessions.
+type sessionLock struct {
+	Holder     string    `json:"holder"`
+	Label      string    `json:"label,omitempty"` // User agent of the holder
+	AcquiredAt time.Time `json:"acquired_at"`
+	LastSeen   time.Time `json:"last_seen"`
+	Mine       bool      `json:"mine"` // Held by the requesting client
+}
+
+// sessionLocks serializes mutating requests from different tabs on the same
+// workspace. Clients identify themselves with X-Client-ID; requests without
+// one (curl, scripts) are not subject to locking.
+type sessionLocks struct {
+	mu    sync.Mutex
+	locks map[string]*sessionLock // workspace -> lock
+}
+
+func newSessionLocks() *sessionLocks {
+	return &sessionLocks{locks: make(map[string]*sessionLock)}
+}
+
+// claim gives client the workspace lock when it is free, expired, already
+// held by client, or takeover is set. Otherwise it returns the current lock
+// and false.
+func (l *sessionLocks) claim(workspace, client, label string, takeover bool, now time.Time) (sessionLock, bool) {
+	if client == "" {
+		return sessionLock{}, true
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	current := l.locks[workspace]
+	if current != nil && current.Holder != client && !takeover && now.Sub(current.LastSeen) < sessionLockTTL {
+		return *current, false
+	}
+	if current == nil || current.Holder != client {
+		current = &sessionLock{Holder: client, Label: label, AcquiredAt: now}
+		l.locks[workspace] = current
+	}
+	current.LastSeen = now
+	held := *current
+	held.Mine = true
+	return held, true
+}
+
+// touch extends client's lock; it does nothing for other clients.
+func (l *sessionLocks) touch(workspace, client string, now time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if current := l.locks[workspace]; current != nil && client != "" && current.Holder == client {
+		current.LastSeen = now
+	}
+}
+
+// release drops client's lock so other tabs can proceed immediately.
+func (l *sessionLocks) release(workspace, client string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if current := l.locks[workspace]; current != nil && current.Holder == client {
+		delete(l.locks, workspace)
+	}
+}
+
+// info returns the live lock on workspace as seen by client, or nil.
+func (l *sessionLocks) info(workspace, client string, now time.Time) *sessionLock {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	current := l.locks[workspace]
+	if current == nil || now.Sub(current.LastSeen) >= sessionLockTTL {
+		return nil
+	}
+	held := *current
+	held.Mine = client != "" && held.Holder == client
+	return &held
+}
+
+func requestClientID(r *http.Request) string {
+	return strings.TrimSpace(r.Header.Get("X-Client-ID"))
+}
+
+func clientLabel(r *http.Request) string {
+	label := r.UserAgent()
+	if len(label) > 80 {
+		label = label[:80]
+	}
+	return label
+}
+
+// claimWorkspace takes the workspace lock for a mutating request, replying
+// 423 Locked when another tab holds it. X-Lock-Takeover: 1 forces the claim.
+func (s *webServer) claimWorkspace(w http.ResponseWriter, r *http.Request, workspace string) bool {
+	if s.locks == nil {
+		return true
+	}
+	takeover := r.Header.Get("X-Lock-Takeover") == "1"
+	held, ok := s.locks.claim(workspace, requestClientID(r), clientLabel(r), takeover, time.Now())
+	if ok {
+		return true
+	}
+	idle := time.Since(held.LastSeen).Round(time.Second)
+	s.respondError(w, r, http.StatusLocked, fmt.Sprintf("this workspace is in use in another tab (active %s ago)", idle))
+	return false
+}
+
+// handleSessionLock reports the workspace lock (GET) or lets a tab
+// heartbeat, take over, or release it (POST {action}).
+func (s *webServer) handleSessionLock(w http.ResponseWriter, r *http.Request) {
+	workspace := s.getWorkspaceFromRequest(r)
+	if workspace == "" || !s.workspaceExists(workspace) {
+		s.respondError(w, r, http.StatusBadRequest, "select a workspace first")
+		return
+	}
+	client := requestClientID(r)
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		var req struct {
+			Action   string `json:"action"`
+			ClientID string `json:"client_id,omitempty"` // For sendBeacon, which cannot set headers
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			s.respondError(w, r, http.StatusBadRequest, "invalid payload")
+			return
+		}
+		if client == "" {
+			client = strings.TrimSpace(req.ClientID)
+		}
+		if client == "" {
+			s.respondError(w, r, http.StatusBadRequest, "client id is required")
+			return
+		}
+		switch req.Action {
+		case "heartbeat":
+			s.locks.touch(workspace, client, time.Now())
+		case "takeover":
+			s.locks.claim(workspace, client, clientLabel(r), true, time.Now())
+		case "release":
+			s.locks.release(workspace, client)
+		default:
+			s.respondError(w, r, http.StatusBadRequest, "action must be heartbeat, takeover, or release")
+			return
+		}
+	default:
+		s.respondError(w, r, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	s.writeJSON(w, r, map[string]any{"lock": s.locks.info(workspace, client, time.Now())})
+}
@@ -0,0 +1,30 @@
+package agent
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSessionLocksTakeover(t *testing.T) {
+	locks := newSessionLocks()
+	now := time.Now()
+	if _, ok := locks.claim("/ws", "tab-a", "", false, now); !ok {
+		t.Fatalf("free workspace not claimed")
+	}
+	held, ok := locks.claim("/ws", "tab-b", "", false, now.Add(time.Second))
+	if ok || held.Holder != "tab-a" {
+		t.Fatalf("second tab claimed a held workspace: %+v", held)
+	}
+	if _, ok := locks.claim("/ws", "", "", false, now); !ok {
+		t.Fatalf("clients without an id are not locked out")
+	}
+	if _, ok := locks.claim("/ws", "tab-b", "", true, now.Add(2*time.Second)); !ok {
+		t.Fatalf("takeover refused")
+	}
+	if info := locks.info("/ws", "tab-a", now.Add(2*time.Second)); info == nil || info.Mine || info.Holder != "tab-b" {
+		t.Fatalf("unexpected lock after takeover: %+v", info)
+	}
+	if _, ok := locks.claim("/ws", "tab-a", "", false, now.Add(2*time.Second+sessionLockTTL)); !ok {
+		t.Fatalf("expired lock not released")
+	}
+}
@@ -0,0 +1,130 @@
+package agent
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"cando/internal/llm"
+	"cando/internal/prompts"
+	"cando/internal/state"
+)
+
+const (
+	// maxSessionTitleRunes caps generated and user-set titles.
+	maxSessionTitleRunes = 80
+	// fallbackTitleRunes is how much of the first request names a session
+	// when the summary model gives no title.
+	fallbackTitleRunes = 48
+	// sessionTitleInputRunes is how much of the first request and reply the
+	// summary model sees.
+	sessionTitleInputRunes = 2000
+	// sessionTitleTimeout bounds the summary model call.
+	sessionTitleTimeout = 30 * time.Second
+)
+
+// titleSession names conv after its first reply if it has no title yet. It
+// runs in the background once a turn has finished, so it never delays the
+// reply, and falls back to the start of the first request when the summary
+// model fails or the session is at its hard budget.
+func (a *Agent) titleSession(states *state.Manager, conv *state.Conversation, workspaceRoot string) {
+	if !a.cfg.Load().IsSessionTitlesEnabled() || conv.Title() != "" {
+		return
+	}
+	request, reply := firstExchange(conv.Messages())
+	if request == "" || reply == "" {
+		return
+	}
+	var title string
+	if a.checkSessionBudget(conv, false) == nil {
+		title = a.generateSessionTitle(conv, request, reply)
+	}
+	if title == "" {
+		title = truncateTitle(strings.Join(strings.Fields(request), " "), fallbackTitleRunes)
+	}
+	if title == "" || conv.Title() != "" {
+		return // Renamed while the title was being generated
+	}
+	conv.SetTitle(title)
+	if err := states.Save(conv); err != nil {
+		a.logger.Printf("save title of session %s: %v", conv.Key(), err)
+		return
+	}
+	a.logger.Printf("titled session %s: %q", conv.Key(), title)
+	if a.onSessionTitled != nil {
+		a.onSessionTitled(workspaceRoot, conv.Key(), title)
+	}
+}
+
+// generateSessionTitle asks the summary model for a title, returning "" on
+// failure. The request counts toward conv's usage and budget like the
+// session's own.
+func (a *Agent) generateSessionTitle(conv *state.Conversation, request, reply string) string {
+	if a.client == nil {
+		return ""
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), sessionTitleTimeout)
+	defer cancel()
+	provider := a.ActiveProviderKey()
+	model := a.cfg.Load().SummaryModelFor(provider)
+	resp, err := a.client.Chat(ctx, llm.ChatRequest{
+		Model: model,
+		Messages: []state.Message{
+			{Role: "system", Content: prompts.SessionTitle()},
+			{Role: "user", Content: "Request:\n" + truncateTitle(request, sessionTitleInputRunes) + "\n\nReply:\n" + truncateTitle(reply, sessionTitleInputRunes)},
+		},
+		Temperature: 0.2,
+	})
+	if err == nil {
+		a.recordUsage(conv, provider, model, resp.Usage)
+		err = llm.ValidateResponse(provider, resp)
+	}
+	if err != nil {
+		a.logger.Printf("generate session title: %v", err)
+		return ""
+	}
+	return cleanSessionTitle(resp.Choices[0].Message.Content)
+}
+
+// firstExchange returns the first user request of a session and the first
+// assistant reply with text after it.
+func firstExchange(messages []state.Message) (request, reply string) {
+	for _, msg := range messages {
+		switch {
+		case msg.Role == "user" && request == "":
+			request = strings.TrimSpace(msg.Content)
+		case msg.Role == "assistant" && request != "" && strings.TrimSpace(msg.Content) != "":
+			return request, strings.TrimSpace(msg.Content)
+		}
+	}
+	return request, ""
+}
+
+// cleanSessionTitle reduces a model's answer to a bare title: its first
+// line without quotes, markup, a "Title:" label or a trailing period.
+func cleanSessionTitle(text string) string {
+	title := strings.TrimSpace(text)
+	if line, _, found := strings.Cut(title, "\n"); found {
+		title = strings.TrimSpace(line)
+	}
+	if label, rest, found := strings.Cut(title, ":"); found && strings.EqualFold(strings.TrimSpace(label), "title") {
+		title = rest
+	}
+	title = strings.Trim(title, " \t\"'`*#_“”")
+	title = strings.TrimSuffix(title, ".")
+	return truncateTitle(strings.Join(strings.Fields(title), " "), maxSessionTitleRunes)
+}
+
+// truncateTitle shortens text to at most limit runes, cutting at a word
+// boundary when one is near and marking the cut with an ellipsis.
+func truncateTitle(text string, limit int) string {
+	runes := []rune(text)
+	if len(runes) <= limit {
+		return text
+	}
+	cut := string(runes[:limit-1])
+	if i := strings.LastIndexByte(cut, ' '); i > len(cut)/2 {
+		cut = cut[:i]
+	}
+	return strings.TrimRight(cut, " ,;:-") + "…"
+}
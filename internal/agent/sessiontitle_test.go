@@ -0,0 +1,63 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"cando/internal/llm"
+	"cando/internal/state"
+)
+
+type failingClient struct{}
+
+func (failingClient) Chat(context.Context, llm.ChatRequest) (llm.ChatResponse, error) {
+	return llm.ChatResponse{}, errors.New("provider down")
+}
+
+func TestTitleSessionAfterFirstReply(t *testing.T) {
+	cfg := baseTestConfig(t.TempDir())
+	cfg.SessionTitles = nil
+	client := newScriptedClient(llm.ChatResponse{Choices: []llm.ChatChoice{{
+		Message:      state.Message{Role: "assistant", Content: "Title: \"Fix flaky login test.\"\nBecause the request is about a test"},
+		FinishReason: "stop",
+	}}, Usage: &llm.Usage{PromptTokens: 140, CompletionTokens: 9}})
+	a := newTestAgent(t, client, cfg)
+	var titled []string
+	a.onSessionTitled = func(workspace, key, title string) { titled = append(titled, key+"="+title) }
+
+	conv := a.states.Current()
+	conv.Append(state.Message{Role: "user", Content: "The login test fails every other run, can you look?"})
+	a.titleSession(a.states, conv, cfg.WorkspaceRoot)
+	if conv.Title() != "" || client.callCount != 0 {
+		t.Fatalf("titled before the first reply: %q", conv.Title())
+	}
+
+	conv.Append(state.Message{Role: "assistant", Content: "The test races the session cleanup."})
+	a.titleSession(a.states, conv, cfg.WorkspaceRoot)
+	if conv.Title() != "Fix flaky login test" {
+		t.Fatalf("title = %q", conv.Title())
+	}
+	if len(titled) != 1 || titled[0] != conv.Key()+"=Fix flaky login test" {
+		t.Fatalf("hook calls = %q", titled)
+	}
+	// The summary model's tokens count toward the session's budget
+	if usage := conv.Usage(); usage.Requests != 1 || usage.PromptTokens != 140 || usage.CompletionTokens != 9 {
+		t.Fatalf("usage = %+v, want the title request recorded", usage)
+	}
+
+	// A title, generated or set by the user, is never replaced
+	conv.SetTitle("Login flake")
+	a.titleSession(a.states, conv, cfg.WorkspaceRoot)
+	if conv.Title() != "Login flake" || client.callCount != 1 {
+		t.Fatalf("existing title replaced: %q after %d calls", conv.Title(), client.callCount)
+	}
+
+	// Without a summary model the first request names the session
+	a.client = failingClient{}
+	conv.SetTitle("")
+	a.titleSession(a.states, conv, cfg.WorkspaceRoot)
+	if want := "The login test fails every other run, can you…"; conv.Title() != want {
+		t.Fatalf("fallback title = %q, want %q", conv.Title(), want)
+	}
+}
@@ -0,0 +1,23 @@
+package agent
+
+import (
+	"cando/internal/state"
+	"cando/internal/tooling"
+)
+
+// lastStatusReport returns the status the agent reported in the latest
+// turn, or nil when that turn did not call report_status.
+func lastStatusReport(messages []state.Message) *tooling.StatusReport {
+	for i := len(messages) - 1; i >= 0; i-- {
+		msg := messages[i]
+		if msg.Role == "user" {
+			return nil
+		}
+		if msg.Role == "tool" && msg.Name == tooling.StatusReportToolName {
+			if report, ok := tooling.ParseStatusReport(msg.Content); ok {
+				return &report
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package agent
+
+import (
+	"time"
+
+	"cando/internal/llm"
+	"cando/internal/state"
+)
+
+// deltaFlushInterval is the shortest gap between assistant_delta events, so
+// a fast model does not send the UI an event per token.
+const deltaFlushInterval = 50 * time.Millisecond
+
+// deltaMode says which parts of a reply are forwarded while it streams.
+type deltaMode int
+
+const (
+	deltasOff     deltaMode = iota // Whole messages only
+	deltasContent                  // Content but not thinking
+	deltasAll                      // Content and thinking
+)
+
+// deltaModeFor picks what the UI may see of a reply before it is complete:
+// nothing while a content policy has to check the whole reply first, and no
+// thinking when the session hides it.
+func (a *Agent) deltaModeFor(conv *state.Conversation, callback StreamCallback) deltaMode {
+	switch {
+	case callback == nil || a.cfg.Load().ContentPolicy.Enabled:
+		return deltasOff
+	case !conv.ThinkingMode().Visible():
+		return deltasContent
+	default:
+		return deltasAll
+	}
+}
+
+// deltaBatcher collects streamed pieces of one provider attempt and emits
+// them as assistant_delta events at most every deltaFlushInterval.
+type deltaBatcher struct {
+	callback StreamCallback
+	mode     deltaMode
+	attempt  int
+	pending  llm.Delta
+	last     time.Time
+}
+
+// onDelta returns the function to stream the attempt with, or nil when
+// nothing is forwarded so the client makes a plain call.
+func (b *deltaBatcher) onDelta() func(llm.Delta) {
+	if b.callback == nil || b.mode == deltasOff {
+		return nil
+	}
+	return b.add
+}
+
+func (b *deltaBatcher) add(d llm.Delta) {
+	b.pending.Content += d.Content
+	if b.mode == deltasAll {
+		b.pending.Thinking += d.Thinking
+	}
+	if time.Since(b.last) >= deltaFlushInterval {
+		b.flush()
+	}
+}
+
+// flush emits what is pending. It is called once more when the attempt
+// ends so the tail is not lost.
+func (b *deltaBatcher) flush() {
+	if b.pending == (llm.Delta{}) {
+		return
+	}
+	b.callback("assistant_delta", map[string]any{
+		"content":  b.pending.Content,
+		"thinking": b.pending.Thinking,
+		"attempt":  b.attempt,
+	})
+	b.pending = llm.Delta{}
+	b.last = time.Now()
+}
@@ -0,0 +1,104 @@
+package agent
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"cando/internal/llm"
+)
+
+const sampleStream = `: keep-alive
+
+data: {"choices":[{"delta":{"role":"assistant","reasoning_content":"Look at "}}]}
+
+data: {"choices":[{"delta":{"reasoning_content":"the file."}}]}
+
+data: {"choices":[{"delta":{"content":"Reading "}}]}
+
+data: {"choices":[{"delta":{"content":"it now.","tool_calls":[{"index":0,"id":"call_1","type":"function","function":{"name":"read_file","arguments":"{\"path\":"}}]}}]}
+
+data: {"choices":[{"delta":{"tool_calls":[{"index":0,"function":{"arguments":"\"main.go\"}"}}]},"finish_reason":"tool_calls"}],"usage":{"prompt_tokens":10,"completion_tokens":5,"total_tokens":15}}
+
+data: [DONE]
+
+`
+
+// sseClient streams a canned server-sent event body.
+type sseClient struct {
+	body string
+}
+
+func (c sseClient) Chat(ctx context.Context, req llm.ChatRequest) (llm.ChatResponse, error) {
+	return c.ChatStream(ctx, req, nil)
+}
+
+func (c sseClient) ChatStream(_ context.Context, _ llm.ChatRequest, onDelta func(llm.Delta)) (llm.ChatResponse, error) {
+	return llm.ReadStream(strings.NewReader(c.body), "test", onDelta)
+}
+
+func TestReadStream(t *testing.T) {
+	var deltas []llm.Delta
+	resp, err := llm.ReadStream(strings.NewReader(sampleStream), "test", func(d llm.Delta) {
+		deltas = append(deltas, d)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deltas) != 4 {
+		t.Errorf("deltas = %+v", deltas)
+	}
+	msg := resp.Choices[0].Message
+	if msg.Content != "Reading it now." || msg.Thinking != "Look at the file." {
+		t.Errorf("message = %+v", msg)
+	}
+	if len(msg.ToolCalls) != 1 || msg.ToolCalls[0].ID != "call_1" || msg.ToolCalls[0].Function.Arguments != `{"path":"main.go"}` {
+		t.Errorf("tool calls = %+v", msg.ToolCalls)
+	}
+	if resp.Choices[0].FinishReason != "tool_calls" || resp.Usage == nil || resp.Usage.TotalTokens != 15 {
+		t.Errorf("finish = %q, usage = %+v", resp.Choices[0].FinishReason, resp.Usage)
+	}
+
+	// A stream cut off mid-reply is retried rather than taken as the answer
+	truncated := sampleStream[:strings.Index(sampleStream, `data: {"choices":[{"delta":{"tool_calls"`)]
+	if _, err := llm.ReadStream(strings.NewReader(truncated), "test", nil); err == nil {
+		t.Error("expected a truncated stream to fail")
+	} else if pe, ok := llm.IsProviderError(err); !ok || !pe.Retryable {
+		t.Errorf("truncated stream error = %v", err)
+	}
+	if _, err := llm.ReadStream(strings.NewReader(`data: {"error":{"code":502,"message":"upstream gone"}}`+"\n\n"), "test", nil); err == nil || !strings.Contains(err.Error(), "upstream gone") {
+		t.Errorf("error event = %v", err)
+	}
+}
+
+func TestProviderCallStreamsDeltas(t *testing.T) {
+	agent := newTestAgent(t, sseClient{body: sampleStream}, baseTestConfig(t.TempDir()))
+	for _, tc := range []struct {
+		mode                   deltaMode
+		wantContent, wantThink string
+	}{
+		{deltasAll, "Reading it now.", "Look at the file."},
+		{deltasContent, "Reading it now.", ""},
+		{deltasOff, "", ""},
+	} {
+		var content, thinking strings.Builder
+		callback := func(event string, data any) error {
+			if event == "assistant_delta" {
+				payload := data.(map[string]any)
+				content.WriteString(payload["content"].(string))
+				thinking.WriteString(payload["thinking"].(string))
+			}
+			return nil
+		}
+		resp, err := agent.callProviderWithRetry(context.Background(), llm.ChatRequest{}, callback, tc.mode)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if content.String() != tc.wantContent || thinking.String() != tc.wantThink {
+			t.Errorf("mode %d streamed %q / %q", tc.mode, content.String(), thinking.String())
+		}
+		if resp.Choices[0].Message.Content != "Reading it now." {
+			t.Errorf("mode %d response = %+v", tc.mode, resp.Choices[0].Message)
+		}
+	}
+}
@@ -0,0 +1,267 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// streamReconnectGrace is how long a turn keeps running after its client
+	// disconnects, waiting for a reconnect, before it is cancelled.
+	streamReconnectGrace = 2 * time.Minute
+	// streamRetention keeps finished turns' events for late reconnects.
+	streamRetention = 10 * time.Minute
+)
+
+// bufferedEvent is one SSE event recorded for replay.
+type bufferedEvent struct {
+	seq     int
+	payload []byte // JSON envelope as sent on the wire
+}
+
+// turnStream records a turn's events so reconnecting clients can replay
+// what they missed and follow the rest live.
+type turnStream struct {
+	id        string
+	workspace string
+
+	mu          sync.Mutex
+	events      []bufferedEvent
+	done        bool
+	finishedAt  time.Time
+	subscribers int
+	notify      chan struct{} // Closed and replaced on every change
+	finished    chan struct{} // Closed when the turn ends
+}
+
+// append records an event and returns its sequence number (from 1).
+func (t *turnStream) append(payload []byte) int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	seq := len(t.events) + 1
+	t.events = append(t.events, bufferedEvent{seq: seq, payload: payload})
+	t.broadcast()
+	return seq
+}
+
+func (t *turnStream) finish() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.done {
+		return
+	}
+	t.done = true
+	t.finishedAt = time.Now()
+	close(t.finished)
+	t.broadcast()
+}
+
+func (t *turnStream) broadcast() {
+	close(t.notify)
+	t.notify = make(chan struct{})
+}
+
+// since returns events after seq, whether the turn has finished, and a
+// channel closed on the next change.
+func (t *turnStream) since(seq int) ([]bufferedEvent, bool, <-chan struct{}) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var events []bufferedEvent
+	if seq < len(t.events) {
+		events = append(events, t.events[max(seq, 0):]...)
+	}
+	return events, t.done, t.notify
+}
+
+func (t *turnStream) isDone() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.done
+}
+
+// lastSeq returns the sequence number of the latest event.
+func (t *turnStream) lastSeq() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return len(t.events)
+}
+
+func (t *turnStream) subscribe(delta int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.subscribers += delta
+}
+
+func (t *turnStream) hasSubscribers() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.subscribers > 0
+}
+
+// turnStreams indexes recent turn streams by turn ID.
+type turnStreams struct {
+	mu    sync.Mutex
+	turns map[string]*turnStream
+}
+
+func newTurnStreams() *turnStreams {
+	return &turnStreams{turns: make(map[string]*turnStream)}
+}
+
+// start registers a stream for a new turn, dropping expired ones.
+func (h *turnStreams) start(id, workspace string) *turnStream {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for key, ts := range h.turns {
+		ts.mu.Lock()
+		expired := ts.done && time.Since(ts.finishedAt) > streamRetention
+		ts.mu.Unlock()
+		if expired {
+			delete(h.turns, key)
+		}
+	}
+	ts := &turnStream{id: id, workspace: workspace, notify: make(chan struct{}), finished: make(chan struct{})}
+	h.turns[id] = ts
+	return ts
+}
+
+func (h *turnStreams) get(id string) (*turnStream, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	ts, ok := h.turns[id]
+	return ts, ok
+}
+
+// active returns the unfinished turn for a workspace, if any.
+func (h *turnStreams) active(workspace string) *turnStream {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, ts := range h.turns {
+		ts.mu.Lock()
+		running := !ts.done && ts.workspace == workspace
+		ts.mu.Unlock()
+		if running {
+			return ts
+		}
+	}
+	return nil
+}
+
+// keepAlive cancels the turn when its original client has gone and nobody
+// reconnects within the grace period.
+func (t *turnStream) keepAlive(clientCtx context.Context, cancel context.CancelFunc) {
+	select {
+	case <-clientCtx.Done():
+	case <-t.finished:
+		return
+	}
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	lastSeen := time.Now()
+	for {
+		select {
+		case <-t.finished:
+			return
+		case now := <-ticker.C:
+			if t.hasSubscribers() {
+				lastSeen = now
+			} else if now.Sub(lastSeen) > streamReconnectGrace {
+				cancel()
+				return
+			}
+		}
+	}
+}
+
+// recordEvent buffers one event of the turn in ts and returns its sequence
+// number and wire payload.
+func (s *webServer) recordEvent(r *http.Request, ts *turnStream, eventType string, data any) (int, []byte, error) {
+	payload, err := json.Marshal(map[string]any{
+		"type":    eventType,
+		"data":    data,
+		"turn_id": ts.id,
+	})
+	if err != nil {
+		s.logRequestError(r, http.StatusInternalServerError, fmt.Sprintf("stream marshal %s event failed: %v", eventType, err))
+		return 0, nil, err
+	}
+	return ts.append(payload), payload, nil
+}
+
+// activeTurn tells a reloaded page which turn to reattach to.
+type activeTurn struct {
+	TurnID      string `json:"turn_id"`
+	LastEventID int    `json:"last_event_id"` // Events buffered so far
+}
+
+// parseLastEventID splits an SSE event ID of the form "<turn>:<seq>".
+func parseLastEventID(value string) (string, int, bool) {
+	idx := strings.LastIndex(value, ":")
+	if idx <= 0 {
+		return "", 0, false
+	}
+	seq, err := strconv.Atoi(value[idx+1:])
+	if err != nil || seq < 0 {
+		return "", 0, false
+	}
+	return value[:idx], seq, true
+}
+
+// handleStreamResume replays a turn's events after the client's last seen
+// event and then follows it live. The position comes from the Last-Event-ID
+// header or the turn_id and last_event_id query parameters.
+func (s *webServer) handleStreamResume(w http.ResponseWriter, r *http.Request) {
+	turnID, seq, ok := parseLastEventID(r.Header.Get("Last-Event-ID"))
+	if !ok {
+		turnID = r.URL.Query().Get("turn_id")
+		seq, _ = strconv.Atoi(r.URL.Query().Get("last_event_id"))
+	}
+	if turnID == "" {
+		s.respondError(w, r, http.StatusBadRequest, "turn_id or Last-Event-ID is required")
+		return
+	}
+	ts, found := s.streams.get(turnID)
+	if !found {
+		s.respondError(w, r, http.StatusNotFound, "turn not found or expired")
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		s.respondError(w, r, http.StatusInternalServerError, "streaming not supported")
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+
+	ts.subscribe(1)
+	defer ts.subscribe(-1)
+	for {
+		events, done, wait := ts.since(seq)
+		for _, event := range events {
+			if _, err := fmt.Fprintf(w, "id: %s:%d\ndata: %s\n\n", ts.id, event.seq, event.payload); err != nil {
+				return
+			}
+			seq = event.seq
+		}
+		flusher.Flush()
+		if done && len(events) == 0 {
+			return
+		}
+		if len(events) > 0 {
+			continue
+		}
+		select {
+		case <-r.Context().Done():
+			return
+		case <-wait:
+		}
+	}
+}
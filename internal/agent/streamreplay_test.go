@@ -0,0 +1,36 @@
+package agent
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestStreamResumeReplaysMissedEvents(t *testing.T) {
+	s := &webServer{streams: newTurnStreams()}
+	stream := s.streams.start("turn-1", "/ws")
+	for _, payload := range []string{`{"type":"turn_started"}`, `{"type":"tool_call_started"}`, `{"type":"complete"}`} {
+		stream.append([]byte(payload))
+	}
+	if active := s.streams.active("/ws"); active != stream {
+		t.Fatalf("running turn not reported as active")
+	}
+	stream.finish()
+
+	req := httptest.NewRequest(http.MethodGet, "/api/stream", nil)
+	req.Header.Set("Last-Event-ID", "turn-1:1")
+	rec := httptest.NewRecorder()
+	s.handleStream(rec, req)
+
+	body := rec.Body.String()
+	if strings.Contains(body, "turn_started") {
+		t.Fatalf("replayed an event the client already had: %s", body)
+	}
+	if !strings.Contains(body, "id: turn-1:2\ndata: {\"type\":\"tool_call_started\"}") || !strings.Contains(body, "id: turn-1:3") {
+		t.Fatalf("missed events not replayed: %s", body)
+	}
+	if s.streams.active("/ws") != nil {
+		t.Fatalf("finished turn still reported as active")
+	}
+}
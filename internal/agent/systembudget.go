@@ -0,0 +1,100 @@
+package agent
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	// systemCharsPerToken matches the conservative 3:1 estimate used for
+	// compaction thresholds.
+	systemCharsPerToken = 3
+	// minSystemSectionChars is the smallest useful slice of a section; with
+	// less room left it is dropped instead of truncated.
+	minSystemSectionChars = 200
+	// systemNoticeChars is the room left for a truncation notice.
+	systemNoticeChars = 120
+)
+
+// systemContext is the project context added to the system message each
+// turn. Pinned files and the plan mode hint are not part of it: the user
+// asked for those explicitly.
+type systemContext struct {
+	instructions string
+	facts        []string
+	profile      string
+	bugHunt      string
+	recentFiles  string
+	repoMap      string
+}
+
+// fit trims the context to budget tokens and returns a note per section it
+// trimmed. Sections are kept in priority order: the user's instructions
+// first, then learned facts, the project profile, bug hunt history, recent
+// files and the repository map, which the model can fetch with repo_map.
+// A truncated section ends with a notice so the model knows text is missing.
+// A budget of 0 keeps everything.
+func (c *systemContext) fit(budget int) []string {
+	if budget <= 0 {
+		return nil
+	}
+	remaining := budget * systemCharsPerToken
+	var notes []string
+
+	take := func(name string, text *string) {
+		size := len(*text)
+		if size <= remaining {
+			remaining -= size
+			return
+		}
+		if remaining < minSystemSectionChars {
+			*text = ""
+			notes = append(notes, fmt.Sprintf("%s left out (%d chars)", name, size))
+			return
+		}
+		kept := truncateSection(*text, remaining-systemNoticeChars)
+		*text = kept + fmt.Sprintf("\n[%s truncated to fit the system prompt budget: %d of %d characters shown]", name, len(kept), size)
+		remaining = 0
+		notes = append(notes, fmt.Sprintf("%s truncated to %d of %d chars", name, len(kept), size))
+	}
+
+	take("Project instructions", &c.instructions)
+
+	for i, fact := range c.facts {
+		size := len(fact) + 3 // "- " and newline
+		if size > remaining {
+			omitted := len(c.facts) - i
+			c.facts = append(c.facts[:i:i], fmt.Sprintf("(%d more facts omitted to fit the system prompt budget)", omitted))
+			remaining = 0
+			notes = append(notes, fmt.Sprintf("%d of %d project facts left out", omitted, omitted+i))
+			break
+		}
+		remaining -= size
+	}
+
+	take("Project profile", &c.profile)
+	take("Bug hunt history", &c.bugHunt)
+	take("Recent files", &c.recentFiles)
+	take("Repository map", &c.repoMap)
+	return notes
+}
+
+// truncateSection cuts text to at most limit bytes, at a line break when one
+// is in the second half, and never inside a UTF-8 sequence.
+func truncateSection(text string, limit int) string {
+	if limit <= 0 {
+		return ""
+	}
+	if len(text) <= limit {
+		return text
+	}
+	for limit > 0 && !utf8.RuneStart(text[limit]) {
+		limit--
+	}
+	kept := text[:limit]
+	if i := strings.LastIndexByte(kept, '\n'); i > limit/2 {
+		kept = kept[:i]
+	}
+	return kept
+}
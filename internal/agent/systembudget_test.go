@@ -0,0 +1,45 @@
+package agent
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSystemContextFit(t *testing.T) {
+	base := systemContext{
+		instructions: "Use tabs.\n" + strings.Repeat("Rule line.\n", 100), // 1110 chars
+		facts:        []string{"tests use go test", "module is cando"},
+		profile:      "Go module",
+		repoMap:      strings.Repeat("m", 500),
+	}
+	unlimited := base
+	if notes := unlimited.fit(0); notes != nil || unlimited.instructions != base.instructions {
+		t.Fatalf("budget 0 trimmed: %q", notes)
+	}
+
+	// 400 tokens is 1200 chars: instructions and facts fit, the profile
+	// fits, and only part of the repository map remains
+	roomy := base
+	notes := roomy.fit(400)
+	if roomy.instructions != base.instructions || len(roomy.facts) != 2 || roomy.profile != "Go module" {
+		t.Errorf("higher priority sections trimmed: %+v", roomy)
+	}
+	if roomy.repoMap != "" || len(notes) != 1 || !strings.Contains(notes[0], "Repository map left out") {
+		t.Errorf("repo map %d chars, notes %q", len(roomy.repoMap), notes)
+	}
+
+	// 200 tokens is 600 chars: the instructions are cut at a line with a
+	// notice and everything after them is dropped
+	tight := base
+	notes = tight.fit(200)
+	if len(tight.instructions) > 600 || !strings.HasPrefix(tight.instructions, "Use tabs.\nRule line.\n") ||
+		!strings.HasSuffix(tight.instructions, "characters shown]") || !strings.Contains(tight.instructions, "Rule line.\n[") {
+		t.Errorf("instructions = %q", tight.instructions)
+	}
+	if len(tight.facts) != 1 || tight.facts[0] != "(2 more facts omitted to fit the system prompt budget)" || tight.profile != "" || tight.repoMap != "" {
+		t.Errorf("after instructions: %+v", tight)
+	}
+	if len(notes) != 4 {
+		t.Errorf("notes = %q", notes)
+	}
+}
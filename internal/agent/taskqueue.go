@@ -0,0 +1,580 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"cando/internal/safefile"
+	"cando/internal/tooling"
+)
+
+const (
+	taskQueueFile = "tasks.json"
+	// taskVerifyTimeout bounds one run of a task's verify command.
+	taskVerifyTimeout = 10 * time.Minute
+	// taskOutputChars is how much verify output is kept, from the end.
+	taskOutputChars = 4000
+	// taskBusyRetry is how long the queue waits before trying again when
+	// another turn is running in the workspace.
+	taskBusyRetry = 10 * time.Second
+	// Attempts per task: the first run plus automatic fix-up turns after a
+	// failed verification.
+	taskDefaultAttempts = 2
+	taskMaxAttempts     = 5
+)
+
+// Task states.
+const (
+	taskPending = "pending"
+	taskRunning = "running"
+	taskDone    = "done"
+	taskSkipped = "skipped" // Counts as done for dependents
+	taskFailed  = "failed"
+	taskBlocked = "blocked" // A dependency failed or was blocked
+)
+
+// Where a task's turns run.
+const (
+	taskModeSession = "session" // A session of its own, named after the task
+	taskModeTurn    = "turn"    // The workspace's current session
+)
+
+// queueTask is one entry of a workspace's task queue.
+type queueTask struct {
+	ID          string    `json:"id"`
+	Title       string    `json:"title"`
+	Prompt      string    `json:"prompt"`
+	DependsOn   []string  `json:"depends_on,omitempty"`
+	Verify      string    `json:"verify,omitempty"` // Shell command run after each turn; exit status 0 completes the task
+	Mode        string    `json:"mode"`
+	MaxAttempts int       `json:"max_attempts"`
+	Status      string    `json:"status"`
+	Attempts    int       `json:"attempts"`
+	Session     string    `json:"session,omitempty"` // Session of the last attempt
+	TurnID      string    `json:"turn_id,omitempty"` // Turn of the last attempt
+	Error       string    `json:"error,omitempty"`
+	Output      string    `json:"output,omitempty"` // Tail of the last verify run
+	StartedAt   time.Time `json:"started_at,omitzero"`
+	FinishedAt  time.Time `json:"finished_at,omitzero"`
+}
+
+// taskQueue is a workspace's queue, kept in tasks.json in its storage root.
+// Dependencies always name earlier tasks, so the list is in an order the
+// tasks can run in.
+type taskQueue struct {
+	Paused bool        `json:"paused"`
+	NextID int         `json:"next_id"`
+	Tasks  []queueTask `json:"tasks"`
+}
+
+func (q *taskQueue) find(id string) int {
+	return slices.IndexFunc(q.Tasks, func(t queueTask) bool { return t.ID == id })
+}
+
+// next blocks pending tasks whose dependencies failed and returns the index
+// of the first pending task whose dependencies are all done, or -1.
+func (q *taskQueue) next() int {
+	status := make(map[string]string, len(q.Tasks))
+	found := -1
+	for i := range q.Tasks {
+		task := &q.Tasks[i]
+		if task.Status == taskPending {
+			ready := true
+			for _, dep := range task.DependsOn {
+				switch status[dep] {
+				case taskDone, taskSkipped:
+				case taskFailed, taskBlocked:
+					task.Status, task.Error = taskBlocked, fmt.Sprintf("dependency %s did not complete", dep)
+					ready = false
+				default:
+					ready = false
+				}
+			}
+			if ready && task.Status == taskPending && found < 0 {
+				found = i
+			}
+		}
+		status[task.ID] = task.Status
+	}
+	return found
+}
+
+// add appends a task, checking that its dependencies exist.
+func (q *taskQueue) add(task queueTask) (queueTask, error) {
+	task.Title = strings.TrimSpace(task.Title)
+	task.Prompt = strings.TrimSpace(task.Prompt)
+	task.Verify = strings.TrimSpace(task.Verify)
+	if task.Prompt == "" {
+		return task, errors.New("prompt is required")
+	}
+	if task.Title == "" {
+		task.Title = truncatePrompt(task.Prompt)
+	}
+	switch task.Mode {
+	case "":
+		task.Mode = taskModeSession
+	case taskModeSession, taskModeTurn:
+	default:
+		return task, fmt.Errorf("mode must be %q or %q", taskModeSession, taskModeTurn)
+	}
+	if task.MaxAttempts <= 0 {
+		task.MaxAttempts = taskDefaultAttempts
+	}
+	task.MaxAttempts = min(task.MaxAttempts, taskMaxAttempts)
+	for _, dep := range task.DependsOn {
+		if q.find(dep) < 0 {
+			return task, fmt.Errorf("unknown dependency %s", dep)
+		}
+	}
+	q.NextID++
+	task.ID = fmt.Sprintf("task-%d", q.NextID)
+	task.Status = taskPending
+	q.Tasks = append(q.Tasks, task)
+	return task, nil
+}
+
+func taskQueuePath(workspaceRoot string) (string, error) {
+	storageRoot, err := ProjectStorageRoot(workspaceRoot)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(storageRoot, taskQueueFile), nil
+}
+
+func loadTaskQueue(workspaceRoot string) (taskQueue, error) {
+	path, err := taskQueuePath(workspaceRoot)
+	if err != nil {
+		return taskQueue{}, err
+	}
+	data, _, err := safefile.Read(path, safefile.ValidJSON)
+	if os.IsNotExist(err) {
+		return taskQueue{}, nil
+	}
+	if err != nil {
+		return taskQueue{}, err
+	}
+	var queue taskQueue
+	if err := json.Unmarshal(data, &queue); err != nil {
+		return taskQueue{}, err
+	}
+	return queue, nil
+}
+
+func saveTaskQueue(workspaceRoot string, queue taskQueue) error {
+	path, err := taskQueuePath(workspaceRoot)
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(queue, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	return safefile.Write(path, data, 0o644)
+}
+
+// taskRunner runs the task queues of the server's workspaces, one task at a
+// time per workspace.
+type taskRunner struct {
+	mu      sync.Mutex        // Guards running, holds and every queue file
+	running map[string]string // Workspace root -> ID of the task being run
+	holds   map[string]func() // Workspace root -> release of the context pinned while its task runs
+}
+
+func newTaskRunner() *taskRunner {
+	return &taskRunner{running: make(map[string]string), holds: make(map[string]func())}
+}
+
+// updateLocked loads a workspace's queue, applies change and saves it.
+// Tasks left running by an earlier process fail as interrupted and pause
+// the queue, so nothing restarts on its own after a crash. The caller holds
+// t.mu.
+func (t *taskRunner) updateLocked(workspaceRoot string, change func(*taskQueue) error) (taskQueue, error) {
+	queue, err := loadTaskQueue(workspaceRoot)
+	if err != nil {
+		return queue, err
+	}
+	for i := range queue.Tasks {
+		task := &queue.Tasks[i]
+		if task.Status == taskRunning && t.running[workspaceRoot] != task.ID {
+			task.Status, task.Error, task.FinishedAt = taskFailed, "interrupted: the server stopped while the task ran", time.Now()
+			queue.Paused = true
+		}
+	}
+	if change != nil {
+		if err := change(&queue); err != nil {
+			return queue, err
+		}
+	}
+	return queue, saveTaskQueue(workspaceRoot, queue)
+}
+
+func (t *taskRunner) update(workspaceRoot string, change func(*taskQueue) error) (taskQueue, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.updateLocked(workspaceRoot, change)
+}
+
+// advanceQueue starts the next runnable task of a workspace unless the
+// queue is paused or a task or another turn is running there.
+func (s *webServer) advanceQueue(wsCtx *WorkspaceContext) {
+	root := wsCtx.root
+	s.tasks.mu.Lock()
+	if s.tasks.running[root] != "" {
+		s.tasks.mu.Unlock()
+		return
+	}
+	busy := s.streams.active(root) != nil || wsCtx.HasInFlightRequest()
+	var task *queueTask
+	waiting := false
+	_, err := s.tasks.updateLocked(root, func(q *taskQueue) error {
+		idx := q.next()
+		if q.Paused || idx < 0 {
+			return nil
+		}
+		if busy {
+			waiting = true
+			return nil
+		}
+		next := &q.Tasks[idx]
+		next.Status, next.Error, next.Output = taskRunning, "", ""
+		next.Attempts++
+		next.StartedAt, next.FinishedAt = time.Now(), time.Time{}
+		copied := *next
+		task = &copied
+		return nil
+	})
+	if task != nil {
+		s.tasks.running[root] = task.ID
+		s.tasks.holds[root] = wsCtx.hold() // Also between the turns of a task
+	}
+	s.tasks.mu.Unlock()
+	if err != nil {
+		s.logger.Printf("[tasks] %s: %v", root, err)
+		return
+	}
+	if task == nil {
+		if waiting {
+			release := wsCtx.hold()
+			time.AfterFunc(taskBusyRetry, func() {
+				release()
+				s.advanceQueue(wsCtx)
+			})
+		}
+		return
+	}
+	s.events.publish("tasks_changed", map[string]string{"workspace": root, "task": task.ID, "status": taskRunning})
+	s.runTask(wsCtx, *task, task.Prompt)
+}
+
+// runTask runs one attempt of a task as a detached turn.
+func (s *webServer) runTask(wsCtx *WorkspaceContext, task queueTask, prompt string) {
+	session := wsCtx.states.CurrentKey()
+	if task.Mode == taskModeSession {
+		conv, err := wsCtx.states.EnsureState(task.ID)
+		if err != nil {
+			s.finishTask(wsCtx, task.ID, "", err)
+			return
+		}
+		session = conv.Key()
+	}
+	req, _ := http.NewRequestWithContext(context.Background(), http.MethodPost, "/api/tasks", nil)
+	req.Header.Set("X-Workspace", wsCtx.root)
+	turnID, err := s.runDetachedTurn(req, wsCtx, prompt, session, func(turnID string, turnErr error) {
+		s.finishTask(wsCtx, task.ID, turnID, turnErr)
+	})
+	if err != nil {
+		s.finishTask(wsCtx, task.ID, "", err)
+		return
+	}
+	s.tasks.update(wsCtx.root, func(q *taskQueue) error {
+		if i := q.find(task.ID); i >= 0 {
+			q.Tasks[i].Session, q.Tasks[i].TurnID = session, turnID
+		}
+		return nil
+	})
+}
+
+// finishTask verifies a finished attempt and records the outcome. A failed
+// verification with attempts left starts a fix-up turn in the same session;
+// otherwise the queue moves on.
+func (s *webServer) finishTask(wsCtx *WorkspaceContext, id, turnID string, turnErr error) {
+	root := wsCtx.root
+	queue, _ := loadTaskQueue(root)
+	var task queueTask
+	if i := queue.find(id); i >= 0 {
+		task = queue.Tasks[i]
+	}
+
+	passed, output := turnErr == nil, ""
+	if passed && task.Verify != "" {
+		passed, output = s.runTaskVerification(root, task.Verify)
+	}
+	retry := !passed && turnErr == nil && task.Attempts < task.MaxAttempts
+
+	var finished queueTask
+	s.tasks.mu.Lock()
+	_, err := s.tasks.updateLocked(root, func(q *taskQueue) error {
+		i := q.find(id)
+		if i < 0 {
+			return nil // Removed while running
+		}
+		t := &q.Tasks[i]
+		if turnID != "" {
+			t.TurnID = turnID
+		}
+		t.Output = output
+		switch {
+		case passed:
+			t.Status, t.Error = taskDone, ""
+		case retry:
+			t.Attempts++
+			t.Error = "verification failed; retrying"
+		case turnErr != nil:
+			t.Status, t.Error = taskFailed, turnErr.Error()
+		default:
+			t.Status, t.Error = taskFailed, fmt.Sprintf("verification failed after %d attempts", t.Attempts)
+		}
+		if !retry {
+			t.FinishedAt = time.Now()
+		}
+		finished = *t
+		return nil
+	})
+	if !retry || finished.ID == "" {
+		delete(s.tasks.running, root)
+		if release := s.tasks.holds[root]; release != nil {
+			release()
+			delete(s.tasks.holds, root)
+		}
+	}
+	s.tasks.mu.Unlock()
+	if err != nil {
+		s.logger.Printf("[tasks] %s: %v", root, err)
+	}
+	if finished.ID == "" {
+		s.advanceQueue(wsCtx)
+		return
+	}
+
+	s.events.publish("tasks_changed", map[string]string{"workspace": root, "task": id, "status": finished.Status})
+	if retry {
+		s.runTask(wsCtx, finished, fmt.Sprintf("The verification command `%s` failed:\n\n```\n%s\n```\n\nFix the problem so the command passes.", finished.Verify, output))
+		return
+	}
+	s.advanceQueue(wsCtx)
+}
+
+// runTaskVerification runs a verify command with the platform shell in the
+// workspace root, in the workspace's shell_sandbox like the shell tool, and
+// returns whether it passed and the tail of its output. The command stops
+// with the server.
+func (s *webServer) runTaskVerification(root, command string) (bool, string) {
+	parent := s.background
+	if parent == nil {
+		parent = context.Background()
+	}
+	ctx, cancel := context.WithTimeout(parent, taskVerifyTimeout)
+	defer cancel()
+	argv := []string{"sh", "-c", command}
+	if runtime.GOOS == "windows" {
+		argv = []string{"cmd", "/C", command}
+	}
+	sandbox := s.agent.cfg.Load().ShellSandboxFor(root)
+	cmd, err := tooling.SandboxedCommand(ctx, sandbox, root, argv, root, tooling.CommandEnv(s.agent.toolOpts.BinDir))
+	if err != nil {
+		return false, err.Error()
+	}
+	out, err := cmd.CombinedOutput()
+	text := strings.TrimSpace(string(out))
+	if len(text) > taskOutputChars {
+		text = "…" + text[len(text)-taskOutputChars:]
+	}
+	if err != nil {
+		if text != "" {
+			text += "\n"
+		}
+		return false, text + err.Error()
+	}
+	return true, text
+}
+
+// handleTasks lists (GET) and changes (POST) the workspace's task queue.
+// POST takes an action:
+//
+//	add          {title, prompt, depends_on, verify, mode, max_attempts}
+//	import_plan  {verify, mode} queues the current plan's unfinished steps in order
+//	pause, resume
+//	retry        {id} runs a failed or blocked task again
+//	skip         {id} marks a task as done without running it
+//	remove       {id}
+//	clear        removes finished tasks
+//
+// The queue advances on its own after every change.
+func (s *webServer) handleTasks(w http.ResponseWriter, r *http.Request) {
+	workspace := s.getWorkspaceFromRequest(r)
+	if workspace == "" || !s.workspaceExists(workspace) {
+		s.respondError(w, r, http.StatusBadRequest, "select a workspace first")
+		return
+	}
+	wsCtx, err := s.agent.GetOrCreateWorkspaceContext(workspace)
+	if err != nil {
+		s.respondError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		queue, err := s.tasks.update(wsCtx.root, nil)
+		if err != nil {
+			s.respondError(w, r, http.StatusInternalServerError, err.Error())
+			return
+		}
+		s.writeJSON(w, r, queue)
+
+	case http.MethodPost:
+		var req struct {
+			Action      string   `json:"action"`
+			ID          string   `json:"id"`
+			Title       string   `json:"title"`
+			Prompt      string   `json:"prompt"`
+			DependsOn   []string `json:"depends_on"`
+			Verify      string   `json:"verify"`
+			Mode        string   `json:"mode"`
+			MaxAttempts int      `json:"max_attempts"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			s.respondError(w, r, http.StatusBadRequest, "invalid payload")
+			return
+		}
+
+		var steps []string
+		if req.Action == "import_plan" {
+			toolCtx := tooling.WithSessionStorage(r.Context(), wsCtx.states.Current().StoragePath())
+			plan, err := fetchPlanSnapshotFromTools(toolCtx, wsCtx.tools)
+			if err != nil {
+				s.respondError(w, r, http.StatusInternalServerError, fmt.Sprintf("load plan: %v", err))
+				return
+			}
+			for _, step := range plan.Steps {
+				if step.Status != "completed" {
+					steps = append(steps, step.Step)
+				}
+			}
+			if len(steps) == 0 {
+				s.respondError(w, r, http.StatusBadRequest, "the plan has no unfinished steps")
+				return
+			}
+		}
+
+		queue, err := s.tasks.update(wsCtx.root, func(q *taskQueue) error {
+			i := q.find(req.ID)
+			switch req.Action {
+			case "add":
+				_, err := q.add(queueTask{Title: req.Title, Prompt: req.Prompt, DependsOn: req.DependsOn, Verify: req.Verify, Mode: req.Mode, MaxAttempts: req.MaxAttempts})
+				return err
+			case "import_plan":
+				mode := req.Mode
+				if mode == "" {
+					mode = taskModeTurn // Steps of one plan build on each other's context
+				}
+				var previous []string
+				for n, step := range steps {
+					prompt := fmt.Sprintf("Work on step %d of %d of the plan: %s\n\nWhen it is done, mark it completed with update_plan and stop; later steps run as separate tasks.", n+1, len(steps), step)
+					task, err := q.add(queueTask{Title: step, Prompt: prompt, DependsOn: previous, Verify: req.Verify, Mode: mode, MaxAttempts: req.MaxAttempts})
+					if err != nil {
+						return err
+					}
+					previous = []string{task.ID}
+				}
+			case "pause":
+				q.Paused = true
+			case "resume":
+				q.Paused = false
+			case "retry", "skip", "remove":
+				if i < 0 {
+					return errTaskNotFound
+				}
+				if q.Tasks[i].Status == taskRunning {
+					return fmt.Errorf("task %s is running", req.ID)
+				}
+				switch req.Action {
+				case "retry":
+					if q.Tasks[i].Status != taskFailed && q.Tasks[i].Status != taskBlocked {
+						return fmt.Errorf("task %s has not failed", req.ID)
+					}
+					q.Tasks[i].Attempts = 0
+					// Tasks blocked behind it get another chance too
+					for k := range q.Tasks {
+						if k == i || q.Tasks[k].Status == taskBlocked {
+							q.Tasks[k].Status, q.Tasks[k].Error = taskPending, ""
+						}
+					}
+				case "skip":
+					q.Tasks[i].Status, q.Tasks[i].Error = taskSkipped, ""
+				case "remove":
+					for _, task := range q.Tasks {
+						if slices.Contains(task.DependsOn, req.ID) {
+							return fmt.Errorf("task %s depends on %s", task.ID, req.ID)
+						}
+					}
+					q.Tasks = slices.Delete(q.Tasks, i, i+1)
+				}
+			case "clear":
+				finished := make(map[string]bool)
+				for _, task := range q.Tasks {
+					if task.Status == taskDone || task.Status == taskSkipped {
+						finished[task.ID] = true
+					}
+				}
+				q.Tasks = slices.DeleteFunc(q.Tasks, func(task queueTask) bool { return finished[task.ID] })
+				for k := range q.Tasks {
+					q.Tasks[k].DependsOn = slices.DeleteFunc(q.Tasks[k].DependsOn, func(dep string) bool { return finished[dep] })
+				}
+			default:
+				return fmt.Errorf("unknown action %q", req.Action)
+			}
+			return nil
+		})
+		if errors.Is(err, errTaskNotFound) {
+			s.respondError(w, r, http.StatusNotFound, err.Error())
+			return
+		}
+		if err != nil {
+			s.respondError(w, r, http.StatusBadRequest, err.Error())
+			return
+		}
+		s.advanceQueue(wsCtx)
+		if current, err := s.tasks.update(wsCtx.root, nil); err == nil {
+			queue = current
+		}
+		s.writeJSON(w, r, queue)
+
+	default:
+		s.respondError(w, r, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+var errTaskNotFound = errors.New("task not found")
+
+// sessionTasks returns the workspace's queue for the session payload, or nil
+// when it is empty. The file is replaced atomically, so it is read unlocked.
+func sessionTasks(workspaceRoot string) *taskQueue {
+	queue, err := loadTaskQueue(workspaceRoot)
+	if err != nil || len(queue.Tasks) == 0 {
+		return nil
+	}
+	return &queue
+}
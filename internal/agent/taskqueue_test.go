@@ -0,0 +1,108 @@
+package agent
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"cando/internal/config"
+)
+
+func TestTaskQueueOrder(t *testing.T) {
+	var q taskQueue
+	build, _ := q.add(queueTask{Prompt: "Build the parser"})
+	test, _ := q.add(queueTask{Prompt: "Test the parser", DependsOn: []string{build.ID}, Mode: taskModeTurn})
+	docs, _ := q.add(queueTask{Title: "Docs", Prompt: "Document it", DependsOn: []string{test.ID}, MaxAttempts: 99})
+	other, _ := q.add(queueTask{Prompt: "Unrelated cleanup"})
+
+	if build.ID != "task-1" || build.Title != "Build the parser" || build.Mode != taskModeSession || build.MaxAttempts != taskDefaultAttempts {
+		t.Errorf("defaults = %+v", build)
+	}
+	if docs.MaxAttempts != taskMaxAttempts {
+		t.Errorf("max attempts = %d, want %d", docs.MaxAttempts, taskMaxAttempts)
+	}
+	if _, err := q.add(queueTask{Prompt: "x", DependsOn: []string{"task-99"}}); err == nil {
+		t.Error("expected an unknown dependency to be rejected")
+	}
+	if _, err := q.add(queueTask{Prompt: " "}); err == nil {
+		t.Error("expected an empty prompt to be rejected")
+	}
+	if _, err := q.add(queueTask{Prompt: "x", Mode: "thread"}); err == nil {
+		t.Error("expected an unknown mode to be rejected")
+	}
+
+	if i := q.next(); q.Tasks[i].ID != build.ID {
+		t.Fatalf("next = %s, want %s", q.Tasks[i].ID, build.ID)
+	}
+	q.Tasks[0].Status = taskSkipped
+	if i := q.next(); q.Tasks[i].ID != test.ID {
+		t.Fatalf("next after skip = %s, want %s", q.Tasks[i].ID, test.ID)
+	}
+
+	// A failure blocks everything downstream but not unrelated tasks
+	q.Tasks[1].Status = taskFailed
+	if i := q.next(); q.Tasks[i].ID != other.ID {
+		t.Fatalf("next after failure = %s, want %s", q.Tasks[i].ID, other.ID)
+	}
+	if q.Tasks[2].Status != taskBlocked || !strings.Contains(q.Tasks[2].Error, test.ID) {
+		t.Errorf("dependent task = %+v", q.Tasks[2])
+	}
+	q.Tasks[3].Status = taskDone
+	if i := q.next(); i != -1 {
+		t.Errorf("next with nothing runnable = %d", i)
+	}
+}
+
+func TestTaskQueueInterrupted(t *testing.T) {
+	root := t.TempDir()
+	runner := newTaskRunner()
+	if _, err := runner.update(root, func(q *taskQueue) error {
+		task, err := q.add(queueTask{Prompt: "Refactor"})
+		q.Tasks[0].Status = taskRunning
+		runner.running[root] = task.ID
+		return err
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if queue, _ := runner.update(root, nil); queue.Tasks[0].Status != taskRunning || queue.Paused {
+		t.Fatalf("live task = %+v, paused %v", queue.Tasks[0], queue.Paused)
+	}
+
+	// A new process does not know about the task
+	queue, err := newTaskRunner().update(root, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if queue.Tasks[0].Status != taskFailed || !queue.Paused {
+		t.Errorf("interrupted task = %+v, paused %v", queue.Tasks[0], queue.Paused)
+	}
+}
+
+func TestTaskVerification(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sh")
+	}
+	root := t.TempDir()
+	s := &webServer{agent: newTestAgent(t, newScriptedClient(), baseTestConfig(root))}
+	if ok, out := s.runTaskVerification(root, "echo fine"); !ok || out != "fine" {
+		t.Errorf("passing command = %v, %q", ok, out)
+	}
+	if ok, out := s.runTaskVerification(root, "echo broken; exit 3"); ok || !strings.Contains(out, "broken") || !strings.Contains(out, "exit status 3") {
+		t.Errorf("failing command = %v, %q", ok, out)
+	}
+
+	// A sandbox that cannot start refuses the command instead of running
+	// it on the host
+	s.agent.cfg.Update(func(c *config.Config) {
+		c.ShellSandbox = config.ShellSandboxes{"default": {Backend: "bubblewrap"}}
+	})
+	t.Setenv("PATH", t.TempDir())
+	if ok, out := s.runTaskVerification(root, "touch ran"); ok || !strings.Contains(out, "bwrap is not installed") {
+		t.Errorf("unsandboxed command = %v, %q", ok, out)
+	}
+	if _, err := os.Stat(filepath.Join(root, "ran")); err == nil {
+		t.Error("verify command ran on the host")
+	}
+}
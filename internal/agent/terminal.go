@@ -0,0 +1,570 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/websocket"
+
+	"cando/internal/state"
+	"cando/internal/tooling"
+)
+
+const (
+	terminalTranscriptLimit = 64 * 1024 // Bytes of output kept per terminal for sharing
+	terminalShareLimit      = 8000      // Characters of transcript appended to a conversation
+	maxTerminalSessions     = 16        // Closed sessions are pruned oldest-first beyond this
+)
+
+var ansiEscapePattern = regexp.MustCompile(`\x1b\[[0-9;?]*[ -/]*[@-~]|\x1b\][^\x07\x1b]*(?:\x07|\x1b\\)|\x1b[@-Z\\-_]`)
+
+// terminalSession tracks one PTY opened from the web UI.
+type terminalSession struct {
+	ID        string
+	Workspace string
+	StartedAt time.Time
+
+	mu         sync.Mutex
+	transcript []byte
+	closed     bool
+}
+
+func (t *terminalSession) record(p []byte) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.transcript = append(t.transcript, p...)
+	if over := len(t.transcript) - terminalTranscriptLimit; over > 0 {
+		t.transcript = t.transcript[over:]
+	}
+}
+
+// Transcript returns the recorded output with terminal escape codes removed.
+func (t *terminalSession) Transcript() string {
+	t.mu.Lock()
+	raw := string(t.transcript)
+	t.mu.Unlock()
+	clean := ansiEscapePattern.ReplaceAllString(raw, "")
+	return strings.ReplaceAll(clean, "\r", "")
+}
+
+// terminalManager keeps recent terminal sessions so transcripts can be shared
+// after the socket closes.
+type terminalManager struct {
+	mu       sync.Mutex
+	sessions map[string]*terminalSession
+	order    []string
+}
+
+func newTerminalManager() *terminalManager {
+	return &terminalManager{sessions: make(map[string]*terminalSession)}
+}
+
+func (m *terminalManager) add(sess *terminalSession) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sessions[sess.ID] = sess
+	m.order = append(m.order, sess.ID)
+	for len(m.order) > maxTerminalSessions {
+		pruned := false
+		for i, id := range m.order {
+			old := m.sessions[id]
+			old.mu.Lock()
+			closed := old.closed
+			old.mu.Unlock()
+			if closed {
+				delete(m.sessions, id)
+				m.order = append(m.order[:i], m.order[i+1:]...)
+				pruned = true
+				break
+			}
+		}
+		if !pruned {
+			break
+		}
+	}
+}
+
+func (m *terminalManager) get(id string) *terminalSession {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.sessions[id]
+}
+
+// terminalMessage is the JSON control protocol spoken over the socket.
+// Client -> server: input, resize. Server -> client: ready, exit.
+// Terminal output is sent as binary frames.
+type terminalMessage struct {
+	Type string `json:"type"`
+	Data string `json:"data,omitempty"`
+	Cols uint16 `json:"cols,omitempty"`
+	Rows uint16 `json:"rows,omitempty"`
+	ID   string `json:"id,omitempty"`
+	Code int    `json:"code,omitempty"`
+}
+
+// handleTerminal upgrades to a WebSocket attached to a shell running in the
+// workspace root with the same environment and shell_sandbox the shell tool
+// uses, or with ?handoff=<id> to the terminal of a command handed to the
+// user.
+func (s *webServer) handleTerminal(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.respondError(w, r, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	workspace := s.getWorkspaceFromRequest(r)
+	if workspace == "" || !s.workspaceExists(workspace) {
+		s.respondError(w, r, http.StatusBadRequest, "select a workspace first")
+		return
+	}
+	// ?handoff=<id> attaches to a command the agent handed to the user
+	if id := r.URL.Query().Get("handoff"); id != "" {
+		h := s.agent.handoffs.get(id)
+		root, _ := filepath.Abs(workspace)
+		if h == nil || h.Workspace != root {
+			s.respondError(w, r, http.StatusNotFound, "no command is waiting for that hand-off; it may have finished")
+			return
+		}
+		server := websocket.Server{
+			Handshake: checkSameOrigin,
+			Handler:   func(ws *websocket.Conn) { s.serveHandoff(ws, h) },
+		}
+		server.ServeHTTP(w, r)
+		return
+	}
+	dir := workspace
+	if cwd := r.URL.Query().Get("cwd"); cwd != "" {
+		resolved, err := tooling.ResolveWithin(workspace, cwd, s.agent.cfg.Load().AllowExternalSymlinks)
+		if err != nil {
+			s.respondError(w, r, http.StatusBadRequest, err.Error())
+			return
+		}
+		dir = resolved
+	}
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		s.respondError(w, r, http.StatusBadRequest, "cwd must be a directory inside the workspace")
+		return
+	}
+	cols := parseTerminalDim(r.URL.Query().Get("cols"), 80)
+	rows := parseTerminalDim(r.URL.Query().Get("rows"), 24)
+
+	wsCtx, err := s.agent.GetOrCreateWorkspaceContext(workspace)
+	if err != nil {
+		s.respondError(w, r, http.StatusInternalServerError, fmt.Sprintf("get workspace context: %v", err))
+		return
+	}
+
+	// Command recording follows config unless the client overrides it
+	var tracker *terminalCommandTracker
+	record := s.agent.cfg.Load().TerminalRecordCommands
+	if raw := r.URL.Query().Get("record"); raw != "" {
+		record, _ = strconv.ParseBool(raw)
+	}
+	if record {
+		tracker = &terminalCommandTracker{wsCtx: wsCtx}
+	}
+
+	server := websocket.Server{
+		Handshake: checkSameOrigin,
+		Handler: func(ws *websocket.Conn) {
+			// The open terminal keeps the workspace context loaded
+			defer wsCtx.hold()()
+			s.serveTerminal(ws, wsCtx.root, dir, cols, rows, tracker)
+		},
+	}
+	server.ServeHTTP(w, r)
+}
+
+func (s *webServer) serveTerminal(ws *websocket.Conn, workspace, dir string, cols, rows uint16, tracker *terminalCommandTracker) {
+	defer ws.Close()
+
+	// Cancelling stops the shell, and the container of a Docker sandbox
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	cmd, err := s.terminalCommand(ctx, workspace, dir)
+	if err != nil {
+		websocket.JSON.Send(ws, terminalMessage{Type: "exit", Data: err.Error(), Code: -1})
+		return
+	}
+	ptmx, err := startTerminal(cmd, cols, rows)
+	if err != nil {
+		websocket.JSON.Send(ws, terminalMessage{Type: "exit", Data: err.Error(), Code: -1})
+		return
+	}
+	defer ptmx.Close()
+
+	sess := &terminalSession{
+		ID:        fmt.Sprintf("term-%d", time.Now().UnixNano()),
+		Workspace: workspace,
+		StartedAt: time.Now(),
+	}
+	s.terminals.add(sess)
+	defer func() {
+		sess.mu.Lock()
+		sess.closed = true
+		sess.mu.Unlock()
+	}()
+	s.logger.Printf("[ws:%s] terminal %s started in %s", workspace, sess.ID, dir)
+
+	var sendMu sync.Mutex
+	send := func(fn func() error) error {
+		sendMu.Lock()
+		defer sendMu.Unlock()
+		return fn()
+	}
+	send(func() error { return websocket.JSON.Send(ws, terminalMessage{Type: "ready", ID: sess.ID}) })
+
+	// Pump PTY output to the socket until the shell exits
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		buf := make([]byte, 4096)
+		for {
+			n, err := ptmx.Read(buf)
+			if n > 0 {
+				chunk := append([]byte(nil), buf[:n]...)
+				sess.record(chunk)
+				if tracker != nil {
+					tracker.output(chunk)
+				}
+				if sendErr := send(func() error { return websocket.Message.Send(ws, chunk) }); sendErr != nil {
+					return
+				}
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	// Pump socket input to the PTY
+	go func() {
+		for {
+			var raw string
+			if err := websocket.Message.Receive(ws, &raw); err != nil {
+				break
+			}
+			var msg terminalMessage
+			if err := json.Unmarshal([]byte(raw), &msg); err != nil {
+				msg = terminalMessage{Type: "input", Data: raw}
+			}
+			switch msg.Type {
+			case "input":
+				if tracker != nil {
+					tracker.input(msg.Data)
+				}
+				_, _ = ptmx.Write([]byte(msg.Data))
+			case "resize":
+				if msg.Cols > 0 && msg.Rows > 0 {
+					_ = resizeTerminal(ptmx, msg.Cols, msg.Rows)
+				}
+			}
+		}
+		// Socket closed by the client: stop the shell
+		cancel()
+	}()
+
+	<-done
+	exitCode := 0
+	if err := cmd.Wait(); err != nil {
+		exitCode = -1
+		if exitErr, ok := err.(interface{ ExitCode() int }); ok {
+			exitCode = exitErr.ExitCode()
+		}
+	}
+	send(func() error {
+		return websocket.JSON.Send(ws, terminalMessage{Type: "exit", ID: sess.ID, Code: exitCode})
+	})
+	s.logger.Printf("[ws:%s] terminal %s exited with code %d", workspace, sess.ID, exitCode)
+}
+
+// terminalCommand returns the shell a terminal runs in dir: the user's
+// $SHELL, or /bin/sh inside the workspace's shell_sandbox, whose image may
+// not have the user's shell. Like the shell tool, it fails rather than run
+// on the host when the sandbox program is missing.
+func (s *webServer) terminalCommand(ctx context.Context, workspace, dir string) (*exec.Cmd, error) {
+	env := tooling.CommandEnv(s.agent.toolOpts.BinDir)
+	sandbox := s.agent.cfg.Load().ShellSandboxFor(workspace)
+	if sandbox.Backend != "" && sandbox.Backend != "direct" {
+		return tooling.SandboxedTerminal(ctx, sandbox, workspace, []string{"/bin/sh"}, dir, env)
+	}
+	shell := os.Getenv("SHELL")
+	if shell == "" {
+		shell = "/bin/sh"
+	}
+	cmd := exec.CommandContext(ctx, shell)
+	cmd.Dir = dir
+	cmd.Env = env
+	return cmd, nil
+}
+
+// handleTerminalShare appends a terminal transcript to the current conversation
+// so the agent can see what the user ran.
+func (s *webServer) handleTerminalShare(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		s.respondError(w, r, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	var req struct {
+		ID string `json:"id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.respondError(w, r, http.StatusBadRequest, "invalid payload")
+		return
+	}
+	sess := s.terminals.get(strings.TrimSpace(req.ID))
+	if sess == nil {
+		s.respondError(w, r, http.StatusNotFound, "terminal not found")
+		return
+	}
+	wsCtx, err := s.agent.GetOrCreateWorkspaceContext(sess.Workspace)
+	if err != nil {
+		s.respondError(w, r, http.StatusInternalServerError, fmt.Sprintf("get workspace context: %v", err))
+		return
+	}
+	if wsCtx.HasInFlightRequest() {
+		s.respondError(w, r, http.StatusConflict, "another request is already running")
+		return
+	}
+
+	transcript := strings.TrimSpace(sess.Transcript())
+	if transcript == "" {
+		s.respondError(w, r, http.StatusBadRequest, "terminal transcript is empty")
+		return
+	}
+	if len(transcript) > terminalShareLimit {
+		transcript = "...\n" + transcript[len(transcript)-terminalShareLimit:]
+	}
+	conv := wsCtx.states.Current()
+	conv.Append(state.Message{
+		Role:    "user",
+		Content: fmt.Sprintf("[Terminal transcript shared by user]\n```\n%s\n```", transcript),
+	})
+	if err := wsCtx.states.Save(conv); err != nil {
+		s.respondError(w, r, http.StatusInternalServerError, fmt.Sprintf("failed to persist conversation: %v", err))
+		return
+	}
+	s.writeSessionPayload(w, r)
+}
+
+// checkSameOrigin rejects cross-site WebSocket handshakes so other pages in
+// the browser cannot open a shell on the local server.
+func checkSameOrigin(cfg *websocket.Config, r *http.Request) error {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return nil // Non-browser clients (editor extensions, CLI)
+	}
+	parsed, err := url.Parse(origin)
+	if err != nil || parsed.Host != r.Host {
+		return fmt.Errorf("cross-origin terminal connection rejected")
+	}
+	cfg.Origin = parsed
+	return nil
+}
+
+func parseTerminalDim(raw string, fallback uint16) uint16 {
+	val, err := strconv.Atoi(raw)
+	if err != nil || val <= 0 || val > 1000 {
+		return fallback
+	}
+	return uint16(val)
+}
+
+const (
+	terminalRecordOutputLimit = 2000 // Characters of output kept per recorded command
+	terminalActivityLimit     = 6000 // Characters of terminal activity injected per turn
+)
+
+// terminalRecord is a compact record of one command the user ran manually.
+type terminalRecord struct {
+	mu       sync.Mutex
+	command  string
+	output   []byte
+	exitCode *int
+}
+
+func (r *terminalRecord) appendOutput(p []byte) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.output = append(r.output, p...)
+	if over := len(r.output) - terminalTranscriptLimit; over > 0 {
+		r.output = r.output[over:]
+	}
+}
+
+// format renders the record, dropping the echoed command and trailing prompt
+// that a PTY transcript contains.
+func (r *terminalRecord) format() string {
+	r.mu.Lock()
+	raw := string(r.output)
+	exitCode := r.exitCode
+	r.mu.Unlock()
+
+	clean := strings.ReplaceAll(ansiEscapePattern.ReplaceAllString(raw, ""), "\r", "")
+	lines := strings.Split(clean, "\n")
+	if len(lines) > 0 && strings.Contains(lines[0], r.command) {
+		lines = lines[1:]
+	}
+	if len(lines) > 0 && !strings.HasSuffix(clean, "\n") {
+		lines = lines[:len(lines)-1] // Next shell prompt
+	}
+	output := strings.TrimSpace(strings.Join(lines, "\n"))
+	if len(output) > terminalRecordOutputLimit {
+		output = "..." + output[len(output)-terminalRecordOutputLimit:]
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "$ %s\n", r.command)
+	if output != "" {
+		b.WriteString(output)
+		b.WriteString("\n")
+	}
+	if exitCode != nil {
+		fmt.Fprintf(&b, "(exit %d)\n", *exitCode)
+	}
+	return b.String()
+}
+
+// addTerminalRecord queues a command so it is shown to the agent on the next turn.
+func (w *WorkspaceContext) addTerminalRecord(rec *terminalRecord) {
+	w.terminalMu.Lock()
+	defer w.terminalMu.Unlock()
+	w.terminalRecords = append(w.terminalRecords, rec)
+}
+
+// takeTerminalActivity drains queued terminal records into a single message.
+// Records are injected at turn start, never mid-turn, so tool call/result
+// ordering in the conversation is preserved.
+func (w *WorkspaceContext) takeTerminalActivity() string {
+	w.terminalMu.Lock()
+	records := w.terminalRecords
+	w.terminalRecords = nil
+	w.terminalMu.Unlock()
+	if len(records) == 0 {
+		return ""
+	}
+
+	entries := make([]string, 0, len(records))
+	total := 0
+	// Keep the most recent commands when over budget
+	for i := len(records) - 1; i >= 0; i-- {
+		entry := records[i].format()
+		if total+len(entry) > terminalActivityLimit && len(entries) > 0 {
+			break
+		}
+		entries = append([]string{entry}, entries...)
+		total += len(entry)
+	}
+	header := "[Terminal activity: commands the user ran manually since the last message]"
+	if skipped := len(records) - len(entries); skipped > 0 {
+		header += fmt.Sprintf("\n(%d earlier commands omitted)", skipped)
+	}
+	return header + "\n" + strings.Join(entries, "\n")
+}
+
+// terminalCommandTracker reconstructs command lines from PTY keystrokes.
+// It is best-effort: line editing beyond backspace is not interpreted.
+type terminalCommandTracker struct {
+	wsCtx    *WorkspaceContext
+	line     []rune
+	escape   bool
+	current  *terminalRecord
+	recordMu sync.Mutex
+}
+
+func (t *terminalCommandTracker) input(data string) {
+	t.recordMu.Lock()
+	defer t.recordMu.Unlock()
+	for _, r := range data {
+		switch {
+		case t.escape:
+			// Skip escape sequences (arrow keys etc.) until their final byte
+			if r >= '@' && r <= '~' && r != '[' {
+				t.escape = false
+			}
+		case r == '\x1b':
+			t.escape = true
+		case r == '\r' || r == '\n':
+			cmd := strings.TrimSpace(string(t.line))
+			t.line = t.line[:0]
+			if cmd == "" {
+				continue
+			}
+			t.current = &terminalRecord{command: cmd}
+			t.wsCtx.addTerminalRecord(t.current)
+		case r == '\x7f' || r == '\b':
+			if len(t.line) > 0 {
+				t.line = t.line[:len(t.line)-1]
+			}
+		case r == '\x03' || r == '\x15':
+			t.line = t.line[:0] // Ctrl-C / Ctrl-U discard the line
+		case r >= ' ':
+			t.line = append(t.line, r)
+		}
+	}
+}
+
+func (t *terminalCommandTracker) output(p []byte) {
+	t.recordMu.Lock()
+	current := t.current
+	t.recordMu.Unlock()
+	if current != nil {
+		current.appendOutput(p)
+	}
+}
+
+// handleTerminalRecord lets a shell wrapper outside the UI report a finished
+// command so it is shown to the agent on the next turn.
+func (s *webServer) handleTerminalRecord(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		s.respondError(w, r, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	var req struct {
+		Command  string `json:"command"`
+		Output   string `json:"output"`
+		ExitCode *int   `json:"exit_code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.respondError(w, r, http.StatusBadRequest, "invalid payload")
+		return
+	}
+	command := strings.TrimSpace(req.Command)
+	if command == "" {
+		s.respondError(w, r, http.StatusBadRequest, "command is required")
+		return
+	}
+	workspace := s.getWorkspaceFromRequest(r)
+	if workspace == "" || !s.workspaceExists(workspace) {
+		s.respondError(w, r, http.StatusBadRequest, "select a workspace first")
+		return
+	}
+	wsCtx, err := s.agent.GetOrCreateWorkspaceContext(workspace)
+	if err != nil {
+		s.respondError(w, r, http.StatusInternalServerError, fmt.Sprintf("get workspace context: %v", err))
+		return
+	}
+	// Wrapper output has no echoed command or prompt to strip
+	output := req.Output
+	if output != "" && !strings.HasSuffix(output, "\n") {
+		output += "\n"
+	}
+	wsCtx.addTerminalRecord(&terminalRecord{
+		command:  command,
+		output:   []byte("$ " + command + "\n" + output),
+		exitCode: req.ExitCode,
+	})
+	s.writeJSON(w, r, map[string]any{
+		"status": "recorded",
+	})
+}
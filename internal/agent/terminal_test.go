@@ -0,0 +1,133 @@
+package agent
+
+import (
+	"context"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/websocket"
+
+	"cando/internal/config"
+)
+
+func TestTerminalCommandTrackerRecordsActivity(t *testing.T) {
+	wsCtx := &WorkspaceContext{}
+	tracker := &terminalCommandTracker{wsCtx: wsCtx}
+
+	// Typo corrected with backspace, arrow key ignored
+	tracker.input("ls -lx\x7fa\x1b[A\r")
+	tracker.output([]byte("ls -la\r\ntotal 0\r\n\x1b[32mmain.go\x1b[0m\r\nuser@host:~$ "))
+	tracker.input("git status\r")
+	tracker.output([]byte("git status\r\nnothing to commit\r\n"))
+
+	activity := wsCtx.takeTerminalActivity()
+	for _, want := range []string{"$ ls -la\ntotal 0\nmain.go\n", "$ git status\nnothing to commit\n"} {
+		if !strings.Contains(activity, want) {
+			t.Fatalf("expected %q in activity:\n%s", want, activity)
+		}
+	}
+	if strings.Contains(activity, "user@host") || strings.Contains(activity, "\x1b") {
+		t.Fatalf("expected prompt and escape codes stripped:\n%s", activity)
+	}
+	if again := wsCtx.takeTerminalActivity(); again != "" {
+		t.Fatalf("expected records to be drained, got %q", again)
+	}
+}
+
+func TestTerminalStartsInsideWorkspace(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("no PTY on Windows")
+	}
+	configDir := t.TempDir()
+	t.Setenv("CANDO_CONFIG_DIR", configDir)
+	t.Setenv("SHELL", "/bin/sh")
+	workspace := t.TempDir()
+	manager := &WorkspaceManager{filePath: filepath.Join(configDir, "workspaces.json")}
+	if _, err := manager.Add(workspace); err != nil {
+		t.Fatal(err)
+	}
+	os.MkdirAll(filepath.Join(workspace, "sub"), 0o755)
+	if err := os.Symlink(t.TempDir(), filepath.Join(workspace, "escape")); err != nil {
+		t.Skipf("symlinks unavailable: %v", err)
+	}
+	s := &webServer{
+		agent:            newTestAgent(t, newScriptedClient(), baseTestConfig(workspace)),
+		logger:           log.New(io.Discard, "", 0),
+		workspaceManager: manager,
+		terminals:        newTerminalManager(),
+	}
+	srv := httptest.NewServer(http.HandlerFunc(s.handleTerminal))
+	defer srv.Close()
+	query := func(cwd string) string {
+		return "?" + url.Values{"workspace": {workspace}, "cwd": {cwd}}.Encode()
+	}
+
+	for _, cwd := range []string{"..", "escape", "missing"} {
+		resp, err := http.Get(srv.URL + query(cwd))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("cwd %q = %d, want 400", cwd, resp.StatusCode)
+		}
+	}
+
+	ws, err := websocket.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+query("sub"), "", srv.URL)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer ws.Close()
+	ws.SetDeadline(time.Now().Add(10 * time.Second))
+	websocket.Message.Send(ws, `{"type":"input","data":"echo \"in=$(pwd -P)\"; exit\r"}`)
+	var output strings.Builder
+	for !strings.Contains(output.String(), `"type":"exit"`) {
+		var frame string
+		if err := websocket.Message.Receive(ws, &frame); err != nil {
+			t.Fatalf("receive: %v (output %q)", err, output.String())
+		}
+		output.WriteString(frame)
+	}
+	want, _ := filepath.EvalSymlinks(filepath.Join(workspace, "sub"))
+	if !strings.Contains(output.String(), "in="+want) {
+		t.Errorf("terminal output = %q, want it to start in %s", output.String(), want)
+	}
+}
+
+func TestTerminalCommandUsesShellSandbox(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("sandboxes need a Unix host")
+	}
+	bin := t.TempDir()
+	os.WriteFile(filepath.Join(bin, "bwrap"), []byte("#!/bin/sh\n"), 0o755)
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+	workspace := t.TempDir()
+	s := &webServer{agent: &Agent{cfg: newRuntimeConfig(config.Config{
+		ShellSandbox: config.ShellSandboxes{"default": {Backend: "bubblewrap"}},
+	})}}
+
+	cmd, err := s.terminalCommand(context.Background(), workspace, workspace)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cmd.Path != filepath.Join(bin, "bwrap") || !slices.Contains(cmd.Args, "--chdir") || cmd.Args[len(cmd.Args)-1] != "/bin/sh" {
+		t.Errorf("terminal command = %q, want the shell under bwrap", cmd.Args)
+	}
+
+	// A missing sandbox program refuses the terminal instead of using the host
+	s.agent.cfg = newRuntimeConfig(config.Config{ShellSandbox: config.ShellSandboxes{"default": {Backend: "firejail"}}})
+	t.Setenv("PATH", bin)
+	if _, err := s.terminalCommand(context.Background(), workspace, workspace); err == nil || !strings.Contains(err.Error(), "not installed") {
+		t.Errorf("missing firejail = %v", err)
+	}
+}
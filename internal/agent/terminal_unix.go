@@ -0,0 +1,26 @@
+//go:build !windows
+
+package agent
+
+import (
+	"os"
+	"os/exec"
+
+	"github.com/creack/pty"
+)
+
+// startTerminal starts the shell of a web terminal attached to a new PTY.
+func startTerminal(cmd *exec.Cmd, cols, rows uint16) (*os.File, error) {
+	return startPTY(cmd, cols, rows)
+}
+
+// startPTY starts cmd attached to a new PTY of the given size.
+func startPTY(cmd *exec.Cmd, cols, rows uint16) (*os.File, error) {
+	cmd.Env = append(cmd.Env, "TERM=xterm-256color")
+	return pty.StartWithSize(cmd, &pty.Winsize{Cols: cols, Rows: rows})
+}
+
+// resizeTerminal updates the PTY window size.
+func resizeTerminal(ptmx *os.File, cols, rows uint16) error {
+	return pty.Setsize(ptmx, &pty.Winsize{Cols: cols, Rows: rows})
+}
@@ -0,0 +1,22 @@
+//go:build windows
+
+package agent
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+)
+
+// startTerminal is not available on Windows; PTYs require ConPTY support.
+func startTerminal(cmd *exec.Cmd, cols, rows uint16) (*os.File, error) {
+	return nil, errors.New("the in-UI terminal is not supported on Windows")
+}
+
+func startPTY(cmd *exec.Cmd, cols, rows uint16) (*os.File, error) {
+	return nil, errors.New("interactive commands are not supported on Windows")
+}
+
+func resizeTerminal(ptmx *os.File, cols, rows uint16) error {
+	return errors.New("the in-UI terminal is not supported on Windows")
+}
@@ -0,0 +1,212 @@
+package agent
+
+import (
+	"encoding/json"
+
+	"cando/internal/timefmt"
+)
+
+// API payloads carry every timestamp as UTC RFC 3339 with a matching
+// <field>_ms in Unix milliseconds, so clients in any timezone render the
+// same times. The methods below shadow the time.Time fields of each payload
+// type; decoding is unchanged because the strings still parse as time.Time.
+
+func (r turnRecord) MarshalJSON() ([]byte, error) {
+	type record turnRecord
+	return json.Marshal(struct {
+		record
+		StartedAt    timefmt.Time `json:"started_at"`
+		StartedAtMs  int64        `json:"started_at_ms"`
+		FinishedAt   timefmt.Time `json:"finished_at,omitzero"`
+		FinishedAtMs int64        `json:"finished_at_ms,omitempty"`
+	}{record(r), timefmt.Time(r.StartedAt), timefmt.Millis(r.StartedAt), timefmt.Time(r.FinishedAt), timefmt.Millis(r.FinishedAt)})
+}
+
+func (e activityEntry) MarshalJSON() ([]byte, error) {
+	type entry activityEntry
+	return json.Marshal(struct {
+		entry
+		Time   timefmt.Time `json:"time"`
+		TimeMs int64        `json:"time_ms"`
+	}{entry(e), timefmt.Time(e.Time), timefmt.Millis(e.Time)})
+}
+
+func (e turnLogEntry) MarshalJSON() ([]byte, error) {
+	type entry turnLogEntry
+	return json.Marshal(struct {
+		entry
+		Time   timefmt.Time `json:"time"`
+		TimeMs int64        `json:"time_ms"`
+	}{entry(e), timefmt.Time(e.Time), timefmt.Millis(e.Time)})
+}
+
+func (s turnSummary) MarshalJSON() ([]byte, error) {
+	type summary turnSummary
+	return json.Marshal(struct {
+		summary
+		Time   timefmt.Time `json:"time"`
+		TimeMs int64        `json:"time_ms"`
+	}{summary(s), timefmt.Time(s.Time), timefmt.Millis(s.Time)})
+}
+
+func (l sessionLock) MarshalJSON() ([]byte, error) {
+	type lock sessionLock
+	return json.Marshal(struct {
+		lock
+		AcquiredAt   timefmt.Time `json:"acquired_at"`
+		AcquiredAtMs int64        `json:"acquired_at_ms"`
+		LastSeen     timefmt.Time `json:"last_seen"`
+		LastSeenMs   int64        `json:"last_seen_ms"`
+	}{lock(l), timefmt.Time(l.AcquiredAt), timefmt.Millis(l.AcquiredAt), timefmt.Time(l.LastSeen), timefmt.Millis(l.LastSeen)})
+}
+
+func (s editorSelection) MarshalJSON() ([]byte, error) {
+	type selection editorSelection
+	return json.Marshal(struct {
+		selection
+		UpdatedAt   timefmt.Time `json:"updated_at"`
+		UpdatedAtMs int64        `json:"updated_at_ms"`
+	}{selection(s), timefmt.Time(s.UpdatedAt), timefmt.Millis(s.UpdatedAt)})
+}
+
+func (c editorCommand) MarshalJSON() ([]byte, error) {
+	type command editorCommand
+	return json.Marshal(struct {
+		command
+		CreatedAt   timefmt.Time `json:"created_at"`
+		CreatedAtMs int64        `json:"created_at_ms"`
+	}{command(c), timefmt.Time(c.CreatedAt), timefmt.Millis(c.CreatedAt)})
+}
+
+func (w Workspace) MarshalJSON() ([]byte, error) {
+	type workspace Workspace
+	return json.Marshal(struct {
+		workspace
+		Added   timefmt.Time `json:"added"`
+		AddedMs int64        `json:"added_ms"`
+	}{workspace(w), timefmt.Time(w.Added), timefmt.Millis(w.Added)})
+}
+
+func (s WorkspaceStats) MarshalJSON() ([]byte, error) {
+	type stats WorkspaceStats
+	return json.Marshal(struct {
+		stats
+		LastActivity   *timefmt.Time `json:"last_activity,omitempty"`
+		LastActivityMs *int64        `json:"last_activity_ms,omitempty"`
+		ComputedAt     timefmt.Time  `json:"computed_at"`
+		ComputedAtMs   int64         `json:"computed_at_ms"`
+	}{stats(s), timefmt.Ptr(s.LastActivity), timefmt.PtrMillis(s.LastActivity), timefmt.Time(s.ComputedAt), timefmt.Millis(s.ComputedAt)})
+}
+
+func (w activeWorkspace) MarshalJSON() ([]byte, error) {
+	type workspace activeWorkspace
+	return json.Marshal(struct {
+		workspace
+		LastUsed   timefmt.Time `json:"last_used"`
+		LastUsedMs int64        `json:"last_used_ms"`
+	}{workspace(w), timefmt.Time(w.LastUsed), timefmt.Millis(w.LastUsed)})
+}
+
+func (p planSnapshot) MarshalJSON() ([]byte, error) {
+	type snapshot planSnapshot
+	return json.Marshal(struct {
+		snapshot
+		UpdatedAt   timefmt.Time `json:"updated_at"`
+		UpdatedAtMs int64        `json:"updated_at_ms"`
+	}{snapshot(p), timefmt.Time(p.UpdatedAt), timefmt.Millis(p.UpdatedAt)})
+}
+
+func (r providerErrorRecord) MarshalJSON() ([]byte, error) {
+	type record providerErrorRecord
+	return json.Marshal(struct {
+		record
+		Time   timefmt.Time `json:"time"`
+		TimeMs int64        `json:"time_ms"`
+	}{record(r), timefmt.Time(r.Time), timefmt.Millis(r.Time)})
+}
+
+func (e feedbackEntry) MarshalJSON() ([]byte, error) {
+	type entry feedbackEntry
+	return json.Marshal(struct {
+		entry
+		Time   timefmt.Time `json:"time"`
+		TimeMs int64        `json:"time_ms"`
+	}{entry(e), timefmt.Time(e.Time), timefmt.Millis(e.Time)})
+}
+
+func (t queueTask) MarshalJSON() ([]byte, error) {
+	type task queueTask
+	return json.Marshal(struct {
+		task
+		StartedAt    timefmt.Time `json:"started_at,omitzero"`
+		StartedAtMs  int64        `json:"started_at_ms,omitempty"`
+		FinishedAt   timefmt.Time `json:"finished_at,omitzero"`
+		FinishedAtMs int64        `json:"finished_at_ms,omitempty"`
+	}{task(t), timefmt.Time(t.StartedAt), timefmt.Millis(t.StartedAt), timefmt.Time(t.FinishedAt), timefmt.Millis(t.FinishedAt)})
+}
+
+func (s modelCacheStatus) MarshalJSON() ([]byte, error) {
+	type status modelCacheStatus
+	return json.Marshal(struct {
+		status
+		FetchedAt   timefmt.Time `json:"fetched_at"`
+		FetchedAtMs int64        `json:"fetched_at_ms"`
+	}{status(s), timefmt.Time(s.FetchedAt), timefmt.Millis(s.FetchedAt)})
+}
+
+func (v checkpointView) MarshalJSON() ([]byte, error) {
+	type view checkpointView
+	return json.Marshal(struct {
+		view
+		Time   timefmt.Time `json:"time"`
+		TimeMs int64        `json:"time_ms"`
+	}{view(v), timefmt.Time(v.Time), timefmt.Millis(v.Time)})
+}
+
+func (n toolNode) MarshalJSON() ([]byte, error) {
+	type node toolNode
+	return json.Marshal(struct {
+		node
+		Started   timefmt.Time `json:"started"`
+		StartedMs int64        `json:"started_ms"`
+	}{node(n), timefmt.Time(n.Started), timefmt.Millis(n.Started)})
+}
+
+func (g turnGraph) MarshalJSON() ([]byte, error) {
+	type graph turnGraph
+	return json.Marshal(struct {
+		graph
+		Started    timefmt.Time  `json:"started"`
+		StartedMs  int64         `json:"started_ms"`
+		Finished   *timefmt.Time `json:"finished,omitempty"`
+		FinishedMs *int64        `json:"finished_ms,omitempty"`
+	}{graph(g), timefmt.Time(g.Started), timefmt.Millis(g.Started), timefmt.Ptr(g.Finished), timefmt.PtrMillis(g.Finished)})
+}
+
+func (p pendingApproval) MarshalJSON() ([]byte, error) {
+	type approval pendingApproval
+	return json.Marshal(struct {
+		approval
+		RequestedAt   timefmt.Time `json:"requested_at"`
+		RequestedAtMs int64        `json:"requested_at_ms"`
+	}{approval(p), timefmt.Time(p.RequestedAt), timefmt.Millis(p.RequestedAt)})
+}
+
+func (p queuedPrompt) MarshalJSON() ([]byte, error) {
+	type prompt queuedPrompt
+	return json.Marshal(struct {
+		prompt
+		QueuedAt   timefmt.Time `json:"queued_at"`
+		QueuedAtMs int64        `json:"queued_at_ms"`
+	}{prompt(p), timefmt.Time(p.QueuedAt), timefmt.Millis(p.QueuedAt)})
+}
+
+// handoff holds locks, so it marshals through a pointer instead of a copy.
+func (h *handoff) MarshalJSON() ([]byte, error) {
+	type step handoff
+	return json.Marshal(struct {
+		*step
+		StartedAt   timefmt.Time `json:"started_at"`
+		StartedAtMs int64        `json:"started_at_ms"`
+	}{(*step)(h), timefmt.Time(h.StartedAt), timefmt.Millis(h.StartedAt)})
+}
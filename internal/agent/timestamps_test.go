@@ -0,0 +1,39 @@
+package agent
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestPayloadTimestampsAreUTC(t *testing.T) {
+	local := time.Date(2024, 3, 9, 14, 30, 5, 250e6, time.FixedZone("CET", 3600))
+	const want = "2024-03-09T13:30:05.250Z"
+
+	cases := []struct {
+		name  string
+		value any
+		field string
+	}{
+		{"checkpoint", checkpointView{ID: "cp1", Time: local}, "time"},
+		{"tool node", toolNode{ID: "n1", Started: local}, "started"},
+		{"turn graph", turnGraph{TurnID: "t1", Started: local}, "started"},
+		{"finished turn graph", turnGraph{TurnID: "t1", Started: local, Finished: &local}, "finished"},
+		{"tool approval", pendingApproval{ID: "a1", RequestedAt: local}, "requested_at"},
+		{"queued prompt", queuedPrompt{ID: "q1", QueuedAt: local}, "queued_at"},
+		{"handoff", &handoff{ID: "h1", StartedAt: local}, "started_at"},
+	}
+	for _, tc := range cases {
+		raw, err := json.Marshal(tc.value)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		var got map[string]any
+		if err := json.Unmarshal(raw, &got); err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		if got[tc.field] != want || got[tc.field+"_ms"] != float64(local.UnixMilli()) {
+			t.Errorf("%s: %s = %v, %s_ms = %v", tc.name, tc.field, got[tc.field], tc.field, got[tc.field+"_ms"])
+		}
+	}
+}
@@ -0,0 +1,202 @@
+package agent
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"cando/internal/tooling"
+)
+
+// approvalTimeout is how long a tool call waits for the user before it is
+// treated as rejected, so an abandoned browser tab cannot hang a turn.
+const approvalTimeout = 10 * time.Minute
+
+// pendingApproval is a tool call waiting for an answer on /api/tool-approval.
+type pendingApproval struct {
+	ID          string         `json:"id"`
+	Workspace   string         `json:"workspace"`
+	TurnID      string         `json:"turn_id,omitempty"`
+	CallID      string         `json:"call_id"`
+	Tool        string         `json:"tool"`
+	Arguments   map[string]any `json:"arguments"`
+	Summary     string         `json:"summary"`
+	RequestedAt time.Time      `json:"requested_at"`
+
+	decide chan tooling.ApprovalDecision
+}
+
+// approvalBroker connects tool calls that need approval with the web UI
+// that answers them. The zero value is ready to use.
+type approvalBroker struct {
+	mu      sync.Mutex
+	pending map[string]*pendingApproval
+}
+
+// approver returns a tooling.Approver for turns in workspace. Each request is
+// announced with a tool_approval_required event and stays listed on
+// /api/tool-approval until it is answered.
+func (b *approvalBroker) approver(workspace, turnID string, callback StreamCallback) tooling.Approver {
+	return func(ctx context.Context, req tooling.ApprovalRequest) (tooling.ApprovalDecision, error) {
+		p := &pendingApproval{
+			ID:          newApprovalID(),
+			Workspace:   workspace,
+			TurnID:      turnID,
+			CallID:      req.ID,
+			Tool:        req.Tool,
+			Arguments:   req.Arguments,
+			Summary:     req.Summary,
+			RequestedAt: time.Now(),
+			decide:      make(chan tooling.ApprovalDecision, 1),
+		}
+		b.mu.Lock()
+		if b.pending == nil {
+			b.pending = make(map[string]*pendingApproval)
+		}
+		b.pending[p.ID] = p
+		b.mu.Unlock()
+		defer func() {
+			b.mu.Lock()
+			delete(b.pending, p.ID)
+			b.mu.Unlock()
+		}()
+
+		if callback != nil {
+			_ = callback("tool_approval_required", map[string]any{
+				"id":         p.ID,
+				"call_id":    p.CallID,
+				"tool":       p.Tool,
+				"arguments":  p.Arguments,
+				"summary":    p.Summary,
+				"timeout_ms": approvalTimeout.Milliseconds(),
+			})
+		}
+		timer := time.NewTimer(approvalTimeout)
+		defer timer.Stop()
+		var decision tooling.ApprovalDecision
+		var err error
+		select {
+		case decision = <-p.decide:
+		case <-timer.C:
+			decision = tooling.ApprovalDecision{Reason: fmt.Sprintf("no answer within %s", approvalTimeout)}
+		case <-ctx.Done():
+			err = ctx.Err()
+		}
+		if callback != nil {
+			_ = callback("tool_approval_resolved", map[string]any{
+				"id":       p.ID,
+				"call_id":  p.CallID,
+				"approved": decision.Approved,
+				"reason":   decision.Reason,
+			})
+		}
+		return decision, err
+	}
+}
+
+// list returns the requests waiting in workspace, oldest first.
+func (b *approvalBroker) list(workspace string) []*pendingApproval {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	out := []*pendingApproval{}
+	for _, p := range b.pending {
+		if p.Workspace == workspace {
+			out = append(out, p)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].RequestedAt.Before(out[j].RequestedAt) })
+	return out
+}
+
+// resolve answers the request id. It reports false when no such request is
+// waiting, e.g. because it was already answered or timed out.
+func (b *approvalBroker) resolve(id string, decision tooling.ApprovalDecision) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	p, ok := b.pending[id]
+	if !ok {
+		return false
+	}
+	delete(b.pending, id)
+	p.decide <- decision
+	return true
+}
+
+func newApprovalID() string {
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		panic("approval id: " + err.Error())
+	}
+	return hex.EncodeToString(buf)
+}
+
+// approveInTerminal asks about a tool call on the terminal. Anything but y or
+// yes rejects it; text after the answer is passed to the model as the reason.
+func (a *Agent) approveInTerminal(ctx context.Context, req tooling.ApprovalRequest) (tooling.ApprovalDecision, error) {
+	fmt.Printf("\nAllow %s: %s\n[y/N, or n followed by a reason] ", req.Tool, req.Summary)
+	// Read directly: go-prompt releases the terminal while a turn runs
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil {
+		return tooling.ApprovalDecision{}, err
+	}
+	if err := ctx.Err(); err != nil {
+		return tooling.ApprovalDecision{}, err
+	}
+	word, reason, _ := strings.Cut(strings.TrimSpace(line), " ")
+	switch strings.ToLower(word) {
+	case "y", "yes":
+		return tooling.ApprovalDecision{Approved: true}, nil
+	}
+	return tooling.ApprovalDecision{Reason: strings.TrimSpace(reason)}, nil
+}
+
+// handleToolApproval lists the tool calls waiting for approval in a
+// workspace (GET) and answers one of them (POST {"id", "approved", "reason"}).
+func (s *webServer) handleToolApproval(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		workspace := s.getWorkspaceFromRequest(r)
+		if workspace == "" {
+			s.respondError(w, r, http.StatusBadRequest, "workspace required")
+			return
+		}
+		root, err := filepath.Abs(workspace)
+		if err != nil {
+			s.respondError(w, r, http.StatusBadRequest, fmt.Sprintf("invalid workspace: %v", err))
+			return
+		}
+		s.writeJSON(w, r, map[string]any{"pending": s.agent.approvals.list(root)})
+	case http.MethodPost:
+		var body struct {
+			ID       string `json:"id"`
+			Approved bool   `json:"approved"`
+			Reason   string `json:"reason"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			s.respondError(w, r, http.StatusBadRequest, fmt.Sprintf("invalid body: %v", err))
+			return
+		}
+		if body.ID == "" {
+			s.respondError(w, r, http.StatusBadRequest, "id required")
+			return
+		}
+		decision := tooling.ApprovalDecision{Approved: body.Approved, Reason: strings.TrimSpace(body.Reason)}
+		if !s.agent.approvals.resolve(body.ID, decision) {
+			s.respondError(w, r, http.StatusNotFound, "no tool call is waiting for that approval; it may have been answered or timed out")
+			return
+		}
+		s.writeJSON(w, r, map[string]any{"status": "ok", "approved": body.Approved})
+	default:
+		s.respondError(w, r, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
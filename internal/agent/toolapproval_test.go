@@ -0,0 +1,140 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"cando/internal/config"
+	"cando/internal/llm"
+	"cando/internal/state"
+)
+
+func TestToolApprovalInWebTurn(t *testing.T) {
+	t.Setenv("CANDO_CONFIG_DIR", t.TempDir())
+	cfg := baseTestConfig(t.TempDir())
+	cfg.ToolPermissions = config.ToolPermissions{"default": {"write_file": "ask"}}
+	workspace := t.TempDir()
+
+	run := func(approved bool) (string, []string) {
+		t.Helper()
+		scripted := newScriptedClient(
+			callReply("write_file", `{"path":"out.txt","content":"hello"}`),
+			llm.ChatResponse{Choices: []llm.ChatChoice{{Message: state.Message{Role: "assistant", Content: "done"}, FinishReason: "stop"}}},
+		)
+		// Streaming callbacks read the active provider
+		client, err := NewMultiProviderClient("mock", []ProviderRegistration{
+			{Option: ProviderOption{Key: "mock", Label: "Mock", Model: cfg.Model}, Client: scripted},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		agent := newTestAgent(t, client, cfg)
+		s := &webServer{agent: agent, logger: log.New(io.Discard, "", 0)}
+		wsCtx, err := agent.GetOrCreateWorkspaceContext(workspace)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var events []string
+		callback := func(eventType string, data any) error {
+			events = append(events, eventType)
+			if eventType != "tool_approval_required" {
+				return nil
+			}
+			payload := data.(map[string]any)
+			if payload["summary"] != "out.txt" {
+				t.Errorf("summary = %v", payload["summary"])
+			}
+			// Answer from another goroutine, as the browser would
+			go func() {
+				rec := httptest.NewRecorder()
+				list := httptest.NewRequest(http.MethodGet, "/api/tool-approval?workspace="+workspace, nil)
+				s.handleToolApproval(rec, list)
+				if !strings.Contains(rec.Body.String(), payload["id"].(string)) {
+					t.Errorf("pending list = %s", rec.Body.String())
+				}
+				body := fmt.Sprintf(`{"id":%q,"approved":%t,"reason":"not now"}`, payload["id"], approved)
+				rec = httptest.NewRecorder()
+				s.handleToolApproval(rec, httptest.NewRequest(http.MethodPost, "/api/tool-approval", strings.NewReader(body)))
+				if rec.Code != http.StatusOK {
+					t.Errorf("approve status = %d: %s", rec.Code, rec.Body.String())
+				}
+			}()
+			return nil
+		}
+		if _, _, err := agent.respondWithCallbacksForWorkspace(context.Background(), "write it", callback, wsCtx); err != nil {
+			t.Fatal(err)
+		}
+		var result string
+		for _, msg := range wsCtx.states.Current().Messages() {
+			if msg.Role == "tool" {
+				result = msg.Content
+			}
+		}
+		return result, events
+	}
+
+	result, events := run(false)
+	if !strings.Contains(result, "the user rejected this write_file call: not now") {
+		t.Errorf("rejected result = %q", result)
+	}
+	if _, err := os.Stat(filepath.Join(workspace, "out.txt")); !os.IsNotExist(err) {
+		t.Fatalf("rejected write ran: %v", err)
+	}
+	if !strings.Contains(strings.Join(events, ","), "tool_approval_required,tool_approval_resolved") {
+		t.Errorf("events = %v", events)
+	}
+
+	if result, _ := run(true); strings.Contains(result, "not run") {
+		t.Errorf("approved result = %q", result)
+	}
+	if data, err := os.ReadFile(filepath.Join(workspace, "out.txt")); err != nil || string(data) != "hello" {
+		t.Fatalf("approved write: %q, %v", data, err)
+	}
+
+	rec := httptest.NewRecorder()
+	s := &webServer{agent: &Agent{}, logger: log.New(io.Discard, "", 0)}
+	s.handleToolApproval(rec, httptest.NewRequest(http.MethodPost, "/api/tool-approval", strings.NewReader(`{"id":"gone","approved":true}`)))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("answering an unknown approval = %d", rec.Code)
+	}
+}
+
+func TestToolPermissionDenyAndNoApprover(t *testing.T) {
+	workspace := t.TempDir()
+	cfg := baseTestConfig(workspace)
+	cfg.ToolPermissions = config.ToolPermissions{
+		"default": {"shell": "ask"},
+		workspace: {"write_file": "deny"},
+	}
+	client := newScriptedClient(
+		callReply("write_file", `{"path":"out.txt","content":"hello"}`),
+		callReply("shell", `{"command":"touch ran"}`),
+		llm.ChatResponse{Choices: []llm.ChatChoice{{Message: state.Message{Role: "assistant", Content: "done"}, FinishReason: "stop"}}},
+	)
+	agent := newTestAgent(t, client, cfg)
+	if err := agent.RunOneShot(context.Background(), "go"); err != nil {
+		t.Fatal(err)
+	}
+	var results []string
+	for _, msg := range agent.states.Current().Messages() {
+		if msg.Role == "tool" {
+			results = append(results, msg.Content)
+		}
+	}
+	if len(results) != 2 || !strings.Contains(results[0], "denied in this workspace") || !strings.Contains(results[1], "cannot be asked for") {
+		t.Errorf("results = %q", results)
+	}
+	for _, name := range []string{"out.txt", "ran"} {
+		if _, err := os.Stat(filepath.Join(workspace, name)); !os.IsNotExist(err) {
+			t.Errorf("%s exists: %v", name, err)
+		}
+	}
+}
@@ -0,0 +1,340 @@
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"cando/internal/tooling"
+)
+
+const (
+	turnGraphsDir = "turn_graphs"
+	// maxTurnGraphs bounds the graphs kept per workspace; the oldest go first.
+	maxTurnGraphs = 200
+)
+
+// Edge kinds of a turn graph.
+const (
+	edgeReadBeforeEdit   = "read_before_edit"   // The file was read, then edited
+	edgeEditAfterEdit    = "edit_after_edit"    // The file was edited again
+	edgeCommandAfterEdit = "command_after_edit" // A command ran after the edit, e.g. tests
+	edgeAfterFailure     = "after_failure"      // The call came in the round after a failed one
+)
+
+// toolNode is one tool call of a turn.
+type toolNode struct {
+	ID         string       `json:"id"`
+	Index      int          `json:"index"` // Order in the turn, from 0
+	Round      int          `json:"round"` // Model response that made the call, from 1
+	Tool       string       `json:"tool"`
+	Summary    string       `json:"summary"`
+	Files      []recentFile `json:"files,omitempty"`
+	Status     string       `json:"status"` // running | ok | error | blocked
+	ExitCode   *int         `json:"exit_code,omitempty"`
+	Started    time.Time    `json:"started"`
+	DurationMS int64        `json:"duration_ms"`
+}
+
+// toolEdge links two tool calls of a turn by node ID.
+type toolEdge struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+	Kind string `json:"kind"`
+	Path string `json:"path,omitempty"`
+}
+
+// turnGraph shows how a turn reached its result: its tool calls in order
+// and how they depend on each other. Served by /api/turns/<id>/graph.
+type turnGraph struct {
+	TurnID   string      `json:"turn_id"`
+	Session  string      `json:"session"`
+	Prompt   string      `json:"prompt,omitempty"`
+	Started  time.Time   `json:"started"`
+	Finished *time.Time  `json:"finished,omitempty"` // Unset while the turn runs
+	Nodes    []*toolNode `json:"nodes"`
+	Edges    []toolEdge  `json:"edges"`
+}
+
+// toolGraphRecorder builds a turn's graph from its tool events. The graph
+// is saved after every tool call, so a running turn's graph can be fetched
+// too.
+type toolGraphRecorder struct {
+	root   string
+	logger *log.Logger
+
+	mu         sync.Mutex
+	graph      turnGraph
+	nodes      map[string]*toolNode // Call ID -> its latest node
+	args       map[string]map[string]any
+	completed  bool     // A call finished since the round's first start
+	failed     []string // Failed calls of the current round
+	prevFailed []string // Failed calls of the previous round
+	lastRead   map[string]string
+	lastEdit   map[string]string
+	unverified []string // Edits since the last command
+}
+
+func newToolGraphRecorder(root, turnID, session, prompt string, logger *log.Logger) *toolGraphRecorder {
+	return &toolGraphRecorder{
+		root:   root,
+		logger: logger,
+		graph: turnGraph{
+			TurnID:  turnID,
+			Session: session,
+			Prompt:  truncatePrompt(prompt),
+			Started: time.Now().UTC(),
+			Nodes:   []*toolNode{},
+			Edges:   []toolEdge{},
+		},
+		nodes:    make(map[string]*toolNode),
+		args:     make(map[string]map[string]any),
+		lastRead: make(map[string]string),
+		lastEdit: make(map[string]string),
+	}
+}
+
+// Wrap returns a callback that records tool calls and forwards to next.
+func (g *toolGraphRecorder) Wrap(next StreamCallback) StreamCallback {
+	return func(eventType string, data any) error {
+		if payload, ok := data.(map[string]any); ok {
+			switch eventType {
+			case "tool_call_started":
+				g.started(payload)
+			case "tool_call_completed":
+				g.completedCall(payload)
+			}
+		}
+		if next == nil {
+			return nil
+		}
+		return next(eventType, data)
+	}
+}
+
+func (g *toolGraphRecorder) started(payload map[string]any) {
+	id, _ := payload["id"].(string)
+	function, _ := payload["function"].(string)
+	raw, _ := payload["arguments"].(string)
+	var args map[string]any
+	json.Unmarshal([]byte(raw), &args)
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	round := 1
+	if n := len(g.graph.Nodes); n > 0 {
+		round = g.graph.Nodes[n-1].Round
+		if g.completed {
+			// Calls after results came back belong to the next response
+			round++
+			g.completed = false
+			g.prevFailed, g.failed = g.failed, nil
+		}
+	}
+	// Node IDs stay unique even if a provider reuses call IDs
+	nodeID := id
+	if nodeID == "" || g.nodes[nodeID] != nil {
+		nodeID = fmt.Sprintf("%s#%d", id, len(g.graph.Nodes))
+	}
+	node := &toolNode{
+		ID:      nodeID,
+		Index:   len(g.graph.Nodes),
+		Round:   round,
+		Tool:    function,
+		Summary: tooling.SummarizeCall(function, args),
+		Status:  "running",
+		Started: time.Now().UTC(),
+	}
+	g.graph.Nodes = append(g.graph.Nodes, node)
+	g.nodes[id] = node
+	g.args[id] = args
+	for _, failed := range g.prevFailed {
+		g.graph.Edges = append(g.graph.Edges, toolEdge{From: failed, To: nodeID, Kind: edgeAfterFailure})
+	}
+}
+
+func (g *toolGraphRecorder) completedCall(payload map[string]any) {
+	id, _ := payload["id"].(string)
+	failed, _ := payload["error"].(bool)
+	blocked, _ := payload["blocked"].(bool)
+	result, _ := payload["result"].(string)
+
+	g.mu.Lock()
+	node := g.nodes[id]
+	if node == nil {
+		g.mu.Unlock()
+		return
+	}
+	g.completed = true
+	node.DurationMS = time.Since(node.Started).Milliseconds()
+	args := g.args[id]
+	delete(g.args, id)
+	id = node.ID
+	switch {
+	case blocked:
+		node.Status = "blocked"
+	case failed:
+		node.Status = "error"
+	default:
+		node.Status = "ok"
+	}
+	if node.Tool == "shell" && !blocked {
+		var shell struct {
+			ExitCode *int `json:"exit_code"`
+		}
+		if json.Unmarshal([]byte(result), &shell) == nil && shell.ExitCode != nil {
+			node.ExitCode = shell.ExitCode
+			if *shell.ExitCode != 0 {
+				node.Status = "error"
+			}
+		}
+		for _, edit := range g.unverified {
+			g.graph.Edges = append(g.graph.Edges, toolEdge{From: edit, To: id, Kind: edgeCommandAfterEdit})
+		}
+		g.unverified = nil
+	}
+	if node.Status == "error" {
+		g.failed = append(g.failed, id)
+	}
+	if node.Status == "ok" {
+		node.Files = touchedFiles(g.root, node.Tool, args)
+		for _, f := range node.Files {
+			if f.Action == "read" {
+				g.lastRead[f.Path] = id
+				continue
+			}
+			if read, ok := g.lastRead[f.Path]; ok {
+				g.graph.Edges = append(g.graph.Edges, toolEdge{From: read, To: id, Kind: edgeReadBeforeEdit, Path: f.Path})
+			}
+			if edit, ok := g.lastEdit[f.Path]; ok && edit != id {
+				g.graph.Edges = append(g.graph.Edges, toolEdge{From: edit, To: id, Kind: edgeEditAfterEdit, Path: f.Path})
+			}
+			g.lastEdit[f.Path] = id
+			g.unverified = appendUnique(g.unverified, id)
+		}
+	}
+	data, err := json.Marshal(g.graph)
+	g.mu.Unlock()
+	if err == nil {
+		g.save(data)
+	}
+}
+
+// Finish marks the graph complete. Turns without tool calls leave no graph.
+func (g *toolGraphRecorder) Finish() {
+	g.mu.Lock()
+	if len(g.graph.Nodes) == 0 {
+		g.mu.Unlock()
+		return
+	}
+	finished := time.Now().UTC()
+	g.graph.Finished = &finished
+	data, err := json.Marshal(g.graph)
+	g.mu.Unlock()
+	if err == nil && g.save(data) {
+		pruneTurnGraphs(g.root)
+	}
+}
+
+func (g *toolGraphRecorder) save(data []byte) bool {
+	path, err := turnGraphPath(g.root, g.graph.TurnID)
+	if err == nil {
+		err = os.MkdirAll(filepath.Dir(path), 0o755)
+	}
+	if err == nil {
+		err = os.WriteFile(path, data, 0o644)
+	}
+	if err != nil {
+		if g.logger != nil {
+			g.logger.Printf("[ws:%s] turn graph write failed: %v", g.root, err)
+		}
+		return false
+	}
+	return true
+}
+
+func turnGraphPath(workspaceRoot, turnID string) (string, error) {
+	name := sanitizeSlug(turnID)
+	if name == "" {
+		return "", fmt.Errorf("invalid turn id %q", turnID)
+	}
+	storageRoot, err := ProjectStorageRoot(workspaceRoot)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(storageRoot, turnGraphsDir, name+".json"), nil
+}
+
+// pruneTurnGraphs drops the oldest graphs beyond maxTurnGraphs.
+func pruneTurnGraphs(workspaceRoot string) {
+	storageRoot, err := ProjectStorageRoot(workspaceRoot)
+	if err != nil {
+		return
+	}
+	dir := filepath.Join(storageRoot, turnGraphsDir)
+	entries, err := os.ReadDir(dir)
+	if err != nil || len(entries) <= maxTurnGraphs {
+		return
+	}
+	type graphFile struct {
+		name string
+		mod  time.Time
+	}
+	files := make([]graphFile, 0, len(entries))
+	for _, entry := range entries {
+		if info, err := entry.Info(); err == nil {
+			files = append(files, graphFile{entry.Name(), info.ModTime()})
+		}
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].mod.Before(files[j].mod) })
+	for _, f := range files[:max(len(files)-maxTurnGraphs, 0)] {
+		os.Remove(filepath.Join(dir, f.name))
+	}
+}
+
+// handleTurnGraph serves GET /api/turns/<id>/graph: the tool calls of a
+// turn and how they relate.
+func (s *webServer) handleTurnGraph(w http.ResponseWriter, r *http.Request) {
+	turnID, ok := strings.CutSuffix(strings.TrimPrefix(r.URL.Path, "/api/turns/"), "/graph")
+	if !ok || turnID == "" || strings.Contains(turnID, "/") {
+		s.respondError(w, r, http.StatusNotFound, "not found")
+		return
+	}
+	if r.Method != http.MethodGet {
+		s.respondError(w, r, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	workspace := s.getWorkspaceFromRequest(r)
+	if workspace == "" || !s.workspaceExists(workspace) {
+		s.respondError(w, r, http.StatusBadRequest, "select a workspace first")
+		return
+	}
+	wsCtx, err := s.agent.GetOrCreateWorkspaceContext(workspace)
+	if err != nil {
+		s.respondError(w, r, http.StatusInternalServerError, fmt.Sprintf("get workspace context: %v", err))
+		return
+	}
+	path, err := turnGraphPath(wsCtx.root, turnID)
+	if err != nil {
+		s.respondError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		s.respondError(w, r, http.StatusNotFound, "no tool calls recorded for this turn")
+		return
+	}
+	if err != nil {
+		s.respondError(w, r, http.StatusInternalServerError, fmt.Sprintf("read turn graph: %v", err))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
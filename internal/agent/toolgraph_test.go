@@ -0,0 +1,83 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"cando/internal/llm"
+	"cando/internal/state"
+)
+
+func TestTurnGraph(t *testing.T) {
+	configDir := t.TempDir()
+	t.Setenv("CANDO_CONFIG_DIR", configDir)
+	workspace := t.TempDir()
+	if err := os.WriteFile(filepath.Join(workspace, "a.txt"), []byte("one\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	client := newScriptedClient(
+		callReply("read_file", `{"path":"a.txt"}`),
+		callReply("write_file", `{"path":"a.txt","content":"two\n"}`),
+		callReply("shell", `{"command":"sh -c 'exit 3'"}`),
+		callReply("read_file", `{"path":"a.txt"}`),
+		llm.ChatResponse{Choices: []llm.ChatChoice{{Message: state.Message{Role: "assistant", Content: "done"}, FinishReason: "stop"}}},
+	)
+	agent := newTestAgent(t, client, baseTestConfig(workspace))
+	if err := agent.RunOneShot(context.Background(), "fix a.txt"); err != nil {
+		t.Fatal(err)
+	}
+	var turnID string
+	for _, msg := range agent.states.Current().Messages() {
+		turnID = msg.TurnID
+	}
+
+	manager := &WorkspaceManager{filePath: filepath.Join(configDir, "workspaces.json")}
+	if _, err := manager.Add(workspace); err != nil {
+		t.Fatal(err)
+	}
+	s := &webServer{agent: agent, logger: log.New(io.Discard, "", 0), workspaceManager: manager}
+	rec := httptest.NewRecorder()
+	s.handleTurnGraph(rec, httptest.NewRequest(http.MethodGet, "/api/turns/"+turnID+"/graph?workspace="+workspace, nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("graph = %d %s", rec.Code, rec.Body.String())
+	}
+	var graph turnGraph
+	if err := json.Unmarshal(rec.Body.Bytes(), &graph); err != nil {
+		t.Fatal(err)
+	}
+	if graph.Prompt != "fix a.txt" || graph.Finished == nil || len(graph.Nodes) != 4 {
+		t.Fatalf("graph = %+v", graph)
+	}
+	shell := graph.Nodes[2]
+	if shell.Round != 3 || shell.Status != "error" || shell.ExitCode == nil || *shell.ExitCode != 3 {
+		t.Errorf("shell node = %+v", shell)
+	}
+	id := func(i int) string { return graph.Nodes[i].ID }
+	want := map[toolEdge]bool{
+		{From: id(0), To: id(1), Kind: edgeReadBeforeEdit, Path: "a.txt"}: true,
+		{From: id(1), To: id(2), Kind: edgeCommandAfterEdit}:              true,
+		{From: id(2), To: id(3), Kind: edgeAfterFailure}:                  true,
+	}
+	for _, edge := range graph.Edges {
+		if !want[edge] {
+			t.Errorf("unexpected edge %+v", edge)
+		}
+		delete(want, edge)
+	}
+	for edge := range want {
+		t.Errorf("missing edge %+v", edge)
+	}
+
+	rec = httptest.NewRecorder()
+	s.handleTurnGraph(rec, httptest.NewRequest(http.MethodGet, "/api/turns/turn-unknown/graph?workspace="+workspace, nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("unknown turn = %d", rec.Code)
+	}
+}
@@ -0,0 +1,80 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"cando/internal/config"
+	"cando/internal/state"
+)
+
+const turnWrapUpHint = "TIME BUDGET REACHED: this turn has used its time limit. Do not start new exploration or tool calls. " +
+	"Reply now with what you have: the results so far, what remains unfinished, and the next steps."
+
+// TurnTimeLimitError ends a turn that kept running past its budget and
+// grace period.
+type TurnTimeLimitError struct {
+	Limit time.Duration
+}
+
+func (e *TurnTimeLimitError) Error() string {
+	return fmt.Sprintf("turn stopped: exceeded its %s time limit", e.Limit)
+}
+
+// turnBudget tracks a turn's wall-clock budget. Once the budget is spent the
+// model is asked to wrap up; after the grace period the turn's context is
+// cancelled.
+type turnBudget struct {
+	limit  time.Duration
+	grace  time.Duration
+	start  time.Time
+	wrapUp bool // Model has been asked to wrap up
+}
+
+func newTurnBudget(cfg config.Config) *turnBudget {
+	return &turnBudget{limit: cfg.TurnTimeLimit(), grace: cfg.TurnGrace(), start: time.Now()}
+}
+
+// withDeadline applies the hard stop to ctx.
+func (b *turnBudget) withDeadline(ctx context.Context) (context.Context, context.CancelFunc) {
+	if b.limit <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithDeadline(ctx, b.start.Add(b.limit+b.grace))
+}
+
+// spent reports whether the budget has elapsed.
+func (b *turnBudget) spent(now time.Time) bool {
+	return b.limit > 0 && now.Sub(b.start) >= b.limit
+}
+
+// prepare asks the model to wrap up once the budget is spent, emitting a
+// status event the first time.
+func (b *turnBudget) prepare(messages []state.Message, callback StreamCallback, logf func(string, ...any)) []state.Message {
+	if !b.spent(time.Now()) {
+		return messages
+	}
+	if !b.wrapUp {
+		b.wrapUp = true
+		logf("[agent] turn time limit (%s) reached; asking model to wrap up", b.limit)
+		if callback != nil {
+			callback("status", map[string]any{
+				"message": fmt.Sprintf("Time limit (%s) reached, asking the model to wrap up. Hard stop in %s.", b.limit, b.grace),
+			})
+		}
+	}
+	result := make([]state.Message, len(messages), len(messages)+1)
+	copy(result, messages)
+	return append(result, state.Message{Role: "user", Content: turnWrapUpHint})
+}
+
+// stopped returns the time limit error when ctx ended because of the hard
+// stop.
+func (b *turnBudget) stopped(ctx context.Context) error {
+	if b.limit > 0 && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return &TurnTimeLimitError{Limit: b.limit}
+	}
+	return nil
+}
@@ -0,0 +1,48 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"cando/internal/state"
+)
+
+func TestTurnBudgetWrapsUpThenStops(t *testing.T) {
+	budget := &turnBudget{limit: 20 * time.Millisecond, grace: 20 * time.Millisecond, start: time.Now()}
+	ctx, cancel := budget.withDeadline(context.Background())
+	defer cancel()
+
+	var statuses int
+	callback := func(event string, _ any) error {
+		if event == "status" {
+			statuses++
+		}
+		return nil
+	}
+	logf := func(string, ...any) {}
+	messages := []state.Message{{Role: "user", Content: "explore"}}
+
+	if got := budget.prepare(messages, callback, logf); len(got) != 1 {
+		t.Fatalf("wrap-up hint injected before the budget was spent")
+	}
+	time.Sleep(25 * time.Millisecond)
+	got := budget.prepare(messages, callback, logf)
+	if len(got) != 2 || got[1].Content != turnWrapUpHint {
+		t.Fatalf("expected wrap-up hint, got %+v", got)
+	}
+	budget.prepare(messages, callback, logf)
+	if statuses != 1 {
+		t.Fatalf("expected one status event, got %d", statuses)
+	}
+	if budget.stopped(ctx) != nil {
+		t.Fatalf("stopped before the grace period ended")
+	}
+
+	<-ctx.Done()
+	var limitErr *TurnTimeLimitError
+	if !errors.As(budget.stopped(ctx), &limitErr) {
+		t.Fatalf("expected TurnTimeLimitError after grace period")
+	}
+}
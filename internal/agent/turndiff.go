@@ -0,0 +1,336 @@
+package agent
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	turnChangesDir = "turn_changes"
+	// maxSnapshotBytes bounds the original content kept per file; larger
+	// files are reported without line counts and cannot be reverted.
+	maxSnapshotBytes = 1 << 20
+	// maxDiffCells caps the exact line diff; beyond it counts are estimated.
+	maxDiffCells = 4_000_000
+	gitTimeout   = 5 * time.Second
+)
+
+// fileChange is one file in a turn summary.
+type fileChange struct {
+	Path       string `json:"path"`   // Workspace-relative, slash-separated
+	Status     string `json:"status"` // added | modified | deleted
+	Insertions int    `json:"insertions"`
+	Deletions  int    `json:"deletions"`
+	Source     string `json:"source"` // tool | shell
+	Binary     bool   `json:"binary,omitempty"`
+	Resolution string `json:"resolution,omitempty"` // accepted | reverted, set via /api/changes
+}
+
+// turnSummary is the aggregate diff of one turn, emitted as a
+// "turn_summary" event and kept with the session.
+type turnSummary struct {
+	TurnID     string       `json:"turn_id,omitempty"`
+	Session    string       `json:"session"`
+	Time       time.Time    `json:"time"`
+	Files      []fileChange `json:"files"`
+	Insertions int          `json:"insertions"`
+	Deletions  int          `json:"deletions"`
+	Commands   []string     `json:"commands,omitempty"`
+}
+
+// fileSnapshot is a file's content before the turn first touched it.
+type fileSnapshot struct {
+	Path     string `json:"path"`
+	Existed  bool   `json:"existed"`
+	Content  []byte `json:"content,omitempty"`
+	TooLarge bool   `json:"too_large,omitempty"`
+	// Git marks files changed by shell commands: they were clean before
+	// the turn, so the original is the committed version.
+	Git bool `json:"git,omitempty"`
+	// AfterHash identifies the content the turn left behind, so a revert
+	// does not silently discard later edits.
+	AfterHash string `json:"after_hash,omitempty"`
+}
+
+// turnChanges is the persisted record of a session's latest turn.
+// Snapshots[i] holds the original of Summary.Files[i].
+type turnChanges struct {
+	Summary   turnSummary     `json:"summary"`
+	Snapshots []*fileSnapshot `json:"snapshots"`
+}
+
+// editedPaths returns the files an edit tool call is about to modify.
+func editedPaths(function string, args map[string]any) []string {
+	switch function {
+	case "edit_file", "write_file":
+		if path, _ := args["path"].(string); path != "" {
+			return []string{path}
+		}
+	case "apply_patch":
+		patch, _ := args["patch"].(string)
+		return patchFilePaths(patch)
+	case "delete_path":
+		action, _ := args["action"].(string)
+		if path, _ := args["path"].(string); path != "" && (action == "" || action == "delete") {
+			return []string{path}
+		}
+	case "rename_path":
+		// Both ends, so the move shows as a delete and an add and can be reverted
+		from, _ := args["from"].(string)
+		to, _ := args["to"].(string)
+		if from != "" && to != "" {
+			return []string{from, to}
+		}
+	case "notebook":
+		if action, _ := args["action"].(string); action != "read" {
+			if path, _ := args["path"].(string); path != "" {
+				return []string{path}
+			}
+		}
+	}
+	return nil
+}
+
+// takeSnapshot records the current content of a workspace file.
+func takeSnapshot(root, rel string) *fileSnapshot {
+	snap := &fileSnapshot{Path: rel}
+	abs := filepath.Join(root, filepath.FromSlash(rel))
+	info, err := os.Stat(abs)
+	if err != nil || !info.Mode().IsRegular() {
+		return snap
+	}
+	snap.Existed = true
+	if info.Size() > maxSnapshotBytes {
+		snap.TooLarge = true
+		return snap
+	}
+	if data, err := os.ReadFile(abs); err == nil {
+		snap.Content = data
+	} else {
+		snap.TooLarge = true
+	}
+	return snap
+}
+
+// diffSnapshot compares a snapshot with the file on disk. ok is false when
+// the file is unchanged.
+func diffSnapshot(root string, snap *fileSnapshot) (fileChange, bool) {
+	change := fileChange{Path: snap.Path, Source: "tool"}
+	if snap.Git {
+		change.Source = "shell"
+	}
+	abs := filepath.Join(root, filepath.FromSlash(snap.Path))
+	current, err := os.ReadFile(abs)
+	exists := err == nil
+	switch {
+	case !snap.Existed && !exists:
+		return change, false
+	case !snap.Existed:
+		change.Status = "added"
+	case !exists:
+		change.Status = "deleted"
+	default:
+		change.Status = "modified"
+	}
+	snap.AfterHash = contentHash(current, exists)
+	if snap.TooLarge {
+		return change, true
+	}
+	if exists && snap.Existed && bytes.Equal(current, snap.Content) {
+		return change, false
+	}
+	if isBinary(snap.Content) || isBinary(current) {
+		change.Binary = true
+		return change, true
+	}
+	change.Insertions, change.Deletions = lineDiffStats(splitLines(snap.Content), splitLines(current))
+	return change, true
+}
+
+// contentHash fingerprints file content; missing files hash to "absent".
+func contentHash(data []byte, exists bool) string {
+	if !exists {
+		return "absent"
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func isBinary(data []byte) bool {
+	return bytes.IndexByte(data[:min(len(data), 8000)], 0) >= 0
+}
+
+func splitLines(data []byte) []string {
+	if len(data) == 0 {
+		return nil
+	}
+	lines := strings.SplitAfter(string(data), "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// lineDiffStats counts inserted and deleted lines between two versions
+// using the longest common subsequence, falling back to a multiset
+// comparison when the files are too large for the exact method.
+func lineDiffStats(before, after []string) (insertions, deletions int) {
+	// Trim the common prefix and suffix, which covers most edits cheaply
+	for len(before) > 0 && len(after) > 0 && before[0] == after[0] {
+		before, after = before[1:], after[1:]
+	}
+	for len(before) > 0 && len(after) > 0 && before[len(before)-1] == after[len(after)-1] {
+		before, after = before[:len(before)-1], after[:len(after)-1]
+	}
+	if len(before) == 0 || len(after) == 0 {
+		return len(after), len(before)
+	}
+	if len(before)*len(after) > maxDiffCells {
+		counts := make(map[string]int, len(before))
+		for _, line := range before {
+			counts[line]++
+		}
+		common := 0
+		for _, line := range after {
+			if counts[line] > 0 {
+				counts[line]--
+				common++
+			}
+		}
+		return len(after) - common, len(before) - common
+	}
+	prev := make([]int, len(after)+1)
+	cur := make([]int, len(after)+1)
+	for i := range before {
+		for j := range after {
+			if before[i] == after[j] {
+				cur[j+1] = prev[j] + 1
+			} else {
+				cur[j+1] = max(cur[j], prev[j+1])
+			}
+		}
+		prev, cur = cur, prev
+	}
+	common := prev[len(after)]
+	return len(after) - common, len(before) - common
+}
+
+// gitDirtyFiles returns `git status --porcelain` codes for the files under
+// root, keyed by path relative to root, or nil when root is not inside a git
+// work tree.
+func gitDirtyFiles(root string) map[string]string {
+	ctx, cancel := context.WithTimeout(context.Background(), gitTimeout)
+	defer cancel()
+	// Porcelain paths are relative to the repository root, which may sit
+	// above the workspace
+	prefix, err := exec.CommandContext(ctx, "git", "-C", root, "rev-parse", "--show-prefix").Output()
+	if err != nil {
+		return nil
+	}
+	out, err := exec.CommandContext(ctx, "git", "-C", root, "status", "--porcelain", "-z", "--untracked-files=all", "--", ".").Output()
+	if err != nil {
+		return nil
+	}
+	repoPrefix := strings.TrimSpace(string(prefix))
+	files := make(map[string]string)
+	entries := strings.Split(string(out), "\x00")
+	for i := 0; i < len(entries); i++ {
+		entry := entries[i]
+		if len(entry) < 4 {
+			continue
+		}
+		code, path := entry[:2], entry[3:]
+		if code[0] == 'R' || code[0] == 'C' {
+			i++ // The original path follows a rename
+		}
+		files[strings.TrimPrefix(path, repoPrefix)] = code
+	}
+	return files
+}
+
+// gitHeadContent returns a file's committed content; ok is false when the
+// file is not in HEAD.
+func gitHeadContent(root, rel string) ([]byte, bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), gitTimeout)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, "git", "-C", root, "show", "HEAD:./"+rel).Output()
+	if err != nil {
+		return nil, false
+	}
+	return out, true
+}
+
+// shellSnapshots returns snapshots for files that were clean before the
+// turn and are dirty after it, i.e. changed by commands rather than by the
+// edit tools already tracked.
+func shellSnapshots(root string, before map[string]string, tracked map[string]bool) []*fileSnapshot {
+	after := gitDirtyFiles(root)
+	var snaps []*fileSnapshot
+	for path, code := range after {
+		if _, wasDirty := before[path]; wasDirty || tracked[path] {
+			continue
+		}
+		snap := &fileSnapshot{Path: path, Git: true}
+		if code != "??" {
+			snap.Content, snap.Existed = gitHeadContent(root, path)
+			snap.TooLarge = len(snap.Content) > maxSnapshotBytes
+			if snap.TooLarge {
+				snap.Content = nil
+			}
+		}
+		snaps = append(snaps, snap)
+	}
+	return snaps
+}
+
+func turnChangesPath(workspaceRoot, session string) (string, error) {
+	storageRoot, err := ProjectStorageRoot(workspaceRoot)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(storageRoot, turnChangesDir, generateSlug(session)+".json"), nil
+}
+
+// saveTurnChanges replaces the session's latest turn record.
+func saveTurnChanges(workspaceRoot string, changes turnChanges) error {
+	path, err := turnChangesPath(workspaceRoot, changes.Summary.Session)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	data, err := json.Marshal(changes)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0o644)
+}
+
+// loadTurnChanges returns the session's latest turn record, if any.
+func loadTurnChanges(workspaceRoot, session string) (*turnChanges, error) {
+	path, err := turnChangesPath(workspaceRoot, session)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var changes turnChanges
+	if err := json.Unmarshal(data, &changes); err != nil {
+		return nil, err
+	}
+	return &changes, nil
+}
@@ -0,0 +1,117 @@
+package agent
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func TestLineDiffStats(t *testing.T) {
+	cases := []struct {
+		before, after string
+		ins, del      int
+	}{
+		{"a\nb\nc\n", "a\nb\nc\n", 0, 0},
+		{"a\nb\nc\n", "a\nx\nc\n", 1, 1},
+		{"a\nb\n", "a\nb\nc\nd\n", 2, 0},
+		{"a\nb\nc\nd\n", "b\nd\n", 0, 2},
+		{"", "new\nfile\n", 2, 0},
+		{"a\nb\nc\n", "c\nb\na\n", 2, 2},
+	}
+	for _, tc := range cases {
+		ins, del := lineDiffStats(splitLines([]byte(tc.before)), splitLines([]byte(tc.after)))
+		if ins != tc.ins || del != tc.del {
+			t.Errorf("%q -> %q = +%d -%d, want +%d -%d", tc.before, tc.after, ins, del, tc.ins, tc.del)
+		}
+	}
+}
+
+func TestDiffSnapshot(t *testing.T) {
+	root := t.TempDir()
+	write := func(name, content string) {
+		if err := os.WriteFile(filepath.Join(root, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("edited.go", "package x\n\nfunc A() {}\n")
+	write("removed.txt", "one\ntwo\n")
+	write("same.txt", "same\n")
+	edited := takeSnapshot(root, "edited.go")
+	removed := takeSnapshot(root, "removed.txt")
+	same := takeSnapshot(root, "same.txt")
+	added := takeSnapshot(root, "added.txt")
+
+	write("edited.go", "package x\n\nfunc A() {}\n\nfunc B() {}\n")
+	write("added.txt", "hello\n")
+	if err := os.Remove(filepath.Join(root, "removed.txt")); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[*fileSnapshot]fileChange{
+		edited:  {Path: "edited.go", Status: "modified", Insertions: 2, Source: "tool"},
+		removed: {Path: "removed.txt", Status: "deleted", Deletions: 2, Source: "tool"},
+		added:   {Path: "added.txt", Status: "added", Insertions: 1, Source: "tool"},
+	}
+	for snap, expected := range want {
+		got, ok := diffSnapshot(root, snap)
+		if !ok || got != expected {
+			t.Errorf("diff %s = %+v (%v), want %+v", snap.Path, got, ok, expected)
+		}
+	}
+	if _, ok := diffSnapshot(root, same); ok {
+		t.Error("unchanged file reported as changed")
+	}
+}
+
+func TestShellSnapshotsFromGit(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	root := t.TempDir()
+	run := func(args ...string) {
+		cmd := exec.Command("git", append([]string{"-C", root, "-c", "user.name=t", "-c", "user.email=t@example.com"}, args...)...)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, out)
+		}
+	}
+	run("init", "-q")
+	if err := os.WriteFile(filepath.Join(root, "tracked.txt"), []byte("v1\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "dirty.txt"), []byte("v1\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	run("add", ".")
+	run("commit", "-q", "-m", "init")
+	if err := os.WriteFile(filepath.Join(root, "dirty.txt"), []byte("local edit\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	before := gitDirtyFiles(root)
+	if before == nil || before["dirty.txt"] == "" {
+		t.Fatalf("dirty files before = %v", before)
+	}
+	// A command rewrites a clean file, creates one and touches an already dirty one
+	os.WriteFile(filepath.Join(root, "tracked.txt"), []byte("v2\nmore\n"), 0o644)
+	os.WriteFile(filepath.Join(root, "generated.txt"), []byte("out\n"), 0o644)
+	os.WriteFile(filepath.Join(root, "dirty.txt"), []byte("again\n"), 0o644)
+
+	snaps := shellSnapshots(root, before, map[string]bool{})
+	got := make(map[string]fileChange)
+	for _, snap := range snaps {
+		change, ok := diffSnapshot(root, snap)
+		if ok {
+			got[snap.Path] = change
+		}
+	}
+	if len(got) != 2 {
+		t.Fatalf("shell changes = %+v, want tracked.txt and generated.txt", got)
+	}
+	if c := got["tracked.txt"]; c.Status != "modified" || c.Insertions != 2 || c.Deletions != 1 || c.Source != "shell" {
+		t.Errorf("tracked.txt = %+v", c)
+	}
+	if c := got["generated.txt"]; c.Status != "added" || c.Insertions != 1 {
+		t.Errorf("generated.txt = %+v", c)
+	}
+}
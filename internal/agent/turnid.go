@@ -0,0 +1,29 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"time"
+)
+
+type turnIDKey struct{}
+
+// newTurnID returns a unique identifier for an accepted prompt.
+func newTurnID() string {
+	return fmt.Sprintf("turn-%d-%04x", time.Now().UnixNano(), rand.IntN(0x10000))
+}
+
+// withTurnID carries a turn ID assigned by the transport into the agent so
+// events and persisted messages share it.
+func withTurnID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, turnIDKey{}, id)
+}
+
+// turnIDFrom returns the turn ID carried by ctx, or a new one.
+func turnIDFrom(ctx context.Context) string {
+	if id, ok := ctx.Value(turnIDKey{}).(string); ok && id != "" {
+		return id
+	}
+	return newTurnID()
+}
@@ -0,0 +1,38 @@
+package agent
+
+import (
+	"context"
+	"testing"
+
+	"cando/internal/llm"
+	"cando/internal/state"
+)
+
+func TestTurnIDStampedOnPersistedMessages(t *testing.T) {
+	t.Setenv("CANDO_CONFIG_DIR", t.TempDir())
+	client := newScriptedClient(
+		llm.ChatResponse{Choices: []llm.ChatChoice{{Message: state.Message{Role: "assistant", Content: "first"}}}},
+		llm.ChatResponse{Choices: []llm.ChatChoice{{Message: state.Message{Role: "assistant", Content: "second"}}}},
+	)
+	agent := newTestAgent(t, client, baseTestConfig(t.TempDir()))
+
+	if _, _, err := agent.respond(withTurnID(context.Background(), "turn-a"), "one"); err != nil {
+		t.Fatalf("respond: %v", err)
+	}
+	if _, _, err := agent.respond(context.Background(), "two"); err != nil {
+		t.Fatalf("respond: %v", err)
+	}
+
+	var ids []string
+	for _, msg := range agent.states.Current().Messages() {
+		if msg.Role != "system" {
+			ids = append(ids, msg.TurnID)
+		}
+	}
+	if len(ids) != 4 || ids[0] != "turn-a" || ids[1] != "turn-a" {
+		t.Fatalf("expected first turn's messages tagged turn-a, got %v", ids)
+	}
+	if ids[2] == "" || ids[2] == "turn-a" || ids[3] != ids[2] {
+		t.Fatalf("expected a fresh shared ID for the second turn, got %v", ids)
+	}
+}
@@ -0,0 +1,132 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"cando/internal/tooling"
+)
+
+// turnSubmission is a prompt sent over /api/stream, /api/ws or the gRPC
+// control API. All three go through submitTurn and runTurn so they share
+// the workspace lock, the prompt queue, idempotency keys and replay.
+type turnSubmission struct {
+	r         *http.Request // Names the request in error logs; nil for gRPC
+	workspace string
+	content   string
+	key       string // Idempotency key
+	pins      *tooling.PinnedFiles
+	clientID  string // Workspace lock holder
+	label     string
+	takeover  bool // Take the workspace lock from another tab
+}
+
+// submittedTurn is an accepted submission: queued behind the running turn,
+// or a turn whose events are buffered in stream for runTurn to run.
+type submittedTurn struct {
+	queued   bool
+	item     queuedPrompt
+	position int
+
+	sub       turnSubmission
+	wsCtx     *WorkspaceContext
+	turnID    string
+	session   string
+	stream    *turnStream
+	duplicate bool   // The session already received the idempotency key
+	endTurn   func() // Releases the busy mark taken by submitTurn
+}
+
+// submitError is a rejected submission with the status /api/stream answers
+// it with.
+type submitError struct {
+	status  int
+	message string
+}
+
+func (e *submitError) Error() string {
+	return e.message
+}
+
+// submitTurn claims the workspace lock, queues the prompt when a turn is
+// running or prompts are waiting, and otherwise starts a turn stream. The
+// busy check and the start happen under the context's submit lock, so two
+// submissions cannot both find the workspace idle. Unless the result is
+// queued, the caller must pass it to runTurn.
+func (s *webServer) submitTurn(wsCtx *WorkspaceContext, sub turnSubmission) (submittedTurn, error) {
+	if s.locks != nil {
+		held, ok := s.locks.claim(sub.workspace, sub.clientID, sub.label, sub.takeover, time.Now())
+		if !ok {
+			idle := time.Since(held.LastSeen).Round(time.Second)
+			return submittedTurn{}, &submitError{http.StatusLocked, fmt.Sprintf("this workspace is in use in another tab (active %s ago)", idle)}
+		}
+	}
+
+	wsCtx.submitMu.Lock()
+	defer wsCtx.submitMu.Unlock()
+
+	// Follow-ups sent while a turn runs wait their turn instead of failing
+	item, position, queued, err := s.queuePromptIfBusy(wsCtx, sub.content, sub.key, sub.pins)
+	if err != nil {
+		return submittedTurn{}, &submitError{http.StatusConflict, err.Error()}
+	}
+	if queued {
+		return submittedTurn{queued: true, item: item, position: position}, nil
+	}
+
+	// Drop resubmissions of a prompt this session already received
+	session := wsCtx.states.Current().Key()
+	duplicateStatus, isNew := s.submissions.begin(sub.workspace, session, sub.key)
+	if !isNew && duplicateStatus == submissionRunning {
+		return submittedTurn{}, &submitError{http.StatusConflict, "this prompt is already running"}
+	}
+	turnID := newTurnID()
+	t := submittedTurn{
+		sub:       sub,
+		wsCtx:     wsCtx,
+		turnID:    turnID,
+		session:   session,
+		stream:    s.streams.start(turnID, wsCtx.root),
+		duplicate: !isNew,
+		endTurn:   func() {},
+	}
+	if isNew {
+		t.endTurn = wsCtx.beginTurn()
+	}
+	return t, nil
+}
+
+// runTurn runs a turn started by submitTurn, buffering every event for
+// replay and handing it to deliver, which may be nil. The turn outlives
+// clientCtx for a grace period so a dropped client can reconnect.
+func (s *webServer) runTurn(clientCtx context.Context, t submittedTurn, deliver func(seq int, payload []byte)) error {
+	sendEvent := func(eventType string, data any) error {
+		seq, payload, err := s.recordEvent(t.sub.r, t.stream, eventType, data)
+		if err != nil {
+			return err
+		}
+		if deliver != nil {
+			deliver(seq, payload)
+		}
+		return nil
+	}
+	if t.duplicate {
+		sendEvent("complete", map[string]string{"status": "duplicate"})
+		t.stream.finish()
+		return nil
+	}
+
+	turnCtx, cancelTurn := context.WithCancel(withUserPins(context.WithoutCancel(clientCtx), t.sub.pins))
+	defer cancelTurn()
+	go t.stream.keepAlive(clientCtx, cancelTurn)
+	sendEvent("turn_started", map[string]any{"turn_id": t.turnID, "session": t.session})
+
+	err := s.executeTurn(turnCtx, t.sub.r, t.wsCtx, t.sub.content, t.turnID, sendEvent)
+	s.submissions.finish(t.sub.workspace, t.session, t.sub.key, err)
+	t.stream.finish()
+	t.endTurn()
+	s.advancePrompts(t.wsCtx) // After the stream has finished
+	return err
+}
@@ -0,0 +1,42 @@
+package agent
+
+import (
+	"io"
+	"log"
+	"path/filepath"
+	"testing"
+)
+
+func TestSubmitTurnMarksWorkspaceBusyBeforeItRuns(t *testing.T) {
+	configDir := t.TempDir()
+	t.Setenv("CANDO_CONFIG_DIR", configDir)
+	workspace := t.TempDir()
+	s := &webServer{
+		agent:            newTestAgent(t, newScriptedClient(), baseTestConfig(workspace)),
+		logger:           log.New(io.Discard, "", 0),
+		workspaceManager: &WorkspaceManager{filePath: filepath.Join(configDir, "workspaces.json")},
+		submissions:      newIdempotencyStore(),
+		streams:          newTurnStreams(),
+		prompts:          newPromptQueues(),
+	}
+	wsCtx, err := s.agent.GetOrCreateWorkspaceContext(workspace)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first, err := s.submitTurn(wsCtx, turnSubmission{workspace: workspace, content: "one", clientID: "grpc"})
+	if err != nil || first.queued {
+		t.Fatalf("first submission: %+v, %v", first, err)
+	}
+	// The first turn has not started its provider call yet
+	second, err := s.submitTurn(wsCtx, turnSubmission{workspace: workspace, content: "two", clientID: "grpc"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !second.queued || second.position != 1 {
+		t.Fatalf("second submission = %+v, want queued at position 1", second)
+	}
+	s.prompts.remove(wsCtx.root, second.item.Session, second.item.ID)
+	first.endTurn()
+	first.stream.finish()
+}
@@ -0,0 +1,345 @@
+package agent
+
+import (
+	"archive/zip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"cando/internal/tooling"
+)
+
+// maxZipEntries bounds how many files one uploaded zip may extract.
+const maxZipEntries = 10000
+
+var (
+	errUploadTooLarge = errors.New("upload too large; raise web.max_upload_mb")
+	errUploadPath     = errors.New("path outside the workspace")
+	errBadZip         = errors.New("not a valid zip archive")
+)
+
+// uploadStatus maps an upload failure to its HTTP status.
+func uploadStatus(err error) int {
+	var maxBytes *http.MaxBytesError
+	switch {
+	case errors.As(err, &maxBytes), errors.Is(err, errUploadTooLarge):
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(err, fs.ErrExist):
+		return http.StatusConflict
+	case errors.Is(err, errUploadPath):
+		return http.StatusForbidden
+	case errors.Is(err, errBadZip), errors.Is(err, zip.ErrChecksum), errors.Is(err, zip.ErrFormat):
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
+// fileUpload is one POST to /api/files/upload.
+type fileUpload struct {
+	root          string // Workspace root
+	dir           string // Target directory, relative to root
+	overwrite     bool
+	allowExternal bool
+	limit         int64 // Bytes left of web.max_upload_mb
+
+	files []string // Written paths, relative to root
+}
+
+// handleFilesUpload stores the files of a multipart/form-data body in the
+// workspace. Query parameters: workspace, dir (target directory, default
+// the root), unzip=true to extract .zip files into dir, and overwrite=true
+// to replace existing files. Every path goes through the workspace guard.
+func (s *webServer) handleFilesUpload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		s.respondError(w, r, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	workspace := s.getWorkspaceFromRequest(r)
+	if workspace == "" {
+		s.respondError(w, r, http.StatusBadRequest, "workspace required")
+		return
+	}
+	query := r.URL.Query()
+	dir := strings.Trim(filepath.ToSlash(query.Get("dir")), "/")
+	target, ok := s.workspaceFilePath(w, r, workspace, dir, true)
+	if !ok {
+		return
+	}
+	if info, err := os.Stat(target); err == nil && !info.IsDir() {
+		s.respondError(w, r, http.StatusBadRequest, fmt.Sprintf("%s is not a directory", dir))
+		return
+	}
+	cfg := s.agent.cfg.Load()
+	limit := cfg.Web.MaxUploadBytes()
+	if r.ContentLength > limit {
+		s.respondError(w, r, http.StatusRequestEntityTooLarge, errUploadTooLarge.Error())
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, limit)
+	reader, err := r.MultipartReader()
+	if err != nil {
+		s.respondError(w, r, http.StatusBadRequest, "expected a multipart/form-data body")
+		return
+	}
+
+	upload := &fileUpload{
+		root:          workspace,
+		dir:           dir,
+		overwrite:     query.Get("overwrite") == "true",
+		allowExternal: cfg.AllowExternalSymlinks,
+		limit:         limit,
+	}
+	unzip := query.Get("unzip") == "true"
+	var total int64
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			status := uploadStatus(err)
+			if status == http.StatusInternalServerError {
+				status = http.StatusBadRequest
+			}
+			s.respondError(w, r, status, fmt.Sprintf("read upload: %v", err))
+			return
+		}
+		name := part.FileName()
+		if name == "" || name == "." || name == string(filepath.Separator) {
+			part.Close()
+			continue
+		}
+		var n int64
+		if unzip && strings.EqualFold(path.Ext(name), ".zip") {
+			n, err = upload.extractZip(name, part)
+		} else {
+			n, err = upload.saveFile(name, part)
+		}
+		part.Close()
+		if err != nil {
+			s.respondError(w, r, uploadStatus(err), err.Error())
+			return
+		}
+		total += n
+	}
+	if len(upload.files) == 0 {
+		s.respondError(w, r, http.StatusBadRequest, "no files in upload")
+		return
+	}
+
+	where := dir
+	if where == "" {
+		where = "the workspace root"
+	}
+	recordActivity(workspace, activityEntry{
+		Kind:    activityFilesUploaded,
+		Summary: fmt.Sprintf("Uploaded %d file(s) to %s", len(upload.files), where),
+		Details: map[string]any{"files": upload.files, "bytes": total},
+	}, s.logger)
+	s.writeJSON(w, r, map[string]any{
+		"status": "uploaded",
+		"files":  upload.files,
+		"bytes":  total,
+	})
+}
+
+// resolve checks rel, relative to the target directory, against the
+// workspace guard and returns its absolute path and workspace-relative name.
+func (u *fileUpload) resolve(rel string) (string, string, error) {
+	rel = path.Join(u.dir, rel)
+	abs, err := tooling.ResolveWithin(u.root, rel, u.allowExternal)
+	if err != nil {
+		return "", "", fmt.Errorf("%s: %w: %v", rel, errUploadPath, err)
+	}
+	return abs, rel, nil
+}
+
+// checkTarget refuses to replace a directory, or an existing file unless
+// overwrite is set.
+func (u *fileUpload) checkTarget(abs, rel string) error {
+	info, err := os.Lstat(abs)
+	if err != nil {
+		return nil
+	}
+	if info.IsDir() {
+		return fmt.Errorf("%s is a directory: %w", rel, fs.ErrExist)
+	}
+	if !u.overwrite {
+		return fmt.Errorf("%s already exists; upload with overwrite=true to replace it: %w", rel, fs.ErrExist)
+	}
+	return nil
+}
+
+// saveFile writes src to name in the target directory.
+func (u *fileUpload) saveFile(name string, src io.Reader) (int64, error) {
+	abs, rel, err := u.resolve(path.Base(filepath.ToSlash(name)))
+	if err != nil {
+		return 0, err
+	}
+	if err := u.checkTarget(abs, rel); err != nil {
+		return 0, err
+	}
+	n, err := u.write(abs, src)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", rel, err)
+	}
+	u.files = append(u.files, rel)
+	return n, nil
+}
+
+// uploadCopy copies an uploaded file to disk; tests swap it to inject
+// write failures.
+var uploadCopy = io.Copy
+
+// write stores src at abs through a temporary file, so a failed or
+// oversized upload never leaves a partial file behind.
+func (u *fileUpload) write(abs string, src io.Reader) (int64, error) {
+	tmp, n, err := u.stage(abs, src, nil)
+	if err != nil {
+		return 0, err
+	}
+	if err := os.Rename(tmp, abs); err != nil {
+		os.Remove(tmp)
+		return 0, err
+	}
+	return n, nil
+}
+
+// stage copies src to a temporary file next to abs and returns its name.
+// Directories it has to create are appended to *made, deepest last, when
+// made is not nil.
+func (u *fileUpload) stage(abs string, src io.Reader, made *[]string) (string, int64, error) {
+	dir := filepath.Dir(abs)
+	if made != nil {
+		var missing []string
+		for d := dir; ; d = filepath.Dir(d) {
+			if _, err := os.Lstat(d); err == nil || d == filepath.Dir(d) {
+				break
+			}
+			missing = append(missing, d)
+		}
+		slices.Reverse(missing)
+		*made = append(*made, missing...)
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", 0, err
+	}
+	tmp, err := os.CreateTemp(dir, ".cando-upload-*")
+	if err != nil {
+		return "", 0, err
+	}
+	n, err := uploadCopy(tmp, io.LimitReader(src, u.limit+1))
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil && n > u.limit {
+		err = errUploadTooLarge
+	}
+	if err == nil {
+		err = os.Chmod(tmp.Name(), 0o644)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return "", 0, err
+	}
+	u.limit -= n
+	return tmp.Name(), n, nil
+}
+
+// extractZip unpacks the zip in src into the target directory. Every entry
+// is checked first, so an archive that would escape the workspace, exceed
+// the size limit or clobber files writes nothing. Entries are then staged
+// in temporary files and only renamed into place once all of them are
+// written, so a failure partway leaves the directory as it was. Only
+// regular files are extracted; symlinks and other special entries are
+// skipped.
+func (u *fileUpload) extractZip(name string, src io.Reader) (written int64, err error) {
+	tmp, err := os.CreateTemp("", "cando-upload-*.zip")
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+	size, err := io.Copy(tmp, src)
+	if err != nil {
+		return 0, err
+	}
+	archive, err := zip.NewReader(tmp, size)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", name, errBadZip)
+	}
+
+	type entry struct {
+		file     *zip.File
+		abs, rel string
+		staged   string
+	}
+	var entries []entry
+	var total uint64
+	for _, f := range archive.File {
+		if !f.Mode().IsRegular() || strings.HasPrefix(f.Name, "__MACOSX/") {
+			continue
+		}
+		clean := path.Clean(strings.ReplaceAll(f.Name, `\`, "/"))
+		if path.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, "../") {
+			return 0, fmt.Errorf("%s: entry %s: %w", name, f.Name, errUploadPath)
+		}
+		abs, rel, err := u.resolve(clean)
+		if err != nil {
+			return 0, fmt.Errorf("%s: %w", name, err)
+		}
+		if err := u.checkTarget(abs, rel); err != nil {
+			return 0, err
+		}
+		total += f.UncompressedSize64
+		if total > uint64(u.limit) || len(entries) >= maxZipEntries {
+			return 0, fmt.Errorf("%s: %w", name, errUploadTooLarge)
+		}
+		entries = append(entries, entry{file: f, abs: abs, rel: rel})
+	}
+
+	var made []string
+	defer func() {
+		if err == nil {
+			return
+		}
+		for _, e := range entries {
+			if e.staged != "" {
+				os.Remove(e.staged)
+			}
+		}
+		for i := len(made) - 1; i >= 0; i-- {
+			os.Remove(made[i])
+		}
+	}()
+	for i := range entries {
+		e := &entries[i]
+		rc, err := e.file.Open()
+		if err != nil {
+			return 0, fmt.Errorf("%s: %s: %w", name, e.rel, errBadZip)
+		}
+		staged, n, err := u.stage(e.abs, rc, &made)
+		rc.Close()
+		if err != nil {
+			return 0, fmt.Errorf("%s: %s: %w", name, e.rel, err)
+		}
+		e.staged = staged
+		written += n
+	}
+	for i := range entries {
+		e := &entries[i]
+		if err := os.Rename(e.staged, e.abs); err != nil {
+			return 0, fmt.Errorf("%s: %s: %w", name, e.rel, err)
+		}
+		e.staged = ""
+		u.files = append(u.files, e.rel)
+	}
+	return written, nil
+}
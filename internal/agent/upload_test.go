@@ -0,0 +1,139 @@
+package agent
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"io"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"cando/internal/config"
+)
+
+func zipOf(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, content := range files {
+		fw, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fw.Write([]byte(content))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestFilesUpload(t *testing.T) {
+	configDir := t.TempDir()
+	t.Setenv("CANDO_CONFIG_DIR", configDir)
+	workspace := t.TempDir()
+	manager := &WorkspaceManager{filePath: filepath.Join(configDir, "workspaces.json")}
+	if _, err := manager.Add(workspace); err != nil {
+		t.Fatal(err)
+	}
+	s := &webServer{
+		agent:            &Agent{cfg: newRuntimeConfig(config.Config{Web: config.WebConfig{MaxUploadMB: 1}})},
+		logger:           log.New(io.Discard, "", 0),
+		workspaceManager: manager,
+	}
+	upload := func(query string, files map[string][]byte) *httptest.ResponseRecorder {
+		t.Helper()
+		var body bytes.Buffer
+		mw := multipart.NewWriter(&body)
+		for name, data := range files {
+			fw, err := mw.CreateFormFile("file", name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			fw.Write(data)
+		}
+		mw.Close()
+		req := httptest.NewRequest(http.MethodPost, "/api/files/upload?workspace="+workspace+"&"+query, &body)
+		req.Header.Set("Content-Type", mw.FormDataContentType())
+		rec := httptest.NewRecorder()
+		s.handleFilesUpload(rec, req)
+		return rec
+	}
+	read := func(rel string) string {
+		data, _ := os.ReadFile(filepath.Join(workspace, rel))
+		return string(data)
+	}
+
+	if rec := upload("dir=assets", map[string][]byte{"logo.svg": []byte("<svg/>")}); rec.Code != http.StatusOK || read("assets/logo.svg") != "<svg/>" {
+		t.Fatalf("upload = %d %s", rec.Code, rec.Body.String())
+	}
+	if rec := upload("dir=assets", map[string][]byte{"logo.svg": []byte("new")}); rec.Code != http.StatusConflict {
+		t.Errorf("existing file = %d", rec.Code)
+	}
+	if rec := upload("dir=assets&overwrite=true", map[string][]byte{"logo.svg": []byte("new")}); rec.Code != http.StatusOK || read("assets/logo.svg") != "new" {
+		t.Errorf("overwrite = %d, content %q", rec.Code, read("assets/logo.svg"))
+	}
+	if rec := upload("dir=../outside", map[string][]byte{"x.txt": []byte("x")}); rec.Code != http.StatusForbidden {
+		t.Errorf("dir outside workspace = %d", rec.Code)
+	}
+	if rec := upload("", map[string][]byte{"big.bin": bytes.Repeat([]byte("x"), 2<<20)}); rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("oversized upload = %d", rec.Code)
+	}
+	if matches, _ := filepath.Glob(filepath.Join(workspace, ".cando-upload-*")); len(matches) > 0 || read("big.bin") != "" {
+		t.Errorf("oversized upload left files behind: %v", matches)
+	}
+
+	data := zipOf(t, map[string]string{"train.csv": "a,b\n", "nested/test.csv": "c,d\n"})
+	rec := upload("dir=data&unzip=true", map[string][]byte{"set.zip": data})
+	if rec.Code != http.StatusOK || read("data/train.csv") != "a,b\n" || read("data/nested/test.csv") != "c,d\n" {
+		t.Fatalf("unzip = %d %s", rec.Code, rec.Body.String())
+	}
+	if _, err := os.Stat(filepath.Join(workspace, "data", "set.zip")); !os.IsNotExist(err) {
+		t.Errorf("extracted zip was also stored: %v", err)
+	}
+	if rec := upload("dir=raw", map[string][]byte{"set.zip": data}); rec.Code != http.StatusOK || read("raw/set.zip") != string(data) {
+		t.Errorf("zip without unzip = %d", rec.Code)
+	}
+
+	// A zip slip entry rejects the whole archive before anything is written
+	evil := zipOf(t, map[string]string{"ok.txt": "ok", "../../escape.txt": "x"})
+	if rec := upload("dir=evil&unzip=true", map[string][]byte{"evil.zip": evil}); rec.Code != http.StatusForbidden {
+		t.Errorf("zip slip = %d %s", rec.Code, rec.Body.String())
+	}
+	if read("evil/ok.txt") != "" {
+		t.Error("rejected archive was partly extracted")
+	}
+	bomb := zipOf(t, map[string]string{"zeros": strings.Repeat("0", 2<<20)})
+	if rec := upload("unzip=true", map[string][]byte{"bomb.zip": bomb}); rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("zip over the limit once extracted = %d", rec.Code)
+	}
+}
+
+func TestExtractZipFailureLeavesNothing(t *testing.T) {
+	workspace := t.TempDir()
+	os.WriteFile(filepath.Join(workspace, "keep.txt"), []byte("old"), 0o644)
+	copies := 0
+	uploadCopy = func(dst io.Writer, src io.Reader) (int64, error) {
+		if copies++; copies == 2 {
+			return 0, errors.New("disk full")
+		}
+		return io.Copy(dst, src)
+	}
+	t.Cleanup(func() { uploadCopy = io.Copy })
+
+	upload := &fileUpload{root: workspace, dir: "data", overwrite: true, limit: 1 << 20}
+	data := zipOf(t, map[string]string{"a.txt": "a", "nested/deep/b.txt": "b", "c.txt": "c"})
+	if _, err := upload.extractZip("set.zip", bytes.NewReader(data)); err == nil || !strings.Contains(err.Error(), "disk full") {
+		t.Fatalf("extract = %v, want the injected failure", err)
+	}
+	entries, _ := os.ReadDir(workspace)
+	if len(entries) != 1 || entries[0].Name() != "keep.txt" || len(upload.files) != 0 {
+		t.Errorf("failed extraction left %v behind, files %v", entries, upload.files)
+	}
+}
@@ -0,0 +1,105 @@
+package agent
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+
+	"cando/internal/state"
+)
+
+// usageReport sums the provider usage recorded by a workspace's sessions.
+type usageReport struct {
+	Total     state.UsageTotals            `json:"total"`
+	Providers map[string]state.UsageTotals `json:"providers"`
+	Sessions  []sessionUsage               `json:"sessions"` // Sessions with usage, costliest first
+}
+
+type sessionUsage struct {
+	Key   string      `json:"key"`
+	Title string      `json:"title,omitempty"`
+	Usage state.Usage `json:"usage"`
+}
+
+func newUsageReport(summaries []state.Summary) usageReport {
+	report := usageReport{Providers: map[string]state.UsageTotals{}, Sessions: []sessionUsage{}}
+	for _, summary := range summaries {
+		if summary.Usage == nil {
+			continue
+		}
+		report.Total.Add(summary.Usage.UsageTotals)
+		for provider, totals := range summary.Usage.Providers {
+			sum := report.Providers[provider]
+			sum.Add(totals)
+			report.Providers[provider] = sum
+		}
+		report.Sessions = append(report.Sessions, sessionUsage{Key: summary.Key, Title: summary.Title, Usage: *summary.Usage})
+	}
+	sort.SliceStable(report.Sessions, func(i, j int) bool {
+		return report.Sessions[i].Usage.CostUSD > report.Sessions[j].Usage.CostUSD
+	})
+	return report
+}
+
+// handleUsage reports the token usage and cost recorded by a workspace's
+// sessions. ?key=<session> narrows it to one session.
+func (s *webServer) handleUsage(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.respondError(w, r, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	workspace := s.getWorkspaceFromRequest(r)
+	if workspace == "" || !s.workspaceExists(workspace) {
+		s.respondError(w, r, http.StatusBadRequest, "select a workspace first")
+		return
+	}
+	wsCtx, err := s.agent.GetOrCreateWorkspaceContext(workspace)
+	if err != nil {
+		s.respondError(w, r, http.StatusInternalServerError, fmt.Sprintf("get workspace context: %v", err))
+		return
+	}
+	if key := strings.TrimSpace(r.URL.Query().Get("key")); key != "" {
+		conv, ok := wsCtx.states.Get(key)
+		if !ok {
+			s.respondError(w, r, http.StatusNotFound, "unknown session")
+			return
+		}
+		s.writeJSON(w, r, sessionUsage{Key: conv.Key(), Title: conv.Title(), Usage: conv.Usage()})
+		return
+	}
+	s.writeJSON(w, r, newUsageReport(wsCtx.states.Summaries()))
+}
+
+// printUsage writes the :usage report: the current session's usage per
+// provider, then the totals of all sessions.
+func printUsage(out io.Writer, conv *state.Conversation, summaries []state.Summary) {
+	usage := conv.Usage()
+	if usage.IsZero() {
+		fmt.Fprintf(out, "No provider usage recorded for %s yet.\n", conv.Key())
+	} else {
+		fmt.Fprintf(out, "Session %s:\n", conv.Key())
+		fmt.Fprintf(out, "  %-12s %s\n", "total", formatUsageTotals(usage.UsageTotals))
+		providers := make([]string, 0, len(usage.Providers))
+		for provider := range usage.Providers {
+			providers = append(providers, provider)
+		}
+		sort.Strings(providers)
+		for _, provider := range providers {
+			fmt.Fprintf(out, "  %-12s %s\n", provider, formatUsageTotals(usage.Providers[provider]))
+		}
+	}
+	report := newUsageReport(summaries)
+	if len(report.Sessions) > 1 {
+		fmt.Fprintf(out, "All %d sessions: %s\n", len(report.Sessions), formatUsageTotals(report.Total))
+	}
+}
+
+func formatUsageTotals(t state.UsageTotals) string {
+	text := fmt.Sprintf("%d requests, %d prompt + %d completion tokens, $%.4f", t.Requests, t.PromptTokens, t.CompletionTokens, t.CostUSD)
+	if t.Unpriced > 0 {
+		text += fmt.Sprintf(" (%d unpriced)", t.Unpriced)
+	}
+	return text
+}
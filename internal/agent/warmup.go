@@ -0,0 +1,169 @@
+package agent
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// warmupTimeout bounds the whole warm-up; providers that have not answered
+// by then are reported as failed.
+const warmupTimeout = 20 * time.Second
+
+// Warm-up states reported by /api/health.
+const (
+	warmupPending  = "pending"  // Not started yet
+	warmupRunning  = "warming"  // Checks in flight
+	warmupReady    = "ready"    // Every provider answered
+	warmupDegraded = "degraded" // At least one provider check failed
+	warmupOff      = "disabled" // Turned off with warmup: false
+)
+
+// warmupResult is the outcome of one provider's warm-up check.
+type warmupResult struct {
+	Provider  string `json:"provider"`
+	OK        bool   `json:"ok"`
+	Skipped   bool   `json:"skipped,omitempty"` // Provider has no account endpoint to check the key with
+	Error     string `json:"error,omitempty"`
+	LatencyMs int64  `json:"latency_ms"`
+}
+
+// warmupReport is the warm-up part of /api/health.
+type warmupReport struct {
+	State            string         `json:"state"`
+	Providers        []warmupResult `json:"providers,omitempty"`
+	ModelsPrefetched bool           `json:"models_prefetched"`
+	DurationMs       int64          `json:"duration_ms,omitempty"`
+}
+
+// warmupTracker holds the latest warm-up. Each run gets a generation so a
+// slow run finishing after a newer one started cannot overwrite it.
+type warmupTracker struct {
+	mu         sync.Mutex
+	generation int
+	report     warmupReport
+	startedAt  time.Time
+}
+
+// Report returns the latest warm-up state.
+func (t *warmupTracker) Report() warmupReport {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	report := t.report
+	if report.State == "" {
+		report.State = warmupPending
+	}
+	report.Providers = append([]warmupResult(nil), report.Providers...)
+	return report
+}
+
+// Ready reports whether the last warm-up has finished, successfully or not,
+// or warm-up is disabled.
+func (t *warmupTracker) Ready() bool {
+	switch t.Report().State {
+	case warmupReady, warmupDegraded, warmupOff:
+		return true
+	}
+	return false
+}
+
+func (t *warmupTracker) begin() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.generation++
+	t.report = warmupReport{State: warmupRunning}
+	t.startedAt = time.Now()
+	return t.generation
+}
+
+func (t *warmupTracker) finish(generation int, results []warmupResult, prefetched bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if generation != t.generation {
+		return
+	}
+	state := warmupReady
+	for _, result := range results {
+		if !result.OK {
+			state = warmupDegraded
+		}
+	}
+	t.report = warmupReport{
+		State:            state,
+		Providers:        results,
+		ModelsPrefetched: prefetched,
+		DurationMs:       time.Since(t.startedAt).Milliseconds(),
+	}
+}
+
+func (t *warmupTracker) disable() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.generation++
+	t.report = warmupReport{State: warmupOff}
+}
+
+// startWarmup checks every configured provider in the background so the
+// first turn does not pay for connection setup: the account lookup opens a
+// keep-alive connection on the provider's HTTP client, confirms the key
+// works and fills the quota cache. The OpenRouter model list is prefetched
+// as well when OpenRouter is configured.
+func (a *Agent) startWarmup(ctx context.Context) {
+	if !a.cfg.Load().IsWarmupEnabled() {
+		a.warmup.disable()
+		return
+	}
+	generation := a.warmup.begin()
+	go func() {
+		ctx, cancel := context.WithTimeout(ctx, warmupTimeout)
+		defer cancel()
+		results, prefetched := a.runWarmup(ctx)
+		a.warmup.finish(generation, results, prefetched)
+	}()
+}
+
+func (a *Agent) runWarmup(ctx context.Context) ([]warmupResult, bool) {
+	keys := a.warmupProviderKeys()
+	results := make([]warmupResult, len(keys))
+	var wg sync.WaitGroup
+	for i, key := range keys {
+		results[i] = warmupResult{Provider: key}
+		if _, ok := a.accountReporterFor(key); !ok {
+			results[i].OK, results[i].Skipped = true, true
+			continue
+		}
+		wg.Add(1)
+		go func(result *warmupResult) {
+			defer wg.Done()
+			start := time.Now()
+			_, errMsg := a.providerAccountStatus(ctx, result.Provider, true)
+			result.LatencyMs = time.Since(start).Milliseconds()
+			result.OK, result.Error = errMsg == "", errMsg
+		}(&results[i])
+	}
+
+	prefetched := false
+	for _, key := range keys {
+		if key == "openrouter" {
+			openRouterModelsJSON()
+			orModelCache.mu.RLock()
+			prefetched = len(orModelCache.data) > 0
+			orModelCache.mu.RUnlock()
+			break
+		}
+	}
+	wg.Wait()
+	return results, prefetched
+}
+
+// warmupProviderKeys lists the configured providers.
+func (a *Agent) warmupProviderKeys() []string {
+	if a.providerCtrl == nil {
+		return nil
+	}
+	var keys []string
+	for _, opt := range a.providerCtrl.ProviderOptions() {
+		keys = append(keys, opt.Key)
+	}
+	return keys
+}
@@ -0,0 +1,84 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"cando/internal/llm"
+)
+
+// failingAccountClient reports an invalid key on every account lookup.
+type failingAccountClient struct {
+	*scriptedClient
+}
+
+func (c *failingAccountClient) AccountStatus(context.Context) (*llm.AccountStatus, error) {
+	return nil, errors.New("401 invalid api key")
+}
+
+func TestWarmupChecksEveryProvider(t *testing.T) {
+	good := &accountClient{scriptedClient: newScriptedClient()}
+	client, err := NewMultiProviderClient("zai", []ProviderRegistration{
+		{Option: ProviderOption{Key: "zai", Label: "A", Model: "m"}, Client: good},
+		{Option: ProviderOption{Key: "bad", Label: "B", Model: "m"}, Client: &failingAccountClient{newScriptedClient()}},
+		{Option: ProviderOption{Key: "mock", Label: "C", Model: "m"}, Client: newScriptedClient()},
+	})
+	if err != nil {
+		t.Fatalf("new client: %v", err)
+	}
+	agent := newTestAgent(t, client, baseTestConfig(t.TempDir()))
+	if agent.warmup.Ready() {
+		t.Fatal("warm-up should not be ready before it runs")
+	}
+
+	agent.startWarmup(context.Background())
+	deadline := time.Now().Add(5 * time.Second)
+	for !agent.warmup.Ready() {
+		if time.Now().After(deadline) {
+			t.Fatal("warm-up did not finish")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	report := agent.warmup.Report()
+	if report.State != warmupDegraded {
+		t.Fatalf("a failing key should degrade the warm-up, got %q", report.State)
+	}
+	results := make(map[string]warmupResult)
+	for _, result := range report.Providers {
+		results[result.Provider] = result
+	}
+	if !results["zai"].OK || results["bad"].OK || results["bad"].Error == "" || !results["mock"].Skipped {
+		t.Fatalf("unexpected results: %+v", report.Providers)
+	}
+	if good.calls != 1 || agent.cachedAccountStatus("zai") == nil {
+		t.Fatal("warm-up should fill the quota cache")
+	}
+}
+
+func TestWarmupDisabled(t *testing.T) {
+	cfg := baseTestConfig(t.TempDir())
+	off := false
+	cfg.Warmup = &off
+	agent := newTestAgent(t, newScriptedClient(), cfg)
+	agent.startWarmup(context.Background())
+	if report := agent.warmup.Report(); report.State != warmupOff || !agent.warmup.Ready() {
+		t.Fatalf("disabled warm-up should report ready, got %+v", report)
+	}
+}
+
+func TestWarmupIgnoresSupersededRuns(t *testing.T) {
+	var tracker warmupTracker
+	first := tracker.begin()
+	second := tracker.begin()
+	tracker.finish(first, []warmupResult{{Provider: "zai", Error: "timeout"}}, false)
+	if tracker.Ready() {
+		t.Fatal("a stale run must not finish the current one")
+	}
+	tracker.finish(second, []warmupResult{{Provider: "zai", OK: true}}, false)
+	if report := tracker.Report(); report.State != warmupReady {
+		t.Fatalf("state = %q", report.State)
+	}
+}
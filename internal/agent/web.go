@@ -2,6 +2,7 @@ package agent
 
 import (
 	"context"
+	"crypto/tls"
 	"embed"
 	"encoding/base64"
 	"encoding/json"
@@ -10,7 +11,6 @@ import (
 	"html/template"
 	"io"
 	"log"
-	"net"
 	"net/http"
 	"os"
 	"os/exec"
@@ -19,16 +19,20 @@ import (
 	"sort"
 	"strconv"
 	"strings"
-	"sync"
 	"time"
+	"unicode/utf8"
+
+	"google.golang.org/grpc"
 
 	"cando/internal/analytics"
 	"cando/internal/config"
 	"cando/internal/contextprofile"
 	"cando/internal/credentials"
+	"cando/internal/ignore"
 	"cando/internal/llm"
-	"cando/internal/logging"
+	"cando/internal/ollama"
 	"cando/internal/state"
+	"cando/internal/tokenizer"
 	"cando/internal/tooling"
 )
 
@@ -55,33 +59,58 @@ var bellSound []byte
 
 var templates *template.Template
 
-// OpenRouter models cache
-const (
-	openrouterModelsURL     = "https://openrouter.ai/api/frontend/models/find?order=top-weekly"
-	openrouterCacheDuration = 15 * time.Minute
-	openrouterFetchTimeout  = 10 * time.Second
-)
-
-type openrouterModelCache struct {
-	data      []byte
-	fetchedAt time.Time
-	mu        sync.RWMutex
-}
-
-var orModelCache = &openrouterModelCache{}
-
 // RunWeb launches the embedded HTML interface instead of the CLI REPL.
 func (a *Agent) RunWeb(ctx context.Context, addr string) error {
 	clean := strings.TrimSpace(addr)
 	if clean == "" {
 		clean = "127.0.0.1:3737"
 	}
-	server := &webServer{
-		agent:  a,
-		addr:   clean,
-		logger: a.logger,
+	return newWebServer(a, clean).run(ctx)
+}
+
+func newWebServer(a *Agent, addr string) *webServer {
+	s := &webServer{
+		agent:       a,
+		addr:        addr,
+		logger:      a.logger,
+		editor:      newEditorBridge(),
+		terminals:   newTerminalManager(),
+		submissions: newIdempotencyStore(),
+		streams:     newTurnStreams(),
+		locks:       newSessionLocks(),
+		csrfToken:   newCSRFToken(),
+		events:      newEventHub(),
+		tasks:       newTaskRunner(),
+		prompts:     newPromptQueues(),
 	}
-	return server.run(ctx)
+	a.onSessionTitled = s.publishSessionTitle
+	return s
+}
+
+// publishSessionTitle tells open tabs that a session was named, so their
+// session lists pick the title up.
+func (s *webServer) publishSessionTitle(workspace, key, title string) {
+	s.events.publish("session_titled", map[string]string{"workspace": workspace, "session": key, "title": title})
+}
+
+// WebHandler returns the web UI and API as an http.Handler without starting
+// a listener, chat bridges or background schedulers, so tests can mount it
+// on an httptest.Server. Workspaces are read from the config directory.
+func (a *Agent) WebHandler() (http.Handler, error) {
+	s := newWebServer(a, "")
+	if s.logger == nil {
+		s.logger = log.Default()
+	}
+	wsMgr, err := NewWorkspaceManager()
+	if err != nil {
+		return nil, fmt.Errorf("failed to init workspace manager: %w", err)
+	}
+	s.workspaceManager = wsMgr
+	if err := loadTemplates(); err != nil {
+		return nil, fmt.Errorf("failed to load templates: %w", err)
+	}
+	s.shutdownCh = make(chan struct{})
+	return s.handler(), nil
 }
 
 type webServer struct {
@@ -92,7 +121,19 @@ type webServer struct {
 	workspaceManager *WorkspaceManager
 	httpServer       *http.Server
 	shutdownCh       chan struct{}
-	binaryPath       string // Original binary path, captured at startup for restart
+	background       context.Context // Cancelled when the server stops; nil when serving through WebHandler
+	binaryPath       string          // Original binary path, captured at startup for restart
+	editor           *editorBridge
+	terminals        *terminalManager
+	submissions      *idempotencyStore // Dedup of resubmitted prompts
+	streams          *turnStreams      // Per-turn event buffers for stream replay
+	locks            *sessionLocks     // Which tab controls each workspace
+	csrfToken        string            // Per-boot token required on mutating browser requests
+	events           *eventHub         // Server-wide events for /api/events
+	health           healthCache       // Disk and memory store checks reused between probes
+	tasks            *taskRunner       // Runs each workspace's task queue
+	limiter          *rateLimiter      // Per-client request budgets, also applied to prompts sent over /api/ws
+	prompts          *promptQueues     // Prompts sent while their workspace was busy
 }
 
 func (s *webServer) run(ctx context.Context) error {
@@ -121,12 +162,76 @@ func (s *webServer) run(ctx context.Context) error {
 		return fmt.Errorf("failed to load templates: %w", err)
 	}
 
-	listener, err := net.Listen("tcp", s.addr)
+	web := s.agent.cfg.Load().Web
+	listener, err := listenWeb(s.addr, web.SocketGroupAccess)
 	if err != nil {
 		return err
 	}
+	_, onSocket := socketPath(s.addr)
+	if web.TLS.On() && !onSocket {
+		tlsConfig, err := webTLSConfig(web.TLS, web.AllowedHosts)
+		if err != nil {
+			listener.Close()
+			return err
+		}
+		listener = tls.NewListener(listener, tlsConfig)
+	}
 	actualAddr := listener.Addr().String()
 	s.actualAddr = actualAddr
+	server := &http.Server{
+		Addr:    actualAddr,
+		Handler: s.handler(),
+	}
+	s.httpServer = server
+	s.shutdownCh = make(chan struct{})
+
+	// Start the gRPC control API alongside HTTP when configured
+	var grpcServer *grpc.Server
+	if s.agent.grpcAddr != "" {
+		grpcServer, err = s.startGRPC(s.agent.grpcAddr)
+		if err != nil {
+			listener.Close()
+			return err
+		}
+	}
+
+	// Chat bridges, the digest scheduler and the config watchers stop with the server
+	bridgeCtx, stopBridges := context.WithCancel(ctx)
+	s.background = bridgeCtx
+	s.startChatBridges(bridgeCtx)
+	s.startDigestScheduler(bridgeCtx)
+	s.startConfigWatcher(bridgeCtx)
+	s.agent.followConfig(bridgeCtx)
+	s.agent.startWarmup(bridgeCtx)
+
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-s.shutdownCh:
+		}
+		stopBridges()
+		if grpcServer != nil {
+			grpcServer.Stop()
+		}
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = server.Shutdown(shutdownCtx)
+	}()
+
+	if onSocket {
+		s.logger.Printf("web UI listening on unix socket %s", actualAddr)
+	} else {
+		s.logger.Printf("web UI listening on %s://%s", web.Scheme(), actualAddr)
+	}
+	err = server.Serve(listener)
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+// handler routes the web UI and API behind the request guards.
+func (s *webServer) handler() http.Handler {
 	mux := http.NewServeMux()
 	mux.HandleFunc("/", s.handleIndex)
 	mux.HandleFunc("/sessions", s.handleSessionsPage)
@@ -136,14 +241,38 @@ func (s *webServer) run(ctx context.Context) error {
 	mux.HandleFunc("/lucide.js", s.handleLucide)
 	mux.HandleFunc("/bell.wav", s.handleBellSound)
 	mux.HandleFunc("/openrouter-models.json", s.handleOpenRouterModels)
+	mux.HandleFunc("/api/openrouter-models/refresh", s.handleOpenRouterModelsRefresh)
+	mux.HandleFunc("/openai-models.json", s.handleOpenAIModels)
+	mux.HandleFunc("/ollama-models.json", s.handleOllamaModels)
 	mux.HandleFunc("/api/session", s.handleSession)
+	mux.HandleFunc("/api/session/lock", s.handleSessionLock)
+	mux.HandleFunc("/api/session/thinking-mode", s.handleThinkingMode)
 	mux.HandleFunc("/api/prompt", s.handlePrompt)
 	mux.HandleFunc("/api/stream", s.handleStream)
+	mux.HandleFunc("/api/ws", s.handleWebSocket)
+	mux.HandleFunc("/api/turns", s.handleTurns)
+	mux.HandleFunc("/api/turns/seen", s.handleTurnsSeen)
+	mux.HandleFunc("/api/turns/", s.handleTurnGraph) // /api/turns/<id>/graph
+	mux.HandleFunc("/api/overview", s.handleOverview)
+	mux.HandleFunc("/api/changes", s.handleChanges)
+	mux.HandleFunc("/api/checkpoints", s.handleCheckpoints)
+	mux.HandleFunc("/api/activity", s.handleActivity)
+	mux.HandleFunc("/api/feedback", s.handleFeedback)
+	mux.HandleFunc("/api/feedback/export", s.handleFeedbackExport)
+	mux.HandleFunc("/api/tasks", s.handleTasks)
 	mux.HandleFunc("/api/state", s.handleState)
+	mux.HandleFunc("/api/session/export", s.handleSessionExport)
+	mux.HandleFunc("/api/usage", s.handleUsage)
+	mux.HandleFunc("/api/session/budget", s.handleSessionBudget)
+	mux.HandleFunc("/api/processes", s.handleProcesses)
+	mux.HandleFunc("/api/processes/logs", s.handleProcessLogs)
+	mux.HandleFunc("/api/processes/kill", s.handleProcessKill)
+	mux.HandleFunc("/api/session/import", s.handleSessionImport)
 	mux.HandleFunc("/api/thinking", s.handleThinking)
 	mux.HandleFunc("/api/force-thinking", s.handleForceThinking)
 	mux.HandleFunc("/api/system-prompt", s.handleSystemPrompt)
 	mux.HandleFunc("/api/cancel", s.handleCancel)
+	mux.HandleFunc("/api/prompt-queue", s.handlePromptQueue)
 	mux.HandleFunc("/api/provider", s.handleProviderSwitch)
 	mux.HandleFunc("/api/provider/model", s.handleProviderModelUpdate)
 	mux.HandleFunc("/api/compaction-history", s.handleCompactionHistory)
@@ -151,6 +280,7 @@ func (s *webServer) run(ctx context.Context) error {
 	mux.HandleFunc("/api/files", s.handleFileSearch)
 	mux.HandleFunc("/api/config", s.handleConfig)
 	mux.HandleFunc("/api/workspaces", s.handleWorkspaces)
+	mux.HandleFunc("/api/workspaces/active", s.handleActiveWorkspaces)
 	mux.HandleFunc("/api/workspace/add", s.handleWorkspaceAdd)
 	mux.HandleFunc("/api/workspace/switch", s.handleWorkspaceSwitch)
 	mux.HandleFunc("/api/workspace/remove", s.handleWorkspaceRemove)
@@ -158,8 +288,15 @@ func (s *webServer) run(ctx context.Context) error {
 	mux.HandleFunc("/api/folder/create", s.handleFolderCreate)
 	mux.HandleFunc("/api/branch", s.handleBranch)
 	mux.HandleFunc("/api/project/instructions", s.handleProjectInstructions)
+	mux.HandleFunc("/api/knowledge/export", s.handleKnowledgeExport)
+	mux.HandleFunc("/api/knowledge/import", s.handleKnowledgeImport)
 	mux.HandleFunc("/api/plan-mode", s.handlePlanMode)
+	mux.HandleFunc("/api/mcp", s.handleMCP)
+	mux.HandleFunc("/api/tool-approval", s.handleToolApproval)
 	mux.HandleFunc("/api/health", s.handleHealth)
+	mux.HandleFunc("/api/diagnostics/bundle", s.handleDiagnosticsBundle)
+	mux.HandleFunc("/api/csrf", s.handleCSRF)
+	mux.HandleFunc("/api/events", s.handleEvents)
 	mux.HandleFunc("/api/update-check", s.handleUpdateCheck)
 	mux.HandleFunc("/api/update", s.handleUpdate)
 	mux.HandleFunc("/api/restart", s.handleRestart)
@@ -169,6 +306,8 @@ func (s *webServer) run(ctx context.Context) error {
 	mux.HandleFunc("/api/files/read", s.handleFilesRead)
 	mux.HandleFunc("/api/files/save", s.handleFilesSave)
 	mux.HandleFunc("/api/files/create", s.handleFilesCreate)
+	mux.HandleFunc("/api/files/upload", s.handleFilesUpload)
+	mux.HandleFunc("/api/files/download", s.handleFilesDownload)
 	mux.HandleFunc("/api/files/mkdir", s.handleFilesMkdir)
 	mux.HandleFunc("/api/files/reveal", s.handleFilesReveal)
 	mux.HandleFunc("/api/files/delete", s.handleFilesDelete)
@@ -176,30 +315,24 @@ func (s *webServer) run(ctx context.Context) error {
 	mux.HandleFunc("/api/preview", s.handlePreview)      // Legacy query-based
 	mux.HandleFunc("/api/preview/", s.handlePreviewPath) // Path-based for relative URLs
 	mux.HandleFunc("/api/preview-enabled", s.handlePreviewEnabled)
-
-	server := &http.Server{
-		Addr:    actualAddr,
-		Handler: s.logRequests(mux),
-	}
-	s.httpServer = server
-	s.shutdownCh = make(chan struct{})
-
-	go func() {
-		select {
-		case <-ctx.Done():
-		case <-s.shutdownCh:
-		}
-		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-		defer cancel()
-		_ = server.Shutdown(shutdownCtx)
-	}()
-
-	s.logger.Printf("web UI listening on http://%s", actualAddr)
-	err = server.Serve(listener)
-	if errors.Is(err, http.ErrServerClosed) {
-		return nil
-	}
-	return err
+	mux.HandleFunc("/api/editor/selection", s.handleEditorSelection)
+	mux.HandleFunc("/api/editor/open", s.handleEditorOpen)
+	mux.HandleFunc("/api/editor/diff", s.handleEditorDiff)
+	mux.HandleFunc("/api/editor/commands", s.handleEditorCommands)
+	mux.HandleFunc("/api/terminal", s.handleTerminal)
+	mux.HandleFunc("/api/terminal/share", s.handleTerminalShare)
+	mux.HandleFunc("/api/terminal/record", s.handleTerminalRecord)
+	mux.HandleFunc("/api/handoff", s.handleHandoff)
+	mux.HandleFunc("/api/actions", s.handleActions)
+	mux.HandleFunc("/api/actions/run", s.handleActionRun)
+	mux.HandleFunc("/api/notifications", s.handleNotifications)
+	mux.HandleFunc("/api/digest", s.handleDigest)
+	mux.HandleFunc("/api/providers/usage", s.handleProviderUsage)
+	mux.HandleFunc("/api/models/metadata", s.handleModelMetadata)
+	mux.HandleFunc("/api/search/global", s.handleGlobalSearch)
+	mux.HandleFunc("/api/search/settings", s.handleSearchSettings)
+	s.limiter = newRateLimiter()
+	return s.logRequests(s.limitRequests(s.limiter, s.requireAPIToken(s.guardRequests(s.demoGuard(mux)))))
 }
 
 func (s *webServer) logRequests(next http.Handler) http.Handler {
@@ -232,6 +365,10 @@ func (s *webServer) logRequestError(r *http.Request, status int, message string)
 	if s.logger == nil {
 		return
 	}
+	if r == nil { // A gRPC call
+		s.logger.Printf("[ERROR] grpc status=%d: %s", status, message)
+		return
+	}
 	workspace := s.getWorkspaceFromRequest(r)
 	if workspace != "" {
 		s.logger.Printf("[ERROR] [ws:%s] status=%d method=%s path=%s remote=%s: %s",
@@ -331,51 +468,6 @@ func (s *webServer) handleBellSound(w http.ResponseWriter, r *http.Request) {
 	_, _ = w.Write(bellSound)
 }
 
-func (s *webServer) handleOpenRouterModels(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json; charset=utf-8")
-	data := s.getOpenRouterModels()
-	_, _ = w.Write(data)
-}
-
-// getOpenRouterModels returns cached models if fresh, otherwise fetches new.
-// Fallback chain: fresh cache -> fetch API -> stale cache -> embedded JSON
-func (s *webServer) getOpenRouterModels() []byte {
-	// Check if cache is fresh (< 15 mins old)
-	orModelCache.mu.RLock()
-	cacheData := orModelCache.data
-	cacheFresh := time.Since(orModelCache.fetchedAt) < openrouterCacheDuration && len(cacheData) > 0
-	orModelCache.mu.RUnlock()
-
-	if cacheFresh {
-		logging.DevLog("openrouter models: returning fresh cache (%d bytes)", len(cacheData))
-		return cacheData
-	}
-
-	// Cache stale or empty - fetch fresh from OpenRouter API
-	logging.DevLog("openrouter models: fetching from API...")
-	data, err := fetchOpenRouterModels()
-	if err != nil {
-		logging.DevLog("openrouter models: fetch failed: %v", err)
-		// Return stale cache if available
-		if len(cacheData) > 0 {
-			logging.DevLog("openrouter models: returning stale cache (%d bytes)", len(cacheData))
-			return cacheData
-		}
-		// No cache at all - return embedded fallback
-		logging.DevLog("openrouter models: returning embedded fallback (%d bytes)", len(openrouterModels))
-		return openrouterModels
-	}
-
-	// Update cache with fresh data
-	orModelCache.mu.Lock()
-	orModelCache.data = data
-	orModelCache.fetchedAt = time.Now()
-	orModelCache.mu.Unlock()
-
-	logging.DevLog("openrouter models: returning fresh fetch (%d bytes)", len(data))
-	return data
-}
-
 // fetchOpenRouterModels fetches and transforms models from OpenRouter API
 func fetchOpenRouterModels() ([]byte, error) {
 	client := &http.Client{Timeout: openrouterFetchTimeout}
@@ -468,7 +560,9 @@ func (s *webServer) handlePrompt(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	var req struct {
-		Content string `json:"content"`
+		Content        string   `json:"content"`
+		IdempotencyKey string   `json:"idempotency_key,omitempty"`
+		PinnedFiles    []string `json:"pinned_files,omitempty"` // Workspace files resent with every provider call of the turn
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		s.respondError(w, r, http.StatusBadRequest, "invalid payload")
@@ -489,11 +583,41 @@ func (s *webServer) handlePrompt(w http.ResponseWriter, r *http.Request) {
 		s.respondError(w, r, http.StatusBadRequest, fmt.Sprintf("get workspace context: %v", err))
 		return
 	}
-	if s.agent.HasInFlightRequest() {
-		s.respondError(w, r, http.StatusConflict, "another request is already running")
+	pins, err := s.userPins(wsCtx.root, req.PinnedFiles)
+	if err != nil {
+		s.respondError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	if !s.claimWorkspace(w, r, workspace) {
 		return
 	}
-	if _, _, err := s.agent.respondWithCallbacksForWorkspace(r.Context(), content, nil, wsCtx); err != nil {
+	key := idempotencyKey(r, req.IdempotencyKey)
+	session := wsCtx.states.Current().Key()
+	if status, ok := s.submissions.begin(workspace, session, key); !ok {
+		if status == submissionRunning {
+			s.respondError(w, r, http.StatusConflict, "this prompt is already running")
+			return
+		}
+		w.Header().Set("Idempotent-Replay", "true")
+		s.writeSessionPayload(w, r)
+		return
+	}
+	if item, position, queued, err := s.queuePromptIfBusy(wsCtx, content, key, pins); err != nil || queued {
+		s.submissions.finish(workspace, session, key, errors.New("busy"))
+		if err != nil {
+			s.respondError(w, r, http.StatusConflict, err.Error())
+			return
+		}
+		s.writeQueued(w, r, item, position)
+		return
+	}
+	turnID := newTurnID()
+	w.Header().Set("X-Turn-ID", turnID)
+	ctx := s.withEditorSelection(withUserPins(withTurnID(r.Context(), turnID), pins), wsCtx.root)
+	_, _, err = s.agent.respondWithCallbacksForWorkspace(ctx, content, nil, wsCtx)
+	s.submissions.finish(workspace, session, key, err)
+	s.advancePrompts(wsCtx)
+	if err != nil {
 		s.respondError(w, r, http.StatusInternalServerError, fmt.Sprintf("request failed: %v", err))
 		return
 	}
@@ -501,12 +625,18 @@ func (s *webServer) handlePrompt(w http.ResponseWriter, r *http.Request) {
 }
 
 func (s *webServer) handleStream(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet {
+		s.handleStreamResume(w, r)
+		return
+	}
 	if r.Method != http.MethodPost {
 		s.respondError(w, r, http.StatusMethodNotAllowed, "method not allowed")
 		return
 	}
 	var req struct {
-		Content string `json:"content"`
+		Content        string   `json:"content"`
+		IdempotencyKey string   `json:"idempotency_key,omitempty"`
+		PinnedFiles    []string `json:"pinned_files,omitempty"` // Workspace files resent with every provider call of the turn
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		s.respondError(w, r, http.StatusBadRequest, "invalid payload")
@@ -517,10 +647,6 @@ func (s *webServer) handleStream(w http.ResponseWriter, r *http.Request) {
 		s.respondError(w, r, http.StatusBadRequest, "content is required")
 		return
 	}
-	if s.agent.HasInFlightRequest() {
-		s.respondError(w, r, http.StatusConflict, "another request is already running")
-		return
-	}
 
 	// Get workspace context for current workspace
 	workspace := s.getWorkspaceFromRequest(r)
@@ -534,50 +660,102 @@ func (s *webServer) handleStream(w http.ResponseWriter, r *http.Request) {
 		s.respondError(w, r, http.StatusInternalServerError, fmt.Sprintf("get workspace context: %v", err))
 		return
 	}
+	pins, err := s.userPins(wsCtx.root, req.PinnedFiles)
+	if err != nil {
+		s.respondError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		s.respondError(w, r, http.StatusInternalServerError, "streaming not supported")
+		return
+	}
+
+	t, err := s.submitTurn(wsCtx, turnSubmission{
+		r:         r,
+		workspace: workspace,
+		content:   content,
+		key:       idempotencyKey(r, req.IdempotencyKey),
+		pins:      pins,
+		clientID:  requestClientID(r),
+		label:     clientLabel(r),
+		takeover:  r.Header.Get("X-Lock-Takeover") == "1",
+	})
+	var rejected *submitError
+	if errors.As(err, &rejected) {
+		s.respondError(w, r, rejected.status, rejected.message)
+		return
+	}
+	if t.queued {
+		s.writeQueued(w, r, t.item, t.position)
+		return
+	}
 
 	w.Header().Set("Content-Type", "text/event-stream")
 	w.Header().Set("Cache-Control", "no-cache")
 	w.Header().Set("Connection", "keep-alive")
 	w.Header().Set("X-Accel-Buffering", "no")
 
-	flusher, ok := w.(http.Flusher)
-	if !ok {
-		s.respondError(w, r, http.StatusInternalServerError, "streaming not supported")
-		return
-	}
+	// Every event is buffered so a client that drops mid-turn can reconnect
+	// and replay from its Last-Event-ID. Once the writer fails, events are
+	// only buffered.
+	clientGone := false
+	s.runTurn(r.Context(), t, func(seq int, payload []byte) {
+		if clientGone {
+			return
+		}
+		if _, err := fmt.Fprintf(w, "id: %s:%d\ndata: %s\n\n", t.turnID, seq, string(payload)); err != nil {
+			clientGone = true
+			s.logger.Printf("[ws:%s] stream client disconnected during %s; buffering for replay", workspace, t.turnID)
+			return
+		}
+		flusher.Flush()
+	})
+}
 
-	sendEvent := func(eventType string, data any) error {
-		payload, err := json.Marshal(map[string]any{
-			"type": eventType,
-			"data": data,
-		})
-		if err != nil {
-			s.logRequestError(r, http.StatusInternalServerError, fmt.Sprintf("stream marshal %s event failed: %v", eventType, err))
+// executeTurn runs one prompt (or :ingest / :explain / :compact command) and finishes
+// the event stream with complete, error, or provider_error.
+func (s *webServer) executeTurn(ctx context.Context, r *http.Request, wsCtx *WorkspaceContext, content, turnID string, sendEvent StreamCallback) error {
+	// Handle :ingest command
+	if strings.TrimSpace(content) == ":ingest" {
+		if err := s.handleIngestCommand(ctx, wsCtx, sendEvent); err != nil {
+			s.logRequestError(r, http.StatusInternalServerError, fmt.Sprintf("ingest command failed: %v", err))
+			sendEvent("error", map[string]string{"message": err.Error()})
 			return err
 		}
-		_, err = fmt.Fprintf(w, "data: %s\n\n", string(payload))
-		if err != nil {
-			s.logRequestError(r, http.StatusInternalServerError, fmt.Sprintf("stream write %s event failed: %v", eventType, err))
+		sendEvent("complete", map[string]string{"status": "done"})
+		return nil
+	}
+
+	// Handle :explain command
+	if strings.TrimSpace(content) == ":explain" {
+		if err := s.handleExplainCommand(ctx, wsCtx, sendEvent); err != nil {
+			s.logRequestError(r, http.StatusInternalServerError, fmt.Sprintf("explain command failed: %v", err))
+			sendEvent("error", map[string]string{"message": err.Error()})
 			return err
 		}
-		flusher.Flush()
+		sendEvent("complete", map[string]string{"status": "done"})
 		return nil
 	}
 
 	// Handle :compact command
 	if strings.HasPrefix(content, ":compact") {
-		if err := s.handleCompactCommand(r.Context(), content, wsCtx, sendEvent); err != nil {
+		if err := s.handleCompactCommand(ctx, content, wsCtx, sendEvent); err != nil {
 			s.logRequestError(r, http.StatusInternalServerError, fmt.Sprintf("compact command failed: %v", err))
 			sendEvent("error", map[string]string{"message": err.Error()})
-			return
+			return err
 		}
 		sendEvent("complete", map[string]string{"status": "done"})
-		return
+		return nil
 	}
 
-	if _, _, err := s.agent.respondWithCallbacksForWorkspace(r.Context(), content, sendEvent, wsCtx); err != nil {
+	ctx = s.withEditorSelection(withTurnID(ctx, turnID), wsCtx.root)
+	if _, _, err := s.agent.respondWithCallbacksForWorkspace(ctx, content, sendEvent, wsCtx); err != nil {
 		// Check if this is a structured ProviderError (event may already have been sent by agent)
-		if pe, ok := llm.IsProviderError(err); ok {
+		if payload := budgetExceededPayload(err); payload != nil {
+			s.logger.Printf("[ws:%s] %v", wsCtx.root, err)
+			sendEvent("budget_exceeded", payload)
+		} else if pe, ok := llm.IsProviderError(err); ok {
 			// Log with provider context instead of generic ERROR
 			s.logger.Printf("[provider] %s error: %s", pe.Provider, pe.Error())
 			// Send provider_error event (in case it wasn't sent during retry loop)
@@ -587,10 +765,11 @@ func (s *webServer) handleStream(w http.ResponseWriter, r *http.Request) {
 			s.logRequestError(r, http.StatusInternalServerError, fmt.Sprintf("stream request failed: %v", err))
 			sendEvent("error", map[string]string{"message": err.Error()})
 		}
-		return
+		return err
 	}
 
 	sendEvent("complete", map[string]string{"status": "done"})
+	return nil
 }
 
 func (s *webServer) handleCompactCommand(ctx context.Context, content string, wsCtx *WorkspaceContext, sendEvent func(string, any) error) error {
@@ -608,7 +787,7 @@ func (s *webServer) handleCompactCommand(ctx context.Context, content string, ws
 	}
 
 	// Parse protected message count
-	target := s.agent.cfg.ContextProtectRecent
+	target := s.agent.cfg.Load().ContextProtectRecent
 	if len(parts) >= 2 {
 		var val int
 		if _, err := fmt.Sscanf(parts[1], "%d", &val); err != nil || val < 0 {
@@ -623,7 +802,7 @@ func (s *webServer) handleCompactCommand(ctx context.Context, content string, ws
 	})
 
 	// Set protected count temporarily
-	originalProtected := s.agent.cfg.ContextProtectRecent
+	originalProtected := s.agent.cfg.Load().ContextProtectRecent
 	setter.SetProtectedRecent(target)
 	defer setter.SetProtectedRecent(originalProtected)
 
@@ -667,6 +846,7 @@ func (s *webServer) handleState(w http.ResponseWriter, r *http.Request) {
 	var req struct {
 		Action string `json:"action"`
 		Key    string `json:"key"`
+		Title  string `json:"title"` // For rename
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		s.respondError(w, r, http.StatusBadRequest, "invalid payload")
@@ -686,6 +866,10 @@ func (s *webServer) handleState(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if !s.claimWorkspace(w, r, workspace) {
+		return
+	}
+
 	action := strings.ToLower(strings.TrimSpace(req.Action))
 	key := strings.TrimSpace(req.Key)
 	switch action {
@@ -698,6 +882,8 @@ func (s *webServer) handleState(w http.ResponseWriter, r *http.Request) {
 			s.respondError(w, r, http.StatusBadRequest, err.Error())
 			return
 		}
+		// Prompts queued in the session run once it is current again
+		defer s.advancePrompts(wsCtx)
 	case "new":
 		if key == "" {
 			s.respondError(w, r, http.StatusBadRequest, "key is required")
@@ -716,6 +902,25 @@ func (s *webServer) handleState(w http.ResponseWriter, r *http.Request) {
 			s.respondError(w, r, http.StatusBadRequest, err.Error())
 			return
 		}
+		s.prompts.remove(wsCtx.root, key, "")
+	case "rename":
+		// Sets the display title; the key stays, so links and queues still work
+		conv, ok := s.sessionOrCurrent(wsCtx, key)
+		if !ok || conv == nil {
+			s.respondError(w, r, http.StatusNotFound, "unknown session")
+			return
+		}
+		title := strings.TrimSpace(req.Title)
+		if utf8.RuneCountInString(title) > maxSessionTitleRunes {
+			s.respondError(w, r, http.StatusBadRequest, fmt.Sprintf("title is longer than %d characters", maxSessionTitleRunes))
+			return
+		}
+		conv.SetTitle(title)
+		if err := wsCtx.states.Save(conv); err != nil {
+			s.respondError(w, r, http.StatusInternalServerError, err.Error())
+			return
+		}
+		s.publishSessionTitle(wsCtx.root, conv.Key(), title)
 	case "clear":
 		if err := wsCtx.states.ClearCurrent(); err != nil {
 			s.respondError(w, r, http.StatusBadRequest, err.Error())
@@ -740,10 +945,10 @@ func (s *webServer) handleThinking(w http.ResponseWriter, r *http.Request) {
 		s.respondError(w, r, http.StatusBadRequest, "invalid payload")
 		return
 	}
-	s.agent.cfg.ThinkingEnabled = req.Enabled
+	updated := s.agent.cfg.Update(func(c *config.Config) { c.ThinkingEnabled = req.Enabled })
 
 	// Save to disk
-	if err := config.Save(s.agent.cfg); err != nil {
+	if err := config.Save(updated); err != nil {
 		s.respondError(w, r, http.StatusInternalServerError, fmt.Sprintf("failed to save config: %v", err))
 		return
 	}
@@ -763,10 +968,10 @@ func (s *webServer) handleForceThinking(w http.ResponseWriter, r *http.Request)
 		s.respondError(w, r, http.StatusBadRequest, "invalid payload")
 		return
 	}
-	s.agent.cfg.ForceThinking = req.Enabled
+	updated := s.agent.cfg.Update(func(c *config.Config) { c.ForceThinking = req.Enabled })
 
 	// Save to disk
-	if err := config.Save(s.agent.cfg); err != nil {
+	if err := config.Save(updated); err != nil {
 		s.respondError(w, r, http.StatusInternalServerError, fmt.Sprintf("failed to save config: %v", err))
 		return
 	}
@@ -774,6 +979,43 @@ func (s *webServer) handleForceThinking(w http.ResponseWriter, r *http.Request)
 	s.writeSessionPayload(w, r)
 }
 
+// handleThinkingMode sets how the current session treats model reasoning.
+func (s *webServer) handleThinkingMode(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		s.respondError(w, r, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	var req struct {
+		Mode string `json:"mode"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.respondError(w, r, http.StatusBadRequest, "invalid payload")
+		return
+	}
+	mode, err := state.ParseThinkingMode(strings.TrimSpace(req.Mode))
+	if err != nil {
+		s.respondError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	workspace := s.getWorkspaceFromRequest(r)
+	if workspace == "" || !s.workspaceExists(workspace) {
+		s.respondError(w, r, http.StatusBadRequest, "select a workspace first")
+		return
+	}
+	wsCtx, err := s.agent.GetOrCreateWorkspaceContext(workspace)
+	if err != nil {
+		s.respondError(w, r, http.StatusInternalServerError, fmt.Sprintf("get workspace context: %v", err))
+		return
+	}
+	conv := wsCtx.states.Current()
+	conv.SetThinkingMode(mode)
+	if err := wsCtx.states.Save(conv); err != nil {
+		s.respondError(w, r, http.StatusInternalServerError, fmt.Sprintf("save conversation: %v", err))
+		return
+	}
+	s.writeSessionPayload(w, r)
+}
+
 func (s *webServer) handleProviderSwitch(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		s.respondError(w, r, http.StatusMethodNotAllowed, "method not allowed")
@@ -814,6 +1056,55 @@ func (s *webServer) handleProviderSwitch(w http.ResponseWriter, r *http.Request)
 	s.writeSessionPayload(w, r)
 }
 
+var errInvalidModelType = errors.New("invalid model_type: must be main, summary, or vision")
+
+// updateProviderModel sets the main, summary or vision model for a provider,
+// persists the config and reloads providers when the main model changes.
+func (s *webServer) updateProviderModel(provider, modelType, model string) error {
+	if modelType != "main" && modelType != "summary" && modelType != "vision" {
+		return errInvalidModelType
+	}
+	// Update the appropriate config field based on model type
+	updated := s.agent.cfg.Update(func(c *config.Config) {
+		switch modelType {
+		case "main":
+			if c.ProviderModels == nil {
+				c.ProviderModels = make(map[string]string)
+			}
+			c.ProviderModels[provider] = model
+		case "summary":
+			if c.ProviderSummaryModels == nil {
+				c.ProviderSummaryModels = make(map[string]string)
+			}
+			c.ProviderSummaryModels[provider] = model
+			// Update current summary model if this is the active provider
+			if provider == c.Provider {
+				c.SummaryModel = model
+			}
+		case "vision":
+			if c.ProviderVLModels == nil {
+				c.ProviderVLModels = make(map[string]string)
+			}
+			c.ProviderVLModels[provider] = model
+		}
+	})
+
+	// Save config to disk
+	if err := config.Save(updated); err != nil {
+		return fmt.Errorf("failed to save config: %w", err)
+	}
+
+	s.logger.Printf("Updated %s %s model to %s", provider, modelType, model)
+
+	// Reload providers for main model changes
+	if modelType == "main" {
+		if err := s.agent.ReloadProviders(); err != nil {
+			s.logger.Printf("Warning: failed to reload providers after model change: %v", err)
+		}
+	}
+	return nil
+}
+
 // handleProviderModelUpdate handles all model type updates (main, summary, vision)
 func (s *webServer) handleProviderModelUpdate(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
@@ -841,45 +1132,13 @@ func (s *webServer) handleProviderModelUpdate(w http.ResponseWriter, r *http.Req
 		req.ModelType = "main"
 	}
 
-	// Update the appropriate config field based on model type
-	switch req.ModelType {
-	case "main":
-		if s.agent.cfg.ProviderModels == nil {
-			s.agent.cfg.ProviderModels = make(map[string]string)
-		}
-		s.agent.cfg.ProviderModels[req.Provider] = req.Model
-	case "summary":
-		if s.agent.cfg.ProviderSummaryModels == nil {
-			s.agent.cfg.ProviderSummaryModels = make(map[string]string)
-		}
-		s.agent.cfg.ProviderSummaryModels[req.Provider] = req.Model
-		// Update current summary model if this is the active provider
-		if req.Provider == s.agent.cfg.Provider {
-			s.agent.cfg.SummaryModel = req.Model
-		}
-	case "vision":
-		if s.agent.cfg.ProviderVLModels == nil {
-			s.agent.cfg.ProviderVLModels = make(map[string]string)
-		}
-		s.agent.cfg.ProviderVLModels[req.Provider] = req.Model
-	default:
-		s.respondError(w, r, http.StatusBadRequest, "invalid model_type: must be main, summary, or vision")
-		return
-	}
-
-	// Save config to disk
-	if err := config.Save(s.agent.cfg); err != nil {
-		s.respondError(w, r, http.StatusInternalServerError, fmt.Sprintf("failed to save config: %v", err))
-		return
-	}
-
-	s.logger.Printf("Updated %s %s model to %s", req.Provider, req.ModelType, req.Model)
-
-	// Reload providers for main model changes
-	if req.ModelType == "main" {
-		if err := s.agent.ReloadProviders(); err != nil {
-			s.logger.Printf("Warning: failed to reload providers after model change: %v", err)
+	if err := s.updateProviderModel(req.Provider, req.ModelType, req.Model); err != nil {
+		if errors.Is(err, errInvalidModelType) {
+			s.respondError(w, r, http.StatusBadRequest, err.Error())
+			return
 		}
+		s.respondError(w, r, http.StatusInternalServerError, err.Error())
+		return
 	}
 
 	s.writeJSON(w, r, map[string]any{
@@ -893,10 +1152,21 @@ func (s *webServer) handleCancel(w http.ResponseWriter, r *http.Request) {
 		s.respondError(w, r, http.StatusMethodNotAllowed, "method not allowed")
 		return
 	}
-	cancelled := s.agent.CancelRequest()
+	// Cancel the request's workspace, or every workspace without one
+	var cancelled, running bool
+	if workspace := s.getWorkspaceFromRequest(r); workspace != "" && s.workspaceExists(workspace) {
+		wsCtx, err := s.agent.GetOrCreateWorkspaceContext(workspace)
+		if err != nil {
+			s.respondError(w, r, http.StatusInternalServerError, fmt.Sprintf("get workspace context: %v", err))
+			return
+		}
+		cancelled, running = wsCtx.CancelRequest(), wsCtx.HasInFlightRequest()
+	} else {
+		cancelled, running = s.agent.CancelRequest(), s.agent.HasInFlightRequest()
+	}
 	resp := map[string]any{
 		"cancelled": cancelled,
-		"running":   s.agent.HasInFlightRequest(),
+		"running":   running,
 	}
 	s.writeJSON(w, r, resp)
 }
@@ -937,35 +1207,52 @@ func (s *webServer) handleCompactionHistory(w http.ResponseWriter, r *http.Reque
 }
 
 type sessionPayload struct {
-	CurrentKey            string            `json:"current_key"`
-	Keys                  []string          `json:"keys"`
-	Sessions              []state.Summary   `json:"sessions"`
-	Messages              []state.Message   `json:"messages"`
-	Thinking              bool              `json:"thinking"`
-	ForceThinking         bool              `json:"force_thinking"`
-	PlanMode              bool              `json:"plan_mode"`
-	SystemPrompt          string            `json:"system_prompt"`
-	Running               bool              `json:"running"`
-	ContextChars          int               `json:"context_chars"`
-	ContextLimitTokens    int               `json:"context_limit_tokens,omitempty"`
-	TotalTokens           int               `json:"total_tokens"`
-	Model                 string            `json:"model"`
-	SummaryModel          string            `json:"summary_model,omitempty"`
-	Providers             []ProviderOption  `json:"providers,omitempty"`
-	ProviderModels        map[string]string `json:"provider_models,omitempty"`
-	ProviderSummaryModels map[string]string `json:"provider_summary_models,omitempty"`
-	ProviderVLModels      map[string]string `json:"provider_vl_models,omitempty"`
-	CurrentProvider       string            `json:"current_provider,omitempty"`
-	OpenRouterFreeMode    bool              `json:"openrouter_free_mode,omitempty"`
-	AnalyticsEnabled      bool              `json:"analytics_enabled"`
-	ContextProfile        string            `json:"context_profile,omitempty"`
-	Plan                  *planSnapshot     `json:"plan,omitempty"`
-	PlanError             string            `json:"plan_error,omitempty"`
-	Workdir               string            `json:"workdir,omitempty"`
-	Config                *configSnapshot   `json:"config,omitempty"`
-	Workspace             *Workspace        `json:"workspace,omitempty"`
-	Workspaces            []Workspace       `json:"workspaces,omitempty"`
-	RecentWorkspaces      []Workspace       `json:"recent_workspaces,omitempty"`
+	CurrentKey            string                `json:"current_key"`
+	Keys                  []string              `json:"keys"`
+	Sessions              []state.Summary       `json:"sessions"`
+	Messages              []state.Message       `json:"messages"`
+	Thinking              bool                  `json:"thinking"`
+	ThinkingMode          state.ThinkingMode    `json:"thinking_mode,omitempty"` // Current session's reasoning mode
+	ForceThinking         bool                  `json:"force_thinking"`
+	PlanMode              bool                  `json:"plan_mode"`
+	SystemPrompt          string                `json:"system_prompt"`
+	Running               bool                  `json:"running"`
+	ActiveTurn            *activeTurn           `json:"active_turn,omitempty"`
+	Lock                  *sessionLock          `json:"lock,omitempty"`
+	FinishedTurns         []turnRecord          `json:"finished_turns,omitempty"` // Unseen detached turns
+	ContextChars          int                   `json:"context_chars"`
+	ContextTokens         int                   `json:"context_tokens"`
+	Usage                 state.Usage           `json:"usage"`                              // Tokens and cost of the current session
+	ContextEstimated      bool                  `json:"context_tokens_estimated,omitempty"` // No tokenizer vocabulary installed
+	ContextLimitTokens    int                   `json:"context_limit_tokens,omitempty"`
+	TotalTokens           int                   `json:"total_tokens"`
+	Model                 string                `json:"model"`
+	SummaryModel          string                `json:"summary_model,omitempty"`
+	Providers             []ProviderOption      `json:"providers,omitempty"`
+	ProviderModels        map[string]string     `json:"provider_models,omitempty"`
+	ProviderSummaryModels map[string]string     `json:"provider_summary_models,omitempty"`
+	ProviderVLModels      map[string]string     `json:"provider_vl_models,omitempty"`
+	CurrentProvider       string                `json:"current_provider,omitempty"`
+	ProviderQuota         *llm.AccountStatus    `json:"provider_quota,omitempty"`
+	OpenRouterFreeMode    bool                  `json:"openrouter_free_mode,omitempty"`
+	AnalyticsEnabled      bool                  `json:"analytics_enabled"`
+	ContextProfile        string                `json:"context_profile,omitempty"`
+	Plan                  *planSnapshot         `json:"plan,omitempty"`
+	PlanError             string                `json:"plan_error,omitempty"`
+	Workdir               string                `json:"workdir,omitempty"`
+	Config                *configSnapshot       `json:"config,omitempty"`
+	Workspace             *Workspace            `json:"workspace,omitempty"`
+	Workspaces            []Workspace           `json:"workspaces,omitempty"`
+	RecentWorkspaces      []Workspace           `json:"recent_workspaces,omitempty"`
+	LastTurnSummary       *turnSummary          `json:"last_turn_summary,omitempty"`
+	LastStatusReport      *tooling.StatusReport `json:"last_status_report,omitempty"`
+	HasOverview           bool                  `json:"has_overview,omitempty"`
+	Feedback              map[string]string     `json:"feedback,omitempty"` // Turn ID -> "up" or "down" for rated turns
+	Tasks                 *taskQueue            `json:"tasks,omitempty"`
+	QueuedPrompts         []queuedPrompt        `json:"queued_prompts,omitempty"`   // Prompts waiting for the running turn, in order
+	EditorSelection       *editorSelection      `json:"editor_selection,omitempty"` // Added to the next prompt's context
+	EditorConnected       bool                  `json:"editor_connected,omitempty"` // An editor polled /api/editor/commands recently
+	Demo                  bool                  `json:"demo,omitempty"`             // Read-only demo: prompts and changes are disabled
 }
 
 type configSnapshot struct {
@@ -975,6 +1262,10 @@ type configSnapshot struct {
 	ContextProtectRecent       int     `json:"context_protect_recent"`
 	SystemPrompt               string  `json:"system_prompt"`
 	RequestTimeoutSeconds      int     `json:"request_timeout_seconds"`
+	TerminalRecordCommands     bool    `json:"terminal_record_commands"`
+	ShellInteractive           bool    `json:"shell_interactive"`
+	TurnTimeLimitSeconds       int     `json:"turn_time_limit_seconds"`
+	BugHunt                    bool    `json:"bug_hunt"`
 }
 
 // getProvidersFromDisk reads current credentials and config from disk to build fresh provider list
@@ -991,11 +1282,12 @@ func (s *webServer) getProvidersFromDisk() ([]ProviderOption, string) {
 	}
 
 	// Build provider options from configured providers
+	cfg := s.agent.cfg.Load()
 	var providers []ProviderOption
 	for providerKey, builder := range s.agent.providerBuilders {
-		if creds.IsConfigured(providerKey) {
+		if creds.IsConfigured(providerKey) || !config.RequiresAPIKey(providerKey) {
 			apiKey := creds.GetAPIKey(providerKey)
-			reg, err := builder(s.agent.cfg, apiKey, s.logger)
+			reg, err := builder(cfg, apiKey, s.logger)
 			if err != nil {
 				continue
 			}
@@ -1018,11 +1310,11 @@ func (s *webServer) getProvidersFromDisk() ([]ProviderOption, string) {
 func (s *webServer) getWorkspaceFromRequest(r *http.Request) string {
 	// Check query parameter first
 	if ws := r.URL.Query().Get("workspace"); ws != "" {
-		return ws
+		return s.unmaskDemoPath(ws)
 	}
 	// Check header (sent by frontend from localStorage)
 	if ws := r.Header.Get("X-Workspace"); ws != "" {
-		return ws
+		return s.unmaskDemoPath(ws)
 	}
 	if s.workspaceManager != nil {
 		if current := s.workspaceManager.Current(); current != nil {
@@ -1055,6 +1347,10 @@ func (s *webServer) writeSessionPayload(w http.ResponseWriter, r *http.Request)
 		s.respondError(w, r, http.StatusInternalServerError, fmt.Sprintf("failed to build session: %v", err))
 		return
 	}
+	if workspace != "" && s.locks != nil {
+		s.locks.touch(workspace, requestClientID(r), time.Now())
+		payload.Lock = s.locks.info(workspace, requestClientID(r), time.Now())
+	}
 	s.writeJSON(w, r, payload)
 }
 
@@ -1063,32 +1359,37 @@ func (s *webServer) buildSessionPayload(ctx context.Context, workspacePath strin
 	activeModel := s.agent.getActiveModel()
 
 	payload := sessionPayload{
-		Thinking:              s.agent.cfg.ThinkingEnabled, // Use config value, not agent cache
-		ForceThinking:         s.agent.cfg.ForceThinking,   // Use config value, not agent cache
-		SystemPrompt:          s.agent.cfg.SystemPrompt,
+		Thinking:              s.agent.cfg.Load().ThinkingEnabled, // Use config value, not agent cache
+		ForceThinking:         s.agent.cfg.Load().ForceThinking,   // Use config value, not agent cache
+		SystemPrompt:          s.agent.cfg.Load().SystemPrompt,
 		Running:               s.agent.HasInFlightRequest(),
 		TotalTokens:           s.agent.getTotalTokens(),
 		Model:                 activeModel,
-		SummaryModel:          s.agent.cfg.SummaryModel,
+		SummaryModel:          s.agent.cfg.Load().SummaryModel,
 		Providers:             providers,
-		ProviderModels:        s.agent.cfg.ProviderModels,
-		ProviderSummaryModels: s.agent.cfg.ProviderSummaryModels,
-		ProviderVLModels:      s.agent.cfg.ProviderVLModels,
+		ProviderModels:        s.agent.cfg.Load().ProviderModels,
+		ProviderSummaryModels: s.agent.cfg.Load().ProviderSummaryModels,
+		ProviderVLModels:      s.agent.cfg.Load().ProviderVLModels,
 		CurrentProvider:       currentProvider,
-		OpenRouterFreeMode:    s.agent.cfg.OpenRouterFreeMode,
-		AnalyticsEnabled:      s.agent.cfg.IsAnalyticsEnabled(),
-		ContextProfile:        s.agent.cfg.ContextProfile, // Add missing field for profile dropdown
+		OpenRouterFreeMode:    s.agent.cfg.Load().OpenRouterFreeMode,
+		AnalyticsEnabled:      s.agent.cfg.Load().IsAnalyticsEnabled(),
+		ContextProfile:        s.agent.cfg.Load().ContextProfile, // Add missing field for profile dropdown
 		Config: &configSnapshot{ // Global config should always be available
-			ContextProfile:             s.agent.cfg.ContextProfile,
-			ContextMessagePercent:      s.agent.cfg.ContextMessagePercent,
-			ContextConversationPercent: s.agent.cfg.ContextTotalPercent,
-			ContextProtectRecent:       s.agent.cfg.ContextProtectRecent,
-			SystemPrompt:               s.agent.cfg.SystemPrompt,
-			RequestTimeoutSeconds:      s.agent.cfg.RequestTimeoutSeconds,
+			ContextProfile:             s.agent.cfg.Load().ContextProfile,
+			ContextMessagePercent:      s.agent.cfg.Load().ContextMessagePercent,
+			ContextConversationPercent: s.agent.cfg.Load().ContextTotalPercent,
+			ContextProtectRecent:       s.agent.cfg.Load().ContextProtectRecent,
+			SystemPrompt:               s.agent.cfg.Load().SystemPrompt,
+			RequestTimeoutSeconds:      s.agent.cfg.Load().RequestTimeoutSeconds,
+			TerminalRecordCommands:     s.agent.cfg.Load().TerminalRecordCommands,
+			ShellInteractive:           s.agent.cfg.Load().ShellInteractive,
+			TurnTimeLimitSeconds:       s.agent.cfg.Load().TurnTimeLimitSeconds,
+			BugHunt:                    s.agent.cfg.Load().BugHunt,
 		},
+		Demo: s.agent.demoDir != "",
 	}
 	if s.workspaceManager != nil {
-		payload.Workspaces = s.workspaceManager.List()
+		payload.Workspaces = s.workspaceManager.ListWithStats()
 		payload.RecentWorkspaces = s.workspaceManager.Recent()
 	}
 
@@ -1114,14 +1415,21 @@ func (s *webServer) buildSessionPayload(ctx context.Context, workspacePath strin
 		s.agent.storeLastPlan(plan)
 	}
 
+	payload.Running = wsCtx.HasInFlightRequest()
+	payload.TotalTokens = wsCtx.TotalTokens()
 	payload.CurrentKey = conv.Key()
 	payload.Keys = wsCtx.states.ListKeys()
 	payload.Sessions = wsCtx.states.Summaries()
 	payload.Messages = filterSystemMessages(messages)
+	payload.ThinkingMode = conv.ThinkingMode()
+	if !payload.ThinkingMode.Visible() {
+		payload.Messages = state.StripThinking(payload.Messages)
+	}
 	payload.ContextChars = conversationCharCount(messages)
+	payload.Usage = conv.Usage()
 	payload.Plan = plan
 	payload.Workdir = wsCtx.root
-	payload.PlanMode = wsCtx.planMode
+	payload.PlanMode = wsCtx.planMode.Load()
 	if planErr != nil {
 		payload.PlanError = planErr.Error()
 	}
@@ -1131,9 +1439,38 @@ func (s *webServer) buildSessionPayload(ctx context.Context, workspacePath strin
 		activeProvider = currentProvider
 	}
 	payload.ContextLimitTokens = config.GetModelContextLength(activeProvider, payload.Model)
+	tok := tokenizer.For(activeProvider, payload.Model)
+	payload.ContextTokens = tokenizer.CountMessages(tok, messages)
+	payload.ContextEstimated = !tok.Exact()
+	payload.ProviderQuota = s.agent.cachedAccountStatus(activeProvider)
+	if s.streams != nil {
+		if stream := s.streams.active(wsCtx.root); stream != nil {
+			payload.ActiveTurn = &activeTurn{TurnID: stream.id, LastEventID: stream.lastSeq()}
+		}
+	}
+	payload.FinishedTurns = s.unseenTurns(wsCtx.root)
+	if changes, err := loadTurnChanges(wsCtx.root, conv.Key()); err != nil {
+		s.logger.Printf("[ws:%s] load turn changes: %v", wsCtx.root, err)
+	} else if changes != nil {
+		payload.LastTurnSummary = &changes.Summary
+	}
+	payload.LastStatusReport = lastStatusReport(messages)
+	if overview, _ := loadOverview(wsCtx.root); overview != nil {
+		payload.HasOverview = true
+	}
+	payload.Feedback = sessionFeedback(wsCtx.root, conv.Key())
+	payload.Tasks = sessionTasks(wsCtx.root)
+	if s.prompts != nil {
+		payload.QueuedPrompts = s.prompts.list(wsCtx.root, conv.Key())
+	}
+	payload.EditorSelection = s.editor.selection(wsCtx.root)
+	payload.EditorConnected = s.editor.connected(wsCtx.root, time.Now())
 
 	if s.workspaceManager != nil {
 		payload.Workspace = s.workspaceManager.GetByPath(wsCtx.root)
+		if payload.Workspace != nil {
+			payload.Workspace.Stats = s.workspaceManager.stats(payload.Workspace.Path)
+		}
 	}
 
 	return payload, nil
@@ -1155,6 +1492,11 @@ func filterSystemMessages(messages []state.Message) []state.Message {
 
 func (s *webServer) handleCredentials(w http.ResponseWriter, r *http.Request) {
 	if r.Method == http.MethodGet {
+		// A demo answers with the bundled session, not a provider
+		if s.agent.demoDir != "" {
+			s.writeJSON(w, r, map[string]any{"configured": true, "demo": true})
+			return
+		}
 		// Check if credentials exist
 		if s.agent.credManager == nil {
 			s.writeJSON(w, r, map[string]any{
@@ -1176,17 +1518,37 @@ func (s *webServer) handleCredentials(w http.ResponseWriter, r *http.Request) {
 		}
 
 		configured := creds.HasAnyProvider()
+		cfg := s.agent.cfg.Load()
+		ollamaAvailable := ollama.Reachable(cfg.OllamaURL)
+		// Ollama started after cando: bring it up instead of onboarding
+		if !configured && ollamaAvailable && s.agent.client == nil {
+			if err := s.agent.ReloadProviders(); err != nil {
+				s.logger.Printf("Warning: failed to load Ollama provider: %v", err)
+				ollamaAvailable = false
+			}
+		}
 		resp := map[string]any{
-			"configured":            configured,
+			"configured":            configured || ollamaAvailable,
 			"provider":              creds.DefaultProvider,
 			"zai_configured":        creds.IsConfigured("zai"),
 			"openrouter_configured": creds.IsConfigured("openrouter"),
+			"openai_configured":     creds.IsConfigured("openai"),
+			"azure_configured":      creds.IsConfigured("azure"),
+			"azure_endpoint":        cfg.AzureOpenAIEndpoint,
+			"ollama_available":      ollamaAvailable,
+			"ollama_url":            cfg.OllamaURL,
 		}
 		if p, ok := creds.Providers["zai"]; ok {
 			resp["zai_vision_model"] = p.VisionModel
+			if !p.Scope.IsZero() {
+				resp["zai_scope"] = p.Scope
+			}
 		}
 		if p, ok := creds.Providers["openrouter"]; ok {
 			resp["openrouter_vision_model"] = p.VisionModel
+			if !p.Scope.IsZero() {
+				resp["openrouter_scope"] = p.Scope
+			}
 		}
 		s.writeJSON(w, r, resp)
 		return
@@ -1195,9 +1557,11 @@ func (s *webServer) handleCredentials(w http.ResponseWriter, r *http.Request) {
 	if r.Method == http.MethodPost {
 		// Save credentials
 		var req struct {
-			Provider    string `json:"provider"`
-			APIKey      string `json:"api_key"`
-			VisionModel string `json:"vision_model,omitempty"`
+			Provider    string             `json:"provider"`
+			APIKey      string             `json:"api_key"`
+			VisionModel string             `json:"vision_model,omitempty"`
+			Scope       *credentials.Scope `json:"scope,omitempty"`
+			Endpoint    string             `json:"endpoint,omitempty"` // Azure OpenAI resource URL
 		}
 
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -1228,10 +1592,21 @@ func (s *webServer) handleCredentials(w http.ResponseWriter, r *http.Request) {
 			creds.Providers = make(map[string]credentials.Provider)
 		}
 
+		// Keep the existing scope unless the request replaces it
+		scope := creds.Providers[req.Provider].Scope
+		if req.Scope != nil {
+			if err := req.Scope.Validate(); err != nil {
+				s.respondError(w, r, http.StatusBadRequest, err.Error())
+				return
+			}
+			scope = *req.Scope
+		}
+
 		// Add or update this provider (preserves other providers)
 		creds.Providers[req.Provider] = credentials.Provider{
 			APIKey:      req.APIKey,
 			VisionModel: req.VisionModel,
+			Scope:       scope,
 		}
 
 		// Set as default if no default provider set
@@ -1250,6 +1625,15 @@ func (s *webServer) handleCredentials(w http.ResponseWriter, r *http.Request) {
 			s.logger.Printf("Warning: failed to create default config: %v", err)
 		}
 
+		// The Azure endpoint lives in the config with the other base URLs
+		if endpoint := strings.TrimRight(strings.TrimSpace(req.Endpoint), "/"); req.Provider == "azure" && endpoint != "" {
+			updated := s.agent.cfg.Update(func(c *config.Config) { c.AzureOpenAIEndpoint = endpoint })
+			if err := config.Save(updated); err != nil {
+				s.respondError(w, r, http.StatusInternalServerError, fmt.Sprintf("failed to save config: %v", err))
+				return
+			}
+		}
+
 		// Reload providers dynamically
 		if err := s.agent.ReloadProviders(); err != nil {
 			s.logger.Printf("Warning: failed to reload providers: %v", err)
@@ -1319,6 +1703,7 @@ func (s *webServer) handleFileSearch(w http.ResponseWriter, r *http.Request) {
 
 	var matches []match
 	maxCollect := 500 // Safety limit to prevent memory issues
+	ignored := ignore.New(workspaceRoot)
 
 	err := filepath.Walk(workspaceRoot, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
@@ -1346,6 +1731,14 @@ func (s *webServer) handleFileSearch(w http.ResponseWriter, r *http.Request) {
 			relPath = path
 		}
 
+		// Skip what the workspace's .gitignore files exclude
+		if path != workspaceRoot && ignored.Ignored(relPath, info.IsDir()) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
 		// Match all files when query is empty, otherwise do substring match
 		matched := query == "" ||
 			strings.Contains(strings.ToLower(base), strings.ToLower(query)) ||
@@ -1417,6 +1810,10 @@ func (s *webServer) handleConfig(w http.ResponseWriter, r *http.Request) {
 			OpenRouterFreeMode         *bool    `json:"openrouter_free_mode"`
 			AnalyticsEnabled           *bool    `json:"analytics_enabled"`
 			RequestTimeoutSeconds      *int     `json:"request_timeout_seconds"`
+			TerminalRecordCommands     *bool    `json:"terminal_record_commands"`
+			ShellInteractive           *bool    `json:"shell_interactive"`
+			TurnTimeLimitSeconds       *int     `json:"turn_time_limit_seconds"`
+			BugHunt                    *bool    `json:"bug_hunt"`
 		}
 
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -1424,78 +1821,79 @@ func (s *webServer) handleConfig(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		// Validate and update compaction settings if provided
-		if req.ContextMessagePercent != nil {
-			if *req.ContextMessagePercent <= 0 || *req.ContextMessagePercent > 0.10 {
-				s.respondError(w, r, http.StatusBadRequest, "context_message_percent must be between 0 and 0.10 (0-10%)")
-				return
-			}
-			s.agent.cfg.ContextMessagePercent = *req.ContextMessagePercent
+		// Validate everything first so a bad field leaves the config untouched
+		if req.ContextMessagePercent != nil && (*req.ContextMessagePercent <= 0 || *req.ContextMessagePercent > 0.10) {
+			s.respondError(w, r, http.StatusBadRequest, "context_message_percent must be between 0 and 0.10 (0-10%)")
+			return
 		}
-		if req.ContextConversationPercent != nil {
-			if *req.ContextConversationPercent <= 0 || *req.ContextConversationPercent > 0.80 {
-				s.respondError(w, r, http.StatusBadRequest, "context_conversation_percent must be between 0 and 0.80 (0-80%)")
-				return
-			}
-			s.agent.cfg.ContextTotalPercent = *req.ContextConversationPercent
+		if req.ContextConversationPercent != nil && (*req.ContextConversationPercent <= 0 || *req.ContextConversationPercent > 0.80) {
+			s.respondError(w, r, http.StatusBadRequest, "context_conversation_percent must be between 0 and 0.80 (0-80%)")
+			return
 		}
-		if req.ContextProtectRecent != nil {
-			if *req.ContextProtectRecent < 0 {
-				s.respondError(w, r, http.StatusBadRequest, "context_protect_recent must be >= 0")
-				return
-			}
-			s.agent.cfg.ContextProtectRecent = *req.ContextProtectRecent
+		if req.ContextProtectRecent != nil && *req.ContextProtectRecent < 0 {
+			s.respondError(w, r, http.StatusBadRequest, "context_protect_recent must be >= 0")
+			return
 		}
-
-		// Update OpenRouter Free Mode if provided
-		if req.OpenRouterFreeMode != nil {
-			s.agent.cfg.OpenRouterFreeMode = *req.OpenRouterFreeMode
+		if req.RequestTimeoutSeconds != nil && (*req.RequestTimeoutSeconds < 90 || *req.RequestTimeoutSeconds > 300) {
+			s.respondError(w, r, http.StatusBadRequest, "request_timeout_seconds must be between 90 and 300")
+			return
 		}
-
-		// Update Analytics if provided
-		if req.AnalyticsEnabled != nil {
-			s.agent.cfg.AnalyticsEnabled = req.AnalyticsEnabled
-			analytics.SetEnabled(*req.AnalyticsEnabled)
+		if req.TurnTimeLimitSeconds != nil && *req.TurnTimeLimitSeconds < 0 {
+			s.respondError(w, r, http.StatusBadRequest, "turn_time_limit_seconds must be >= 0")
+			return
 		}
 
-		// Update Request Timeout if provided
-		if req.RequestTimeoutSeconds != nil {
-			if *req.RequestTimeoutSeconds < 90 || *req.RequestTimeoutSeconds > 300 {
-				s.respondError(w, r, http.StatusBadRequest, "request_timeout_seconds must be between 90 and 300")
-				return
+		updated := s.agent.cfg.Update(func(c *config.Config) {
+			// Compaction settings
+			if req.ContextMessagePercent != nil {
+				c.ContextMessagePercent = *req.ContextMessagePercent
+			}
+			if req.ContextConversationPercent != nil {
+				c.ContextTotalPercent = *req.ContextConversationPercent
+			}
+			if req.ContextProtectRecent != nil {
+				c.ContextProtectRecent = *req.ContextProtectRecent
 			}
-			s.agent.cfg.RequestTimeoutSeconds = *req.RequestTimeoutSeconds
+			if req.OpenRouterFreeMode != nil {
+				c.OpenRouterFreeMode = *req.OpenRouterFreeMode
+			}
+			if req.AnalyticsEnabled != nil {
+				c.AnalyticsEnabled = req.AnalyticsEnabled
+			}
+			if req.RequestTimeoutSeconds != nil {
+				c.RequestTimeoutSeconds = *req.RequestTimeoutSeconds
+			}
+			// Append in-UI terminal commands to the conversation
+			if req.TerminalRecordCommands != nil {
+				c.TerminalRecordCommands = *req.TerminalRecordCommands
+			}
+			// Let the shell tool hand interactive commands to the user
+			if req.ShellInteractive != nil {
+				c.ShellInteractive = *req.ShellInteractive
+			}
+			// Per-turn time budget (0 disables it)
+			if req.TurnTimeLimitSeconds != nil {
+				c.TurnTimeLimitSeconds = *req.TurnTimeLimitSeconds
+			}
+			// Seed turns with the history of the files they mention
+			if req.BugHunt != nil {
+				c.BugHunt = *req.BugHunt
+			}
+		})
+		if req.AnalyticsEnabled != nil {
+			analytics.SetEnabled(*req.AnalyticsEnabled)
 		}
 
 		// Save to config file
-		if err := config.Save(s.agent.cfg); err != nil {
+		if err := config.Save(updated); err != nil {
 			s.respondError(w, r, http.StatusInternalServerError, fmt.Sprintf("failed to save config: %v", err))
 			return
 		}
 
 		// Reload all workspace profiles with new config
-		s.agent.workspacesMu.RLock()
-		for _, wsCtx := range s.agent.workspaceContexts {
-			if reloadable, ok := wsCtx.profile.(interface {
-				ReloadConfig(config.Config) error
-			}); ok {
-				if err := reloadable.ReloadConfig(s.agent.cfg); err != nil {
-					s.agent.workspacesMu.RUnlock()
-					s.respondError(w, r, http.StatusInternalServerError, fmt.Sprintf("failed to reload workspace profile: %v", err))
-					return
-				}
-			}
-		}
-		s.agent.workspacesMu.RUnlock()
-
-		// Also reload default profile for CLI mode
-		if reloadable, ok := s.agent.profile.(interface {
-			ReloadConfig(config.Config) error
-		}); ok {
-			if err := reloadable.ReloadConfig(s.agent.cfg); err != nil {
-				s.respondError(w, r, http.StatusInternalServerError, fmt.Sprintf("failed to reload profile: %v", err))
-				return
-			}
+		if err := s.agent.reloadProfiles(); err != nil {
+			s.respondError(w, r, http.StatusInternalServerError, fmt.Sprintf("failed to %v", err))
+			return
 		}
 
 		s.writeJSON(w, r, map[string]string{"status": "saved"})
@@ -1518,9 +1916,9 @@ func (s *webServer) handleSystemPrompt(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	trimmed := strings.TrimSpace(req.Prompt)
-	s.agent.UpdateSystemPrompt(trimmed)
+	updated := s.agent.UpdateSystemPrompt(trimmed)
 
-	if err := config.Save(s.agent.cfg); err != nil {
+	if err := config.Save(updated); err != nil {
 		s.respondError(w, r, http.StatusInternalServerError, fmt.Sprintf("failed to save system prompt: %v", err))
 		return
 	}
@@ -1888,6 +2286,34 @@ func findAvailableBranchName(states *state.Manager, baseKey string) string {
 	return fmt.Sprintf("%s-branch", baseKey)
 }
 
+// branchSession copies the current conversation's messages up to (not
+// including) index into a new session and returns the new session key.
+func branchSession(states *state.Manager, index int) (string, error) {
+	currentConv := states.Current()
+	currentMessages := currentConv.Messages()
+	if index < 0 || index > len(currentMessages) {
+		return "", fmt.Errorf("invalid message index %d", index)
+	}
+
+	// Generate simple session name with counter suffix
+	newKey := findAvailableBranchName(states, currentConv.Key())
+
+	// Create new session
+	newConv, err := states.NewState(newKey)
+	if err != nil {
+		return "", fmt.Errorf("failed to create new session: %w", err)
+	}
+
+	// Set messages in new conversation
+	newConv.ReplaceMessages(currentMessages[0:index])
+
+	// Save new conversation
+	if err := states.Save(newConv); err != nil {
+		return "", fmt.Errorf("failed to save new session: %w", err)
+	}
+	return newKey, nil
+}
+
 // handleBranch creates a new session by branching from current session at a specific message index
 func (s *webServer) handleBranch(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
@@ -1922,38 +2348,19 @@ func (s *webServer) handleBranch(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Get current conversation
-	currentConv := wsCtx.states.Current()
-	currentMessages := currentConv.Messages()
-
-	if req.EditIndex < 0 || req.EditIndex >= len(currentMessages) {
+	if req.EditIndex < 0 || req.EditIndex >= len(wsCtx.states.Current().Messages()) {
 		s.respondError(w, r, http.StatusBadRequest, "invalid edit_index")
 		return
 	}
 
-	// Generate simple session name with counter suffix
-	currentKey := currentConv.Key()
-	newKey := findAvailableBranchName(wsCtx.states, currentKey)
-
-	// Create new session
-	newConv, err := wsCtx.states.NewState(newKey)
-	if err != nil {
-		s.respondError(w, r, http.StatusInternalServerError, fmt.Sprintf("failed to create new session: %v", err))
-		return
-	}
-
-	// Copy messages up to (not including) the edit index
 	// Do NOT include the edited message - frontend will submit it
-	messagesToCopy := currentMessages[0:req.EditIndex]
-
-	// Set messages in new conversation
-	newConv.ReplaceMessages(messagesToCopy)
-
-	// Save new conversation
-	if err := wsCtx.states.Save(newConv); err != nil {
-		s.respondError(w, r, http.StatusInternalServerError, fmt.Sprintf("failed to save new session: %v", err))
+	from := wsCtx.states.CurrentKey()
+	newKey, err := branchSession(wsCtx.states, req.EditIndex)
+	if err != nil {
+		s.respondError(w, r, http.StatusInternalServerError, err.Error())
 		return
 	}
+	recordBranchActivity(wsCtx, from, newKey, req.EditIndex, s.logger)
 
 	s.writeJSON(w, r, map[string]interface{}{
 		"new_session_key": newKey,
@@ -2037,7 +2444,7 @@ func (s *webServer) handlePlanMode(w http.ResponseWriter, r *http.Request) {
 
 	switch r.Method {
 	case http.MethodGet:
-		s.writeJSON(w, r, map[string]bool{"planMode": wsCtx.planMode})
+		s.writeJSON(w, r, map[string]bool{"planMode": wsCtx.planMode.Load()})
 
 	case http.MethodPost:
 		var req struct {
@@ -2048,8 +2455,8 @@ func (s *webServer) handlePlanMode(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		wsCtx.planMode = req.Enabled
-		s.writeJSON(w, r, map[string]bool{"planMode": wsCtx.planMode})
+		wsCtx.planMode.Store(req.Enabled)
+		s.writeJSON(w, r, map[string]bool{"planMode": req.Enabled})
 
 	default:
 		s.respondError(w, r, http.StatusMethodNotAllowed, "method not allowed")
@@ -2064,10 +2471,6 @@ const (
 	updateDownloadTimeout = 120 * time.Second
 )
 
-func (s *webServer) handleHealth(w http.ResponseWriter, r *http.Request) {
-	s.writeJSON(w, r, map[string]string{"status": "ok"})
-}
-
 func (s *webServer) handleUpdateCheck(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		s.respondError(w, r, http.StatusMethodNotAllowed, "method not allowed")
@@ -2168,6 +2571,37 @@ func (s *webServer) handleTelemetry(w http.ResponseWriter, r *http.Request) {
 	s.writeJSON(w, r, map[string]string{"status": "ok"})
 }
 
+// workspaceFilePath resolves a path for the /api/files handlers with the
+// same symlink-aware containment check the agent's tools use. The workspace
+// must be registered; allowRoot permits the workspace directory itself.
+func (s *webServer) workspaceFilePath(w http.ResponseWriter, r *http.Request, workspace, path string, allowRoot bool) (string, bool) {
+	return s.resolveWorkspaceFile(w, r, workspace, path, allowRoot, tooling.ResolveWithin)
+}
+
+// workspaceEntryPath is workspaceFilePath for deleting or renaming: a
+// symlink in the final component is acted on itself, not followed.
+func (s *webServer) workspaceEntryPath(w http.ResponseWriter, r *http.Request, workspace, path string) (string, bool) {
+	return s.resolveWorkspaceFile(w, r, workspace, path, false, tooling.ResolveEntryWithin)
+}
+
+func (s *webServer) resolveWorkspaceFile(w http.ResponseWriter, r *http.Request, workspace, path string, allowRoot bool, resolve func(root, path string, allowExternal bool) (string, error)) (string, bool) {
+	if !s.workspaceExists(workspace) {
+		s.respondError(w, r, http.StatusBadRequest, "unknown workspace")
+		return "", false
+	}
+	allowExternal := s.agent.cfg.Load().AllowExternalSymlinks
+	fullPath, err := resolve(workspace, path, allowExternal)
+	if err != nil {
+		s.respondError(w, r, http.StatusForbidden, err.Error())
+		return "", false
+	}
+	if root, _ := tooling.ResolveWithin(workspace, "", allowExternal); !allowRoot && fullPath == root {
+		s.respondError(w, r, http.StatusForbidden, "path must be inside the workspace")
+		return "", false
+	}
+	return fullPath, true
+}
+
 // FileTreeEntry represents a file or directory in the tree
 type FileTreeEntry struct {
 	Name     string          `json:"name"`
@@ -2190,7 +2624,7 @@ func (s *webServer) handleFilesTree(w http.ResponseWriter, r *http.Request) {
 
 	// Validate workspace path exists
 	info, err := os.Stat(workspacePath)
-	if err != nil || !info.IsDir() {
+	if err != nil || !info.IsDir() || !s.workspaceExists(workspacePath) {
 		s.respondError(w, r, http.StatusBadRequest, "invalid workspace path")
 		return
 	}
@@ -2271,12 +2705,8 @@ func (s *webServer) handleFilesRead(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Construct full path and validate it's within workspace
-	fullPath := filepath.Join(workspacePath, filePath)
-	fullPath = filepath.Clean(fullPath)
-
-	if !strings.HasPrefix(fullPath, filepath.Clean(workspacePath)) {
-		s.respondError(w, r, http.StatusForbidden, "path traversal not allowed")
+	fullPath, ok := s.workspaceFilePath(w, r, workspacePath, filePath, false)
+	if !ok {
 		return
 	}
 
@@ -2344,12 +2774,8 @@ func (s *webServer) handleFilesSave(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Construct full path and validate it's within workspace
-	fullPath := filepath.Join(req.Workspace, req.Path)
-	fullPath = filepath.Clean(fullPath)
-
-	if !strings.HasPrefix(fullPath, filepath.Clean(req.Workspace)) {
-		s.respondError(w, r, http.StatusForbidden, "path traversal not allowed")
+	fullPath, ok := s.workspaceFilePath(w, r, req.Workspace, req.Path, false)
+	if !ok {
 		return
 	}
 
@@ -2401,11 +2827,8 @@ func (s *webServer) handleFilesCreate(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	fullPath := filepath.Join(req.Workspace, req.Path)
-	fullPath = filepath.Clean(fullPath)
-
-	if !strings.HasPrefix(fullPath, filepath.Clean(req.Workspace)) {
-		s.respondError(w, r, http.StatusForbidden, "path traversal not allowed")
+	fullPath, ok := s.workspaceFilePath(w, r, req.Workspace, req.Path, false)
+	if !ok {
 		return
 	}
 
@@ -2455,11 +2878,8 @@ func (s *webServer) handleFilesMkdir(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	fullPath := filepath.Join(req.Workspace, req.Path)
-	fullPath = filepath.Clean(fullPath)
-
-	if !strings.HasPrefix(fullPath, filepath.Clean(req.Workspace)) {
-		s.respondError(w, r, http.StatusForbidden, "path traversal not allowed")
+	fullPath, ok := s.workspaceFilePath(w, r, req.Workspace, req.Path, false)
+	if !ok {
 		return
 	}
 
@@ -2502,14 +2922,8 @@ func (s *webServer) handleFilesReveal(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// If path is empty, reveal the workspace folder itself
-	fullPath := req.Workspace
-	if req.Path != "" {
-		fullPath = filepath.Join(req.Workspace, req.Path)
-	}
-	fullPath = filepath.Clean(fullPath)
-
-	if !strings.HasPrefix(fullPath, filepath.Clean(req.Workspace)) {
-		s.respondError(w, r, http.StatusForbidden, "path traversal not allowed")
+	fullPath, ok := s.workspaceFilePath(w, r, req.Workspace, req.Path, true)
+	if !ok {
 		return
 	}
 
@@ -2562,17 +2976,13 @@ func (s *webServer) handleFilesDelete(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	fullPath := filepath.Join(req.Workspace, req.Path)
-	fullPath = filepath.Clean(fullPath)
-
-	// Prevent path traversal
-	if !strings.HasPrefix(fullPath, filepath.Clean(req.Workspace)+string(filepath.Separator)) {
-		s.respondError(w, r, http.StatusForbidden, "path traversal not allowed")
+	fullPath, ok := s.workspaceEntryPath(w, r, req.Workspace, req.Path)
+	if !ok {
 		return
 	}
 
 	// Check if path exists
-	info, err := os.Stat(fullPath)
+	info, err := os.Lstat(fullPath)
 	if os.IsNotExist(err) {
 		s.respondError(w, r, http.StatusNotFound, "file not found")
 		return
@@ -2623,31 +3033,23 @@ func (s *webServer) handleFilesRename(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	oldFullPath := filepath.Join(req.Workspace, req.OldPath)
-	oldFullPath = filepath.Clean(oldFullPath)
-	newFullPath := filepath.Join(req.Workspace, req.NewPath)
-	newFullPath = filepath.Clean(newFullPath)
-
-	cleanWorkspace := filepath.Clean(req.Workspace) + string(filepath.Separator)
-
-	// Prevent path traversal for both paths
-	if !strings.HasPrefix(oldFullPath, cleanWorkspace) {
-		s.respondError(w, r, http.StatusForbidden, "path traversal not allowed")
+	oldFullPath, ok := s.workspaceEntryPath(w, r, req.Workspace, req.OldPath)
+	if !ok {
 		return
 	}
-	if !strings.HasPrefix(newFullPath, cleanWorkspace) {
-		s.respondError(w, r, http.StatusForbidden, "path traversal not allowed")
+	newFullPath, ok := s.workspaceEntryPath(w, r, req.Workspace, req.NewPath)
+	if !ok {
 		return
 	}
 
 	// Check if source exists
-	if _, err := os.Stat(oldFullPath); os.IsNotExist(err) {
+	if _, err := os.Lstat(oldFullPath); os.IsNotExist(err) {
 		s.respondError(w, r, http.StatusNotFound, "source file not found")
 		return
 	}
 
 	// Check if destination already exists
-	if _, err := os.Stat(newFullPath); err == nil {
+	if _, err := os.Lstat(newFullPath); err == nil {
 		s.respondError(w, r, http.StatusConflict, "destination already exists")
 		return
 	}
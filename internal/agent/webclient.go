@@ -0,0 +1,79 @@
+package agent
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// unixAddrPrefix marks a web listen address as a Unix socket path.
+const unixAddrPrefix = "unix:"
+
+// socketPath returns the socket path of a "unix:/path" address.
+func socketPath(addr string) (string, bool) {
+	if !strings.HasPrefix(addr, unixAddrPrefix) {
+		return "", false
+	}
+	return strings.TrimPrefix(addr, unixAddrPrefix), true
+}
+
+// WebClient returns an HTTP client and base URL for talking to a running
+// Cando web server at addr: host:port, or unix:/path for a Unix socket.
+// With TLS the certificate is not verified, since the server is typically
+// local and self-signed.
+func WebClient(addr, scheme string, timeout time.Duration) (*http.Client, string) {
+	transport := &http.Transport{}
+	baseURL := scheme + "://" + addr
+	if path, ok := socketPath(addr); ok {
+		transport.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", path)
+		}
+		baseURL = "http://localhost"
+	} else if scheme == "https" {
+		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+	return &http.Client{Transport: transport, Timeout: timeout}, baseURL
+}
+
+// listenWeb opens the web listener. Unix sockets get owner-only (or group)
+// permissions; a stale socket file left by a crashed server is replaced.
+func listenWeb(addr string, groupAccess bool) (net.Listener, error) {
+	path, ok := socketPath(addr)
+	if !ok {
+		return net.Listen("tcp", addr)
+	}
+	if conn, err := net.DialTimeout("unix", path, 500*time.Millisecond); err == nil {
+		conn.Close()
+		return nil, fmt.Errorf("socket %s is already in use", path)
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("remove stale socket: %w", err)
+	}
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	mode := os.FileMode(0o600)
+	if groupAccess {
+		mode = 0o660
+	}
+	if err := os.Chmod(path, mode); err != nil {
+		listener.Close()
+		return nil, fmt.Errorf("set socket permissions: %w", err)
+	}
+	return listener, nil
+}
+
+// viaUnixSocket reports whether r arrived on a Unix socket listener, where
+// filesystem permissions already restrict who can connect.
+func viaUnixSocket(r *http.Request) bool {
+	addr, ok := r.Context().Value(http.LocalAddrContextKey).(net.Addr)
+	return ok && addr.Network() == "unix"
+}
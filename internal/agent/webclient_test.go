@@ -0,0 +1,45 @@
+package agent
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWebServerOverUnixSocket(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cando.sock")
+	if err := os.WriteFile(path, nil, 0o600); err != nil { // Stale socket file
+		t.Fatal(err)
+	}
+	listener, err := listenWeb("unix:"+path, false)
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	info, err := os.Stat(path)
+	if err != nil || info.Mode().Perm() != 0o600 {
+		t.Fatalf("socket permissions: %v %v", info, err)
+	}
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !viaUnixSocket(r) {
+			t.Errorf("request not recognized as socket request")
+		}
+		w.Write([]byte("ok"))
+	})}
+	go server.Serve(listener)
+	defer server.Close()
+
+	if _, err := listenWeb("unix:"+path, false); err == nil {
+		t.Fatalf("second server took over a live socket")
+	}
+	client, baseURL := WebClient("unix:"+path, "http", 2*time.Second)
+	resp, err := client.Get(baseURL + "/api/health")
+	if err != nil {
+		t.Fatalf("request over socket: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("unexpected status %d", resp.StatusCode)
+	}
+}
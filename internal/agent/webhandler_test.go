@@ -0,0 +1,68 @@
+package agent
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"cando/internal/config"
+	"cando/internal/testmode"
+)
+
+func TestWebHandlerInTestMode(t *testing.T) {
+	configDir := t.TempDir()
+	t.Setenv("CANDO_CONFIG_DIR", configDir)
+	hooks := testmode.Apply(config.DefaultConfig(), nil)
+	defer hooks.Restore()
+
+	workspace := t.TempDir()
+	agent := newTestAgent(t, newScriptedClient(), baseTestConfig(workspace))
+	handler, err := agent.WebHandler()
+	if err != nil {
+		t.Fatalf("web handler: %v", err)
+	}
+	srv := httptest.NewServer(handler)
+	defer srv.Close()
+
+	body, _ := json.Marshal(map[string]string{"path": workspace})
+	resp, err := http.Post(srv.URL+"/api/workspace/add", "application/json", bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var added struct {
+		Workspace Workspace `json:"workspace"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&added)
+	resp.Body.Close()
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("add workspace: status %d, %v", resp.StatusCode, err)
+	}
+	if added.Workspace.Added.Before(testmode.Epoch) || added.Workspace.Added.After(testmode.Epoch.Add(time.Minute)) {
+		t.Fatalf("workspace timestamp %v does not come from the test clock", added.Workspace.Added)
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, srv.URL+"/api/knowledge/export", nil)
+	req.Header.Set("X-Workspace", workspace)
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var archive knowledgeArchive
+	err = json.NewDecoder(resp.Body).Decode(&archive)
+	resp.Body.Close()
+	if err != nil || resp.StatusCode != http.StatusOK || archive.Format != knowledgeFormat {
+		t.Fatalf("export: status %d, %+v, %v", resp.StatusCode, archive, err)
+	}
+
+	if err := config.Save(config.DefaultConfig()); err != nil || hooks.Config.Saves() != 1 {
+		t.Fatalf("config save should go to the memory store (%v)", err)
+	}
+	if _, err := os.Stat(filepath.Join(configDir, "config.yaml")); !os.IsNotExist(err) {
+		t.Fatalf("test mode wrote the config file: %v", err)
+	}
+}
@@ -0,0 +1,173 @@
+package agent
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const (
+	csrfCookie = "cando_csrf"
+	csrfHeader = "X-CSRF-Token"
+)
+
+// corsAllowedHeaders lists the request headers external frontends may send.
+var corsAllowedHeaders = strings.Join([]string{
+	"Content-Type", csrfHeader, "X-Workspace", "X-Client-ID", "X-Lock-Takeover",
+	"Idempotency-Key", "Last-Event-ID",
+}, ", ")
+
+func newCSRFToken() string {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		panic("csrf token: " + err.Error())
+	}
+	return hex.EncodeToString(buf)
+}
+
+// hostAllowed guards against DNS rebinding: the Host header must name the
+// machine directly (localhost or an IP address) or be configured explicitly.
+func hostAllowed(host string, allowed []string) bool {
+	if host == "" {
+		return true
+	}
+	name := host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		name = h
+	}
+	name = strings.TrimSuffix(strings.Trim(name, "[]"), ".")
+	if strings.EqualFold(name, "localhost") || strings.HasSuffix(strings.ToLower(name), ".localhost") {
+		return true
+	}
+	if net.ParseIP(name) != nil {
+		return true
+	}
+	for _, entry := range allowed {
+		if strings.EqualFold(entry, name) || strings.EqualFold(entry, host) {
+			return true
+		}
+	}
+	return false
+}
+
+// originAllowed accepts same-origin requests and configured CORS origins.
+func originAllowed(origin, host string, corsOrigins []string) (allowed, cors bool) {
+	u, err := url.Parse(origin)
+	if err != nil || u.Host == "" {
+		return false, false
+	}
+	if strings.EqualFold(u.Host, host) {
+		return true, false
+	}
+	for _, entry := range corsOrigins {
+		if strings.EqualFold(strings.TrimRight(entry, "/"), origin) {
+			return true, true
+		}
+	}
+	return false, false
+}
+
+// fromBrowser reports whether a request carries headers only browsers send.
+// CSRF needs a victim browser, so other clients (curl, scripts, editors)
+// need no token.
+func fromBrowser(r *http.Request) bool {
+	return r.Header.Get("Origin") != "" || r.Header.Get("Sec-Fetch-Site") != "" ||
+		r.Header.Get("Referer") != "" || strings.Contains(r.UserAgent(), "Mozilla/")
+}
+
+func isMutating(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return false
+	}
+	return true
+}
+
+// requireAPIToken rejects requests without the headless API token in an
+// "Authorization: Bearer" header. CORS preflights pass, since browsers send
+// them without credentials. Without a token every request passes.
+func (s *webServer) requireAPIToken(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := s.agent.apiToken
+		if token == "" || r.Method == http.MethodOptions {
+			next.ServeHTTP(w, r)
+			return
+		}
+		given, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(strings.TrimSpace(given)), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="cando"`)
+			s.respondError(w, r, http.StatusUnauthorized, "missing or invalid API token")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// guardRequests rejects requests with an unexpected Host or Origin (Host is
+// not checked on Unix sockets, which browsers cannot reach, nor when
+// requireAPIToken has already authenticated the request), answers
+// CORS preflights for configured origins, and requires the per-boot CSRF
+// token on mutating browser requests. The token reaches the UI through a
+// SameSite cookie and other frontends through GET /api/csrf.
+func (s *webServer) guardRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		web := s.agent.cfg.Load().Web
+		if s.agent.apiToken == "" && !viaUnixSocket(r) && !hostAllowed(r.Host, web.AllowedHosts) {
+			s.respondError(w, r, http.StatusForbidden, "host not allowed; add it to web.allowed_hosts")
+			return
+		}
+		if origin := r.Header.Get("Origin"); origin != "" {
+			allowed, cors := originAllowed(origin, r.Host, web.CORSOrigins)
+			if !allowed {
+				s.respondError(w, r, http.StatusForbidden, "origin not allowed; add it to web.cors_origins")
+				return
+			}
+			if cors {
+				w.Header().Set("Access-Control-Allow-Origin", origin)
+				w.Header().Add("Vary", "Origin")
+				if r.Method == http.MethodOptions {
+					w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
+					w.Header().Set("Access-Control-Allow-Headers", corsAllowedHeaders)
+					w.Header().Set("Access-Control-Max-Age", "600")
+					w.WriteHeader(http.StatusNoContent)
+					return
+				}
+			}
+		}
+		if isMutating(r.Method) && fromBrowser(r) {
+			token := r.Header.Get(csrfHeader)
+			if token == "" {
+				token = r.URL.Query().Get("csrf_token") // sendBeacon cannot set headers
+			}
+			if subtle.ConstantTimeCompare([]byte(token), []byte(s.csrfToken)) != 1 {
+				s.respondError(w, r, http.StatusForbidden, "missing or invalid CSRF token")
+				return
+			}
+		}
+		if r.Method == http.MethodGet && !strings.HasPrefix(r.URL.Path, "/api/") {
+			http.SetCookie(w, &http.Cookie{
+				Name:     csrfCookie,
+				Value:    s.csrfToken,
+				Path:     "/",
+				Secure:   r.TLS != nil,
+				SameSite: http.SameSiteStrictMode,
+			})
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// handleCSRF returns the CSRF token. Browsers on other origins cannot read
+// the reply unless their origin is listed in web.cors_origins.
+func (s *webServer) handleCSRF(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.respondError(w, r, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	s.writeJSON(w, r, map[string]string{"token": s.csrfToken, "header": csrfHeader})
+}
@@ -0,0 +1,85 @@
+package agent
+
+import (
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"cando/internal/llm"
+)
+
+func TestGuardRequests(t *testing.T) {
+	cfg := baseTestConfig(t.TempDir())
+	cfg.Web.CORSOrigins = []string{"https://ui.example.com"}
+	s := &webServer{
+		agent:     newTestAgent(t, newScriptedClient(llm.ChatResponse{}), cfg),
+		logger:    log.New(io.Discard, "", 0),
+		csrfToken: "secret",
+	}
+	handler := s.guardRequests(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	cases := []struct {
+		name    string
+		method  string
+		host    string
+		headers map[string]string
+		want    int
+	}{
+		{"rebound host", http.MethodGet, "evil.example.com:3737", nil, http.StatusForbidden},
+		{"cross-site post", http.MethodPost, "127.0.0.1:3737", map[string]string{"Origin": "https://evil.example.com"}, http.StatusForbidden},
+		{"same-origin post without token", http.MethodPost, "127.0.0.1:3737", map[string]string{"Origin": "http://127.0.0.1:3737"}, http.StatusForbidden},
+		{"same-origin post with token", http.MethodPost, "127.0.0.1:3737", map[string]string{"Origin": "http://127.0.0.1:3737", csrfHeader: "secret"}, http.StatusOK},
+		{"script without browser headers", http.MethodPost, "localhost:3737", nil, http.StatusOK},
+		{"cors preflight", http.MethodOptions, "127.0.0.1:3737", map[string]string{"Origin": "https://ui.example.com"}, http.StatusNoContent},
+	}
+	for _, tc := range cases {
+		req := httptest.NewRequest(tc.method, "/api/prompt", nil)
+		req.Host = tc.host
+		for k, v := range tc.headers {
+			req.Header.Set(k, v)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != tc.want {
+			t.Errorf("%s: got %d, want %d", tc.name, rec.Code, tc.want)
+		}
+	}
+}
+
+func TestRequireAPIToken(t *testing.T) {
+	agent := newTestAgent(t, newScriptedClient(llm.ChatResponse{}), baseTestConfig(t.TempDir()))
+	agent.apiToken = "s3cret"
+	s := &webServer{agent: agent, logger: log.New(io.Discard, "", 0), csrfToken: "csrf"}
+	handler := s.requireAPIToken(s.guardRequests(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})))
+
+	cases := []struct {
+		name   string
+		method string
+		auth   string
+		want   int
+	}{
+		{"no token", http.MethodGet, "", http.StatusUnauthorized},
+		{"wrong token", http.MethodPost, "Bearer nope", http.StatusUnauthorized},
+		{"other scheme", http.MethodGet, "Basic s3cret", http.StatusUnauthorized},
+		{"valid token", http.MethodPost, "Bearer s3cret", http.StatusOK},
+		{"preflight", http.MethodOptions, "", http.StatusOK},
+	}
+	for _, tc := range cases {
+		req := httptest.NewRequest(tc.method, "/api/prompt", nil)
+		// Any host name is fine once the request is authenticated
+		req.Host = "ci-runner.internal:3737"
+		if tc.auth != "" {
+			req.Header.Set("Authorization", tc.auth)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != tc.want {
+			t.Errorf("%s: got %d, want %d", tc.name, rec.Code, tc.want)
+		}
+		if tc.want == http.StatusUnauthorized && rec.Header().Get("WWW-Authenticate") == "" {
+			t.Errorf("%s: no WWW-Authenticate header", tc.name)
+		}
+	}
+}
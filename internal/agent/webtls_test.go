@@ -0,0 +1,38 @@
+package agent
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"cando/internal/config"
+)
+
+func TestSelfSignedCertIsReusedUntilRenewal(t *testing.T) {
+	t.Setenv("CANDO_CONFIG_DIR", t.TempDir())
+	tlsConfig, err := webTLSConfig(config.WebTLS{Enabled: true}, []string{"cando.internal"})
+	if err != nil {
+		t.Fatalf("tls config: %v", err)
+	}
+	leaf := tlsConfig.Certificates[0].Leaf
+	if leaf == nil || leaf.VerifyHostname("cando.internal") != nil || leaf.VerifyHostname("127.0.0.1") != nil {
+		t.Fatalf("certificate does not cover configured hosts")
+	}
+
+	certFile := filepath.Join(config.GetConfigDir(), "tls", "cert.pem")
+	keyFile := filepath.Join(config.GetConfigDir(), "tls", "key.pem")
+	before, _ := os.ReadFile(certFile)
+	if err := ensureSelfSignedCert(certFile, keyFile, []string{"cando.internal"}, time.Now()); err != nil {
+		t.Fatalf("ensure cert: %v", err)
+	}
+	if after, _ := os.ReadFile(certFile); string(after) != string(before) {
+		t.Fatalf("valid certificate was regenerated")
+	}
+	if err := ensureSelfSignedCert(certFile, keyFile, nil, time.Now().Add(selfSignedValidity)); err != nil {
+		t.Fatalf("renew cert: %v", err)
+	}
+	if after, _ := os.ReadFile(certFile); string(after) == string(before) {
+		t.Fatalf("expiring certificate was not renewed")
+	}
+}
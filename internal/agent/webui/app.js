@@ -8,6 +8,7 @@ const ui = {
   sendBtn: null,
   cancelBtn: null,
   thinkingToggle: null,
+  thinkingModeSelect: null,
   forceThinkingToggle: null,
   systemPromptInput: null,
   statusText: null,
@@ -81,7 +82,30 @@ const appState = {
   bellEnabled: true,     // Bell sound on task completion
   bellAudio: null,       // Audio element for bell sound
   bellArmed: false,      // Only play bell after LLM work starts (not on page load)
+  lastEventId: null,     // "<turn>:<seq>" of the last stream event seen
+  resuming: false,       // Replaying a turn after reconnect
   contextMenuTarget: null, // Current right-clicked file/folder for context menu
+  pinnedFiles: [],       // Files sent as pinned_files with the next prompt
+  queuedTurnStarted: false, // A queued prompt started while this tab was busy
+};
+
+// The server sets a per-boot CSRF token cookie with the page; attach it to
+// every mutating same-origin request.
+function getCsrfToken() {
+  const match = document.cookie.match(/(?:^|;\s*)cando_csrf=([^;]+)/);
+  return match ? match[1] : '';
+}
+
+const nativeFetch = window.fetch.bind(window);
+window.fetch = (input, init = {}) => {
+  const method = (init.method || (input instanceof Request ? input.method : 'GET')).toUpperCase();
+  const url = new URL(input instanceof Request ? input.url : input, window.location.href);
+  if (method !== 'GET' && method !== 'HEAD' && url.origin === window.location.origin) {
+    const headers = new Headers(init.headers || {});
+    headers.set('X-CSRF-Token', getCsrfToken());
+    init = { ...init, headers };
+  }
+  return nativeFetch(input, init);
 };
 
 // Custom alert dialog - returns a Promise that resolves when user clicks OK
@@ -260,6 +284,7 @@ async function initUI() {
   ui.sendBtn = document.getElementById('sendBtn');
   ui.cancelBtn = document.getElementById('cancelBtn');
   ui.thinkingToggle = document.getElementById('thinkingToggle');
+  ui.thinkingModeSelect = document.getElementById('thinkingModeSelect');
   ui.forceThinkingToggle = document.getElementById('forceThinkingToggle');
   ui.systemPromptInput = document.getElementById('systemPromptInput');
   ui.statusText = document.getElementById('statusText');
@@ -347,6 +372,7 @@ async function initUI() {
 
   ui.cancelBtn.addEventListener('click', cancelRequest);
   ui.thinkingToggle.addEventListener('click', toggleThinking);
+  ui.thinkingModeSelect?.addEventListener('change', (e) => setThinkingMode(e.target.value));
   if (ui.forceThinkingToggle) {
     ui.forceThinkingToggle.addEventListener('click', toggleForceThinking);
   }
@@ -364,6 +390,12 @@ async function initUI() {
     ui.requestTimeoutInput.addEventListener('change', saveRequestTimeout);
   }
   ui.compactionHistoryBtn.addEventListener('click', showCompactionHistory);
+  document.getElementById('processesBtn')?.addEventListener('click', showProcesses);
+  document.getElementById('refreshProcessesBtn')?.addEventListener('click', loadProcesses);
+  document.getElementById('closeProcessesDialog')?.addEventListener('click', closeProcesses);
+  document.getElementById('processesDialog')?.addEventListener('click', (e) => {
+    if (e.target.id === 'processesDialog') closeProcesses();
+  });
   ui.closeCompactionDialog.addEventListener('click', closeCompactionHistory);
   ui.compactionDialog.addEventListener('click', (e) => {
     if (e.target === ui.compactionDialog) {
@@ -455,6 +487,8 @@ async function initUI() {
     }
   });
 
+  setupChatExportActions();
+
   // New Chat button in toolbar
   if (ui.newChatBtn) {
     ui.newChatBtn.addEventListener('click', () => {
@@ -498,7 +532,13 @@ async function initUI() {
         ui.apiKeyHelp.innerHTML = 'Get your Z.AI key at: <a href="https://z.ai" target="_blank">z.ai</a>';
       } else if (provider === 'openrouter') {
         ui.apiKeyHelp.innerHTML = 'Get your OpenRouter key at: <a href="https://openrouter.ai/keys" target="_blank">openrouter.ai/keys</a>';
+      } else if (provider === 'openai') {
+        ui.apiKeyHelp.innerHTML = 'Get your OpenAI key at: <a href="https://platform.openai.com/api-keys" target="_blank">platform.openai.com/api-keys</a>';
+      } else if (provider === 'azure') {
+        ui.apiKeyHelp.textContent = 'Use a key from your Azure OpenAI resource (Keys and Endpoint). Models are your deployment names.';
       }
+      const azureGroup = document.getElementById('azureEndpointGroup');
+      if (azureGroup) azureGroup.style.display = provider === 'azure' ? '' : 'none';
     });
   }
 
@@ -517,11 +557,14 @@ async function initUI() {
   initPreviewPanel();
   sendTelemetry();
   updateStatusBar();
+  startSessionLockHeartbeat();
+  listenServerEvents();
 
   document.addEventListener('keydown', handleGlobalKeydown);
 }
 
 async function refreshSession() {
+  appState.queuedTurnStarted = false;
   setBusy(true, 'Syncing context…');
   try {
     const res = await fetchWithWorkspace('/api/session');
@@ -539,6 +582,22 @@ async function refreshSession() {
     render();
     setStatus(appState.data.running ? 'Sublimating… (Esc to cancel)' : 'Ready.');
 
+    // A turn is still running after a page reload: follow it live, over the
+    // socket when it is open (its connected frame covers the other case)
+    const active = appState.data.active_turn;
+    if (active && !appState.currentAbortController && !appState.resuming) {
+      if (socketReady()) {
+        setTimeout(() => followSocketTurn(active), 0);
+      } else if (!('WebSocket' in window)) {
+        setTimeout(() => resumeStream(`${active.turn_id}:${active.last_event_id}`), 0);
+      }
+    }
+    connectSocket();
+    announceFinishedTurns(appState.data.finished_turns);
+    if (appState.data.lock && !appState.data.lock.mine) {
+      setStatus('Another tab is working in this workspace; your next change will ask to take over.');
+    }
+
     // Refresh file explorer
     if (typeof loadFileTree === 'function') {
       loadFileTree();
@@ -554,6 +613,8 @@ async function refreshSession() {
 function render() {
   if (!appState.data) return;
   renderMessages();
+  renderQueuedPrompts();
+  renderEditorSelection();
   renderPlan();
   renderModelSelector();
   updateStatusMeta();
@@ -572,7 +633,7 @@ function render() {
   if (ui.promptInput) {
     if (hasProject) {
       ui.promptInput.disabled = false;
-      ui.promptInput.readOnly = !!appState.busy;
+      ui.promptInput.readOnly = false;
       ui.promptInput.placeholder = 'Ask Cando anything… (Enter to send, Shift+Enter for new line)';
     } else {
       ui.promptInput.value = '';
@@ -584,12 +645,25 @@ function render() {
   if (ui.sendBtn && !appState.busy) {
     ui.sendBtn.disabled = !hasProject;
   }
+  // A demo only shows the bundled session; the server rejects changes
+  document.body.classList.toggle('demo-mode', !!appState.data.demo);
+  if (appState.data.demo) {
+    if (ui.promptInput) {
+      ui.promptInput.disabled = true;
+      ui.promptInput.placeholder = 'Read-only demo: prompts and changes are disabled';
+    }
+    if (ui.sendBtn) ui.sendBtn.disabled = true;
+  }
   ui.thinkingToggle.textContent = appState.data.thinking ? 'On' : 'Off';
   ui.thinkingToggle.classList.toggle('active', appState.data.thinking);
   if (ui.forceThinkingToggle) {
     ui.forceThinkingToggle.textContent = appState.data.force_thinking ? 'On' : 'Off';
     ui.forceThinkingToggle.classList.toggle('active', appState.data.force_thinking);
   }
+  if (ui.thinkingModeSelect) {
+    ui.thinkingModeSelect.value = appState.data.thinking_mode || 'collapse';
+    ui.thinkingModeSelect.disabled = !appState.data.current_key;
+  }
   if (ui.planModeBtn) {
     ui.planModeBtn.classList.toggle('active', appState.data.plan_mode);
   }
@@ -683,7 +757,8 @@ function renderMessages() {
     if (segments.length > 0) {
       const showRole = previousRole !== 'assistant';
       const isLatest = offset + lastAssistantIndex === findLastPrimaryMessageIndex(appState.data.messages);
-      const node = createAssistantSegments(segments, isLatest, showRole);
+      const turnId = messages[lastAssistantIndex].turn_id;
+      const node = createAssistantSegments(segments, isLatest, showRole, turnId);
       if (node) {
         ui.messages.appendChild(node);
       }
@@ -691,11 +766,362 @@ function renderMessages() {
     }
   }
 
+  renderOverviewCard();
+  renderStatusReport();
+  renderTurnSummary();
   scrollMessagesToBottom();
 }
 
+// A fresh chat offers to explain the repository, or shows the overview
+// :explain wrote earlier
+async function renderOverviewCard() {
+  if (appState.data?.messages?.length || appState.data?.demo) return;
+  const card = document.createElement('div');
+  card.className = 'project-overview';
+  if (!appState.data?.has_overview) {
+    card.innerHTML = `
+      <div class="project-overview-intro">New to this project? Cando can explore it and write an overview: architecture, entry points, and how to build and test.</div>
+      <button class="primary" type="button">Explain this repo</button>
+    `;
+    card.querySelector('button').addEventListener('click', () => {
+      ui.promptInput.value = ':explain';
+      submitPrompt();
+    });
+    ui.messages.appendChild(card);
+    return;
+  }
+  try {
+    const res = await fetchWithWorkspace('/api/overview');
+    if (!res.ok) return;
+    const overview = await res.json();
+    if (appState.data?.messages?.length || ui.messages.querySelector('.project-overview')) return;
+    const generated = overview.generated ? new Date(overview.generated).toLocaleString() : '';
+    card.innerHTML = `
+      <details open>
+        <summary>Project overview${generated ? ` <span class="project-overview-date">${escapeHtml(generated)}</span>` : ''}</summary>
+        <div class="project-overview-body">${renderMarkdown(overview.markdown || '')}</div>
+        <button class="ghost" type="button">Explain again</button>
+      </details>
+    `;
+    card.querySelector('button').addEventListener('click', () => {
+      ui.promptInput.value = ':explain';
+      submitPrompt();
+    });
+    ui.messages.appendChild(card);
+  } catch (err) {
+    console.warn('Failed to load project overview', err);
+  }
+}
+
+// Show the agent's self-reported confidence, risks and open questions for
+// the latest turn, apart from its prose answer
+function renderStatusReport() {
+  ui.messages.querySelector('.status-report')?.remove();
+  const report = appState.data?.last_status_report;
+  if (!report?.confidence) return;
+
+  const card = document.createElement('section');
+  card.className = `status-report confidence-${report.confidence}`;
+  const heading = document.createElement('div');
+  heading.className = 'status-report-heading';
+  heading.innerHTML = `<span class="status-report-badge">${escapeHtml(report.confidence)} confidence</span>`;
+  if (report.summary) {
+    heading.insertAdjacentHTML('beforeend', ` ${escapeHtml(report.summary)}`);
+  }
+  card.appendChild(heading);
+  const sections = [
+    ['Risks', report.risks],
+    ['Open questions', report.open_questions],
+    ['Next steps', report.next_steps],
+  ];
+  for (const [title, items] of sections) {
+    if (!items?.length) continue;
+    const label = document.createElement('div');
+    label.className = 'status-report-label';
+    label.textContent = title;
+    const list = document.createElement('ul');
+    for (const item of items) {
+      const li = document.createElement('li');
+      li.textContent = item;
+      list.appendChild(li);
+    }
+    card.append(label, list);
+  }
+  ui.messages.appendChild(card);
+}
+
+// Ask the user to approve a tool call set to "ask" in tool_permissions. The
+// turn waits until the card is answered here, in another tab, or times out.
+function renderToolApproval(data) {
+  if (!data?.id) return;
+  clearStreamingDraft();
+  const card = document.createElement('section');
+  card.className = 'tool-approval';
+  card.dataset.approvalId = data.id;
+  const heading = document.createElement('div');
+  heading.className = 'tool-approval-heading';
+  heading.textContent = `Allow ${data.tool}?`;
+  const summary = document.createElement('pre');
+  summary.className = 'tool-approval-summary';
+  summary.textContent = data.summary || '';
+  const reason = document.createElement('input');
+  reason.type = 'text';
+  reason.className = 'tool-approval-reason';
+  reason.placeholder = 'Reason for rejecting (optional)';
+  const actions = document.createElement('div');
+  actions.className = 'tool-approval-actions';
+  const answer = async (approved) => {
+    actions.querySelectorAll('button').forEach((btn) => { btn.disabled = true; });
+    try {
+      if (socketReady()) {
+        wsTransport.socket.send(JSON.stringify({ type: 'tool_approval', id: data.id, approved, reason: reason.value }));
+        card.remove();
+        return;
+      }
+      const res = await fetchWithWorkspace('/api/tool-approval', {
+        method: 'POST',
+        headers: { 'Content-Type': 'application/json' },
+        body: JSON.stringify({ id: data.id, approved, reason: reason.value }),
+      });
+      if (!res.ok) throw new Error((await res.text()).trim());
+      card.remove();
+    } catch (err) {
+      setStatus(`Approval failed: ${err.message}`);
+      card.remove();
+    }
+  };
+  const approveBtn = document.createElement('button');
+  approveBtn.className = 'primary';
+  approveBtn.textContent = 'Approve';
+  approveBtn.onclick = () => answer(true);
+  const rejectBtn = document.createElement('button');
+  rejectBtn.textContent = 'Reject';
+  rejectBtn.onclick = () => answer(false);
+  actions.append(approveBtn, rejectBtn);
+  card.append(heading, summary, reason, actions);
+  ui.messages.appendChild(card);
+  scrollMessagesToBottom();
+  setStatus(`Waiting for approval to run ${data.tool}`);
+  approveBtn.focus();
+}
+
+// Keys sent to a handed-off command's terminal as the bytes a terminal sends
+const handoffKeys = {
+  Enter: '\r', Backspace: '\x7f', Tab: '\t', Escape: '\x1b', Delete: '\x1b[3~',
+  ArrowUp: '\x1b[A', ArrowDown: '\x1b[B', ArrowRight: '\x1b[C', ArrowLeft: '\x1b[D',
+  Home: '\x1b[H', End: '\x1b[F',
+};
+const handoffEscapePattern = /\x1b\[[0-9;?]*[ -/]*[@-~]|\x1b\][^\x07\x1b]*(?:\x07|\x1b\\)|\x1b[@-Z\\-_]/g;
+
+// Let the user complete a command the agent handed over (shell with
+// interactive=true). The command's PTY streams over /api/terminal?handoff=<id>
+// and the turn continues once it exits or the user ends the step.
+function renderHandoff(data) {
+  if (!data?.id || ui.messages.querySelector(`.handoff[data-handoff-id="${data.id}"]`)) return;
+  clearStreamingDraft();
+  const card = document.createElement('section');
+  card.className = 'handoff';
+  card.dataset.handoffId = data.id;
+  const heading = document.createElement('div');
+  heading.className = 'handoff-heading';
+  heading.textContent = `Your turn: ${(data.command || []).join(' ')}`;
+  card.appendChild(heading);
+  if (data.instructions) {
+    const instructions = document.createElement('div');
+    instructions.className = 'handoff-instructions';
+    instructions.textContent = data.instructions;
+    card.appendChild(instructions);
+  }
+  const screen = document.createElement('pre');
+  screen.className = 'handoff-screen';
+  screen.tabIndex = 0;
+  const actions = document.createElement('div');
+  actions.className = 'handoff-actions';
+  const endBtn = document.createElement('button');
+  endBtn.textContent = 'End step';
+  actions.appendChild(endBtn);
+  card.append(screen, actions);
+  ui.messages.appendChild(card);
+  scrollMessagesToBottom();
+
+  // Plain-text rendering: escape codes are dropped, \r and \b move the
+  // cursor so prompts that redraw their line overwrite it
+  const lines = [''];
+  let col = 0;
+  const decoder = new TextDecoder();
+  const write = (text) => {
+    for (const ch of text.replace(handoffEscapePattern, '')) {
+      const line = lines[lines.length - 1];
+      if (ch === '\n') {
+        lines.push('');
+        col = 0;
+      } else if (ch === '\r') {
+        col = 0;
+      } else if (ch === '\b') {
+        col = Math.max(col - 1, 0);
+      } else if (ch >= ' ' || ch === '\t') {
+        lines[lines.length - 1] = line.slice(0, col).padEnd(col) + ch + line.slice(col + 1);
+        col++;
+      }
+    }
+    if (lines.length > 500) lines.splice(0, lines.length - 500);
+    screen.textContent = lines.join('\n');
+    screen.scrollTop = screen.scrollHeight;
+  };
+
+  const scheme = window.location.protocol === 'https:' ? 'wss' : 'ws';
+  const params = new URLSearchParams({ workspace: getCurrentWorkspacePath(), handoff: data.id });
+  const socket = new WebSocket(`${scheme}://${window.location.host}/api/terminal?${params}`);
+  socket.binaryType = 'arraybuffer';
+  card.handoffSocket = socket;
+  const send = (input) => {
+    if (socket.readyState === WebSocket.OPEN) socket.send(JSON.stringify({ type: 'input', data: input }));
+  };
+  socket.onmessage = (msg) => {
+    if (msg.data instanceof ArrayBuffer) {
+      write(decoder.decode(new Uint8Array(msg.data), { stream: true }));
+      return;
+    }
+    const control = JSON.parse(msg.data);
+    if (control.type === 'exit') {
+      endBtn.disabled = true;
+      write(`\n[exited with code ${control.code || 0}]\n`);
+    }
+  };
+  socket.onerror = () => write('\n[terminal connection failed]\n');
+
+  screen.addEventListener('keydown', (e) => {
+    if (e.metaKey) return;
+    let input = handoffKeys[e.key];
+    if (!input && e.ctrlKey && /^[a-z]$/i.test(e.key)) {
+      input = String.fromCharCode(e.key.toLowerCase().charCodeAt(0) - 96);
+    } else if (!input && e.key.length === 1 && !e.ctrlKey) {
+      input = e.key;
+    }
+    if (!input) return;
+    e.preventDefault();
+    send(input);
+  });
+  screen.addEventListener('paste', (e) => {
+    e.preventDefault();
+    send(e.clipboardData.getData('text'));
+  });
+  endBtn.onclick = async () => {
+    endBtn.disabled = true;
+    try {
+      const res = await fetchWithWorkspace('/api/handoff', {
+        method: 'POST',
+        headers: { 'Content-Type': 'application/json' },
+        body: JSON.stringify({ id: data.id }),
+      });
+      if (!res.ok) throw new Error((await res.text()).trim());
+    } catch (err) {
+      setStatus(`Ending the step failed: ${err.message}`);
+    }
+  };
+  setStatus('Waiting for you to finish the command in the terminal');
+  screen.focus();
+}
+
+function finishHandoff(data) {
+  const card = ui.messages.querySelector(`.handoff[data-handoff-id="${data?.id}"]`);
+  if (!card) return;
+  card.handoffSocket?.close();
+  card.classList.add('finished');
+  card.querySelector('.handoff-screen')?.removeAttribute('tabindex');
+  card.querySelector('.handoff-actions')?.remove();
+  const how = data.ended_by === 'exit' ? `exited with code ${data.exit_code}` : `ended (${data.ended_by})`;
+  card.querySelector('.handoff-heading').textContent += ` · ${how}`;
+  setStatus('Working...');
+}
+
+// Show the files changed and commands run by the session's latest turn
+function renderTurnSummary() {
+  ui.messages.querySelector('.turn-summary')?.remove();
+  const summary = appState.data?.last_turn_summary;
+  if (!summary || (!summary.files?.length && !summary.commands?.length)) return;
+
+  const details = document.createElement('details');
+  details.className = 'turn-summary';
+  const files = summary.files || [];
+  const commands = summary.commands || [];
+  const parts = [];
+  if (files.length) {
+    parts.push(`${files.length} file${files.length === 1 ? '' : 's'} changed`);
+    parts.push(`<span class="diff-add">+${summary.insertions || 0}</span> <span class="diff-del">−${summary.deletions || 0}</span>`);
+  }
+  if (commands.length) {
+    parts.push(`${commands.length} command${commands.length === 1 ? '' : 's'} run`);
+  }
+  const heading = document.createElement('summary');
+  heading.innerHTML = `Last turn: ${parts.join(' · ')}`;
+  details.appendChild(heading);
+
+  const list = document.createElement('ul');
+  for (const file of files) {
+    const item = document.createElement('li');
+    const stat = file.binary ? 'binary' : `<span class="diff-add">+${file.insertions}</span> <span class="diff-del">−${file.deletions}</span>`;
+    const via = file.source === 'shell' ? ' <span class="turn-summary-via">(via command)</span>' : '';
+    item.innerHTML = `<code>${escapeHtml(file.path)}</code> ${escapeHtml(file.status)} ${stat}${via}`;
+    if (file.resolution) {
+      item.insertAdjacentHTML('beforeend', ` <span class="turn-summary-via">${escapeHtml(file.resolution)}</span>`);
+    } else {
+      item.append(' ', turnChangeButton('Keep', file.path, 'accept', details), ' ', turnChangeButton('Revert', file.path, 'revert', details));
+    }
+    list.appendChild(item);
+  }
+  if (files.filter(f => !f.resolution).length > 1) {
+    const item = document.createElement('li');
+    item.className = 'turn-summary-all';
+    item.append(turnChangeButton('Keep all', '', 'accept', details), ' ', turnChangeButton('Revert all', '', 'revert', details));
+    list.appendChild(item);
+  }
+  for (const command of commands) {
+    const item = document.createElement('li');
+    item.innerHTML = `<span class="turn-summary-via">$</span> <code>${escapeHtml(command)}</code>`;
+    list.appendChild(item);
+  }
+  details.appendChild(list);
+  ui.messages.appendChild(details);
+}
+
+function turnChangeButton(label, path, action, details) {
+  const btn = document.createElement('button');
+  btn.type = 'button';
+  btn.className = 'turn-change-btn';
+  btn.textContent = label;
+  btn.onclick = () => resolveTurnChange(path, action, details);
+  return btn;
+}
+
+// Keep or roll back files from the latest turn. An empty path applies to all.
+async function resolveTurnChange(path, action, details, force = false) {
+  const res = await fetchWithWorkspace('/api/changes', {
+    method: 'POST',
+    headers: { 'Content-Type': 'application/json' },
+    body: JSON.stringify({ path, action, force }),
+  });
+  if (res.status === 409 && action === 'revert' && !force) {
+    const message = (await res.text()).trim();
+    if (message.includes('changed since') && await showConfirm(`${message}.\n\nRevert and discard those edits?`, 'File changed')) {
+      return resolveTurnChange(path, action, details, true);
+    }
+    setStatus(message);
+    return;
+  }
+  if (!res.ok) {
+    setStatus(`Could not ${action} change: ${(await res.text()).trim()}`);
+    return;
+  }
+  const body = await res.json();
+  if (appState.data) appState.data.last_turn_summary = body.summary;
+  renderTurnSummary();
+  ui.messages.querySelector('.turn-summary')?.setAttribute('open', '');
+  setStatus(action === 'revert' ? 'Reverted.' : 'Kept.');
+}
+
 // Create assistant message with multiple content/tool segments
-function createAssistantSegments(segments, isLatest, showRole) {
+function createAssistantSegments(segments, isLatest, showRole, turnId) {
   const wrapper = document.createElement('article');
   wrapper.className = 'message assistant';
 
@@ -717,6 +1143,10 @@ function createAssistantSegments(segments, isLatest, showRole) {
     copyBtn.innerHTML = '📋';
     copyBtn.onclick = () => copyMessageContent(allContent, copyBtn);
     actions.appendChild(copyBtn);
+    if (turnId) {
+      actions.appendChild(createFeedbackButton(turnId, 'up'));
+      actions.appendChild(createFeedbackButton(turnId, 'down'));
+    }
     wrapper.appendChild(actions);
   }
 
@@ -894,6 +1324,15 @@ function findLastPrimaryMessageIndex(messages) {
 function renderPlan() {
   const plan = appState.data?.plan;
   if (!plan || !Array.isArray(plan.steps) || plan.steps.length === 0) {
+    const tasks = appState.data?.tasks?.tasks;
+    if (tasks?.length && ui.planSummaryText) {
+      const done = tasks.filter((t) => t.status === 'done' || t.status === 'skipped').length;
+      const running = tasks.find((t) => t.status === 'running');
+      ui.planSummaryText.textContent = running ? `${running.title} ▶` : `Tasks ${done}/${tasks.length}`;
+      ui.planSummaryText.classList.toggle('completed', done === tasks.length);
+      updateThinkingIndicatorVisibility();
+      return;
+    }
     if (ui.planSummaryText) {
       ui.planSummaryText.textContent = '';
       ui.planSummaryText.classList.remove('completed');
@@ -1019,6 +1458,53 @@ function createMessageElement(msg, attachedTools = [], isLatest = false, showRol
   return wrapper;
 }
 
+// Thumbs up/down on an assistant turn. Feedback stays in the workspace's
+// local storage; clicking the active rating again removes it.
+function createFeedbackButton(turnId, rating) {
+  const btn = document.createElement('button');
+  const active = appState.data?.feedback?.[turnId] === rating;
+  btn.className = `message-action-btn feedback-btn${active ? ' active' : ''}`;
+  btn.title = rating === 'up' ? 'Good response' : 'Bad response';
+  btn.innerHTML = rating === 'up' ? '👍' : '👎';
+  btn.onclick = () => rateTurn(turnId, rating, active);
+  return btn;
+}
+
+async function rateTurn(turnId, rating, active) {
+  const session = appState.data?.current_key || '';
+  let res;
+  if (active) {
+    const query = new URLSearchParams({ session, turn_id: turnId });
+    res = await fetchWithWorkspace(`/api/feedback?${query}`, { method: 'DELETE' });
+  } else {
+    let comment = '';
+    let includeTranscript = false;
+    if (rating === 'down') {
+      const note = await showPrompt('What went wrong? (optional)', '', 'Feedback');
+      if (note === null) return;
+      comment = note;
+      includeTranscript = await showConfirm('Save a copy of this turn with the feedback? Known secrets are redacted and nothing leaves this machine.', 'Include transcript');
+    }
+    res = await fetchWithWorkspace('/api/feedback', {
+      method: 'POST',
+      headers: { 'Content-Type': 'application/json' },
+      body: JSON.stringify({ session, turn_id: turnId, rating, comment, include_transcript: includeTranscript }),
+    });
+  }
+  if (!res.ok) {
+    setStatus('Saving feedback failed');
+    return;
+  }
+  if (!appState.data) return;
+  appState.data.feedback = { ...(appState.data.feedback || {}) };
+  if (active) {
+    delete appState.data.feedback[turnId];
+  } else {
+    appState.data.feedback[turnId] = rating;
+  }
+  render();
+}
+
 async function copyMessageContent(content, button) {
   try {
     await navigator.clipboard.writeText(content);
@@ -1141,7 +1627,7 @@ async function createBranchFromEdit(editIndex, newContent) {
     const streamRes = await fetchWithWorkspace('/api/stream', {
       method: 'POST',
       headers: { 'Content-Type': 'application/json' },
-      body: JSON.stringify({ content: newContent }),
+      body: JSON.stringify({ content: newContent, idempotency_key: newIdempotencyKey() }),
     });
 
     if (!streamRes.ok) {
@@ -1167,7 +1653,7 @@ async function createBranchFromEdit(editIndex, newContent) {
         const data = line.slice(6);
         try {
           const event = JSON.parse(data);
-          if (event.type === 'error' || event.type === 'provider_error') {
+          if (event.type === 'error' || event.type === 'provider_error' || event.type === 'budget_exceeded') {
             hadError = true;
           }
           handleStreamEvent(event);
@@ -1397,7 +1883,10 @@ async function submitPrompt() {
     setStatus('Select a workspace to get started.');
     return;
   }
-  if (appState.busy) return;
+  if (appState.busy) {
+    await queuePrompt();
+    return;
+  }
   const content = ui.promptInput.value.trim();
   if (!content) {
     setStatus('Enter a prompt.');
@@ -1421,18 +1910,44 @@ async function submitPrompt() {
   // Arm the bell to play when we return to Ready state
   appState.bellArmed = true;
 
+  const pinnedFiles = appState.pinnedFiles;
+  appState.pinnedFiles = [];
+
   try {
+    if (socketReady()) {
+      appState.lastEventId = null;
+      const result = await submitSocketPrompt({
+        type: 'prompt',
+        content,
+        idempotency_key: newIdempotencyKey(),
+        pinned_files: pinnedFiles,
+      }, appState.currentAbortController.signal);
+      removeThinkingPlaceholder();
+      if (result.queued) {
+        await promptQueued(result.queued);
+      } else if (!result.hadError) {
+        setStatus('Ready.');
+      }
+      return;
+    }
     const res = await fetchWithWorkspace('/api/stream', {
       method: 'POST',
       headers: { 'Content-Type': 'application/json' },
-      body: JSON.stringify({ content }),
+      body: JSON.stringify({ content, idempotency_key: newIdempotencyKey(), pinned_files: pinnedFiles }),
       signal: appState.currentAbortController.signal,
     });
+    appState.lastEventId = null;
 
     if (!res.ok) {
       const text = await res.text();
       throw new Error(text || 'Stream failed');
     }
+    if (res.status === 202) {
+      // Another turn is running in the workspace; this one waits for it
+      removeThinkingPlaceholder();
+      await promptQueued(await res.json());
+      return;
+    }
 
     const reader = res.body.getReader();
     const decoder = new TextDecoder();
@@ -1448,12 +1963,16 @@ async function submitPrompt() {
       buffer = lines.pop() || '';
 
       for (const line of lines) {
+        if (line.startsWith('id: ')) {
+          appState.lastEventId = line.slice(4).trim();
+          continue;
+        }
         if (!line.trim() || !line.startsWith('data: ')) continue;
         const data = line.slice(6);
         try {
           const event = JSON.parse(data);
           // Track if we received an error event
-          if (event.type === 'error' || event.type === 'provider_error') {
+          if (event.type === 'error' || event.type === 'provider_error' || event.type === 'budget_exceeded') {
             hadError = true;
           }
           handleStreamEvent(event);
@@ -1475,6 +1994,9 @@ async function submitPrompt() {
     // Check if it was aborted
     if (err.name === 'AbortError') {
       setStatus('Request cancelled.');
+    } else if (appState.lastEventId && await resumeStream(appState.lastEventId)) {
+      // Connection dropped mid-turn; the missed events were replayed
+      return;
     } else {
       setStatus(err.message || 'Request failed.');
     }
@@ -1485,9 +2007,414 @@ async function submitPrompt() {
     stopThinkingIndicator();
     setBusy(false);
     appState.currentAbortController = null;
+    // The next queued prompt has started; follow it
+    if (appState.queuedTurnStarted || appState.data?.queued_prompts?.length) await refreshSession();
+    if (appState.budgetStop) await confirmBudgetStop(content);
   }
 }
 
+// confirmBudgetStop asks whether to go on after a turn stopped at the
+// session's hard budget. Confirming grants a fresh allowance and sends the
+// prompt again when it was refused before reaching the session.
+async function confirmBudgetStop(content) {
+  const stop = appState.budgetStop;
+  appState.budgetStop = null;
+  const confirmed = await showConfirm(`${stop.message || 'This session reached its hard budget.'}\n\nContinue with a fresh allowance?`, 'Session budget');
+  if (!confirmed) {
+    await refreshSession();
+    return;
+  }
+  try {
+    const res = await fetchWithWorkspace('/api/session/budget', {
+      method: 'POST',
+      headers: { 'Content-Type': 'application/json' },
+      body: JSON.stringify({ key: stop.session, action: 'continue' }),
+    });
+    if (!res.ok) throw new Error(await res.text());
+  } catch (err) {
+    showAlert('Failed to continue: ' + err.message);
+    return;
+  }
+  if (stop.before_prompt && content) {
+    await refreshSession();
+    ui.promptInput.value = content;
+    await submitPrompt();
+  } else {
+    setStatus('Budget extended. Send a prompt to continue.');
+  }
+}
+
+// Prompts sent while a turn runs are queued on the server and run in order.
+async function queuePrompt() {
+  const content = ui.promptInput.value.trim();
+  if (!content) return;
+  const pinnedFiles = appState.pinnedFiles;
+  try {
+    const res = await fetchWithWorkspace('/api/prompt-queue', {
+      method: 'POST',
+      headers: { 'Content-Type': 'application/json' },
+      body: JSON.stringify({ action: 'add', content, idempotency_key: newIdempotencyKey(), pinned_files: pinnedFiles }),
+    });
+    if (!res.ok) throw new Error((await res.text()).trim() || 'Queueing failed');
+    const body = await res.json();
+    ui.promptInput.value = '';
+    ui.promptInput.style.height = 'auto';
+    appState.pinnedFiles = [];
+    await loadQueuedPrompts();
+    setStatus(`Queued as #${body.position}; it runs when the current turn finishes.`);
+  } catch (err) {
+    setStatus(err.message);
+  }
+}
+
+// promptQueued shows a prompt the server queued instead of running.
+async function promptQueued(body) {
+  await refreshSession();
+  setStatus(`Another turn is running; your prompt is queued as #${body.position}.`);
+}
+
+async function loadQueuedPrompts() {
+  try {
+    const res = await fetchWithWorkspace('/api/prompt-queue');
+    if (!res.ok) return;
+    const body = await res.json();
+    if (appState.data) appState.data.queued_prompts = body.queued;
+    renderQueuedPrompts();
+  } catch (err) {
+    console.warn('Failed to load queued prompts', err);
+  }
+}
+
+function renderQueuedPrompts() {
+  let list = document.getElementById('queuedPrompts');
+  const queued = appState.data?.queued_prompts || [];
+  if (!queued.length) {
+    list?.remove();
+    return;
+  }
+  if (!list) {
+    list = document.createElement('ul');
+    list.id = 'queuedPrompts';
+    list.className = 'queued-prompts';
+    ui.promptForm.insertBefore(list, ui.promptForm.firstChild);
+  }
+  list.innerHTML = '';
+  queued.forEach((item, i) => {
+    const row = document.createElement('li');
+    row.className = 'queued-prompt';
+    const label = document.createElement('span');
+    label.className = 'queued-prompt-label';
+    label.textContent = `Queued #${i + 1}`;
+    const text = document.createElement('span');
+    text.className = 'queued-prompt-text';
+    text.textContent = item.content;
+    text.title = item.content;
+    const cancel = document.createElement('button');
+    cancel.type = 'button';
+    cancel.className = 'ghost queued-prompt-cancel';
+    cancel.textContent = '✕';
+    cancel.title = 'Remove from the queue';
+    cancel.onclick = async () => {
+      cancel.disabled = true;
+      const res = await fetchWithWorkspace('/api/prompt-queue', {
+        method: 'POST',
+        headers: { 'Content-Type': 'application/json' },
+        body: JSON.stringify({ action: 'cancel', id: item.id }),
+      });
+      if (!res.ok) setStatus((await res.text()).trim());
+      await loadQueuedPrompts();
+    };
+    row.append(label, text, cancel);
+    list.appendChild(row);
+  });
+}
+
+// Show the file and selection an editor extension pushed; the server adds
+// it to the context of every prompt until it is cleared.
+function renderEditorSelection() {
+  let chip = document.getElementById('editorSelection');
+  const sel = appState.data?.editor_selection;
+  if (!sel) {
+    chip?.remove();
+    return;
+  }
+  if (!chip) {
+    chip = document.createElement('div');
+    chip.id = 'editorSelection';
+    chip.className = 'editor-selection';
+    ui.promptForm.insertBefore(chip, ui.promptForm.querySelector('.input-wrapper'));
+  }
+  chip.innerHTML = '';
+  const label = document.createElement('span');
+  label.className = 'editor-selection-label';
+  label.textContent = 'From editor';
+  const text = document.createElement('span');
+  text.className = 'editor-selection-text';
+  let where = sel.path;
+  if (sel.start_line > 0) where += sel.end_line > sel.start_line ? `:${sel.start_line}-${sel.end_line}` : `:${sel.start_line}`;
+  text.textContent = where;
+  text.title = sel.text ? sel.text.slice(0, 2000) : where;
+  const clear = document.createElement('button');
+  clear.type = 'button';
+  clear.className = 'ghost editor-selection-clear';
+  clear.textContent = '✕';
+  clear.title = 'Stop sending this selection with prompts';
+  clear.onclick = async () => {
+    clear.disabled = true;
+    const res = await fetchWithWorkspace('/api/editor/selection', { method: 'DELETE' });
+    if (!res.ok) setStatus((await res.text()).trim());
+    if (appState.data) appState.data.editor_selection = null;
+    renderEditorSelection();
+  };
+  chip.append(label, text, clear);
+}
+
+// Queue a command for the connected editor extension: open_file or
+// apply_diff.
+async function sendToEditor(endpoint, body, done) {
+  try {
+    const res = await fetchWithWorkspace(`/api/editor/${endpoint}`, {
+      method: 'POST',
+      headers: { 'Content-Type': 'application/json' },
+      body: JSON.stringify(body),
+    });
+    if (!res.ok) throw new Error((await res.text()).trim() || `HTTP ${res.status}`);
+    showToast(done, 'success');
+  } catch (err) {
+    setStatus(`Editor: ${err.message}`);
+  }
+}
+
+function editorButton(label, title, onclick) {
+  const btn = document.createElement('button');
+  btn.type = 'button';
+  btn.className = 'ghost editor-send-btn';
+  btn.textContent = label;
+  btn.title = title;
+  btn.addEventListener('click', (e) => {
+    e.stopPropagation();
+    onclick();
+  });
+  return btn;
+}
+
+// Reattach to a running (or just finished) turn and replay the events after
+// lastEventId ("<turn>:<seq>"). Returns false when the turn is gone.
+async function resumeStream(lastEventId) {
+  if (appState.resuming) return true;
+  appState.resuming = true;
+  appState.currentAbortController = new AbortController();
+  setBusy(true);
+  setStatus('Reconnecting…');
+  let hadError = false;
+  try {
+    const res = await fetchWithWorkspace('/api/stream', {
+      headers: { 'Last-Event-ID': lastEventId },
+      signal: appState.currentAbortController.signal,
+    });
+    if (!res.ok) return false;
+
+    const reader = res.body.getReader();
+    const decoder = new TextDecoder();
+    let buffer = '';
+    while (true) {
+      const { done, value } = await reader.read();
+      if (done) break;
+      buffer += decoder.decode(value, { stream: true });
+      const lines = buffer.split('\n');
+      buffer = lines.pop() || '';
+      for (const line of lines) {
+        if (line.startsWith('id: ')) {
+          appState.lastEventId = line.slice(4).trim();
+          continue;
+        }
+        if (!line.startsWith('data: ')) continue;
+        try {
+          const event = JSON.parse(line.slice(6));
+          if (event.type === 'error' || event.type === 'provider_error' || event.type === 'budget_exceeded') hadError = true;
+          handleStreamEvent(event);
+        } catch (e) {
+          console.error('Failed to parse SSE event:', e, line);
+        }
+      }
+    }
+    if (!hadError) setStatus('Ready.');
+    await refreshSession();
+    return true;
+  } catch (err) {
+    console.error(err);
+    setStatus(err.name === 'AbortError' ? 'Request cancelled.' : (err.message || 'Reconnect failed.'));
+    return err.name === 'AbortError';
+  } finally {
+    appState.resuming = false;
+    appState.currentAbortController = null;
+    setBusy(false);
+  }
+}
+
+// WebSocket transport (/api/ws). While the socket is open, prompts, cancels
+// and tool approvals go over it and turn events come back on it; otherwise
+// the page falls back to /api/stream.
+const wsTransport = {
+  socket: null,
+  workspace: '',
+  turn: null,   // { resolve, reject, hadError } of the turn being followed
+};
+
+function socketReady() {
+  return wsTransport.socket?.readyState === WebSocket.OPEN;
+}
+
+function connectSocket() {
+  const workspace = getCurrentWorkspacePath();
+  if (!workspace || !('WebSocket' in window)) return;
+  const current = wsTransport.socket;
+  if (current && wsTransport.workspace === workspace && current.readyState <= WebSocket.OPEN) return;
+  current?.close();
+  const scheme = window.location.protocol === 'https:' ? 'wss' : 'ws';
+  const params = new URLSearchParams({ workspace, client_id: getClientId() });
+  const socket = new WebSocket(`${scheme}://${window.location.host}/api/ws?${params}`);
+  wsTransport.socket = socket;
+  wsTransport.workspace = workspace;
+  socket.onmessage = (msg) => {
+    try {
+      handleSocketFrame(JSON.parse(msg.data));
+    } catch (e) {
+      console.error('Failed to handle socket frame:', e, msg.data);
+    }
+  };
+  let opened = false;
+  socket.onopen = () => { opened = true; };
+  socket.onclose = () => {
+    if (wsTransport.socket !== socket) return;
+    wsTransport.socket = null;
+    settleSocketTurn(new Error('Connection lost.'));
+    // The socket never opened (e.g. a proxy without WebSocket support):
+    // follow a running turn over /api/stream instead
+    const active = appState.data?.active_turn;
+    if (!opened && active && !appState.busy && !appState.resuming) {
+      resumeStream(`${active.turn_id}:${active.last_event_id}`);
+    }
+  };
+}
+
+function handleSocketFrame(frame) {
+  switch (frame.type) {
+    case 'connected': {
+      // A turn is running after a page reload: follow it over the socket
+      const active = frame.data?.active_turn;
+      if (active && !appState.busy && !appState.resuming) {
+        const known = appState.data?.active_turn;
+        followSocketTurn(known?.turn_id === active.turn_id ? known : active);
+      }
+      break;
+    }
+    case 'rejected': {
+      const err = new Error(frame.data?.message || 'Request rejected.');
+      err.status = frame.data?.status;
+      if (wsTransport.turn && (frame.data?.request === 'prompt' || frame.data?.request === 'resume')) {
+        settleSocketTurn(err);
+      } else {
+        setStatus(err.message);
+      }
+      break;
+    }
+    case 'cancel_result':
+    case 'tool_approval_result':
+      break;
+    case 'turn_finished':
+      settleSocketTurn(null);
+      break;
+    case 'queued':
+      if (wsTransport.turn) wsTransport.turn.queued = frame.data;
+      settleSocketTurn(null);
+      break;
+    default:
+      if (frame.id) appState.lastEventId = frame.id;
+      if ((frame.type === 'error' || frame.type === 'provider_error' || frame.type === 'budget_exceeded') && wsTransport.turn) {
+        wsTransport.turn.hadError = true;
+      }
+      handleStreamEvent(frame);
+  }
+}
+
+// runSocketTurn sends a prompt or resume message and resolves once the turn
+// finishes with { hadError }, or with { queued } when the prompt was queued.
+function runSocketTurn(message, signal) {
+  return new Promise((resolve, reject) => {
+    settleSocketTurn(new Error('Superseded by a newer request.'));
+    wsTransport.turn = { resolve, reject, hadError: false };
+    signal?.addEventListener('abort', () => {
+      settleSocketTurn(new DOMException('Request cancelled.', 'AbortError'));
+    });
+    wsTransport.socket.send(JSON.stringify(message));
+  });
+}
+
+function settleSocketTurn(err) {
+  const turn = wsTransport.turn;
+  if (!turn) return;
+  wsTransport.turn = null;
+  if (err) turn.reject(err);
+  else turn.resolve({ hadError: turn.hadError, queued: turn.queued });
+}
+
+async function followSocketTurn(active) {
+  appState.resuming = true;
+  appState.currentAbortController = new AbortController();
+  setBusy(true);
+  setStatus('Reconnecting…');
+  try {
+    const { hadError } = await runSocketTurn({
+      type: 'resume',
+      turn_id: active.turn_id,
+      last_event_id: active.last_event_id,
+    }, appState.currentAbortController.signal);
+    if (!hadError) setStatus('Ready.');
+  } catch (err) {
+    setStatus(err.name === 'AbortError' ? 'Request cancelled.' : (err.message || 'Reconnect failed.'));
+  } finally {
+    appState.resuming = false;
+    appState.currentAbortController = null;
+    setBusy(false);
+  }
+  await refreshSession();
+}
+
+// submitSocketPrompt runs a prompt over the socket, offering to take over
+// the workspace when another tab holds it.
+async function submitSocketPrompt(message, signal) {
+  try {
+    return await runSocketTurn(message, signal);
+  } catch (err) {
+    if (err.status !== 423 || message.takeover) throw err;
+    const takeover = await showConfirm(`${err.message}.\n\nTake control in this tab? The other tab will be asked before its next change.`, 'Workspace in use');
+    if (!takeover || !socketReady()) throw err;
+    return runSocketTurn({ ...message, takeover: true }, signal);
+  }
+}
+
+// Report background turns that finished while the page was closed, then
+// mark them seen so they are announced only once.
+function announceFinishedTurns(turns) {
+  if (!turns || !turns.length) return;
+  const failed = turns.filter(t => t.status !== 'done').length;
+  const noun = turns.length === 1 ? 'turn' : 'turns';
+  const suffix = failed ? ` (${failed} did not complete)` : '';
+  setStatus(`${turns.length} background ${noun} finished while you were away${suffix}.`);
+  fetchWithWorkspace('/api/turns/seen', {
+    method: 'POST',
+    headers: { 'Content-Type': 'application/json' },
+    body: JSON.stringify({ ids: turns.map(t => t.id) }),
+  }).catch(err => console.error('Failed to mark turns seen:', err));
+}
+
+// Unique key per prompt submission so the server can drop resubmissions
+function newIdempotencyKey() {
+  if (window.crypto?.randomUUID) return window.crypto.randomUUID();
+  return `${Date.now().toString(36)}-${Math.random().toString(36).slice(2)}`;
+}
+
 function appendUserMessage(content) {
   const wrapper = document.createElement('article');
   wrapper.className = 'message user';
@@ -1513,13 +2440,90 @@ function removeThinkingPlaceholder() {
   updateThinkingIndicatorVisibility();
 }
 
+// Draft of the reply the model is still generating, shown until the
+// finished assistant_message replaces it
+function appendStreamingDelta(data) {
+  let draft = ui.messages.querySelector('.streaming-draft');
+  if (draft && draft.dataset.attempt !== String(data.attempt || 1)) {
+    clearStreamingDraft();
+    draft = null;
+  }
+  if (!draft) {
+    let host = ui.messages.lastElementChild;
+    if (!host || !host.classList.contains('assistant') || !host.classList.contains('streaming-tools')) {
+      host = document.createElement('div');
+      host.className = 'message assistant streaming-tools draft-host';
+      const role = document.createElement('div');
+      role.className = 'message-role';
+      role.textContent = 'Cando';
+      const body = document.createElement('div');
+      body.className = 'message-body';
+      host.append(role, body);
+      ui.messages.appendChild(host);
+    }
+    draft = document.createElement('div');
+    draft.className = 'streaming-draft';
+    draft.dataset.attempt = String(data.attempt || 1);
+    draft.dataset.content = '';
+    draft.dataset.thinking = '';
+    host.querySelector('.message-body').appendChild(draft);
+  }
+  draft.dataset.content += data.content || '';
+  draft.dataset.thinking += data.thinking || '';
+  draft.innerHTML = '';
+  if (draft.dataset.thinking) {
+    const thinking = document.createElement('div');
+    thinking.className = 'streaming-thinking';
+    thinking.textContent = draft.dataset.thinking.slice(-600);
+    draft.appendChild(thinking);
+  }
+  if (draft.dataset.content) {
+    const content = document.createElement('div');
+    content.className = 'message-content';
+    content.innerHTML = renderMarkdown(draft.dataset.content);
+    draft.appendChild(content);
+  }
+  setStatus(draft.dataset.content ? 'Writing…' : 'Thinking…');
+  scrollMessagesToBottom();
+}
+
+function clearStreamingDraft() {
+  const draft = ui.messages.querySelector('.streaming-draft');
+  if (!draft) return;
+  const host = draft.closest('.message');
+  draft.remove();
+  if (host?.classList.contains('draft-host') && !host.querySelector('.message-body')?.childElementCount) {
+    host.remove();
+  }
+}
+
 function handleStreamEvent(event) {
   switch (event.type) {
+    case 'assistant_delta':
+      appendStreamingDelta(event.data || {});
+      break;
     case 'tool_call_started':
       console.log('Tool call started:', event.data);
+      clearStreamingDraft();
       setStatus('Working...');
       appendStreamingToolCall(event.data);
       break;
+    case 'tool_approval_required':
+      renderToolApproval(event.data);
+      break;
+    case 'tool_approval_resolved':
+      ui.messages.querySelector(`.tool-approval[data-approval-id="${event.data?.id}"]`)?.remove();
+      setStatus('Working...');
+      break;
+    case 'tool_output':
+      appendToolOutput(event.data || {});
+      break;
+    case 'interactive_handoff':
+      renderHandoff(event.data);
+      break;
+    case 'interactive_handoff_finished':
+      finishHandoff(event.data);
+      break;
     case 'tool_call_completed':
       console.log('Tool call completed:', event.data);
       setStatus('Working...');
@@ -1532,11 +2536,28 @@ function handleStreamEvent(event) {
       const delayMs = Number(data.delay_ms || 0);
       const seconds = (delayMs / 1000).toFixed(1);
       const message = data.error ? ` after error: ${data.error}` : '';
+      clearStreamingDraft();
       setStatus(`Retrying request (attempt ${next}/${max}) in ${seconds}s${message}`);
       break;
     }
+    case 'turn_started':
+      appState.currentTurnId = event.turn_id || event.data?.turn_id || null;
+      if (appState.data) appState.data.last_status_report = null;
+      ui.messages.querySelector('.status-report')?.remove();
+      break;
+    case 'heartbeat': {
+      const data = event.data || {};
+      const seconds = Math.round(Number(data.elapsed_ms || 0) / 1000);
+      const attempt = data.attempt > 1 ? ` (attempt ${data.attempt}/${data.max_attempts})` : '';
+      setStatus(`Model is thinking for ${seconds}s…${attempt}`);
+      break;
+    }
+    case 'status':
+      if (event.data?.message) setStatus(event.data.message);
+      break;
     case 'assistant_message':
       console.log('Assistant message:', event.data);
+      clearStreamingDraft();
       // Status is set at stream end with hadError check - don't set here
 
       // Construct message object
@@ -1557,12 +2578,19 @@ function handleStreamEvent(event) {
       if (event.data.context_chars !== undefined) {
         appState.data.context_chars = event.data.context_chars;
       }
+      if (event.data.context_tokens !== undefined) {
+        appState.data.context_tokens = event.data.context_tokens;
+      }
       if (event.data.total_tokens !== undefined) {
         appState.data.total_tokens = event.data.total_tokens;
       }
       if (event.data.context_limit_tokens !== undefined) {
         appState.data.context_limit_tokens = event.data.context_limit_tokens;
       }
+      if (event.data.cost) {
+        appState.sessionCost = event.data.cost;
+        appState.data.usage = { ...(appState.data.usage || {}), cost_usd: event.data.cost.conversation_usd };
+      }
       updateStatusMeta();
       updateThinkingModelInfo();
 
@@ -1583,6 +2611,7 @@ function handleStreamEvent(event) {
           const contentDiv = document.createElement('div');
           contentDiv.className = 'message-content';
           contentDiv.innerHTML = renderMarkdown(assistantMsg.content);
+          linkCitations(contentDiv, event.data.citations);
           body.appendChild(contentDiv);
           scrollMessagesToBottom();
         }
@@ -1590,6 +2619,7 @@ function handleStreamEvent(event) {
         // Create and append new DOM element
         const msgElement = createMessageElement(assistantMsg, [], true, true);
         if (msgElement) {
+          linkCitations(msgElement, event.data.citations);
           // Mark as streaming turn so subsequent events append to this message
           msgElement.classList.add('streaming-tools');
           ui.messages.appendChild(msgElement);
@@ -1599,12 +2629,15 @@ function handleStreamEvent(event) {
       break;
     case 'compaction_start':
       console.log('Compaction started:', event.data);
-      setStatus(`Compacting context (${event.data.chars_before?.toLocaleString()} chars)...`);
+      setStatus(event.data.tokens_before
+        ? `Compacting context (${event.data.tokens_before.toLocaleString()} tokens)...`
+        : `Compacting context (${event.data.chars_before?.toLocaleString()} chars)...`);
       break;
     case 'compaction_complete':
       console.log('Compaction complete:', event.data);
-      const savedChars = Math.max(0, (event.data.chars_before || 0) - (event.data.chars_after || 0));
-      const savedTokens = Math.round(savedChars / 3);
+      const savedTokens = event.data.tokens_before
+        ? Math.max(0, event.data.tokens_before - (event.data.tokens_after || 0))
+        : Math.round(Math.max(0, (event.data.chars_before || 0) - (event.data.chars_after || 0)) / 3);
       setStatus(`Context compacted: saved ${savedTokens.toLocaleString()} tokens (${event.data.messages_compacted} messages)`);
       // After showing compaction result briefly, transition to "Working..." while waiting for LLM response
       setTimeout(() => {
@@ -1633,11 +2666,27 @@ function handleStreamEvent(event) {
         showPreview(event.data.path, event.data.title || 'Preview');
       }
       break;
+    case 'status_report':
+      if (appState.data) {
+        appState.data.last_status_report = event.data;
+        renderStatusReport();
+        renderTurnSummary();
+      }
+      break;
+    case 'turn_summary':
+      if (appState.data) {
+        appState.data.last_turn_summary = event.data;
+        renderTurnSummary();
+      }
+      break;
     case 'context_update':
       // Update context values in app state
       if (event.data.context_chars !== undefined) {
         appState.data.context_chars = event.data.context_chars;
       }
+      if (event.data.context_tokens !== undefined) {
+        appState.data.context_tokens = event.data.context_tokens;
+      }
       if (event.data.total_tokens !== undefined) {
         appState.data.total_tokens = event.data.total_tokens;
       }
@@ -1650,9 +2699,15 @@ function handleStreamEvent(event) {
       break;
     case 'complete':
       console.log('Stream complete');
+      clearStreamingDraft();
+      if (event.data?.status === 'duplicate') {
+        // Server already handled this submission; show its result
+        refreshSession();
+      }
       break;
     case 'error':
       console.error('Stream error:', event.data);
+      clearStreamingDraft();
       setStatus(`Error: ${event.data.message}`);
       break;
     case 'provider_error': {
@@ -1665,7 +2720,7 @@ function handleStreamEvent(event) {
       switch (type) {
         case 'quota_exceeded':
           statusMsg = `${provider}: Usage limit reached.`;
-          if (resetAt) statusMsg += ` Resets at ${resetAt}`;
+          if (resetAt) statusMsg += ` Resets at ${new Date(resetAt).toLocaleTimeString()}`;
           break;
         case 'insufficient_credit':
           statusMsg = `${provider}: Insufficient credits. Please add balance.`;
@@ -1691,6 +2746,26 @@ function handleStreamEvent(event) {
       setStatus(statusMsg);
       break;
     }
+    case 'budget_warning':
+      setStatus(event.data?.message || 'Session passed its soft budget.');
+      break;
+    case 'budget_exceeded':
+      // Asked once the turn has ended; see confirmBudgetStop
+      clearStreamingDraft();
+      appState.budgetStop = event.data || {};
+      setStatus(appState.budgetStop.message || 'Session reached its hard budget.');
+      break;
+    case 'model_switch': {
+      const data = event.data || {};
+      console.warn('Model switch:', data);
+      setStatus(`Switched to ${data.to}: ${data.reason || 'model unavailable'}`);
+      break;
+    }
+    case 'session_rolled_over': {
+      const data = event.data || {};
+      setStatus(`Session was large; older messages moved to ${data.archive}`);
+      break;
+    }
   }
 }
 
@@ -1776,6 +2851,7 @@ function appendStreamingToolCall(data) {
     argsContainer.appendChild(pre);
   }
   details.appendChild(argsContainer);
+  renderToolDiffs(details, data.diffs);
   toolCard.appendChild(details);
   toolStack.appendChild(toolCard);
 
@@ -1812,6 +2888,39 @@ function updateToolGroupSummary(toolGroup) {
   }
 }
 
+// Output shown while a command runs; older output is dropped past this.
+const toolOutputLimit = 20000;
+
+// Append a chunk of a running command's output to its tool card, opening
+// the card so the output can be watched live.
+function appendToolOutput(data) {
+  const toolCard = document.querySelector(`[data-tool-id="${data.id}"]`);
+  const details = toolCard?.querySelector('details');
+  if (!details || !data.chunk) return;
+  let pre = details.querySelector('.tool-output');
+  if (!pre) {
+    pre = document.createElement('pre');
+    pre.className = 'tool-output';
+    details.appendChild(pre);
+    details.open = true;
+    toolCard.closest('.tool-group')?.setAttribute('open', '');
+  }
+  const following = pre.scrollTop + pre.clientHeight >= pre.scrollHeight - 4;
+  const span = document.createElement('span');
+  if (data.stream === 'stderr') span.className = 'stderr';
+  span.textContent = data.chunk;
+  pre.appendChild(span);
+  pre.dataset.length = Number(pre.dataset.length || 0) + data.chunk.length;
+  while (Number(pre.dataset.length) > toolOutputLimit && pre.childElementCount > 1) {
+    pre.dataset.length -= pre.firstElementChild.textContent.length;
+    pre.firstElementChild.remove();
+  }
+  if (following) pre.scrollTop = pre.scrollHeight;
+  const lastLine = data.chunk.trimEnd().split('\n').pop();
+  if (lastLine) setStatus(`${data.function}: ${lastLine.slice(0, 120)}`);
+  scrollMessagesToBottom();
+}
+
 function updateStreamingToolResult(data) {
   const toolCard = document.querySelector(`[data-tool-id="${data.id}"]`);
   if (!toolCard) return;
@@ -1821,6 +2930,58 @@ function updateStreamingToolResult(data) {
     status.textContent = data.error ? 'failed' : 'completed';
     status.style.color = data.error ? 'var(--danger)' : 'var(--muted)';
   }
+  // The applied diff replaces the preview; a failed edit changed nothing
+  const details = toolCard.querySelector('details');
+  if (details && (data.diffs || data.error)) {
+    details.querySelector('.tool-diffs')?.remove();
+    renderToolDiffs(details, data.diffs);
+  }
+}
+
+// Render the unified diffs of a file-editing tool call, one block per file.
+function renderToolDiffs(container, diffs) {
+  if (!Array.isArray(diffs) || !diffs.length) return;
+  const wrap = document.createElement('div');
+  wrap.className = 'tool-diffs';
+  diffs.forEach((file) => {
+    const block = document.createElement('div');
+    block.className = 'tool-diff';
+    const header = document.createElement('div');
+    header.className = 'tool-diff-header';
+    const stat = file.binary ? 'binary' : `<span class="diff-add">+${file.additions}</span> <span class="diff-del">−${file.deletions}</span>`;
+    header.innerHTML = `<span class="tool-diff-path">${escapeHtml(file.path)}</span> <span class="tool-diff-status">${escapeHtml(file.status)}</span> ${stat}`;
+    if (appState.data?.editor_connected && file.status !== 'deleted') {
+      header.appendChild(editorButton('Open in editor', `Open ${file.path} in your editor`, () =>
+        sendToEditor('open', { path: file.path }, `Opening ${file.path} in the editor`)));
+      if (file.diff && !file.truncated && !file.binary) {
+        header.appendChild(editorButton('Apply in editor', 'Apply this diff to the editor buffer', () =>
+          sendToEditor('diff', { path: file.path, diff: file.diff }, `Sent the diff of ${file.path} to the editor`)));
+      }
+    }
+    block.appendChild(header);
+    if (file.diff) {
+      const pre = document.createElement('pre');
+      file.diff.split('\n').forEach((line, i, lines) => {
+        if (i === lines.length - 1 && line === '') return;
+        const row = document.createElement('span');
+        if (line.startsWith('@@')) row.className = 'diff-hunk';
+        else if (line.startsWith('+++') || line.startsWith('---')) row.className = 'diff-file';
+        else if (line.startsWith('+')) row.className = 'diff-add';
+        else if (line.startsWith('-')) row.className = 'diff-del';
+        row.textContent = `${line}\n`;
+        pre.appendChild(row);
+      });
+      if (file.truncated) {
+        const more = document.createElement('span');
+        more.className = 'diff-hunk';
+        more.textContent = '… diff truncated';
+        pre.appendChild(more);
+      }
+      block.appendChild(pre);
+    }
+    wrap.appendChild(block);
+  });
+  container.appendChild(wrap);
 }
 
 async function switchState(key) {
@@ -1886,8 +3047,12 @@ async function showCompactionHistory() {
 
     const html = history.map(event => {
       const date = new Date(event.timestamp);
-      const saved = event.chars_before - event.chars_after;
-      const savingsPercent = ((saved / event.chars_before) * 100).toFixed(1);
+      // Events from before token accounting only have character counts
+      const unit = event.tokens_before ? 'tokens' : 'chars';
+      const before = event.tokens_before || event.chars_before;
+      const after = event.tokens_before ? event.tokens_after : event.chars_after;
+      const saved = before - after;
+      const savingsPercent = ((saved / before) * 100).toFixed(1);
 
       return `
         <div class="compaction-entry">
@@ -1898,15 +3063,15 @@ async function showCompactionHistory() {
           <div class="compaction-stats">
             <div class="compaction-stat">
               <div class="compaction-stat-label">Before</div>
-              <div class="compaction-stat-value">${event.chars_before.toLocaleString()} chars</div>
+              <div class="compaction-stat-value">${before.toLocaleString()} ${unit}</div>
             </div>
             <div class="compaction-stat">
               <div class="compaction-stat-label">After</div>
-              <div class="compaction-stat-value">${event.chars_after.toLocaleString()} chars</div>
+              <div class="compaction-stat-value">${after.toLocaleString()} ${unit}</div>
             </div>
             <div class="compaction-stat">
               <div class="compaction-stat-label">Saved</div>
-              <div class="compaction-stat-value positive">${saved.toLocaleString()} chars (${savingsPercent}%)</div>
+              <div class="compaction-stat-value positive">${saved.toLocaleString()} ${unit} (${savingsPercent}%)</div>
             </div>
             <div class="compaction-stat">
               <div class="compaction-stat-label">Duration</div>
@@ -1928,8 +3093,112 @@ async function showCompactionHistory() {
   }
 }
 
-function closeCompactionHistory() {
-  ui.compactionDialog.style.display = 'none';
+function closeCompactionHistory() {
+  ui.compactionDialog.style.display = 'none';
+}
+
+// Background processes the agent started, listed so they can be inspected
+// and stopped without asking the model.
+function showProcesses() {
+  if (!appState.data?.workspace) {
+    setStatus('Select a workspace to get started.');
+    return;
+  }
+  document.getElementById('processesDialog').style.display = 'flex';
+  loadProcesses();
+}
+
+function closeProcesses() {
+  document.getElementById('processesDialog').style.display = 'none';
+}
+
+async function loadProcesses() {
+  const list = document.getElementById('processesList');
+  try {
+    const res = await fetchWithWorkspace('/api/processes');
+    if (!res.ok) throw new Error(await res.text());
+    const processes = (await res.json()).processes || [];
+    if (!processes.length) {
+      list.innerHTML = '<div class="no-compaction-history">The agent has not started any background processes.</div>';
+      return;
+    }
+    list.innerHTML = '';
+    processes.forEach((proc) => list.appendChild(renderProcess(proc)));
+  } catch (err) {
+    list.innerHTML = `<div class="no-compaction-history">Error loading processes: ${escapeHtml(err.message)}</div>`;
+  }
+}
+
+function renderProcess(proc) {
+  const entry = document.createElement('div');
+  entry.className = 'process-entry';
+  const started = new Date(proc.started_at).toLocaleString();
+  let meta = `${escapeHtml(proc.job_id)} · started ${started}`;
+  if (proc.pid) meta += ` · pid ${proc.pid}`;
+  if (proc.status !== 'running' && proc.status !== 'orphaned') meta += ` · exit ${proc.exit_code}`;
+  entry.innerHTML = `
+    <div class="process-entry-header">
+      <span class="process-command">${escapeHtml((proc.command || []).join(' '))}</span>
+      <span class="process-buttons">
+        <span class="process-status ${escapeHtml(proc.status)}">${escapeHtml(proc.status)}</span>
+        <button class="ghost" data-stream="stdout">Output</button>
+        <button class="ghost" data-stream="stderr">Errors</button>
+      </span>
+    </div>
+    <div class="process-meta">${meta}</div>`;
+  const buttons = entry.querySelector('.process-buttons');
+  buttons.querySelectorAll('[data-stream]').forEach((btn) => {
+    btn.addEventListener('click', () => showProcessLogs(entry, proc.job_id, btn.dataset.stream));
+  });
+  if (proc.status === 'running') {
+    const kill = document.createElement('button');
+    kill.className = 'ghost danger';
+    kill.textContent = 'Stop';
+    kill.addEventListener('click', () => killProcess(proc));
+    buttons.appendChild(kill);
+  }
+  return entry;
+}
+
+async function showProcessLogs(entry, jobID, stream) {
+  let pre = entry.querySelector('.process-logs');
+  if (pre?.dataset.stream === stream) {
+    pre.remove();
+    return;
+  }
+  if (!pre) {
+    pre = document.createElement('pre');
+    pre.className = 'process-logs';
+    entry.appendChild(pre);
+  }
+  pre.dataset.stream = stream;
+  pre.textContent = 'Loading...';
+  try {
+    const res = await fetchWithWorkspace(`/api/processes/logs?job_id=${encodeURIComponent(jobID)}&stream=${stream}`);
+    if (!res.ok) throw new Error(await res.text());
+    const lines = (await res.json()).lines || [];
+    pre.textContent = lines.length ? lines.join('\n') : `(no ${stream} output)`;
+    pre.scrollTop = pre.scrollHeight;
+  } catch (err) {
+    pre.textContent = `Failed to load logs: ${err.message}`;
+  }
+}
+
+async function killProcess(proc) {
+  if (!await showConfirm(`Stop "${(proc.command || []).join(' ')}"?`, 'Stop Process')) return;
+  try {
+    const res = await fetchWithWorkspace('/api/processes/kill', {
+      method: 'POST',
+      headers: { 'Content-Type': 'application/json' },
+      body: JSON.stringify({ job_id: proc.job_id }),
+    });
+    if (!res.ok) throw new Error(await res.text());
+    setStatus(`Stopped ${proc.job_id}.`);
+  } catch (err) {
+    showAlert('Failed to stop process: ' + err.message);
+  }
+  // The job's status changes once it has exited
+  setTimeout(loadProcesses, 300);
 }
 
 function togglePlanDropdown() {
@@ -1943,17 +3212,19 @@ function togglePlanDropdown() {
 }
 
 function showPlanDropdown() {
-  if (!appState.data?.plan || !appState.data.plan.steps || appState.data.plan.steps.length === 0) {
+  const queue = appState.data?.tasks;
+  const hasTasks = queue?.tasks?.length > 0;
+  if (!hasTasks && (!appState.data?.plan || !appState.data.plan.steps || appState.data.plan.steps.length === 0)) {
     return;
   }
 
-  const plan = appState.data.plan;
+  const plan = appState.data.plan || { steps: [] };
   const total = plan.steps.length;
   const completed = plan.steps.filter((s) => s.status === 'completed').length;
 
   // Update title
   if (ui.planDropdownTitle) {
-    ui.planDropdownTitle.textContent = `Plan · ${completed}/${total}`;
+    ui.planDropdownTitle.textContent = total ? `Plan · ${completed}/${total}` : 'Tasks';
   }
 
   // Populate steps
@@ -1975,6 +3246,17 @@ function showPlanDropdown() {
       stepItem.appendChild(content);
       ui.planDropdownSteps.appendChild(stepItem);
     });
+    if (completed < total && !hasTasks) {
+      const runBtn = document.createElement('button');
+      runBtn.className = 'task-btn task-queue-action';
+      runBtn.textContent = 'Run as task queue';
+      runBtn.title = 'Queue each unfinished step as a task that runs after the previous one';
+      runBtn.addEventListener('click', () => importPlanAsTasks());
+      ui.planDropdownSteps.appendChild(runBtn);
+    }
+    if (hasTasks) {
+      renderTaskQueue(queue);
+    }
   }
 
   // Hide just the summary text (not the whole container) when dropdown is open
@@ -1988,6 +3270,86 @@ function showPlanDropdown() {
   }
 }
 
+const TASK_ICONS = { pending: '○', running: '▶', done: '✓', skipped: '↷', failed: '✕', blocked: '⊘' };
+
+// renderTaskQueue appends the workspace's task queue to the plan dropdown.
+function renderTaskQueue(queue) {
+  const done = queue.tasks.filter((t) => t.status === 'done' || t.status === 'skipped').length;
+  const header = document.createElement('div');
+  header.className = 'task-queue-header';
+  const title = document.createElement('span');
+  title.textContent = `Tasks · ${done}/${queue.tasks.length}${queue.paused ? ' · paused' : ''}`;
+  header.appendChild(title);
+  const toggle = document.createElement('button');
+  toggle.className = 'task-btn';
+  toggle.textContent = queue.paused ? 'Resume' : 'Pause';
+  toggle.addEventListener('click', () => taskAction(queue.paused ? 'resume' : 'pause'));
+  header.appendChild(toggle);
+  if (done > 0) {
+    const clear = document.createElement('button');
+    clear.className = 'task-btn';
+    clear.textContent = 'Clear done';
+    clear.addEventListener('click', () => taskAction('clear'));
+    header.appendChild(clear);
+  }
+  ui.planDropdownSteps.appendChild(header);
+
+  queue.tasks.forEach((task) => {
+    const item = document.createElement('div');
+    item.className = 'plan-step-item';
+    item.title = task.verify ? `Verify: ${task.verify}` : '';
+
+    const icon = document.createElement('div');
+    icon.className = `plan-step-icon task-${task.status}`;
+    icon.textContent = TASK_ICONS[task.status] || '○';
+
+    const content = document.createElement('div');
+    content.className = 'plan-step-content';
+    content.textContent = task.title;
+    if (task.attempts > 1 || task.error) {
+      const detail = document.createElement('div');
+      detail.className = 'task-detail';
+      detail.textContent = [task.attempts > 1 ? `attempt ${task.attempts}/${task.max_attempts}` : '', task.error || ''].filter(Boolean).join(' · ');
+      content.appendChild(detail);
+    }
+
+    item.appendChild(icon);
+    item.appendChild(content);
+    const action = task.status === 'failed' || task.status === 'blocked' ? 'retry' : task.status === 'pending' ? 'skip' : '';
+    if (action) {
+      const btn = document.createElement('button');
+      btn.className = 'task-btn';
+      btn.textContent = action === 'retry' ? 'Retry' : 'Skip';
+      btn.addEventListener('click', () => taskAction(action, { id: task.id }));
+      item.appendChild(btn);
+    }
+    ui.planDropdownSteps.appendChild(item);
+  });
+}
+
+async function taskAction(action, extra = {}) {
+  const res = await fetchWithWorkspace('/api/tasks', {
+    method: 'POST',
+    headers: { 'Content-Type': 'application/json' },
+    body: JSON.stringify({ action, ...extra }),
+  });
+  if (!res.ok) {
+    setStatus(`Task queue: ${(await res.text()).trim()}`);
+    return;
+  }
+  if (appState.data) {
+    appState.data.tasks = await res.json();
+    renderPlan();
+    if (!ui.planDropdown?.classList.contains('hidden')) showPlanDropdown();
+  }
+}
+
+async function importPlanAsTasks() {
+  const verify = await showPrompt('Command that checks each step, e.g. go test ./... (optional)', '', 'Run plan as task queue');
+  if (verify === null) return;
+  await taskAction('import_plan', { verify });
+}
+
 function hidePlanDropdown() {
   if (ui.planDropdown) {
     ui.planDropdown.classList.add('hidden');
@@ -2038,6 +3400,13 @@ async function saveCredentials() {
     return;
   }
 
+  const endpoint = document.getElementById('azureEndpointInput')?.value.trim() || '';
+  if (provider === 'azure' && !endpoint) {
+    ui.onboardingError.textContent = 'Please enter your Azure OpenAI endpoint';
+    ui.onboardingError.style.display = 'block';
+    return;
+  }
+
   // Disable button during submission
   ui.saveCredentialsBtn.disabled = true;
   ui.saveCredentialsBtn.textContent = 'Saving...';
@@ -2049,6 +3418,7 @@ async function saveCredentials() {
       body: JSON.stringify({
         provider: provider,
         api_key: apiKey,
+        endpoint: provider === 'azure' ? endpoint : undefined,
       }),
     });
 
@@ -2164,6 +3534,29 @@ async function toggleForceThinking() {
   render();
 }
 
+async function setThinkingMode(mode) {
+  if (!appState.data) return;
+  if (mode === 'discard' && appState.data.thinking_mode !== 'discard') {
+    const ok = await showConfirm('Reasoning already saved in this session will be deleted.', 'Stop storing reasoning');
+    if (!ok) {
+      render();
+      return;
+    }
+  }
+  const res = await fetchWithWorkspace('/api/session/thinking-mode', {
+    method: 'POST',
+    headers: { 'Content-Type': 'application/json' },
+    body: JSON.stringify({ mode }),
+  });
+  if (!res.ok) {
+    setStatus('Thinking mode change failed');
+    render();
+    return;
+  }
+  appState.data = await res.json();
+  render();
+}
+
 async function togglePlanMode() {
   if (!appState.data || !appState.data.workdir) return;
   const next = !appState.data.plan_mode;
@@ -2247,7 +3640,11 @@ async function cancelRequest() {
 
   // Also notify backend to cancel
   try {
-    await fetch('/api/cancel', { method: 'POST' });
+    if (socketReady()) {
+      wsTransport.socket.send(JSON.stringify({ type: 'cancel' }));
+      return;
+    }
+    await fetchWithWorkspace('/api/cancel', { method: 'POST' });
   } catch (e) {
     console.error('Failed to notify backend of cancellation:', e);
   }
@@ -2256,7 +3653,7 @@ async function cancelRequest() {
 function setBusy(flag, message) {
   appState.busy = flag;
   ui.sendBtn.disabled = flag;
-  ui.promptInput.readOnly = flag;
+  // The input stays editable: prompts sent while busy are queued
   ui.cancelBtn.disabled = !flag;
 
   // Change button text and style based on state
@@ -2345,10 +3742,18 @@ function playBell() {
   }
 }
 
+// Tokens the conversation takes in the active model's context; older
+// servers only report its JSON size, estimated at 3 characters a token
+function contextTokensUsed() {
+  if (appState.data.context_tokens !== undefined) {
+    return Math.max(0, appState.data.context_tokens);
+  }
+  return Math.max(0, Math.round((appState.data.context_chars || 0) / 3));
+}
+
 function updateThinkingModelInfo() {
   if (!appState.data || !ui.thinkingModelInfo) return;
-  const usedChars = Math.max(0, appState.data.context_chars || 0);
-  const usedTokens = Math.max(0, Math.round(usedChars / 3));
+  const usedTokens = contextTokensUsed();
   const limitTokens = Math.max(0, appState.data.context_limit_tokens || 0);
   const model = appState.data.model || '';
 
@@ -2365,8 +3770,7 @@ function updateStatusMeta() {
   if (!appState.data || !ui.statusMeta) {
     return;
   }
-  const usedChars = Math.max(0, appState.data.context_chars || 0);
-  const usedTokens = Math.max(0, Math.round(usedChars / 3));
+  const usedTokens = contextTokensUsed();
   const limitTokens = Math.max(0, appState.data.context_limit_tokens || 0);
   const model = appState.data.model || '';
 
@@ -2381,7 +3785,8 @@ function updateStatusMeta() {
     if (ui.contextProgressBar) {
       ui.contextProgressBar.classList.remove('hidden');
     }
-    const leftLabel = `${remainingTokens.toLocaleString()} tokens left`;
+    const approx = appState.data.context_tokens_estimated ? '~' : '';
+    const leftLabel = `${approx}${remainingTokens.toLocaleString()} tokens left`;
     ui.statusMeta.textContent = model ? `${model} · ${leftLabel}` : leftLabel;
   } else {
     if (ui.contextProgressFill) {
@@ -2394,6 +3799,32 @@ function updateStatusMeta() {
     const usedLabel = `${usedTokens.toLocaleString()} tokens used`;
     ui.statusMeta.textContent = model ? `${model} · ${usedLabel}` : usedLabel;
   }
+  const quotaLabel = formatProviderQuota(appState.data.provider_quota);
+  if (quotaLabel) {
+    ui.statusMeta.textContent += ` · ${quotaLabel}`;
+  }
+  // Cost of the current session, persisted with it across restarts
+  const sessionUSD = appState.data.usage?.cost_usd || 0;
+  if (sessionUSD > 0) {
+    ui.statusMeta.textContent += ` · $${sessionUSD.toFixed(sessionUSD < 1 ? 4 : 2)}`;
+  }
+  const cost = appState.sessionCost;
+  if (cost) {
+    ui.statusMeta.title = `Last request: ~$${cost.projected_usd.toFixed(4)} projected, $${(cost.actual_usd || 0).toFixed(4)} actual (${cost.model}); $${cost.session_usd.toFixed(4)} on this provider since startup`;
+  }
+}
+
+// Summarize remaining provider quota/credit; only shown when running low
+function formatProviderQuota(quota) {
+  if (!quota || !quota.low || quota.remaining === undefined) return '';
+  const left = quota.unit === 'usd'
+    ? `$${quota.remaining.toFixed(2)}`
+    : `${Math.round(quota.remaining)}%`;
+  let label = `⚠ ${left} quota left`;
+  if (quota.reset_at) {
+    label += ` (resets ${new Date(quota.reset_at).toLocaleTimeString()})`;
+  }
+  return label;
 }
 
 function updateContextChars(chars) {
@@ -2515,6 +3946,27 @@ function initSettings() {
     });
   }
 
+  // OpenAI and Azure keys
+  ['openai', 'azure'].forEach(provider => {
+    const capitalized = provider.charAt(0).toUpperCase() + provider.slice(1);
+    document.getElementById(`save${capitalized}Key`)?.addEventListener('click', () => saveApiKey(provider));
+    document.getElementById(`${provider}ApiKey`)?.addEventListener('keydown', (e) => {
+      if (e.key === 'Enter') {
+        e.preventDefault();
+        saveApiKey(provider);
+      }
+    });
+  });
+  // Typed model names are saved on change
+  ['openai', 'azure', 'ollama'].forEach(provider => {
+    Object.entries(TYPED_MODEL_INPUTS).forEach(([modelType, suffix]) => {
+      const input = document.getElementById(provider + suffix);
+      if (input) {
+        input.addEventListener('change', () => saveTypedProviderModel(provider, modelType, input));
+      }
+    });
+  });
+
   // Auto-save on model selection change
   const zaiModelSelect = document.getElementById('zaiModelSelect');
   if (zaiModelSelect) {
@@ -2556,6 +4008,9 @@ async function openSettingsDialog() {
     refreshCompactionInfo();
     loadApiKeyStatus();
     await loadOpenRouterModels();
+    loadTypedModelOptions('openai');
+    loadTypedModelOptions('azure');
+    loadTypedModelOptions('ollama');
     updateProviderStatus();
     initializeProviderAccordions();
     populateSystemPrompt();
@@ -2735,7 +4190,7 @@ function refreshChatList() {
 
     const name = document.createElement('div');
     name.className = 'chat-item-name';
-    name.textContent = session.key;
+    name.textContent = sessionLabel(session);
 
     const meta = document.createElement('div');
     meta.className = 'chat-item-meta';
@@ -3254,6 +4709,31 @@ function updateProviderStatus() {
     }
   }
 
+  // OpenAI, Azure and Ollama: status, radio and typed model names
+  ['openai', 'azure', 'ollama'].forEach(key => {
+    const provider = providers.find(p => p.key === key);
+    const status = document.getElementById(`${key}Status`);
+    const radio = document.getElementById(`radio-${key}`);
+    if (status) {
+      if (key === 'ollama') {
+        status.textContent = provider ? 'Running' : 'Not detected';
+      } else {
+        status.textContent = provider ? 'Configured' : 'Not configured';
+      }
+      status.classList.toggle('configured', !!provider);
+    }
+    if (radio) {
+      radio.checked = (activeKey === key);
+      radio.disabled = !provider;
+    }
+    Object.entries(TYPED_MODEL_INPUTS).forEach(([modelType, suffix]) => {
+      const input = document.getElementById(key + suffix);
+      if (input && document.activeElement !== input) {
+        input.value = (appState.data?.[MODEL_CONFIG[modelType].configKey] || {})[key] || '';
+      }
+    });
+  });
+
   // Set OpenRouter model selections (works even before API key is set)
   populateModelFromConfig('openrouter', 'main');
   populateModelFromConfig('openrouter', 'summary');
@@ -3267,7 +4747,7 @@ function initializeProviderAccordions() {
   const activeKey = appState.data?.current_provider || '';
 
   // Expand the active provider, collapse others
-  const providers = ['zai', 'openrouter'];
+  const providers = ['zai', 'openrouter', 'openai', 'azure', 'ollama'];
   providers.forEach(key => {
     const section = document.querySelector(`.provider-section[data-provider="${key}"]`);
     if (section) {
@@ -3359,13 +4839,74 @@ function showSavedIndicator(indicatorId) {
   }, 2000); // Show for 2 seconds
 }
 
+// Model inputs of the OpenAI, Azure and Ollama sections, by model type
+const TYPED_MODEL_INPUTS = { main: 'ModelSelect', summary: 'SummaryModel', vision: 'VisionModel' };
+
+// Save a model name typed for OpenAI, Azure (a deployment name) or Ollama
+async function saveTypedProviderModel(provider, modelType, input) {
+  const modelId = input.value.trim();
+  if (!modelId || isModelAlreadySaved(provider, modelType, modelId)) return;
+
+  try {
+    const res = await fetch('/api/provider/model', {
+      method: 'POST',
+      headers: { 'Content-Type': 'application/json' },
+      body: JSON.stringify({ provider, model_type: modelType, model: modelId })
+    });
+    if (res.ok) {
+      showSavedIndicator(input.id + 'Saved');
+      await refreshSession();
+      updateProviderStatus();
+      if (provider === 'azure') {
+        loadTypedModelOptions(provider);
+      }
+    } else {
+      const error = await res.text();
+      setStatus(`Failed to save model: ${error}`);
+    }
+  } catch (err) {
+    console.error('Save model failed:', err);
+    setStatus('Failed to save model');
+  }
+}
+
+// Where the typed model sections get their suggestions
+const TYPED_MODEL_LISTS = {
+  openai: '/openai-models.json',
+  azure: '/openai-models.json?provider=azure',
+  ollama: '/ollama-models.json'
+};
+
+// Fill the OpenAI, Azure or Ollama model suggestions
+async function loadTypedModelOptions(provider) {
+  const list = document.getElementById(`${provider}ModelOptions`);
+  if (!list) return;
+  try {
+    const res = await fetch(TYPED_MODEL_LISTS[provider]);
+    if (!res.ok) return;
+    const models = await res.json();
+    list.innerHTML = '';
+    (models || []).forEach(model => {
+      const option = document.createElement('option');
+      option.value = model.id;
+      list.appendChild(option);
+    });
+  } catch (err) {
+    console.error(`Failed to load ${provider} models:`, err);
+  }
+}
+
 async function saveApiKey(provider) {
-  const inputId = provider === 'zai' ? 'zaiApiKey' : 'openrouterApiKey';
-  const input = document.getElementById(inputId);
+  const input = document.getElementById(`${provider}ApiKey`);
   if (!input || !input.value.trim()) {
     showAlert('Please enter a valid API key');
     return;
   }
+  const endpointInput = provider === 'azure' ? document.getElementById('azureEndpoint') : null;
+  if (endpointInput && !endpointInput.value.trim()) {
+    showAlert('Please enter your Azure OpenAI endpoint');
+    return;
+  }
 
   // Get vision model if set
   const visionModelId = provider === 'zai' ? 'zaiVisionModel' : 'openrouterVisionModel';
@@ -3380,6 +4921,9 @@ async function saveApiKey(provider) {
     if (visionModel) {
       payload.vision_model = visionModel;
     }
+    if (endpointInput) {
+      payload.endpoint = endpointInput.value.trim();
+    }
 
     const res = await fetch('/api/credentials', {
       method: 'POST',
@@ -3396,7 +4940,7 @@ async function saveApiKey(provider) {
       input.placeholder = 'API key configured ✓';
 
       // Update button text temporarily
-      const saveBtn = document.getElementById(provider === 'zai' ? 'saveZaiKey' : 'saveOpenrouterKey');
+      const saveBtn = document.getElementById(`save${provider.charAt(0).toUpperCase()}${provider.slice(1)}Key`);
       if (saveBtn) {
         const originalText = saveBtn.textContent;
         saveBtn.textContent = 'Saved ✓';
@@ -3414,6 +4958,9 @@ async function saveApiKey(provider) {
       await refreshSession();
       await loadApiKeyStatus();
       updateProviderStatus();
+      if (provider === 'openai' || provider === 'azure') {
+        loadTypedModelOptions(provider);
+      }
     } else {
       const error = await res.text();
       showAlert(`Failed to save API key: ${error}`);
@@ -3447,6 +4994,25 @@ async function loadApiKeyStatus() {
     if (zaiVisionModel && data.zai_vision_model) {
       zaiVisionModel.value = data.zai_vision_model;
     }
+    [['openai', 'OpenAI'], ['azure', 'Azure OpenAI']].forEach(([key, label]) => {
+      const keyInput = document.getElementById(`${key}ApiKey`);
+      if (!keyInput) return;
+      if (data[`${key}_configured`]) {
+        keyInput.placeholder = '••••••••••••••••••••••••';
+        keyInput.setAttribute('data-configured', 'true');
+      } else {
+        keyInput.placeholder = `Enter ${label} API key`;
+        keyInput.removeAttribute('data-configured');
+      }
+    });
+    const ollamaUrl = document.getElementById('ollamaUrl');
+    if (ollamaUrl && data.ollama_url) {
+      ollamaUrl.textContent = data.ollama_url;
+    }
+    const azureEndpoint = document.getElementById('azureEndpoint');
+    if (azureEndpoint && data.azure_endpoint && !azureEndpoint.value) {
+      azureEndpoint.value = data.azure_endpoint;
+    }
     if (openrouterInput) {
       if (data.openrouter_configured) {
         openrouterInput.placeholder = '••••••••••••••••••••••••';
@@ -4114,16 +5680,111 @@ function setCurrentWorkspacePath(path) {
   localStorage.setItem('currentWorkspace', path);
 }
 
-// Helper to add workspace header to fetch requests
-function fetchWithWorkspace(url, options = {}) {
+// Per-tab ID so the server can tell tabs apart for workspace locking
+function getClientId() {
+  let id = sessionStorage.getItem('candoClientId');
+  if (!id) {
+    id = newIdempotencyKey();
+    sessionStorage.setItem('candoClientId', id);
+  }
+  return id;
+}
+
+// Helper to add workspace and tab headers to fetch requests. When another
+// tab holds the workspace (423), offer to take it over and retry once.
+async function fetchWithWorkspace(url, options = {}) {
   const workspace = getCurrentWorkspacePath();
+  options.headers = options.headers || {};
+  options.headers['X-Client-ID'] = getClientId();
   if (workspace) {
-    options.headers = options.headers || {};
     options.headers['X-Workspace'] = workspace;
   }
+  const res = await fetch(url, options);
+  if (res.status !== 423 || options.headers['X-Lock-Takeover']) return res;
+  const message = (await res.clone().text()).trim();
+  const takeover = await showConfirm(`${message}.\n\nTake control in this tab? The other tab will be asked before its next change.`, 'Workspace in use');
+  if (!takeover) return res;
+  options.headers['X-Lock-Takeover'] = '1';
   return fetch(url, options);
 }
 
+// Keep this tab's workspace lock alive while visible; release it on close
+function startSessionLockHeartbeat() {
+  setInterval(() => {
+    if (document.visibilityState !== 'visible' || !getCurrentWorkspacePath()) return;
+    if (!appState.data?.lock?.mine) return;
+    fetchWithWorkspace('/api/session/lock', {
+      method: 'POST',
+      headers: { 'Content-Type': 'application/json' },
+      body: JSON.stringify({ action: 'heartbeat' }),
+    }).then(res => res.ok ? res.json() : null)
+      .then(body => { if (body && appState.data) appState.data.lock = body.lock; })
+      .catch(() => {});
+  }, 15000);
+  window.addEventListener('pagehide', () => {
+    if (!appState.data?.lock?.mine) return;
+    const workspace = encodeURIComponent(getCurrentWorkspacePath());
+    const token = encodeURIComponent(getCsrfToken());
+    navigator.sendBeacon(`/api/session/lock?workspace=${workspace}&csrf_token=${token}`, new Blob(
+      [JSON.stringify({ action: 'release', client_id: getClientId() })],
+      { type: 'application/json' },
+    ));
+  });
+}
+
+// Server-wide events (not tied to a turn), e.g. config edits on disk.
+// EventSource reconnects on its own after the server restarts.
+function listenServerEvents() {
+  if (!window.EventSource) return;
+  const source = new EventSource('/api/events');
+  source.onmessage = (e) => {
+    let event;
+    try { event = JSON.parse(e.data); } catch { return; }
+    if (event.type === 'config_changed') {
+      const data = event.data || {};
+      const restart = data.restart_required || [];
+      let message = 'Config reloaded from disk';
+      if (data.changed?.length) message += `: ${data.changed.join(', ')}`;
+      if (restart.length) message += ` (restart to apply ${restart.join(', ')})`;
+      setStatus(message);
+      refreshSession();
+    } else if (event.type === 'prompt_queue_changed') {
+      const data = event.data || {};
+      if (data.workspace !== getCurrentWorkspacePath()) return;
+      // A turn that ends refreshes the session itself and follows the next one
+      if (data.status !== 'running') {
+        loadQueuedPrompts();
+      } else if (appState.busy) {
+        appState.queuedTurnStarted = true;
+      } else {
+        refreshSession();
+      }
+    } else if (event.type === 'tasks_changed') {
+      const data = event.data || {};
+      if (data.workspace !== getCurrentWorkspacePath()) return;
+      setStatus(`Task ${data.task} ${data.status}`);
+      refreshSession();
+    } else if (event.type === 'editor_selection_changed') {
+      const data = event.data || {};
+      if (data.workspace !== getCurrentWorkspacePath() || !appState.data) return;
+      appState.data.editor_selection = data.selection;
+      appState.data.editor_connected = true;
+      renderEditorSelection();
+    } else if (event.type === 'session_titled') {
+      const data = event.data || {};
+      if (data.workspace !== getCurrentWorkspacePath()) return;
+      // Patch the list in place rather than refreshing under a running turn
+      const session = appState.data?.sessions?.find(s => s.key === data.session);
+      if (session) {
+        session.title = data.title;
+        updateChatUI();
+      } else if (!appState.busy) {
+        refreshSession();
+      }
+    }
+  };
+}
+
 async function initProjects() {
   // Initialize project/chat data from session payload
   updateProjectUI();
@@ -4152,14 +5813,21 @@ function updateProjectUI() {
   renderProjectMenu();
 }
 
+// sessionLabel is what lists show for a session: its title, else its key.
+function sessionLabel(session) {
+  return session?.title || session?.key || '';
+}
+
 function updateChatUI() {
   if (!appState.data) return;
 
   const currentKey = appState.data.current_key || '';
+  const current = (appState.data.sessions || []).find(s => s.key === currentKey);
 
   // Update chat label in toolbar
   if (ui.currentChatLabel) {
-    ui.currentChatLabel.textContent = currentKey || 'chat-1';
+    ui.currentChatLabel.textContent = sessionLabel(current) || currentKey || 'chat-1';
+    ui.currentChatLabel.title = currentKey;
   }
 
   // Render chat dropdown menu
@@ -4273,10 +5941,15 @@ function renderChatMenu() {
       item.classList.add('current');
     }
 
-    item.innerHTML = `
-      <span class="chat-menu-item-name">${session.key}</span>
-      <span class="chat-menu-item-meta">${session.message_count || 0} messages</span>
-    `;
+    // Titles come from the model or the user, so never parse them as HTML
+    const name = document.createElement('span');
+    name.className = 'chat-menu-item-name';
+    name.textContent = sessionLabel(session);
+    name.title = session.key;
+    const meta = document.createElement('span');
+    meta.className = 'chat-menu-item-meta';
+    meta.textContent = `${session.message_count || 0} messages`;
+    item.append(name, meta);
 
     item.addEventListener('click', async () => {
       if (session.key !== currentKey) {
@@ -4289,6 +5962,94 @@ function renderChatMenu() {
   });
 }
 
+// renameCurrentChat sets the title the chat lists show; an empty title
+// removes it.
+async function renameCurrentChat() {
+  hideChatDropdown();
+  const key = appState.data?.current_key || '';
+  const current = (appState.data?.sessions || []).find(s => s.key === key);
+  const title = await showPrompt('Chat title (leave empty to remove it):', current?.title || '', 'Rename Chat');
+  if (title === null) return;
+  try {
+    const res = await fetchWithWorkspace('/api/state', {
+      method: 'POST',
+      headers: { 'Content-Type': 'application/json' },
+      body: JSON.stringify({ action: 'rename', key, title: title.trim() }),
+    });
+    if (!res.ok) {
+      showAlert('Rename failed: ' + await res.text());
+      return;
+    }
+    await refreshSession();
+  } catch (err) {
+    console.error('Failed to rename chat:', err);
+    showAlert('Failed to rename chat');
+  }
+}
+
+// Renaming and export of the current chat as Markdown or JSON, and import
+// of a JSON export as a new chat, from the chat dropdown.
+function setupChatExportActions() {
+  const markdownBtn = document.getElementById('exportChatMarkdownBtn');
+  const jsonBtn = document.getElementById('exportChatJSONBtn');
+  const importBtn = document.getElementById('importChatBtn');
+  const fileInput = document.getElementById('importChatFile');
+  if (!markdownBtn || !jsonBtn || !importBtn || !fileInput) return;
+
+  const exportChat = async (format) => {
+    hideChatDropdown();
+    const key = appState.data?.current_key || '';
+    try {
+      const res = await fetchWithWorkspace(`/api/session/export?format=${format}&key=${encodeURIComponent(key)}`);
+      if (!res.ok) {
+        showAlert('Export failed: ' + await res.text());
+        return;
+      }
+      const url = URL.createObjectURL(await res.blob());
+      const link = document.createElement('a');
+      link.href = url;
+      link.download = `${key || 'chat'}.${format === 'json' ? 'json' : 'md'}`;
+      document.body.appendChild(link);
+      link.click();
+      link.remove();
+      URL.revokeObjectURL(url);
+    } catch (err) {
+      console.error('Failed to export chat:', err);
+      showAlert('Failed to export chat');
+    }
+  };
+  markdownBtn.addEventListener('click', () => exportChat('markdown'));
+  const renameBtn = document.getElementById('renameChatBtn');
+  if (renameBtn) renameBtn.addEventListener('click', renameCurrentChat);
+  jsonBtn.addEventListener('click', () => exportChat('json'));
+
+  importBtn.addEventListener('click', () => {
+    hideChatDropdown();
+    fileInput.click();
+  });
+  fileInput.addEventListener('change', async () => {
+    const file = fileInput.files && fileInput.files[0];
+    fileInput.value = '';
+    if (!file) return;
+    try {
+      const res = await fetchWithWorkspace('/api/session/import', {
+        method: 'POST',
+        headers: { 'Content-Type': 'application/json' },
+        body: await file.text(),
+      });
+      if (!res.ok) {
+        showAlert('Import failed: ' + await res.text());
+        return;
+      }
+      await refreshSession();
+      setStatus(`Imported chat ${appState.data?.current_key || ''}`);
+    } catch (err) {
+      console.error('Failed to import chat:', err);
+      showAlert('Failed to import chat');
+    }
+  });
+}
+
 async function switchChat(key) {
   try {
     // Collapse preview panel before switching (keep button visible)
@@ -4517,6 +6278,39 @@ function hideWorkspaceDropdown() {
   }
 }
 
+// formatWorkspaceStats summarizes a workspace for the switcher, e.g.
+// "main · 3 dirty · 1,234 files · 12.5 MB · active 2h ago".
+function formatWorkspaceStats(stats) {
+  if (!stats) return '';
+  const parts = [];
+  if (stats.branch) {
+    parts.push(stats.branch);
+    if (stats.dirty_files > 0) parts.push(`${stats.dirty_files} dirty`);
+  }
+  const files = stats.files.toLocaleString();
+  parts.push(`${files}${stats.truncated ? '+' : ''} ${stats.files === 1 ? 'file' : 'files'}`);
+  parts.push(formatStatsSize(stats.size_bytes));
+  if (stats.last_activity) {
+    parts.push(`active ${formatStatsAge(new Date(stats.last_activity))}`);
+  }
+  return parts.join(' · ');
+}
+
+function formatStatsSize(bytes) {
+  if (bytes >= 1 << 30) return `${(bytes / (1 << 30)).toFixed(1)} GB`;
+  if (bytes >= 1 << 20) return `${(bytes / (1 << 20)).toFixed(1)} MB`;
+  if (bytes >= 1 << 10) return `${Math.round(bytes / (1 << 10))} KB`;
+  return `${bytes} B`;
+}
+
+function formatStatsAge(date) {
+  const seconds = Math.max(0, (Date.now() - date.getTime()) / 1000);
+  if (seconds < 60) return 'just now';
+  if (seconds < 3600) return `${Math.floor(seconds / 60)}m ago`;
+  if (seconds < 86400) return `${Math.floor(seconds / 3600)}h ago`;
+  return `${Math.floor(seconds / 86400)}d ago`;
+}
+
 function renderWorkspaceDropdown() {
   if (!ui.workspaceMenuOpen || !ui.workspaceMenuRecent) return;
 
@@ -4543,12 +6337,26 @@ function renderWorkspaceDropdown() {
     icon.setAttribute('data-lucide', 'folder');
     item.appendChild(icon);
 
+    const contentDiv = document.createElement('div');
+    contentDiv.style.flex = '1';
+    contentDiv.style.overflow = 'hidden';
+
     const nameDiv = document.createElement('div');
     nameDiv.className = 'workspace-menu-item-name';
     const name = workspace.name || workspace.path.split('/').filter(Boolean).pop() || workspace.path;
     nameDiv.textContent = name;
     nameDiv.title = workspace.path;
-    item.appendChild(nameDiv);
+    contentDiv.appendChild(nameDiv);
+
+    const statsText = formatWorkspaceStats(workspace.stats);
+    if (statsText) {
+      const statsDiv = document.createElement('div');
+      statsDiv.className = 'workspace-menu-item-stats';
+      statsDiv.textContent = statsText;
+      statsDiv.title = workspace.path;
+      contentDiv.appendChild(statsDiv);
+    }
+    item.appendChild(contentDiv);
 
     item.addEventListener('click', () => {
       if (workspace.path !== workspaceState.currentWorkspace?.path) {
@@ -5065,7 +6873,7 @@ async function loadChatsDialogData() {
     const currentMessagesEl = document.getElementById('currentChatMessages');
     const currentUpdatedEl = document.getElementById('currentChatUpdated');
 
-    if (currentNameEl) currentNameEl.textContent = data.current_key || '—';
+    if (currentNameEl) currentNameEl.textContent = sessionLabel(data.sessions?.find(s => s.key === data.current_key)) || data.current_key || '—';
     if (currentMessagesEl) {
       const count = data.messages?.length || 0;
       currentMessagesEl.textContent = `${count} message${count !== 1 ? 's' : ''}`;
@@ -5115,7 +6923,7 @@ function renderChatsList(sessions, currentKey) {
 
     const name = document.createElement('div');
     name.className = 'chat-name';
-    name.textContent = chat.key;
+    name.textContent = sessionLabel(chat);
 
     const meta = document.createElement('div');
     meta.className = 'chat-meta';
@@ -5416,6 +7224,7 @@ async function showProjectSettingsDialog() {
   if (saveBtn) saveBtn.addEventListener('click', handleSave);
   if (cancelBtn) cancelBtn.addEventListener('click', closeDialog);
   if (closeBtn) closeBtn.addEventListener('click', closeDialog);
+  setupProjectKnowledgeActions();
 
   // Handle tab switching within project settings (for future tabs)
   const tabBtns = dialog.querySelectorAll('.tab-btn');
@@ -5433,6 +7242,64 @@ async function showProjectSettingsDialog() {
   });
 }
 
+// Export/import of project facts and memories. Handlers are bound once,
+// since the dialog is reopened without being rebuilt.
+function setupProjectKnowledgeActions() {
+  const exportBtn = document.getElementById('exportProjectKnowledge');
+  const importBtn = document.getElementById('importProjectKnowledge');
+  const fileInput = document.getElementById('projectKnowledgeFile');
+  if (!exportBtn || !importBtn || !fileInput || exportBtn.dataset.bound) return;
+  exportBtn.dataset.bound = 'true';
+
+  exportBtn.addEventListener('click', async () => {
+    try {
+      const res = await fetchWithWorkspace('/api/knowledge/export');
+      if (!res.ok) {
+        showAlert('Export failed: ' + await res.text());
+        return;
+      }
+      const url = URL.createObjectURL(await res.blob());
+      const link = document.createElement('a');
+      link.href = url;
+      link.download = 'cando-knowledge.json';
+      document.body.appendChild(link);
+      link.click();
+      link.remove();
+      URL.revokeObjectURL(url);
+    } catch (err) {
+      console.error('Failed to export project knowledge:', err);
+      showAlert('Failed to export project knowledge');
+    }
+  });
+
+  importBtn.addEventListener('click', () => fileInput.click());
+  fileInput.addEventListener('change', async () => {
+    const file = fileInput.files && fileInput.files[0];
+    fileInput.value = '';
+    if (!file) return;
+    try {
+      const res = await fetchWithWorkspace('/api/knowledge/import', {
+        method: 'POST',
+        headers: { 'Content-Type': 'application/json' },
+        body: await file.text(),
+      });
+      if (!res.ok) {
+        showAlert('Import failed: ' + await res.text());
+        return;
+      }
+      const result = await res.json();
+      let message = `Imported ${result.facts} new facts and ${result.memories} new memories.`;
+      if (result.skipped_memories) {
+        message += ` ${result.skipped_memories} memories were skipped because this project's context profile does not store memories.`;
+      }
+      showAlert(message);
+    } catch (err) {
+      console.error('Failed to import project knowledge:', err);
+      showAlert('Failed to import project knowledge');
+    }
+  });
+}
+
 async function loadSessionsPageData() {
   try {
     const res = await fetchWithWorkspace('/api/session');
@@ -5451,7 +7318,7 @@ async function loadSessionsPageData() {
     const currentMessagesEl = document.getElementById('currentSessionMessages');
     const currentUpdatedEl = document.getElementById('currentSessionUpdated');
 
-    if (currentNameEl) currentNameEl.textContent = data.current_key || '—';
+    if (currentNameEl) currentNameEl.textContent = sessionLabel(data.sessions?.find(s => s.key === data.current_key)) || data.current_key || '—';
     if (currentMessagesEl) {
       const count = data.messages?.length || 0;
       currentMessagesEl.textContent = `${count} message${count !== 1 ? 's' : ''}`;
@@ -5497,7 +7364,7 @@ function renderSessionsList(sessions, currentKey) {
 
     const name = document.createElement('div');
     name.className = 'session-name';
-    name.textContent = session.key;
+    name.textContent = sessionLabel(session);
 
     const meta = document.createElement('div');
     meta.className = 'session-meta';
@@ -5801,7 +7668,8 @@ async function pollForRestart() {
   const poll = async () => {
     try {
       const res = await fetch('/api/health');
-      if (res.ok) {
+      // 503 means the server is up but reports a subsystem as unhealthy
+      if (res.ok || res.status === 503) {
         // Server is back, reload page
         window.location.reload();
         return;
@@ -6126,6 +7994,8 @@ function initFileExplorer() {
     });
   }
 
+  initExplorerUploadDrop();
+
   // Load file tree when workspace changes
   loadFileTree();
 }
@@ -7259,6 +9129,32 @@ function showPreview(path, title) {
   updatePreviewToggleState();
 }
 
+// Turn inline code that matches a checked citation (path:line) into a link
+// that opens the file in the preview pane
+function linkCitations(container, citations) {
+  if (!container || !Array.isArray(citations) || citations.length === 0) return;
+  const byText = new Map(citations.map((citation) => [citation.text, citation]));
+  container.querySelectorAll('code').forEach((code) => {
+    if (code.closest('pre')) return;
+    const citation = byText.get(code.textContent.trim());
+    if (!citation) return;
+    const range = citation.end > citation.start ? `${citation.start}-${citation.end}` : `${citation.start}`;
+    code.classList.add('citation-link');
+    code.title = `Open ${citation.path} (line ${range})`;
+    code.setAttribute('role', 'link');
+    code.tabIndex = 0;
+    const open = () => showPreview(citation.path, `${citation.path}:${range}`);
+    code.addEventListener('click', open);
+    code.addEventListener('keydown', (e) => {
+      if (e.key === 'Enter') open();
+    });
+    if (appState.data?.editor_connected) {
+      code.after(editorButton('↗', `Open ${citation.path} at line ${citation.start} in your editor`, () =>
+        sendToEditor('open', { path: citation.path, line: citation.start }, `Opening ${citation.path}:${citation.start} in the editor`)));
+    }
+  });
+}
+
 // Toggle preview panel visibility
 function togglePreviewPanel() {
   if (!ui.previewPanel) return;
@@ -7575,6 +9471,17 @@ function showExplorerContextMenu(e, path, isDir) {
     previewBtn.disabled = !canPreview;
   }
 
+  const downloadBtn = menu.querySelector('[data-action="download"]');
+  if (downloadBtn) {
+    downloadBtn.querySelector('span').textContent = isDir ? 'Download as zip' : 'Download';
+  }
+
+  const pinBtn = menu.querySelector('[data-action="pin"]');
+  if (pinBtn) {
+    pinBtn.disabled = isDir;
+    pinBtn.querySelector('span').textContent = appState.pinnedFiles.includes(path) ? 'Unpin' : 'Pin to next prompt';
+  }
+
   // Refresh icons
   if (window.lucide) {
     lucide.createIcons({ nodes: [menu] });
@@ -7613,6 +9520,44 @@ async function handleContextMenuAction(action) {
       }
       break;
 
+    case 'pin':
+      if (!target.isDir) {
+        const name = target.path.split('/').pop();
+        if (appState.pinnedFiles.includes(target.path)) {
+          appState.pinnedFiles = appState.pinnedFiles.filter((p) => p !== target.path);
+          showToast(`Unpinned ${name}`, 'success');
+        } else {
+          appState.pinnedFiles.push(target.path);
+          showToast(`${name} will be kept up to date in the next prompt's context`, 'success');
+        }
+      }
+      break;
+
+    case 'upload': {
+      // Folders receive the files; for a file, its folder does
+      const dir = target.isDir ? target.path : target.path.substring(0, target.path.lastIndexOf('/'));
+      const input = document.getElementById('explorerUploadInput');
+      input.onchange = () => {
+        const files = [...input.files];
+        input.value = '';
+        uploadFilesToWorkspace(files, dir);
+      };
+      input.click();
+      break;
+    }
+
+    case 'download': {
+      // Folders arrive as a zip
+      const params = new URLSearchParams({ workspace: workspacePath, path: target.path });
+      const link = document.createElement('a');
+      link.href = `/api/files/download?${params}`;
+      link.download = '';
+      document.body.appendChild(link);
+      link.click();
+      link.remove();
+      break;
+    }
+
     case 'rename':
       const oldName = target.path.split('/').pop();
       const newName = await showPrompt('Rename to:', oldName, 'Rename');
@@ -7670,6 +9615,70 @@ async function handleContextMenuAction(action) {
   }
 }
 
+// Upload files into dir (relative to the workspace root). Zips can be
+// extracted in place, and existing files are only replaced after asking.
+async function uploadFilesToWorkspace(files, dir) {
+  const workspacePath = appState.data?.workspace?.path;
+  if (!workspacePath || !files.length) return;
+  const zips = files.filter((f) => f.name.toLowerCase().endsWith('.zip')).map((f) => f.name);
+  const where = dir || 'the project root';
+  const unzip = zips.length > 0 && await showConfirm(`Extract ${zips.join(', ')} into ${where}? Cancel uploads the archive as is.`, 'Extract Archive');
+  const send = (overwrite) => {
+    const form = new FormData();
+    for (const file of files) form.append('file', file, file.name);
+    const params = new URLSearchParams({ workspace: workspacePath, dir, unzip, overwrite });
+    return fetch(`/api/files/upload?${params}`, { method: 'POST', body: form });
+  };
+
+  setStatus(`Uploading ${files.length} file(s) to ${where}…`);
+  try {
+    let res = await send(false);
+    if (res.status === 409) {
+      const message = (await res.text()).trim();
+      if (!await showConfirm(`${message.replace(/;.*$/, '')}. Replace existing files?`, 'Replace Files')) {
+        setStatus('Upload cancelled');
+        return;
+      }
+      res = await send(true);
+    }
+    if (!res.ok) throw new Error((await res.text()).trim() || res.statusText);
+    const result = await res.json();
+    setStatus(`Uploaded ${result.files.length} file(s) to ${where}`);
+    refreshFileTree();
+  } catch (err) {
+    setStatus('Upload failed');
+    showAlert(err.message, 'Upload Failed');
+  }
+}
+
+// Dropping files on the explorer uploads them into the folder under the
+// cursor, or the project root
+function initExplorerUploadDrop() {
+  const tree = fileExplorer.fileTree;
+  if (!tree) return;
+  const hasFiles = (e) => [...(e.dataTransfer?.types || [])].includes('Files');
+  const dropFolder = (e) => {
+    const item = e.target.closest('.file-tree-item[data-path]');
+    if (!item) return '';
+    const path = item.dataset.path;
+    return item.dataset.isDir === 'true' ? path : path.substring(0, path.lastIndexOf('/'));
+  };
+  tree.addEventListener('dragover', (e) => {
+    if (!hasFiles(e)) return;
+    e.preventDefault();
+    tree.classList.add('drag-over');
+  });
+  tree.addEventListener('dragleave', (e) => {
+    if (!tree.contains(e.relatedTarget)) tree.classList.remove('drag-over');
+  });
+  tree.addEventListener('drop', (e) => {
+    if (!hasFiles(e)) return;
+    e.preventDefault();
+    tree.classList.remove('drag-over');
+    uploadFilesToWorkspace([...e.dataTransfer.files], dropFolder(e));
+  });
+}
+
 function initExplorerContextMenu() {
   // Hide on click outside
   document.addEventListener('click', (e) => {
@@ -11,7 +11,9 @@ import (
 	"sync"
 	"time"
 
+	"cando/internal/clock"
 	"cando/internal/config"
+	"cando/internal/projectlock"
 )
 
 // Workspace represents a folder selected by the user
@@ -20,6 +22,8 @@ type Workspace struct {
 	Slug  string    `json:"slug"`  // Generated slug for storage (name-hash)
 	Name  string    `json:"name"`  // Display name (folder basename)
 	Added time.Time `json:"added"` // When workspace was added
+
+	Stats *WorkspaceStats `json:"stats,omitempty"` // Set on listings only, never persisted
 }
 
 // WorkspaceManager handles workspace list persistence and operations
@@ -29,6 +33,9 @@ type WorkspaceManager struct {
 	recent     []Workspace
 	current    string // Current workspace path
 	filePath   string // Path to workspaces.json
+
+	statsMu    sync.Mutex
+	statsCache map[string]*workspaceStatsEntry
 }
 
 type workspaceFile struct {
@@ -90,7 +97,7 @@ func (m *WorkspaceManager) Add(path string) (*Workspace, error) {
 		Path:  absPath,
 		Slug:  generateSlug(absPath),
 		Name:  filepath.Base(absPath),
-		Added: time.Now(),
+		Added: clock.Now(),
 	}
 
 	m.workspaces = append(m.workspaces, ws)
@@ -140,6 +147,9 @@ func (m *WorkspaceManager) Remove(path string) error {
 	if found {
 		m.addToRecentLocked(removed)
 	}
+	m.statsMu.Lock()
+	delete(m.statsCache, absPath)
+	m.statsMu.Unlock()
 
 	// If we removed the current workspace, switch to the first one (if any)
 	if m.current == absPath {
@@ -342,3 +352,21 @@ func ProjectStorageRoot(workspace string) (string, error) {
 	slug := generateSlug(workspace)
 	return filepath.Join(config.GetConfigDir(), "projects", slug), nil
 }
+
+// lockStorage takes the project lock on a storage root so a second Cando
+// instance cannot use it at the same time. After a restart it waits for the
+// previous process to let go.
+func (a *Agent) lockStorage(dataRoot string) (*projectlock.Lock, error) {
+	var wait time.Duration
+	if os.Getenv("CANDO_RESTARTING") != "" {
+		wait = 10 * time.Second
+	}
+	lock, err := projectlock.AcquireWithin(dataRoot, a.forceTakeover, wait)
+	if err != nil {
+		return nil, err
+	}
+	if lock.Displaced != nil {
+		a.logger.Printf("WARNING: took over project lock on %s from %s", dataRoot, lock.Displaced)
+	}
+	return lock, nil
+}
@@ -0,0 +1,157 @@
+package agent
+
+import (
+	"io"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"cando/internal/clock"
+	"cando/internal/tooling"
+)
+
+// workspaceIdleAfter is how long a workspace context must go unused before
+// it can be evicted, so handlers that just looked it up are never cut off.
+const workspaceIdleAfter = 2 * time.Minute
+
+// activeWorkspace describes a loaded workspace context for
+// /api/workspaces/active.
+type activeWorkspace struct {
+	Path     string    `json:"path"`
+	Name     string    `json:"name"`
+	LastUsed time.Time `json:"last_used"`
+	Running  bool      `json:"running"`  // A turn is running in it
+	Sessions int       `json:"sessions"` // Sessions known to its state manager
+}
+
+// touch marks the context as used now.
+func (c *WorkspaceContext) touch() {
+	c.lastUsed.Store(clock.Now().UnixNano())
+}
+
+func (c *WorkspaceContext) lastUsedAt() time.Time {
+	return time.Unix(0, c.lastUsed.Load())
+}
+
+// beginTurn pins the context while a turn runs in it. The returned function
+// ends the turn.
+func (c *WorkspaceContext) beginTurn() func() {
+	c.turns.Add(1)
+	c.touch()
+	return func() {
+		c.touch()
+		c.turns.Add(-1)
+	}
+}
+
+// hold pins the context while something outside a turn uses it: a
+// terminal, a WebSocket connection or the task queue. The returned function
+// releases it.
+func (c *WorkspaceContext) hold() func() {
+	c.holds.Add(1)
+	c.touch()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			c.touch()
+			c.holds.Add(-1)
+		})
+	}
+}
+
+// idle reports whether the context may be evicted: nothing runs or holds
+// it, none of its background processes is running, and it has not been
+// used for workspaceIdleAfter.
+func (c *WorkspaceContext) idle(now time.Time) bool {
+	if c.turns.Load() > 0 || c.holds.Load() > 0 || now.Sub(c.lastUsedAt()) < workspaceIdleAfter {
+		return false
+	}
+	if c.tools != nil {
+		if tool, ok := c.tools.Lookup("background_process"); ok {
+			if processes, ok := tool.(*tooling.BackgroundProcessTool); ok && processes.Running() > 0 {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// evictIdleWorkspacesLocked removes the least recently used idle contexts
+// until no more than max_workspaces remain, never touching keep. Contexts
+// that are busy or were used recently stay, even over the limit. The caller
+// holds workspacesMu and closes the returned contexts.
+func (a *Agent) evictIdleWorkspacesLocked(keep string) []*WorkspaceContext {
+	limit := a.cfg.Load().WorkspaceLimit()
+	if limit == 0 || len(a.workspaceContexts) <= limit {
+		return nil
+	}
+	now := clock.Now()
+	var idle []*WorkspaceContext
+	for root, wsCtx := range a.workspaceContexts {
+		if root != keep && wsCtx.idle(now) {
+			idle = append(idle, wsCtx)
+		}
+	}
+	sort.Slice(idle, func(i, j int) bool { return idle[i].lastUsed.Load() < idle[j].lastUsed.Load() })
+	excess := min(len(a.workspaceContexts)-limit, len(idle))
+	evicted := idle[:excess]
+	for _, wsCtx := range evicted {
+		delete(a.workspaceContexts, wsCtx.root)
+	}
+	return evicted
+}
+
+// closeWorkspaceContext flushes an evicted context's sessions and releases
+// its memory store, MCP servers and project lock.
+func (a *Agent) closeWorkspaceContext(wsCtx *WorkspaceContext) {
+	// Sessions are not written over the storage of an instance that took it over
+	if err := wsCtx.storageLock.Check(); err != nil {
+		a.logger.Printf("Not flushing sessions of evicted workspace %s: %v", wsCtx.root, err)
+	} else if err := wsCtx.states.Flush(); err != nil {
+		a.logger.Printf("Flush sessions of evicted workspace %s: %v", wsCtx.root, err)
+	}
+	if closer, ok := wsCtx.profile.(io.Closer); ok {
+		if err := closer.Close(); err != nil {
+			a.logger.Printf("Close profile of evicted workspace %s: %v", wsCtx.root, err)
+		}
+	}
+	if err := wsCtx.mcpServers.Close(); err != nil {
+		a.logger.Printf("Close MCP servers of evicted workspace %s: %v", wsCtx.root, err)
+	}
+	wsCtx.storageLock.Release()
+	a.logger.Printf("Evicted idle workspace context: %s", wsCtx.root)
+}
+
+// activeWorkspaces lists the loaded workspace contexts, most recently used
+// first.
+func (a *Agent) activeWorkspaces() []activeWorkspace {
+	a.workspacesMu.RLock()
+	active := make([]activeWorkspace, 0, len(a.workspaceContexts))
+	for root, wsCtx := range a.workspaceContexts {
+		active = append(active, activeWorkspace{
+			Path:     root,
+			Name:     filepath.Base(root),
+			LastUsed: wsCtx.lastUsedAt(),
+			Running:  wsCtx.turns.Load() > 0,
+			Sessions: len(wsCtx.states.ListKeys()),
+		})
+	}
+	a.workspacesMu.RUnlock()
+	sort.Slice(active, func(i, j int) bool { return active[i].LastUsed.After(active[j].LastUsed) })
+	return active
+}
+
+// handleActiveWorkspaces reports which workspace contexts are loaded and the
+// limit idle ones are evicted at.
+func (s *webServer) handleActiveWorkspaces(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.respondError(w, r, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	s.writeJSON(w, r, map[string]any{
+		"workspaces": s.agent.activeWorkspaces(),
+		"limit":      s.agent.cfg.Load().WorkspaceLimit(),
+	})
+}
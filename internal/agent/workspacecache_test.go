@@ -0,0 +1,133 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"cando/internal/clock"
+	"cando/internal/state"
+	"cando/internal/tooling"
+)
+
+func TestIdleWorkspaceContextsAreEvicted(t *testing.T) {
+	t.Setenv("CANDO_CONFIG_DIR", t.TempDir())
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	restore := clock.Set(func() time.Time { return now })
+	defer restore()
+
+	cfg := baseTestConfig(t.TempDir())
+	cfg.MaxWorkspaces = 2
+	cfg.ContextProfile = "memory"
+	agent := newTestAgent(t, newScriptedClient(), cfg)
+
+	open := func(name string) *WorkspaceContext {
+		t.Helper()
+		dir := filepath.Join(t.TempDir(), name)
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			t.Fatal(err)
+		}
+		wsCtx, err := agent.GetOrCreateWorkspaceContext(dir)
+		if err != nil {
+			t.Fatalf("open %s: %v", name, err)
+		}
+		now = now.Add(time.Minute)
+		return wsCtx
+	}
+
+	first := open("first")
+	endTurn := first.beginTurn()
+	second := open("second")
+	now = now.Add(workspaceIdleAfter)
+
+	// The busy context survives; the idle one is flushed and dropped
+	conv := second.states.Current()
+	conv.Append(state.Message{Role: "user", Content: "unsaved"})
+	third := open("third")
+	if got := len(agent.activeWorkspaces()); got != 2 {
+		t.Fatalf("expected 2 loaded workspaces, got %d", got)
+	}
+	for _, active := range agent.activeWorkspaces() {
+		if active.Path == second.root {
+			t.Fatal("idle workspace was not evicted")
+		}
+		if active.Path == first.root && !active.Running {
+			t.Fatal("busy workspace should be reported as running")
+		}
+	}
+	if active := agent.activeWorkspaces(); active[0].Path != third.root {
+		t.Fatalf("expected the newest workspace first, got %s", active[0].Path)
+	}
+	reopened, err := agent.GetOrCreateWorkspaceContext(second.root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msgs := reopened.states.Current().Messages(); len(msgs) == 0 || msgs[len(msgs)-1].Content != "unsaved" {
+		t.Fatalf("unsaved messages were lost on eviction: %+v", msgs)
+	}
+	endTurn()
+}
+
+func TestWorkspaceWithRunningProcessSurvivesEviction(t *testing.T) {
+	t.Setenv("CANDO_CONFIG_DIR", t.TempDir())
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	restore := clock.Set(func() time.Time { return now })
+	defer restore()
+
+	cfg := baseTestConfig(t.TempDir())
+	cfg.MaxWorkspaces = 1
+	cfg.ContextProfile = "memory"
+	agent := newTestAgent(t, newScriptedClient(), cfg)
+	open := func() *WorkspaceContext {
+		t.Helper()
+		wsCtx, err := agent.GetOrCreateWorkspaceContext(t.TempDir())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return wsCtx
+	}
+
+	serving := open()
+	tool, _ := serving.tools.Lookup("background_process")
+	started, err := tool.Call(context.Background(), map[string]any{"action": "start", "command": []string{"sleep", "30"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var job struct {
+		ID string `json:"job_id"`
+	}
+	json.Unmarshal([]byte(started), &job)
+	defer func() {
+		// Let the job's wait goroutine write its metadata before TempDir cleanup
+		tool.Call(context.Background(), map[string]any{"action": "kill", "job_id": job.ID})
+		for deadline := time.Now().Add(5 * time.Second); tool.(*tooling.BackgroundProcessTool).Running() > 0 && time.Now().Before(deadline); {
+			time.Sleep(5 * time.Millisecond)
+		}
+	}()
+	held := open()
+	release := held.hold() // An open terminal or socket
+	now = now.Add(workspaceIdleAfter)
+
+	open()
+	for _, wsCtx := range []*WorkspaceContext{serving, held} {
+		found := false
+		for _, active := range agent.activeWorkspaces() {
+			found = found || active.Path == wsCtx.root
+		}
+		if !found {
+			t.Fatalf("busy workspace %s was evicted", wsCtx.root)
+		}
+	}
+
+	release()
+	now = now.Add(workspaceIdleAfter)
+	open()
+	for _, active := range agent.activeWorkspaces() {
+		if active.Path == held.root {
+			t.Fatal("released workspace was not evicted")
+		}
+	}
+}
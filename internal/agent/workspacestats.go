@@ -0,0 +1,125 @@
+package agent
+
+import (
+	"context"
+	"io/fs"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"cando/internal/repomap"
+)
+
+const (
+	// workspaceStatsTTL is how long computed stats are served before a
+	// background refresh is started.
+	workspaceStatsTTL = 2 * time.Minute
+	// maxStatsFiles bounds the walk for very large trees.
+	maxStatsFiles = 50000
+)
+
+// WorkspaceStats summarizes a workspace for the workspace switcher.
+type WorkspaceStats struct {
+	Files        int        `json:"files"`
+	SizeBytes    int64      `json:"size_bytes"`
+	Truncated    bool       `json:"truncated,omitempty"` // Walk stopped at maxStatsFiles
+	Branch       string     `json:"branch,omitempty"`
+	DirtyFiles   int        `json:"dirty_files"`
+	LastActivity *time.Time `json:"last_activity,omitempty"`
+	ComputedAt   time.Time  `json:"computed_at"`
+}
+
+type workspaceStatsEntry struct {
+	stats      *WorkspaceStats
+	refreshing bool
+}
+
+// ListWithStats returns all workspaces with their cached stats attached.
+// Missing or stale stats are recomputed in the background, so the first
+// listing of a workspace has none.
+func (m *WorkspaceManager) ListWithStats() []Workspace {
+	list := m.List()
+	for i := range list {
+		list[i].Stats = m.stats(list[i].Path)
+	}
+	return list
+}
+
+func (m *WorkspaceManager) stats(path string) *WorkspaceStats {
+	m.statsMu.Lock()
+	defer m.statsMu.Unlock()
+	if m.statsCache == nil {
+		m.statsCache = make(map[string]*workspaceStatsEntry)
+	}
+	entry := m.statsCache[path]
+	if entry == nil {
+		entry = &workspaceStatsEntry{}
+		m.statsCache[path] = entry
+	}
+	stale := entry.stats == nil || time.Since(entry.stats.ComputedAt) > workspaceStatsTTL
+	if stale && !entry.refreshing {
+		entry.refreshing = true
+		go func() {
+			stats := computeWorkspaceStats(path)
+			m.statsMu.Lock()
+			entry.stats = stats
+			entry.refreshing = false
+			m.statsMu.Unlock()
+		}()
+	}
+	return entry.stats
+}
+
+// computeWorkspaceStats walks the workspace, skipping dependency and build
+// directories, and reads git and activity state.
+func computeWorkspaceStats(root string) *WorkspaceStats {
+	stats := &WorkspaceStats{}
+	filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if d.IsDir() {
+			if path != root && repomap.SkipDir(d.Name()) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		if stats.Files == maxStatsFiles {
+			stats.Truncated = true
+			return fs.SkipAll
+		}
+		stats.Files++
+		if info, err := d.Info(); err == nil {
+			stats.SizeBytes += info.Size()
+		}
+		return nil
+	})
+	if dirty := gitDirtyFiles(root); dirty != nil {
+		stats.DirtyFiles = len(dirty)
+		stats.Branch = gitBranch(root)
+	}
+	if entries, _, err := readActivity(root, 0, 1, ""); err == nil && len(entries) > 0 {
+		stats.LastActivity = &entries[0].Time
+	}
+	stats.ComputedAt = time.Now()
+	return stats
+}
+
+// gitBranch returns the checked-out branch, or the short commit when HEAD is
+// detached.
+func gitBranch(root string) string {
+	ctx, cancel := context.WithTimeout(context.Background(), gitTimeout)
+	defer cancel()
+	// symbolic-ref also names unborn branches, which rev-parse cannot
+	if out, err := exec.CommandContext(ctx, "git", "-C", root, "symbolic-ref", "--short", "-q", "HEAD").Output(); err == nil {
+		return strings.TrimSpace(string(out))
+	}
+	if out, err := exec.CommandContext(ctx, "git", "-C", root, "rev-parse", "--short", "HEAD").Output(); err == nil {
+		return "detached@" + strings.TrimSpace(string(out))
+	}
+	return ""
+}
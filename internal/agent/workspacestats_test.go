@@ -0,0 +1,55 @@
+package agent
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestComputeWorkspaceStats(t *testing.T) {
+	t.Setenv("CANDO_CONFIG_DIR", t.TempDir())
+	root := t.TempDir()
+	for name, content := range map[string]string{
+		"main.go":                 "package main\n",
+		"docs/readme.md":          "hello",
+		"node_modules/dep/dep.js": "ignored",
+	} {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	stats := computeWorkspaceStats(root)
+	if stats.Files != 2 || stats.SizeBytes != 18 || stats.Truncated {
+		t.Errorf("stats = %+v, want 2 files, 18 bytes", stats)
+	}
+	if stats.Branch != "" || stats.DirtyFiles != 0 || stats.LastActivity != nil {
+		t.Errorf("non-repo stats = %+v", stats)
+	}
+
+	if err := appendActivity(root, activityEntry{Kind: activityPrompt, Summary: "hi"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := exec.LookPath("git"); err == nil {
+		cmd := exec.Command("git", "-C", root, "-c", "init.defaultBranch=trunk", "init", "-q")
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git init: %v: %s", err, out)
+		}
+	}
+	stats = computeWorkspaceStats(root)
+	if stats.LastActivity == nil || time.Since(*stats.LastActivity) > time.Minute {
+		t.Errorf("last activity = %v", stats.LastActivity)
+	}
+	if _, err := exec.LookPath("git"); err == nil {
+		// git status counts the untracked node_modules file too
+		if stats.Branch != "trunk" || stats.DirtyFiles != 3 {
+			t.Errorf("git stats = branch %q, dirty %d", stats.Branch, stats.DirtyFiles)
+		}
+	}
+}
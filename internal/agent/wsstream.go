@@ -0,0 +1,299 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/websocket"
+
+	"cando/internal/tooling"
+)
+
+// wsClientMessage is a message from a /api/ws client. Type selects which
+// fields apply: prompt, cancel, tool_approval or resume.
+type wsClientMessage struct {
+	Type           string   `json:"type"`
+	Content        string   `json:"content,omitempty"`
+	IdempotencyKey string   `json:"idempotency_key,omitempty"`
+	PinnedFiles    []string `json:"pinned_files,omitempty"`
+	Takeover       bool     `json:"takeover,omitempty"` // Take the workspace lock from another tab
+	ID             string   `json:"id,omitempty"`       // Tool approval ID
+	Approved       bool     `json:"approved,omitempty"`
+	Reason         string   `json:"reason,omitempty"`
+	TurnID         string   `json:"turn_id,omitempty"`
+	LastEventID    int      `json:"last_event_id,omitempty"` // Sequence number of the last event seen
+}
+
+// wsConn is one /api/ws connection. Turn events are sent from the turn's
+// replay buffer, so a connection follows its own turns and, after a page
+// refresh, the turn another connection started.
+type wsConn struct {
+	s         *webServer
+	ws        *websocket.Conn
+	r         *http.Request
+	ctx       context.Context
+	workspace string
+	root      string
+	clientID  string
+
+	sendMu     sync.Mutex
+	followMu   sync.Mutex
+	stopFollow context.CancelFunc
+}
+
+// handleWebSocket serves GET /api/ws: prompts, cancels and tool approvals
+// in, the same events as /api/stream out. The workspace and the tab's
+// client ID come from the workspace and client_id query parameters, since
+// browsers cannot set headers on WebSocket requests.
+func (s *webServer) handleWebSocket(w http.ResponseWriter, r *http.Request) {
+	workspace := s.getWorkspaceFromRequest(r)
+	if workspace == "" || !s.workspaceExists(workspace) {
+		s.respondError(w, r, http.StatusBadRequest, "select a workspace first")
+		return
+	}
+	root, err := filepath.Abs(workspace)
+	if err != nil {
+		s.respondError(w, r, http.StatusBadRequest, fmt.Sprintf("invalid workspace: %v", err))
+		return
+	}
+	clientID := requestClientID(r)
+	if clientID == "" {
+		clientID = strings.TrimSpace(r.URL.Query().Get("client_id"))
+	}
+	server := websocket.Server{
+		Handshake: checkSameOrigin,
+		Handler: func(ws *websocket.Conn) {
+			if limit := s.agent.cfg.Load().Web.MaxBodyBytes(); limit > 0 {
+				ws.MaxPayloadBytes = int(limit)
+			}
+			// An open socket keeps its workspace context loaded
+			if wsCtx, err := s.agent.GetOrCreateWorkspaceContext(workspace); err == nil {
+				defer wsCtx.hold()()
+			}
+			ctx, cancel := context.WithCancel(r.Context())
+			defer cancel()
+			c := &wsConn{s: s, ws: ws, r: r, ctx: ctx, workspace: workspace, root: root, clientID: clientID}
+			c.serve()
+		},
+	}
+	server.ServeHTTP(w, r)
+}
+
+// serve announces the workspace's running turn, follows it, and handles
+// client messages until the connection closes.
+func (c *wsConn) serve() {
+	wsCtx, err := c.workspaceContext()
+	if err != nil {
+		c.reject("connect", http.StatusInternalServerError, err.Error())
+		return
+	}
+	hello := map[string]any{"running": wsCtx.HasInFlightRequest()}
+	if ts := c.s.streams.active(c.root); ts != nil {
+		hello["active_turn"] = activeTurn{TurnID: ts.id, LastEventID: ts.lastSeq()}
+	}
+	if c.send(map[string]any{"type": "connected", "data": hello}) != nil {
+		return
+	}
+	for {
+		var msg wsClientMessage
+		if err := websocket.JSON.Receive(c.ws, &msg); err != nil {
+			return // Closed by the client, or not JSON
+		}
+		switch msg.Type {
+		case "prompt":
+			c.prompt(msg)
+		case "resume":
+			c.resume(msg)
+		case "cancel":
+			c.cancel()
+		case "tool_approval":
+			c.approve(msg)
+		default:
+			c.reject(msg.Type, http.StatusBadRequest, fmt.Sprintf("unknown message type %q", msg.Type))
+		}
+	}
+}
+
+// workspaceContext looks the connection's workspace context up again for
+// each message, since an idle context can be evicted while the socket stays
+// open.
+func (c *wsConn) workspaceContext() (*WorkspaceContext, error) {
+	wsCtx, err := c.s.agent.GetOrCreateWorkspaceContext(c.workspace)
+	if err != nil {
+		return nil, fmt.Errorf("get workspace context: %w", err)
+	}
+	return wsCtx, nil
+}
+
+func (c *wsConn) cancel() {
+	wsCtx, err := c.workspaceContext()
+	if err != nil {
+		c.reject("cancel", http.StatusInternalServerError, err.Error())
+		return
+	}
+	c.send(map[string]any{"type": "cancel_result", "data": map[string]any{
+		"cancelled": wsCtx.CancelRequest(),
+		"running":   wsCtx.HasInFlightRequest(),
+	}})
+}
+
+func (c *wsConn) send(frame any) error {
+	c.sendMu.Lock()
+	defer c.sendMu.Unlock()
+	c.ws.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	return websocket.JSON.Send(c.ws, frame)
+}
+
+// reject answers a message that could not be carried out, with the status
+// /api/stream would have replied with.
+func (c *wsConn) reject(request string, status int, message string) {
+	c.send(map[string]any{"type": "rejected", "data": map[string]any{
+		"request": request,
+		"status":  status,
+		"message": message,
+	}})
+}
+
+// prompt starts a turn in the background and follows its events. The turn
+// keeps running for a grace period when the connection drops, so a
+// reloaded page can resume it.
+func (c *wsConn) prompt(msg wsClientMessage) {
+	s := c.s
+	content := strings.TrimSpace(msg.Content)
+	if content == "" {
+		c.reject("prompt", http.StatusBadRequest, "content is required")
+		return
+	}
+	if perMinute := s.agent.cfg.Load().Web.RequestsPerMinute(); perMinute > 0 && s.limiter != nil {
+		// The same budget as POST /api/stream
+		if ok, retryAfter, _ := s.limiter.allow(clientAddress(c.r)+" /api/stream", min(endpointLimits["/api/stream"], perMinute)); !ok {
+			c.reject("prompt", http.StatusTooManyRequests, fmt.Sprintf("too many requests; retry in %ds", int(math.Ceil(retryAfter.Seconds()))))
+			return
+		}
+	}
+	wsCtx, err := c.workspaceContext()
+	if err != nil {
+		c.reject("prompt", http.StatusInternalServerError, err.Error())
+		return
+	}
+	pins, err := s.userPins(wsCtx.root, msg.PinnedFiles)
+	if err != nil {
+		c.reject("prompt", http.StatusBadRequest, err.Error())
+		return
+	}
+	t, err := s.submitTurn(wsCtx, turnSubmission{
+		r:         c.r,
+		workspace: c.workspace,
+		content:   content,
+		key:       idempotencyKey(c.r, msg.IdempotencyKey),
+		pins:      pins,
+		clientID:  c.clientID,
+		label:     clientLabel(c.r),
+		takeover:  msg.Takeover,
+	})
+	var rejected *submitError
+	if errors.As(err, &rejected) {
+		c.reject("prompt", rejected.status, rejected.message)
+		return
+	}
+	if t.queued {
+		c.send(map[string]any{"type": "queued", "data": map[string]any{"queued": t.item, "position": t.position}})
+		return
+	}
+	c.follow(t.stream, 0)
+	go s.runTurn(c.ctx, t, nil)
+}
+
+// resume replays a turn's events after last_event_id and follows the rest.
+// Without a turn_id it attaches to the workspace's running turn.
+func (c *wsConn) resume(msg wsClientMessage) {
+	var ts *turnStream
+	if msg.TurnID != "" {
+		ts, _ = c.s.streams.get(msg.TurnID)
+	} else {
+		ts = c.s.streams.active(c.root)
+	}
+	if ts == nil {
+		c.reject("resume", http.StatusNotFound, "turn not found or expired")
+		return
+	}
+	c.follow(ts, msg.LastEventID)
+}
+
+func (c *wsConn) approve(msg wsClientMessage) {
+	if msg.ID == "" {
+		c.reject("tool_approval", http.StatusBadRequest, "id required")
+		return
+	}
+	decision := tooling.ApprovalDecision{Approved: msg.Approved, Reason: strings.TrimSpace(msg.Reason)}
+	if !c.s.agent.approvals.resolve(msg.ID, decision) {
+		c.reject("tool_approval", http.StatusNotFound, "no tool call is waiting for that approval; it may have been answered or timed out")
+		return
+	}
+	c.send(map[string]any{"type": "tool_approval_result", "data": map[string]any{"id": msg.ID, "approved": msg.Approved}})
+}
+
+// follow sends ts's events after seq until the turn ends, replacing the
+// turn the connection followed before. Each event carries an id of the
+// form "<turn>:<seq>" to resume from; a turn_finished frame marks the end,
+// also when the turn was already over.
+func (c *wsConn) follow(ts *turnStream, seq int) {
+	c.followMu.Lock()
+	if c.stopFollow != nil {
+		c.stopFollow()
+	}
+	ctx, stop := context.WithCancel(c.ctx)
+	c.stopFollow = stop
+	c.followMu.Unlock()
+
+	ts.subscribe(1)
+	go func() {
+		defer ts.subscribe(-1)
+		for {
+			events, done, wait := ts.since(seq)
+			for _, event := range events {
+				if ctx.Err() != nil {
+					return
+				}
+				if err := c.sendEvent(ts.id, event); err != nil {
+					return
+				}
+				seq = event.seq
+			}
+			if done && len(events) == 0 {
+				c.send(map[string]any{"type": "turn_finished", "data": map[string]any{"turn_id": ts.id}})
+				return
+			}
+			if len(events) > 0 {
+				continue
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-wait:
+			}
+		}
+	}()
+}
+
+// sendEvent sends a buffered event as a frame: its JSON envelope plus id.
+func (c *wsConn) sendEvent(turnID string, event bufferedEvent) error {
+	var frame map[string]json.RawMessage
+	if err := json.Unmarshal(event.payload, &frame); err != nil {
+		return err
+	}
+	id, err := json.Marshal(fmt.Sprintf("%s:%d", turnID, event.seq))
+	if err != nil {
+		return err
+	}
+	frame["id"] = id
+	return c.send(frame)
+}
@@ -0,0 +1,89 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/websocket"
+)
+
+func TestWebSocketResumesRunningTurn(t *testing.T) {
+	t.Setenv("CANDO_CONFIG_DIR", t.TempDir())
+	workspace := t.TempDir()
+	a := newTestAgent(t, newScriptedClient(), baseTestConfig(workspace))
+	s := &webServer{agent: a, streams: newTurnStreams()}
+	stream := s.streams.start("turn-1", workspace)
+	stream.append([]byte(`{"type":"turn_started","turn_id":"turn-1"}`))
+	stream.append([]byte(`{"type":"assistant_delta","turn_id":"turn-1"}`))
+
+	srv := httptest.NewServer(websocket.Handler(func(ws *websocket.Conn) {
+		c := &wsConn{s: s, ws: ws, r: ws.Request(), ctx: context.Background(), workspace: workspace, root: workspace}
+		c.serve()
+	}))
+	defer srv.Close()
+	ws, err := websocket.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), "", srv.URL)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer ws.Close()
+	ws.SetDeadline(time.Now().Add(5 * time.Second))
+
+	receive := func() map[string]any {
+		t.Helper()
+		var frame map[string]any
+		if err := websocket.JSON.Receive(ws, &frame); err != nil {
+			t.Fatalf("receive: %v", err)
+		}
+		return frame
+	}
+	send := func(msg wsClientMessage) {
+		t.Helper()
+		if err := websocket.JSON.Send(ws, msg); err != nil {
+			t.Fatalf("send: %v", err)
+		}
+	}
+
+	hello := receive()
+	var announced struct {
+		ActiveTurn activeTurn `json:"active_turn"`
+	}
+	raw, _ := json.Marshal(hello["data"])
+	json.Unmarshal(raw, &announced)
+	if hello["type"] != "connected" || announced.ActiveTurn != (activeTurn{TurnID: "turn-1", LastEventID: 2}) {
+		t.Fatalf("running turn not announced: %v", hello)
+	}
+
+	// A reloaded page that saw the first event gets the rest, then the end
+	send(wsClientMessage{Type: "resume", TurnID: "turn-1", LastEventID: 1})
+	if frame := receive(); frame["type"] != "assistant_delta" || frame["id"] != "turn-1:2" {
+		t.Fatalf("missed event not replayed: %v", frame)
+	}
+	stream.append([]byte(`{"type":"complete","turn_id":"turn-1"}`))
+	stream.finish()
+	if frame := receive(); frame["type"] != "complete" || frame["id"] != "turn-1:3" {
+		t.Fatalf("live event not forwarded: %v", frame)
+	}
+	if frame := receive(); frame["type"] != "turn_finished" {
+		t.Fatalf("turn end not marked: %v", frame)
+	}
+
+	send(wsClientMessage{Type: "cancel"})
+	if frame := receive(); frame["type"] != "cancel_result" {
+		t.Fatalf("cancel not answered: %v", frame)
+	}
+	send(wsClientMessage{Type: "resume", TurnID: "turn-gone"})
+	frame := receive()
+	data, _ := frame["data"].(map[string]any)
+	if frame["type"] != "rejected" || data["status"] != float64(http.StatusNotFound) {
+		t.Fatalf("unknown turn not rejected: %v", frame)
+	}
+	send(wsClientMessage{Type: "prompt"})
+	if frame := receive(); frame["type"] != "rejected" {
+		t.Fatalf("empty prompt not rejected: %v", frame)
+	}
+}
@@ -0,0 +1,80 @@
+// Package chatbridge connects chat platforms (Slack, Discord) to the agent.
+// Each Bot holds a long-lived connection that delivers incoming messages and
+// posts replies; the agent decides what to run for each message.
+package chatbridge
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const httpTimeout = 15 * time.Second
+
+// Message is an incoming chat message addressed to the bot.
+type Message struct {
+	ID      string // Platform message ID (Slack ts, Discord snowflake)
+	Channel string
+	Thread  string // Thread the reply belongs to (Slack thread_ts)
+	User    string
+	Text    string
+}
+
+// Bot is a connected chat platform.
+type Bot interface {
+	// Platform returns the platform name ("slack" or "discord").
+	Platform() string
+	// Run connects and delivers messages to handle until the connection
+	// drops or ctx is cancelled. Callers reconnect by calling Run again.
+	Run(ctx context.Context, handle func(Message)) error
+	// Post sends text as a reply to msg, splitting it to fit platform limits.
+	Post(ctx context.Context, msg Message, text string) error
+	// PostSnippet sends content as a titled code block, truncated to fit.
+	PostSnippet(ctx context.Context, msg Message, title, lang, content string) error
+}
+
+// New builds the bot for platform.
+func New(platform, botToken, appToken string) (Bot, error) {
+	client := &http.Client{Timeout: httpTimeout}
+	switch platform {
+	case "slack":
+		return &slackBot{botToken: botToken, appToken: appToken, client: client}, nil
+	case "discord":
+		return &discordBot{token: botToken, client: client}, nil
+	default:
+		return nil, fmt.Errorf("unsupported chat platform %q", platform)
+	}
+}
+
+// splitText breaks text into chunks of at most limit bytes, preferring line
+// boundaries.
+func splitText(text string, limit int) []string {
+	var chunks []string
+	for len(text) > limit {
+		cut := strings.LastIndex(text[:limit], "\n")
+		if cut <= 0 {
+			cut = limit
+		}
+		chunks = append(chunks, text[:cut])
+		text = strings.TrimPrefix(text[cut:], "\n")
+	}
+	if strings.TrimSpace(text) != "" {
+		chunks = append(chunks, text)
+	}
+	return chunks
+}
+
+// formatSnippet renders a code block that fits in limit bytes.
+func formatSnippet(title, lang, content string, limit int) string {
+	content = strings.ReplaceAll(content, "```", "'''")
+	header := fmt.Sprintf("*%s*\n```%s\n", title, lang)
+	const footer = "\n```"
+	const truncated = "\n… (truncated)"
+	room := limit - len(header) - len(footer)
+	if len(content) > room {
+		content = content[:max(room-len(truncated), 0)] + truncated
+	}
+	return header + content + footer
+}
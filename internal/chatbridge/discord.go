@@ -0,0 +1,245 @@
+package chatbridge
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/websocket"
+)
+
+const (
+	discordAPIBase      = "https://discord.com/api/v10"
+	discordGatewayQuery = "/?v=10&encoding=json"
+	discordMessageLimit = 2000
+	// GUILD_MESSAGES | DIRECT_MESSAGES | MESSAGE_CONTENT
+	discordIntents = 1<<9 | 1<<12 | 1<<15
+)
+
+// Gateway opcodes
+const (
+	discordOpDispatch       = 0
+	discordOpHeartbeat      = 1
+	discordOpIdentify       = 2
+	discordOpReconnect      = 7
+	discordOpInvalidSession = 9
+	discordOpHello          = 10
+)
+
+var discordMentionPattern = regexp.MustCompile(`<@!?[0-9]+>`)
+
+// discordBot receives messages over the Discord gateway and replies via REST.
+type discordBot struct {
+	token  string
+	client *http.Client
+}
+
+type discordPayload struct {
+	Op       int             `json:"op"`
+	Data     json.RawMessage `json:"d,omitempty"`
+	Sequence *int64          `json:"s,omitempty"`
+	Type     string          `json:"t,omitempty"`
+}
+
+func (b *discordBot) Platform() string { return "discord" }
+
+func (b *discordBot) Run(ctx context.Context, handle func(Message)) error {
+	var gateway struct {
+		URL string `json:"url"`
+	}
+	if err := b.call(ctx, http.MethodGet, "/gateway/bot", nil, &gateway); err != nil {
+		return err
+	}
+
+	cfg, err := websocket.NewConfig(gateway.URL+discordGatewayQuery, "https://discord.com")
+	if err != nil {
+		return fmt.Errorf("discord gateway url: %w", err)
+	}
+	conn, err := cfg.DialContext(ctx)
+	if err != nil {
+		return fmt.Errorf("discord gateway connect: %w", err)
+	}
+	defer conn.Close()
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	var (
+		sendMu   sync.Mutex
+		seqMu    sync.Mutex
+		sequence *int64
+		selfID   string
+	)
+	send := func(op int, data any) error {
+		raw, err := json.Marshal(data)
+		if err != nil {
+			return err
+		}
+		sendMu.Lock()
+		defer sendMu.Unlock()
+		return websocket.JSON.Send(conn, discordPayload{Op: op, Data: raw})
+	}
+
+	heartbeatDone := make(chan struct{})
+	defer close(heartbeatDone)
+
+	for {
+		var payload discordPayload
+		if err := websocket.JSON.Receive(conn, &payload); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return fmt.Errorf("discord gateway read: %w", err)
+		}
+		if payload.Sequence != nil {
+			seqMu.Lock()
+			sequence = payload.Sequence
+			seqMu.Unlock()
+		}
+
+		switch payload.Op {
+		case discordOpHello:
+			var hello struct {
+				HeartbeatInterval int `json:"heartbeat_interval"`
+			}
+			if err := json.Unmarshal(payload.Data, &hello); err != nil || hello.HeartbeatInterval <= 0 {
+				return errors.New("discord gateway: invalid hello")
+			}
+			go func() {
+				ticker := time.NewTicker(time.Duration(hello.HeartbeatInterval) * time.Millisecond)
+				defer ticker.Stop()
+				for {
+					select {
+					case <-ticker.C:
+						seqMu.Lock()
+						seq := sequence
+						seqMu.Unlock()
+						if err := send(discordOpHeartbeat, seq); err != nil {
+							conn.Close()
+							return
+						}
+					case <-heartbeatDone:
+						return
+					}
+				}
+			}()
+			identify := map[string]any{
+				"token":   b.token,
+				"intents": discordIntents,
+				"properties": map[string]string{
+					"os":      "linux",
+					"browser": "cando",
+					"device":  "cando",
+				},
+			}
+			if err := send(discordOpIdentify, identify); err != nil {
+				return fmt.Errorf("discord identify: %w", err)
+			}
+
+		case discordOpReconnect:
+			return errors.New("discord requested reconnect")
+
+		case discordOpInvalidSession:
+			return errors.New("discord invalidated the session")
+
+		case discordOpDispatch:
+			switch payload.Type {
+			case "READY":
+				var ready struct {
+					User struct {
+						ID string `json:"id"`
+					} `json:"user"`
+				}
+				if err := json.Unmarshal(payload.Data, &ready); err == nil {
+					selfID = ready.User.ID
+				}
+			case "MESSAGE_CREATE":
+				var event struct {
+					ID        string `json:"id"`
+					ChannelID string `json:"channel_id"`
+					Content   string `json:"content"`
+					Author    struct {
+						ID  string `json:"id"`
+						Bot bool   `json:"bot"`
+					} `json:"author"`
+				}
+				if err := json.Unmarshal(payload.Data, &event); err != nil {
+					continue
+				}
+				if event.Author.Bot || event.Author.ID == selfID {
+					continue
+				}
+				text := strings.TrimSpace(discordMentionPattern.ReplaceAllString(event.Content, ""))
+				if text == "" {
+					continue
+				}
+				handle(Message{ID: event.ID, Channel: event.ChannelID, User: event.Author.ID, Text: text})
+			}
+		}
+	}
+}
+
+func (b *discordBot) Post(ctx context.Context, msg Message, text string) error {
+	for _, chunk := range splitText(text, discordMessageLimit) {
+		if err := b.createMessage(ctx, msg, chunk); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (b *discordBot) PostSnippet(ctx context.Context, msg Message, title, lang, content string) error {
+	return b.createMessage(ctx, msg, formatSnippet(title, lang, content, discordMessageLimit))
+}
+
+func (b *discordBot) createMessage(ctx context.Context, msg Message, text string) error {
+	payload := map[string]any{"content": text}
+	if msg.ID != "" {
+		payload["message_reference"] = map[string]any{
+			"message_id":         msg.ID,
+			"fail_if_not_exists": false,
+		}
+	}
+	return b.call(ctx, http.MethodPost, "/channels/"+msg.Channel+"/messages", payload, nil)
+}
+
+// call invokes a Discord REST endpoint with bot authorization.
+func (b *discordBot) call(ctx context.Context, method, path string, payload any, out any) error {
+	var body io.Reader
+	if payload != nil {
+		data, err := json.Marshal(payload)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, discordAPIBase+path, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bot "+b.token)
+	req.Header.Set("User-Agent", "DiscordBot (https://github.com/cutoken/cando, 1)")
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("discord %s: %w", path, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("discord %s: %s: %s", path, resp.Status, strings.TrimSpace(string(detail)))
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
@@ -0,0 +1,177 @@
+package chatbridge
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/websocket"
+)
+
+const (
+	slackAPIBase = "https://slack.com/api/"
+	// chat.postMessage accepts more, but Slack truncates long texts in the UI
+	slackMessageLimit = 3900
+)
+
+var slackMentionPattern = regexp.MustCompile(`<@[A-Z0-9]+>`)
+
+// slackBot receives events over Socket Mode, so no public URL is needed.
+type slackBot struct {
+	botToken string // xoxb- token for posting
+	appToken string // xapp- token for Socket Mode
+	client   *http.Client
+}
+
+type slackEnvelope struct {
+	EnvelopeID string `json:"envelope_id"`
+	Type       string `json:"type"`
+	Payload    struct {
+		Event struct {
+			Type     string `json:"type"`
+			Subtype  string `json:"subtype"`
+			BotID    string `json:"bot_id"`
+			User     string `json:"user"`
+			Channel  string `json:"channel"`
+			Text     string `json:"text"`
+			TS       string `json:"ts"`
+			ThreadTS string `json:"thread_ts"`
+		} `json:"event"`
+	} `json:"payload"`
+}
+
+func (b *slackBot) Platform() string { return "slack" }
+
+func (b *slackBot) Run(ctx context.Context, handle func(Message)) error {
+	var opened struct {
+		URL string `json:"url"`
+	}
+	if err := b.call(ctx, b.appToken, "apps.connections.open", nil, &opened); err != nil {
+		return err
+	}
+
+	cfg, err := websocket.NewConfig(opened.URL, "https://slack.com")
+	if err != nil {
+		return fmt.Errorf("slack socket url: %w", err)
+	}
+	conn, err := cfg.DialContext(ctx)
+	if err != nil {
+		return fmt.Errorf("slack socket connect: %w", err)
+	}
+	defer conn.Close()
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	// A channel mention arrives as both "message" and "app_mention"
+	seen := make(map[string]bool)
+	var seenOrder []string
+
+	for {
+		var env slackEnvelope
+		if err := websocket.JSON.Receive(conn, &env); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return fmt.Errorf("slack socket read: %w", err)
+		}
+		if env.EnvelopeID != "" {
+			if err := websocket.JSON.Send(conn, map[string]string{"envelope_id": env.EnvelopeID}); err != nil {
+				return fmt.Errorf("slack socket ack: %w", err)
+			}
+		}
+		switch env.Type {
+		case "disconnect":
+			return errors.New("slack requested reconnect")
+		case "events_api":
+			event := env.Payload.Event
+			// Skip bot messages (including our own replies) and edits/joins
+			if event.BotID != "" || event.Subtype != "" {
+				continue
+			}
+			if event.Type != "message" && event.Type != "app_mention" {
+				continue
+			}
+			thread := event.ThreadTS
+			if thread == "" {
+				thread = event.TS
+			}
+			text := strings.TrimSpace(slackMentionPattern.ReplaceAllString(event.Text, ""))
+			if text == "" || seen[event.TS] {
+				continue
+			}
+			seen[event.TS] = true
+			seenOrder = append(seenOrder, event.TS)
+			if len(seenOrder) > 256 {
+				delete(seen, seenOrder[0])
+				seenOrder = seenOrder[1:]
+			}
+			handle(Message{ID: event.TS, Channel: event.Channel, Thread: thread, User: event.User, Text: text})
+		}
+	}
+}
+
+func (b *slackBot) Post(ctx context.Context, msg Message, text string) error {
+	for _, chunk := range splitText(text, slackMessageLimit) {
+		if err := b.postMessage(ctx, msg, chunk); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (b *slackBot) PostSnippet(ctx context.Context, msg Message, title, lang, content string) error {
+	return b.postMessage(ctx, msg, formatSnippet(title, lang, content, slackMessageLimit))
+}
+
+func (b *slackBot) postMessage(ctx context.Context, msg Message, text string) error {
+	payload := map[string]string{"channel": msg.Channel, "text": text}
+	if msg.Thread != "" {
+		payload["thread_ts"] = msg.Thread
+	}
+	return b.call(ctx, b.botToken, "chat.postMessage", payload, nil)
+}
+
+// call invokes a Slack Web API method and checks the "ok" field.
+func (b *slackBot) call(ctx context.Context, token, method string, payload any, out any) error {
+	var body bytes.Buffer
+	if payload != nil {
+		if err := json.NewEncoder(&body).Encode(payload); err != nil {
+			return err
+		}
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, slackAPIBase+method, &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("slack %s: %w", method, err)
+	}
+	defer resp.Body.Close()
+
+	var raw json.RawMessage
+	if err := json.NewDecoder(resp.Body).Decode(&raw); err != nil {
+		return fmt.Errorf("slack %s: decode response: %w", method, err)
+	}
+	var status struct {
+		OK    bool   `json:"ok"`
+		Error string `json:"error"`
+	}
+	if err := json.Unmarshal(raw, &status); err != nil {
+		return fmt.Errorf("slack %s: decode response: %w", method, err)
+	}
+	if !status.OK {
+		return fmt.Errorf("slack %s: %s", method, status.Error)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.Unmarshal(raw, out)
+}
@@ -0,0 +1,52 @@
+// Package clock is the time source for timestamps that are stored or shown:
+// conversation and memory times, memory IDs and workspace entries. It reads
+// the system clock unless a test pins it with Set.
+package clock
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var source atomic.Pointer[func() time.Time]
+
+// Now returns the current time from the active source.
+func Now() time.Time {
+	if f := source.Load(); f != nil {
+		return (*f)()
+	}
+	return time.Now()
+}
+
+// Set replaces the time source and returns a function that restores the
+// previous one. A nil f restores the system clock.
+func Set(f func() time.Time) (restore func()) {
+	var prev *func() time.Time
+	if f == nil {
+		prev = source.Swap(nil)
+	} else {
+		prev = source.Swap(&f)
+	}
+	return func() { source.Store(prev) }
+}
+
+// Fixed returns a source that always reports t.
+func Fixed(t time.Time) func() time.Time {
+	return func() time.Time { return t }
+}
+
+// Stepping returns a source that starts at start and moves forward by step
+// on every call, so consecutive timestamps stay distinct and ordered while
+// still being reproducible.
+func Stepping(start time.Time, step time.Duration) func() time.Time {
+	var mu sync.Mutex
+	next := start
+	return func() time.Time {
+		mu.Lock()
+		defer mu.Unlock()
+		t := next
+		next = next.Add(step)
+		return t
+	}
+}
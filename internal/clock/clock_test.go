@@ -0,0 +1,31 @@
+package clock
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSetAndRestore(t *testing.T) {
+	start := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	restore := Set(Stepping(start, time.Second))
+	if got := Now(); !got.Equal(start) {
+		t.Fatalf("first reading = %v, want %v", got, start)
+	}
+	if got := Now(); !got.Equal(start.Add(time.Second)) {
+		t.Fatalf("second reading = %v, want one step later", got)
+	}
+
+	inner := Set(Fixed(start))
+	if !Now().Equal(start) || !Now().Equal(start) {
+		t.Fatal("fixed source should not move")
+	}
+	inner()
+	if got := Now(); !got.Equal(start.Add(2 * time.Second)) {
+		t.Fatalf("after restoring the stepping source got %v", got)
+	}
+
+	restore()
+	if time.Since(Now()) > time.Minute {
+		t.Fatal("expected the system clock after restore")
+	}
+}
@@ -3,13 +3,18 @@ package config
 import (
 	"fmt"
 	"log"
+	"net/url"
 	"os"
+	"path"
 	"path/filepath"
+	"regexp"
+	"slices"
 	"strings"
 	"time"
 
 	"cando/internal/config/migrate"
 	"cando/internal/prompts"
+	"cando/internal/state"
 	"gopkg.in/yaml.v3"
 )
 
@@ -32,6 +37,21 @@ var ProviderDefaults = map[string]ProviderModelDefaults{
 		Summary: "qwen/qwen3-30b-a3b-instruct-2507",
 		VL:      "qwen/qwen2.5-vl-32b-instruct",
 	},
+	"openai": {
+		Main:    "gpt-4.1",
+		Summary: "gpt-4.1-mini",
+		VL:      "gpt-4.1",
+	},
+	"azure": { // Deployment names; these match the usual model deployments
+		Main:    "gpt-4.1",
+		Summary: "gpt-4.1-mini",
+		VL:      "gpt-4.1",
+	},
+	"ollama": { // Local models; any pulled model can be chosen in settings
+		Main:    "qwen2.5-coder",
+		Summary: "qwen2.5-coder",
+		VL:      "llava",
+	},
 	"mock": {
 		Main:    "mock-model",
 		Summary: "mock-summary-model",
@@ -41,7 +61,13 @@ var ProviderDefaults = map[string]ProviderModelDefaults{
 
 // KnownProviders returns the list of all known provider keys
 func KnownProviders() []string {
-	return []string{"zai", "openrouter", "mock"}
+	return []string{"zai", "openrouter", "openai", "azure", "ollama", "mock"}
+}
+
+// RequiresAPIKey reports whether provider is only available with a
+// configured key. Ollama runs locally and is available whenever it answers.
+func RequiresAPIKey(provider string) bool {
+	return provider != "ollama"
 }
 
 // DefaultConfig returns a config with all defaults set - SINGLE SOURCE OF TRUTH
@@ -64,6 +90,9 @@ func DefaultConfig() Config {
 		ZAIVisionURL:          "https://api.z.ai/api/coding/paas/v4/chat/completions",
 		OpenRouterBaseURL:     "https://openrouter.ai/api/v1",
 		OpenRouterVisionURL:   "https://openrouter.ai/api/v1/chat/completions",
+		OpenAIBaseURL:         "https://api.openai.com/v1",
+		AzureOpenAIAPIVersion: "2024-10-21",
+		OllamaURL:             "http://localhost:11434",
 		ProviderModels:        make(map[string]string),
 		ProviderSummaryModels: make(map[string]string),
 		ProviderVLModels:      make(map[string]string),
@@ -89,36 +118,340 @@ func DefaultConfig() Config {
 const DefaultCompactionPrompt = "Summarize the following text in 20 words or fewer. Return only the summary."
 
 type Config struct {
-	ConfigVersion         int               `yaml:"config_version"`
-	Model                 string            `yaml:"model"`
-	SummaryModel          string            `yaml:"summary_model"`
-	VLModel               string            `yaml:"vl_model"`
-	BaseURL               string            `yaml:"base_url"`
-	Provider              string            `yaml:"provider"`
-	ProviderModels        map[string]string `yaml:"provider_models"`
-	ProviderSummaryModels map[string]string `yaml:"provider_summary_models"`
-	ProviderVLModels      map[string]string `yaml:"provider_vl_models"`
-	Temperature           float64           `yaml:"temperature"`
-	SystemPrompt          string            `yaml:"system_prompt"`
-	RequestTimeoutSeconds int               `yaml:"request_timeout_seconds"`
-	ConversationDir       string            `yaml:"conversation_dir"`
-	WorkspaceRoot         string            `yaml:"workspace_root"`
-	ShellTimeoutSeconds   int               `yaml:"shell_timeout_seconds"`
-	ContextProfile        string            `yaml:"context_profile"`
-	ZAIBaseURL            string            `yaml:"zai_base_url"`
-	ZAIVisionURL          string            `yaml:"zai_vision_url"`
-	OpenRouterBaseURL     string            `yaml:"openrouter_base_url"`
-	OpenRouterVisionURL   string            `yaml:"openrouter_vision_url"`
-	ContextMessagePercent float64           `yaml:"context_message_percent"`
-	ContextTotalPercent   float64           `yaml:"context_conversation_percent"`
-	ContextProtectRecent  int               `yaml:"context_protect_recent"`
-	MemoryStorePath       string            `yaml:"memory_store_path"`
-	HistoryPath           string            `yaml:"history_path"`
-	ThinkingEnabled       bool              `yaml:"thinking_enabled"`
-	ForceThinking         bool              `yaml:"force_thinking"`
-	CompactionPrompt      string            `yaml:"compaction_summary_prompt"`
-	OpenRouterFreeMode    bool              `yaml:"openrouter_free_mode"`
-	AnalyticsEnabled      *bool             `yaml:"analytics_enabled,omitempty"` // nil = default true
+	ConfigVersion          int               `yaml:"config_version"`
+	Model                  string            `yaml:"model"`
+	SummaryModel           string            `yaml:"summary_model"`
+	VLModel                string            `yaml:"vl_model"`
+	BaseURL                string            `yaml:"base_url"`
+	Provider               string            `yaml:"provider"`
+	ProviderModels         map[string]string `yaml:"provider_models"`
+	ProviderSummaryModels  map[string]string `yaml:"provider_summary_models"`
+	ProviderVLModels       map[string]string `yaml:"provider_vl_models"`
+	Temperature            float64           `yaml:"temperature"`
+	SystemPrompt           string            `yaml:"system_prompt"`
+	RequestTimeoutSeconds  int               `yaml:"request_timeout_seconds"`
+	ConversationDir        string            `yaml:"conversation_dir"`
+	WorkspaceRoot          string            `yaml:"workspace_root"`
+	ShellTimeoutSeconds    int               `yaml:"shell_timeout_seconds"`
+	ContextProfile         string            `yaml:"context_profile"`
+	ZAIBaseURL             string            `yaml:"zai_base_url"`
+	ZAIVisionURL           string            `yaml:"zai_vision_url"`
+	OpenRouterBaseURL      string            `yaml:"openrouter_base_url"`
+	OpenRouterVisionURL    string            `yaml:"openrouter_vision_url"`
+	OpenAIBaseURL          string            `yaml:"openai_base_url"`
+	AzureOpenAIEndpoint    string            `yaml:"azure_openai_endpoint,omitempty"`    // e.g. https://my-resource.openai.azure.com
+	AzureOpenAIAPIVersion  string            `yaml:"azure_openai_api_version,omitempty"` // Data-plane API version
+	OllamaURL              string            `yaml:"ollama_url"`
+	ContextMessagePercent  float64           `yaml:"context_message_percent"`
+	ContextTotalPercent    float64           `yaml:"context_conversation_percent"`
+	ContextProtectRecent   int               `yaml:"context_protect_recent"`
+	MemoryStorePath        string            `yaml:"memory_store_path"`
+	HistoryPath            string            `yaml:"history_path"`
+	ThinkingEnabled        bool              `yaml:"thinking_enabled"`
+	ForceThinking          bool              `yaml:"force_thinking"`
+	CompactionPrompt       string            `yaml:"compaction_summary_prompt"`
+	OpenRouterFreeMode     bool              `yaml:"openrouter_free_mode"`
+	AnalyticsEnabled       *bool             `yaml:"analytics_enabled,omitempty"`       // nil = default true
+	TerminalRecordCommands bool              `yaml:"terminal_record_commands"`          // Append in-UI terminal commands to the conversation
+	ShellInteractive       bool              `yaml:"shell_interactive"`                 // Let the shell tool hand interactive commands to the user
+	ChatBridges            []ChatBridge      `yaml:"chat_bridges"`                      // Slack/Discord bots relaying prompts to a workspace
+	Digest                 DigestConfig      `yaml:"digest"`                            // Daily activity email
+	ContentPolicy          ContentPolicy     `yaml:"content_policy"`                    // Filters applied to assistant output
+	TurnTimeLimitSeconds   int               `yaml:"turn_time_limit_seconds"`           // Wall-clock budget per turn (0 disables)
+	TurnGraceSeconds       int               `yaml:"turn_grace_seconds"`                // Time to wrap up after the budget before a hard stop
+	RetryPolicies          RetryPolicies     `yaml:"retry_policies,omitempty"`          // Keyed by provider; "default" applies to all
+	Web                    WebConfig         `yaml:"web,omitempty"`                     // Embedded web server security and listener options
+	VisionAutoCaption      *bool             `yaml:"vision_auto_caption,omitempty"`     // Caption images tools create; nil = default true
+	ProjectProfile         *bool             `yaml:"project_profile,omitempty"`         // Inject detected languages/tools; nil = default true
+	RepoMapTokens          int               `yaml:"repo_map_tokens,omitempty"`         // Budget for the injected repository map (0 = default, -1 disables)
+	SystemPromptTokens     int               `yaml:"system_prompt_tokens,omitempty"`    // Budget for project context added to the system message (0 = 15% of the context window, -1 disables)
+	LargeFileLimitKB       int               `yaml:"large_file_limit_kb,omitempty"`     // Edits to bigger files need confirm (0 = 1024, -1 disables)
+	AllowExternalSymlinks  bool              `yaml:"allow_external_symlinks,omitempty"` // Let tools follow workspace symlinks that point outside it
+	RecentFilesHint        *bool             `yaml:"recent_files_hint,omitempty"`       // List files the session recently read or edited; nil = default true
+	MaxSessionMessages     int               `yaml:"max_session_messages,omitempty"`    // Archive older history past this many messages (0 = 2000, -1 disables)
+	MaxSessionMB           int               `yaml:"max_session_mb,omitempty"`          // Archive older history past this file size (0 = 20, -1 disables)
+	SyncWrites             *bool             `yaml:"sync_writes,omitempty"`             // fsync session and plan files on save; nil = default true
+	SessionTitles          *bool             `yaml:"session_titles,omitempty"`          // Name sessions with the summary model after their first reply; nil = default true
+	MaxWorkspaces          int               `yaml:"max_workspaces,omitempty"`          // Workspace contexts kept loaded in web mode (0 = 8, -1 disables eviction)
+	Warmup                 *bool             `yaml:"warmup,omitempty"`                  // Check provider keys and prefetch model lists at startup; nil = default true
+	BugHunt                bool              `yaml:"bug_hunt,omitempty"`                // Seed turns with recent commits touching the files a prompt names
+	ParallelToolCalls      int               `yaml:"parallel_tool_calls,omitempty"`     // Read-only tool calls from one reply run at once (0 = 4, -1 runs every call in turn)
+	MCPServers             []MCPServer       `yaml:"mcp_servers,omitempty"`             // Model Context Protocol servers whose tools are offered to the model
+	ToolPermissions        ToolPermissions   `yaml:"tool_permissions,omitempty"`        // Keyed by workspace path; "default" applies to all
+	ShellSandbox           ShellSandboxes    `yaml:"shell_sandbox,omitempty"`           // Where shell commands run, keyed by workspace path; "default" applies to all
+	ShellCommands          ShellCommandRules `yaml:"shell_commands,omitempty"`          // Commands the shell tool may run, keyed by workspace path; "default" applies to all
+	GitAuthor              GitAuthor         `yaml:"git_author,omitempty"`              // Identity of commits made by git_commit (empty = git's own config)
+	SessionBudget          state.Budget      `yaml:"session_budget,omitempty"`          // Default token and cost limits per session (zero = unlimited)
+}
+
+// WebConfig holds options for the embedded web server.
+type WebConfig struct {
+	AllowedHosts []string `yaml:"allowed_hosts,omitempty"` // Host names accepted besides localhost and IP addresses
+	CORSOrigins  []string `yaml:"cors_origins,omitempty"`  // Origins of external frontends allowed to call the API
+	TLS          WebTLS   `yaml:"tls,omitempty"`
+	// Socket makes the server listen on this Unix socket instead of TCP.
+	// Only the owner may connect unless SocketGroupAccess is set.
+	Socket            string `yaml:"socket,omitempty"`
+	SocketGroupAccess bool   `yaml:"socket_group_access,omitempty"`
+	RateLimit         int    `yaml:"rate_limit,omitempty"`    // Requests per minute per client address (0 = 1200, -1 disables rate limits)
+	MaxBodyMB         int    `yaml:"max_body_mb,omitempty"`   // Largest request body (0 = 10, -1 disables)
+	MaxUploadMB       int    `yaml:"max_upload_mb,omitempty"` // Largest file upload, and zip content once extracted (0 = 100)
+	// AuthToken is the bearer token --headless requires on every request.
+	// When empty, a new token is generated and printed at each start.
+	AuthToken string `yaml:"auth_token,omitempty"`
+}
+
+// RequestsPerMinute is the per-client request budget, or 0 when rate
+// limiting is off.
+func (w WebConfig) RequestsPerMinute() int {
+	switch {
+	case w.RateLimit < 0:
+		return 0
+	case w.RateLimit == 0:
+		return 1200
+	}
+	return w.RateLimit
+}
+
+// MaxBodyBytes is the request body limit, or 0 when bodies are unlimited.
+func (w WebConfig) MaxBodyBytes() int64 {
+	switch {
+	case w.MaxBodyMB < 0:
+		return 0
+	case w.MaxBodyMB == 0:
+		return 10 << 20
+	}
+	return int64(w.MaxBodyMB) << 20
+}
+
+// MaxUploadBytes is the largest upload /api/files/upload accepts. It also
+// caps the extracted size of an uploaded zip.
+func (w WebConfig) MaxUploadBytes() int64 {
+	if w.MaxUploadMB == 0 {
+		return 100 << 20
+	}
+	return int64(w.MaxUploadMB) << 20
+}
+
+// WebTLS serves the web UI over HTTPS. With no certificate configured, a
+// self-signed one is generated under the config directory.
+type WebTLS struct {
+	Enabled  bool   `yaml:"enabled"`
+	CertFile string `yaml:"cert_file,omitempty"` // PEM certificate chain
+	KeyFile  string `yaml:"key_file,omitempty"`  // PEM private key
+}
+
+// On reports whether the web server should use TLS.
+func (t WebTLS) On() bool {
+	return t.Enabled || t.CertFile != ""
+}
+
+// Scheme returns the URL scheme the web server is reachable on.
+func (w WebConfig) Scheme() string {
+	if w.TLS.On() {
+		return "https"
+	}
+	return "http"
+}
+
+// RetryPolicies maps provider keys to retry policies.
+type RetryPolicies map[string]RetryPolicy
+
+// RetryPolicy controls how failed provider calls are retried. Zero fields
+// fall back to the default policy.
+type RetryPolicy struct {
+	MaxAttempts int      `yaml:"max_attempts,omitempty"`
+	BaseDelayMs int      `yaml:"base_delay_ms,omitempty"` // First backoff, doubled per attempt
+	MaxDelayMs  int      `yaml:"max_delay_ms,omitempty"`  // Backoff cap
+	Jitter      float64  `yaml:"jitter,omitempty"`        // 0-1, randomizes each delay by up to this fraction
+	RetryOn     []string `yaml:"retry_on,omitempty"`      // Error classes to retry (rate_limit, provider_down, unknown, network, ...); empty uses each provider's classification
+}
+
+// DefaultRetryPolicy matches the original hard-coded behavior.
+var DefaultRetryPolicy = RetryPolicy{MaxAttempts: 5, BaseDelayMs: 1000, MaxDelayMs: 16000}
+
+// RetryPolicyFor resolves the retry policy for a provider: defaults, then the
+// "default" entry, then the provider's own entry.
+func (c Config) RetryPolicyFor(provider string) RetryPolicy {
+	policy := DefaultRetryPolicy
+	for _, key := range []string{"default", provider} {
+		override, ok := c.RetryPolicies[key]
+		if !ok {
+			continue
+		}
+		if override.MaxAttempts > 0 {
+			policy.MaxAttempts = override.MaxAttempts
+		}
+		if override.BaseDelayMs > 0 {
+			policy.BaseDelayMs = override.BaseDelayMs
+		}
+		if override.MaxDelayMs > 0 {
+			policy.MaxDelayMs = override.MaxDelayMs
+		}
+		if override.Jitter > 0 {
+			policy.Jitter = override.Jitter
+		}
+		if len(override.RetryOn) > 0 {
+			policy.RetryOn = override.RetryOn
+		}
+	}
+	return policy
+}
+
+// ContentPolicy blocks assistant output that matches any rule. A violation
+// halts the turn before the output reaches tools or the UI.
+type ContentPolicy struct {
+	Enabled         bool     `yaml:"enabled"`
+	BlockPatterns   []string `yaml:"block_patterns,omitempty"`   // Regular expressions
+	BlockKeywords   []string `yaml:"block_keywords,omitempty"`   // Case-insensitive substrings
+	ModerationModel string   `yaml:"moderation_model,omitempty"` // Optional model asked to classify output
+	// ModerationFailClosed blocks output when the moderation call fails.
+	ModerationFailClosed bool `yaml:"moderation_fail_closed,omitempty"`
+}
+
+// DigestConfig controls the daily email digest of agent activity across
+// workspaces. The SMTP password is expanded with environment variables.
+type DigestConfig struct {
+	Enabled      bool     `yaml:"enabled"`
+	Hour         int      `yaml:"hour"` // Local hour (0-23) the digest is sent
+	SMTPHost     string   `yaml:"smtp_host"`
+	SMTPPort     int      `yaml:"smtp_port"` // Defaults to 587; 465 uses implicit TLS
+	SMTPUsername string   `yaml:"smtp_username,omitempty"`
+	SMTPPassword string   `yaml:"smtp_password,omitempty"`
+	From         string   `yaml:"from"`
+	To           []string `yaml:"to"`
+}
+
+// ChatBridge connects a Slack or Discord bot to one workspace session.
+// Token fields are expanded with environment variables so secrets can stay
+// out of config.yaml (e.g. bot_token: $SLACK_BOT_TOKEN).
+type ChatBridge struct {
+	Platform     string   `yaml:"platform"`                // slack | discord
+	BotToken     string   `yaml:"bot_token"`               // Slack xoxb- token or Discord bot token
+	AppToken     string   `yaml:"app_token,omitempty"`     // Slack xapp- token for Socket Mode
+	Channel      string   `yaml:"channel,omitempty"`       // Only relay messages from this channel ID
+	AllowedUsers []string `yaml:"allowed_users,omitempty"` // Only relay messages from these user IDs
+	Workspace    string   `yaml:"workspace"`               // Workspace path prompts run in
+	Session      string   `yaml:"session,omitempty"`       // Session key (defaults to the workspace's current session)
+}
+
+// GitAuthor is the author and committer of commits the agent makes.
+type GitAuthor struct {
+	Name  string `yaml:"name,omitempty"`
+	Email string `yaml:"email,omitempty"`
+}
+
+// ToolPermissions maps "default" or a workspace path to the permission of
+// each tool: allow (the default), ask or deny. "*" names every tool not
+// listed.
+type ToolPermissions map[string]map[string]string
+
+// ToolPermissionFor returns the permission of tool in workspace. Entries for
+// the workspace take precedence over "default".
+func (c Config) ToolPermissionFor(workspace, tool string) string {
+	var sets []map[string]string
+	if set, ok := workspaceEntry(c.ToolPermissions, workspace); ok {
+		sets = append(sets, set)
+	}
+	sets = append(sets, c.ToolPermissions["default"])
+	for _, set := range sets {
+		if permission, ok := set[tool]; ok {
+			return permission
+		}
+		if permission, ok := set["*"]; ok {
+			return permission
+		}
+	}
+	return "allow"
+}
+
+// ShellSandboxes maps "default" or a workspace path to the backend the
+// shell tool runs commands in.
+type ShellSandboxes map[string]ShellSandbox
+
+// ShellSandbox is how shell commands run: directly on the host (the
+// default), in a Docker container, or under bubblewrap or firejail on Linux.
+// Sandboxed commands see the workspace at its usual path, get only the
+// environment variables listed in Env, and have no network unless Network
+// is set.
+type ShellSandbox struct {
+	Backend string            `yaml:"backend,omitempty"` // direct, docker, bubblewrap or firejail
+	Image   string            `yaml:"image,omitempty"`   // docker: image the container runs
+	Network bool              `yaml:"network,omitempty"` // Allow network access
+	Env     map[string]string `yaml:"env,omitempty"`     // Variables set inside the sandbox
+	Args    []string          `yaml:"args,omitempty"`    // Extra arguments for docker run, bwrap or firejail
+}
+
+// ShellSandboxFor returns the sandbox of shell commands in workspace. An
+// entry for the workspace replaces "default".
+func (c Config) ShellSandboxFor(workspace string) ShellSandbox {
+	if sandbox, ok := workspaceEntry(c.ShellSandbox, workspace); ok {
+		return sandbox
+	}
+	return c.ShellSandbox["default"]
+}
+
+// ShellCommandRules maps "default" or a workspace path to the commands the
+// shell tool may run without asking.
+type ShellCommandRules map[string]ShellCommandRule
+
+// ShellCommandRule lists command patterns such as "git push --force". The
+// first word of a pattern matches the program, and each further word one of
+// its arguments in any order. Words may use *, ? and [...] as in file
+// globs. Commands that match Deny, or miss a non-empty Allow, need the
+// user's approval.
+type ShellCommandRule struct {
+	Allow []string `yaml:"allow,omitempty"` // When set, only matching commands run without asking
+	Deny  []string `yaml:"deny,omitempty"`  // nil = DefaultShellDeny
+}
+
+// DefaultShellDeny is the deny list of workspaces that don't set one.
+var DefaultShellDeny = []string{"sudo", "su", "passwd"}
+
+// ShellCommandsFor returns the shell command rule of workspace. An entry for
+// the workspace replaces "default".
+func (c Config) ShellCommandsFor(workspace string) ShellCommandRule {
+	rule, found := workspaceEntry(c.ShellCommands, workspace)
+	if !found {
+		rule, found = c.ShellCommands["default"]
+	}
+	if !found || rule.Deny == nil {
+		rule.Deny = DefaultShellDeny
+	}
+	return rule
+}
+
+// MCPServer is a Model Context Protocol server started (stdio) or reached
+// (SSE) for a workspace. Env and header values are expanded with environment
+// variables, like chat bridge tokens.
+type MCPServer struct {
+	Name           string            `yaml:"name"`                      // Prefix of the server's tool names
+	Command        string            `yaml:"command,omitempty"`         // stdio: program to run in the workspace root
+	Args           []string          `yaml:"args,omitempty"`            // stdio: program arguments
+	Env            map[string]string `yaml:"env,omitempty"`             // stdio: extra environment variables
+	URL            string            `yaml:"url,omitempty"`             // SSE: event stream endpoint
+	Headers        map[string]string `yaml:"headers,omitempty"`         // SSE: extra request headers
+	Workspaces     []string          `yaml:"workspaces,omitempty"`      // Workspace paths to connect in (empty = all)
+	TimeoutSeconds int               `yaml:"timeout_seconds,omitempty"` // Per tool call (0 = 60)
+	MaxResultKB    int               `yaml:"max_result_kb,omitempty"`   // Larger results are truncated (0 = 64)
+}
+
+// MCPServersFor returns the MCP servers configured for workspace.
+func (c Config) MCPServersFor(workspace string) []MCPServer {
+	var servers []MCPServer
+	for _, server := range c.MCPServers {
+		if len(server.Workspaces) == 0 {
+			servers = append(servers, server)
+			continue
+		}
+		for _, ws := range server.Workspaces {
+			if absPath(ws) == absPath(workspace) {
+				servers = append(servers, server)
+				break
+			}
+		}
+	}
+	return servers
 }
 
 // IsAnalyticsEnabled returns true if analytics is enabled (default: true)
@@ -129,8 +462,138 @@ func (c Config) IsAnalyticsEnabled() bool {
 	return *c.AnalyticsEnabled
 }
 
+// IsVisionAutoCaptionEnabled reports whether images created by tools are
+// described with the vision model automatically (default: true).
+func (c Config) IsVisionAutoCaptionEnabled() bool {
+	return c.VisionAutoCaption == nil || *c.VisionAutoCaption
+}
+
+// IsProjectProfileEnabled reports whether the detected project profile is
+// added to the system message (default: true).
+func (c Config) IsProjectProfileEnabled() bool {
+	return c.ProjectProfile == nil || *c.ProjectProfile
+}
+
+// IsRecentFilesHintEnabled reports whether the files a session recently read
+// or edited are listed in the system message (default: true).
+func (c Config) IsRecentFilesHintEnabled() bool {
+	return c.RecentFilesHint == nil || *c.RecentFilesHint
+}
+
+// IsSessionTitlesEnabled reports whether sessions get a title from the
+// summary model after their first reply (default: true).
+func (c Config) IsSessionTitlesEnabled() bool {
+	return c.SessionTitles == nil || *c.SessionTitles
+}
+
+// IsWarmupEnabled reports whether provider connections are opened, keys
+// checked and model lists prefetched at startup (default: true).
+func (c Config) IsWarmupEnabled() bool {
+	return c.Warmup == nil || *c.Warmup
+}
+
+// DefaultRepoMapTokens is the repository map budget when none is configured.
+const DefaultRepoMapTokens = 1024
+
+// RepoMapBudget returns the token budget of the repository map added to the
+// system message; 0 means the map is disabled.
+func (c Config) RepoMapBudget() int {
+	switch {
+	case c.RepoMapTokens < 0:
+		return 0
+	case c.RepoMapTokens == 0:
+		return DefaultRepoMapTokens
+	}
+	return c.RepoMapTokens
+}
+
+// DefaultParallelToolCalls is how many read-only tool calls run at once
+// when none is configured.
+const DefaultParallelToolCalls = 4
+
+// ToolCallWorkers returns how many read-only tool calls from one assistant
+// message may run concurrently; 1 means every call runs in turn.
+func (c Config) ToolCallWorkers() int {
+	switch {
+	case c.ParallelToolCalls < 0:
+		return 1
+	case c.ParallelToolCalls == 0:
+		return DefaultParallelToolCalls
+	}
+	return c.ParallelToolCalls
+}
+
+// DefaultSystemPromptPercent is the share of the model's context window that
+// project context added to the system message may use when no budget is set.
+const DefaultSystemPromptPercent = 15
+
+// SystemPromptBudget returns the token budget for project instructions,
+// facts and the other context added to the system message; 0 means no limit.
+func (c Config) SystemPromptBudget(provider, model string) int {
+	switch {
+	case c.SystemPromptTokens < 0:
+		return 0
+	case c.SystemPromptTokens == 0:
+		return GetModelContextLength(provider, model) * DefaultSystemPromptPercent / 100
+	}
+	return c.SystemPromptTokens
+}
+
+// LargeFileLimit returns the size in bytes above which edit tools require an
+// explicit confirm; 0 selects the tool default and negative disables the guard.
+func (c Config) LargeFileLimit() int64 {
+	if c.LargeFileLimitKB < 0 {
+		return -1
+	}
+	return int64(c.LargeFileLimitKB) * 1024
+}
+
+// IsSyncWritesEnabled reports whether session and plan files are flushed to
+// disk on every save (default: true).
+func (c Config) IsSyncWritesEnabled() bool {
+	return c.SyncWrites == nil || *c.SyncWrites
+}
+
+// Session size limits applied when none are configured.
+const (
+	DefaultMaxSessionMessages = 2000
+	DefaultMaxSessionMB       = 20
+)
+
+// SessionLimits returns the message count and byte size above which a
+// session's older history is archived to a linked part; 0 means unlimited.
+func (c Config) SessionLimits() (messages, bytes int) {
+	messages, mb := c.MaxSessionMessages, c.MaxSessionMB
+	if messages == 0 {
+		messages = DefaultMaxSessionMessages
+	}
+	if mb == 0 {
+		mb = DefaultMaxSessionMB
+	}
+	return max(messages, 0), max(mb, 0) << 20
+}
+
+// DefaultMaxWorkspaces is how many workspace contexts stay loaded when
+// max_workspaces is not set.
+const DefaultMaxWorkspaces = 8
+
+// WorkspaceLimit returns how many workspace contexts may stay loaded before
+// idle ones are evicted; 0 means no limit.
+func (c Config) WorkspaceLimit() int {
+	switch {
+	case c.MaxWorkspaces < 0:
+		return 0
+	case c.MaxWorkspaces == 0:
+		return DefaultMaxWorkspaces
+	}
+	return c.MaxWorkspaces
+}
+
 // EnsureDefaultConfig creates config.yaml with provider-appropriate defaults if it doesn't exist
 func EnsureDefaultConfig(provider string) error {
+	if currentStore() != nil {
+		return nil
+	}
 	configDir := GetConfigDir()
 	configPath := filepath.Join(configDir, "config.yaml")
 
@@ -219,6 +682,18 @@ func EnsureAllProviderDefaults(configPath string) error {
 		cfg.OpenRouterVisionURL = defaultCfg.OpenRouterVisionURL
 		changes = append(changes, fmt.Sprintf("openrouter_vision_url=%s", cfg.OpenRouterVisionURL))
 	}
+	if cfg.OpenAIBaseURL == "" {
+		cfg.OpenAIBaseURL = defaultCfg.OpenAIBaseURL
+		changes = append(changes, fmt.Sprintf("openai_base_url=%s", cfg.OpenAIBaseURL))
+	}
+	if cfg.AzureOpenAIAPIVersion == "" {
+		cfg.AzureOpenAIAPIVersion = defaultCfg.AzureOpenAIAPIVersion
+		changes = append(changes, fmt.Sprintf("azure_openai_api_version=%s", cfg.AzureOpenAIAPIVersion))
+	}
+	if cfg.OllamaURL == "" {
+		cfg.OllamaURL = defaultCfg.OllamaURL
+		changes = append(changes, fmt.Sprintf("ollama_url=%s", cfg.OllamaURL))
+	}
 
 	// Initialize maps if nil
 	if cfg.ProviderModels == nil {
@@ -276,14 +751,23 @@ func EnsureAllProviderDefaults(configPath string) error {
 	return nil
 }
 
+// UserConfigPath returns the user config file: CANDO_CONFIG_PATH when set,
+// otherwise config.yaml in the config directory.
+func UserConfigPath() string {
+	if path := os.Getenv("CANDO_CONFIG_PATH"); path != "" {
+		return path
+	}
+	return filepath.Join(GetConfigDir(), "config.yaml")
+}
+
 // LoadUserConfig loads configuration from ~/.cando/config.yaml
 // Checks CANDO_CONFIG_PATH environment variable first.
 // If the file doesn't exist, returns defaults
 func LoadUserConfig() (Config, error) {
-	configPath := os.Getenv("CANDO_CONFIG_PATH")
-	if configPath == "" {
-		configPath = filepath.Join(GetConfigDir(), "config.yaml")
+	if store := currentStore(); store != nil {
+		return store.Load()
 	}
+	configPath := UserConfigPath()
 
 	// Run migrations first (if config exists)
 	if _, err := os.Stat(configPath); err == nil {
@@ -403,6 +887,23 @@ func (c Config) validate() error {
 	if c.ShellTimeoutSeconds > 600 {
 		return fmt.Errorf("shell_timeout_seconds cannot exceed 600 (10 minutes)")
 	}
+	if c.TurnTimeLimitSeconds < 0 || c.TurnGraceSeconds < 0 {
+		return fmt.Errorf("turn_time_limit_seconds and turn_grace_seconds must be >= 0")
+	}
+	if err := c.SessionBudget.Validate(); err != nil {
+		return fmt.Errorf("session_budget: %w", err)
+	}
+	for key, policy := range c.RetryPolicies {
+		if policy.MaxAttempts < 0 || policy.MaxAttempts > 20 {
+			return fmt.Errorf("retry_policies.%s.max_attempts must be between 1 and 20", key)
+		}
+		if policy.BaseDelayMs < 0 || policy.MaxDelayMs < 0 {
+			return fmt.Errorf("retry_policies.%s delays must be >= 0", key)
+		}
+		if policy.Jitter < 0 || policy.Jitter > 1 {
+			return fmt.Errorf("retry_policies.%s.jitter must be between 0 and 1", key)
+		}
+	}
 	if strings.TrimSpace(c.MemoryStorePath) == "" {
 		return fmt.Errorf("memory_store_path must be set")
 	}
@@ -412,6 +913,105 @@ func (c Config) validate() error {
 	if strings.TrimSpace(c.SummaryModel) == "" {
 		return fmt.Errorf("summary_model must be set")
 	}
+	for i, bridge := range c.ChatBridges {
+		switch bridge.Platform {
+		case "slack":
+			if strings.TrimSpace(bridge.AppToken) == "" {
+				return fmt.Errorf("chat_bridges[%d]: slack requires app_token", i)
+			}
+		case "discord":
+		default:
+			return fmt.Errorf("chat_bridges[%d]: platform must be slack or discord", i)
+		}
+		if strings.TrimSpace(bridge.BotToken) == "" {
+			return fmt.Errorf("chat_bridges[%d]: bot_token must be set", i)
+		}
+		if strings.TrimSpace(bridge.Workspace) == "" {
+			return fmt.Errorf("chat_bridges[%d]: workspace must be set", i)
+		}
+		// Anyone who can message the bot can run tools in the workspace
+		if strings.TrimSpace(bridge.Channel) == "" && len(bridge.AllowedUsers) == 0 {
+			return fmt.Errorf("chat_bridges[%d]: set channel or allowed_users to limit who can send prompts", i)
+		}
+	}
+	for key, set := range c.ToolPermissions {
+		for tool, permission := range set {
+			if permission != "allow" && permission != "ask" && permission != "deny" {
+				return fmt.Errorf("tool_permissions.%s.%s must be allow, ask or deny", key, tool)
+			}
+		}
+	}
+	for key, sandbox := range c.ShellSandbox {
+		switch sandbox.Backend {
+		case "", "direct", "bubblewrap", "firejail":
+		case "docker":
+			if strings.TrimSpace(sandbox.Image) == "" {
+				return fmt.Errorf("shell_sandbox.%s: docker requires image", key)
+			}
+		default:
+			return fmt.Errorf("shell_sandbox.%s.backend must be direct, docker, bubblewrap or firejail", key)
+		}
+	}
+	for key, rule := range c.ShellCommands {
+		for _, pattern := range append(slices.Clone(rule.Allow), rule.Deny...) {
+			words := strings.Fields(pattern)
+			if len(words) == 0 {
+				return fmt.Errorf("shell_commands.%s: empty pattern", key)
+			}
+			for _, word := range words {
+				if _, err := path.Match(word, ""); err != nil {
+					return fmt.Errorf("shell_commands.%s: invalid pattern %q: %w", key, pattern, err)
+				}
+			}
+		}
+	}
+	if (c.GitAuthor.Name == "") != (c.GitAuthor.Email == "") || (c.GitAuthor.Email != "" && !strings.Contains(c.GitAuthor.Email, "@")) {
+		return fmt.Errorf("git_author needs both a name and an email address")
+	}
+	seenMCP := make(map[string]bool, len(c.MCPServers))
+	for i, server := range c.MCPServers {
+		if !mcpNamePattern.MatchString(server.Name) {
+			return fmt.Errorf("mcp_servers[%d]: name must be 1-32 letters, digits, - or _", i)
+		}
+		if seenMCP[server.Name] {
+			return fmt.Errorf("mcp_servers[%d]: duplicate name %q", i, server.Name)
+		}
+		seenMCP[server.Name] = true
+		if (strings.TrimSpace(server.Command) == "") == (strings.TrimSpace(server.URL) == "") {
+			return fmt.Errorf("mcp_servers.%s: set exactly one of command (stdio) or url (SSE)", server.Name)
+		}
+		if server.TimeoutSeconds < 0 || server.TimeoutSeconds > 600 || server.MaxResultKB < 0 {
+			return fmt.Errorf("mcp_servers.%s: timeout_seconds must be 0-600 and max_result_kb >= 0", server.Name)
+		}
+	}
+	for _, pattern := range c.ContentPolicy.BlockPatterns {
+		if _, err := regexp.Compile(pattern); err != nil {
+			return fmt.Errorf("content_policy.block_patterns: invalid pattern %q: %w", pattern, err)
+		}
+	}
+	if c.Digest.Enabled {
+		if c.Digest.Hour < 0 || c.Digest.Hour > 23 {
+			return fmt.Errorf("digest.hour must be between 0 and 23")
+		}
+		if strings.TrimSpace(c.Digest.SMTPHost) == "" || strings.TrimSpace(c.Digest.From) == "" || len(c.Digest.To) == 0 {
+			return fmt.Errorf("digest requires smtp_host, from and to")
+		}
+	}
+	if (c.Web.TLS.CertFile == "") != (c.Web.TLS.KeyFile == "") {
+		return fmt.Errorf("web.tls: cert_file and key_file must be set together")
+	}
+	if c.Web.RateLimit < -1 || c.Web.MaxBodyMB < -1 {
+		return fmt.Errorf("web.rate_limit and web.max_body_mb must be >= -1")
+	}
+	if c.Web.MaxUploadMB < 0 {
+		return fmt.Errorf("web.max_upload_mb must be >= 0")
+	}
+	for _, origin := range c.Web.CORSOrigins {
+		u, err := url.Parse(origin)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || strings.TrimRight(u.Path, "/") != "" {
+			return fmt.Errorf("web.cors_origins: %q must look like https://host[:port]", origin)
+		}
+	}
 	return nil
 }
 
@@ -420,6 +1020,20 @@ func (c Config) RequestTimeout() time.Duration {
 	return time.Duration(c.RequestTimeoutSeconds) * time.Second
 }
 
+// TurnTimeLimit returns the per-turn wall-clock budget; zero disables it.
+func (c Config) TurnTimeLimit() time.Duration {
+	return time.Duration(c.TurnTimeLimitSeconds) * time.Second
+}
+
+// TurnGrace returns how long a turn may keep wrapping up after its budget,
+// defaulting to two minutes.
+func (c Config) TurnGrace() time.Duration {
+	if c.TurnGraceSeconds == 0 {
+		return 2 * time.Minute
+	}
+	return time.Duration(c.TurnGraceSeconds) * time.Second
+}
+
 // ShellTimeout exposes the configured duration for sandboxed shell commands.
 func (c Config) ShellTimeout() time.Duration {
 	return time.Duration(c.ShellTimeoutSeconds) * time.Second
@@ -467,6 +1081,21 @@ func (c *Config) rebasePath(target *string, oldRoot, newRoot string) {
 	*target = filepath.Join(newAbs, pathVal)
 }
 
+// workspaceEntry returns the entry of a map keyed by "default" or workspace
+// path, such as ToolPermissions, that names workspace itself. Keys match
+// after conversion to absolute paths.
+func workspaceEntry[T any](entries map[string]T, workspace string) (T, bool) {
+	if workspace != "" {
+		for key, entry := range entries {
+			if key != "default" && absPath(key) == absPath(workspace) {
+				return entry, true
+			}
+		}
+	}
+	var zero T
+	return zero, false
+}
+
 func absPath(path string) string {
 	path = strings.TrimSpace(path)
 	if path == "" {
@@ -479,10 +1108,22 @@ func absPath(path string) string {
 	return abs
 }
 
+// GetConfigDir returns the directory holding config, credentials and project
+// data: CANDO_CONFIG_DIR when set, else the active profile's directory, else
+// the base config directory.
 func GetConfigDir() string {
 	if configDir := os.Getenv("CANDO_CONFIG_DIR"); configDir != "" {
 		return configDir
 	}
+	if profile := ActiveProfile(); profile != "" {
+		return filepath.Join(BaseConfigDir(), "profiles", profile)
+	}
+	return BaseConfigDir()
+}
+
+// BaseConfigDir returns the top-level config directory, ~/.cando (or
+// ~/.cando-beta), regardless of the active profile.
+func BaseConfigDir() string {
 	home, err := os.UserHomeDir()
 	if err != nil {
 		return ".cando"
@@ -497,6 +1138,46 @@ func GetConfigDir() string {
 	return filepath.Join(home, ".cando")
 }
 
+// ProfileEnv selects a named config profile. Each profile keeps its own
+// config, credentials and project data under <config dir>/profiles/<name>.
+const ProfileEnv = "CANDO_PROFILE"
+
+var profileNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]*$`)
+
+// mcpNamePattern keeps MCP tool names (mcp_<server>_<tool>) valid for every
+// provider.
+var mcpNamePattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,32}$`)
+
+// ValidProfileName reports whether name can be used as a profile directory.
+func ValidProfileName(name string) bool {
+	return len(name) <= 64 && profileNamePattern.MatchString(name)
+}
+
+// ActiveProfile returns the profile selected through CANDO_PROFILE, or ""
+// for the default config. Invalid names are ignored.
+func ActiveProfile() string {
+	name := strings.TrimSpace(os.Getenv(ProfileEnv))
+	if !ValidProfileName(name) {
+		return ""
+	}
+	return name
+}
+
+// ListProfiles returns the names of the existing profiles.
+func ListProfiles() []string {
+	entries, err := os.ReadDir(filepath.Join(BaseConfigDir(), "profiles"))
+	if err != nil {
+		return nil
+	}
+	var names []string
+	for _, entry := range entries {
+		if entry.IsDir() && ValidProfileName(entry.Name()) {
+			names = append(names, entry.Name())
+		}
+	}
+	return names
+}
+
 // ModelFor returns the configured model for the given provider key, falling back to provider-appropriate defaults.
 func (c Config) ModelFor(provider string) string {
 	provider = strings.ToLower(provider)
@@ -548,38 +1229,34 @@ func (c Config) VLModelFor(provider string) string {
 	return ProviderDefaults["openrouter"].VL
 }
 
-// CalculateMessageThreshold returns the absolute character threshold for message compaction
-// based on the configured percentage and model context length.
-// Uses 3:1 character-to-token ratio (conservative estimate).
+// CalculateMessageThreshold returns the token count above which a single
+// message is compacted: the configured percentage of the model's context
+// length.
 func (c Config) CalculateMessageThreshold(provider, model string) int {
-	tokens := GetModelContextLength(provider, model)
-	chars := tokens * 3
-	threshold := int(float64(chars) * c.ContextMessagePercent)
+	threshold := int(float64(GetModelContextLength(provider, model)) * c.ContextMessagePercent)
 	if threshold <= 0 {
-		threshold = 1000 // Minimum fallback
+		threshold = 300 // Minimum fallback
 	}
 	return threshold
 }
 
-// CalculateConversationThreshold returns the absolute character threshold for conversation compaction
-// based on the configured percentage and model context length.
-// Uses 3:1 character-to-token ratio (conservative estimate).
+// CalculateConversationThreshold returns the token count above which the
+// conversation is compacted: the configured percentage of the model's
+// context length.
 func (c Config) CalculateConversationThreshold(provider, model string) int {
-	tokens := GetModelContextLength(provider, model)
-	chars := tokens * 3
-	threshold := int(float64(chars) * c.ContextTotalPercent)
+	threshold := int(float64(GetModelContextLength(provider, model)) * c.ContextTotalPercent)
 	if threshold <= 0 {
-		threshold = 10000 // Minimum fallback
+		threshold = 3000 // Minimum fallback
 	}
 	return threshold
 }
 
 // Save writes the config to the user's config file
 func Save(c Config) error {
-	configPath := os.Getenv("CANDO_CONFIG_PATH")
-	if configPath == "" {
-		configPath = filepath.Join(GetConfigDir(), "config.yaml")
+	if store := currentStore(); store != nil {
+		return store.Save(c)
 	}
+	configPath := UserConfigPath()
 
 	// Clear runtime-calculated paths before saving
 	// These are set dynamically based on workspace and shouldn't be persisted
@@ -66,6 +66,54 @@ func TestConfigValidation(t *testing.T) {
 			expectError: true,
 			errorString: "shell_timeout_seconds cannot exceed",
 		},
+		{
+			name: "mcp server with command and url fails",
+			modifyFunc: func(c *Config) {
+				c.MCPServers = []MCPServer{{Name: "docs", Command: "docs-mcp", URL: "http://localhost:8080/sse"}}
+			},
+			expectError: true,
+			errorString: "exactly one of command",
+		},
+		{
+			name: "mcp server name with spaces fails",
+			modifyFunc: func(c *Config) {
+				c.MCPServers = []MCPServer{{Name: "my docs", Command: "docs-mcp"}}
+			},
+			expectError: true,
+			errorString: "mcp_servers[0]: name",
+		},
+		{
+			name: "unknown tool permission fails",
+			modifyFunc: func(c *Config) {
+				c.ToolPermissions = ToolPermissions{"default": {"shell": "prompt"}}
+			},
+			expectError: true,
+			errorString: "tool_permissions.default.shell",
+		},
+		{
+			name: "docker sandbox without image fails",
+			modifyFunc: func(c *Config) {
+				c.ShellSandbox = ShellSandboxes{"default": {Backend: "docker"}}
+			},
+			expectError: true,
+			errorString: "shell_sandbox.default: docker requires image",
+		},
+		{
+			name: "invalid shell command pattern fails",
+			modifyFunc: func(c *Config) {
+				c.ShellCommands = ShellCommandRules{"default": {Deny: []string{"rm [-rf"}}}
+			},
+			expectError: true,
+			errorString: `shell_commands.default: invalid pattern "rm [-rf"`,
+		},
+		{
+			name: "git author without email fails",
+			modifyFunc: func(c *Config) {
+				c.GitAuthor = GitAuthor{Name: "Cando Bot"}
+			},
+			expectError: true,
+			errorString: "git_author needs both",
+		},
 	}
 
 	for _, tt := range tests {
@@ -295,6 +343,59 @@ func TestModelForProviderFallbacks(t *testing.T) {
 	}
 }
 
+func TestToolPermissionFor(t *testing.T) {
+	cfg := Config{ToolPermissions: ToolPermissions{
+		"default":   {"shell": "ask", "*": "allow"},
+		"/work/api": {"write_file": "deny", "*": "ask"},
+	}}
+	tests := []struct {
+		workspace, tool, want string
+	}{
+		{"/work/web", "shell", "ask"},
+		{"/work/web", "read_file", "allow"},
+		{"/work/api", "write_file", "deny"},
+		{"/work/api/", "read_file", "ask"},
+		{"", "shell", "ask"},
+	}
+	for _, tt := range tests {
+		if got := cfg.ToolPermissionFor(tt.workspace, tt.tool); got != tt.want {
+			t.Errorf("ToolPermissionFor(%q, %q) = %q, want %q", tt.workspace, tt.tool, got, tt.want)
+		}
+	}
+	if got := (Config{}).ToolPermissionFor("/work", "shell"); got != "allow" {
+		t.Errorf("unconfigured permission = %q, want allow", got)
+	}
+}
+
+func TestShellSandboxFor(t *testing.T) {
+	cfg := Config{ShellSandbox: ShellSandboxes{
+		"default":   {Backend: "bubblewrap"},
+		"/work/api": {Backend: "docker", Image: "node:20"},
+	}}
+	if got := cfg.ShellSandboxFor("/work/api/"); got.Backend != "docker" || got.Image != "node:20" {
+		t.Errorf("workspace sandbox = %+v, want docker node:20", got)
+	}
+	if got := cfg.ShellSandboxFor("/work/web"); got.Backend != "bubblewrap" {
+		t.Errorf("default sandbox = %+v, want bubblewrap", got)
+	}
+	if got := (Config{}).ShellSandboxFor("/work"); got.Backend != "" {
+		t.Errorf("unconfigured sandbox = %+v, want direct", got)
+	}
+}
+
+func TestShellCommandsFor(t *testing.T) {
+	cfg := Config{ShellCommands: ShellCommandRules{
+		"default":   {Allow: []string{"go", "git"}},
+		"/work/api": {Deny: []string{}},
+	}}
+	if got := cfg.ShellCommandsFor("/work/web"); len(got.Allow) != 2 || len(got.Deny) != len(DefaultShellDeny) {
+		t.Errorf("default rule = %+v, want its allow list and the default deny list", got)
+	}
+	if got := cfg.ShellCommandsFor("/work/api"); len(got.Allow) != 0 || len(got.Deny) != 0 {
+		t.Errorf("workspace rule = %+v, want nothing denied", got)
+	}
+}
+
 func TestSummaryModelForProviderFallbacks(t *testing.T) {
 	tests := []struct {
 		name                 string
@@ -445,3 +546,31 @@ func TestVLModelForProviderFallbacks(t *testing.T) {
 		})
 	}
 }
+
+func TestConfigDirProfiles(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("CANDO_CONFIG_DIR", "")
+	base := BaseConfigDir()
+
+	t.Setenv(ProfileEnv, "work")
+	if got, want := GetConfigDir(), filepath.Join(base, "profiles", "work"); got != want {
+		t.Errorf("GetConfigDir() = %q, want %q", got, want)
+	}
+	t.Setenv(ProfileEnv, "../escape")
+	if got := GetConfigDir(); got != base {
+		t.Errorf("invalid profile name should fall back to %q, got %q", base, got)
+	}
+	t.Setenv("CANDO_CONFIG_DIR", "/explicit")
+	t.Setenv(ProfileEnv, "work")
+	if got := GetConfigDir(); got != "/explicit" {
+		t.Errorf("CANDO_CONFIG_DIR should take precedence, got %q", got)
+	}
+
+	if err := os.MkdirAll(filepath.Join(base, "profiles", "personal"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if got := ListProfiles(); len(got) != 1 || got[0] != "personal" {
+		t.Errorf("ListProfiles() = %v, want [personal]", got)
+	}
+}
@@ -27,8 +27,9 @@ func loadModelContexts() {
 }
 
 // GetModelContextLength returns the maximum context length for a given provider and model.
+// A context_length in the user's models.yaml takes precedence over the built-in table.
 // Returns 65536 as a safe default if the model is not found.
-// Provider examples: "openrouter", "zai"
+// Provider examples: "openrouter", "zai", "openai"
 // Model examples: "anthropic/claude-3.5-sonnet", "glm-4.6"
 func GetModelContextLength(provider, model string) int {
 	loadModelContexts()
@@ -40,9 +41,21 @@ func GetModelContextLength(provider, model string) int {
 	// Build lookup key: "provider/model"
 	key := provider + "/" + model
 
+	if entries, err := LoadModelMetadata(); err != nil {
+		logModelMetadataError(err)
+	} else if meta := entries[key]; meta.ContextLength > 0 {
+		return meta.ContextLength
+	}
+
 	if contextLength, ok := modelContexts[key]; ok && contextLength > 0 {
 		return contextLength
 	}
+	// OpenAI and Azure serve the models OpenRouter lists under openai/
+	if provider == "openai" || provider == "azure" {
+		if contextLength, ok := modelContexts["openrouter/openai/"+model]; ok && contextLength > 0 {
+			return contextLength
+		}
+	}
 
 	// Return safe default for unknown models
 	return 65536
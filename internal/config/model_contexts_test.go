@@ -57,3 +57,36 @@ func TestGetAllModelContexts(t *testing.T) {
 		t.Error("Expected at least one openrouter model in contexts")
 	}
 }
+
+func TestUserModelMetadataOverrides(t *testing.T) {
+	t.Setenv("CANDO_CONFIG_DIR", t.TempDir())
+	yes := true
+	entries := map[string]ModelMetadata{
+		"zai/glm-5":   {ContextLength: 300000, SupportsVision: &yes},
+		"zai/glm-4.6": {Pricing: &ModelPricing{PromptPerMillion: 0.6, CompletionPerMillion: 2.2}},
+	}
+	if err := SaveModelMetadata(entries); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := GetModelContextLength("zai", "GLM-5"); got != 300000 {
+		t.Errorf("custom model context = %d, want 300000", got)
+	}
+	meta, ok := LookupModelMetadata("zai", "glm-4.6")
+	if !ok || meta.ContextLength != 200000 || meta.Pricing == nil || meta.Pricing.PromptPerMillion != 0.6 {
+		t.Errorf("merged glm-4.6 metadata = %+v (found %v), want built-in context with user pricing", meta, ok)
+	}
+	if _, ok := LookupModelMetadata("zai", "unknown"); ok {
+		t.Error("unknown model reported as known")
+	}
+
+	if err := SaveModelMetadata(map[string]ModelMetadata{"zai/glm-5": {ContextLength: -1}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadModelMetadata(); err == nil {
+		t.Error("expected invalid entry to be rejected")
+	}
+	if got := GetModelContextLength("zai", "glm-5"); got != 65536 {
+		t.Errorf("invalid file should fall back to defaults, got %d", got)
+	}
+}
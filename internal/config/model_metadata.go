@@ -0,0 +1,162 @@
+package config
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ModelMetadata describes a model beyond what providers report. Entries in
+// the user's models.yaml are merged over the built-in context lengths, so
+// custom and newly released models get correct compaction thresholds.
+// Unset capability flags mean "unknown", which behaves like supported.
+type ModelMetadata struct {
+	ContextLength    int           `yaml:"context_length,omitempty" json:"context_length,omitempty"`
+	SupportsTools    *bool         `yaml:"supports_tools,omitempty" json:"supports_tools,omitempty"`
+	SupportsVision   *bool         `yaml:"supports_vision,omitempty" json:"supports_vision,omitempty"`
+	SupportsThinking *bool         `yaml:"supports_thinking,omitempty" json:"supports_thinking,omitempty"`
+	Pricing          *ModelPricing `yaml:"pricing,omitempty" json:"pricing,omitempty"`
+}
+
+// ModelPricing is a model's price in USD per million tokens.
+type ModelPricing struct {
+	PromptPerMillion     float64 `yaml:"prompt_per_million" json:"prompt_per_million"`
+	CompletionPerMillion float64 `yaml:"completion_per_million" json:"completion_per_million"`
+}
+
+// Validate checks a metadata entry before it is stored.
+func (m ModelMetadata) Validate() error {
+	if m.ContextLength < 0 {
+		return fmt.Errorf("context_length must be >= 0")
+	}
+	if p := m.Pricing; p != nil && (p.PromptPerMillion < 0 || p.CompletionPerMillion < 0) {
+		return fmt.Errorf("pricing must be >= 0")
+	}
+	return nil
+}
+
+// ModelMetadataKey returns the lookup key for a model: "provider/model",
+// lowercased like the built-in context lengths.
+func ModelMetadataKey(provider, model string) string {
+	return strings.ToLower(strings.TrimSpace(provider)) + "/" + strings.ToLower(strings.TrimSpace(model))
+}
+
+// ModelMetadataPath returns the user's model metadata file.
+func ModelMetadataPath() string {
+	return filepath.Join(GetConfigDir(), "models.yaml")
+}
+
+// userModelMetadata caches models.yaml, reloading it when the file changes.
+var userModelMetadata struct {
+	mu      sync.Mutex
+	path    string
+	modTime time.Time
+	entries map[string]ModelMetadata
+}
+
+// LoadModelMetadata returns the user's model metadata entries. A missing
+// file yields an empty map.
+func LoadModelMetadata() (map[string]ModelMetadata, error) {
+	path := ModelMetadataPath()
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return map[string]ModelMetadata{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	userModelMetadata.mu.Lock()
+	defer userModelMetadata.mu.Unlock()
+	if userModelMetadata.entries != nil && userModelMetadata.path == path && userModelMetadata.modTime.Equal(info.ModTime()) {
+		return copyModelMetadata(userModelMetadata.entries), nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	raw := map[string]ModelMetadata{}
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	entries := make(map[string]ModelMetadata, len(raw))
+	for key, meta := range raw {
+		if err := meta.Validate(); err != nil {
+			return nil, fmt.Errorf("%s: %s: %w", path, key, err)
+		}
+		entries[strings.ToLower(strings.TrimSpace(key))] = meta
+	}
+	userModelMetadata.path = path
+	userModelMetadata.modTime = info.ModTime()
+	userModelMetadata.entries = entries
+	return copyModelMetadata(entries), nil
+}
+
+// SaveModelMetadata writes the user's model metadata entries.
+func SaveModelMetadata(entries map[string]ModelMetadata) error {
+	path := ModelMetadataPath()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("create config dir: %w", err)
+	}
+	data, err := yaml.Marshal(entries)
+	if err != nil {
+		return fmt.Errorf("marshal model metadata: %w", err)
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("write model metadata: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("write model metadata: %w", err)
+	}
+	userModelMetadata.mu.Lock()
+	userModelMetadata.entries = nil
+	userModelMetadata.mu.Unlock()
+	return nil
+}
+
+// LookupModelMetadata returns the merged metadata for a model: the user's
+// entry, with the built-in context length filling in when it has none.
+func LookupModelMetadata(provider, model string) (ModelMetadata, bool) {
+	key := ModelMetadataKey(provider, model)
+	entries, err := LoadModelMetadata()
+	if err != nil {
+		logModelMetadataError(err)
+	}
+	meta, found := entries[key]
+	if meta.ContextLength == 0 {
+		loadModelContexts()
+		if length, ok := modelContexts[key]; ok && length > 0 {
+			meta.ContextLength = length
+			found = true
+		}
+	}
+	return meta, found
+}
+
+// logModelMetadataError reports a broken models.yaml once per change so
+// lookups on every message do not flood the log.
+var lastModelMetadataError string
+
+func logModelMetadataError(err error) {
+	userModelMetadata.mu.Lock()
+	defer userModelMetadata.mu.Unlock()
+	if msg := err.Error(); msg != lastModelMetadataError {
+		lastModelMetadataError = msg
+		log.Printf("Warning: model metadata ignored: %v", err)
+	}
+}
+
+func copyModelMetadata(entries map[string]ModelMetadata) map[string]ModelMetadata {
+	out := make(map[string]ModelMetadata, len(entries))
+	for k, v := range entries {
+		out[k] = v
+	}
+	return out
+}
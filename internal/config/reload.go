@@ -0,0 +1,152 @@
+package config
+
+import (
+	"maps"
+	"reflect"
+	"slices"
+)
+
+// ApplyReloadable copies the fields of next that can change while running
+// (thresholds, prompts, model maps, policies) into c. It returns the YAML
+// names of the fields it changed and of changed fields that need a restart.
+func (c *Config) ApplyReloadable(next Config) (changed, restart []string) {
+	apply := func(name string, dst, src any) {
+		d := reflect.ValueOf(dst).Elem()
+		if !reflect.DeepEqual(d.Interface(), src) {
+			d.Set(reflect.ValueOf(src))
+			changed = append(changed, name)
+		}
+	}
+	needsRestart := func(name string, current, proposed any) {
+		if !reflect.DeepEqual(current, proposed) {
+			restart = append(restart, name)
+		}
+	}
+
+	apply("model", &c.Model, next.Model)
+	apply("summary_model", &c.SummaryModel, next.SummaryModel)
+	apply("vl_model", &c.VLModel, next.VLModel)
+	apply("provider_models", &c.ProviderModels, next.ProviderModels)
+	apply("provider_summary_models", &c.ProviderSummaryModels, next.ProviderSummaryModels)
+	apply("provider_vl_models", &c.ProviderVLModels, next.ProviderVLModels)
+	apply("temperature", &c.Temperature, next.Temperature)
+	apply("system_prompt", &c.SystemPrompt, next.SystemPrompt)
+	apply("compaction_summary_prompt", &c.CompactionPrompt, next.CompactionPrompt)
+	apply("request_timeout_seconds", &c.RequestTimeoutSeconds, next.RequestTimeoutSeconds)
+	apply("shell_timeout_seconds", &c.ShellTimeoutSeconds, next.ShellTimeoutSeconds)
+	apply("context_message_percent", &c.ContextMessagePercent, next.ContextMessagePercent)
+	apply("context_conversation_percent", &c.ContextTotalPercent, next.ContextTotalPercent)
+	apply("context_protect_recent", &c.ContextProtectRecent, next.ContextProtectRecent)
+	apply("thinking_enabled", &c.ThinkingEnabled, next.ThinkingEnabled)
+	apply("force_thinking", &c.ForceThinking, next.ForceThinking)
+	apply("openrouter_free_mode", &c.OpenRouterFreeMode, next.OpenRouterFreeMode)
+	apply("terminal_record_commands", &c.TerminalRecordCommands, next.TerminalRecordCommands)
+	apply("shell_interactive", &c.ShellInteractive, next.ShellInteractive)
+	apply("content_policy", &c.ContentPolicy, next.ContentPolicy)
+	apply("turn_time_limit_seconds", &c.TurnTimeLimitSeconds, next.TurnTimeLimitSeconds)
+	apply("turn_grace_seconds", &c.TurnGraceSeconds, next.TurnGraceSeconds)
+	apply("retry_policies", &c.RetryPolicies, next.RetryPolicies)
+	apply("tool_permissions", &c.ToolPermissions, next.ToolPermissions)
+	apply("shell_sandbox", &c.ShellSandbox, next.ShellSandbox)
+	apply("shell_commands", &c.ShellCommands, next.ShellCommands)
+	apply("vision_auto_caption", &c.VisionAutoCaption, next.VisionAutoCaption)
+	apply("project_profile", &c.ProjectProfile, next.ProjectProfile)
+	apply("repo_map_tokens", &c.RepoMapTokens, next.RepoMapTokens)
+	apply("system_prompt_tokens", &c.SystemPromptTokens, next.SystemPromptTokens)
+	apply("recent_files_hint", &c.RecentFilesHint, next.RecentFilesHint)
+	apply("max_session_messages", &c.MaxSessionMessages, next.MaxSessionMessages)
+	apply("max_session_mb", &c.MaxSessionMB, next.MaxSessionMB)
+	apply("session_titles", &c.SessionTitles, next.SessionTitles)
+	apply("session_budget", &c.SessionBudget, next.SessionBudget)
+	apply("max_workspaces", &c.MaxWorkspaces, next.MaxWorkspaces)
+	apply("warmup", &c.Warmup, next.Warmup)
+	apply("bug_hunt", &c.BugHunt, next.BugHunt)
+	apply("parallel_tool_calls", &c.ParallelToolCalls, next.ParallelToolCalls)
+	apply("web.allowed_hosts", &c.Web.AllowedHosts, next.Web.AllowedHosts)
+	apply("web.cors_origins", &c.Web.CORSOrigins, next.Web.CORSOrigins)
+	apply("web.rate_limit", &c.Web.RateLimit, next.Web.RateLimit)
+	apply("web.max_body_mb", &c.Web.MaxBodyMB, next.Web.MaxBodyMB)
+	apply("web.max_upload_mb", &c.Web.MaxUploadMB, next.Web.MaxUploadMB)
+
+	needsRestart("provider", c.Provider, next.Provider)
+	needsRestart("context_profile", c.ContextProfile, next.ContextProfile)
+	needsRestart("chat_bridges", c.ChatBridges, next.ChatBridges)
+	needsRestart("digest", c.Digest, next.Digest)
+	needsRestart("web.tls", c.Web.TLS, next.Web.TLS)
+	needsRestart("web.socket", c.Web.Socket, next.Web.Socket)
+	needsRestart("web.auth_token", c.Web.AuthToken, next.Web.AuthToken)
+	needsRestart("large_file_limit_kb", c.LargeFileLimitKB, next.LargeFileLimitKB)
+	needsRestart("allow_external_symlinks", c.AllowExternalSymlinks, next.AllowExternalSymlinks)
+	needsRestart("sync_writes", c.SyncWrites, next.SyncWrites)
+	needsRestart("mcp_servers", c.MCPServers, next.MCPServers)
+	needsRestart("git_author", c.GitAuthor, next.GitAuthor)
+	return changed, restart
+}
+
+// Clone returns a deep copy of c, so the copy can be modified while other
+// goroutines keep reading c.
+func (c Config) Clone() Config {
+	out := c
+	out.ProviderModels = maps.Clone(c.ProviderModels)
+	out.ProviderSummaryModels = maps.Clone(c.ProviderSummaryModels)
+	out.ProviderVLModels = maps.Clone(c.ProviderVLModels)
+	out.AnalyticsEnabled = cloneBool(c.AnalyticsEnabled)
+	out.VisionAutoCaption = cloneBool(c.VisionAutoCaption)
+	out.ProjectProfile = cloneBool(c.ProjectProfile)
+	out.RecentFilesHint = cloneBool(c.RecentFilesHint)
+	out.SyncWrites = cloneBool(c.SyncWrites)
+	out.SessionTitles = cloneBool(c.SessionTitles)
+	out.Warmup = cloneBool(c.Warmup)
+	out.ChatBridges = slices.Clone(c.ChatBridges)
+	out.MCPServers = slices.Clone(c.MCPServers)
+	for i, server := range out.MCPServers {
+		server.Args = slices.Clone(server.Args)
+		server.Env = maps.Clone(server.Env)
+		server.Headers = maps.Clone(server.Headers)
+		server.Workspaces = slices.Clone(server.Workspaces)
+		out.MCPServers[i] = server
+	}
+	out.Digest.To = slices.Clone(c.Digest.To)
+	out.ContentPolicy.BlockPatterns = slices.Clone(c.ContentPolicy.BlockPatterns)
+	out.ContentPolicy.BlockKeywords = slices.Clone(c.ContentPolicy.BlockKeywords)
+	out.Web.AllowedHosts = slices.Clone(c.Web.AllowedHosts)
+	out.Web.CORSOrigins = slices.Clone(c.Web.CORSOrigins)
+	if c.ToolPermissions != nil {
+		out.ToolPermissions = make(ToolPermissions, len(c.ToolPermissions))
+		for key, set := range c.ToolPermissions {
+			out.ToolPermissions[key] = maps.Clone(set)
+		}
+	}
+	if c.ShellSandbox != nil {
+		out.ShellSandbox = make(ShellSandboxes, len(c.ShellSandbox))
+		for key, sandbox := range c.ShellSandbox {
+			sandbox.Env = maps.Clone(sandbox.Env)
+			sandbox.Args = slices.Clone(sandbox.Args)
+			out.ShellSandbox[key] = sandbox
+		}
+	}
+	if c.ShellCommands != nil {
+		out.ShellCommands = make(ShellCommandRules, len(c.ShellCommands))
+		for key, rule := range c.ShellCommands {
+			rule.Allow = slices.Clone(rule.Allow)
+			rule.Deny = slices.Clone(rule.Deny)
+			out.ShellCommands[key] = rule
+		}
+	}
+	if c.RetryPolicies != nil {
+		out.RetryPolicies = make(RetryPolicies, len(c.RetryPolicies))
+		for key, policy := range c.RetryPolicies {
+			policy.RetryOn = slices.Clone(policy.RetryOn)
+			out.RetryPolicies[key] = policy
+		}
+	}
+	return out
+}
+
+func cloneBool(b *bool) *bool {
+	if b == nil {
+		return nil
+	}
+	v := *b
+	return &v
+}
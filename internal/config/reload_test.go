@@ -0,0 +1,58 @@
+package config
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestApplyReloadable(t *testing.T) {
+	cur := DefaultConfig()
+	cur.ConversationDir = "/runtime/conversations"
+	next := cur
+	next.ProviderModels = map[string]string{"zai": "glm-4.6"}
+	next.ContextTotalPercent = cur.ContextTotalPercent / 2
+	next.SystemPrompt = "be brief"
+	next.Provider = "other"
+	next.ConversationDir = "/elsewhere"
+
+	changed, restart := cur.ApplyReloadable(next)
+	for _, field := range []string{"provider_models", "context_conversation_percent", "system_prompt"} {
+		if !slices.Contains(changed, field) {
+			t.Errorf("changed = %v, missing %s", changed, field)
+		}
+	}
+	if !slices.Equal(restart, []string{"provider"}) {
+		t.Errorf("restart = %v, want [provider]", restart)
+	}
+	if cur.ProviderModels["zai"] != "glm-4.6" || cur.SystemPrompt != "be brief" {
+		t.Errorf("hot fields not applied: %+v", cur)
+	}
+	if cur.Provider == "other" || cur.ConversationDir != "/runtime/conversations" {
+		t.Errorf("non-reloadable fields were applied: provider %q, conversation dir %q", cur.Provider, cur.ConversationDir)
+	}
+
+	changed, _ = cur.ApplyReloadable(cur)
+	if len(changed) != 0 {
+		t.Errorf("reapplying the same config changed %v", changed)
+	}
+}
+
+func TestCloneIsDeep(t *testing.T) {
+	on := true
+	cur := DefaultConfig()
+	cur.ProviderModels["zai"] = "glm-4.6"
+	cur.RetryPolicies = RetryPolicies{"default": {RetryOn: []string{"network"}}}
+	cur.Web.AllowedHosts = []string{"box.local"}
+	cur.AnalyticsEnabled = &on
+
+	clone := cur.Clone()
+	clone.ProviderModels["zai"] = "other"
+	clone.RetryPolicies["default"].RetryOn[0] = "rate_limit"
+	clone.Web.AllowedHosts[0] = "elsewhere"
+	*clone.AnalyticsEnabled = false
+
+	if cur.ProviderModels["zai"] != "glm-4.6" || cur.RetryPolicies["default"].RetryOn[0] != "network" ||
+		cur.Web.AllowedHosts[0] != "box.local" || !*cur.AnalyticsEnabled {
+		t.Fatalf("clone shares state with the original: %+v", cur)
+	}
+}
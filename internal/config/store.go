@@ -0,0 +1,77 @@
+package config
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// Store holds the user config in place of the config file. LoadUserConfig
+// and Save use it when one is set with SetStore.
+type Store interface {
+	Load() (Config, error)
+	Save(Config) error
+}
+
+var activeStore atomic.Pointer[Store]
+
+// SetStore makes LoadUserConfig and Save use s instead of the config file
+// and returns a function that restores the previous store. A nil s goes
+// back to the file.
+func SetStore(s Store) (restore func()) {
+	var prev *Store
+	if s == nil {
+		prev = activeStore.Swap(nil)
+	} else {
+		prev = activeStore.Swap(&s)
+	}
+	return func() { activeStore.Store(prev) }
+}
+
+func currentStore() Store {
+	if s := activeStore.Load(); s != nil {
+		return *s
+	}
+	return nil
+}
+
+// MemoryStore is a Store kept in memory, for tests and the test mode that
+// must not read or write the user's config file.
+type MemoryStore struct {
+	mu    sync.Mutex
+	cfg   Config
+	saves int
+}
+
+// NewMemoryStore returns a store holding cfg.
+func NewMemoryStore(cfg Config) *MemoryStore {
+	return &MemoryStore{cfg: cfg}
+}
+
+// Load returns the stored config with its computed paths applied.
+func (m *MemoryStore) Load() (Config, error) {
+	m.mu.Lock()
+	cfg := m.cfg
+	m.mu.Unlock()
+	cfg.applyComputedPaths()
+	return cfg, nil
+}
+
+// Save replaces the stored config, dropping the runtime paths as the file
+// store does.
+func (m *MemoryStore) Save(c Config) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	c.ConversationDir = ""
+	c.MemoryStorePath = ""
+	c.HistoryPath = ""
+	m.cfg = c
+	m.saves++
+	return nil
+}
+
+// Saves reports how many times Save was called.
+func (m *MemoryStore) Saves() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.saves
+}
@@ -223,9 +223,15 @@ func TestEmptyMessageRemoval(t *testing.T) {
 // Mock LLM client for testing
 type mockLLMClient struct {
 	summaries map[string]string
+	err       error // Returned by every call when set
+	calls     int
 }
 
 func (m *mockLLMClient) Chat(ctx context.Context, req llm.ChatRequest) (llm.ChatResponse, error) {
+	m.calls++
+	if m.err != nil {
+		return llm.ChatResponse{}, m.err
+	}
 	// Generate a simple summary
 	summary := "Test summary of conversation turn"
 	m.summaries[req.Messages[len(req.Messages)-1].Content] = summary
@@ -0,0 +1,141 @@
+package contextprofile
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+const (
+	// fallbackSentenceWords bounds each sentence quoted by an extractive summary.
+	fallbackSentenceWords  = 15
+	maxFallbackIdentifiers = 8
+)
+
+// rolePrefix matches the "[role name]: " headers compaction puts before each
+// message of a turn.
+var rolePrefix = regexp.MustCompile(`^\[[a-z_]+(?: [^\]]*)?\]: ?`)
+
+// fallbackSummary condenses content without a model, for when the summary
+// model fails: the first and last sentences plus the identifiers it
+// mentions most prominently, such as file paths and function names. It is
+// cruder than a model summary but lets compaction go ahead.
+func fallbackSummary(content string) string {
+	var segments []string
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(rolePrefix.ReplaceAllString(strings.TrimSpace(line), ""))
+		if line != "" {
+			segments = append(segments, line)
+		}
+	}
+	if len(segments) == 0 {
+		return "(extractive) empty content"
+	}
+
+	first := firstSentence(segments[0])
+	last := lastSentence(segments[len(segments)-1])
+	summary := "(extractive) " + truncateWords(first, fallbackSentenceWords)
+	if last != "" && last != first {
+		summary += " … " + truncateWords(last, fallbackSentenceWords)
+	}
+	if ids := keyIdentifiers(content, maxFallbackIdentifiers); len(ids) > 0 {
+		summary += " Key terms: " + strings.Join(ids, ", ")
+	}
+	return summary
+}
+
+func firstSentence(text string) string {
+	if i := sentenceEnd(text); i >= 0 {
+		return text[:i+1]
+	}
+	return text
+}
+
+func lastSentence(text string) string {
+	text = strings.TrimSpace(text)
+	// Search before the final punctuation so the sentence keeps it
+	for i := len(text) - 2; i > 0; i-- {
+		if strings.ContainsRune(".!?", rune(text[i])) && text[i+1] == ' ' {
+			return strings.TrimSpace(text[i+1:])
+		}
+	}
+	return text
+}
+
+// sentenceEnd returns the index of the punctuation ending the first
+// sentence, or -1.
+func sentenceEnd(text string) int {
+	for i := 0; i < len(text)-1; i++ {
+		if strings.ContainsRune(".!?", rune(text[i])) && text[i+1] == ' ' {
+			return i
+		}
+	}
+	return -1
+}
+
+// keyIdentifiers returns up to limit distinct code-like tokens from text in
+// order of appearance: paths, file names, camelCase, snake_case and calls.
+func keyIdentifiers(text string, limit int) []string {
+	var ids []string
+	seen := make(map[string]bool)
+	fields := strings.FieldsFunc(text, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && !strings.ContainsRune("_./-()", r)
+	})
+	for _, field := range fields {
+		token := strings.TrimLeft(strings.Trim(field, ".-/"), "(")
+		if i := strings.IndexByte(token, '('); i > 0 {
+			token = token[:i] + "()" // Calls, e.g. fmt.Println(x)
+		} else {
+			token = strings.TrimRight(token, ")")
+		}
+		if !isIdentifier(token) || seen[token] {
+			continue
+		}
+		seen[token] = true
+		ids = append(ids, token)
+		if len(ids) == limit {
+			break
+		}
+	}
+	return ids
+}
+
+func isIdentifier(token string) bool {
+	if len(token) < 3 || len(token) > 80 || strings.Contains(token, "://") {
+		return false
+	}
+	if strings.HasSuffix(token, "()") {
+		return true
+	}
+	if strings.ContainsAny(token, "()") {
+		return false
+	}
+	// Paths and file names: a dot followed by a short extension
+	if dot := strings.LastIndexByte(token, '.'); dot > 0 {
+		if ext := token[dot+1:]; len(ext) >= 2 && len(ext) <= 4 && isLetters(ext) {
+			return true
+		}
+	}
+	if strings.Contains(token, "/") && !strings.HasPrefix(token, "/") {
+		return true
+	}
+	if strings.Contains(strings.Trim(token, "_"), "_") {
+		return true
+	}
+	// camelCase or PascalCase with an inner capital
+	for i := 1; i < len(token); i++ {
+		if unicode.IsUpper(rune(token[i])) && unicode.IsLower(rune(token[i-1])) {
+			return true
+		}
+	}
+	return false
+}
+
+func isLetters(s string) bool {
+	for _, r := range s {
+		if !unicode.IsLetter(r) {
+			return false
+		}
+	}
+	return true
+}
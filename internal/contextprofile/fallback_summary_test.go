@@ -0,0 +1,83 @@
+package contextprofile
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"cando/internal/config"
+	"cando/internal/state"
+	"cando/internal/tooling"
+)
+
+func TestFallbackSummary(t *testing.T) {
+	content := "[user]: Why does parseConfig crash on empty files? It panics.\n" +
+		"[assistant]: I'll read internal/config/load.go first.\n" +
+		"[tool read_file]: func parseConfig(data []byte) { ... }\n" +
+		"[assistant]: Fixed it by checking len(data) in load_config. Tests pass now."
+	got := fallbackSummary(content)
+	for _, want := range []string{
+		"(extractive) Why does parseConfig crash on empty files?",
+		"… Tests pass now.",
+		"Key terms: parseConfig, internal/config/load.go, read_file, parseConfig(), len(), load_config",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("summary %q lacks %q", got, want)
+		}
+	}
+}
+
+func TestCompactionFallsBackWhenSummaryModelFails(t *testing.T) {
+	client := &mockLLMClient{summaries: make(map[string]string), err: errors.New("503 service unavailable")}
+	profile, err := newMemoryProfile(Dependencies{
+		Client: client,
+		Config: config.Config{
+			MemoryStorePath:       filepath.Join(t.TempDir(), "test.db"),
+			ContextMessagePercent: 0.02,
+			ContextTotalPercent:   0.01,
+			ContextProtectRecent:  1,
+		},
+		Provider: "test",
+		Model:    "test-model",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer profile.store.Close()
+	profile.SetToolDefinitions([]tooling.ToolDefinition{})
+
+	var messages []state.Message
+	for _, topic := range []string{"the parser", "the cache", "the router"} {
+		messages = append(messages,
+			state.Message{Role: "user", Content: "Please refactor " + topic + "."},
+			state.Message{Role: "assistant", Content: "Refactored " + topic + " in handle_request.go. " + strings.Repeat("Details. ", 40)},
+		)
+	}
+	prepared, err := profile.Prepare(context.Background(), newTestConversation(messages))
+	if err != nil {
+		t.Fatalf("Prepare failed: %v", err)
+	}
+
+	placeholders := 0
+	for _, msg := range prepared.Messages {
+		if isPlaceholder(msg.Content) {
+			placeholders++
+			if !strings.Contains(msg.Content, "(extractive) Refactored") || !strings.Contains(msg.Content, "handle_request.go") {
+				t.Errorf("placeholder = %q", msg.Content)
+			}
+		}
+	}
+	if placeholders == 0 {
+		t.Fatal("compaction stalled when the summary model failed")
+	}
+	// After the first failure the model is not retried for a while
+	if client.calls != 1 {
+		t.Errorf("summary model called %d times", client.calls)
+	}
+	history := profile.GetCompactionHistory()
+	if len(history) == 0 || history[len(history)-1].FallbackSummaries != placeholders {
+		t.Errorf("history = %+v, want %d fallback summaries", history, placeholders)
+	}
+}
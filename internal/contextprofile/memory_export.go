@@ -0,0 +1,96 @@
+package contextprofile
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"cando/internal/clock"
+)
+
+// MemoryRecord is a stored memory in portable form, for moving memories
+// between machines or workspace clones.
+type MemoryRecord struct {
+	ID               string          `json:"id"`
+	Content          string          `json:"content"`
+	Summary          string          `json:"summary"`
+	Placeholder      string          `json:"placeholder"`
+	OriginalMessages json.RawMessage `json:"original_messages,omitempty"`
+	CreatedAt        time.Time       `json:"created_at"`
+	LastAccess       time.Time       `json:"last_access"`
+	Pinned           bool            `json:"pinned,omitempty"`
+}
+
+// MemoryPorter is implemented by profiles whose memories can be exported and
+// imported.
+type MemoryPorter interface {
+	ExportMemories() ([]MemoryRecord, error)
+	// ImportMemories stores records whose IDs are not present yet and
+	// returns how many it added. Existing memories are left untouched.
+	ImportMemories(records []MemoryRecord) (int, error)
+}
+
+func (p *memoryProfile) ExportMemories() ([]MemoryRecord, error) {
+	entries, err := p.store.All()
+	if err != nil {
+		return nil, err
+	}
+	records := make([]MemoryRecord, 0, len(entries))
+	for _, entry := range entries {
+		record := MemoryRecord{
+			ID:          entry.ID,
+			Content:     entry.Content,
+			Summary:     entry.Summary,
+			Placeholder: entry.Placeholder,
+			CreatedAt:   entry.CreatedAt,
+			LastAccess:  entry.LastAccess,
+			Pinned:      entry.Pinned,
+		}
+		if json.Valid(entry.OriginalMessages) {
+			record.OriginalMessages = json.RawMessage(entry.OriginalMessages)
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+func (p *memoryProfile) ImportMemories(records []MemoryRecord) (int, error) {
+	pinned := p.store.PinnedCount()
+	added := 0
+	for _, record := range records {
+		if record.ID == "" || record.Content == "" {
+			continue
+		}
+		if _, err := p.store.Access(record.ID, nil); err == nil {
+			continue
+		} else if !errors.Is(err, errMemoryNotFound) {
+			return added, err
+		}
+		entry := &memoryEntry{
+			ID:               record.ID,
+			Content:          record.Content,
+			Summary:          record.Summary,
+			Placeholder:      record.Placeholder,
+			OriginalMessages: []byte(record.OriginalMessages),
+			CreatedAt:        record.CreatedAt,
+			LastAccess:       record.LastAccess,
+		}
+		if entry.CreatedAt.IsZero() {
+			entry.CreatedAt = clock.Now()
+		}
+		if entry.LastAccess.IsZero() {
+			entry.LastAccess = entry.CreatedAt
+		}
+		// Imported pins count against the same limit as local ones
+		if record.Pinned && pinned < p.maxPins {
+			entry.Pinned = true
+			pinned++
+		}
+		if err := p.store.Put(entry); err != nil {
+			return added, fmt.Errorf("import memory %s: %w", record.ID, err)
+		}
+		added++
+	}
+	return added, nil
+}
@@ -0,0 +1,50 @@
+package contextprofile
+
+import (
+	"io"
+	"log"
+	"path/filepath"
+	"testing"
+)
+
+func TestMemoryExportImport(t *testing.T) {
+	logger := log.New(io.Discard, "", 0)
+	open := func(dir string) *memoryProfile {
+		store, err := newMemoryStore(filepath.Join(dir, "memory.db"), logger)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { store.Close() })
+		return &memoryProfile{store: store, logger: logger, maxPins: 1}
+	}
+	src := open(t.TempDir())
+	if _, err := src.store.Access("missing", nil); err == nil {
+		t.Fatal("expected a missing memory")
+	}
+	for _, id := range []string{"a", "b"} {
+		if err := src.store.Put(&memoryEntry{ID: id, Content: "content " + id, Summary: id, Placeholder: "[" + id + "]", OriginalMessages: []byte(`[{"role":"user","content":"hi"}]`), Pinned: true}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	records, err := src.ExportMemories()
+	if err != nil || len(records) != 2 {
+		t.Fatalf("export: %d records, %v", len(records), err)
+	}
+
+	dst := open(t.TempDir())
+	if err := dst.store.Put(&memoryEntry{ID: "a", Content: "local a", Summary: "a"}); err != nil {
+		t.Fatal(err)
+	}
+	added, err := dst.ImportMemories(records)
+	if err != nil || added != 1 {
+		t.Fatalf("import added %d, %v", added, err)
+	}
+	local, err := dst.store.Access("a", nil)
+	if err != nil || local.Content != "local a" {
+		t.Fatalf("existing memory was overwritten: %+v, %v", local, err)
+	}
+	b, err := dst.store.Access("b", nil)
+	if err != nil || b.Content != "content b" || string(b.OriginalMessages) == "" || !b.Pinned {
+		t.Fatalf("imported memory incomplete: %+v, %v", b, err)
+	}
+}
@@ -2,6 +2,8 @@ package contextprofile
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -11,9 +13,11 @@ import (
 	"sync"
 	"time"
 
+	"cando/internal/clock"
 	"cando/internal/config"
 	"cando/internal/llm"
 	"cando/internal/state"
+	"cando/internal/tokenizer"
 	"cando/internal/tooling"
 )
 
@@ -49,6 +53,12 @@ type MemoryInspector interface {
 	MemorySummary(limit int) (MemorySummary, error)
 }
 
+// MemorySeeder is implemented by profiles that can store externally sourced
+// content (such as project docs) as recallable memories.
+type MemorySeeder interface {
+	SeedMemory(ctx context.Context, source, content string) (MemorySummaryEntry, error)
+}
+
 type MemorySummary struct {
 	Total   int
 	Pinned  int
@@ -70,6 +80,7 @@ type memoryProfile struct {
 	store                 *memoryStore
 	cfg                   config.Config
 	provider              string
+	tokenizer             tokenizer.Tokenizer
 	threshold             int
 	conversationThreshold int
 	protectedRecent       int
@@ -85,6 +96,8 @@ type memoryProfile struct {
 	toolDefinitions       []tooling.ToolDefinition
 	toolDefsMu            sync.RWMutex
 	factsExtractor        FactsExtractor
+	summaryDownUntil      time.Time
+	fallbackSummaries     int
 }
 
 func (p *memoryProfile) SetProtectedRecent(n int) {
@@ -184,6 +197,11 @@ func newMemoryProfile(deps Dependencies) (*memoryProfile, error) {
 		return nil, err
 	}
 
+	seed := deps.IDSeed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+
 	// Load compaction history from database
 	history, err := store.LoadCompactionEvents()
 	if err != nil {
@@ -199,12 +217,13 @@ func newMemoryProfile(deps Dependencies) (*memoryProfile, error) {
 		store:                 store,
 		cfg:                   deps.Config,
 		provider:              provider,
+		tokenizer:             tokenizer.For(provider, model),
 		threshold:             messageLimit,
 		conversationThreshold: totalLimit,
 		protectedRecent:       protected,
 		cooldown:              memoryCooldown,
 		maxPins:               memoryMaxPins,
-		randSrc:               rand.New(rand.NewSource(time.Now().UnixNano())),
+		randSrc:               rand.New(rand.NewSource(seed)),
 		summaryPrompt:         deps.Config.CompactionPrompt,
 		compactionHistory:     history,
 	}, nil
@@ -218,7 +237,7 @@ func (p *memoryProfile) Prepare(ctx context.Context, conv *state.Conversation) (
 		return Prepared{Messages: messages}, nil
 	}
 
-	total := p.totalActualSize(messages)
+	total := p.totalTokens(messages)
 	forced := p.shouldForceCompaction()
 	if forced {
 		p.clearForceCompaction()
@@ -243,9 +262,9 @@ func (p *memoryProfile) Prepare(ctx context.Context, conv *state.Conversation) (
 				messages = removeEmptyMessages(messages)
 				mutated = true
 				if forced {
-					p.logger.Printf("FORCED context compaction: %d -> %d chars across %d messages (considered=%d)", stats.before, stats.after, stats.compacted, stats.considered)
+					p.logger.Printf("FORCED context compaction: %d -> %d tokens across %d messages (considered=%d)", stats.before, stats.after, stats.compacted, stats.considered)
 				} else {
-					p.logger.Printf("context compaction: %d -> %d chars across %d messages (considered=%d)", stats.before, stats.after, stats.compacted, stats.considered)
+					p.logger.Printf("context compaction: %d -> %d tokens across %d messages (considered=%d)", stats.before, stats.after, stats.compacted, stats.considered)
 				}
 			} else {
 				if forced {
@@ -459,11 +478,14 @@ func (p *memoryProfile) compactOverflow(ctx context.Context, messages []state.Me
 	}
 
 	// Emit compaction start event
+	charsBefore := p.totalChars(messages)
 	p.emitCompactionEvent("compaction_start", map[string]any{
-		"chars_before": total,
+		"tokens_before": total,
+		"chars_before":  charsBefore,
 	})
 
 	current := total
+	fallbacksBefore := p.fallbackCount()
 	protect := p.currentProtected()
 	if protect < 0 {
 		protect = 0
@@ -510,8 +532,8 @@ func (p *memoryProfile) compactOverflow(ctx context.Context, messages []state.Me
 		if changed {
 			// Recalculate actual size from JSON after compaction
 			// Note: Empty shells will be removed by caller (Prepare)
-			newSize := p.totalActualSize(messages)
-			p.logger.Printf("compaction: turn %d COMPACTED: %d -> %d chars (saved %d)", i+1, current, newSize, current-newSize)
+			newSize := p.totalTokens(messages)
+			p.logger.Printf("compaction: turn %d COMPACTED: %d -> %d tokens (saved %d)", i+1, current, newSize, current-newSize)
 			current = newSize
 			stats.compacted++
 		} else {
@@ -519,18 +541,21 @@ func (p *memoryProfile) compactOverflow(ctx context.Context, messages []state.Me
 		}
 	}
 
-	p.logger.Printf("compaction: finished - compacted %d/%d turns, %d -> %d chars", stats.compacted, len(compactableTurns), stats.before, current)
+	p.logger.Printf("compaction: finished - compacted %d/%d turns, %d -> %d tokens", stats.compacted, len(compactableTurns), stats.before, current)
 	stats.after = current
 	duration := time.Since(startTime)
 
 	// Create and store compaction event
 	event := CompactionEvent{
 		Timestamp:          startTime,
-		CharsBefore:        stats.before,
-		CharsAfter:         stats.after,
+		TokensBefore:       stats.before,
+		TokensAfter:        stats.after,
+		CharsBefore:        charsBefore,
+		CharsAfter:         p.totalChars(messages),
 		MessagesCompacted:  stats.compacted,
 		MessagesConsidered: stats.considered,
 		DurationMs:         duration.Milliseconds(),
+		FallbackSummaries:  p.fallbackCount() - fallbacksBefore,
 	}
 	p.addCompactionEvent(event)
 
@@ -551,7 +576,7 @@ func (p *memoryProfile) compactMessage(ctx context.Context, msg *state.Message)
 	if isPlaceholder(msg.Content) {
 		return 0, false, nil
 	}
-	if len(msg.Content) <= p.threshold {
+	if p.currentTokenizer().Count(msg.Content) <= p.threshold {
 		return 0, false, nil
 	}
 	// For single message compaction, store the message itself
@@ -592,8 +617,8 @@ func (p *memoryProfile) createMemory(ctx context.Context, content string, origin
 		Summary:          summary,
 		Placeholder:      placeholder,
 		OriginalMessages: originalMessagesJSON,
-		CreatedAt:        time.Now(),
-		LastAccess:       time.Now(),
+		CreatedAt:        clock.Now(),
+		LastAccess:       clock.Now(),
 	}
 	if err := p.store.Put(entry); err != nil {
 		return nil, err
@@ -601,7 +626,75 @@ func (p *memoryProfile) createMemory(ctx context.Context, content string, origin
 	return entry, nil
 }
 
+// SeedMemory summarizes content and stores it under an ID derived from
+// source, so seeding the same source again replaces the earlier memory.
+func (p *memoryProfile) SeedMemory(ctx context.Context, source, content string) (MemorySummaryEntry, error) {
+	summary, err := p.summarize(ctx, content)
+	if err != nil {
+		return MemorySummaryEntry{}, err
+	}
+	sum := sha256.Sum256([]byte(source))
+	id := "doc-" + hex.EncodeToString(sum[:6])
+	originalMessages, err := json.Marshal([]state.Message{{
+		Role:    "user",
+		Content: fmt.Sprintf("Project document %s:\n\n%s", source, content),
+	}})
+	if err != nil {
+		return MemorySummaryEntry{}, fmt.Errorf("marshal original messages: %w", err)
+	}
+	now := clock.Now()
+	entry := &memoryEntry{
+		ID:               id,
+		Content:          content,
+		Summary:          fmt.Sprintf("%s: %s", source, summary),
+		Placeholder:      fmt.Sprintf("[PROJECT DOC: %s] %s: %s\nRecall with recall_memory(%s) for the full text.", id, source, summary, id),
+		OriginalMessages: originalMessages,
+		CreatedAt:        now,
+		LastAccess:       now,
+	}
+	if err := p.store.Put(entry); err != nil {
+		return MemorySummaryEntry{}, err
+	}
+	return MemorySummaryEntry{ID: id, Summary: entry.Summary, LastAccess: now}, nil
+}
+
+// summaryRetryAfter is how long compaction keeps to extractive summaries
+// after the summary model fails, instead of waiting on it for every turn.
+const summaryRetryAfter = 2 * time.Minute
+
+// summarize condenses content with the summary model. When the model fails,
+// it falls back to an extractive summary so compaction still goes ahead; only
+// a cancelled context is an error.
 func (p *memoryProfile) summarize(ctx context.Context, content string) (string, error) {
+	p.mu.RLock()
+	down := clock.Now().Before(p.summaryDownUntil)
+	p.mu.RUnlock()
+	if !down {
+		summary, err := p.summarizeWithModel(ctx, content)
+		if err == nil {
+			return summary, nil
+		}
+		if ctx.Err() != nil {
+			return "", err
+		}
+		p.logger.Printf("summary model failed, using extractive summaries for %s: %v", summaryRetryAfter, err)
+		p.mu.Lock()
+		p.summaryDownUntil = clock.Now().Add(summaryRetryAfter)
+		p.mu.Unlock()
+	}
+	p.mu.Lock()
+	p.fallbackSummaries++
+	p.mu.Unlock()
+	return fallbackSummary(content), nil
+}
+
+func (p *memoryProfile) fallbackCount() int {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.fallbackSummaries
+}
+
+func (p *memoryProfile) summarizeWithModel(ctx context.Context, content string) (string, error) {
 	resp, err := p.client.Chat(ctx, llm.ChatRequest{
 		Model: p.summaryModel,
 		Messages: []state.Message{
@@ -629,7 +722,7 @@ func (p *memoryProfile) summarize(ctx context.Context, content string) (string,
 func (p *memoryProfile) generateID() string {
 	p.mu.Lock()
 	defer p.mu.Unlock()
-	return fmt.Sprintf("mem-%d-%04x", time.Now().UnixNano(), p.randSrc.Intn(0xffff))
+	return fmt.Sprintf("mem-%d-%04x", clock.Now().UnixNano(), p.randSrc.Intn(0xffff))
 }
 
 func isPlaceholder(content string) bool {
@@ -645,31 +738,37 @@ func totalContentLength(messages []state.Message) int {
 	return total
 }
 
-func (p *memoryProfile) totalActualSize(messages []state.Message) int {
-	// Marshal messages to JSON
+// totalTokens measures what a request with messages sends: the messages and
+// the tool definitions, or an allowance for them before they are set.
+func (p *memoryProfile) totalTokens(messages []state.Message) int {
+	tok := p.currentTokenizer()
+	total := tokenizer.CountMessages(tok, messages)
+	if toolDefs := p.getToolDefinitions(); len(toolDefs) > 0 {
+		return total + tokenizer.CountJSON(tok, toolDefs)
+	}
+	return total + 3000
+}
+
+// totalChars is the JSON size of messages and tool definitions, kept in
+// compaction events next to their token counts.
+func (p *memoryProfile) totalChars(messages []state.Message) int {
 	msgData, err := json.Marshal(messages)
 	if err != nil {
-		// Fallback to content-only measurement
 		return totalContentLength(messages)
 	}
-
-	// Get tool definitions
-	toolDefs := p.getToolDefinitions()
-	if len(toolDefs) == 0 {
-		// No tools set yet, use estimate
-		return len(msgData) + 10000
-	}
-
-	// Marshal tools to JSON
-	toolData, err := json.Marshal(toolDefs)
+	toolData, err := json.Marshal(p.getToolDefinitions())
 	if err != nil {
-		// Fallback to estimate
-		return len(msgData) + 10000
+		return len(msgData)
 	}
-
 	return len(msgData) + len(toolData)
 }
 
+func (p *memoryProfile) currentTokenizer() tokenizer.Tokenizer {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.tokenizer
+}
+
 func (p *memoryProfile) MemorySummary(limit int) (MemorySummary, error) {
 	if limit <= 0 {
 		limit = 5
@@ -694,6 +793,16 @@ func (p *memoryProfile) MemorySummary(limit int) (MemorySummary, error) {
 	}, nil
 }
 
+// Close releases the memory store. The profile must not be used afterwards.
+func (p *memoryProfile) Close() error {
+	return p.store.Close()
+}
+
+// CheckIntegrity implements IntegrityChecker.
+func (p *memoryProfile) CheckIntegrity(ctx context.Context) error {
+	return p.store.CheckIntegrity(ctx)
+}
+
 func (p *memoryProfile) ReloadConfig(cfg config.Config) error {
 	// Note: We ignore cfg.MemoryStorePath - the store path is set at profile creation
 	// and cannot be changed at runtime. The passed config may have a different path
@@ -730,6 +839,7 @@ func (p *memoryProfile) UpdateProviderModel(provider, model string) {
 	defer p.mu.Unlock()
 	p.provider = provider
 	p.model = model
+	p.tokenizer = tokenizer.For(provider, model)
 
 	// Recalculate thresholds with new provider/model
 	p.threshold = p.cfg.CalculateMessageThreshold(provider, model)
@@ -741,8 +851,8 @@ func (p *memoryProfile) UpdateProviderModel(provider, model string) {
 		p.summaryModel = summaryModel
 	}
 
-	p.logger.Printf("Updated compaction thresholds for %s/%s: message=%d, conversation=%d, summary_model=%s",
-		provider, model, p.threshold, p.conversationThreshold, p.summaryModel)
+	p.logger.Printf("Updated compaction thresholds for %s/%s: message=%d, conversation=%d tokens (%s), summary_model=%s",
+		provider, model, p.threshold, p.conversationThreshold, p.tokenizer.Name(), p.summaryModel)
 }
 
 // SetCompactionCallback implements CompactionEventEmitter.
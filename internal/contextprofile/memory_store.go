@@ -8,8 +8,11 @@ import (
 	"log"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 
+	"cando/internal/clock"
+
 	_ "modernc.org/sqlite"
 )
 
@@ -96,12 +99,27 @@ CREATE TABLE IF NOT EXISTS compaction_events (
 	chars_after INTEGER NOT NULL,
 	messages_compacted INTEGER NOT NULL,
 	messages_considered INTEGER NOT NULL,
-	duration_ms INTEGER NOT NULL
+	duration_ms INTEGER NOT NULL,
+	tokens_before INTEGER NOT NULL DEFAULT 0,
+	tokens_after INTEGER NOT NULL DEFAULT 0
 )`); err != nil {
 		db.Close()
 		return nil, fmt.Errorf("init compaction_events schema: %w", err)
 	}
 
+	// Migration: Add token columns to events recorded in characters only
+	err = db.QueryRowContext(context.Background(),
+		`SELECT COUNT(*) FROM pragma_table_info('compaction_events') WHERE name='tokens_before'`).Scan(&hasColumn)
+	if err == nil && hasColumn == 0 {
+		for _, column := range []string{"tokens_before", "tokens_after"} {
+			if _, err = db.ExecContext(context.Background(),
+				`ALTER TABLE compaction_events ADD COLUMN `+column+` INTEGER NOT NULL DEFAULT 0`); err != nil {
+				db.Close()
+				return nil, fmt.Errorf("migrate compaction_events schema: %w", err)
+			}
+		}
+	}
+
 	return &memoryStore{db: db, path: path, logger: logger}, nil
 }
 
@@ -254,7 +272,7 @@ func (s *memoryStore) Pin(id string, pin bool, maxPins int) (*memoryEntry, error
 	} else if !pin {
 		entry.Pinned = false
 	}
-	entry.LastAccess = time.Now()
+	entry.LastAccess = clock.Now()
 	if err := saveEntry(tx, entry); err != nil {
 		tx.Rollback()
 		return nil, err
@@ -304,10 +322,58 @@ LIMIT ?`, limit)
 	return total, pinned, entries, nil
 }
 
+// All returns every stored memory, oldest first.
+func (s *memoryStore) All() ([]memoryEntry, error) {
+	rows, err := s.db.Query(`
+SELECT id, content, summary, placeholder, original_messages, created_at, last_access, pinned
+FROM memories
+ORDER BY created_at, id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var entries []memoryEntry
+	for rows.Next() {
+		entry, err := scanEntry(rows)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, *entry)
+	}
+	return entries, rows.Err()
+}
+
 func (s *memoryStore) Path() string {
 	return s.path
 }
 
+// CheckIntegrity runs SQLite's quick_check and returns the first problems
+// it reports.
+func (s *memoryStore) CheckIntegrity(ctx context.Context) error {
+	rows, err := s.db.QueryContext(ctx, "PRAGMA quick_check(5)")
+	if err != nil {
+		return fmt.Errorf("quick_check: %w", err)
+	}
+	defer rows.Close()
+	var problems []string
+	for rows.Next() {
+		var line string
+		if err := rows.Scan(&line); err != nil {
+			return fmt.Errorf("quick_check: %w", err)
+		}
+		if line != "ok" {
+			problems = append(problems, line)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("quick_check: %w", err)
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("memory store %s is damaged: %s", s.path, strings.Join(problems, "; "))
+	}
+	return nil
+}
+
 func (s *memoryStore) Close() error {
 	if s.db != nil {
 		return s.db.Close()
@@ -364,16 +430,16 @@ func boolToInt(b bool) int {
 // SaveCompactionEvent persists a compaction event to the database
 func (s *memoryStore) SaveCompactionEvent(event CompactionEvent) error {
 	_, err := s.db.ExecContext(context.Background(), `
-INSERT INTO compaction_events (timestamp, chars_before, chars_after, messages_compacted, messages_considered, duration_ms)
-VALUES (?, ?, ?, ?, ?, ?)`,
-		event.Timestamp, event.CharsBefore, event.CharsAfter, event.MessagesCompacted, event.MessagesConsidered, event.DurationMs)
+INSERT INTO compaction_events (timestamp, chars_before, chars_after, tokens_before, tokens_after, messages_compacted, messages_considered, duration_ms)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		event.Timestamp, event.CharsBefore, event.CharsAfter, event.TokensBefore, event.TokensAfter, event.MessagesCompacted, event.MessagesConsidered, event.DurationMs)
 	return err
 }
 
 // LoadCompactionEvents loads all compaction events from the database
 func (s *memoryStore) LoadCompactionEvents() ([]CompactionEvent, error) {
 	rows, err := s.db.QueryContext(context.Background(), `
-SELECT timestamp, chars_before, chars_after, messages_compacted, messages_considered, duration_ms
+SELECT timestamp, chars_before, chars_after, tokens_before, tokens_after, messages_compacted, messages_considered, duration_ms
 FROM compaction_events
 ORDER BY timestamp DESC
 LIMIT 50`)
@@ -385,7 +451,7 @@ LIMIT 50`)
 	var events []CompactionEvent
 	for rows.Next() {
 		var event CompactionEvent
-		if err := rows.Scan(&event.Timestamp, &event.CharsBefore, &event.CharsAfter, &event.MessagesCompacted, &event.MessagesConsidered, &event.DurationMs); err != nil {
+		if err := rows.Scan(&event.Timestamp, &event.CharsBefore, &event.CharsAfter, &event.TokensBefore, &event.TokensAfter, &event.MessagesCompacted, &event.MessagesConsidered, &event.DurationMs); err != nil {
 			return nil, err
 		}
 		events = append(events, event)
@@ -8,6 +8,7 @@ import (
 	"strings"
 	"time"
 
+	"cando/internal/clock"
 	"cando/internal/logging"
 	"cando/internal/state"
 	"cando/internal/tooling"
@@ -51,7 +52,7 @@ func (t *recallMemoryTool) Call(ctx context.Context, args map[string]any) (strin
 
 	// Access memory and update last access time
 	entry, err := t.store.Access(id, func(e *memoryEntry) {
-		e.LastAccess = time.Now()
+		e.LastAccess = clock.Now()
 	})
 	if err != nil {
 		logging.ErrorLog("memory: failed to access %s: %v", id, err)
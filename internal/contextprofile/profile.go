@@ -2,6 +2,7 @@ package contextprofile
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"log"
 	"strings"
@@ -10,6 +11,7 @@ import (
 	"cando/internal/config"
 	"cando/internal/llm"
 	"cando/internal/state"
+	"cando/internal/timefmt"
 	"cando/internal/tooling"
 )
 
@@ -33,12 +35,30 @@ type ConfigReloadable interface {
 
 // CompactionEvent represents a single compaction operation's statistics.
 type CompactionEvent struct {
-	Timestamp          time.Time `json:"timestamp"`
-	CharsBefore        int       `json:"chars_before"`
-	CharsAfter         int       `json:"chars_after"`
-	MessagesCompacted  int       `json:"messages_compacted"`
-	MessagesConsidered int       `json:"messages_considered"`
-	DurationMs         int64     `json:"duration_ms"`
+	Timestamp time.Time `json:"timestamp"`
+	// TokensBefore and TokensAfter measure the context in the active
+	// model's tokens; events recorded before token accounting have only
+	// the JSON character counts.
+	TokensBefore       int   `json:"tokens_before,omitempty"`
+	TokensAfter        int   `json:"tokens_after,omitempty"`
+	CharsBefore        int   `json:"chars_before"`
+	CharsAfter         int   `json:"chars_after"`
+	MessagesCompacted  int   `json:"messages_compacted"`
+	MessagesConsidered int   `json:"messages_considered"`
+	DurationMs         int64 `json:"duration_ms"`
+	// FallbackSummaries counts turns summarized extractively because the
+	// summary model failed.
+	FallbackSummaries int `json:"fallback_summaries,omitempty"`
+}
+
+// MarshalJSON writes the timestamp as UTC RFC 3339 with Unix millis.
+func (e CompactionEvent) MarshalJSON() ([]byte, error) {
+	type event CompactionEvent
+	return json.Marshal(struct {
+		event
+		Timestamp   timefmt.Time `json:"timestamp"`
+		TimestampMs int64        `json:"timestamp_ms"`
+	}{event(e), timefmt.Time(e.Timestamp), timefmt.Millis(e.Timestamp)})
 }
 
 // CompactionEventEmitter is an optional interface for profiles that support compaction event emission.
@@ -47,6 +67,12 @@ type CompactionEventEmitter interface {
 	GetCompactionHistory() []CompactionEvent
 }
 
+// IntegrityChecker is an optional interface for profiles whose storage can
+// verify itself, used by the health endpoint.
+type IntegrityChecker interface {
+	CheckIntegrity(ctx context.Context) error
+}
+
 // FactsExtractor is called before compaction to extract project knowledge from the conversation.
 // Implementation should handle loading existing facts, calling LLM, and saving updated facts.
 type FactsExtractor interface {
@@ -65,6 +91,7 @@ type Dependencies struct {
 	Config   config.Config
 	Provider string // Active provider (e.g., "zai", "openrouter")
 	Model    string // Active model name
+	IDSeed   int64  // Seeds generated memory IDs; 0 seeds from the clock
 }
 
 // New selects the requested profile by name.
@@ -3,8 +3,12 @@ package credentials
 import (
 	"fmt"
 	"os"
+	"path"
 	"path/filepath"
 	"strings"
+	"sync"
+
+	"cando/internal/config"
 
 	"gopkg.in/yaml.v3"
 )
@@ -19,6 +23,62 @@ type Credentials struct {
 type Provider struct {
 	APIKey      string `yaml:"api_key"`
 	VisionModel string `yaml:"vision_model,omitempty"`
+	Scope       Scope  `yaml:"scope,omitempty"`
+}
+
+// Scope restricts which models a provider key may be used with. The zero
+// value allows every model.
+type Scope struct {
+	FreeModelsOnly bool     `yaml:"free_models_only,omitempty" json:"free_models_only,omitempty"` // Only OpenRouter ":free" variants
+	AllowedModels  []string `yaml:"allowed_models,omitempty" json:"allowed_models,omitempty"`     // Glob patterns, e.g. "z-ai/*"
+	DeniedModels   []string `yaml:"denied_models,omitempty" json:"denied_models,omitempty"`       // Glob patterns checked first
+}
+
+// IsZero reports whether the scope places no restrictions.
+func (s Scope) IsZero() bool {
+	return !s.FreeModelsOnly && len(s.AllowedModels) == 0 && len(s.DeniedModels) == 0
+}
+
+// Check returns an error describing why model falls outside the scope, or
+// nil when it is allowed.
+func (s Scope) Check(model string) error {
+	model = strings.TrimSpace(model)
+	for _, pattern := range s.DeniedModels {
+		if matchModel(pattern, model) {
+			return fmt.Errorf("model %q is denied by pattern %q", model, pattern)
+		}
+	}
+	if s.FreeModelsOnly && !strings.HasSuffix(model, ":free") {
+		return fmt.Errorf("model %q is not a free model (key is restricted to \":free\" models)", model)
+	}
+	if len(s.AllowedModels) == 0 {
+		return nil
+	}
+	for _, pattern := range s.AllowedModels {
+		if matchModel(pattern, model) {
+			return nil
+		}
+	}
+	return fmt.Errorf("model %q is not in the key's allowed models (%s)", model, strings.Join(s.AllowedModels, ", "))
+}
+
+// Validate reports malformed glob patterns.
+func (s Scope) Validate() error {
+	for _, pattern := range append(append([]string{}, s.AllowedModels...), s.DeniedModels...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid model pattern %q: %w", pattern, err)
+		}
+	}
+	return nil
+}
+
+func matchModel(pattern, model string) bool {
+	pattern = strings.TrimSpace(pattern)
+	if pattern == model {
+		return true
+	}
+	ok, err := path.Match(pattern, model)
+	return err == nil && ok
 }
 
 // Manager handles credential storage and retrieval
@@ -28,35 +88,17 @@ type Manager struct {
 
 // NewManager creates a new credential manager
 // Checks CANDO_CREDENTIALS_PATH environment variable first.
-// If not set, defaults to ~/.cando/credentials.yaml
+// If not set, defaults to credentials.yaml in the config directory
+// (~/.cando, or the active profile's directory).
 func NewManager() (*Manager, error) {
 	credPath := os.Getenv("CANDO_CREDENTIALS_PATH")
 	if credPath == "" {
-		configDir := getConfigDir()
-		credPath = filepath.Join(configDir, "credentials.yaml")
+		credPath = filepath.Join(config.GetConfigDir(), "credentials.yaml")
 	}
 
 	return &Manager{path: credPath}, nil
 }
 
-func getConfigDir() string {
-	if configDir := os.Getenv("CANDO_CONFIG_DIR"); configDir != "" {
-		return configDir
-	}
-	home, err := os.UserHomeDir()
-	if err != nil {
-		return ".cando"
-	}
-
-	// Check if running as beta version
-	execName := filepath.Base(os.Args[0])
-	if strings.Contains(execName, "beta") {
-		return filepath.Join(home, ".cando-beta")
-	}
-
-	return filepath.Join(home, ".cando")
-}
-
 // Load reads credentials from disk
 func (m *Manager) Load() (*Credentials, error) {
 	data, err := os.ReadFile(m.path)
@@ -78,6 +120,11 @@ func (m *Manager) Load() (*Credentials, error) {
 	if creds.Providers == nil {
 		creds.Providers = make(map[string]Provider)
 	}
+	for name, p := range creds.Providers {
+		if err := p.Scope.Validate(); err != nil {
+			return nil, fmt.Errorf("provider %s scope: %w", name, err)
+		}
+	}
 
 	return &creds, nil
 }
@@ -173,6 +220,14 @@ func (c *Credentials) ListProviders() []string {
 	return names
 }
 
+// GetScope returns the model scope for a provider
+func (c *Credentials) GetScope(provider string) Scope {
+	if c.Providers == nil {
+		return Scope{}
+	}
+	return c.Providers[provider].Scope
+}
+
 // GetVisionModel returns the vision model for a provider
 func (c *Credentials) GetVisionModel(provider string) string {
 	if c.Providers == nil {
@@ -180,3 +235,54 @@ func (c *Credentials) GetVisionModel(provider string) string {
 	}
 	return c.Providers[provider].VisionModel
 }
+
+// MemoryStore keeps credentials in memory instead of on disk. It has the
+// same Load/Save/Path methods as Manager, for tests and the test mode that
+// must not read or touch the user's credentials file.
+type MemoryStore struct {
+	mu    sync.Mutex
+	creds Credentials
+}
+
+// NewMemoryStore returns a store holding a copy of creds (which may be nil).
+func NewMemoryStore(creds *Credentials) *MemoryStore {
+	s := &MemoryStore{}
+	if creds != nil {
+		s.creds = creds.clone()
+	}
+	return s
+}
+
+// Load returns a copy of the stored credentials.
+func (s *MemoryStore) Load() (*Credentials, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	creds := s.creds.clone()
+	return &creds, nil
+}
+
+// Save replaces the stored credentials with a copy of creds.
+func (s *MemoryStore) Save(creds *Credentials) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if creds == nil {
+		s.creds = Credentials{}
+		return nil
+	}
+	s.creds = creds.clone()
+	return nil
+}
+
+// Path returns "" since nothing is written to disk.
+func (s *MemoryStore) Path() string {
+	return ""
+}
+
+func (c Credentials) clone() Credentials {
+	providers := make(map[string]Provider, len(c.Providers))
+	for name, p := range c.Providers {
+		providers[name] = p
+	}
+	c.Providers = providers
+	return c
+}
@@ -55,6 +55,10 @@ func chooseProvider() (string, error) {
 	fmt.Println()
 	fmt.Println("  1) Z.AI        - Fast Chinese models (GLM-4, recommended)")
 	fmt.Println("  2) OpenRouter  - Access to Claude, GPT-4, and more")
+	fmt.Println("  3) OpenAI      - GPT and o-series models")
+	fmt.Println("  4) Azure       - Azure OpenAI deployments")
+	fmt.Println()
+	fmt.Println("Running Ollama locally? No key is needed; Cando uses it whenever it is running.")
 	fmt.Println()
 
 	choice := promptWithDefault("Choice", "1")
@@ -72,11 +76,30 @@ func chooseProvider() (string, error) {
 		fmt.Println("Get one at: https://openrouter.ai/keys")
 		fmt.Println()
 		return "openrouter", nil
+	case "3", "openai":
+		fmt.Println()
+		fmt.Println("Great! You'll need an OpenAI API key.")
+		fmt.Println("Get one at: https://platform.openai.com/api-keys")
+		fmt.Println()
+		return "openai", nil
+	case "4", "azure":
+		printAzureHint()
+		return "azure", nil
 	default:
 		return "", fmt.Errorf("invalid choice: %s", choice)
 	}
 }
 
+// printAzureHint explains the settings an Azure key needs besides itself.
+func printAzureHint() {
+	fmt.Println()
+	fmt.Println("You'll need a key from your Azure OpenAI resource (Keys and Endpoint).")
+	fmt.Println("Also set azure_openai_endpoint in ~/.cando/config.yaml, e.g.")
+	fmt.Println("  azure_openai_endpoint: https://my-resource.openai.azure.com")
+	fmt.Println("Model names are your deployment names.")
+	fmt.Println()
+}
+
 func getAPIKey(provider string) (string, error) {
 	for {
 		apiKey := prompt(fmt.Sprintf("Enter your %s API key", strings.ToUpper(provider)))
@@ -87,8 +110,8 @@ func getAPIKey(provider string) (string, error) {
 			continue
 		}
 
-		// Basic validation
-		if !strings.HasPrefix(apiKey, "sk-") && !strings.Contains(apiKey, "glm-") {
+		// Basic validation; Azure keys have no fixed prefix
+		if provider != "azure" && !strings.HasPrefix(apiKey, "sk-") && !strings.Contains(apiKey, "glm-") {
 			fmt.Println("⚠ Warning: API key doesn't look valid (should start with 'sk-')")
 			confirm := promptWithDefault("Continue anyway? [y/n]", "n")
 			if !strings.HasPrefix(strings.ToLower(confirm), "y") {
@@ -174,6 +197,8 @@ func addProvider(creds *Credentials, manager *Manager) error {
 	fmt.Println("Which provider?")
 	fmt.Println("  1) Z.AI")
 	fmt.Println("  2) OpenRouter")
+	fmt.Println("  3) OpenAI")
+	fmt.Println("  4) Azure OpenAI")
 	fmt.Println()
 
 	choice := prompt("Choice")
@@ -184,6 +209,11 @@ func addProvider(creds *Credentials, manager *Manager) error {
 		provider = "zai"
 	case "2", "openrouter", "or":
 		provider = "openrouter"
+	case "3", "openai":
+		provider = "openai"
+	case "4", "azure":
+		provider = "azure"
+		printAzureHint()
 	default:
 		return fmt.Errorf("invalid provider: %s", choice)
 	}
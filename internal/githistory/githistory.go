@@ -0,0 +1,281 @@
+// Package githistory reads the history of files in a git repository and
+// renders it compactly for the model: one line per commit for logs, one
+// header per run of lines from the same commit for blame, and patches cut
+// to a size budget for show.
+package githistory
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultLimit is the number of commits a log returns by default.
+	DefaultLimit = 15
+	// MaxLimit caps the commits of one log.
+	MaxLimit = 100
+	// maxFilesPerCommit caps the file list printed under each commit.
+	maxFilesPerCommit = 8
+	// maxBlameLines caps the lines of one blame.
+	maxBlameLines = 400
+	// DefaultShowChars is the patch budget of Show.
+	DefaultShowChars = 12000
+)
+
+// ErrNotRepository is returned for workspaces outside a git work tree.
+var ErrNotRepository = errors.New("not a git repository")
+
+// Commit is one entry of a log.
+type Commit struct {
+	Hash    string   `json:"hash"` // Abbreviated
+	Date    string   `json:"date"` // YYYY-MM-DD
+	Author  string   `json:"author"`
+	Subject string   `json:"subject"`
+	Files   []string `json:"files,omitempty"` // Paths relative to the repository root
+}
+
+// LogOptions selects the commits of a log.
+type LogOptions struct {
+	Paths  []string // Only commits touching these paths, relative to the root
+	Symbol string   // Only commits adding or removing lines that mention it
+	Since  string   // Git date, e.g. "2 weeks ago" or "2024-05-01"
+	Limit  int      // 0 means DefaultLimit
+}
+
+// git runs a git command in root and returns its standard output.
+func git(ctx context.Context, root string, args ...string) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, "git", append([]string{"-C", root, "--no-pager"}, args...)...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if strings.Contains(msg, "not a git repository") {
+			return nil, ErrNotRepository
+		}
+		if msg == "" {
+			return nil, err
+		}
+		return nil, fmt.Errorf("git %s: %s", args[0], msg)
+	}
+	return out, nil
+}
+
+// Log returns the newest commits matching opts, newest first.
+func Log(ctx context.Context, root string, opts LogOptions) ([]Commit, error) {
+	limit := opts.Limit
+	if limit <= 0 {
+		limit = DefaultLimit
+	}
+	limit = min(limit, MaxLimit)
+	args := []string{"log", "--no-color", "--date=short", "--name-only",
+		"--format=%x1e%h%x1f%ad%x1f%an%x1f%s", "-n", strconv.Itoa(limit)}
+	if opts.Symbol != "" {
+		args = append(args, "-G"+regexp.QuoteMeta(opts.Symbol))
+	}
+	if opts.Since != "" {
+		args = append(args, "--since="+opts.Since)
+	}
+	args = append(args, "--")
+	args = append(args, opts.Paths...)
+	out, err := git(ctx, root, args...)
+	if err != nil {
+		// A repository without commits has no history to show
+		if strings.Contains(err.Error(), "does not have any commits") {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return parseLog(out), nil
+}
+
+func parseLog(out []byte) []Commit {
+	var commits []Commit
+	for _, record := range strings.Split(string(out), "\x1e") {
+		header, files, _ := strings.Cut(record, "\n")
+		fields := strings.Split(header, "\x1f")
+		if len(fields) != 4 {
+			continue
+		}
+		commit := Commit{Hash: fields[0], Date: fields[1], Author: fields[2], Subject: fields[3]}
+		for _, file := range strings.Split(files, "\n") {
+			if file = strings.TrimSpace(file); file != "" {
+				commit.Files = append(commit.Files, file)
+			}
+		}
+		commits = append(commits, commit)
+	}
+	return commits
+}
+
+// FormatLog renders commits one per line, each followed by the files it
+// touched.
+func FormatLog(commits []Commit) string {
+	var b strings.Builder
+	for _, c := range commits {
+		fmt.Fprintf(&b, "%s %s %s: %s\n", c.Hash, c.Date, c.Author, c.Subject)
+		files := c.Files
+		if len(files) > maxFilesPerCommit {
+			files = files[:maxFilesPerCommit]
+		}
+		if len(files) > 0 {
+			b.WriteString("    " + strings.Join(files, ", "))
+			if more := len(c.Files) - len(files); more > 0 {
+				fmt.Fprintf(&b, " (+%d more)", more)
+			}
+			b.WriteByte('\n')
+		}
+	}
+	return b.String()
+}
+
+// blameLine is one line of a blame with the commit that last changed it.
+type blameLine struct {
+	hash    string
+	date    string
+	author  string
+	summary string
+	line    int
+	text    string
+}
+
+// Blame shows which commit last changed each line of path, grouping runs of
+// lines from the same commit under one header. start and end select a line
+// range (1-based, inclusive); 0 means the start or end of the file.
+func Blame(ctx context.Context, root, path string, start, end int) (string, error) {
+	args := []string{"blame", "--line-porcelain"}
+	if start > 0 || end > 0 {
+		start = max(start, 1)
+		rng := strconv.Itoa(start) + ","
+		if end > 0 {
+			rng += strconv.Itoa(end)
+		}
+		args = append(args, "-L", rng)
+	}
+	args = append(args, "--", path)
+	out, err := git(ctx, root, args...)
+	if err != nil {
+		return "", err
+	}
+	lines := parseBlame(out)
+	if len(lines) == 0 {
+		return "", nil
+	}
+
+	var b strings.Builder
+	truncated := len(lines) > maxBlameLines
+	if truncated {
+		lines = lines[:maxBlameLines]
+	}
+	for i, line := range lines {
+		if i == 0 || lines[i-1].hash != line.hash {
+			last := i
+			for last+1 < len(lines) && lines[last+1].hash == line.hash {
+				last++
+			}
+			fmt.Fprintf(&b, "L%d-%d %s %s %s: %s\n", line.line, lines[last].line, line.hash, line.date, line.author, line.summary)
+		}
+		fmt.Fprintf(&b, "%6d| %s\n", line.line, line.text)
+	}
+	if truncated {
+		fmt.Fprintf(&b, "... (truncated at %d lines; pass start_line/end_line for a range)\n", maxBlameLines)
+	}
+	return b.String(), nil
+}
+
+func parseBlame(out []byte) []blameLine {
+	var (
+		lines   []blameLine
+		current blameLine
+	)
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	scanner.Buffer(make([]byte, 0, 64*1024), 4*1024*1024)
+	for scanner.Scan() {
+		text := scanner.Text()
+		if strings.HasPrefix(text, "\t") {
+			current.text = text[1:]
+			lines = append(lines, current)
+			current = blameLine{}
+			continue
+		}
+		key, value, _ := strings.Cut(text, " ")
+		switch key {
+		case "author":
+			current.author = value
+		case "author-time":
+			if secs, err := strconv.ParseInt(value, 10, 64); err == nil {
+				current.date = time.Unix(secs, 0).Format(time.DateOnly)
+			}
+		case "summary":
+			current.summary = value
+		default:
+			// The header line of each entry: <sha> <orig line> <final line> [<count>]
+			fields := strings.Fields(text)
+			if len(fields) >= 3 && len(fields[0]) == 40 {
+				current.hash = fields[0][:8]
+				current.line, _ = strconv.Atoi(fields[2])
+			}
+		}
+	}
+	// Lines not committed yet carry an all-zero hash and a placeholder author
+	for i := range lines {
+		if strings.Trim(lines[i].hash, "0") == "" {
+			lines[i].author, lines[i].summary = "you", "not committed yet"
+		}
+	}
+	return lines
+}
+
+// Show renders a commit's message, changed files and patch, limited to path
+// when given and cut to maxChars (0 means DefaultShowChars).
+func Show(ctx context.Context, root, ref, path string, maxChars int) (string, error) {
+	if maxChars <= 0 {
+		maxChars = DefaultShowChars
+	}
+	if ref == "" {
+		ref = "HEAD"
+	}
+	if strings.HasPrefix(ref, "-") {
+		return "", fmt.Errorf("invalid revision %q", ref)
+	}
+	args := []string{"show", "--no-color", "--date=short", "--stat", "--patch",
+		"--format=%h %ad %an%n%s%n%n%b", ref, "--"}
+	if path != "" {
+		args = append(args, path)
+	}
+	out, err := git(ctx, root, args...)
+	if err != nil {
+		return "", err
+	}
+	text := strings.TrimRight(string(out), "\n")
+	if len(text) > maxChars {
+		text = text[:maxChars] + fmt.Sprintf("\n... (truncated at %d chars; pass a path to narrow the patch)", maxChars)
+	}
+	return text, nil
+}
+
+// FindFile returns the tracked file named name when exactly one exists
+// anywhere in the repository, so a bare "parser.go" in a bug report can be
+// matched to its path.
+func FindFile(ctx context.Context, root, name string) (string, bool) {
+	if name == "" || strings.ContainsAny(name, "/\\*?[") {
+		return "", false
+	}
+	out, err := git(ctx, root, "ls-files", "-z", "--", ":(glob)**/"+name)
+	if err != nil {
+		return "", false
+	}
+	matches := strings.Split(strings.TrimSuffix(string(out), "\x00"), "\x00")
+	if len(matches) != 1 || matches[0] == "" {
+		return "", false
+	}
+	return matches[0], true
+}
@@ -0,0 +1,110 @@
+package githistory
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func testRepo(t *testing.T) string {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	return t.TempDir()
+}
+
+func commitFile(t *testing.T, root, rel, content, message string) {
+	t.Helper()
+	abs := filepath.Join(root, rel)
+	if err := os.MkdirAll(filepath.Dir(abs), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(abs, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	for _, args := range [][]string{{"add", rel}, {"commit", "-q", "-m", message}} {
+		cmd := exec.Command("git", append([]string{"-C", root, "-c", "user.name=Ada", "-c", "user.email=ada@example.com"}, args...)...)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, out)
+		}
+	}
+}
+
+func TestHistory(t *testing.T) {
+	root := testRepo(t)
+	ctx := context.Background()
+	if err := exec.Command("git", "-C", root, "init", "-q").Run(); err != nil {
+		t.Fatal(err)
+	}
+	if commits, err := Log(ctx, root, LogOptions{}); err != nil || commits != nil {
+		t.Fatalf("empty repository log = %v, %v", commits, err)
+	}
+
+	commitFile(t, root, "src/parse.go", "package src\n\nfunc Parse() {}\n", "Add parser")
+	commitFile(t, root, "README.md", "# demo\n", "Add readme")
+	commitFile(t, root, "src/parse.go", "package src\n\nfunc Parse() {}\n\nfunc ParseAll() {}\n", "Parse many inputs")
+
+	commits, err := Log(ctx, root, LogOptions{Paths: []string{"src/parse.go"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(commits) != 2 || commits[0].Subject != "Parse many inputs" || commits[1].Subject != "Add parser" {
+		t.Fatalf("path log = %+v", commits)
+	}
+	if commits[0].Author != "Ada" || len(commits[0].Files) != 1 || commits[0].Files[0] != "src/parse.go" {
+		t.Errorf("commit = %+v", commits[0])
+	}
+	if out := FormatLog(commits); !strings.Contains(out, commits[0].Hash+" ") || !strings.Contains(out, "    src/parse.go\n") {
+		t.Errorf("formatted log:\n%s", out)
+	}
+
+	bySymbol, err := Log(ctx, root, LogOptions{Symbol: "ParseAll"})
+	if err != nil || len(bySymbol) != 1 || bySymbol[0].Subject != "Parse many inputs" {
+		t.Errorf("symbol log = %+v, %v", bySymbol, err)
+	}
+	if limited, _ := Log(ctx, root, LogOptions{Limit: 1}); len(limited) != 1 {
+		t.Errorf("limit 1 returned %d commits", len(limited))
+	}
+
+	blame, err := Blame(ctx, root, "src/parse.go", 3, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(blame), "\n")
+	if len(lines) != 5 || !strings.HasPrefix(lines[0], "L3-3 ") || !strings.Contains(lines[0], "Add parser") ||
+		!strings.HasPrefix(lines[2], "L4-5 ") || !strings.Contains(lines[2], "Parse many inputs") ||
+		!strings.HasSuffix(lines[4], "| func ParseAll() {}") {
+		t.Errorf("blame:\n%s", blame)
+	}
+
+	show, err := Show(ctx, root, commits[0].Hash, "", 0)
+	if err != nil || !strings.Contains(show, "Parse many inputs") || !strings.Contains(show, "+func ParseAll() {}") {
+		t.Errorf("show = %q, %v", show, err)
+	}
+	if short, _ := Show(ctx, root, "HEAD", "", 20); !strings.Contains(short, "truncated at 20 chars") {
+		t.Errorf("show was not truncated: %q", short)
+	}
+	if _, err := Show(ctx, root, "--output=/tmp/x", "", 0); err == nil {
+		t.Error("expected an option-like revision to be rejected")
+	}
+
+	if path, ok := FindFile(ctx, root, "parse.go"); !ok || path != "src/parse.go" {
+		t.Errorf("FindFile = %q, %v", path, ok)
+	}
+	if _, ok := FindFile(ctx, root, "missing.go"); ok {
+		t.Error("FindFile found a missing file")
+	}
+}
+
+func TestNotRepository(t *testing.T) {
+	root := testRepo(t)
+	t.Setenv("GIT_CEILING_DIRECTORIES", filepath.Dir(root))
+	if _, err := Log(context.Background(), root, LogOptions{}); !errors.Is(err, ErrNotRepository) {
+		t.Errorf("err = %v, want ErrNotRepository", err)
+	}
+}
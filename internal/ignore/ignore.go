@@ -0,0 +1,174 @@
+// Package ignore decides which workspace files listings leave out: version
+// control metadata, installed dependencies, and whatever the workspace's
+// .gitignore files exclude. Patterns follow gitignore(5): blank lines and
+// # comments are skipped, ! re-includes, a trailing / matches directories
+// only, a pattern with a slash elsewhere is relative to its .gitignore's
+// directory, and ** matches any number of directories.
+package ignore
+
+import (
+	"bufio"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// DefaultDirs are left out whether or not a .gitignore names them.
+var DefaultDirs = map[string]bool{
+	".git": true, ".hg": true, ".svn": true, "node_modules": true,
+	"__pycache__": true, ".venv": true, "venv": true, ".gradle": true,
+}
+
+type rule struct {
+	pattern  string // Slash-separated glob
+	negate   bool
+	dirOnly  bool
+	anchored bool // Matched against the path from the .gitignore's directory, not the base name
+}
+
+// Matcher reads the .gitignore files under root as paths are checked, each
+// once. It is safe for concurrent use.
+type Matcher struct {
+	root string
+
+	mu    sync.Mutex
+	rules map[string][]rule // Directory, relative to root ("" for root) -> its .gitignore rules
+}
+
+// New returns a matcher for the workspace at root.
+func New(root string) *Matcher {
+	return &Matcher{root: root, rules: make(map[string][]rule)}
+}
+
+// Ignored reports whether rel, a slash-separated path relative to root, is
+// left out; isDir tells whether it names a directory. Like git, a path is
+// ignored when any directory above it is.
+func (m *Matcher) Ignored(rel string, isDir bool) bool {
+	rel = path.Clean(strings.TrimPrefix(filepath.ToSlash(rel), "/"))
+	if rel == "." || rel == "" {
+		return false
+	}
+	parts := strings.Split(rel, "/")
+	for i := range parts {
+		last := i == len(parts)-1
+		if m.match(parts[:i+1], !last || isDir) {
+			return true
+		}
+	}
+	return false
+}
+
+// match applies DefaultDirs and the rules of every .gitignore above the
+// path; the last matching rule wins.
+func (m *Matcher) match(parts []string, isDir bool) bool {
+	name := parts[len(parts)-1]
+	if isDir && DefaultDirs[name] {
+		return true
+	}
+	ignored := false
+	for depth := 0; depth < len(parts); depth++ {
+		dir := strings.Join(parts[:depth], "/")
+		rel := strings.Join(parts[depth:], "/")
+		for _, r := range m.rulesFor(dir) {
+			if r.dirOnly && !isDir {
+				continue
+			}
+			target := name
+			if r.anchored {
+				target = rel
+			}
+			if globMatch(r.pattern, target) {
+				ignored = !r.negate
+			}
+		}
+	}
+	return ignored
+}
+
+func (m *Matcher) rulesFor(dir string) []rule {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if rules, ok := m.rules[dir]; ok {
+		return rules
+	}
+	rules := readRules(filepath.Join(m.root, filepath.FromSlash(dir), ".gitignore"))
+	m.rules[dir] = rules
+	return rules
+}
+
+func readRules(file string) []rule {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	var rules []rule
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if r, ok := parseRule(scanner.Text()); ok {
+			rules = append(rules, r)
+		}
+	}
+	return rules
+}
+
+func parseRule(line string) (rule, bool) {
+	line = strings.TrimRight(line, " \t\r")
+	if line == "" || strings.HasPrefix(line, "#") {
+		return rule{}, false
+	}
+	var r rule
+	if strings.HasPrefix(line, "!") {
+		r.negate = true
+		line = line[1:]
+	} else if strings.HasPrefix(line, `\#`) || strings.HasPrefix(line, `\!`) {
+		line = line[1:]
+	}
+	if strings.HasSuffix(line, "/") {
+		r.dirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+	r.anchored = strings.Contains(line, "/")
+	line = strings.TrimPrefix(line, "/")
+	if strings.HasPrefix(line, "**/") {
+		// **/name matches name at any depth, like a pattern without a slash
+		if rest := line[3:]; !strings.Contains(rest, "/") {
+			r.anchored = false
+			line = rest
+		}
+	}
+	if line == "" {
+		return rule{}, false
+	}
+	r.pattern = line
+	return r, true
+}
+
+// globMatch matches a slash-separated path against pattern segment by
+// segment; a ** segment matches any number of segments.
+func globMatch(pattern, name string) bool {
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(name, "/"))
+}
+
+func matchSegments(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(name); i++ {
+				if matchSegments(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if ok, err := path.Match(pattern[0], name[0]); err != nil || !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
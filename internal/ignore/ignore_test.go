@@ -0,0 +1,54 @@
+package ignore
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMatcher(t *testing.T) {
+	root := t.TempDir()
+	write := func(rel, content string) {
+		t.Helper()
+		full := filepath.Join(root, filepath.FromSlash(rel))
+		os.MkdirAll(filepath.Dir(full), 0o755)
+		if err := os.WriteFile(full, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(".gitignore", "# build output\n*.log\n!keep.log\n/dist\nbuild/\ndocs/**/*.pdf\n\\#notes\n")
+	write("web/.gitignore", "generated.js\n/local\n")
+
+	tests := []struct {
+		rel   string
+		isDir bool
+		want  bool
+	}{
+		{"main.go", false, false},
+		{"debug.log", false, true},
+		{"logs/app/debug.log", false, true},
+		{"keep.log", false, false},
+		{"dist", true, true},
+		{"dist/app.js", false, true},
+		{"web/dist", true, false}, // /dist is anchored to the root
+		{"build", false, false},   // build/ only matches directories
+		{"web/build/out.js", false, true},
+		{"docs/a/b/guide.pdf", false, true},
+		{"docs/guide.pdf", false, true},
+		{"guide.pdf", false, false},
+		{"#notes", false, true},
+		{"web/generated.js", false, true},
+		{"generated.js", false, false}, // Rules apply below their .gitignore only
+		{"web/local", true, true},
+		{"web/src/local", true, false},
+		{"node_modules", true, true},
+		{"src/.git", true, true},
+		{".gitignore", false, false},
+	}
+	m := New(root)
+	for _, tt := range tests {
+		if got := m.Ignored(tt.rel, tt.isDir); got != tt.want {
+			t.Errorf("Ignored(%q, %v) = %v, want %v", tt.rel, tt.isDir, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"cando/internal/timefmt"
+)
+
+// lowQuotaFraction marks an account as low when less than this share of its
+// limit remains.
+const lowQuotaFraction = 0.1
+
+// AccountStatus reports how much of a provider key's quota or credit is left.
+type AccountStatus struct {
+	Provider  string     `json:"provider"`
+	Unit      string     `json:"unit"`            // "usd" or "percent"
+	Limit     *float64   `json:"limit,omitempty"` // nil when the key is unlimited
+	Used      float64    `json:"used"`
+	Remaining *float64   `json:"remaining,omitempty"`
+	ResetAt   *time.Time `json:"reset_at,omitempty"`
+	FreeTier  bool       `json:"free_tier,omitempty"`
+	Low       bool       `json:"low"` // Close to the limit; the next turns may fail
+	FetchedAt time.Time  `json:"fetched_at"`
+}
+
+// MarshalJSON writes the timestamps as UTC RFC 3339 with Unix millis.
+func (s AccountStatus) MarshalJSON() ([]byte, error) {
+	type status AccountStatus
+	return json.Marshal(struct {
+		status
+		ResetAt     *timefmt.Time `json:"reset_at,omitempty"`
+		ResetAtMs   *int64        `json:"reset_at_ms,omitempty"`
+		FetchedAt   timefmt.Time  `json:"fetched_at"`
+		FetchedAtMs int64         `json:"fetched_at_ms"`
+	}{status(s), timefmt.Ptr(s.ResetAt), timefmt.PtrMillis(s.ResetAt), timefmt.Time(s.FetchedAt), timefmt.Millis(s.FetchedAt)})
+}
+
+// AccountReporter is implemented by clients that can query the provider's
+// account endpoints for usage and limits.
+type AccountReporter interface {
+	AccountStatus(ctx context.Context) (*AccountStatus, error)
+}
+
+// SetLimit records limit and used, deriving the remaining amount and the low
+// flag.
+func (s *AccountStatus) SetLimit(limit, used float64) {
+	remaining := max(limit-used, 0)
+	s.Limit = &limit
+	s.Used = used
+	s.Remaining = &remaining
+	s.Low = limit > 0 && remaining < limit*lowQuotaFraction
+}
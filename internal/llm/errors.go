@@ -3,6 +3,9 @@ package llm
 import (
 	"errors"
 	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -16,6 +19,8 @@ const (
 	ErrorTypeProviderDown       ErrorType = "provider_down"       // 502/503 - upstream issue
 	ErrorTypeAuth               ErrorType = "auth"                // 401 - bad API key
 	ErrorTypeModeration         ErrorType = "moderation"          // 403 - content flagged
+	ErrorTypeScope              ErrorType = "scope"               // Model outside the key's credential scope
+	ErrorTypeInvalidResponse    ErrorType = "invalid_response"    // Reply failed validation (empty, duplicated or truncated)
 	ErrorTypeUnknown            ErrorType = "unknown"             // Fallback
 )
 
@@ -60,3 +65,32 @@ func NewProviderError(provider string, errType ErrorType, code, message string)
 		Message:  message,
 	}
 }
+
+// ApplyRetryAfter honors a Retry-After response header (seconds or HTTP
+// date), which takes precedence over provider-specific hints.
+func (e *ProviderError) ApplyRetryAfter(header http.Header) {
+	if e == nil {
+		return
+	}
+	if wait, ok := ParseRetryAfter(header.Get("Retry-After"), time.Now()); ok {
+		e.RetryAfter = &wait
+	}
+}
+
+// ParseRetryAfter parses a Retry-After header value.
+func ParseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, false
+	}
+	if secs, err := strconv.Atoi(value); err == nil {
+		if secs < 0 {
+			return 0, false
+		}
+		return time.Duration(secs) * time.Second, true
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		return max(at.Sub(now), 0), true
+	}
+	return 0, false
+}
@@ -14,6 +14,7 @@ type ChatRequest struct {
 	Tools       []tooling.ToolDefinition `json:"tools,omitempty"`
 	Temperature float64                  `json:"temperature,omitempty"`
 	Thinking    *ThinkingOptions         `json:"thinking,omitempty"`
+	Stream      bool                     `json:"stream,omitempty"` // Set by ChatStream implementations
 }
 
 type ThinkingOptions struct {
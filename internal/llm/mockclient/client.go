@@ -52,3 +52,16 @@ func (c *Client) Chat(_ context.Context, req llm.ChatRequest) (llm.ChatResponse,
 		},
 	}, nil
 }
+
+// ChatStream satisfies llm.Streamer, passing the reply to onDelta a word at
+// a time.
+func (c *Client) ChatStream(ctx context.Context, req llm.ChatRequest, onDelta func(llm.Delta)) (llm.ChatResponse, error) {
+	resp, err := c.Chat(ctx, req)
+	if err != nil {
+		return resp, err
+	}
+	for _, word := range strings.SplitAfter(resp.Choices[0].Message.Content, " ") {
+		onDelta(llm.Delta{Content: word})
+	}
+	return resp, nil
+}
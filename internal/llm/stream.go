@@ -0,0 +1,182 @@
+package llm
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"sort"
+	"strings"
+
+	"cando/internal/state"
+)
+
+// Delta is a piece of an assistant reply received while it is generated.
+type Delta struct {
+	Content  string `json:"content,omitempty"`
+	Thinking string `json:"thinking,omitempty"`
+}
+
+// Streamer is implemented by clients that can stream replies as they are
+// generated. ChatStream calls onDelta for each piece of content or thinking
+// and returns the complete response, tool calls and usage included, as Chat
+// would.
+type Streamer interface {
+	ChatStream(ctx context.Context, req ChatRequest, onDelta func(Delta)) (ChatResponse, error)
+}
+
+// ChatStream streams the reply when the client supports it and onDelta is
+// set, and otherwise falls back to a plain Chat call.
+func ChatStream(ctx context.Context, client Client, req ChatRequest, onDelta func(Delta)) (ChatResponse, error) {
+	if streamer, ok := client.(Streamer); ok && onDelta != nil {
+		return streamer.ChatStream(ctx, req, onDelta)
+	}
+	return client.Chat(ctx, req)
+}
+
+// IsEventStream reports whether a response carries server-sent events.
+// Endpoints that ignore the stream flag answer with plain JSON instead.
+func IsEventStream(resp *http.Response) bool {
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	return mediaType == "text/event-stream"
+}
+
+// streamChunk is one event of an OpenAI-compatible completion stream.
+type streamChunk struct {
+	Choices []struct {
+		Delta struct {
+			Content          string `json:"content"`
+			ReasoningContent string `json:"reasoning_content"` // Z.AI
+			Reasoning        string `json:"reasoning"`         // OpenRouter
+			ToolCalls        []struct {
+				Index    int    `json:"index"`
+				ID       string `json:"id"`
+				Type     string `json:"type"`
+				Function struct {
+					Name      string `json:"name"`
+					Arguments string `json:"arguments"`
+				} `json:"function"`
+			} `json:"tool_calls"`
+		} `json:"delta"`
+		FinishReason string `json:"finish_reason"`
+	} `json:"choices"`
+	Usage *Usage `json:"usage"`
+	Error *struct {
+		Code    any    `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// ReadStream reads an OpenAI-compatible server-sent event stream, passing
+// content and thinking to onDelta as they arrive, and assembles the complete
+// response. An error event, or a stream that ends before the reply is
+// finished, is returned as a retryable *ProviderError for provider.
+func ReadStream(body io.Reader, provider string, onDelta func(Delta)) (ChatResponse, error) {
+	var (
+		content, thinking strings.Builder
+		calls             = make(map[int]*state.ToolCall)
+		finishReason      string
+		usage             *Usage
+		done              bool
+	)
+
+	handle := func(data []byte) error {
+		if string(data) == "[DONE]" {
+			done = true
+			return nil
+		}
+		var chunk streamChunk
+		if err := json.Unmarshal(data, &chunk); err != nil {
+			return fmt.Errorf("parse stream event: %w", err)
+		}
+		if chunk.Error != nil {
+			pe := NewProviderError(provider, ErrorTypeUnknown, fmt.Sprint(chunk.Error.Code), chunk.Error.Message)
+			pe.Retryable = true
+			return pe
+		}
+		if chunk.Usage != nil {
+			usage = chunk.Usage
+		}
+		for _, choice := range chunk.Choices {
+			delta := Delta{Content: choice.Delta.Content, Thinking: choice.Delta.ReasoningContent + choice.Delta.Reasoning}
+			content.WriteString(delta.Content)
+			thinking.WriteString(delta.Thinking)
+			if delta != (Delta{}) && onDelta != nil {
+				onDelta(delta)
+			}
+			for _, tc := range choice.Delta.ToolCalls {
+				call, ok := calls[tc.Index]
+				if !ok {
+					call = &state.ToolCall{Type: "function"}
+					calls[tc.Index] = call
+				}
+				if tc.ID != "" {
+					call.ID = tc.ID
+				}
+				if tc.Type != "" {
+					call.Type = tc.Type
+				}
+				if tc.Function.Name != "" {
+					call.Function.Name = tc.Function.Name
+				}
+				call.Function.Arguments += tc.Function.Arguments
+			}
+			if choice.FinishReason != "" {
+				finishReason = choice.FinishReason
+			}
+		}
+		return nil
+	}
+
+	// Events are "data:" lines ended by a blank line; comments (":") and
+	// other fields are keep-alives and metadata
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 0, 64*1024), 4*1024*1024)
+	var event [][]byte
+	for scanner.Scan() && !done {
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			if len(event) > 0 {
+				if err := handle(bytes.Join(event, []byte("\n"))); err != nil {
+					return ChatResponse{}, err
+				}
+				event = event[:0]
+			}
+			continue
+		}
+		if data, ok := bytes.CutPrefix(line, []byte("data:")); ok {
+			event = append(event, append([]byte(nil), bytes.TrimPrefix(data, []byte(" "))...))
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return ChatResponse{}, fmt.Errorf("read stream: %w", err)
+	}
+	if len(event) > 0 && !done {
+		if err := handle(bytes.Join(event, []byte("\n"))); err != nil {
+			return ChatResponse{}, err
+		}
+	}
+	if !done && finishReason == "" {
+		pe := NewProviderError(provider, ErrorTypeProviderDown, "stream", "the response stream ended before the reply was complete")
+		pe.Retryable = true
+		return ChatResponse{}, pe
+	}
+
+	message := state.Message{Role: "assistant", Content: content.String(), Thinking: thinking.String()}
+	indexes := make([]int, 0, len(calls))
+	for index := range calls {
+		indexes = append(indexes, index)
+	}
+	sort.Ints(indexes)
+	for _, index := range indexes {
+		message.ToolCalls = append(message.ToolCalls, *calls[index])
+	}
+	return ChatResponse{
+		Choices: []ChatChoice{{Message: message, FinishReason: finishReason}},
+		Usage:   usage,
+	}, nil
+}
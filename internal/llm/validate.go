@@ -0,0 +1,63 @@
+package llm
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// ValidateResponse rejects replies that are obviously broken rather than
+// wrong: no choices, an empty answer that claims to be finished, the same
+// tool call repeated within one message, or tool arguments cut off mid-JSON.
+// The returned error is a retryable ProviderError of type
+// ErrorTypeInvalidResponse.
+func ValidateResponse(provider string, resp ChatResponse) error {
+	if len(resp.Choices) == 0 {
+		return invalidResponse(provider, "no choices returned")
+	}
+	choice := resp.Choices[0]
+	msg := choice.Message
+	if len(msg.ToolCalls) == 0 {
+		if strings.TrimSpace(msg.Content) == "" && (choice.FinishReason == "stop" || choice.FinishReason == "") {
+			return invalidResponse(provider, "empty reply")
+		}
+		return nil
+	}
+
+	seen := make(map[string]bool, len(msg.ToolCalls))
+	for _, call := range msg.ToolCalls {
+		args := strings.TrimSpace(call.Function.Arguments)
+		if args != "" && !json.Valid([]byte(args)) {
+			reason := fmt.Sprintf("tool call %s has malformed JSON arguments", call.Function.Name)
+			if choice.FinishReason == "length" {
+				reason = fmt.Sprintf("tool call %s was cut off at the output limit", call.Function.Name)
+			}
+			return invalidResponse(provider, reason)
+		}
+		key := call.Function.Name + "\x00" + compactJSON(args)
+		if seen[key] {
+			return invalidResponse(provider, fmt.Sprintf("tool call %s repeated with identical arguments", call.Function.Name))
+		}
+		seen[key] = true
+	}
+	return nil
+}
+
+func invalidResponse(provider, message string) *ProviderError {
+	pe := NewProviderError(provider, ErrorTypeInvalidResponse, "", message)
+	pe.Retryable = true
+	return pe
+}
+
+// compactJSON normalizes whitespace so equal arguments compare equal.
+func compactJSON(s string) string {
+	if s == "" {
+		return "{}"
+	}
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, []byte(s)); err != nil {
+		return s
+	}
+	return buf.String()
+}
@@ -0,0 +1,157 @@
+package ollama
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"cando/internal/openai"
+)
+
+// DefaultURL is where a local Ollama server listens.
+const DefaultURL = "http://localhost:11434"
+
+// probeTimeout bounds the model list request, so an absent server never
+// holds up startup or the provider list.
+const probeTimeout = 2 * time.Second
+
+// probeTTL is how long a model list, or the failure to get one, is reused.
+// Callers probe on every provider list.
+const probeTTL = 5 * time.Second
+
+// Client chats through Ollama's OpenAI-compatible endpoint, which needs no
+// API key.
+type Client struct {
+	*openai.Client
+}
+
+// NewClient configures a client for the server at baseURL, e.g.
+// http://localhost:11434.
+func NewClient(baseURL string, timeout time.Duration, logger *log.Logger) *Client {
+	return &Client{openai.NewCompatibleClient("ollama", strings.TrimRight(baseURL, "/")+"/v1", "", timeout, logger)}
+}
+
+// Model is an entry of the model picker, in the shape of
+// openrouter-models.json.
+type Model struct {
+	ID           string   `json:"id"`
+	Name         string   `json:"name"`
+	Capabilities []string `json:"capabilities"`
+}
+
+type probe struct {
+	models []Model
+	err    error
+	at     time.Time
+}
+
+var (
+	probeMu sync.Mutex
+	probes  = map[string]probe{}
+)
+
+// InstalledModels lists the models pulled on the server at baseURL. Results
+// are cached for a few seconds.
+func InstalledModels(baseURL string) ([]Model, error) {
+	baseURL = strings.TrimRight(baseURL, "/")
+	probeMu.Lock()
+	defer probeMu.Unlock()
+	if p, ok := probes[baseURL]; ok && time.Since(p.at) < probeTTL {
+		return p.models, p.err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), probeTimeout)
+	defer cancel()
+	models, err := listModels(ctx, baseURL)
+	probes[baseURL] = probe{models: models, err: err, at: time.Now()}
+	return models, err
+}
+
+// Reachable reports whether an Ollama server answers at baseURL.
+func Reachable(baseURL string) bool {
+	_, err := InstalledModels(baseURL)
+	return err == nil
+}
+
+// HasModel reports whether model is among models. A name without a tag
+// matches its :latest tag, as in the Ollama CLI.
+func HasModel(models []Model, model string) bool {
+	if model == "" {
+		return false
+	}
+	if !strings.Contains(model, ":") {
+		model += ":latest"
+	}
+	for _, m := range models {
+		if m.ID == model {
+			return true
+		}
+	}
+	return false
+}
+
+func listModels(ctx context.Context, baseURL string) ([]Model, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, baseURL+"/api/tags", nil)
+	if err != nil {
+		return nil, fmt.Errorf("build request: %w", err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("read response: %w", err)
+	}
+	if resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("ollama returned %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	var tags struct {
+		Models []struct {
+			Name    string `json:"name"`
+			Details struct {
+				Families      []string `json:"families"`
+				ParameterSize string   `json:"parameter_size"`
+			} `json:"details"`
+		} `json:"models"`
+	}
+	if err := json.Unmarshal(body, &tags); err != nil {
+		return nil, fmt.Errorf("parse response: %w", err)
+	}
+	models := make([]Model, 0, len(tags.Models))
+	for _, m := range tags.Models {
+		name := m.Name
+		if m.Details.ParameterSize != "" {
+			name = fmt.Sprintf("%s (%s)", m.Name, m.Details.ParameterSize)
+		}
+		capabilities := []string{"text"}
+		if isVisionModel(m.Name, m.Details.Families) {
+			capabilities = append(capabilities, "image")
+		}
+		models = append(models, Model{ID: m.Name, Name: name, Capabilities: capabilities})
+	}
+	return models, nil
+}
+
+// isVisionModel guesses image support from the model family, since the tag
+// list does not report capabilities.
+func isVisionModel(name string, families []string) bool {
+	for _, f := range families {
+		if f == "clip" || f == "mllama" {
+			return true
+		}
+	}
+	name = strings.ToLower(name)
+	for _, hint := range []string{"llava", "vision", "-vl", "moondream", "gemma3"} {
+		if strings.Contains(name, hint) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,331 @@
+package openai
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"cando/internal/llm"
+	"cando/internal/logging"
+	"cando/internal/state"
+	"cando/internal/tooling"
+)
+
+// Client wraps the OpenAI chat completions API, either at OpenAI itself or
+// on an Azure OpenAI resource, where the model names a deployment.
+type Client struct {
+	httpClient *http.Client
+	provider   string // "openai", "azure" or a compatible server
+	baseURL    string
+	apiKey     string
+	apiVersion string // Azure only
+	logger     *log.Logger
+}
+
+// NewClient configures a client for OpenAI or a compatible endpoint.
+func NewClient(baseURL, apiKey string, timeout time.Duration, logger *log.Logger) *Client {
+	return newClient("openai", baseURL, apiKey, "", timeout, logger)
+}
+
+// NewCompatibleClient configures a client for another server that speaks
+// the OpenAI API, reporting errors as provider. apiKey may be empty.
+func NewCompatibleClient(provider, baseURL, apiKey string, timeout time.Duration, logger *log.Logger) *Client {
+	return newClient(provider, baseURL, apiKey, "", timeout, logger)
+}
+
+// NewAzureClient configures a client for an Azure OpenAI resource, e.g.
+// https://my-resource.openai.azure.com.
+func NewAzureClient(endpoint, apiKey, apiVersion string, timeout time.Duration, logger *log.Logger) *Client {
+	return newClient("azure", endpoint, apiKey, apiVersion, timeout, logger)
+}
+
+func newClient(provider, baseURL, apiKey, apiVersion string, timeout time.Duration, logger *log.Logger) *Client {
+	if logger == nil {
+		logger = log.Default()
+	}
+	return &Client{
+		httpClient: &http.Client{Timeout: timeout},
+		provider:   provider,
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		apiKey:     apiKey,
+		apiVersion: apiVersion,
+		logger:     logger,
+	}
+}
+
+// chatRequest is the subset of llm.ChatRequest OpenAI accepts: no thinking
+// options, and no reasoning on past messages.
+type chatRequest struct {
+	Model         string                   `json:"model"`
+	Messages      []message                `json:"messages"`
+	Tools         []tooling.ToolDefinition `json:"tools,omitempty"`
+	Temperature   *float64                 `json:"temperature,omitempty"`
+	Stream        bool                     `json:"stream,omitempty"`
+	StreamOptions *streamOptions           `json:"stream_options,omitempty"`
+}
+
+type streamOptions struct {
+	IncludeUsage bool `json:"include_usage"`
+}
+
+type message struct {
+	Role       string           `json:"role"`
+	Content    string           `json:"content"`
+	Name       string           `json:"name,omitempty"`
+	ToolCallID string           `json:"tool_call_id,omitempty"`
+	ToolCalls  []state.ToolCall `json:"tool_calls,omitempty"`
+}
+
+func buildRequest(req llm.ChatRequest) chatRequest {
+	out := chatRequest{Model: req.Model, Tools: req.Tools, Stream: req.Stream}
+	if req.Stream {
+		out.StreamOptions = &streamOptions{IncludeUsage: true}
+	}
+	// Reasoning models only accept the default temperature
+	if req.Temperature != 0 && !IsReasoningModel(req.Model) {
+		temperature := req.Temperature
+		out.Temperature = &temperature
+	}
+	out.Messages = make([]message, 0, len(req.Messages))
+	for _, msg := range req.Messages {
+		out.Messages = append(out.Messages, message{
+			Role:       msg.Role,
+			Content:    msg.Content,
+			Name:       msg.Name,
+			ToolCallID: msg.ToolCallID,
+			ToolCalls:  msg.ToolCalls,
+		})
+	}
+	return out
+}
+
+// IsReasoningModel reports whether model is one of OpenAI's reasoning
+// models (o1, o3, o4 and gpt-5 families).
+func IsReasoningModel(model string) bool {
+	model = strings.ToLower(model)
+	for _, prefix := range []string{"o1", "o3", "o4", "gpt-5"} {
+		if model == prefix || strings.HasPrefix(model, prefix+"-") {
+			return true
+		}
+	}
+	return false
+}
+
+// Chat satisfies the llm.Client interface.
+func (c *Client) Chat(ctx context.Context, reqPayload llm.ChatRequest) (llm.ChatResponse, error) {
+	return c.complete(ctx, reqPayload, nil)
+}
+
+// ChatStream satisfies llm.Streamer, passing content to onDelta as the
+// model generates it.
+func (c *Client) ChatStream(ctx context.Context, reqPayload llm.ChatRequest, onDelta func(llm.Delta)) (llm.ChatResponse, error) {
+	reqPayload.Stream = true
+	return c.complete(ctx, reqPayload, onDelta)
+}
+
+func (c *Client) complete(ctx context.Context, reqPayload llm.ChatRequest, onDelta func(llm.Delta)) (llm.ChatResponse, error) {
+	var respPayload llm.ChatResponse
+
+	payload, err := json.Marshal(buildRequest(reqPayload))
+	if err != nil {
+		return respPayload, fmt.Errorf("marshal request: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.chatURL(reqPayload.Model), bytes.NewReader(payload))
+	if err != nil {
+		return respPayload, fmt.Errorf("build request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	c.authorize(req)
+
+	c.logger.Printf("sending %d messages to %s model %s", len(reqPayload.Messages), c.provider, reqPayload.Model)
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return respPayload, fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	// Errors arrive as plain JSON even when streaming was asked for
+	if resp.StatusCode < 300 && llm.IsEventStream(resp) {
+		respPayload, err = llm.ReadStream(resp.Body, c.provider, onDelta)
+		if err != nil {
+			logging.ErrorLog("%s stream error: %v", c.provider, err)
+		}
+		return respPayload, err
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return respPayload, fmt.Errorf("read response: %w", err)
+	}
+	if resp.StatusCode >= 300 {
+		logging.ErrorLog("%s API error: %d - %s", c.provider, resp.StatusCode, string(body))
+		pe := parseError(c.provider, resp.StatusCode, body)
+		pe.ApplyRetryAfter(resp.Header)
+		return respPayload, pe
+	}
+	if err := json.Unmarshal(body, &respPayload); err != nil {
+		return respPayload, fmt.Errorf("parse response: %w", err)
+	}
+	if len(respPayload.Choices) == 0 {
+		return respPayload, fmt.Errorf("no choices returned")
+	}
+	logging.DevLog("%s: received response with %d choices", c.provider, len(respPayload.Choices))
+	return respPayload, nil
+}
+
+// chatURL returns the completions endpoint; on Azure it is per deployment.
+func (c *Client) chatURL(model string) string {
+	if c.provider != "azure" {
+		return c.baseURL + "/chat/completions"
+	}
+	return fmt.Sprintf("%s/openai/deployments/%s/chat/completions?api-version=%s",
+		c.baseURL, url.PathEscape(model), url.QueryEscape(c.apiVersion))
+}
+
+func (c *Client) authorize(req *http.Request) {
+	if c.provider == "azure" {
+		req.Header.Set("api-key", c.apiKey)
+		return
+	}
+	if c.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+c.apiKey)
+	}
+}
+
+// Model is an entry of the model picker, in the shape of
+// openrouter-models.json.
+type Model struct {
+	ID           string   `json:"id"`
+	Name         string   `json:"name"`
+	Capabilities []string `json:"capabilities"`
+}
+
+// ListModels returns the account's chat models, newest first. Azure
+// resources list deployments through the management API only, so there the
+// caller has to fall back to configured deployment names.
+func (c *Client) ListModels(ctx context.Context) ([]Model, error) {
+	if c.provider == "azure" {
+		return nil, fmt.Errorf("azure deployments cannot be listed with an API key")
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+"/models", nil)
+	if err != nil {
+		return nil, fmt.Errorf("build request: %w", err)
+	}
+	c.authorize(req)
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("read response: %w", err)
+	}
+	if resp.StatusCode >= 300 {
+		return nil, parseError(c.provider, resp.StatusCode, body)
+	}
+	var list struct {
+		Data []struct {
+			ID      string `json:"id"`
+			Created int64  `json:"created"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(body, &list); err != nil {
+		return nil, fmt.Errorf("parse response: %w", err)
+	}
+	sort.SliceStable(list.Data, func(i, j int) bool { return list.Data[i].Created > list.Data[j].Created })
+	var models []Model
+	for _, m := range list.Data {
+		if IsChatModel(m.ID) {
+			models = append(models, ModelEntry(m.ID))
+		}
+	}
+	return models, nil
+}
+
+// IsChatModel reports whether id names a model that serves chat
+// completions, leaving out embeddings, audio, image and moderation models.
+func IsChatModel(id string) bool {
+	id = strings.ToLower(id)
+	if !strings.HasPrefix(id, "gpt-") && !strings.HasPrefix(id, "chatgpt-") && !IsReasoningModel(id) {
+		return false
+	}
+	for _, skip := range []string{"audio", "realtime", "transcribe", "tts", "image", "search", "instruct"} {
+		if strings.Contains(id, skip) {
+			return false
+		}
+	}
+	return true
+}
+
+// ModelEntry describes id for the model picker.
+func ModelEntry(id string) Model {
+	capabilities := []string{"text"}
+	if !strings.HasPrefix(id, "gpt-3.5") {
+		capabilities = append(capabilities, "image")
+	}
+	return Model{ID: id, Name: id, Capabilities: capabilities}
+}
+
+// parseError converts an error response to a structured ProviderError.
+// Format: {"error":{"message":"...","type":"...","code":"..."}}
+func parseError(provider string, statusCode int, body []byte) *llm.ProviderError {
+	pe := &llm.ProviderError{
+		Provider: provider,
+		Code:     strconv.Itoa(statusCode),
+		Message:  strings.TrimSpace(string(body)),
+	}
+	var errResp struct {
+		Error struct {
+			Message string `json:"message"`
+			Type    string `json:"type"`
+			Code    any    `json:"code"`
+		} `json:"error"`
+	}
+	errCode := ""
+	if err := json.Unmarshal(body, &errResp); err == nil && errResp.Error.Message != "" {
+		pe.Message = errResp.Error.Message
+		if errResp.Error.Code != nil {
+			errCode = fmt.Sprint(errResp.Error.Code)
+			pe.Code = errCode
+		}
+	}
+
+	switch {
+	case errCode == "insufficient_quota":
+		pe.Type = llm.ErrorTypeInsufficientCredit
+		pe.Retryable = false
+	case errCode == "content_filter" || statusCode == 403:
+		pe.Type = llm.ErrorTypeModeration
+		pe.Retryable = false
+	case statusCode == 401:
+		pe.Type = llm.ErrorTypeAuth
+		pe.Retryable = false
+		if pe.Message == "" {
+			pe.Message = "Invalid API key. Please check your " + provider + " credentials."
+		}
+	case statusCode == 429:
+		pe.Type = llm.ErrorTypeRateLimit
+		pe.Retryable = true
+		delay := 20 * time.Second
+		pe.RetryAfter = &delay
+	case statusCode == 502 || statusCode == 503:
+		pe.Type = llm.ErrorTypeProviderDown
+		pe.Retryable = true
+		delay := 10 * time.Second
+		pe.RetryAfter = &delay
+	default:
+		pe.Type = llm.ErrorTypeUnknown
+		pe.Retryable = statusCode >= 500
+	}
+	return pe
+}
@@ -37,6 +37,17 @@ func NewClient(baseURL, apiKey string, timeout time.Duration, logger *log.Logger
 
 // Chat executes a single completion request.
 func (c *Client) Chat(ctx context.Context, reqPayload llm.ChatRequest) (llm.ChatResponse, error) {
+	return c.complete(ctx, reqPayload, nil)
+}
+
+// ChatStream satisfies llm.Streamer, passing content and reasoning to
+// onDelta as the model generates them.
+func (c *Client) ChatStream(ctx context.Context, reqPayload llm.ChatRequest, onDelta func(llm.Delta)) (llm.ChatResponse, error) {
+	reqPayload.Stream = true
+	return c.complete(ctx, reqPayload, onDelta)
+}
+
+func (c *Client) complete(ctx context.Context, reqPayload llm.ChatRequest, onDelta func(llm.Delta)) (llm.ChatResponse, error) {
 	var respPayload llm.ChatResponse
 
 	payload, err := json.Marshal(reqPayload)
@@ -63,13 +74,26 @@ func (c *Client) Chat(ctx context.Context, reqPayload llm.ChatRequest) (llm.Chat
 	}
 	defer resp.Body.Close()
 
+	// Errors arrive as plain JSON even when streaming was asked for
+	if resp.StatusCode < 300 && llm.IsEventStream(resp) {
+		respPayload, err = llm.ReadStream(resp.Body, "openrouter", onDelta)
+		if err != nil {
+			logging.ErrorLog("openrouter stream error: %v", err)
+			return respPayload, err
+		}
+		logging.DevLog("openrouter: streamed response finished (%s)", respPayload.Choices[0].FinishReason)
+		return respPayload, nil
+	}
+
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
 		return respPayload, fmt.Errorf("read response: %w", err)
 	}
 	if resp.StatusCode >= 300 {
 		logging.ErrorLog("openrouter API error: %d - %s", resp.StatusCode, string(body))
-		return respPayload, parseOpenRouterError(resp.StatusCode, body)
+		pe := parseOpenRouterError(resp.StatusCode, body)
+		pe.ApplyRetryAfter(resp.Header)
+		return respPayload, pe
 	}
 
 	if err := json.Unmarshal(body, &respPayload); err != nil {
@@ -169,3 +193,74 @@ func parseOpenRouterError(statusCode int, body []byte) *llm.ProviderError {
 
 	return pe
 }
+
+// AccountStatus reports the key's spend limit, or the account's remaining
+// credits when the key itself is unlimited.
+func (c *Client) AccountStatus(ctx context.Context) (*llm.AccountStatus, error) {
+	var key struct {
+		Data struct {
+			Usage          float64  `json:"usage"`
+			Limit          *float64 `json:"limit"`
+			LimitRemaining *float64 `json:"limit_remaining"`
+			IsFreeTier     bool     `json:"is_free_tier"`
+		} `json:"data"`
+	}
+	if err := c.getJSON(ctx, "/key", &key); err != nil {
+		return nil, err
+	}
+	status := &llm.AccountStatus{
+		Provider:  "openrouter",
+		Unit:      "usd",
+		Used:      key.Data.Usage,
+		FreeTier:  key.Data.IsFreeTier,
+		FetchedAt: time.Now(),
+	}
+	if key.Data.Limit != nil {
+		used := key.Data.Usage
+		if key.Data.LimitRemaining != nil {
+			used = *key.Data.Limit - *key.Data.LimitRemaining
+		}
+		status.SetLimit(*key.Data.Limit, used)
+		return status, nil
+	}
+
+	var credits struct {
+		Data struct {
+			TotalCredits float64 `json:"total_credits"`
+			TotalUsage   float64 `json:"total_usage"`
+		} `json:"data"`
+	}
+	if err := c.getJSON(ctx, "/credits", &credits); err != nil {
+		// Credits need a provisioning-capable key; the key usage alone is still useful
+		c.logger.Printf("openrouter credits lookup failed: %v", err)
+		return status, nil
+	}
+	if !key.Data.IsFreeTier || credits.Data.TotalCredits > 0 {
+		status.SetLimit(credits.Data.TotalCredits, credits.Data.TotalUsage)
+	}
+	return status, nil
+}
+
+func (c *Client) getJSON(ctx context.Context, path string, out any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+path, nil)
+	if err != nil {
+		return fmt.Errorf("build request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+c.apiKey)
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("read response: %w", err)
+	}
+	if resp.StatusCode >= 300 {
+		return parseOpenRouterError(resp.StatusCode, body)
+	}
+	if err := json.Unmarshal(body, out); err != nil {
+		return fmt.Errorf("parse response: %w", err)
+	}
+	return nil
+}
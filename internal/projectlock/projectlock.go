@@ -0,0 +1,215 @@
+// Package projectlock keeps two Cando processes from using the same project
+// storage at once, which would corrupt conversations and memory.db. It takes
+// an advisory lock on a file in the storage root; the operating system
+// releases it when the process exits, so a crash never leaves a stale lock.
+package projectlock
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FileName is the lock file created in each project storage root.
+const FileName = "cando.lock"
+
+// errWouldBlock is returned by lockFile when another process holds the lock.
+var errWouldBlock = errors.New("lock held by another process")
+
+// Holder describes the process holding a lock.
+type Holder struct {
+	PID     int       `json:"pid"`
+	Host    string    `json:"host"`
+	Command string    `json:"command"`
+	Started time.Time `json:"started"`
+}
+
+func (h Holder) String() string {
+	s := fmt.Sprintf("pid %d on %s, %q", h.PID, h.Host, h.Command)
+	if !h.Started.IsZero() {
+		s += ", since " + h.Started.Format(time.RFC3339)
+	}
+	return s
+}
+
+// LockedError reports that another process holds the lock.
+type LockedError struct {
+	Dir    string
+	Holder Holder
+}
+
+func (e *LockedError) Error() string {
+	return fmt.Sprintf("another Cando instance is using %s (%s); stop it first, or start with --force-takeover", e.Dir, e.Holder)
+}
+
+// TakenOverError reports that another process took over a lock this one
+// holds, with --force-takeover.
+type TakenOverError struct {
+	Dir    string
+	Holder Holder
+}
+
+func (e *TakenOverError) Error() string {
+	return fmt.Sprintf("another Cando instance took over %s (%s); this instance no longer uses it, restart it once the other one has stopped", e.Dir, e.Holder)
+}
+
+// Lock is a held project lock. Locks on the same directory within one
+// process are shared and counted.
+type Lock struct {
+	dir    string
+	file   *os.File
+	refs   int
+	record []byte          // Holder record this process wrote
+	taken  *TakenOverError // Set once another process took the lock over
+	// Displaced is the holder that was ignored when the lock was taken over.
+	Displaced *Holder
+}
+
+var (
+	mu   sync.Mutex
+	held = make(map[string]*Lock)
+	// lost remembers directories taken over from this process, so it does
+	// not reclaim them once their lock is released.
+	lost = make(map[string]*TakenOverError)
+)
+
+// Acquire locks the project storage root dir. It fails with a *LockedError
+// when another process holds the lock, unless takeover is set; then it goes
+// ahead without the lock and records the displaced holder. A directory
+// another process took over from this one fails with its *TakenOverError,
+// unless takeover is set.
+func Acquire(dir string, takeover bool) (*Lock, error) {
+	dir = filepath.Clean(dir)
+	mu.Lock()
+	defer mu.Unlock()
+	if l := held[dir]; l != nil {
+		l.refs++
+		return l, nil
+	}
+	if e := lost[dir]; e != nil && !takeover {
+		return nil, e
+	}
+	f, err := os.OpenFile(filepath.Join(dir, FileName), os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("open lock file: %w", err)
+	}
+	l := &Lock{dir: dir, file: f, refs: 1}
+	if err := lockFile(f); err != nil {
+		if !errors.Is(err, errWouldBlock) {
+			f.Close()
+			return nil, fmt.Errorf("lock %s: %w", dir, err)
+		}
+		holder := readHolder(f)
+		if !takeover {
+			f.Close()
+			return nil, &LockedError{Dir: dir, Holder: holder}
+		}
+		l.Displaced = &holder
+	}
+	l.record = writeHolder(f)
+	held[dir] = l
+	return l, nil
+}
+
+// AcquireWithin is Acquire, retrying for up to wait while another process
+// holds the lock. A restarting instance uses it to wait out its predecessor,
+// which on Windows exits only after starting its replacement.
+func AcquireWithin(dir string, takeover bool, wait time.Duration) (*Lock, error) {
+	deadline := time.Now().Add(wait)
+	for {
+		l, err := Acquire(dir, takeover && !time.Now().Before(deadline))
+		var locked *LockedError
+		if !errors.As(err, &locked) || !time.Now().Before(deadline) {
+			return l, err
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+// Release drops one reference to the lock and unlocks it with the last.
+func (l *Lock) Release() {
+	if l == nil {
+		return
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	l.refs--
+	if l.refs > 0 {
+		return
+	}
+	if held[l.dir] == l {
+		delete(held, l.dir)
+	}
+	if taken := l.checkLocked(); taken != nil {
+		lost[l.dir] = taken
+	} else if l.Displaced == nil {
+		l.file.Truncate(0)
+	}
+	unlockFile(l.file)
+	l.file.Close()
+}
+
+// Check returns a *TakenOverError once another process has taken the lock
+// over, and nil while the holder record is still this process's. Callers
+// check before using the storage and stop using it on an error; the
+// takeover is permanent for this Lock.
+func (l *Lock) Check() error {
+	if l == nil {
+		return nil
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if err := l.checkLocked(); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (l *Lock) checkLocked() *TakenOverError {
+	if l.taken != nil || l.record == nil {
+		return l.taken
+	}
+	data := make([]byte, len(l.record)+1)
+	n, err := l.file.ReadAt(data, 0)
+	if err != nil && !errors.Is(err, io.EOF) || bytes.Equal(data[:n], l.record) {
+		return nil
+	}
+	holder := readHolder(l.file)
+	l.taken = &TakenOverError{Dir: l.dir, Holder: holder}
+	return l.taken
+}
+
+func readHolder(f *os.File) Holder {
+	var holder Holder
+	if _, err := f.Seek(0, io.SeekStart); err == nil {
+		data, _ := io.ReadAll(io.LimitReader(f, 4096))
+		json.Unmarshal(data, &holder)
+	}
+	return holder
+}
+
+// writeHolder records this process in the lock file, for error messages and
+// for Check, and returns the record.
+func writeHolder(f *os.File) []byte {
+	host, _ := os.Hostname()
+	command := strings.Join(os.Args, " ")
+	if len(command) > 200 {
+		command = command[:200] + "…"
+	}
+	data, err := json.Marshal(Holder{PID: os.Getpid(), Host: host, Command: command, Started: time.Now().UTC()})
+	if err != nil {
+		return nil
+	}
+	f.Truncate(0)
+	if _, err := f.WriteAt(data, 0); err != nil {
+		return nil
+	}
+	return data
+}
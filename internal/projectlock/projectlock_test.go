@@ -0,0 +1,108 @@
+package projectlock
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAcquireSharedWithinProcess(t *testing.T) {
+	dir := t.TempDir()
+	first, err := Acquire(dir, false)
+	if err != nil {
+		t.Fatalf("acquire: %v", err)
+	}
+	second, err := Acquire(dir, false)
+	if err != nil {
+		t.Fatalf("second acquire in the same process: %v", err)
+	}
+	if first != second {
+		t.Fatal("expected the same lock to be shared")
+	}
+	data, err := os.ReadFile(filepath.Join(dir, FileName))
+	if err != nil || !strings.Contains(string(data), `"pid"`) {
+		t.Fatalf("lock file should name the holder, got %q (%v)", data, err)
+	}
+
+	first.Release()
+	if held[filepath.Clean(dir)] == nil {
+		t.Fatal("lock released while still referenced")
+	}
+	second.Release()
+	if held[filepath.Clean(dir)] != nil {
+		t.Fatal("lock still registered after the last release")
+	}
+	again, err := Acquire(dir, false)
+	if err != nil {
+		t.Fatalf("reacquire after release: %v", err)
+	}
+	again.Release()
+}
+
+func TestLockedError(t *testing.T) {
+	err := error(&LockedError{Dir: "/data/proj", Holder: Holder{PID: 42, Host: "box", Command: "cando"}})
+	var locked *LockedError
+	if !errors.As(err, &locked) {
+		t.Fatal("expected a *LockedError")
+	}
+	msg := err.Error()
+	for _, want := range []string{"another Cando instance", "/data/proj", "pid 42", "--force-takeover"} {
+		if !strings.Contains(msg, want) {
+			t.Errorf("error %q does not mention %q", msg, want)
+		}
+	}
+}
+
+func TestDisplacedHolderNoticesTakeover(t *testing.T) {
+	dir := t.TempDir()
+	first, err := Acquire(dir, false)
+	if err != nil {
+		t.Fatalf("acquire: %v", err)
+	}
+	if err := first.Check(); err != nil {
+		t.Fatalf("check before takeover: %v", err)
+	}
+
+	// Forget the first lock so the next Acquire opens the file again, as
+	// another process would
+	mu.Lock()
+	delete(held, filepath.Clean(dir))
+	mu.Unlock()
+	var locked *LockedError
+	if _, err := Acquire(dir, false); !errors.As(err, &locked) {
+		t.Fatalf("second holder without takeover: %v", err)
+	}
+	second, err := Acquire(dir, true)
+	if err != nil || second.Displaced == nil {
+		t.Fatalf("takeover = %+v, %v", second, err)
+	}
+
+	var taken *TakenOverError
+	if err := first.Check(); !errors.As(err, &taken) || taken.Holder.PID != os.Getpid() {
+		t.Fatalf("displaced holder check = %v", err)
+	}
+	if err := second.Check(); err != nil {
+		t.Fatalf("new holder check: %v", err)
+	}
+
+	// The displaced holder leaves the new holder's record in place
+	first.Release()
+	if err := second.Check(); err != nil {
+		t.Fatalf("new holder check after the old one released: %v", err)
+	}
+	data, _ := os.ReadFile(filepath.Join(dir, FileName))
+	if !strings.Contains(string(data), `"pid"`) {
+		t.Fatalf("holder record removed: %q", data)
+	}
+
+	// Nor does it take the directory back once the file is unlocked
+	mu.Lock()
+	delete(held, filepath.Clean(dir))
+	mu.Unlock()
+	if _, err := Acquire(dir, false); !errors.As(err, &taken) {
+		t.Fatalf("reacquire by the displaced holder = %v", err)
+	}
+	second.Release()
+}
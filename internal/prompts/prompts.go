@@ -12,6 +12,21 @@ var baseSystemPrompt string
 //go:embed system_facts_extraction.txt
 var factsExtractionPrompt string
 
+//go:embed system_docs_ingest.txt
+var docsIngestPrompt string
+
+//go:embed system_moderation.txt
+var moderationPrompt string
+
+//go:embed system_chunk_analysis.txt
+var chunkAnalysisPrompt string
+
+//go:embed system_explain.txt
+var explainPrompt string
+
+//go:embed system_session_title.txt
+var sessionTitlePrompt string
+
 var (
 	metadataMu sync.RWMutex
 	metadata   string
@@ -27,6 +42,33 @@ func FactsExtraction() string {
 	return strings.TrimSpace(factsExtractionPrompt)
 }
 
+// DocsIngest returns the prompt for extracting project facts from docs.
+func DocsIngest() string {
+	return strings.TrimSpace(docsIngestPrompt)
+}
+
+// Moderation returns the prompt for the optional content policy reviewer.
+func Moderation() string {
+	return strings.TrimSpace(moderationPrompt)
+}
+
+// ChunkAnalysis returns the prompt for reading one window of a large file.
+func ChunkAnalysis() string {
+	return strings.TrimSpace(chunkAnalysisPrompt)
+}
+
+// SessionTitle returns the prompt for naming a session after its first
+// exchange.
+func SessionTitle() string {
+	return strings.TrimSpace(sessionTitlePrompt)
+}
+
+// Explain returns the prompt for exploring a workspace and writing its
+// onboarding overview.
+func Explain() string {
+	return strings.TrimSpace(explainPrompt)
+}
+
 // Combine joins the built-in prompt with an optional user-provided prompt.
 func Combine(user string) string {
 	base := Base()
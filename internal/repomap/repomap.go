@@ -0,0 +1,320 @@
+// Package repomap builds a compressed overview of a repository: the files
+// that matter most and the signatures of the symbols they define, ranked by
+// how often other files refer to them and cut to a token budget.
+//
+// Maps are refreshed incrementally: only files whose size or modification
+// time changed since the last scan are parsed again.
+package repomap
+
+import (
+	"fmt"
+	"io/fs"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// charsPerToken matches the conservative 3:1 estimate used elsewhere.
+	charsPerToken = 3
+	// maxFiles and maxFileBytes bound the work done on huge repositories.
+	maxFiles     = 3000
+	maxEntries   = 50000 // Directory entries visited, source or not
+	maxFileBytes = 256 * 1024
+	// minRefreshInterval keeps repeated lookups within one turn from
+	// rescanning the tree.
+	minRefreshInterval = 2 * time.Second
+	maxSignatureChars  = 160
+)
+
+// skipDirs are never scanned: dependencies, build output and VCS metadata.
+var skipDirs = map[string]bool{
+	".git": true, ".hg": true, ".svn": true, "node_modules": true, "vendor": true,
+	"dist": true, "build": true, "target": true, "out": true, ".venv": true,
+	"venv": true, "__pycache__": true, ".next": true, ".cache": true, ".idea": true,
+	".vscode": true, "bin": true, "obj": true, ".gradle": true, "Pods": true,
+}
+
+// SkipDir reports whether a directory name holds dependencies or build
+// output rather than project source.
+func SkipDir(name string) bool {
+	return skipDirs[name] || (strings.HasPrefix(name, ".") && name != ".github" && name != ".")
+}
+
+// Symbol is a top-level definition in a source file.
+type Symbol struct {
+	Name      string
+	Signature string
+	Line      int
+}
+
+type fileEntry struct {
+	size    int64
+	modTime time.Time
+	symbols []Symbol
+	idents  map[string]struct{}
+}
+
+// Map is the repository map of one workspace.
+type Map struct {
+	root string
+
+	mu          sync.Mutex
+	files       map[string]*fileEntry // Keyed by slash-separated relative path
+	refs        map[string]int        // Symbol name -> number of files mentioning it
+	defs        map[string]int        // Symbol name -> number of definitions
+	truncated   bool
+	refreshedAt time.Time
+}
+
+var (
+	mapsMu sync.Mutex
+	maps   = make(map[string]*Map)
+)
+
+// ForRoot returns the shared map for a workspace root, so the context
+// injection and the repo_map tool reuse the same incremental state.
+func ForRoot(root string) *Map {
+	root = filepath.Clean(root)
+	mapsMu.Lock()
+	defer mapsMu.Unlock()
+	m, ok := maps[root]
+	if !ok {
+		m = New(root)
+		maps[root] = m
+	}
+	return m
+}
+
+// New creates an empty map for root; call Refresh before rendering.
+func New(root string) *Map {
+	return &Map{root: filepath.Clean(root), files: make(map[string]*fileEntry)}
+}
+
+// Refresh rescans the tree, parsing only new and changed files.
+func (m *Map) Refresh() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if time.Since(m.refreshedAt) < minRefreshInterval {
+		return nil
+	}
+
+	seen := make(map[string]bool, len(m.files))
+	changed := false
+	truncated := false
+	entries := 0
+	err := filepath.WalkDir(m.root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if entries++; entries > maxEntries {
+			truncated = true
+			return filepath.SkipAll
+		}
+		if d.IsDir() {
+			if path != m.root && SkipDir(d.Name()) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		lang := languageOf(d.Name())
+		if lang == "" || !d.Type().IsRegular() {
+			return nil
+		}
+		if len(seen) >= maxFiles {
+			truncated = true
+			return filepath.SkipAll
+		}
+		info, err := d.Info()
+		if err != nil || info.Size() > maxFileBytes {
+			return nil
+		}
+		rel, err := filepath.Rel(m.root, path)
+		if err != nil {
+			return nil
+		}
+		rel = filepath.ToSlash(rel)
+		seen[rel] = true
+		if entry, ok := m.files[rel]; ok && entry.size == info.Size() && entry.modTime.Equal(info.ModTime()) {
+			return nil
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil
+		}
+		m.files[rel] = &fileEntry{
+			size:    info.Size(),
+			modTime: info.ModTime(),
+			symbols: extractSymbols(lang, data),
+			idents:  identifiers(data),
+		}
+		changed = true
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for rel := range m.files {
+		if !seen[rel] {
+			delete(m.files, rel)
+			changed = true
+		}
+	}
+	if changed || m.refs == nil {
+		m.refs, m.defs = countReferences(m.files)
+	}
+	m.truncated = truncated
+	m.refreshedAt = time.Now()
+	return nil
+}
+
+// countReferences counts, for every defined symbol name, how many files
+// mention it and how many times it is defined.
+func countReferences(files map[string]*fileEntry) (refs, defs map[string]int) {
+	refs = make(map[string]int)
+	defs = make(map[string]int)
+	for _, entry := range files {
+		for _, sym := range entry.symbols {
+			refs[sym.Name] = 0
+			defs[sym.Name]++
+		}
+	}
+	for _, entry := range files {
+		for ident := range entry.idents {
+			if _, ok := refs[ident]; ok {
+				refs[ident]++
+			}
+		}
+	}
+	return refs, defs
+}
+
+// Options controls rendering.
+type Options struct {
+	// MaxTokens is the output budget, estimated at three characters per token.
+	MaxTokens int
+	// Focus is free text, typically the user's latest message. Files and
+	// symbols it names are ranked first.
+	Focus string
+	// Path restricts the map to files under this slash-separated prefix.
+	Path string
+}
+
+type candidate struct {
+	file  string
+	sym   Symbol
+	score float64
+}
+
+// Render returns the ranked map within the token budget. Files are listed
+// in rank order with their most referenced symbols in source order.
+func (m *Map) Render(opts Options) string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if opts.MaxTokens <= 0 || len(m.files) == 0 {
+		return ""
+	}
+	budget := opts.MaxTokens * charsPerToken
+	focus := strings.ToLower(opts.Focus)
+	prefix := strings.Trim(filepath.ToSlash(opts.Path), "/")
+
+	fileScores := make(map[string]float64)
+	var candidates []candidate
+	for rel, entry := range m.files {
+		if prefix != "" && rel != prefix && !strings.HasPrefix(rel, prefix+"/") {
+			continue
+		}
+		boost := 1.0
+		if focus != "" && mentions(focus, rel) {
+			boost = 10
+		}
+		fileScores[rel] = 0
+		for _, sym := range entry.symbols {
+			// References from other files; the defining file always mentions
+			// it. Names defined in many places (New, Error, String) say
+			// little about any one of them, so their weight is shared.
+			others := m.refs[sym.Name] - 1
+			score := (1 + math.Log2(1+float64(max(others, 0)))) / float64(max(m.defs[sym.Name], 1)) * boost
+			if focus != "" && len(sym.Name) > 3 && strings.Contains(focus, strings.ToLower(sym.Name)) {
+				score *= 10
+			}
+			fileScores[rel] += score
+			candidates = append(candidates, candidate{file: rel, sym: sym, score: score})
+		}
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].score != candidates[j].score {
+			return candidates[i].score > candidates[j].score
+		}
+		if candidates[i].file != candidates[j].file {
+			return candidates[i].file < candidates[j].file
+		}
+		return candidates[i].sym.Line < candidates[j].sym.Line
+	})
+
+	chosen := make(map[string][]Symbol)
+	used := 0
+	for _, c := range candidates {
+		cost := len(c.sym.Signature) + 4
+		if _, ok := chosen[c.file]; !ok {
+			cost += len(c.file) + 2
+		}
+		if used+cost > budget {
+			continue
+		}
+		used += cost
+		chosen[c.file] = append(chosen[c.file], c.sym)
+	}
+
+	files := make([]string, 0, len(chosen))
+	for rel := range chosen {
+		files = append(files, rel)
+	}
+	sort.Slice(files, func(i, j int) bool {
+		if fileScores[files[i]] != fileScores[files[j]] {
+			return fileScores[files[i]] > fileScores[files[j]]
+		}
+		return files[i] < files[j]
+	})
+
+	var b strings.Builder
+	for _, rel := range files {
+		syms := chosen[rel]
+		sort.Slice(syms, func(i, j int) bool { return syms[i].Line < syms[j].Line })
+		b.WriteString(rel + ":\n")
+		for _, sym := range syms {
+			b.WriteString("  " + sym.Signature + "\n")
+		}
+	}
+	if omitted := len(fileScores) - len(files); omitted > 0 {
+		fmt.Fprintf(&b, "(%d more files not shown)\n", omitted)
+	}
+	if m.truncated {
+		b.WriteString("(large repository; only part of the tree was indexed)\n")
+	}
+	return b.String()
+}
+
+// Stats reports how many files and symbols are indexed.
+func (m *Map) Stats() (files, symbols int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, entry := range m.files {
+		symbols += len(entry.symbols)
+	}
+	return len(m.files), symbols
+}
+
+// mentions reports whether focus text names a file by path or base name.
+func mentions(focus, rel string) bool {
+	lower := strings.ToLower(rel)
+	if strings.Contains(focus, lower) {
+		return true
+	}
+	base := lower[strings.LastIndex(lower, "/")+1:]
+	return len(base) > 4 && strings.Contains(focus, base)
+}
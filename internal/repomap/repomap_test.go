@@ -0,0 +1,103 @@
+package repomap
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeFiles(t *testing.T, root string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestRenderRanksReferencedSymbols(t *testing.T) {
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{
+		"store/store.go":            "package store\n\n// Store keeps records.\ntype Store struct{ items map[string]any }\n\nfunc NewStore() *Store {\n\treturn &Store{}\n}\n\nfunc (s *Store) Get(key string) (any, bool) {\n\tv, ok := s.items[key]\n\treturn v, ok\n}\n\nfunc rarelyUsedHelper(v interface{}) {}\n",
+		"api/handler.go":            "package api\n\nfunc Handle() { s := store.NewStore(); s.Get(\"x\") }\n",
+		"cli/cli.go":                "package cli\n\nfunc Run() { store.NewStore() }\n",
+		"tools/gen.py":              "import os\n\nclass Generator:\n    def run(self, path):\n        pass\n\ndef _private():\n    pass\n",
+		"web/app.ts":                "export function renderApp(root: HTMLElement): void {\n}\nexport const VERSION = '1';\n",
+		"node_modules/dep/index.js": "export function ignored() {}\n",
+	})
+
+	m := New(root)
+	if err := m.Refresh(); err != nil {
+		t.Fatal(err)
+	}
+	out := m.Render(Options{MaxTokens: 1000})
+	if strings.Contains(out, "ignored") || strings.Contains(out, "_private") {
+		t.Errorf("map includes skipped code:\n%s", out)
+	}
+	for _, want := range []string{
+		"store/store.go:\n  type Store struct\n  func NewStore() *Store\n  func (s *Store) Get(key string) (any, bool)\n  func rarelyUsedHelper(v interface{})\n",
+		"tools/gen.py:\n  class Generator\n  def run(self, path)\n",
+		"web/app.ts:\n  export function renderApp(root: HTMLElement): void\n  export const VERSION = '1'\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("map missing %q:\n%s", want, out)
+		}
+	}
+	if !strings.HasPrefix(out, "store/store.go:") {
+		t.Errorf("most referenced file should come first:\n%s", out)
+	}
+
+	// A tight budget keeps the most referenced symbol
+	small := m.Render(Options{MaxTokens: 15})
+	if !strings.Contains(small, "func NewStore() *Store") || strings.Contains(small, "rarelyUsedHelper") {
+		t.Errorf("small map:\n%s", small)
+	}
+
+	// Focus text lifts the files it names
+	focused := m.Render(Options{MaxTokens: 1000, Focus: "fix the bug in gen.py"})
+	if !strings.HasPrefix(focused, "tools/gen.py:") {
+		t.Errorf("focused map should start with gen.py:\n%s", focused)
+	}
+	if only := m.Render(Options{MaxTokens: 1000, Path: "web"}); !strings.HasPrefix(only, "web/app.ts:") || strings.Contains(only, "store.go") {
+		t.Errorf("path-restricted map:\n%s", only)
+	}
+}
+
+func TestRefreshIsIncremental(t *testing.T) {
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{
+		"a.go": "package a\n\nfunc First() {}\n",
+		"b.go": "package a\n\nfunc Second() {}\n",
+	})
+	m := New(root)
+	if err := m.Refresh(); err != nil {
+		t.Fatal(err)
+	}
+	writeFiles(t, root, map[string]string{"a.go": "package a\n\nfunc Renamed(x int) {}\n"})
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(filepath.Join(root, "a.go"), later, later); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(filepath.Join(root, "b.go")); err != nil {
+		t.Fatal(err)
+	}
+	writeFiles(t, root, map[string]string{"c.go": "package a\n\nfunc Third() {}\n"})
+
+	m.refreshedAt = time.Time{} // Skip the refresh throttle
+	if err := m.Refresh(); err != nil {
+		t.Fatal(err)
+	}
+	out := m.Render(Options{MaxTokens: 1000})
+	if !strings.Contains(out, "func Renamed(x int)") || strings.Contains(out, "First") {
+		t.Errorf("changed file not reparsed:\n%s", out)
+	}
+	if strings.Contains(out, "Second") || !strings.Contains(out, "func Third()") {
+		t.Errorf("removed or added file not reflected:\n%s", out)
+	}
+}
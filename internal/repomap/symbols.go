@@ -0,0 +1,187 @@
+package repomap
+
+import (
+	"bytes"
+	"go/ast"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+var extLanguages = map[string]string{
+	".go": "go", ".py": "python", ".js": "js", ".jsx": "js", ".mjs": "js",
+	".ts": "js", ".tsx": "js", ".rs": "rust", ".java": "java", ".kt": "java",
+	".cs": "java", ".scala": "java", ".swift": "swift", ".rb": "ruby", ".php": "php",
+	".c": "c", ".h": "c", ".cpp": "c", ".cc": "c", ".hpp": "c",
+}
+
+func languageOf(name string) string {
+	if strings.HasSuffix(name, ".min.js") || strings.HasSuffix(name, ".pb.go") {
+		return "" // Generated code crowds out what people actually edit
+	}
+	if isTestFile(name) {
+		return ""
+	}
+	return extLanguages[strings.ToLower(filepath.Ext(name))]
+}
+
+// isTestFile reports test sources, which define helpers nobody else calls.
+func isTestFile(name string) bool {
+	lower := strings.ToLower(name)
+	return strings.HasSuffix(lower, "_test.go") || strings.HasPrefix(lower, "test_") ||
+		strings.HasSuffix(lower, "_test.py") || strings.Contains(lower, ".test.") || strings.Contains(lower, ".spec.")
+}
+
+// symbolPatterns find top-level definitions in languages parsed by regex.
+// The first capture group is the symbol name; the matched line, trimmed,
+// is its signature.
+var symbolPatterns = map[string][]*regexp.Regexp{
+	"python": {
+		regexp.MustCompile(`^(?:async\s+)?def\s+([A-Za-z_]\w*)`),
+		regexp.MustCompile(`^class\s+([A-Za-z_]\w*)`),
+		regexp.MustCompile(`^    (?:async\s+)?def\s+([A-Za-z_]\w*)`),
+	},
+	"js": {
+		regexp.MustCompile(`^(?:export\s+)?(?:default\s+)?(?:async\s+)?function\*?\s+([A-Za-z_$][\w$]*)`),
+		regexp.MustCompile(`^(?:export\s+)?(?:default\s+)?(?:abstract\s+)?class\s+([A-Za-z_$][\w$]*)`),
+		regexp.MustCompile(`^(?:export\s+)?(?:interface|type|enum)\s+([A-Za-z_$][\w$]*)`),
+		regexp.MustCompile(`^export\s+(?:const|let|var)\s+([A-Za-z_$][\w$]*)`),
+	},
+	"rust": {
+		regexp.MustCompile(`^\s*(?:pub(?:\([^)]*\))?\s+)?(?:async\s+)?(?:unsafe\s+)?fn\s+([A-Za-z_]\w*)`),
+		regexp.MustCompile(`^(?:pub(?:\([^)]*\))?\s+)?(?:struct|enum|trait|type|union)\s+([A-Za-z_]\w*)`),
+		regexp.MustCompile(`^impl(?:<[^>]*>)?\s+(?:[\w:<>]+\s+for\s+)?([A-Za-z_]\w*)`),
+	},
+	"java": {
+		regexp.MustCompile(`^\s*(?:(?:public|private|protected|internal|abstract|final|sealed|static|data|open)\s+)*(?:class|interface|enum|record|object|struct)\s+([A-Za-z_]\w*)`),
+		regexp.MustCompile(`^\s{2,4}(?:(?:public|protected|internal|static|final|abstract|override|suspend|async)\s+)+[\w<>\[\], ?]*?\s*([A-Za-z_]\w*)\s*\(`),
+		regexp.MustCompile(`^\s*(?:(?:public|internal|private)\s+)?fun\s+(?:<[^>]*>\s*)?(?:[\w.]+\.)?([A-Za-z_]\w*)\s*\(`),
+	},
+	"swift": {
+		regexp.MustCompile(`^\s*(?:(?:public|open|internal|final)\s+)*(?:class|struct|enum|protocol|extension|actor)\s+([A-Za-z_]\w*)`),
+		regexp.MustCompile(`^\s*(?:(?:public|open|internal|static|override|mutating)\s+)*func\s+([A-Za-z_]\w*)`),
+	},
+	"ruby": {
+		regexp.MustCompile(`^\s*(?:class|module)\s+([A-Z]\w*)`),
+		regexp.MustCompile(`^\s*def\s+(?:self\.)?([a-z_]\w*[?!]?)`),
+	},
+	"php": {
+		regexp.MustCompile(`^\s*(?:(?:abstract|final)\s+)?(?:class|interface|trait|enum)\s+([A-Za-z_]\w*)`),
+		regexp.MustCompile(`^\s*(?:(?:public|protected|static|abstract|final)\s+)*function\s+([A-Za-z_]\w*)`),
+	},
+	"c": {
+		regexp.MustCompile(`^(?:struct|class|enum|union)\s+([A-Za-z_]\w*)\s*[:{]?`),
+		regexp.MustCompile(`^(?:static\s+|inline\s+|extern\s+)*[A-Za-z_][\w:<>*&\s]*?[\s*&]([A-Za-z_][\w:]*)\s*\([^;]*$`),
+	},
+}
+
+// extractSymbols returns the top-level definitions of a source file. Go is
+// parsed properly; other languages use line patterns, which is enough for
+// an overview.
+func extractSymbols(lang string, src []byte) []Symbol {
+	if lang == "go" {
+		return goSymbols(src)
+	}
+	patterns := symbolPatterns[lang]
+	var symbols []Symbol
+	for i, line := range strings.Split(string(src), "\n") {
+		for _, re := range patterns {
+			m := re.FindStringSubmatch(line)
+			if m == nil {
+				continue
+			}
+			name := m[1]
+			if strings.HasPrefix(name, "_") && lang == "python" && name != "__init__" {
+				break // Private helpers
+			}
+			symbols = append(symbols, Symbol{Name: name, Signature: signature(line), Line: i + 1})
+			break
+		}
+	}
+	return symbols
+}
+
+func goSymbols(src []byte) []Symbol {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "", src, parser.SkipObjectResolution)
+	if err != nil {
+		return nil
+	}
+	var symbols []Symbol
+	add := func(name string, node any, pos token.Pos) {
+		var buf bytes.Buffer
+		if err := printer.Fprint(&buf, fset, node); err != nil {
+			return
+		}
+		symbols = append(symbols, Symbol{Name: name, Signature: oneLine(buf.String()), Line: fset.Position(pos).Line})
+	}
+	for _, decl := range file.Decls {
+		switch d := decl.(type) {
+		case *ast.FuncDecl:
+			if d.Recv == nil && (d.Name.Name == "init" || d.Name.Name == "main") {
+				continue
+			}
+			add(d.Name.Name, &ast.FuncDecl{Recv: d.Recv, Name: d.Name, Type: d.Type}, d.Pos())
+		case *ast.GenDecl:
+			for _, spec := range d.Specs {
+				switch s := spec.(type) {
+				case *ast.TypeSpec:
+					kind := "type " + s.Name.Name
+					switch s.Type.(type) {
+					case *ast.StructType:
+						kind += " struct"
+					case *ast.InterfaceType:
+						kind += " interface"
+					default:
+						var buf bytes.Buffer
+						_ = printer.Fprint(&buf, fset, s.Type)
+						kind += " " + buf.String()
+					}
+					symbols = append(symbols, Symbol{Name: s.Name.Name, Signature: oneLine(kind), Line: fset.Position(s.Pos()).Line})
+				case *ast.ValueSpec:
+					for _, name := range s.Names {
+						if !name.IsExported() {
+							continue
+						}
+						symbols = append(symbols, Symbol{Name: name.Name, Signature: d.Tok.String() + " " + name.Name, Line: fset.Position(name.Pos()).Line})
+					}
+				}
+			}
+		}
+	}
+	return symbols
+}
+
+// signature reduces a matched source line to its declaration, dropping an
+// opening body brace or trailing colon.
+func signature(line string) string {
+	line = strings.TrimSpace(line)
+	if i := strings.Index(line, "{"); i > 0 {
+		line = line[:i]
+	}
+	line = strings.TrimSpace(line)
+	return oneLine(strings.TrimSuffix(strings.TrimSuffix(line, ":"), ";"))
+}
+
+// oneLine collapses whitespace and bounds the length of a signature.
+func oneLine(text string) string {
+	text = strings.Join(strings.Fields(text), " ")
+	if len(text) > maxSignatureChars {
+		text = text[:maxSignatureChars] + "…"
+	}
+	return text
+}
+
+// identifierPattern finds names long enough to be meaningful references.
+var identifierPattern = regexp.MustCompile(`[A-Za-z_][A-Za-z0-9_]{2,}`)
+
+func identifiers(src []byte) map[string]struct{} {
+	idents := make(map[string]struct{})
+	for _, m := range identifierPattern.FindAll(src, -1) {
+		idents[string(m)] = struct{}{}
+	}
+	return idents
+}
@@ -0,0 +1,126 @@
+// Package safefile writes files so that a crash never leaves them half
+// written. Content goes to a temporary file in the same directory, which is
+// flushed to disk and then renamed over the target. The version it replaces
+// is kept next to it with a ".bak" suffix, and Read falls back to that copy
+// when the file is missing or fails validation.
+package safefile
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+)
+
+// BackupSuffix is appended to a file's name for its previous version.
+const BackupSuffix = ".bak"
+
+var noSync atomic.Bool
+
+// SetSync turns fsync of written files and their directories on (the
+// default) or off. Without it, writes are still atomic but the latest ones
+// may be lost on power failure.
+func SetSync(enabled bool) {
+	noSync.Store(!enabled)
+}
+
+// BackupPath returns where the previous version of path is kept.
+func BackupPath(path string) string {
+	return path + BackupSuffix
+}
+
+// Write atomically replaces path with data, keeping the old content at
+// BackupPath(path).
+func Write(path string, data []byte, perm os.FileMode) error {
+	dir := filepath.Dir(path)
+	tmp, err := os.CreateTemp(dir, filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	sync := !noSync.Load()
+	_, err = tmp.Write(data)
+	if err == nil && sync {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(tmp.Name(), perm)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	// Between these renames path is briefly missing; Read and Recover then
+	// use the backup
+	if _, err := os.Lstat(path); err == nil {
+		os.Rename(path, BackupPath(path))
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if sync {
+		syncDir(dir)
+	}
+	return nil
+}
+
+// Read returns the content of path. When path is missing or validate
+// rejects it, the previous version is returned instead and fromBackup is
+// set. validate may be nil. The error for path is returned when neither
+// copy is usable.
+func Read(path string, validate func([]byte) error) (data []byte, fromBackup bool, err error) {
+	data, err = readValid(path, validate)
+	if err == nil {
+		return data, false, nil
+	}
+	if backup, backupErr := readValid(BackupPath(path), validate); backupErr == nil {
+		return backup, true, nil
+	}
+	return nil, false, err
+}
+
+// Recover restores path from its previous version when a crash left only
+// the backup behind. It reports whether it did.
+func Recover(path string) bool {
+	if _, err := os.Lstat(path); !errors.Is(err, os.ErrNotExist) {
+		return false
+	}
+	if _, err := os.Stat(BackupPath(path)); err != nil {
+		return false
+	}
+	return os.Rename(BackupPath(path), path) == nil
+}
+
+// ValidJSON is a Read validator for files holding a JSON document.
+func ValidJSON(data []byte) error {
+	if !json.Valid(data) {
+		return errors.New("not valid JSON (truncated or corrupted)")
+	}
+	return nil
+}
+
+func readValid(path string, validate func([]byte) error) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if validate != nil {
+		if err := validate(data); err != nil {
+			return nil, err
+		}
+	}
+	return data, nil
+}
+
+// syncDir flushes a directory so a rename in it survives power loss. Not
+// every platform supports this, so failures are ignored.
+func syncDir(dir string) {
+	if d, err := os.Open(dir); err == nil {
+		d.Sync()
+		d.Close()
+	}
+}
@@ -0,0 +1,57 @@
+package safefile
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteKeepsPreviousVersion(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "plan.json")
+	if err := Write(path, []byte(`{"v":1}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(BackupPath(path)); !os.IsNotExist(err) {
+		t.Errorf("first write left a backup: %v", err)
+	}
+	if err := Write(path, []byte(`{"v":2}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(BackupPath(path)); string(data) != `{"v":1}` {
+		t.Errorf("backup = %s", data)
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0o644 {
+		t.Errorf("stat = %v, %v", info, err)
+	}
+	if matches, _ := filepath.Glob(path + ".*.tmp"); len(matches) != 0 {
+		t.Errorf("temp files left: %v", matches)
+	}
+
+	data, fromBackup, err := Read(path, ValidJSON)
+	if err != nil || fromBackup || string(data) != `{"v":2}` {
+		t.Fatalf("Read = %s, %v, %v", data, fromBackup, err)
+	}
+
+	// Truncated by a crash
+	os.WriteFile(path, []byte(`{"v":`), 0o644)
+	data, fromBackup, err = Read(path, ValidJSON)
+	if err != nil || !fromBackup || string(data) != `{"v":1}` {
+		t.Errorf("Read damaged = %s, %v, %v", data, fromBackup, err)
+	}
+
+	// Only the backup survived
+	os.Remove(path)
+	if !Recover(path) {
+		t.Fatal("Recover did not restore the backup")
+	}
+	if data, _ := os.ReadFile(path); string(data) != `{"v":1}` {
+		t.Errorf("recovered = %s", data)
+	}
+	if Recover(path) {
+		t.Error("Recover replaced an existing file")
+	}
+
+	if _, _, err := Read(filepath.Join(t.TempDir(), "missing.json"), nil); !os.IsNotExist(err) {
+		t.Errorf("missing file error = %v", err)
+	}
+}
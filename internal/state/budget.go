@@ -0,0 +1,119 @@
+package state
+
+import "fmt"
+
+// Budget limits the provider usage of a session. Zero fields are unlimited.
+// Past the soft limits the user is warned; at the hard limits turns stop
+// until the user chooses to continue.
+type Budget struct {
+	SoftTokens int     `yaml:"soft_tokens,omitempty" json:"soft_tokens,omitempty"`
+	HardTokens int     `yaml:"hard_tokens,omitempty" json:"hard_tokens,omitempty"`
+	SoftUSD    float64 `yaml:"soft_usd,omitempty" json:"soft_usd,omitempty"`
+	HardUSD    float64 `yaml:"hard_usd,omitempty" json:"hard_usd,omitempty"`
+}
+
+// Validate rejects negative limits and soft limits above hard ones.
+func (b Budget) Validate() error {
+	if b.SoftTokens < 0 || b.HardTokens < 0 || b.SoftUSD < 0 || b.HardUSD < 0 {
+		return fmt.Errorf("budget limits must be >= 0")
+	}
+	if b.HardTokens > 0 && b.SoftTokens > b.HardTokens {
+		return fmt.Errorf("soft_tokens (%d) cannot exceed hard_tokens (%d)", b.SoftTokens, b.HardTokens)
+	}
+	if b.HardUSD > 0 && b.SoftUSD > b.HardUSD {
+		return fmt.Errorf("soft_usd (%g) cannot exceed hard_usd (%g)", b.SoftUSD, b.HardUSD)
+	}
+	return nil
+}
+
+// SoftReached reports whether spent reached a soft limit.
+func (b Budget) SoftReached(spent UsageTotals) bool {
+	return reached(b.SoftTokens, b.SoftUSD, spent)
+}
+
+// HardReached reports whether spent reached a hard limit.
+func (b Budget) HardReached(spent UsageTotals) bool {
+	return reached(b.HardTokens, b.HardUSD, spent)
+}
+
+func reached(tokens int, usd float64, spent UsageTotals) bool {
+	return (tokens > 0 && spent.PromptTokens+spent.CompletionTokens >= tokens) ||
+		(usd > 0 && spent.CostUSD >= usd)
+}
+
+// BudgetState is a session's own budget: limits overriding the configured
+// default and its progress against them.
+type BudgetState struct {
+	Limits *Budget `json:"limits,omitempty"` // nil uses the configured budget
+	// Base is the usage when the user last chose to continue past the hard
+	// limit; limits apply to what was used since.
+	Base   UsageTotals `json:"base"`
+	Warned bool        `json:"warned,omitempty"` // Soft limit reported since Base
+}
+
+// Spent returns the usage counted against the budget.
+func (b BudgetState) Spent(usage Usage) UsageTotals {
+	return UsageTotals{
+		Requests:         usage.Requests - b.Base.Requests,
+		PromptTokens:     usage.PromptTokens - b.Base.PromptTokens,
+		CompletionTokens: usage.CompletionTokens - b.Base.CompletionTokens,
+		CostUSD:          usage.CostUSD - b.Base.CostUSD,
+		Unpriced:         usage.Unpriced - b.Base.Unpriced,
+	}
+}
+
+func (b BudgetState) orNil() *BudgetState {
+	if b.Limits == nil && b.Base == (UsageTotals{}) && !b.Warned {
+		return nil
+	}
+	if b.Limits != nil {
+		limits := *b.Limits
+		b.Limits = &limits
+	}
+	return &b
+}
+
+// Budget returns the session's budget settings and progress.
+func (c *Conversation) Budget() BudgetState {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if clone := c.budget.orNil(); clone != nil {
+		return *clone
+	}
+	return BudgetState{}
+}
+
+// SetBudgetLimits overrides the configured budget for this session; nil
+// restores the default. The soft limit is reported again once reached.
+func (c *Conversation) SetBudgetLimits(limits *Budget) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.ensureLoadedLocked()
+	if limits != nil {
+		copied := *limits
+		limits = &copied
+	}
+	c.budget.Limits = limits
+	c.budget.Warned = false
+	c.dirty = true
+}
+
+// ContinuePastBudget starts a fresh allowance from the current usage after
+// the user confirmed going on past the hard limit.
+func (c *Conversation) ContinuePastBudget() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.ensureLoadedLocked()
+	c.budget.Base = c.usage.UsageTotals
+	c.budget.Warned = false
+	c.dirty = true
+}
+
+// MarkBudgetWarned records that the soft limit was reported.
+func (c *Conversation) MarkBudgetWarned() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.ensureLoadedLocked()
+	c.budget.Warned = true
+	c.dirty = true
+}
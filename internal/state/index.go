@@ -0,0 +1,148 @@
+package state
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"cando/internal/safefile"
+)
+
+const (
+	// indexFile caches conversation metadata so startup does not parse
+	// every conversation file.
+	indexFile = "index.json"
+	// maxLoadedConversations is how many conversations keep their messages
+	// in memory; the least recently used beyond this are unloaded.
+	maxLoadedConversations = 32
+)
+
+// indexEntry is the metadata of one conversation file. Size and ModTime
+// detect files changed since the entry was written.
+type indexEntry struct {
+	Key          string    `json:"key"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+	MessageCount int       `json:"message_count"`
+	Parts        []string  `json:"parts,omitempty"`
+	ArchiveOf    string    `json:"archive_of,omitempty"`
+	Title        string    `json:"title,omitempty"`
+	Usage        *Usage    `json:"usage,omitempty"`
+	Size         int64     `json:"size"`
+	ModTime      time.Time `json:"mod_time"`
+
+	Budget       *BudgetState `json:"budget,omitempty"`
+	ThinkingMode ThinkingMode `json:"thinking_mode,omitempty"`
+}
+
+// readIndex returns the cached metadata keyed by path relative to the root.
+// A missing or unreadable index yields an empty one.
+func (m *Manager) readIndex() map[string]indexEntry {
+	index := make(map[string]indexEntry)
+	data, err := os.ReadFile(filepath.Join(m.root, indexFile))
+	if err != nil {
+		return index
+	}
+	if err := json.Unmarshal(data, &index); err != nil {
+		m.logger.Printf("ignoring conversation index: %v", err)
+		return make(map[string]indexEntry)
+	}
+	return index
+}
+
+func (m *Manager) writeIndexLocked() {
+	data, err := json.Marshal(m.index)
+	if err != nil {
+		return
+	}
+	if err := safefile.Write(filepath.Join(m.root, indexFile), data, 0o644); err != nil {
+		m.logger.Printf("write conversation index: %v", err)
+	}
+}
+
+// indexConversationLocked records conv's metadata after it was persisted.
+func (m *Manager) indexConversationLocked(conv *Conversation, count int) {
+	info, err := os.Stat(conv.storagePath)
+	if err != nil {
+		return
+	}
+	m.index[m.relPath(conv.storagePath)] = indexEntry{
+		Key:          conv.key,
+		CreatedAt:    conv.createdAt,
+		UpdatedAt:    conv.updatedAt,
+		MessageCount: count,
+		Parts:        conv.parts,
+		ArchiveOf:    conv.archiveOf,
+		Title:        conv.title,
+		Usage:        conv.usage.orNil(),
+		Budget:       conv.budget.orNil(),
+		ThinkingMode: conv.thinkingMode,
+		Size:         info.Size(),
+		ModTime:      info.ModTime(),
+	}
+	m.writeIndexLocked()
+}
+
+func (m *Manager) relPath(path string) string {
+	if rel, err := filepath.Rel(m.root, path); err == nil {
+		return filepath.ToSlash(rel)
+	}
+	return path
+}
+
+// readConversationFile parses a conversation file in full, falling back to
+// the previous version when the file is damaged.
+func (m *Manager) readConversationFile(path string) (persistedConversation, error) {
+	var persisted persistedConversation
+	data, fromBackup, err := safefile.Read(path, safefile.ValidJSON)
+	if err != nil {
+		return persisted, err
+	}
+	if fromBackup {
+		m.logger.Printf("%s is damaged; using its previous version", path)
+	}
+	if err := json.Unmarshal(data, &persisted); err != nil {
+		return persisted, fmt.Errorf("parse %s: %w", path, err)
+	}
+	return persisted, nil
+}
+
+// loader returns the function that reads conv's messages on first use. It
+// repairs their structure, and moves a file that no longer parses aside so
+// the next save does not overwrite it.
+func (m *Manager) loader(conv *Conversation) func() ([]Message, error) {
+	return func() ([]Message, error) {
+		persisted, err := m.readConversationFile(conv.storagePath)
+		if err != nil {
+			m.logger.Printf("load conversation %s: %v", conv.key, err)
+			if !os.IsNotExist(err) {
+				os.Rename(conv.storagePath, conv.storagePath+".corrupt")
+			}
+			return nil, err
+		}
+		messages, fixes := Lint(persisted.Messages)
+		for _, fix := range fixes {
+			m.logger.Printf("repaired conversation %s: %s", conv.key, fix)
+		}
+		return messages, nil
+	}
+}
+
+// touchLocked marks conv as most recently used and unloads the least
+// recently used conversations beyond maxLoadedConversations. The current
+// conversation and ones with unsaved changes stay loaded.
+func (m *Manager) touchLocked(conv *Conversation) {
+	m.recent = slices.DeleteFunc(m.recent, func(c *Conversation) bool { return c == conv })
+	m.recent = append(m.recent, conv)
+	for i := 0; len(m.recent) > maxLoadedConversations && i < len(m.recent)-1; {
+		c := m.recent[i]
+		if c.key != m.currentKey && c.unload() {
+			m.recent = slices.Delete(m.recent, i, i+1)
+			continue
+		}
+		i++
+	}
+}
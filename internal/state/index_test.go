@@ -0,0 +1,157 @@
+package state
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLazyLoading(t *testing.T) {
+	root := t.TempDir()
+	m, err := NewManager("sys", root, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < maxLoadedConversations+8; i++ {
+		conv, err := m.NewState(fmt.Sprintf("s%d", i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		conv.Append(Message{Role: "user", Content: fmt.Sprintf("hello %d", i)})
+		if err := m.Save(conv); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(root, indexFile)); err != nil {
+		t.Fatalf("index not written: %v", err)
+	}
+
+	m, err = NewManager("sys", root, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, conv := range m.states {
+		if conv.loaded {
+			t.Fatalf("%s loaded at startup", conv.key)
+		}
+	}
+	for _, s := range m.Summaries() {
+		if s.MessageCount != 2 {
+			t.Errorf("%s has count %d, want 2", s.Key, s.MessageCount)
+		}
+	}
+
+	loaded := 0
+	for i := 0; i < maxLoadedConversations+8; i++ {
+		conv, _ := m.Get(fmt.Sprintf("s%d", i))
+		if msgs := conv.Messages(); len(msgs) != 2 || msgs[1].Content != fmt.Sprintf("hello %d", i) {
+			t.Fatalf("s%d messages = %+v", i, msgs)
+		}
+	}
+	for _, conv := range m.states {
+		if conv.loaded {
+			loaded++
+		}
+	}
+	if loaded > maxLoadedConversations+1 {
+		t.Errorf("%d conversations loaded, want at most %d", loaded, maxLoadedConversations+1)
+	}
+
+	// An unloaded conversation reloads on use and keeps new messages
+	first, _ := m.Get("s0")
+	first.Append(Message{Role: "assistant", Content: "hi"})
+	if err := m.Save(first); err != nil {
+		t.Fatal(err)
+	}
+	m, err = NewManager("sys", root, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, _ = m.Get("s0")
+	if n := first.MessageCount(); n != 3 {
+		t.Errorf("count after reload = %d, want 3", n)
+	}
+	if n := len(first.Messages()); n != 3 {
+		t.Errorf("messages after reload = %d, want 3", n)
+	}
+}
+
+func TestLoadFallsBackToPreviousVersion(t *testing.T) {
+	root := t.TempDir()
+	m, err := NewManager("sys", root, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conv, err := m.NewState("chat")
+	if err != nil {
+		t.Fatal(err)
+	}
+	conv.Append(Message{Role: "user", Content: "first"})
+	if err := m.Save(conv); err != nil {
+		t.Fatal(err)
+	}
+	conv.Append(Message{Role: "assistant", Content: "second"})
+	if err := m.Save(conv); err != nil {
+		t.Fatal(err)
+	}
+	// Damage the latest version, as a crash mid-write would
+	if err := os.WriteFile(conv.StoragePath(), []byte(`{"key": "chat", "messages": [`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	m, err = NewManager("sys", root, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conv, ok := m.Get("chat")
+	if !ok {
+		t.Fatal("conversation lost")
+	}
+	if msgs := conv.Messages(); len(msgs) != 2 || msgs[1].Content != "first" {
+		t.Errorf("messages = %+v, want the previous version", msgs)
+	}
+}
+
+func TestTitleSurvivesReload(t *testing.T) {
+	root := t.TempDir()
+	m, err := NewManager("sys", root, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conv, err := m.NewState("session-20240101-123456")
+	if err != nil {
+		t.Fatal(err)
+	}
+	conv.Append(Message{Role: "user", Content: "fix the login form"})
+	if err := m.Save(conv); err != nil {
+		t.Fatal(err)
+	}
+
+	// Titling a conversation that is not loaded yet must still save it
+	m, err = NewManager("sys", root, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conv, _ = m.Get("session-20240101-123456")
+	updated := conv.UpdatedAt()
+	conv.SetTitle("  Fix login form ")
+	if err := m.Save(conv); err != nil {
+		t.Fatal(err)
+	}
+	if !conv.UpdatedAt().Equal(updated) {
+		t.Errorf("renaming changed the update time")
+	}
+
+	m, err = NewManager("sys", root, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summaries := m.Summaries(); len(summaries) != 1 || summaries[0].Title != "Fix login form" {
+		t.Fatalf("summaries = %+v", summaries)
+	}
+	conv, _ = m.Get("session-20240101-123456")
+	if msgs := conv.Messages(); len(msgs) != 2 {
+		t.Fatalf("messages lost on rename: %+v", msgs)
+	}
+}
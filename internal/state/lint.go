@@ -0,0 +1,110 @@
+package state
+
+import "fmt"
+
+// InterruptedToolResult is the content given to tool calls that never got a
+// result, for example because the process stopped mid-turn.
+const InterruptedToolResult = "tool error: the call was interrupted before it returned a result"
+
+// Lint checks the structure providers require of a history and returns a
+// repaired copy along with a description of each fix. Every assistant tool
+// call must be answered by exactly one tool message, and those answers must
+// directly follow the assistant message. Broken histories come from crashes
+// mid-turn, hand edits and compaction.
+//
+// Repairs, in order: tool calls without an id are dropped; tool results that
+// answer no pending call, or answer one twice, are dropped; results separated
+// from their call by other messages are moved back next to it; calls left
+// unanswered get an InterruptedToolResult; and assistant messages with no
+// content, thinking or tool calls are dropped.
+func Lint(messages []Message) ([]Message, []string) {
+	var fixes []string
+	out := make([]Message, 0, len(messages))
+	for i := 0; i < len(messages); i++ {
+		msg := messages[i]
+		switch {
+		case msg.Role == "tool":
+			// Results following their call are consumed below
+			fixes = append(fixes, fmt.Sprintf("dropped tool result %q (%s) with no matching call", msg.ToolCallID, msg.Name))
+		case msg.Role == "assistant" && len(msg.ToolCalls) > 0:
+			calls := make([]ToolCall, 0, len(msg.ToolCalls))
+			seen := make(map[string]bool)
+			for _, call := range msg.ToolCalls {
+				if call.ID == "" || seen[call.ID] {
+					fixes = append(fixes, fmt.Sprintf("dropped %s call with a missing or repeated id", call.Function.Name))
+					continue
+				}
+				seen[call.ID] = true
+				calls = append(calls, call)
+			}
+			msg.ToolCalls = calls
+			if len(calls) == 0 && msg.Content == "" && msg.Thinking == "" {
+				fixes = append(fixes, "dropped assistant message left empty")
+				continue
+			}
+			out = append(out, msg)
+
+			// Gather results up to the next assistant message; anything else
+			// in between is moved after them
+			results := make(map[string]Message)
+			var deferred []Message
+			j := i + 1
+			for ; j < len(messages) && messages[j].Role != "assistant"; j++ {
+				next := messages[j]
+				if next.Role != "tool" {
+					deferred = append(deferred, next)
+					continue
+				}
+				if _, done := results[next.ToolCallID]; !seen[next.ToolCallID] || done {
+					fixes = append(fixes, fmt.Sprintf("dropped tool result %q (%s) with no matching call", next.ToolCallID, next.Name))
+					continue
+				}
+				if len(deferred) > 0 {
+					fixes = append(fixes, fmt.Sprintf("moved tool result %q back to its call", next.ToolCallID))
+				}
+				results[next.ToolCallID] = next
+			}
+			for _, call := range calls {
+				result, ok := results[call.ID]
+				if !ok {
+					fixes = append(fixes, fmt.Sprintf("answered interrupted %s call %q", call.Function.Name, call.ID))
+					result = Message{Role: "tool", Name: call.Function.Name, ToolCallID: call.ID, Content: InterruptedToolResult, TurnID: msg.TurnID}
+				}
+				out = append(out, result)
+			}
+			out = append(out, deferred...)
+			i = j - 1
+		case msg.Role == "assistant" && msg.Content == "" && msg.Thinking == "":
+			fixes = append(fixes, "dropped empty assistant message")
+		default:
+			out = append(out, msg)
+		}
+	}
+	return out, fixes
+}
+
+// Repair lints the conversation in place and returns the fixes applied. It
+// leaves UpdatedAt alone, since the content the user sees is unchanged.
+func (c *Conversation) Repair() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.ensureLoadedLocked()
+	repaired, fixes := Lint(c.messages)
+	if len(fixes) > 0 {
+		c.messages = repaired
+		c.dirty = true
+	}
+	return fixes
+}
+
+// Repair lints conv, logs what was fixed and saves it when anything changed.
+func (m *Manager) Repair(conv *Conversation) error {
+	fixes := conv.Repair()
+	if len(fixes) == 0 {
+		return nil
+	}
+	for _, fix := range fixes {
+		m.logger.Printf("repaired conversation %s: %s", conv.key, fix)
+	}
+	return m.Save(conv)
+}
@@ -0,0 +1,50 @@
+package state
+
+import (
+	"reflect"
+	"testing"
+)
+
+func call(id, name string) ToolCall {
+	return ToolCall{ID: id, Type: "function", Function: FunctionCall{Name: name}}
+}
+
+func TestLintRepairsHistory(t *testing.T) {
+	messages := []Message{
+		{Role: "system", Content: "sys"},
+		{Role: "tool", ToolCallID: "stray", Name: "shell", Content: "orphan"},
+		{Role: "user", Content: "hi"},
+		{Role: "assistant", ToolCalls: []ToolCall{call("a", "read_file"), call("b", "shell"), call("", "grep")}},
+		{Role: "tool", ToolCallID: "a", Content: "A"},
+		{Role: "user", Content: "terminal activity"},
+		{Role: "tool", ToolCallID: "b", Content: "B"},
+		{Role: "tool", ToolCallID: "b", Content: "B again"},
+		{Role: "assistant", Content: ""},
+		{Role: "assistant", ToolCalls: []ToolCall{call("c", "shell")}},
+		{Role: "user", Content: "after crash"},
+	}
+	got, fixes := Lint(messages)
+	want := []Message{
+		{Role: "system", Content: "sys"},
+		{Role: "user", Content: "hi"},
+		{Role: "assistant", ToolCalls: []ToolCall{call("a", "read_file"), call("b", "shell")}},
+		{Role: "tool", ToolCallID: "a", Content: "A"},
+		{Role: "tool", ToolCallID: "b", Content: "B"},
+		{Role: "user", Content: "terminal activity"},
+		{Role: "assistant", ToolCalls: []ToolCall{call("c", "shell")}},
+		{Role: "tool", ToolCallID: "c", Name: "shell", Content: InterruptedToolResult},
+		{Role: "user", Content: "after crash"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("Lint =\n%+v\nwant\n%+v", got, want)
+	}
+	// Orphan, missing id, moved, duplicate, empty assistant, interrupted
+	if len(fixes) != 6 {
+		t.Errorf("fixes = %q", fixes)
+	}
+
+	again, fixes := Lint(got)
+	if len(fixes) != 0 || !reflect.DeepEqual(again, got) {
+		t.Errorf("second pass changed history: %q", fixes)
+	}
+}
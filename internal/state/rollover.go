@@ -0,0 +1,171 @@
+package state
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"cando/internal/clock"
+)
+
+const (
+	// rolloverKeepMessages is roughly how much recent history stays in the
+	// live session; the cut is moved back to the start of a user turn.
+	rolloverKeepMessages = 20
+	// rolloverSeedPrompts is how many earlier requests the seed lists.
+	rolloverSeedPrompts = 10
+	rolloverSeedLineLen = 200
+)
+
+// RolloverLimits caps the size of a conversation. Zero fields are unlimited.
+type RolloverLimits struct {
+	MaxMessages int
+	MaxBytes    int
+}
+
+// Parts returns the keys of the sessions this conversation's older history
+// was archived to, oldest first.
+func (c *Conversation) Parts() []string {
+	return append([]string(nil), c.parts...)
+}
+
+// ArchiveOf returns the key of the live session when this conversation is an
+// archived part of it.
+func (c *Conversation) ArchiveOf() string {
+	return c.archiveOf
+}
+
+// exceedsLocked reports whether the loaded messages are over limits.
+func (c *Conversation) exceedsLocked(limits RolloverLimits) bool {
+	if limits.MaxMessages > 0 && len(c.messages) > limits.MaxMessages {
+		return true
+	}
+	if limits.MaxBytes > 0 {
+		data, err := json.Marshal(c.messages)
+		return err == nil && len(data) > limits.MaxBytes
+	}
+	return false
+}
+
+// Rollover archives conv's older history when it is over limits. The old
+// messages move to a new "<key>-part-N" session linked from conv, and conv
+// keeps its system prompt, a seed message describing the archived part, and
+// the latest turns. It returns the archive key, or "" when conv is within
+// limits or has too little history to split.
+func (m *Manager) Rollover(conv *Conversation, limits RolloverLimits) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if conv == nil {
+		return "", nil
+	}
+	conv.mu.Lock()
+	conv.ensureLoadedLocked()
+	if !conv.exceedsLocked(limits) {
+		conv.mu.Unlock()
+		return "", nil
+	}
+	messages, thinkingMode, title := conv.messages, conv.thinkingMode, conv.title
+	conv.mu.Unlock()
+	start := 0
+	for start < len(messages) && messages[start].Role == "system" {
+		start++
+	}
+	cut := rolloverCut(messages, start)
+	if cut <= start {
+		return "", nil
+	}
+
+	key := m.archiveKeyLocked(conv)
+	archive := &Conversation{
+		key:       key,
+		messages:  append([]Message(nil), messages[:cut]...),
+		createdAt: conv.createdAt,
+		updatedAt: clock.Now(),
+		archiveOf: conv.key,
+		loaded:    true,
+
+		thinkingMode: thinkingMode,
+	}
+	if title != "" {
+		// "Fix login (part 1)" for key "session-…-part-1"
+		archive.title = fmt.Sprintf("%s (%s)", title, strings.ReplaceAll(strings.TrimPrefix(key, conv.key+"-"), "-", " "))
+	}
+	if err := m.persistConversationLocked(archive); err != nil {
+		return "", fmt.Errorf("archive conversation: %w", err)
+	}
+	m.states[key] = archive
+	archive.unload() // Rarely read again; loaded on demand
+
+	kept := append([]Message(nil), messages[:start]...)
+	kept = append(kept, Message{Role: "user", Content: rolloverSeed(key, messages[start:cut])})
+	kept = append(kept, messages[cut:]...)
+	conv.ReplaceMessages(kept)
+	conv.parts = append(conv.parts, key)
+	if err := m.persistConversationLocked(conv); err != nil {
+		return "", err
+	}
+	m.logger.Printf("rolled over conversation %s: %d messages archived to %s", conv.key, cut-start, key)
+	return key, nil
+}
+
+// rolloverCut returns the index where the kept history starts: the first
+// user message among the latest rolloverKeepMessages, or the last user
+// message when the latest turn alone is longer.
+func rolloverCut(messages []Message, start int) int {
+	last := -1
+	for i := len(messages) - 1; i >= start; i-- {
+		if messages[i].Role != "user" {
+			continue
+		}
+		if last >= 0 && len(messages)-i > rolloverKeepMessages {
+			break
+		}
+		last = i
+	}
+	return last
+}
+
+func (m *Manager) archiveKeyLocked(conv *Conversation) string {
+	for n := len(conv.parts) + 1; ; n++ {
+		key := fmt.Sprintf("%s-part-%d", conv.key, n)
+		if _, exists := m.states[key]; !exists {
+			return key
+		}
+	}
+}
+
+// rolloverSeed summarizes the archived messages for the continuation, so the
+// model knows the history exists and where to find it.
+func rolloverSeed(archiveKey string, archived []Message) string {
+	var prompts []string
+	for _, msg := range archived {
+		if msg.Role != "user" {
+			continue
+		}
+		line := strings.Join(strings.Fields(msg.Content), " ")
+		if line == "" {
+			continue
+		}
+		if len(line) > rolloverSeedLineLen {
+			line = line[:rolloverSeedLineLen] + "…"
+		}
+		prompts = append(prompts, line)
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "[This conversation grew too large, so its first %d messages were archived to session %q. ", len(archived), archiveKey)
+	if len(prompts) == 0 {
+		b.WriteString("Continue from the messages below.]")
+		return b.String()
+	}
+	if len(prompts) > rolloverSeedPrompts {
+		fmt.Fprintf(&b, "The last %d of %d earlier requests were:", rolloverSeedPrompts, len(prompts))
+		prompts = prompts[len(prompts)-rolloverSeedPrompts:]
+	} else {
+		b.WriteString("Earlier requests were:")
+	}
+	for _, p := range prompts {
+		b.WriteString("\n- " + p)
+	}
+	b.WriteString("]")
+	return b.String()
+}
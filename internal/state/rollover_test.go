@@ -0,0 +1,56 @@
+package state
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestRolloverArchivesOlderHistory(t *testing.T) {
+	root := t.TempDir()
+	m, err := NewManager("sys", root, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conv, err := m.NewState("big")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 30; i++ {
+		conv.Append(Message{Role: "user", Content: fmt.Sprintf("request %d", i)})
+		conv.Append(Message{Role: "assistant", Content: "done"})
+	}
+
+	if key, err := m.Rollover(conv, RolloverLimits{MaxMessages: 100}); err != nil || key != "" {
+		t.Fatalf("within limits: key %q, err %v", key, err)
+	}
+	key, err := m.Rollover(conv, RolloverLimits{MaxMessages: 40})
+	if err != nil || key != "big-part-1" {
+		t.Fatalf("rollover: key %q, err %v", key, err)
+	}
+
+	kept := conv.Messages()
+	if len(kept) != 22 || kept[0].Content != "sys" || kept[2].Content != "request 20" {
+		t.Fatalf("kept %d messages: %+v", len(kept), kept[:3])
+	}
+	seed := kept[1].Content
+	if !strings.Contains(seed, `"big-part-1"`) || !strings.Contains(seed, "request 19") || strings.Contains(seed, "request 9\n") {
+		t.Errorf("seed = %s", seed)
+	}
+
+	reloaded, err := NewManager("sys", root, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	live, _ := reloaded.Get("big")
+	archive, ok := reloaded.Get("big-part-1")
+	if !ok || archive.ArchiveOf() != "big" || len(archive.Messages()) != 41 {
+		t.Fatalf("archive not persisted: %v", archive)
+	}
+	if parts := live.Parts(); len(parts) != 1 || parts[0] != "big-part-1" {
+		t.Errorf("parts = %v", parts)
+	}
+	if reloaded.CurrentKey() != "big" {
+		t.Errorf("current = %s, want the live session", reloaded.CurrentKey())
+	}
+}
@@ -9,10 +9,15 @@ import (
 	"os"
 	"path/filepath"
 	"regexp"
+	"slices"
 	"sort"
 	"strings"
 	"sync"
 	"time"
+
+	"cando/internal/clock"
+	"cando/internal/safefile"
+	"cando/internal/timefmt"
 )
 
 var (
@@ -32,6 +37,7 @@ type Message struct {
 	ToolCallID string     `json:"tool_call_id,omitempty"`
 	ToolCalls  []ToolCall `json:"tool_calls,omitempty"`
 	Thinking   string     `json:"thinking,omitempty"`
+	TurnID     string     `json:"turn_id,omitempty"` // Turn that produced the message
 }
 
 // ToolCall represents a function call request emitted by the model.
@@ -48,12 +54,28 @@ type FunctionCall struct {
 }
 
 // Conversation is a named, mutable list of chat messages with persistence metadata.
+// Conversations read from disk hold only metadata until their messages are
+// first needed, and may be unloaded again by the Manager when idle.
 type Conversation struct {
+	mu           sync.Mutex // Guards messages, loaded, dirty and messageCount
+	messages     []Message
+	loaded       bool
+	dirty        bool // Changed since last persisted; never unloaded while set
+	messageCount int  // Known length while messages are not loaded
+	load         func() ([]Message, error)
+
 	key         string
-	messages    []Message
 	storagePath string
 	createdAt   time.Time
 	updatedAt   time.Time
+	turnID      string   // Stamped on messages appended during a turn
+	parts       []string // Archived parts of this conversation, oldest first
+	archiveOf   string   // Live conversation this one is an archived part of
+	title       string   // Display name; the key stays the identifier
+	usage       Usage    // Provider requests made for the conversation
+	budget      BudgetState
+
+	thinkingMode ThinkingMode // "" for the default, ThinkingCollapse
 }
 
 // Key returns the identifier assigned to the conversation.
@@ -68,33 +90,98 @@ func (c *Conversation) StoragePath() string {
 
 // Messages exposes the underlying history for serialization.
 func (c *Conversation) Messages() []Message {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.ensureLoadedLocked()
 	out := make([]Message, len(c.messages))
 	copy(out, c.messages)
 	return out
 }
 
-// Append adds a new chat message to the history.
+// MessageCount returns the number of messages without loading them.
+func (c *Conversation) MessageCount() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.loaded && c.load != nil {
+		return c.messageCount
+	}
+	return len(c.messages)
+}
+
+// Append adds a new chat message to the history, tagging it with the
+// active turn.
 func (c *Conversation) Append(msg Message) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.ensureLoadedLocked()
+	if msg.TurnID == "" {
+		msg.TurnID = c.turnID
+	}
+	if c.thinkingMode == ThinkingDiscard {
+		msg.Thinking = ""
+	}
 	c.messages = append(c.messages, msg)
+	c.dirty = true
 	c.touch()
 }
 
-// Clear removes all non-system history and reinstates the system prompt when given.
+// BeginTurn tags messages appended until EndTurn with id.
+func (c *Conversation) BeginTurn(id string) {
+	c.turnID = id
+}
+
+// EndTurn stops tagging appended messages.
+func (c *Conversation) EndTurn() {
+	c.turnID = ""
+}
+
+// Clear removes all non-system history and the title, and reinstates the
+// system prompt when given.
 func (c *Conversation) Clear(systemPrompt string) {
-	c.messages = c.messages[:0]
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.messages, c.title = nil, ""
 	if systemPrompt != "" {
 		c.messages = append(c.messages, Message{Role: "system", Content: systemPrompt})
 	}
+	c.loaded, c.dirty = true, true
 	c.touch()
 }
 
 // ReplaceMessages swaps the current conversation history with the provided slice.
 func (c *Conversation) ReplaceMessages(messages []Message) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	c.messages = make([]Message, len(messages))
 	copy(c.messages, messages)
+	if c.thinkingMode == ThinkingDiscard {
+		c.messages = StripThinking(c.messages)
+	}
+	c.loaded, c.dirty = true, true
 	c.touch()
 }
 
+// Title returns the conversation's display name, or "" when it has none.
+func (c *Conversation) Title() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.title
+}
+
+// SetTitle renames the conversation for display; "" removes the title. It
+// does not count as an update, so the session keeps its place in the list.
+func (c *Conversation) SetTitle(title string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	title = strings.TrimSpace(title)
+	if title == c.title {
+		return
+	}
+	c.ensureLoadedLocked()
+	c.title = title
+	c.dirty = true
+}
+
 // CreatedAt returns when the conversation was first persisted.
 func (c *Conversation) CreatedAt() time.Time {
 	return c.createdAt
@@ -105,8 +192,36 @@ func (c *Conversation) UpdatedAt() time.Time {
 	return c.updatedAt
 }
 
+// ensureLoadedLocked reads the messages of a conversation loaded lazily.
+// A file that can no longer be read leaves the conversation empty.
+func (c *Conversation) ensureLoadedLocked() {
+	if c.loaded || c.load == nil {
+		return
+	}
+	messages, err := c.load()
+	if err != nil {
+		messages = nil
+	}
+	c.messages = messages
+	c.loaded = true
+}
+
+// unload drops the messages of a conversation with no unsaved changes; they
+// are read again from disk on next use.
+func (c *Conversation) unload() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.loaded || c.dirty || c.load == nil {
+		return false
+	}
+	c.messageCount = len(c.messages)
+	c.messages = nil
+	c.loaded = false
+	return true
+}
+
 func (c *Conversation) touch() {
-	now := time.Now()
+	now := clock.Now()
 	if c.createdAt.IsZero() {
 		c.createdAt = now
 	}
@@ -121,6 +236,8 @@ type Manager struct {
 	systemPrompt string
 	root         string
 	logger       *log.Logger
+	index        map[string]indexEntry // Metadata by file path relative to root
+	recent       []*Conversation       // Loaded conversations, least recently used first
 }
 
 // NewManager sets up the container for managing multiple contexts backed by disk persistence.
@@ -136,6 +253,7 @@ func NewManager(systemPrompt, root string, logger *log.Logger) (*Manager, error)
 	}
 	mgr := &Manager{
 		states:       make(map[string]*Conversation),
+		index:        make(map[string]indexEntry),
 		systemPrompt: systemPrompt,
 		root:         root,
 		logger:       logger,
@@ -155,6 +273,7 @@ func (m *Manager) EnsureState(key string) (*Conversation, error) {
 	}
 	if conv, ok := m.states[key]; ok {
 		m.currentKey = key
+		m.touchLocked(conv)
 		return conv, nil
 	}
 	conv := newConversation(key, m.systemPrompt)
@@ -166,6 +285,7 @@ func (m *Manager) EnsureState(key string) (*Conversation, error) {
 	}
 	m.states[key] = conv
 	m.currentKey = key
+	m.touchLocked(conv)
 	return conv, nil
 }
 
@@ -185,6 +305,7 @@ func (m *Manager) NewState(key string) (*Conversation, error) {
 	}
 	m.states[key] = conv
 	m.currentKey = key
+	m.touchLocked(conv)
 	return conv, nil
 }
 
@@ -197,9 +318,21 @@ func (m *Manager) Use(key string) (*Conversation, error) {
 		return nil, fmt.Errorf("%w: %s", ErrUnknownState, key)
 	}
 	m.currentKey = key
+	m.touchLocked(conv)
 	return conv, nil
 }
 
+// Get returns a conversation by key without switching to it.
+func (m *Manager) Get(key string) (*Conversation, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	conv, ok := m.states[key]
+	if ok {
+		m.touchLocked(conv)
+	}
+	return conv, ok
+}
+
 // Delete removes a stored conversation from memory and disk.
 func (m *Manager) Delete(key string) error {
 	m.mu.Lock()
@@ -212,8 +345,12 @@ func (m *Manager) Delete(key string) error {
 		if err := os.Remove(conv.storagePath); err != nil && !os.IsNotExist(err) {
 			return fmt.Errorf("delete state %s: %w", key, err)
 		}
+		os.Remove(safefile.BackupPath(conv.storagePath))
 	}
 	delete(m.states, key)
+	delete(m.index, m.relPath(conv.storagePath))
+	m.writeIndexLocked()
+	m.recent = slices.DeleteFunc(m.recent, func(c *Conversation) bool { return c == conv })
 	if m.currentKey == key {
 		m.currentKey = ""
 	}
@@ -252,6 +389,22 @@ type Summary struct {
 	CreatedAt    time.Time `json:"created_at"`
 	UpdatedAt    time.Time `json:"updated_at"`
 	MessageCount int       `json:"message_count"`
+	ArchiveOf    string    `json:"archive_of,omitempty"` // Set on parts archived by a rollover
+	Title        string    `json:"title,omitempty"`
+	Usage        *Usage    `json:"usage,omitempty"`
+}
+
+// MarshalJSON writes the timestamps as UTC RFC 3339 with Unix millis
+// alongside, so clients in any timezone render the same times.
+func (s Summary) MarshalJSON() ([]byte, error) {
+	type summary Summary
+	return json.Marshal(struct {
+		summary
+		CreatedAt   timefmt.Time `json:"created_at"`
+		CreatedAtMs int64        `json:"created_at_ms"`
+		UpdatedAt   timefmt.Time `json:"updated_at"`
+		UpdatedAtMs int64        `json:"updated_at_ms"`
+	}{summary(s), timefmt.Time(s.CreatedAt), timefmt.Millis(s.CreatedAt), timefmt.Time(s.UpdatedAt), timefmt.Millis(s.UpdatedAt)})
 }
 
 // Summaries returns lightweight details for each known conversation, sorted by last update desc.
@@ -267,7 +420,10 @@ func (m *Manager) Summaries() []Summary {
 			Key:          key,
 			CreatedAt:    conv.CreatedAt(),
 			UpdatedAt:    conv.UpdatedAt(),
-			MessageCount: len(conv.messages),
+			MessageCount: conv.MessageCount(),
+			ArchiveOf:    conv.archiveOf,
+			Title:        conv.Title(),
+			Usage:        conv.Usage().orNil(),
 		})
 	}
 	sort.Slice(summaries, func(i, j int) bool {
@@ -302,7 +458,30 @@ func (m *Manager) Save(conv *Conversation) error {
 	if _, ok := m.states[conv.key]; !ok {
 		return fmt.Errorf("%w: %s", ErrUnknownState, conv.key)
 	}
-	return m.persistConversationLocked(conv)
+	if err := m.persistConversationLocked(conv); err != nil {
+		return err
+	}
+	m.touchLocked(conv)
+	return nil
+}
+
+// Flush writes every conversation with unsaved changes to disk.
+func (m *Manager) Flush() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var errs []error
+	for _, conv := range m.states {
+		conv.mu.Lock()
+		dirty := conv.dirty
+		conv.mu.Unlock()
+		if !dirty {
+			continue
+		}
+		if err := m.persistConversationLocked(conv); err != nil {
+			errs = append(errs, fmt.Errorf("save %s: %w", conv.key, err))
+		}
+	}
+	return errors.Join(errs...)
 }
 
 func (m *Manager) ensureCurrentLocked() *Conversation {
@@ -310,6 +489,7 @@ func (m *Manager) ensureCurrentLocked() *Conversation {
 		m.currentKey = m.generateUniqueSessionNameLocked()
 	}
 	if conv, ok := m.states[m.currentKey]; ok {
+		m.touchLocked(conv)
 		return conv
 	}
 	conv := newConversation(m.currentKey, m.systemPrompt)
@@ -319,15 +499,20 @@ func (m *Manager) ensureCurrentLocked() *Conversation {
 		m.logger.Printf("persist conversation failed: %v", err)
 	}
 	m.states[m.currentKey] = conv
+	m.touchLocked(conv)
 	return conv
 }
 
+// loadExisting registers the stored conversations without reading their
+// messages. Metadata comes from the index when a file is unchanged since it
+// was indexed, and from parsing the file otherwise.
 func (m *Manager) loadExisting() error {
 	entries, err := os.ReadDir(m.root)
 	if err != nil {
 		return fmt.Errorf("read conversation root: %w", err)
 	}
-	loaded := 0
+	cached := m.readIndex()
+	loaded, parsed := 0, 0
 	for _, entry := range entries {
 		if !entry.IsDir() {
 			continue
@@ -338,38 +523,70 @@ func (m *Manager) loadExisting() error {
 			m.logger.Printf("skip %s: %v", dayDir, err)
 			continue
 		}
+		if m.recoverBackups(dayDir, files) {
+			if files, err = os.ReadDir(dayDir); err != nil {
+				continue
+			}
+		}
 		for _, fileEntry := range files {
 			if fileEntry.IsDir() || filepath.Ext(fileEntry.Name()) != fileExtension {
 				continue
 			}
 			path := filepath.Join(dayDir, fileEntry.Name())
-			data, err := os.ReadFile(path)
+			info, err := fileEntry.Info()
 			if err != nil {
-				m.logger.Printf("read %s failed: %v", path, err)
+				m.logger.Printf("stat %s failed: %v", path, err)
 				continue
 			}
-			var persisted persistedConversation
-			if err := json.Unmarshal(data, &persisted); err != nil {
-				m.logger.Printf("parse %s failed: %v", path, err)
-				continue
+			rel := m.relPath(path)
+			meta, ok := cached[rel]
+			if !ok || meta.Size != info.Size() || !meta.ModTime.Equal(info.ModTime()) {
+				persisted, err := m.readConversationFile(path)
+				if err != nil {
+					m.logger.Printf("read %s failed: %v", path, err)
+					continue
+				}
+				meta = indexEntry{
+					Key:          persisted.Key,
+					CreatedAt:    persisted.CreatedAt,
+					UpdatedAt:    persisted.UpdatedAt,
+					MessageCount: len(persisted.Messages),
+					Parts:        persisted.Parts,
+					ArchiveOf:    persisted.ArchiveOf,
+					Title:        persisted.Title,
+					Usage:        persisted.Usage,
+					Budget:       persisted.Budget,
+					ThinkingMode: persisted.ThinkingMode,
+					Size:         info.Size(),
+					ModTime:      info.ModTime(),
+				}
+				parsed++
 			}
-			key := persisted.Key
+			m.index[rel] = meta
+			key := meta.Key
 			if key == "" {
 				key = strings.TrimSuffix(fileEntry.Name(), fileExtension)
 			}
 			conv := &Conversation{
-				key:         key,
-				messages:    persisted.Messages,
-				storagePath: path,
-				createdAt:   persisted.CreatedAt,
-				updatedAt:   persisted.UpdatedAt,
+				key:          key,
+				messageCount: meta.MessageCount,
+				storagePath:  path,
+				createdAt:    meta.CreatedAt,
+				updatedAt:    meta.UpdatedAt,
+				parts:        meta.Parts,
+				archiveOf:    meta.ArchiveOf,
+				title:        meta.Title,
+				thinkingMode: meta.ThinkingMode,
 			}
+			if meta.Usage != nil {
+				conv.usage = *meta.Usage
+			}
+			if meta.Budget != nil {
+				conv.budget = *meta.Budget
+			}
+			conv.load = m.loader(conv)
 			if conv.createdAt.IsZero() {
-				if info, statErr := os.Stat(path); statErr == nil {
-					conv.createdAt = info.ModTime()
-				} else {
-					conv.createdAt = time.Now()
-				}
+				conv.createdAt = info.ModTime()
 			}
 			if conv.updatedAt.IsZero() {
 				conv.updatedAt = conv.createdAt
@@ -383,8 +600,11 @@ func (m *Manager) loadExisting() error {
 			loaded++
 		}
 	}
+	if parsed > 0 || len(cached) != len(m.index) {
+		m.writeIndexLocked()
+	}
 	if loaded > 0 {
-		m.logger.Printf("loaded %d stored conversations", loaded)
+		m.logger.Printf("loaded %d stored conversations (%d parsed)", loaded, parsed)
 
 		// Set current key to most recently updated session
 		var mostRecent *Conversation
@@ -400,6 +620,21 @@ func (m *Manager) loadExisting() error {
 	return nil
 }
 
+// recoverBackups restores conversation files of which a crash between
+// replacing the file and renaming its new version into place left only the
+// previous version. It reports whether any were restored.
+func (m *Manager) recoverBackups(dir string, files []os.DirEntry) bool {
+	recovered := false
+	for _, entry := range files {
+		name, ok := strings.CutSuffix(entry.Name(), safefile.BackupSuffix)
+		if ok && filepath.Ext(name) == fileExtension && safefile.Recover(filepath.Join(dir, name)) {
+			m.logger.Printf("restored %s from its previous version", name)
+			recovered = true
+		}
+	}
+	return recovered
+}
+
 func (m *Manager) assignPathLocked(conv *Conversation) error {
 	if conv.storagePath != "" {
 		return nil
@@ -419,23 +654,37 @@ func (m *Manager) persistConversationLocked(conv *Conversation) error {
 			return err
 		}
 	}
+	conv.mu.Lock()
+	defer conv.mu.Unlock()
+	if !conv.loaded && conv.load != nil {
+		// Nothing changed since the messages were last read
+		return nil
+	}
 	payload := persistedConversation{
 		Key:       conv.key,
 		Messages:  conv.messages,
 		CreatedAt: conv.createdAt,
 		UpdatedAt: conv.updatedAt,
+		Parts:     conv.parts,
+		ArchiveOf: conv.archiveOf,
+		Title:     conv.title,
+		Usage:     conv.usage.orNil(),
+		Budget:    conv.budget.orNil(),
+
+		ThinkingMode: conv.thinkingMode,
 	}
 	data, err := json.MarshalIndent(payload, "", "  ")
 	if err != nil {
 		return fmt.Errorf("marshal conversation: %w", err)
 	}
-	tmp := conv.storagePath + ".tmp"
-	if err := os.WriteFile(tmp, data, 0o644); err != nil {
-		return fmt.Errorf("write temp conversation: %w", err)
+	if err := safefile.Write(conv.storagePath, data, 0o644); err != nil {
+		return fmt.Errorf("write conversation: %w", err)
 	}
-	if err := os.Rename(tmp, conv.storagePath); err != nil {
-		return fmt.Errorf("replace conversation: %w", err)
+	conv.dirty = false
+	if conv.load == nil {
+		conv.load = m.loader(conv)
 	}
+	m.indexConversationLocked(conv, len(conv.messages))
 	return nil
 }
 
@@ -468,8 +717,8 @@ func (m *Manager) generateUniqueSessionNameLocked() string {
 }
 
 func newConversation(key, systemPrompt string) *Conversation {
-	now := time.Now()
-	conv := &Conversation{key: key, createdAt: now, updatedAt: now}
+	now := clock.Now()
+	conv := &Conversation{key: key, createdAt: now, updatedAt: now, loaded: true}
 	if systemPrompt != "" {
 		conv.messages = append(conv.messages, Message{Role: "system", Content: systemPrompt})
 	}
@@ -482,4 +731,11 @@ type persistedConversation struct {
 	Messages  []Message `json:"messages"`
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
+	Parts     []string  `json:"parts,omitempty"`
+	ArchiveOf string    `json:"archive_of,omitempty"`
+	Title     string    `json:"title,omitempty"`
+	Usage     *Usage    `json:"usage,omitempty"`
+
+	Budget       *BudgetState `json:"budget,omitempty"`
+	ThinkingMode ThinkingMode `json:"thinking_mode,omitempty"`
 }
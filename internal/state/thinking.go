@@ -0,0 +1,74 @@
+package state
+
+import "fmt"
+
+// ThinkingMode controls what a session does with model reasoning.
+type ThinkingMode string
+
+const (
+	// ThinkingCollapse stores reasoning and shows it folded. It is the
+	// default for sessions that never set a mode.
+	ThinkingCollapse ThinkingMode = "collapse"
+	// ThinkingHide stores reasoning but keeps it out of the UI.
+	ThinkingHide ThinkingMode = "hide"
+	// ThinkingDiscard never stores reasoning and keeps it out of provider
+	// requests.
+	ThinkingDiscard ThinkingMode = "discard"
+)
+
+// ParseThinkingMode validates a mode name; "" selects the default.
+func ParseThinkingMode(name string) (ThinkingMode, error) {
+	switch mode := ThinkingMode(name); mode {
+	case "":
+		return ThinkingCollapse, nil
+	case ThinkingCollapse, ThinkingHide, ThinkingDiscard:
+		return mode, nil
+	}
+	return "", fmt.Errorf("unknown thinking mode %q (use collapse, hide or discard)", name)
+}
+
+// Visible reports whether reasoning is shown to the user.
+func (m ThinkingMode) Visible() bool {
+	return m != ThinkingHide && m != ThinkingDiscard
+}
+
+// ThinkingMode returns the session's reasoning mode.
+func (c *Conversation) ThinkingMode() ThinkingMode {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.thinkingMode == "" {
+		return ThinkingCollapse
+	}
+	return c.thinkingMode
+}
+
+// SetThinkingMode changes the session's reasoning mode. Switching to
+// ThinkingDiscard also drops the reasoning already stored in the session.
+func (c *Conversation) SetThinkingMode(mode ThinkingMode) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if mode == ThinkingCollapse {
+		mode = ""
+	}
+	if mode == c.thinkingMode {
+		return
+	}
+	c.ensureLoadedLocked()
+	c.thinkingMode = mode
+	if mode == ThinkingDiscard {
+		c.messages = StripThinking(c.messages)
+	}
+	c.dirty = true
+	c.touch()
+}
+
+// StripThinking returns messages with their reasoning removed. The input is
+// left untouched.
+func StripThinking(messages []Message) []Message {
+	out := make([]Message, len(messages))
+	for i, msg := range messages {
+		msg.Thinking = ""
+		out[i] = msg
+	}
+	return out
+}
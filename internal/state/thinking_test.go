@@ -0,0 +1,57 @@
+package state
+
+import "testing"
+
+func TestThinkingModeDiscard(t *testing.T) {
+	root := t.TempDir()
+	m, err := NewManager("sys", root, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conv, err := m.NewState("s")
+	if err != nil {
+		t.Fatal(err)
+	}
+	conv.Append(Message{Role: "assistant", Content: "a", Thinking: "first"})
+	if err := m.Save(conv); err != nil {
+		t.Fatal(err)
+	}
+
+	conv.SetThinkingMode(ThinkingDiscard)
+	conv.Append(Message{Role: "assistant", Content: "b", Thinking: "second"})
+	if err := m.Save(conv); err != nil {
+		t.Fatal(err)
+	}
+	for _, msg := range conv.Messages() {
+		if msg.Thinking != "" {
+			t.Fatalf("thinking kept after discard: %+v", msg)
+		}
+	}
+
+	// The mode survives a restart, and the index carries it
+	m, err = NewManager("sys", root, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reloaded, ok := m.Get("s")
+	if !ok {
+		t.Fatal("session missing after reload")
+	}
+	if mode := reloaded.ThinkingMode(); mode != ThinkingDiscard {
+		t.Fatalf("mode after reload = %q", mode)
+	}
+	for _, msg := range reloaded.Messages() {
+		if msg.Thinking != "" {
+			t.Fatalf("thinking persisted after discard: %+v", msg)
+		}
+	}
+}
+
+func TestParseThinkingMode(t *testing.T) {
+	if mode, err := ParseThinkingMode(""); err != nil || mode != ThinkingCollapse {
+		t.Fatalf("empty mode = %q, %v", mode, err)
+	}
+	if _, err := ParseThinkingMode("loud"); err == nil {
+		t.Fatal("expected an error for an unknown mode")
+	}
+}
@@ -0,0 +1,78 @@
+package state
+
+// UsageTotals counts provider requests, the tokens they reported and what
+// they cost.
+type UsageTotals struct {
+	Requests         int     `json:"requests"`
+	PromptTokens     int     `json:"prompt_tokens"`
+	CompletionTokens int     `json:"completion_tokens"`
+	CostUSD          float64 `json:"cost_usd"`
+	// Unpriced counts requests to models without known pricing, whose
+	// tokens are not reflected in CostUSD.
+	Unpriced int `json:"unpriced,omitempty"`
+}
+
+// Add sums other into t.
+func (t *UsageTotals) Add(other UsageTotals) {
+	t.Requests += other.Requests
+	t.PromptTokens += other.PromptTokens
+	t.CompletionTokens += other.CompletionTokens
+	t.CostUSD += other.CostUSD
+	t.Unpriced += other.Unpriced
+}
+
+// Usage is what a conversation's provider requests used, in total and per
+// provider key.
+type Usage struct {
+	UsageTotals
+	Providers map[string]UsageTotals `json:"providers,omitempty"`
+}
+
+// IsZero reports whether no request has been recorded.
+func (u Usage) IsZero() bool {
+	return u.Requests == 0
+}
+
+func (u Usage) clone() Usage {
+	if u.Providers != nil {
+		providers := make(map[string]UsageTotals, len(u.Providers))
+		for key, totals := range u.Providers {
+			providers[key] = totals
+		}
+		u.Providers = providers
+	}
+	return u
+}
+
+// orNil returns a copy of u to persist, or nil when nothing was recorded.
+func (u Usage) orNil() *Usage {
+	if u.IsZero() {
+		return nil
+	}
+	clone := u.clone()
+	return &clone
+}
+
+// Usage returns the provider usage recorded for the conversation.
+func (c *Conversation) Usage() Usage {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.usage.clone()
+}
+
+// AddUsage records one provider request against the conversation. Like a
+// rename it does not count as an update; usage survives Clear, since the
+// requests were still made and paid for.
+func (c *Conversation) AddUsage(provider string, request UsageTotals) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.ensureLoadedLocked()
+	c.usage.Add(request)
+	if c.usage.Providers == nil {
+		c.usage.Providers = make(map[string]UsageTotals)
+	}
+	totals := c.usage.Providers[provider]
+	totals.Add(request)
+	c.usage.Providers[provider] = totals
+	c.dirty = true
+}
@@ -0,0 +1,52 @@
+package state
+
+import "testing"
+
+func TestUsageSurvivesReload(t *testing.T) {
+	root := t.TempDir()
+	m, err := NewManager("sys", root, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conv, err := m.NewState("session-20240101-123456")
+	if err != nil {
+		t.Fatal(err)
+	}
+	conv.Append(Message{Role: "user", Content: "fix the login form"})
+	conv.AddUsage("zai", UsageTotals{Requests: 1, PromptTokens: 1000, CompletionTokens: 200, CostUSD: 0.00104})
+	if err := m.Save(conv); err != nil {
+		t.Fatal(err)
+	}
+
+	// Usage recorded on a conversation that is not loaded yet must be saved
+	m, err = NewManager("sys", root, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conv, _ = m.Get("session-20240101-123456")
+	conv.AddUsage("ollama", UsageTotals{Requests: 1, PromptTokens: 500, CompletionTokens: 50, Unpriced: 1})
+	conv.Clear("sys")
+	if err := m.Save(conv); err != nil {
+		t.Fatal(err)
+	}
+
+	m, err = NewManager("sys", root, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	summaries := m.Summaries()
+	if len(summaries) != 1 || summaries[0].Usage == nil {
+		t.Fatalf("summaries = %+v", summaries)
+	}
+	usage := *summaries[0].Usage
+	if usage.Requests != 2 || usage.PromptTokens != 1500 || usage.Unpriced != 1 || usage.CostUSD != 0.00104 {
+		t.Errorf("usage = %+v", usage)
+	}
+	if zai := usage.Providers["zai"]; zai.CompletionTokens != 200 || len(usage.Providers) != 2 {
+		t.Errorf("providers = %+v", usage.Providers)
+	}
+	conv, _ = m.Get("session-20240101-123456")
+	if conv.Usage().PromptTokens != 1500 {
+		t.Errorf("loaded usage = %+v", conv.Usage())
+	}
+}
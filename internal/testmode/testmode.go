@@ -0,0 +1,60 @@
+// Package testmode makes a Cando process deterministic for end-to-end
+// tests. With CANDO_TEST_MODE=1 the clock starts at a fixed epoch and
+// advances a millisecond per reading, memory IDs use a fixed seed, and the
+// config and credentials live in memory so the user's files under the config
+// directory are neither read nor written. Combine it with CANDO_MOCK_LLM=1
+// and CANDO_CONFIG_DIR pointing at a temporary directory.
+package testmode
+
+import (
+	"os"
+	"time"
+
+	"cando/internal/clock"
+	"cando/internal/config"
+	"cando/internal/credentials"
+)
+
+// Env is the environment variable that turns test mode on.
+const Env = "CANDO_TEST_MODE"
+
+// Seed is the memory ID seed used in test mode.
+const Seed int64 = 1
+
+// Epoch is the first time the clock reports in test mode.
+var Epoch = time.Date(2025, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// Enabled reports whether test mode is on.
+func Enabled() bool {
+	return os.Getenv(Env) == "1"
+}
+
+// Hooks are the deterministic replacements installed by Apply.
+type Hooks struct {
+	Config      *config.MemoryStore
+	Credentials *credentials.MemoryStore
+	restore     []func()
+}
+
+// Apply installs the test-mode clock and an in-memory config store holding
+// cfg, and returns an in-memory credential store holding creds (which may
+// be nil). Restore undoes it.
+func Apply(cfg config.Config, creds *credentials.Credentials) *Hooks {
+	h := &Hooks{
+		Config:      config.NewMemoryStore(cfg),
+		Credentials: credentials.NewMemoryStore(creds),
+	}
+	h.restore = append(h.restore,
+		clock.Set(clock.Stepping(Epoch, time.Millisecond)),
+		config.SetStore(h.Config),
+	)
+	return h
+}
+
+// Restore puts back the system clock and the file-based config.
+func (h *Hooks) Restore() {
+	for i := len(h.restore) - 1; i >= 0; i-- {
+		h.restore[i]()
+	}
+	h.restore = nil
+}
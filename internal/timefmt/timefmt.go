@@ -0,0 +1,85 @@
+// Package timefmt formats timestamps consistently: API payloads carry RFC
+// 3339 strings in UTC next to Unix milliseconds, and terminal output uses
+// short relative times.
+package timefmt
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Time marshals to JSON as an RFC 3339 string in UTC, whatever the location
+// of the wrapped time. Struct MarshalJSON methods use it to override their
+// time.Time fields.
+type Time time.Time
+
+func (t Time) MarshalJSON() ([]byte, error) {
+	return json.Marshal(Format(time.Time(t)))
+}
+
+// IsZero lets omitzero drop unset times.
+func (t Time) IsZero() bool { return time.Time(t).IsZero() }
+
+// Ptr wraps an optional time, keeping nil as nil so omitempty still applies.
+func Ptr(t *time.Time) *Time {
+	if t == nil {
+		return nil
+	}
+	v := Time(*t)
+	return &v
+}
+
+// Layout is RFC 3339 with fixed millisecond precision, matching the
+// resolution of Millis.
+const Layout = "2006-01-02T15:04:05.000Z07:00"
+
+// Format returns t as RFC 3339 in UTC with millisecond precision.
+func Format(t time.Time) string {
+	return t.UTC().Format(Layout)
+}
+
+// Millis returns t as Unix milliseconds, or 0 for the zero time.
+func Millis(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixMilli()
+}
+
+// PtrMillis is Millis for optional times; nil stays nil.
+func PtrMillis(t *time.Time) *int64 {
+	if t == nil {
+		return nil
+	}
+	ms := Millis(*t)
+	return &ms
+}
+
+// Relative describes t relative to now for terminal output: "just now",
+// "5m ago", "3h ago", "yesterday", "4d ago", and the local date beyond a
+// week. Times in the future read "in 5m".
+func Relative(t, now time.Time) string {
+	if t.IsZero() {
+		return "never"
+	}
+	d := now.Sub(t)
+	suffix := func(s string) string { return s + " ago" }
+	if d < 0 {
+		d = -d
+		suffix = func(s string) string { return "in " + s }
+	}
+	switch {
+	case d < time.Minute:
+		return "just now"
+	case d < time.Hour:
+		return suffix(fmt.Sprintf("%dm", int(d/time.Minute)))
+	case d < 24*time.Hour:
+		return suffix(fmt.Sprintf("%dh", int(d/time.Hour)))
+	case d < 48*time.Hour && t.Before(now):
+		return "yesterday"
+	case d < 7*24*time.Hour:
+		return suffix(fmt.Sprintf("%dd", int(d/(24*time.Hour))))
+	}
+	return t.Local().Format("2006-01-02")
+}
@@ -0,0 +1,48 @@
+package timefmt
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestTimeMarshalsUTC(t *testing.T) {
+	zone := time.FixedZone("UTC+5", 5*60*60)
+	ts := time.Date(2025, 3, 1, 10, 30, 0, 250e6, zone)
+	data, err := json.Marshal(struct {
+		At Time  `json:"at"`
+		Ms int64 `json:"at_ms"`
+	}{Time(ts), Millis(ts)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"at":"2025-03-01T05:30:00.250Z","at_ms":1740807000250}`; string(data) != want {
+		t.Fatalf("got %s, want %s", data, want)
+	}
+	if Millis(time.Time{}) != 0 || Ptr(nil) != nil || PtrMillis(nil) != nil {
+		t.Fatal("zero and nil times should stay empty")
+	}
+}
+
+func TestRelative(t *testing.T) {
+	now := time.Date(2025, 3, 10, 12, 0, 0, 0, time.UTC)
+	cases := map[time.Duration]string{
+		10 * time.Second:   "just now",
+		5 * time.Minute:    "5m ago",
+		3 * time.Hour:      "3h ago",
+		30 * time.Hour:     "yesterday",
+		4 * 24 * time.Hour: "4d ago",
+		-5 * time.Minute:   "in 5m",
+	}
+	for ago, want := range cases {
+		if got := Relative(now.Add(-ago), now); got != want {
+			t.Errorf("Relative(-%v) = %q, want %q", ago, got, want)
+		}
+	}
+	if got := Relative(now.Add(-30*24*time.Hour), now); got != now.Add(-30*24*time.Hour).Local().Format("2006-01-02") {
+		t.Errorf("old times should show the date, got %q", got)
+	}
+	if got := Relative(time.Time{}, now); got != "never" {
+		t.Errorf("zero time = %q", got)
+	}
+}
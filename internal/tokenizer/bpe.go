@@ -0,0 +1,137 @@
+package tokenizer
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"strconv"
+	"unicode"
+	"unicode/utf8"
+)
+
+// maxPieceBytes bounds the pieces BPE merges at once. Merging is quadratic
+// in the piece length, and pieces this long (minified code, base64 without
+// padding) are rare and already far from any vocabulary entry.
+const maxPieceBytes = 256
+
+// bpe counts tokens with a tiktoken byte-pair encoding.
+type bpe struct {
+	name  string
+	ranks map[string]int
+}
+
+func (b *bpe) Name() string { return b.name }
+func (b *bpe) Exact() bool  { return true }
+
+func (b *bpe) Count(text string) int {
+	n := 0
+	split(text, func(piece string) {
+		for len(piece) > maxPieceBytes {
+			n += b.countPiece(piece[:maxPieceBytes])
+			piece = piece[maxPieceBytes:]
+		}
+		n += b.countPiece(piece)
+	})
+	return n
+}
+
+// countPiece merges the bytes of piece pairwise, lowest rank first, until
+// no adjacent pair is in the vocabulary, and returns how many parts remain.
+func (b *bpe) countPiece(piece string) int {
+	if _, ok := b.ranks[piece]; ok {
+		return 1
+	}
+	bounds := make([]int, len(piece)+1)
+	for i := range bounds {
+		bounds[i] = i
+	}
+	for len(bounds) > 2 {
+		best, at := 0, -1
+		for i := 0; i+2 < len(bounds); i++ {
+			if rank, ok := b.ranks[piece[bounds[i]:bounds[i+2]]]; ok && (at < 0 || rank < best) {
+				best, at = rank, i
+			}
+		}
+		if at < 0 {
+			break
+		}
+		bounds = append(bounds[:at+1], bounds[at+2:]...)
+	}
+	return len(bounds) - 1
+}
+
+// loadRanks reads a .tiktoken file: one base64 token and its rank per line.
+func loadRanks(path string) (map[string]int, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	ranks := make(map[string]int, bytes.Count(data, []byte("\n"))+1)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; scanner.Scan(); line++ {
+		text := bytes.TrimSpace(scanner.Bytes())
+		if len(text) == 0 {
+			continue
+		}
+		token, rank, ok := bytes.Cut(text, []byte(" "))
+		if !ok {
+			return nil, fmt.Errorf("%s:%d: expected token and rank", path, line)
+		}
+		decoded, err := base64.StdEncoding.DecodeString(string(token))
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		n, err := strconv.Atoi(string(rank))
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		ranks[string(decoded)] = n
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(ranks) < 256 {
+		return nil, fmt.Errorf("%s: %d tokens, want at least one per byte", path, len(ranks))
+	}
+	return ranks, nil
+}
+
+// estimator approximates an encoding's counts from the shape of each piece
+// when its rank file is not installed. Prose and code land within about 15%
+// of cl100k_base.
+type estimator struct {
+	encoding string
+}
+
+func (e estimator) Name() string { return e.encoding }
+func (e estimator) Exact() bool  { return false }
+
+func (e estimator) Count(text string) int {
+	n := 0
+	split(text, func(piece string) { n += estimatePiece(piece) })
+	return n
+}
+
+// estimatePiece charges a token per eight ASCII bytes of each camel-case
+// hump, common words being single tokens and identifiers splitting at their
+// humps, and a token per three bytes of other scripts.
+func estimatePiece(piece string) int {
+	tokens, ascii, other := 0, 0, 0
+	var prev rune
+	for _, r := range piece {
+		switch {
+		case r >= utf8.RuneSelf:
+			other += utf8.RuneLen(r)
+		case unicode.IsUpper(r) && unicode.IsLower(prev):
+			tokens += (ascii + 7) / 8
+			ascii = 1
+		default:
+			ascii++
+		}
+		prev = r
+	}
+	tokens += (ascii+7)/8 + (other+2)/3
+	return max(tokens, 1)
+}
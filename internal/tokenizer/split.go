@@ -0,0 +1,122 @@
+package tokenizer
+
+import (
+	"unicode"
+	"unicode/utf8"
+)
+
+// split breaks text into the pieces BPE runs on, following the cl100k_base
+// pattern:
+//
+//	'(?i:[sdmt]|ll|ve|re)|[^\r\n\p{L}\p{N}]?\p{L}+|\p{N}{1,3}| ?[^\s\p{L}\p{N}]+[\r\n]*|\s*[\r\n]+|\s+(?!\S)|\s+
+//
+// Go's regexp has no lookahead, so the alternatives are tried by hand in the
+// same order. o200k_base splits camel case and attaches contractions to
+// their word; sharing this split costs it a few tokens per thousand.
+func split(text string, yield func(piece string)) {
+	for i := 0; i < len(text); {
+		n := pieceLen(text[i:])
+		yield(text[i : i+n])
+		i += n
+	}
+}
+
+// pieceLen returns the byte length of the piece at the start of s.
+func pieceLen(s string) int {
+	r, size := utf8.DecodeRuneInString(s)
+
+	if r == '\'' {
+		if n := contractionLen(s[size:]); n > 0 {
+			return size + n
+		}
+	}
+	if unicode.IsLetter(r) {
+		return size + runLen(s[size:], unicode.IsLetter, -1)
+	}
+	if r != '\r' && r != '\n' && !unicode.IsNumber(r) {
+		if next, _ := utf8.DecodeRuneInString(s[size:]); unicode.IsLetter(next) {
+			return size + runLen(s[size:], unicode.IsLetter, -1)
+		}
+	}
+	if unicode.IsNumber(r) {
+		return size + runLen(s[size:], unicode.IsNumber, 2)
+	}
+	if r == ' ' {
+		if next, _ := utf8.DecodeRuneInString(s[size:]); isSymbol(next) {
+			n := size + runLen(s[size:], isSymbol, -1)
+			return n + runLen(s[n:], isNewline, -1)
+		}
+	}
+	if isSymbol(r) {
+		n := size + runLen(s[size:], isSymbol, -1)
+		return n + runLen(s[n:], isNewline, -1)
+	}
+
+	// r is whitespace: take the run up to its last newline if it has one,
+	// else leave its last space to lead the next word.
+	run := size + runLen(s[size:], unicode.IsSpace, -1)
+	last := -1
+	for j := 0; j < run; j++ {
+		if isNewline(rune(s[j])) {
+			last = j
+		}
+	}
+	if last >= 0 {
+		return last + 1
+	}
+	if run == len(s) {
+		return run
+	}
+	if _, lastSize := utf8.DecodeLastRuneInString(s[:run]); run > lastSize {
+		return run - lastSize
+	}
+	return run
+}
+
+// contractionLen matches the suffix of an English contraction after its
+// apostrophe.
+func contractionLen(s string) int {
+	if len(s) >= 2 {
+		switch string([]byte{lower(s[0]), lower(s[1])}) {
+		case "ll", "ve", "re":
+			return 2
+		}
+	}
+	if len(s) >= 1 {
+		switch lower(s[0]) {
+		case 's', 'd', 'm', 't':
+			return 1
+		}
+	}
+	return 0
+}
+
+func lower(c byte) byte {
+	if 'A' <= c && c <= 'Z' {
+		return c + 'a' - 'A'
+	}
+	return c
+}
+
+// runLen returns the byte length of the leading runes of s matching class,
+// at most limit runes when limit is not negative.
+func runLen(s string, class func(rune) bool, limit int) int {
+	n := 0
+	for n < len(s) && limit != 0 {
+		r, size := utf8.DecodeRuneInString(s[n:])
+		if !class(r) {
+			break
+		}
+		n += size
+		limit--
+	}
+	return n
+}
+
+func isSymbol(r rune) bool {
+	return !unicode.IsSpace(r) && !unicode.IsLetter(r) && !unicode.IsNumber(r)
+}
+
+func isNewline(r rune) bool {
+	return r == '\r' || r == '\n'
+}
@@ -0,0 +1,128 @@
+// Package tokenizer counts tokens the way the active model's provider does,
+// so context limits and compaction are measured in the unit models are
+// billed and bounded in.
+//
+// Counts are exact for an encoding whose tiktoken rank file is installed in
+// <config dir>/tokenizers (cl100k_base.tiktoken, o200k_base.tiktoken, as
+// published by OpenAI). Without it they are estimated from the same
+// pre-tokenization, which is much closer than a fixed character ratio.
+package tokenizer
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"log"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"cando/internal/config"
+	"cando/internal/state"
+)
+
+// Encodings Cando can load.
+const (
+	CL100K = "cl100k_base"
+	O200K  = "o200k_base"
+)
+
+// Tokenizer counts the tokens of text in one encoding.
+type Tokenizer interface {
+	// Name is the encoding, such as cl100k_base.
+	Name() string
+	// Exact reports whether counts come from the encoding's vocabulary
+	// rather than an estimate.
+	Exact() bool
+	Count(text string) int
+}
+
+// encodings picks, per provider, the encoding of a model's tokenizer.
+// Providers not listed, and models whose own tokenizers are not published in
+// tiktoken form (GLM, Llama, Qwen), are measured with cl100k_base.
+var encodings = map[string]func(model string) string{
+	"openai": openAIEncoding,
+	"azure":  openAIEncoding,
+	"openrouter": func(model string) string {
+		if name, ok := strings.CutPrefix(model, "openai/"); ok {
+			return openAIEncoding(name)
+		}
+		return CL100K
+	},
+}
+
+// openAIEncoding returns o200k_base for GPT-4o and later models and
+// cl100k_base for GPT-4 and GPT-3.5.
+func openAIEncoding(model string) string {
+	for _, prefix := range []string{"gpt-4o", "chatgpt-4o", "gpt-4.1", "gpt-4.5", "gpt-5", "gpt-oss", "o1", "o3", "o4"} {
+		if strings.HasPrefix(model, prefix) {
+			return O200K
+		}
+	}
+	return CL100K
+}
+
+var (
+	mu     sync.Mutex
+	loaded = map[string]Tokenizer{}
+	// rankDir is where rank files are read from; tests point it elsewhere.
+	rankDir = func() string { return filepath.Join(config.GetConfigDir(), "tokenizers") }
+)
+
+// For returns the tokenizer of a provider's model. Rank files are read once
+// per process, so one installed later takes effect on restart.
+func For(provider, model string) Tokenizer {
+	name := CL100K
+	if pick, ok := encodings[strings.ToLower(strings.TrimSpace(provider))]; ok {
+		name = pick(strings.ToLower(strings.TrimSpace(model)))
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if t, ok := loaded[name]; ok {
+		return t
+	}
+	var t Tokenizer = estimator{encoding: name}
+	ranks, err := loadRanks(filepath.Join(rankDir(), name+".tiktoken"))
+	switch {
+	case err == nil:
+		t = &bpe{name: name, ranks: ranks}
+	case !errors.Is(err, fs.ErrNotExist):
+		log.Printf("tokenizer: %v; estimating %s counts", err, name)
+	}
+	loaded[name] = t
+	return t
+}
+
+// Overheads of the chat format: each message's role and separators, each
+// tool call's framing, and the tokens priming the reply.
+const (
+	messageOverhead  = 3
+	toolCallOverhead = 3
+	replyOverhead    = 3
+)
+
+// CountMessages returns the prompt tokens messages take in a chat request.
+func CountMessages(t Tokenizer, messages []state.Message) int {
+	n := replyOverhead
+	for _, msg := range messages {
+		n += messageOverhead + t.Count(msg.Role) + t.Count(msg.Content) + t.Count(msg.Thinking)
+		if msg.Name != "" {
+			n += 1 + t.Count(msg.Name)
+		}
+		for _, call := range msg.ToolCalls {
+			n += toolCallOverhead + t.Count(call.Function.Name) + t.Count(call.Function.Arguments)
+		}
+	}
+	return n
+}
+
+// CountJSON returns the tokens of v encoded as JSON, the form tool
+// definitions are sent in; 0 if v cannot be encoded.
+func CountJSON(t Tokenizer, v any) int {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return 0
+	}
+	return t.Count(string(data))
+}
@@ -0,0 +1,62 @@
+package tokenizer
+
+import (
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"cando/internal/state"
+)
+
+func TestSplitMatchesCL100KPattern(t *testing.T) {
+	var pieces []string
+	split("Hello world's  end\n\n  x = 12345;\n", func(p string) { pieces = append(pieces, p) })
+	want := []string{"Hello", " world", "'s", " ", " end", "\n\n", " ", " x", " =", " ", "123", "45", ";\n"}
+	if !reflect.DeepEqual(pieces, want) {
+		t.Fatalf("pieces = %q\nwant     %q", pieces, want)
+	}
+}
+
+func TestForLoadsRankFile(t *testing.T) {
+	dir := t.TempDir()
+	var ranks strings.Builder
+	for b := 0; b < 256; b++ {
+		fmt.Fprintf(&ranks, "%s %d\n", base64.StdEncoding.EncodeToString([]byte{byte(b)}), b)
+	}
+	fmt.Fprintf(&ranks, "%s 256\n%s 257\n", base64.StdEncoding.EncodeToString([]byte("ab")), base64.StdEncoding.EncodeToString([]byte("abc")))
+	if err := os.WriteFile(filepath.Join(dir, O200K+".tiktoken"), []byte(ranks.String()), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	rankDir = func() string { return dir }
+	loaded = map[string]Tokenizer{}
+	t.Cleanup(func() { loaded = map[string]Tokenizer{} })
+
+	tok := For("OpenAI", "gpt-4o-mini")
+	if tok.Name() != O200K || !tok.Exact() {
+		t.Fatalf("tokenizer = %s (exact %v)", tok.Name(), tok.Exact())
+	}
+	// "abc" is one token; " abd" merges to " ", "ab", "d"
+	if n := tok.Count("abc abd"); n != 4 {
+		t.Fatalf("Count = %d, want 4", n)
+	}
+
+	est := For("zai", "glm-4.6")
+	if est.Name() != CL100K || est.Exact() {
+		t.Fatalf("tokenizer without rank file = %s (exact %v)", est.Name(), est.Exact())
+	}
+	if n := est.Count("hello world"); n != 2 {
+		t.Errorf("estimate of two words = %d", n)
+	}
+	if n := est.Count("getUserName"); n != 3 {
+		t.Errorf("estimate of camel case identifier = %d", n)
+	}
+
+	msgs := []state.Message{{Role: "user", Content: "hello world"}}
+	if n := CountMessages(est, msgs); n != replyOverhead+messageOverhead+1+2 {
+		t.Errorf("CountMessages = %d", n)
+	}
+}
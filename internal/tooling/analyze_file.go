@@ -0,0 +1,182 @@
+package tooling
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// AnalyzeFileToolName is the tool that reads a file too large for the
+// context window in windows, carrying a summary from one to the next.
+const AnalyzeFileToolName = "analyze_large_file"
+
+const (
+	defaultAnalyzeWindowChars = 24000
+	minAnalyzeWindowChars     = 4000
+	maxAnalyzeWindowChars     = 100000
+	maxAnalyzeWindows         = 200
+)
+
+// Summarizer answers one window prompt with the session's summary model.
+type Summarizer func(ctx context.Context, prompt string) (string, error)
+
+type summarizerCtxKey struct{}
+
+// WithSummarizer gives analyze_large_file a model to run its windows on.
+func WithSummarizer(ctx context.Context, fn Summarizer) context.Context {
+	return context.WithValue(ctx, summarizerCtxKey{}, fn)
+}
+
+func summarizerFromContext(ctx context.Context) (Summarizer, bool) {
+	fn, ok := ctx.Value(summarizerCtxKey{}).(Summarizer)
+	return fn, ok && fn != nil
+}
+
+// AnalyzeFileTool answers a question about a file that does not fit in
+// context: each window is read together with the notes so far, and the
+// notes after the last window are the answer.
+type AnalyzeFileTool struct {
+	guard pathGuard
+}
+
+// NewAnalyzeFileTool constructs the chunked file analysis tool.
+func NewAnalyzeFileTool(guard pathGuard) *AnalyzeFileTool {
+	return &AnalyzeFileTool{guard: guard}
+}
+
+func (t *AnalyzeFileTool) Definition() ToolDefinition {
+	return ToolDefinition{
+		Type: "function",
+		Function: ToolFunction{
+			Name:        AnalyzeFileToolName,
+			Description: "Answer a question about a text file too large to read whole (generated code, logs, bundles, data dumps). The file is read in windows by a helper model that keeps rolling notes with line numbers; you get one combined answer. Slower than read_file, so use it only when the file does not fit.",
+			Parameters: map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"path": map[string]any{
+						"type":        "string",
+						"description": "Path to the file, relative to the workspace root.",
+					},
+					"question": map[string]any{
+						"type":        "string",
+						"description": "What to find out, e.g. \"Which functions touch the session table?\" or \"Summarize the structure\".",
+					},
+					"window_chars": map[string]any{
+						"type":        "integer",
+						"description": fmt.Sprintf("Characters per window (default %d).", defaultAnalyzeWindowChars),
+					},
+				},
+				"required": []string{"path", "question"},
+			},
+		},
+	}
+}
+
+func (t *AnalyzeFileTool) Call(ctx context.Context, args map[string]any) (string, error) {
+	path, ok := stringArg(args, "path")
+	if !ok || path == "" {
+		return "", errors.New("path is required")
+	}
+	question, ok := stringArg(args, "question")
+	if !ok || strings.TrimSpace(question) == "" {
+		return "", errors.New("question is required")
+	}
+	summarize, ok := summarizerFromContext(ctx)
+	if !ok {
+		return "", errors.New("file analysis is not available in this session")
+	}
+	windowChars := min(max(intArg(args, "window_chars", defaultAnalyzeWindowChars), minAnalyzeWindowChars), maxAnalyzeWindowChars)
+
+	abs, err := t.guard.Resolve(path)
+	if err != nil {
+		return "", err
+	}
+	data, err := os.ReadFile(abs)
+	if err != nil {
+		return "", err
+	}
+	if bytes.IndexByte(data[:min(len(data), 8000)], 0) >= 0 {
+		return "", fmt.Errorf("%s looks binary", path)
+	}
+	windows := splitWindows(string(data), windowChars)
+	if len(windows) > maxAnalyzeWindows {
+		return "", fmt.Errorf("%s needs %d windows of %d chars (limit %d); raise window_chars or grep for the relevant part first", path, len(windows), windowChars, maxAnalyzeWindows)
+	}
+
+	notes := ""
+	for i, w := range windows {
+		select {
+		case <-ctx.Done():
+			return "", ctx.Err()
+		default:
+		}
+		notes, err = summarize(ctx, windowPrompt(t.guard.Rel(abs), question, notes, w, i, len(windows)))
+		if err != nil {
+			return "", fmt.Errorf("window %d/%d (lines %d-%d): %w", i+1, len(windows), w.firstLine, w.lastLine, err)
+		}
+		notes = strings.TrimSpace(notes)
+	}
+
+	payload := map[string]any{
+		"path":     t.guard.Rel(abs),
+		"question": question,
+		"bytes":    len(data),
+		"lines":    windows[len(windows)-1].lastLine,
+		"windows":  len(windows),
+		"analysis": notes,
+	}
+	out, err := jsonMarshalNoEscape(payload)
+	if err != nil {
+		return "", err
+	}
+	return string(out), nil
+}
+
+type textWindow struct {
+	text                string
+	firstLine, lastLine int
+}
+
+// splitWindows cuts text into windows of about size characters, breaking
+// at line ends. A single line longer than size is cut mid-line.
+func splitWindows(text string, size int) []textWindow {
+	var windows []textWindow
+	line := 1
+	for len(text) > 0 {
+		end := min(len(text), size)
+		if end < len(text) {
+			if nl := strings.LastIndexByte(text[:end], '\n'); nl > 0 {
+				end = nl + 1
+			}
+		}
+		chunk := text[:end]
+		lines := strings.Count(strings.TrimSuffix(chunk, "\n"), "\n")
+		windows = append(windows, textWindow{text: chunk, firstLine: line, lastLine: line + lines})
+		line += strings.Count(chunk, "\n")
+		text = text[end:]
+	}
+	if len(windows) == 0 {
+		windows = append(windows, textWindow{firstLine: 1, lastLine: 1})
+	}
+	return windows
+}
+
+func windowPrompt(path, question, notes string, w textWindow, index, total int) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "File: %s\nQuestion: %s\n\n", path, question)
+	if notes == "" {
+		b.WriteString("Notes so far: (none, this is the first part)\n\n")
+	} else {
+		fmt.Fprintf(&b, "Notes so far:\n%s\n\n", notes)
+	}
+	fmt.Fprintf(&b, "Part %d of %d, lines %d-%d:\n%s\n", index+1, total, w.firstLine, w.lastLine, w.text)
+	if index == total-1 {
+		b.WriteString("\nThis is the last part. Return the final answer to the question, with line numbers.")
+	} else {
+		b.WriteString("\nReturn the updated notes.")
+	}
+	return b.String()
+}
@@ -0,0 +1,76 @@
+package tooling
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAnalyzeFileWindows(t *testing.T) {
+	guard, err := newPathGuard(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var content strings.Builder
+	for i := 1; i <= 1000; i++ {
+		fmt.Fprintf(&content, "line %04d %s\n", i, strings.Repeat("x", 21)) // 32 bytes
+	}
+	if err := os.WriteFile(filepath.Join(guard.root, "big.txt"), []byte(content.String()), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tool := NewAnalyzeFileTool(guard)
+	args := map[string]any{"path": "big.txt", "question": "How many lines?", "window_chars": 4000}
+	if _, err := tool.Call(context.Background(), args); err == nil {
+		t.Fatal("expected an error without a summarizer")
+	}
+
+	var prompts []string
+	summarize := func(_ context.Context, prompt string) (string, error) {
+		prompts = append(prompts, prompt)
+		return fmt.Sprintf("notes after part %d", len(prompts)), nil
+	}
+	out, err := tool.Call(WithSummarizer(context.Background(), summarize), args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var result struct {
+		Lines    int    `json:"lines"`
+		Windows  int    `json:"windows"`
+		Analysis string `json:"analysis"`
+	}
+	if err := json.Unmarshal([]byte(out), &result); err != nil {
+		t.Fatal(err)
+	}
+	// 125 whole lines fit in a 4000 char window
+	if result.Windows != 8 || len(prompts) != 8 || result.Lines != 1000 || result.Analysis != "notes after part 8" {
+		t.Fatalf("result = %+v after %d prompts", result, len(prompts))
+	}
+	if !strings.Contains(prompts[0], "lines 1-125:") || !strings.Contains(prompts[0], "(none, this is the first part)") {
+		t.Errorf("first prompt = %.200s", prompts[0])
+	}
+	if !strings.Contains(prompts[1], "notes after part 1") || !strings.Contains(prompts[1], "lines 126-250:\nline 0126") {
+		t.Errorf("second prompt does not carry the notes: %.300s", prompts[1])
+	}
+	if !strings.Contains(prompts[7], "This is the last part") || strings.Contains(prompts[6], "This is the last part") {
+		t.Error("only the last part asks for the final answer")
+	}
+}
+
+func TestSplitWindows(t *testing.T) {
+	windows := splitWindows("ab\n"+strings.Repeat("x", 10)+"\ncd", 6)
+	var lines []string
+	for _, w := range windows {
+		lines = append(lines, fmt.Sprintf("%d-%d:%q", w.firstLine, w.lastLine, w.text))
+	}
+	got := strings.Join(lines, " ")
+	// An overlong line is cut mid-line and keeps its line number
+	want := `1-1:"ab\n" 2-2:"xxxxxx" 2-2:"xxxx\n" 3-3:"cd"`
+	if got != want {
+		t.Errorf("windows = %s", got)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io/fs"
 	"os"
 	"path/filepath"
 	"strconv"
@@ -33,6 +34,7 @@ func (ApplyPatchTool) Definition() ToolDefinition {
 						"type":        "string",
 						"description": "Unified diff patch text (*** Begin Patch / *** Update File sections).",
 					},
+					"confirm": confirmParam,
 				},
 				"required": []string{"patch"},
 			},
@@ -56,29 +58,135 @@ func (a *ApplyPatchTool) Call(ctx context.Context, args map[string]any) (string,
 	if err != nil {
 		return "", err
 	}
+	// Check every file first so a refused file does not leave a half-applied patch
+	if err := a.checkSections(sections, boolArg(args, "confirm", false)); err != nil {
+		return "", err
+	}
 
 	for _, section := range sections {
-		switch section.op {
-		case patchOpUpdate:
-			if err := a.applyUpdate(section); err != nil {
-				return "", err
-			}
-		case patchOpAdd:
-			if err := a.applyAdd(section); err != nil {
-				return "", err
-			}
-		case patchOpDelete:
-			if err := a.applyDelete(section); err != nil {
-				return "", err
-			}
-		default:
-			return "", fmt.Errorf("unknown patch op %q", section.op)
+		change, err := a.planSection(section, os.ReadFile)
+		if err != nil {
+			return "", err
+		}
+		if change.Exists {
+			err = os.WriteFile(change.abs, change.After, 0o644)
+		} else {
+			err = os.Remove(change.abs)
+		}
+		if err != nil {
+			return "", err
 		}
 	}
 
 	return fmt.Sprintf("Applied %d patch block(s).", len(sections)), nil
 }
 
+// PreviewChanges works out the files a patch would leave, without writing
+// them. Several blocks for one file come back as a single change.
+func (a *ApplyPatchTool) PreviewChanges(args map[string]any) ([]FileChange, error) {
+	patch, ok := stringArg(args, "patch")
+	if !ok || strings.TrimSpace(patch) == "" {
+		return nil, errors.New("patch is required")
+	}
+	sections, err := a.parseSections(patch)
+	if err != nil {
+		return nil, err
+	}
+	if err := a.checkSections(sections, boolArg(args, "confirm", false)); err != nil {
+		return nil, err
+	}
+
+	// Later blocks see the content earlier blocks would have written
+	var changes []FileChange
+	index := make(map[string]int)
+	read := func(abs string) ([]byte, error) {
+		i, ok := index[abs]
+		if !ok {
+			return os.ReadFile(abs)
+		}
+		if !changes[i].Exists {
+			return nil, &os.PathError{Op: "open", Path: abs, Err: os.ErrNotExist}
+		}
+		return changes[i].After, nil
+	}
+	for _, section := range sections {
+		change, err := a.planSection(section, read)
+		if err != nil {
+			return nil, err
+		}
+		if i, ok := index[change.abs]; ok {
+			changes[i].After, changes[i].Exists = change.After, change.Exists
+			continue
+		}
+		index[change.abs] = len(changes)
+		changes = append(changes, change)
+	}
+	return changes, nil
+}
+
+func (a *ApplyPatchTool) checkSections(sections []patchSection, confirmed bool) error {
+	for _, section := range sections {
+		if section.op == patchOpDelete {
+			continue
+		}
+		absPath, err := a.guard.Resolve(section.path)
+		if err != nil {
+			return err
+		}
+		incoming := 0
+		if section.op == patchOpAdd {
+			for _, line := range section.body {
+				incoming += len(line) + 1
+			}
+		}
+		if err := a.guard.checkEditable(absPath, incoming, confirmed); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// planSection works out the file one patch block leaves, reading the current
+// content through read.
+func (a *ApplyPatchTool) planSection(section patchSection, read func(string) ([]byte, error)) (FileChange, error) {
+	absPath, err := a.guard.Resolve(section.path)
+	if err != nil {
+		return FileChange{}, err
+	}
+	change := FileChange{Path: filepath.ToSlash(a.guard.Rel(absPath)), abs: absPath}
+	switch section.op {
+	case patchOpUpdate:
+		origData, err := read(absPath)
+		if err != nil {
+			return FileChange{}, fmt.Errorf("read %s: %w", section.path, err)
+		}
+		content, err := applyUpdate(section, origData)
+		if err != nil {
+			return FileChange{}, err
+		}
+		change.Before, change.Existed = origData, true
+		change.After, change.Exists = []byte(content), true
+	case patchOpAdd:
+		if _, err := read(absPath); !errors.Is(err, fs.ErrNotExist) {
+			return FileChange{}, fmt.Errorf("file %s already exists", section.path)
+		}
+		content, err := applyAdd(section)
+		if err != nil {
+			return FileChange{}, err
+		}
+		change.After, change.Exists = []byte(content), true
+	case patchOpDelete:
+		origData, err := read(absPath)
+		if errors.Is(err, fs.ErrNotExist) {
+			return FileChange{}, fmt.Errorf("file %s does not exist", section.path)
+		}
+		change.Before, change.Existed = origData, true
+	default:
+		return FileChange{}, fmt.Errorf("unknown patch op %q", section.op)
+	}
+	return change, nil
+}
+
 const (
 	patchOpUpdate = "update"
 	patchOpAdd    = "add"
@@ -177,69 +285,39 @@ func (a *ApplyPatchTool) validatePath(path string) error {
 	return err
 }
 
-func (a *ApplyPatchTool) applyUpdate(section patchSection) error {
-	absPath, err := a.guard.Resolve(section.path)
-	if err != nil {
-		return err
-	}
-	origData, err := os.ReadFile(absPath)
-	if err != nil {
-		return fmt.Errorf("read %s: %w", section.path, err)
-	}
-
+func applyUpdate(section patchSection, origData []byte) (string, error) {
 	hunks, err := parseHunks(section.body)
 	if err != nil {
-		return fmt.Errorf("parse patch for %s: %w", section.path, err)
+		return "", fmt.Errorf("parse patch for %s: %w", section.path, err)
 	}
 
 	origLines, origHadTrailingNewline := splitLinesWithNewline(string(origData))
 	newLines, err := applyHunks(origLines, hunks)
 	if err != nil {
-		return fmt.Errorf("apply patch for %s: %w", section.path, err)
+		return "", fmt.Errorf("apply patch for %s: %w", section.path, err)
 	}
 
-	content := joinLinesWithNewline(newLines, origHadTrailingNewline || hasTrailingNewlineFlag(section.body))
-	return os.WriteFile(absPath, []byte(content), 0o644)
+	return joinLinesWithNewline(newLines, origHadTrailingNewline || hasTrailingNewlineFlag(section.body)), nil
 }
 
-func (a *ApplyPatchTool) applyAdd(section patchSection) error {
-	absPath, err := a.guard.Resolve(section.path)
-	if err != nil {
-		return err
-	}
-	if _, statErr := os.Stat(absPath); statErr == nil {
-		return fmt.Errorf("file %s already exists", section.path)
-	}
-
+func applyAdd(section patchSection) (string, error) {
 	if containsHunkHeader(section.body) {
 		hunks, err := parseHunks(section.body)
 		if err != nil {
-			return fmt.Errorf("parse patch for %s: %w", section.path, err)
+			return "", fmt.Errorf("parse patch for %s: %w", section.path, err)
 		}
 		newLines, err := applyHunks(nil, hunks)
 		if err != nil {
-			return fmt.Errorf("apply patch for %s: %w", section.path, err)
+			return "", fmt.Errorf("apply patch for %s: %w", section.path, err)
 		}
-		content := joinLinesWithNewline(newLines, hasTrailingNewlineFlag(section.body))
-		return os.WriteFile(absPath, []byte(content), 0o644)
+		return joinLinesWithNewline(newLines, hasTrailingNewlineFlag(section.body)), nil
 	}
 
 	content := strings.Join(stripDiffPrefixes(section.body, '+'), "\n")
 	if content != "" {
 		content += "\n"
 	}
-	return os.WriteFile(absPath, []byte(content), 0o644)
-}
-
-func (a *ApplyPatchTool) applyDelete(section patchSection) error {
-	absPath, err := a.guard.Resolve(section.path)
-	if err != nil {
-		return err
-	}
-	if _, statErr := os.Stat(absPath); statErr != nil {
-		return fmt.Errorf("file %s does not exist", section.path)
-	}
-	return os.Remove(absPath)
+	return content, nil
 }
 
 // --- diff parsing helpers ---
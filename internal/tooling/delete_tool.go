@@ -0,0 +1,319 @@
+package tooling
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	trashLogFile   = "log.jsonl"
+	trashRetention = 30 * 24 * time.Hour
+)
+
+// trashEntry describes one deleted path held in the trash.
+type trashEntry struct {
+	ID        string    `json:"id"`
+	Path      string    `json:"path"` // Workspace-relative, slash-separated
+	Type      string    `json:"type"` // file | directory
+	Files     int       `json:"files"`
+	Bytes     int64     `json:"bytes"`
+	DeletedAt time.Time `json:"deleted_at"`
+}
+
+// DeletePathTool removes files and directories by moving them to a trash
+// directory outside the workspace, from which they can be restored.
+type DeletePathTool struct {
+	guard    pathGuard
+	trashDir string
+	mu       sync.Mutex
+}
+
+func NewDeletePathTool(guard pathGuard, trashDir string) *DeletePathTool {
+	return &DeletePathTool{guard: guard, trashDir: trashDir}
+}
+
+func (*DeletePathTool) Definition() ToolDefinition {
+	return ToolDefinition{
+		Type: "function",
+		Function: ToolFunction{
+			Name:        "delete_path",
+			Description: "Delete a file or directory in the workspace by moving it to the trash, where it is kept for 30 days. Use this instead of shell rm. Non-empty directories need recursive=true. action=list shows the trash and action=restore puts an entry back.",
+			Parameters: map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"action": map[string]any{
+						"type":        "string",
+						"enum":        []string{"delete", "list", "restore"},
+						"description": "delete (default), list, or restore.",
+					},
+					"path": map[string]any{
+						"type":        "string",
+						"description": "For delete: file or directory relative to the workspace root.",
+					},
+					"recursive": map[string]any{
+						"type":        "boolean",
+						"description": "Required to delete a non-empty directory.",
+					},
+					"id": map[string]any{
+						"type":        "string",
+						"description": "For restore: trash entry id from delete or list.",
+					},
+				},
+			},
+		},
+	}
+}
+
+func (t *DeletePathTool) Call(ctx context.Context, args map[string]any) (string, error) {
+	select {
+	case <-ctx.Done():
+		return "", ctx.Err()
+	default:
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	action, _ := stringArg(args, "action")
+	var result any
+	var err error
+	switch strings.ToLower(strings.TrimSpace(action)) {
+	case "", "delete":
+		path, _ := stringArg(args, "path")
+		result, err = t.delete(path, boolArg(args, "recursive", false))
+	case "list":
+		var entries []trashEntry
+		entries, err = t.entries()
+		result = map[string]any{"entries": entries}
+	case "restore":
+		id, _ := stringArg(args, "id")
+		result, err = t.restore(id)
+	default:
+		return "", fmt.Errorf("unknown action %s", action)
+	}
+	if err != nil {
+		return "", err
+	}
+	data, err := jsonMarshalNoEscape(result)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+func (t *DeletePathTool) delete(path string, recursive bool) (trashEntry, error) {
+	if strings.TrimSpace(path) == "" {
+		return trashEntry{}, errors.New("path is required")
+	}
+	abs, err := t.guard.ResolveEntry(path)
+	if err != nil {
+		return trashEntry{}, err
+	}
+	rel := filepath.ToSlash(t.guard.Rel(abs))
+	if abs == t.guard.root {
+		return trashEntry{}, errors.New("cannot delete the workspace root")
+	}
+	if rel == ".git" || strings.HasPrefix(rel, ".git/") {
+		return trashEntry{}, errors.New("refusing to delete git metadata")
+	}
+	info, err := os.Lstat(abs)
+	if err != nil {
+		return trashEntry{}, fmt.Errorf("stat %s: %w", path, err)
+	}
+	entry := trashEntry{Path: rel, Type: typeOf(info.IsDir()), DeletedAt: time.Now().UTC()}
+	if info.IsDir() {
+		entry.Files, entry.Bytes = treeSize(abs)
+		if entry.Files > 0 && !recursive {
+			return trashEntry{}, fmt.Errorf("%s is a directory with %d files (%s); set recursive=true to delete it", rel, entry.Files, formatBytes(entry.Bytes))
+		}
+	} else {
+		entry.Files, entry.Bytes = 1, info.Size()
+	}
+
+	entry.ID = strconv.FormatInt(entry.DeletedAt.UnixNano(), 36)
+	itemDir := filepath.Join(t.trashDir, entry.ID)
+	if err := os.MkdirAll(itemDir, 0o755); err != nil {
+		return trashEntry{}, fmt.Errorf("create trash: %w", err)
+	}
+	if err := movePath(abs, filepath.Join(itemDir, filepath.Base(abs))); err != nil {
+		os.RemoveAll(itemDir)
+		return trashEntry{}, fmt.Errorf("move to trash: %w", err)
+	}
+	if err := t.writeMeta(entry); err != nil {
+		return trashEntry{}, err
+	}
+	t.log("delete", entry)
+	t.purgeExpired()
+	return entry, nil
+}
+
+func (t *DeletePathTool) restore(id string) (map[string]any, error) {
+	id = strings.TrimSpace(id)
+	if id == "" || strings.ContainsAny(id, `/\.`) {
+		return nil, errors.New("a valid trash id is required")
+	}
+	data, err := os.ReadFile(filepath.Join(t.trashDir, id+".json"))
+	if err != nil {
+		return nil, fmt.Errorf("trash entry %s not found", id)
+	}
+	var entry trashEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return nil, err
+	}
+	dst, err := t.guard.ResolveEntry(entry.Path)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := os.Lstat(dst); err == nil {
+		return nil, fmt.Errorf("%s exists again; move it away before restoring", entry.Path)
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+		return nil, err
+	}
+	itemDir := filepath.Join(t.trashDir, id)
+	if err := movePath(filepath.Join(itemDir, filepath.Base(dst)), dst); err != nil {
+		return nil, fmt.Errorf("restore: %w", err)
+	}
+	os.RemoveAll(itemDir)
+	os.Remove(filepath.Join(t.trashDir, id+".json"))
+	t.log("restore", entry)
+	return map[string]any{"restored": entry.Path, "id": id}, nil
+}
+
+// entries lists the trash, newest first.
+func (t *DeletePathTool) entries() ([]trashEntry, error) {
+	matches, err := filepath.Glob(filepath.Join(t.trashDir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	entries := []trashEntry{}
+	for _, match := range matches {
+		data, err := os.ReadFile(match)
+		if err != nil {
+			continue
+		}
+		var entry trashEntry
+		if json.Unmarshal(data, &entry) == nil && entry.ID != "" {
+			entries = append(entries, entry)
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].DeletedAt.After(entries[j].DeletedAt) })
+	return entries, nil
+}
+
+func (t *DeletePathTool) writeMeta(entry trashEntry) error {
+	data, err := json.MarshalIndent(entry, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(t.trashDir, entry.ID+".json"), data, 0o644)
+}
+
+// log appends to the trash audit log; failures do not fail the deletion.
+func (t *DeletePathTool) log(action string, entry trashEntry) {
+	record := struct {
+		Time   time.Time `json:"time"`
+		Action string    `json:"action"`
+		trashEntry
+	}{time.Now().UTC(), action, entry}
+	data, err := json.Marshal(record)
+	if err != nil {
+		return
+	}
+	f, err := os.OpenFile(filepath.Join(t.trashDir, trashLogFile), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	f.Write(append(data, '\n'))
+}
+
+// purgeExpired permanently removes entries older than trashRetention.
+func (t *DeletePathTool) purgeExpired() {
+	entries, err := t.entries()
+	if err != nil {
+		return
+	}
+	cutoff := time.Now().Add(-trashRetention)
+	for _, entry := range entries {
+		if entry.DeletedAt.Before(cutoff) {
+			os.RemoveAll(filepath.Join(t.trashDir, entry.ID))
+			os.Remove(filepath.Join(t.trashDir, entry.ID+".json"))
+			t.log("purge", entry)
+		}
+	}
+}
+
+func treeSize(root string) (files int, bytes int64) {
+	filepath.WalkDir(root, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return nil
+		}
+		files++
+		if info, err := d.Info(); err == nil {
+			bytes += info.Size()
+		}
+		return nil
+	})
+	return files, bytes
+}
+
+// movePath renames src to dst, copying when they are on different devices.
+func movePath(src, dst string) error {
+	if err := os.Rename(src, dst); err == nil {
+		return nil
+	}
+	if err := copyTree(src, dst); err != nil {
+		os.RemoveAll(dst)
+		return err
+	}
+	return os.RemoveAll(src)
+}
+
+func copyTree(src, dst string) error {
+	return filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(src, path)
+		target := filepath.Join(dst, rel)
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		switch {
+		case d.IsDir():
+			return os.MkdirAll(target, info.Mode().Perm()|0o700)
+		case d.Type()&fs.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(link, target)
+		}
+		in, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer in.Close()
+		out, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, info.Mode().Perm())
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(out, in); err != nil {
+			out.Close()
+			return err
+		}
+		return out.Close()
+	})
+}
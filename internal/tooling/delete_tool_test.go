@@ -0,0 +1,64 @@
+package tooling
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDeletePathTool(t *testing.T) {
+	guard, err := newPathGuard(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	tool := NewDeletePathTool(guard, filepath.Join(t.TempDir(), "trash"))
+	ctx := context.Background()
+	os.MkdirAll(filepath.Join(guard.root, "build", "out"), 0o755)
+	os.WriteFile(filepath.Join(guard.root, "build", "out", "app.bin"), []byte("binary"), 0o644)
+	os.WriteFile(filepath.Join(guard.root, "notes.txt"), []byte("keep me"), 0o644)
+
+	if _, err := tool.Call(ctx, map[string]any{"path": "build"}); err == nil || !strings.Contains(err.Error(), "recursive=true") {
+		t.Fatalf("non-recursive directory delete = %v", err)
+	}
+	if _, err := tool.Call(ctx, map[string]any{"path": "."}); err == nil {
+		t.Fatal("deleting the workspace root was allowed")
+	}
+	if _, err := tool.Call(ctx, map[string]any{"path": "build", "recursive": true}); err != nil {
+		t.Fatal(err)
+	}
+	out, err := tool.Call(ctx, map[string]any{"path": "notes.txt"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var deleted trashEntry
+	if err := json.Unmarshal([]byte(out), &deleted); err != nil || deleted.ID == "" {
+		t.Fatalf("delete result %q: %v", out, err)
+	}
+	if _, err := os.Stat(filepath.Join(guard.root, "notes.txt")); !os.IsNotExist(err) {
+		t.Fatal("file still in workspace after delete")
+	}
+
+	out, err = tool.Call(ctx, map[string]any{"action": "list"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var listed struct{ Entries []trashEntry }
+	json.Unmarshal([]byte(out), &listed)
+	if len(listed.Entries) != 2 || listed.Entries[0].Path != "notes.txt" || listed.Entries[1].Files != 1 {
+		t.Fatalf("trash = %+v", listed.Entries)
+	}
+
+	if _, err := tool.Call(ctx, map[string]any{"action": "restore", "id": deleted.ID}); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(filepath.Join(guard.root, "notes.txt"))
+	if err != nil || string(data) != "keep me" {
+		t.Fatalf("restored content = %q, %v", data, err)
+	}
+	if _, err := tool.Call(ctx, map[string]any{"action": "restore", "id": deleted.ID}); err == nil {
+		t.Error("restoring the same entry twice succeeded")
+	}
+}
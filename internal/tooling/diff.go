@@ -0,0 +1,276 @@
+package tooling
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"strings"
+)
+
+const (
+	// DiffContext is the number of unchanged lines shown around a change.
+	DiffContext = 3
+	// MaxDiffChars caps the diff of one file in tool events.
+	MaxDiffChars = 20000
+	// maxDiffCells bounds the exact line diff; beyond it the changed middle
+	// of a file shows as removed and re-added wholesale.
+	maxDiffCells = 4_000_000
+)
+
+// FileChange is a file a tool call is about to write: its content before
+// and after. Tools that modify files return these from PreviewChanges.
+type FileChange struct {
+	Path    string // Workspace-relative, slash-separated
+	Before  []byte
+	After   []byte
+	Existed bool // The file existed before the call
+	Exists  bool // The file exists after the call
+
+	abs string
+}
+
+// FileDiff is the unified diff of one file, as sent with tool events.
+type FileDiff struct {
+	Path      string `json:"path"`
+	Status    string `json:"status"` // added | modified | deleted
+	Diff      string `json:"diff,omitempty"`
+	Additions int    `json:"additions"`
+	Deletions int    `json:"deletions"`
+	Binary    bool   `json:"binary,omitempty"`
+	Truncated bool   `json:"truncated,omitempty"`
+}
+
+// ChangePreviewer is implemented by tools that modify files. PreviewChanges
+// works out what a call would write without touching the disk; it fails
+// where the call itself would.
+type ChangePreviewer interface {
+	PreviewChanges(args map[string]any) ([]FileChange, error)
+}
+
+// PreviewDiffs returns the diffs a call to tool would make, or nil when the
+// tool does not modify files or the call would fail.
+func PreviewDiffs(tool Tool, args map[string]any) []FileDiff {
+	previewer, ok := tool.(ChangePreviewer)
+	if !ok {
+		return nil
+	}
+	changes, err := previewer.PreviewChanges(args)
+	if err != nil {
+		return nil
+	}
+	return diffChanges(changes)
+}
+
+// AppliedDiffs diffs the files of changes, previewed before a call, against
+// what the call left on disk.
+func AppliedDiffs(changes []FileChange) []FileDiff {
+	applied := make([]FileChange, 0, len(changes))
+	for _, change := range changes {
+		data, err := os.ReadFile(change.abs)
+		change.After, change.Exists = data, err == nil
+		applied = append(applied, change)
+	}
+	return diffChanges(applied)
+}
+
+func diffChanges(changes []FileChange) []FileDiff {
+	var diffs []FileDiff
+	for _, change := range changes {
+		if diff, ok := Diff(change); ok {
+			diffs = append(diffs, diff)
+		}
+	}
+	return diffs
+}
+
+// Diff renders change as a unified diff with DiffContext lines of context.
+// ok is false when the content does not change.
+func Diff(change FileChange) (FileDiff, bool) {
+	diff := FileDiff{Path: change.Path, Status: "modified"}
+	switch {
+	case !change.Existed && !change.Exists:
+		return diff, false
+	case !change.Existed:
+		diff.Status = "added"
+	case !change.Exists:
+		diff.Status = "deleted"
+	case bytes.Equal(change.Before, change.After):
+		return diff, false
+	}
+	if isBinaryContent(change.Before) || isBinaryContent(change.After) {
+		diff.Binary = true
+		return diff, true
+	}
+
+	ops := lineOps(splitDiffLines(change.Before), splitDiffLines(change.After))
+	for _, op := range ops {
+		switch op.kind {
+		case '+':
+			diff.Additions++
+		case '-':
+			diff.Deletions++
+		}
+	}
+	from, to := "a/"+change.Path, "b/"+change.Path
+	if !change.Existed {
+		from = "/dev/null"
+	}
+	if !change.Exists {
+		to = "/dev/null"
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "--- %s\n+++ %s\n", from, to)
+	writeHunks(&b, ops, DiffContext)
+	diff.Diff = b.String()
+	if len(diff.Diff) > MaxDiffChars {
+		cut := strings.LastIndexByte(diff.Diff[:MaxDiffChars], '\n')
+		diff.Diff = diff.Diff[:cut+1]
+		diff.Truncated = true
+	}
+	return diff, true
+}
+
+func isBinaryContent(data []byte) bool {
+	return bytes.IndexByte(data[:min(len(data), 8000)], 0) >= 0
+}
+
+// splitDiffLines splits data into lines that keep their "\n", so a missing
+// final newline shows up as a change.
+func splitDiffLines(data []byte) []string {
+	if len(data) == 0 {
+		return nil
+	}
+	lines := strings.SplitAfter(string(data), "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+type diffOp struct {
+	kind byte // ' ', '-' or '+'
+	text string
+}
+
+// lineOps returns an edit script from a to b using the longest common
+// subsequence of their lines.
+func lineOps(a, b []string) []diffOp {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+	ops := make([]diffOp, 0, len(a)+len(b))
+	for _, line := range a[:prefix] {
+		ops = append(ops, diffOp{' ', line})
+	}
+	ma, mb := a[prefix:len(a)-suffix], b[prefix:len(b)-suffix]
+	n, m := len(ma), len(mb)
+	i, j := 0, 0
+	if n*m <= maxDiffCells {
+		// lcs[i*w+j] is the common subsequence length of ma[i:] and mb[j:]
+		w := m + 1
+		lcs := make([]int32, (n+1)*w)
+		for i := n - 1; i >= 0; i-- {
+			for j := m - 1; j >= 0; j-- {
+				if ma[i] == mb[j] {
+					lcs[i*w+j] = lcs[(i+1)*w+j+1] + 1
+				} else {
+					lcs[i*w+j] = max(lcs[(i+1)*w+j], lcs[i*w+j+1])
+				}
+			}
+		}
+		for i < n && j < m {
+			switch {
+			case ma[i] == mb[j]:
+				ops = append(ops, diffOp{' ', ma[i]})
+				i++
+				j++
+			case lcs[(i+1)*w+j] >= lcs[i*w+j+1]:
+				ops = append(ops, diffOp{'-', ma[i]})
+				i++
+			default:
+				ops = append(ops, diffOp{'+', mb[j]})
+				j++
+			}
+		}
+	}
+	for ; i < n; i++ {
+		ops = append(ops, diffOp{'-', ma[i]})
+	}
+	for ; j < m; j++ {
+		ops = append(ops, diffOp{'+', mb[j]})
+	}
+	for _, line := range a[len(a)-suffix:] {
+		ops = append(ops, diffOp{' ', line})
+	}
+	return ops
+}
+
+// writeHunks writes the changes in ops as unified diff hunks.
+func writeHunks(b *strings.Builder, ops []diffOp, context int) {
+	// aPos[i] and bPos[i] count the old and new lines before ops[i]
+	aPos := make([]int, len(ops)+1)
+	bPos := make([]int, len(ops)+1)
+	for i, op := range ops {
+		aPos[i+1], bPos[i+1] = aPos[i], bPos[i]
+		if op.kind != '+' {
+			aPos[i+1]++
+		}
+		if op.kind != '-' {
+			bPos[i+1]++
+		}
+	}
+	start, end := -1, -1
+	flush := func() {
+		if start < 0 {
+			return
+		}
+		aStart, aCount := aPos[start]+1, aPos[end]-aPos[start]
+		bStart, bCount := bPos[start]+1, bPos[end]-bPos[start]
+		if aCount == 0 {
+			aStart--
+		}
+		if bCount == 0 {
+			bStart--
+		}
+		fmt.Fprintf(b, "@@ -%d,%d +%d,%d @@\n", aStart, aCount, bStart, bCount)
+		for _, op := range ops[start:end] {
+			b.WriteByte(op.kind)
+			b.WriteString(strings.TrimSuffix(op.text, "\n"))
+			if !strings.HasSuffix(op.text, "\n") {
+				b.WriteString("\n\\ No newline at end of file")
+			}
+			b.WriteByte('\n')
+		}
+	}
+	for i, op := range ops {
+		if op.kind == ' ' {
+			continue
+		}
+		if start >= 0 && i-context < end {
+			end = min(i+context+1, len(ops))
+			continue
+		}
+		flush()
+		start, end = max(i-context, 0), min(i+context+1, len(ops))
+	}
+	flush()
+}
+
+// readForPreview returns a file's content and whether it exists.
+func readForPreview(abs string) ([]byte, bool, error) {
+	data, err := os.ReadFile(abs)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return data, true, nil
+}
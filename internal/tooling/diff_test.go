@@ -0,0 +1,125 @@
+package tooling
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	before := "a\nb\nc\nd\ne\nf\ng\nh\ni\nj\nk\nl\n"
+	after := "a\nB\nc\nd\ne\nf\ng\nh\ni\nj\nk\nl\nm"
+	diff, ok := Diff(FileChange{Path: "x.txt", Before: []byte(before), After: []byte(after), Existed: true, Exists: true})
+	if !ok {
+		t.Fatal("no diff")
+	}
+	want := `--- a/x.txt
++++ b/x.txt
+@@ -1,5 +1,5 @@
+ a
+-b
++B
+ c
+ d
+ e
+@@ -10,3 +10,4 @@
+ j
+ k
+ l
++m
+\ No newline at end of file
+`
+	if diff.Diff != want || diff.Additions != 2 || diff.Deletions != 1 || diff.Status != "modified" {
+		t.Errorf("diff = %+v\n%s", diff, diff.Diff)
+	}
+
+	added, _ := Diff(FileChange{Path: "new.txt", After: []byte("x\n"), Exists: true})
+	if added.Status != "added" || added.Diff != "--- /dev/null\n+++ b/new.txt\n@@ -0,0 +1,1 @@\n+x\n" {
+		t.Errorf("added = %+v", added)
+	}
+	if _, ok := Diff(FileChange{Path: "same", Before: []byte("x"), After: []byte("x"), Existed: true, Exists: true}); ok {
+		t.Error("unchanged file produced a diff")
+	}
+}
+
+func TestPreviewChanges(t *testing.T) {
+	dir := t.TempDir()
+	guard, err := newPathGuard(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "f.txt")
+	if err := os.WriteFile(path, []byte("one\ntwo\nthree\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name string
+		tool Tool
+		args map[string]any
+		want []string // Changed lines, per file
+	}{
+		{"write_file", NewWriteFileTool(guard), map[string]any{"path": "f.txt", "mode": "replace", "start_line": 2, "end_line": 2, "content": "TWO"}, []string{"-two\n+TWO"}},
+		{"edit_file", NewEditFileTool(guard), map[string]any{"path": "f.txt", "old_string": "three", "new_string": "3"}, []string{"-three\n+3"}},
+		{"apply_patch", NewApplyPatchTool(guard), map[string]any{"patch": `*** Begin Patch
+*** Update File: f.txt
+@@ -1 +1 @@
+-one
++1
+*** End Patch
+*** Begin Patch
+*** Update File: f.txt
+@@ -2 +2 @@
+-two
++2
+*** End Patch
+*** Begin Patch
+*** Add File: g.txt
++new
+*** End Patch`}, []string{"-one\n-two\n+1\n+2", "+new"}},
+	}
+	for _, tc := range cases {
+		diffs := PreviewDiffs(tc.tool, tc.args)
+		if len(diffs) != len(tc.want) {
+			t.Fatalf("%s: diffs = %+v", tc.name, diffs)
+		}
+		for i, want := range tc.want {
+			var changed []string
+			for _, line := range strings.Split(diffs[i].Diff, "\n") {
+				if (strings.HasPrefix(line, "+") || strings.HasPrefix(line, "-")) && !strings.HasPrefix(line, "+++") && !strings.HasPrefix(line, "---") {
+					changed = append(changed, line)
+				}
+			}
+			if got := strings.Join(changed, "\n"); got != want {
+				t.Errorf("%s: changed lines %q, want %q", tc.name, got, want)
+			}
+		}
+	}
+	if data, _ := os.ReadFile(path); string(data) != "one\ntwo\nthree\n" {
+		t.Errorf("preview wrote the file: %q", data)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "g.txt")); !os.IsNotExist(err) {
+		t.Error("preview created g.txt")
+	}
+
+	// The applied diff matches the preview
+	edit := NewEditFileTool(guard)
+	args := map[string]any{"path": "f.txt", "old_string": "two", "new_string": "2"}
+	changes, err := edit.PreviewChanges(args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	preview := diffChanges(changes)
+	if _, err := edit.Call(context.Background(), args); err != nil {
+		t.Fatal(err)
+	}
+	applied := AppliedDiffs(changes)
+	if len(applied) != 1 || applied[0] != preview[0] || applied[0].Additions != 1 || applied[0].Deletions != 1 {
+		t.Fatalf("applied = %+v, preview %+v", applied, preview)
+	}
+	if PreviewDiffs(edit, map[string]any{"path": "f.txt", "old_string": "missing", "new_string": "x"}) != nil {
+		t.Error("failing call produced a preview")
+	}
+}
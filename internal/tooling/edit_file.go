@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
 	"strings"
 )
 
@@ -42,6 +43,7 @@ func (EditFileTool) Definition() ToolDefinition {
 						"type":        "boolean",
 						"description": "If true, replace all occurrences. If false (default), old_string must be unique in the file.",
 					},
+					"confirm": confirmParam,
 				},
 				"required": []string{"path", "old_string", "new_string"},
 			},
@@ -56,35 +58,62 @@ func (e *EditFileTool) Call(ctx context.Context, args map[string]any) (string, e
 	default:
 	}
 
+	change, replacedCount, err := e.edit(args)
+	if err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(change.abs, change.After, 0644); err != nil {
+		return "", fmt.Errorf("write file: %w", err)
+	}
+
+	path, _ := stringArg(args, "path")
+	return fmt.Sprintf("Successfully replaced %d occurrence(s) in %s", replacedCount, path), nil
+}
+
+// PreviewChanges works out the file edit_file would leave, without writing it.
+func (e *EditFileTool) PreviewChanges(args map[string]any) ([]FileChange, error) {
+	change, _, err := e.edit(args)
+	if err != nil {
+		return nil, err
+	}
+	return []FileChange{change}, nil
+}
+
+// edit applies the replacement in memory and returns the resulting change
+// and how many occurrences it replaced.
+func (e *EditFileTool) edit(args map[string]any) (FileChange, int, error) {
 	path, ok := stringArg(args, "path")
 	if !ok || path == "" {
-		return "", errors.New("path is required")
+		return FileChange{}, 0, errors.New("path is required")
 	}
 
 	oldString, ok := stringArg(args, "old_string")
 	if !ok {
-		return "", errors.New("old_string is required")
+		return FileChange{}, 0, errors.New("old_string is required")
 	}
 
 	newString, ok := stringArg(args, "new_string")
 	if !ok {
-		return "", errors.New("new_string is required")
+		return FileChange{}, 0, errors.New("new_string is required")
 	}
 
 	if oldString == newString {
-		return "", errors.New("old_string and new_string must be different")
+		return FileChange{}, 0, errors.New("old_string and new_string must be different")
 	}
 
 	replaceAll := boolArg(args, "replace_all", false)
 
 	absPath, err := e.guard.Resolve(path)
 	if err != nil {
-		return "", err
+		return FileChange{}, 0, err
+	}
+	if err := e.guard.checkEditable(absPath, 0, boolArg(args, "confirm", false)); err != nil {
+		return FileChange{}, 0, err
 	}
 
 	content, err := os.ReadFile(absPath)
 	if err != nil {
-		return "", fmt.Errorf("read file: %w", err)
+		return FileChange{}, 0, fmt.Errorf("read file: %w", err)
 	}
 
 	contentStr := string(content)
@@ -95,28 +124,29 @@ func (e *EditFileTool) Call(ctx context.Context, args map[string]any) (string, e
 		if len(snippet) > maxPreview {
 			snippet = snippet[:maxPreview] + "…"
 		}
-		return "", fmt.Errorf("old_string not found. Double-check whitespace/indentation. Preview: %q", snippet)
+		return FileChange{}, 0, fmt.Errorf("old_string not found. Double-check whitespace/indentation. Preview: %q", snippet)
 	}
 
 	if !replaceAll && count > 1 {
-		return "", fmt.Errorf("old_string appears %d times in the file. Use replace_all=true to replace all occurrences, or provide a larger unique string", count)
+		return FileChange{}, 0, fmt.Errorf("old_string appears %d times in the file. Use replace_all=true to replace all occurrences, or provide a larger unique string", count)
 	}
 
 	var newContent string
+	replacedCount := count
 	if replaceAll {
 		newContent = strings.ReplaceAll(contentStr, oldString, newString)
 	} else {
 		newContent = strings.Replace(contentStr, oldString, newString, 1)
-	}
-
-	if err := os.WriteFile(absPath, []byte(newContent), 0644); err != nil {
-		return "", fmt.Errorf("write file: %w", err)
-	}
-
-	replacedCount := count
-	if !replaceAll {
 		replacedCount = 1
 	}
 
-	return fmt.Sprintf("Successfully replaced %d occurrence(s) in %s", replacedCount, path), nil
+	change := FileChange{
+		Path:    filepath.ToSlash(e.guard.Rel(absPath)),
+		Before:  content,
+		After:   []byte(newContent),
+		Existed: true,
+		Exists:  true,
+		abs:     absPath,
+	}
+	return change, replacedCount, nil
 }
@@ -0,0 +1,126 @@
+package tooling
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"cando/internal/githistory"
+)
+
+// GitHistoryTool answers questions about how code got the way it is: the
+// commits touching a path or symbol, who last changed each line, and what a
+// commit changed.
+type GitHistoryTool struct {
+	guard pathGuard
+}
+
+func NewGitHistoryTool(guard pathGuard) *GitHistoryTool {
+	return &GitHistoryTool{guard: guard}
+}
+
+func (GitHistoryTool) Definition() ToolDefinition {
+	return ToolDefinition{
+		Type: "function",
+		Function: ToolFunction{
+			Name:        "git_history",
+			Description: "Inspect git history with compact output. action=log lists recent commits (hash, date, author, subject, files) touching a path and/or changing lines that mention a symbol; action=blame shows which commit last changed each line of a file; action=show prints a commit's message, stats and patch. Use it when hunting bugs: regressions are usually explained by recent changes.",
+			Parameters: map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"action": map[string]any{
+						"type":        "string",
+						"enum":        []string{"log", "blame", "show"},
+						"description": "log, blame or show.",
+					},
+					"path": map[string]any{
+						"type":        "string",
+						"description": "File or directory relative to workspace root. Required for blame; narrows log and show.",
+					},
+					"symbol": map[string]any{
+						"type":        "string",
+						"description": "For log: only commits adding or removing lines that mention this identifier or text.",
+					},
+					"since": map[string]any{
+						"type":        "string",
+						"description": "For log: only commits after this date, e.g. \"2 weeks ago\" or \"2024-05-01\".",
+					},
+					"limit": map[string]any{
+						"type":        "integer",
+						"description": fmt.Sprintf("For log: number of commits (default %d, max %d).", githistory.DefaultLimit, githistory.MaxLimit),
+					},
+					"start_line": map[string]any{
+						"type":        "integer",
+						"description": "For blame: first line of the range (1-based).",
+					},
+					"end_line": map[string]any{
+						"type":        "integer",
+						"description": "For blame: last line of the range (inclusive).",
+					},
+					"ref": map[string]any{
+						"type":        "string",
+						"description": "For show: commit, tag or branch (default HEAD).",
+					},
+				},
+				"required": []string{"action"},
+			},
+		},
+	}
+}
+
+func (g *GitHistoryTool) Call(ctx context.Context, args map[string]any) (string, error) {
+	select {
+	case <-ctx.Done():
+		return "", ctx.Err()
+	default:
+	}
+
+	path := ""
+	if raw, ok := stringArg(args, "path"); ok && strings.TrimSpace(raw) != "" {
+		resolved, err := g.guard.Resolve(raw)
+		if err != nil {
+			return "", err
+		}
+		path = filepath.ToSlash(g.guard.Rel(resolved))
+	}
+
+	action, _ := stringArg(args, "action")
+	var (
+		out string
+		err error
+	)
+	switch action {
+	case "log":
+		opts := githistory.LogOptions{Limit: intArg(args, "limit", githistory.DefaultLimit)}
+		opts.Symbol, _ = stringArg(args, "symbol")
+		opts.Since, _ = stringArg(args, "since")
+		if path != "" {
+			opts.Paths = []string{path}
+		}
+		var commits []githistory.Commit
+		commits, err = githistory.Log(ctx, g.guard.root, opts)
+		if err == nil && len(commits) == 0 {
+			return "No matching commits.", nil
+		}
+		out = githistory.FormatLog(commits)
+	case "blame":
+		if path == "" {
+			return "", errors.New("blame needs a path")
+		}
+		out, err = githistory.Blame(ctx, g.guard.root, path, intArg(args, "start_line", 0), intArg(args, "end_line", 0))
+		if err == nil && out == "" {
+			return "No lines to blame.", nil
+		}
+	case "show":
+		ref, _ := stringArg(args, "ref")
+		out, err = githistory.Show(ctx, g.guard.root, strings.TrimSpace(ref), path, 0)
+	default:
+		return "", fmt.Errorf("unknown action %q (want log, blame or show)", action)
+	}
+	if errors.Is(err, githistory.ErrNotRepository) {
+		return "", errors.New("the workspace is not a git repository")
+	}
+	return out, err
+}
@@ -0,0 +1,209 @@
+package tooling
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"cando/internal/config"
+)
+
+func TestGitTools(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	repo := t.TempDir()
+	t.Setenv("GIT_CONFIG_GLOBAL", filepath.Join(repo, "gitconfig"))
+	t.Setenv("GIT_CONFIG_NOSYSTEM", "1")
+	git := func(args ...string) string {
+		t.Helper()
+		out, err := exec.Command("git", append([]string{"-C", repo}, args...)...).CombinedOutput()
+		if err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, out)
+		}
+		return strings.TrimSpace(string(out))
+	}
+	// The workspace is a subdirectory of the repository
+	workspace := filepath.Join(repo, "app")
+	write := func(rel, content string) {
+		t.Helper()
+		abs := filepath.Join(workspace, rel)
+		os.MkdirAll(filepath.Dir(abs), 0o755)
+		if err := os.WriteFile(abs, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	git("init", "-q", "-b", "main")
+	git("config", "user.name", "Repo Owner")
+	git("config", "user.email", "owner@example.com")
+	write("main.go", "package main\n")
+	write("old.go", "package main\n")
+	os.WriteFile(filepath.Join(repo, "outside.txt"), []byte("x"), 0o644)
+	git("add", "-A")
+	git("commit", "-q", "-m", "initial")
+
+	guard, err := newPathGuard(workspace)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	call := func(tool Tool, args map[string]any, v any) {
+		t.Helper()
+		out, err := tool.Call(ctx, args)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := json.Unmarshal([]byte(out), v); err != nil {
+			t.Fatalf("%s: %v", out, err)
+		}
+	}
+
+	write("main.go", "package main\n\nfunc main() {}\n")
+	write("notes/todo.md", "- ship\n")
+	os.Remove(filepath.Join(workspace, "old.go"))
+	os.WriteFile(filepath.Join(repo, "outside.txt"), []byte("changed"), 0o644)
+	git("add", "app/main.go")
+
+	var status GitStatus
+	call(NewGitStatusTool(guard), map[string]any{}, &status)
+	if status.Branch != "main" || status.Clean {
+		t.Errorf("status = %+v", status)
+	}
+	if len(status.Staged) != 1 || status.Staged[0] != (GitFileStatus{Path: "main.go", Status: "modified"}) {
+		t.Errorf("staged = %+v", status.Staged)
+	}
+	if len(status.Unstaged) != 1 || status.Unstaged[0].Path != "old.go" || status.Unstaged[0].Status != "deleted" {
+		t.Errorf("unstaged = %+v (changes outside the workspace must not show)", status.Unstaged)
+	}
+	if len(status.Untracked) != 1 || status.Untracked[0] != "notes/todo.md" {
+		t.Errorf("untracked = %v", status.Untracked)
+	}
+
+	var diff struct {
+		Files []GitFileStatus `json:"files"`
+		Patch string          `json:"patch"`
+	}
+	call(NewGitDiffTool(guard), map[string]any{"staged": true}, &diff)
+	if len(diff.Files) != 1 || diff.Files[0].Path != "main.go" || *diff.Files[0].Additions != 2 || *diff.Files[0].Deletions != 0 {
+		t.Errorf("staged diff files = %+v", diff.Files)
+	}
+	if !strings.Contains(diff.Patch, "+func main() {}") {
+		t.Errorf("staged patch = %q", diff.Patch)
+	}
+	if _, err := NewGitDiffTool(guard).Call(ctx, map[string]any{"ref": "--output=/tmp/x"}); err == nil {
+		t.Error("expected an option passed as ref to be refused")
+	}
+
+	author := config.GitAuthor{Name: "Cando Agent", Email: "agent@example.com"}
+	commit := NewGitCommitTool(guard, author)
+	var dry struct {
+		DryRun bool            `json:"dry_run"`
+		Author string          `json:"author"`
+		Files  []GitFileStatus `json:"files"`
+	}
+	call(commit, map[string]any{"message": "Add todo", "paths": []any{"notes", "old.go"}, "dry_run": true}, &dry)
+	if !dry.DryRun || dry.Author != "Cando Agent <agent@example.com>" || len(dry.Files) != 2 {
+		t.Errorf("dry run = %+v", dry)
+	}
+	if staged := git("diff", "--cached", "--name-only"); staged != "app/main.go" {
+		t.Errorf("dry run changed the index: %q", staged)
+	}
+
+	var result struct {
+		Hash  string          `json:"hash"`
+		Files []GitFileStatus `json:"files"`
+	}
+	call(commit, map[string]any{"message": "Add todo", "paths": []any{"notes", "old.go"}}, &result)
+	if result.Hash == "" || len(result.Files) != 2 {
+		t.Errorf("commit = %+v", result)
+	}
+	if got := git("log", "-1", "--format=%an <%ae>|%cn|%s"); got != "Cando Agent <agent@example.com>|Cando Agent|Add todo" {
+		t.Errorf("commit identity = %q", got)
+	}
+	if files := git("show", "--name-only", "--format=", "HEAD"); files != "app/notes/todo.md\napp/old.go" {
+		t.Errorf("committed files = %q", files)
+	}
+	if staged := git("diff", "--cached", "--name-only"); staged != "app/main.go" {
+		t.Errorf("other staged changes were not kept: %q", staged)
+	}
+
+	// Without paths, what is staged is committed with git's own identity
+	call(NewGitCommitTool(guard, config.GitAuthor{}), map[string]any{"message": "Add main"}, &result)
+	if got := git("log", "-1", "--format=%an|%s"); got != "Repo Owner|Add main" {
+		t.Errorf("staged commit = %q", got)
+	}
+	if _, err := commit.Call(ctx, map[string]any{"message": "Empty"}); err == nil || !strings.Contains(err.Error(), "nothing to commit") {
+		t.Errorf("empty commit error = %v", err)
+	}
+
+	var log struct {
+		Commits []struct {
+			Subject string `json:"subject"`
+		} `json:"commits"`
+	}
+	call(NewGitLogTool(guard), map[string]any{"paths": []any{"notes"}}, &log)
+	if len(log.Commits) != 1 || log.Commits[0].Subject != "Add todo" {
+		t.Errorf("log = %+v", log)
+	}
+
+	notRepo, _ := newPathGuard(t.TempDir())
+	if _, err := NewGitStatusTool(notRepo).Call(ctx, map[string]any{}); err != errNotGitRepo {
+		t.Errorf("outside a repository: %v", err)
+	}
+}
+
+func TestGitCommitSkipsRepositoryHooks(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	if runtime.GOOS == "windows" {
+		t.Skip("hooks are shell scripts")
+	}
+	repo := t.TempDir()
+	t.Setenv("GIT_CONFIG_GLOBAL", filepath.Join(repo, "gitconfig"))
+	t.Setenv("GIT_CONFIG_NOSYSTEM", "1")
+	git := func(args ...string) {
+		t.Helper()
+		if out, err := exec.Command("git", append([]string{"-C", repo}, args...)...).CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, out)
+		}
+	}
+	git("init", "-q", "-b", "main")
+	git("config", "user.name", "Repo Owner")
+	git("config", "user.email", "owner@example.com")
+
+	// Hooks in .git/hooks and in a hooksPath the workspace configures
+	marker := filepath.Join(t.TempDir(), "hook-ran")
+	hook := "#!/bin/sh\ntouch " + marker + "\n"
+	for _, dir := range []string{filepath.Join(repo, ".git", "hooks"), filepath.Join(repo, "githooks")} {
+		os.MkdirAll(dir, 0o755)
+		for _, name := range []string{"pre-commit", "commit-msg", "post-commit"} {
+			if err := os.WriteFile(filepath.Join(dir, name), []byte(hook), 0o755); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	os.WriteFile(filepath.Join(repo, "main.go"), []byte("package main\n"), 0o644)
+
+	guard, err := newPathGuard(repo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, hooksPath := range []string{"", "githooks"} {
+		if hooksPath != "" {
+			git("config", "core.hooksPath", hooksPath)
+			os.WriteFile(filepath.Join(repo, "main.go"), []byte("package main\n\nfunc main() {}\n"), 0o644)
+		}
+		if _, err := NewGitCommitTool(guard, config.GitAuthor{}).Call(context.Background(), map[string]any{"message": "Add main", "paths": []any{"main.go"}}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := os.Stat(marker); err == nil {
+			t.Fatalf("a repository hook ran on the host (hooksPath %q)", hooksPath)
+		}
+	}
+}
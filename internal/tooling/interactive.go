@@ -0,0 +1,48 @@
+package tooling
+
+import (
+	"context"
+	"errors"
+)
+
+// InteractiveRequest is a command handed to the user, who completes its
+// prompts in a terminal.
+type InteractiveRequest struct {
+	Command      []string // As the model asked for it
+	Args         []string // What to start, wrapped for the shell sandbox
+	Dir          string
+	Env          []string
+	Instructions string // What the model asks the user to do
+	// Stop, when set, ends the command in place of killing its process,
+	// such as the container behind a docker client.
+	Stop func() error
+}
+
+// InteractiveResult is how a handed-off command ended. EndedBy is "exit"
+// when the command finished, "user" when the user ended it, or "timeout".
+type InteractiveResult struct {
+	Output   string // Terminal output without escape codes, possibly cut
+	ExitCode int
+	EndedBy  string
+}
+
+// InteractiveRunner runs req in a terminal attached to the user and blocks
+// until it ends or ctx does.
+type InteractiveRunner func(ctx context.Context, req InteractiveRequest) (InteractiveResult, error)
+
+// ErrNoInteractiveRunner is returned for interactive commands in turns
+// without a user terminal to hand them to.
+var ErrNoInteractiveRunner = errors.New("no user terminal is attached to this turn; rerun the command with non-interactive flags (for example npm init -y)")
+
+type interactiveCtxKey struct{}
+
+// WithInteractiveRunner makes run the way shell commands with
+// interactive=true are handed to the user.
+func WithInteractiveRunner(ctx context.Context, run InteractiveRunner) context.Context {
+	return context.WithValue(ctx, interactiveCtxKey{}, run)
+}
+
+func interactiveRunnerFromContext(ctx context.Context) (InteractiveRunner, bool) {
+	run, ok := ctx.Value(interactiveCtxKey{}).(InteractiveRunner)
+	return run, ok && run != nil
+}
@@ -0,0 +1,56 @@
+package tooling
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestShellToolInteractive(t *testing.T) {
+	guard, err := newPathGuard(t.TempDir())
+	if err != nil {
+		t.Fatalf("newPathGuard: %v", err)
+	}
+	enabled := false
+	tool := &ShellTool{guard: guard, interactive: func() bool { return enabled }}
+	args := map[string]any{"command": []string{"npm", "init"}, "interactive": true, "instructions": " Accept the defaults "}
+
+	if _, ok := tool.Definition().Function.Parameters["properties"].(map[string]any)["interactive"]; ok {
+		t.Fatal("interactive parameter offered while disabled")
+	}
+	if _, err := tool.Call(context.Background(), args); err == nil {
+		t.Fatal("interactive call succeeded while disabled")
+	}
+
+	enabled = true
+	if _, ok := tool.Definition().Function.Parameters["properties"].(map[string]any)["interactive"]; !ok {
+		t.Fatal("interactive parameter missing while enabled")
+	}
+	if _, err := tool.Call(context.Background(), args); !errors.Is(err, ErrNoInteractiveRunner) {
+		t.Fatalf("err = %v, want ErrNoInteractiveRunner", err)
+	}
+
+	var got InteractiveRequest
+	ctx := WithInteractiveRunner(context.Background(), func(ctx context.Context, req InteractiveRequest) (InteractiveResult, error) {
+		got = req
+		return InteractiveResult{Output: "done", ExitCode: 0, EndedBy: "exit"}, nil
+	})
+	resp, err := tool.Call(ctx, args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Command[0] != "npm" || got.Instructions != "Accept the defaults" || got.Dir == "" {
+		t.Fatalf("request = %+v", got)
+	}
+	var result struct {
+		Output  string `json:"output"`
+		EndedBy string `json:"ended_by"`
+	}
+	if err := json.Unmarshal([]byte(resp), &result); err != nil {
+		t.Fatal(err)
+	}
+	if result.Output != "done" || result.EndedBy != "exit" {
+		t.Fatalf("result = %+v", result)
+	}
+}
@@ -0,0 +1,114 @@
+package tooling
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// DefaultLargeFileLimit is the size above which edit tools refuse to touch a
+// file unless the call sets confirm.
+const DefaultLargeFileLimit = 1 << 20
+
+// confirmParam is the edit tool parameter that overrides the large and
+// generated file guard.
+var confirmParam = map[string]any{
+	"type":        "boolean",
+	"description": "Set true to modify a file over the size limit or a generated/vendored file. Only after the user asked for this change.",
+}
+
+// vendoredDirs hold third-party or build output nobody should edit by hand.
+var vendoredDirs = map[string]bool{
+	"node_modules": true, "vendor": true, "third_party": true,
+	"bower_components": true, "dist": true, ".venv": true, "site-packages": true,
+}
+
+var generatedSuffixes = []string{
+	".min.js", ".min.css", ".pb.go", "_pb2.py", ".pb.cc", ".pb.h",
+	"_generated.go", ".generated.ts", ".g.dart", ".bundle.js", ".js.map",
+}
+
+var lockFiles = map[string]bool{
+	"package-lock.json": true, "yarn.lock": true, "pnpm-lock.yaml": true,
+	"Cargo.lock": true, "poetry.lock": true, "composer.lock": true, "go.sum": true,
+}
+
+// generatedMarker is the header Go and many other generators write.
+var generatedMarker = []byte("DO NOT EDIT")
+
+// checkEditable refuses to change abs when it is, or would become, larger
+// than the guard's size limit, or when it looks generated or vendored, unless
+// confirmed. incoming is the size of the content being written.
+func (p pathGuard) checkEditable(abs string, incoming int, confirmed bool) error {
+	if confirmed || p.largeFileLimit < 0 {
+		return nil
+	}
+	limit := p.largeFileLimit
+	if limit == 0 {
+		limit = DefaultLargeFileLimit
+	}
+	rel := filepath.ToSlash(p.Rel(abs))
+	size := int64(incoming)
+	if info, err := os.Stat(abs); err == nil && info.Mode().IsRegular() {
+		size = max(size, info.Size())
+		if reason := generatedReason(abs); reason != "" {
+			return fmt.Errorf("%s %s; hand edits are usually overwritten. Regenerate it instead, or ask the user and retry with confirm=true", rel, reason)
+		}
+	}
+	if size > limit {
+		return fmt.Errorf("%s is %s, over the %s limit for edits; a file this size is usually a bundle or data, not source. Ask the user, and retry with confirm=true only if they want it changed", rel, formatBytes(size), formatBytes(limit))
+	}
+	if reason := vendoredReason(rel); reason != "" {
+		return fmt.Errorf("%s %s; changes there are lost on the next install or build. Ask the user, and retry with confirm=true only if they want it changed", rel, reason)
+	}
+	return nil
+}
+
+// vendoredReason explains why a workspace-relative path looks like
+// third-party or generated output, judging by its name alone.
+func vendoredReason(rel string) string {
+	parts := strings.Split(rel, "/")
+	for _, dir := range parts[:len(parts)-1] {
+		if vendoredDirs[dir] {
+			return "is inside " + dir + "/"
+		}
+	}
+	name := parts[len(parts)-1]
+	if lockFiles[name] {
+		return "is a lock file maintained by the package manager"
+	}
+	for _, suffix := range generatedSuffixes {
+		if strings.HasSuffix(name, suffix) {
+			return "is generated (" + suffix + ")"
+		}
+	}
+	return ""
+}
+
+// generatedReason reports existing files whose header marks them generated.
+func generatedReason(abs string) string {
+	f, err := os.Open(abs)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	head := make([]byte, 1024)
+	n, _ := f.Read(head)
+	head = head[:n]
+	if i := bytes.Index(head, generatedMarker); i >= 0 && bytes.Contains(bytes.ToLower(head[:i]), []byte("generated")) {
+		return "is marked as generated code"
+	}
+	return ""
+}
+
+func formatBytes(n int64) string {
+	switch {
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1f MB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%d KB", n/(1<<10))
+	}
+	return fmt.Sprintf("%d bytes", n)
+}
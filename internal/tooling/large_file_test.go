@@ -0,0 +1,68 @@
+package tooling
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLargeFileGuard(t *testing.T) {
+	guard, err := newPathGuard(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	guard.largeFileLimit = 64
+	write := func(rel, content string) {
+		abs := filepath.Join(guard.root, rel)
+		os.MkdirAll(filepath.Dir(abs), 0o755)
+		if err := os.WriteFile(abs, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("bundle.txt", strings.Repeat("x", 100)+"\n")
+	write("small.go", "package small\n")
+	write("gen.go", "// Code generated by protoc. DO NOT EDIT.\npackage gen\n")
+	write("node_modules/pkg/index.js", "module.exports = 1\n")
+
+	edit := NewEditFileTool(guard)
+	tests := []struct {
+		path    string
+		confirm bool
+		refused string
+	}{
+		{"small.go", false, ""},
+		{"bundle.txt", false, "over the 64 bytes limit"},
+		{"bundle.txt", true, ""},
+		{"gen.go", false, "marked as generated"},
+		{"node_modules/pkg/index.js", false, "inside node_modules/"},
+	}
+	for _, tt := range tests {
+		old := map[string]string{"small.go": "small", "bundle.txt": "x", "gen.go": "gen", "node_modules/pkg/index.js": "1"}[tt.path]
+		_, err := edit.Call(context.Background(), map[string]any{
+			"path": tt.path, "old_string": old, "new_string": "y", "replace_all": true, "confirm": tt.confirm,
+		})
+		switch {
+		case tt.refused == "" && err != nil:
+			t.Errorf("%s: unexpected error %v", tt.path, err)
+		case tt.refused != "" && (err == nil || !strings.Contains(err.Error(), tt.refused)):
+			t.Errorf("%s: error = %v, want %q", tt.path, err, tt.refused)
+		}
+	}
+
+	// A patch is checked as a whole before any file is written
+	patch := NewApplyPatchTool(guard)
+	_, err = patch.Call(context.Background(), map[string]any{"patch": "*** Begin Patch\n*** Add File: notes.txt\n+hello\n*** End Patch\n*** Begin Patch\n*** Add File: dist/app.js\n+x\n*** End Patch"})
+	if err == nil || !strings.Contains(err.Error(), "inside dist/") {
+		t.Fatalf("patch error = %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(guard.root, "notes.txt")); !os.IsNotExist(err) {
+		t.Error("refused patch was partially applied")
+	}
+
+	guard.largeFileLimit = -1
+	if err := guard.checkEditable(filepath.Join(guard.root, "bundle.txt"), 0, false); err != nil {
+		t.Errorf("disabled guard refused: %v", err)
+	}
+}
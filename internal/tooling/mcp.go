@@ -0,0 +1,502 @@
+package tooling
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+
+	"cando/internal/config"
+)
+
+// mcpProtocolVersion is the MCP revision the client speaks. It is the one
+// that defines the SSE transport.
+const mcpProtocolVersion = "2024-11-05"
+
+const (
+	defaultMCPTimeout     = 60 * time.Second
+	defaultMCPResultBytes = 64 * 1024
+	// mcpConnectTimeout bounds starting a server and listing its tools, so a
+	// broken server only delays loading its workspace this long.
+	mcpConnectTimeout = 20 * time.Second
+	maxMCPToolPages   = 20
+)
+
+var mcpToolNameUnsafe = regexp.MustCompile(`[^A-Za-z0-9_-]`)
+
+// MCPServers holds a workspace's connections to its MCP servers.
+type MCPServers struct {
+	clients []*mcpClient
+	status  []MCPServerStatus
+}
+
+// MCPServerStatus describes one configured server for the settings UI.
+type MCPServerStatus struct {
+	Name      string   `json:"name"`
+	Transport string   `json:"transport"` // stdio | sse
+	Connected bool     `json:"connected"`
+	Error     string   `json:"error,omitempty"`
+	Tools     []string `json:"tools,omitempty"`
+}
+
+// ConnectMCPServers starts or dials the servers in parallel and lists their
+// tools. A server that fails is logged and reported by Status but does not
+// fail the others.
+func ConnectMCPServers(ctx context.Context, servers []config.MCPServer, workDir, clientVersion string, logger *log.Logger) *MCPServers {
+	m := &MCPServers{
+		clients: make([]*mcpClient, len(servers)),
+		status:  make([]MCPServerStatus, len(servers)),
+	}
+	ctx, cancel := context.WithTimeout(ctx, mcpConnectTimeout)
+	defer cancel()
+	var wg sync.WaitGroup
+	for i, server := range servers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			status := MCPServerStatus{Name: server.Name, Transport: "stdio"}
+			if server.URL != "" {
+				status.Transport = "sse"
+			}
+			client, err := connectMCP(ctx, server, workDir, clientVersion, logger)
+			if err != nil {
+				logger.Printf("MCP server %s unavailable: %v", server.Name, err)
+				status.Error = err.Error()
+				m.status[i] = status
+				return
+			}
+			status.Connected = true
+			for _, tool := range client.tools {
+				status.Tools = append(status.Tools, tool.Definition().Function.Name)
+			}
+			logger.Printf("MCP server %s connected with %d tools", server.Name, len(client.tools))
+			m.clients[i] = client
+			m.status[i] = status
+		}()
+	}
+	wg.Wait()
+	return m
+}
+
+// Tools returns the proxies for every connected server's tools. A tool whose
+// name clashes with an earlier one is left out.
+func (m *MCPServers) Tools() []Tool {
+	if m == nil {
+		return nil
+	}
+	var tools []Tool
+	seen := make(map[string]bool)
+	for _, client := range m.clients {
+		if client == nil {
+			continue
+		}
+		for _, tool := range client.tools {
+			name := tool.Definition().Function.Name
+			if seen[name] {
+				client.logger.Printf("MCP server %s: skipping duplicate tool %s", client.server.Name, name)
+				continue
+			}
+			seen[name] = true
+			tools = append(tools, tool)
+		}
+	}
+	return tools
+}
+
+// Status reports each configured server, connected or not.
+func (m *MCPServers) Status() []MCPServerStatus {
+	if m == nil {
+		return nil
+	}
+	out := make([]MCPServerStatus, len(m.status))
+	for i, status := range m.status {
+		if status.Connected && m.clients[i].closedErr() != nil {
+			status.Connected = false
+			status.Error = m.clients[i].closedErr().Error()
+		}
+		out[i] = status
+	}
+	return out
+}
+
+// Close stops stdio servers and drops SSE streams.
+func (m *MCPServers) Close() error {
+	if m == nil {
+		return nil
+	}
+	var errs []error
+	for _, client := range m.clients {
+		if client != nil {
+			if err := client.close(); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", client.server.Name, err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// mcpConn carries JSON-RPC messages to a server. Incoming messages are
+// handed to the client by the transport's read loop.
+type mcpConn interface {
+	send(ctx context.Context, msg []byte) error
+	close() error
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+type rpcMessage struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method,omitempty"`
+	Params  any             `json:"params,omitempty"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+}
+
+type mcpClient struct {
+	server    config.MCPServer
+	conn      mcpConn
+	logger    *log.Logger
+	timeout   time.Duration
+	maxResult int
+	tools     []*mcpTool
+
+	nextID  atomic.Int64
+	mu      sync.Mutex
+	pending map[int64]chan rpcMessage
+	err     error         // Why the connection ended
+	done    chan struct{} // Closed when the connection ends
+}
+
+func connectMCP(ctx context.Context, server config.MCPServer, workDir, clientVersion string, logger *log.Logger) (*mcpClient, error) {
+	c := &mcpClient{
+		server:    server,
+		logger:    logger,
+		timeout:   defaultMCPTimeout,
+		maxResult: defaultMCPResultBytes,
+		pending:   make(map[int64]chan rpcMessage),
+		done:      make(chan struct{}),
+	}
+	if server.TimeoutSeconds > 0 {
+		c.timeout = time.Duration(server.TimeoutSeconds) * time.Second
+	}
+	if server.MaxResultKB > 0 {
+		c.maxResult = server.MaxResultKB * 1024
+	}
+	var err error
+	if server.URL != "" {
+		c.conn, err = dialSSE(ctx, server, c.handle, c.shutdown)
+	} else {
+		c.conn, err = startStdio(server, workDir, logger, c.handle, c.shutdown)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := c.initialize(ctx, clientVersion); err != nil {
+		_ = c.close()
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *mcpClient) initialize(ctx context.Context, clientVersion string) error {
+	var info struct {
+		ProtocolVersion string `json:"protocolVersion"`
+		ServerInfo      struct {
+			Name    string `json:"name"`
+			Version string `json:"version"`
+		} `json:"serverInfo"`
+	}
+	err := c.call(ctx, "initialize", map[string]any{
+		"protocolVersion": mcpProtocolVersion,
+		"capabilities":    map[string]any{},
+		"clientInfo":      map[string]any{"name": "cando", "version": clientVersion},
+	}, &info)
+	if err != nil {
+		return err
+	}
+	if err := c.notify(ctx, "notifications/initialized", nil); err != nil {
+		return err
+	}
+	c.logger.Printf("MCP server %s is %s %s (protocol %s)", c.server.Name, info.ServerInfo.Name, info.ServerInfo.Version, info.ProtocolVersion)
+
+	cursor := ""
+	for range maxMCPToolPages {
+		params := map[string]any{}
+		if cursor != "" {
+			params["cursor"] = cursor
+		}
+		var page struct {
+			Tools []struct {
+				Name        string         `json:"name"`
+				Description string         `json:"description"`
+				InputSchema map[string]any `json:"inputSchema"`
+			} `json:"tools"`
+			NextCursor string `json:"nextCursor"`
+		}
+		if err := c.call(ctx, "tools/list", params, &page); err != nil {
+			return err
+		}
+		for _, tool := range page.Tools {
+			c.tools = append(c.tools, newMCPTool(c, tool.Name, tool.Description, tool.InputSchema))
+		}
+		if page.NextCursor == "" {
+			break
+		}
+		cursor = page.NextCursor
+	}
+	return nil
+}
+
+// call sends a request and waits for its response, the connection to end,
+// or ctx. A request abandoned on ctx is cancelled on the server.
+func (c *mcpClient) call(ctx context.Context, method string, params, result any) error {
+	id := c.nextID.Add(1)
+	ch := make(chan rpcMessage, 1)
+	c.mu.Lock()
+	if c.err != nil {
+		c.mu.Unlock()
+		return c.err
+	}
+	c.pending[id] = ch
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		delete(c.pending, id)
+		c.mu.Unlock()
+	}()
+
+	if params == nil {
+		params = map[string]any{}
+	}
+	msg, err := json.Marshal(rpcMessage{JSONRPC: "2.0", ID: json.RawMessage(fmt.Sprint(id)), Method: method, Params: params})
+	if err != nil {
+		return err
+	}
+	if err := c.conn.send(ctx, msg); err != nil {
+		return fmt.Errorf("%s: %w", method, err)
+	}
+	select {
+	case resp := <-ch:
+		if resp.Error != nil {
+			return fmt.Errorf("%s: %s (code %d)", method, resp.Error.Message, resp.Error.Code)
+		}
+		if result == nil {
+			return nil
+		}
+		if err := json.Unmarshal(resp.Result, result); err != nil {
+			return fmt.Errorf("%s: parse result: %w", method, err)
+		}
+		return nil
+	case <-c.done:
+		return c.closedErr()
+	case <-ctx.Done():
+		cancelCtx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		_ = c.notify(cancelCtx, "notifications/cancelled", map[string]any{"requestId": id, "reason": ctx.Err().Error()})
+		return ctx.Err()
+	}
+}
+
+func (c *mcpClient) notify(ctx context.Context, method string, params any) error {
+	msg, err := json.Marshal(rpcMessage{JSONRPC: "2.0", Method: method, Params: params})
+	if err != nil {
+		return err
+	}
+	return c.conn.send(ctx, msg)
+}
+
+// handle dispatches one incoming message or batch. Server requests get an
+// answer for ping and "method not found" for everything else, since the
+// client offers no capabilities.
+func (c *mcpClient) handle(data []byte) {
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 {
+		return
+	}
+	if data[0] == '[' {
+		var batch []json.RawMessage
+		if err := json.Unmarshal(data, &batch); err != nil {
+			c.logger.Printf("MCP server %s sent an invalid batch: %v", c.server.Name, err)
+			return
+		}
+		for _, item := range batch {
+			c.handle(item)
+		}
+		return
+	}
+	var msg rpcMessage
+	if err := json.Unmarshal(data, &msg); err != nil {
+		c.logger.Printf("MCP server %s sent invalid JSON: %.200s", c.server.Name, data)
+		return
+	}
+	switch {
+	case msg.Method != "" && len(msg.ID) > 0:
+		reply := rpcMessage{JSONRPC: "2.0", ID: msg.ID}
+		if msg.Method == "ping" {
+			reply.Result = json.RawMessage("{}")
+		} else {
+			reply.Error = &rpcError{Code: -32601, Message: "method not supported by client: " + msg.Method}
+		}
+		out, _ := json.Marshal(reply)
+		go func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			_ = c.conn.send(ctx, out)
+		}()
+	case msg.Method != "":
+		if msg.Method == "notifications/tools/list_changed" {
+			c.logger.Printf("MCP server %s changed its tools; reload the workspace to pick them up", c.server.Name)
+		}
+	default:
+		var id int64
+		if err := json.Unmarshal(msg.ID, &id); err != nil {
+			return
+		}
+		c.mu.Lock()
+		ch, ok := c.pending[id]
+		c.mu.Unlock()
+		if ok {
+			ch <- msg
+		}
+	}
+}
+
+// shutdown records why the connection ended and fails pending calls.
+func (c *mcpClient) shutdown(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil {
+		return
+	}
+	if err == nil {
+		err = errors.New("connection closed")
+	}
+	c.err = fmt.Errorf("MCP server %s: %w", c.server.Name, err)
+	close(c.done)
+}
+
+func (c *mcpClient) closedErr() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err
+}
+
+func (c *mcpClient) close() error {
+	err := c.conn.close()
+	c.shutdown(errors.New("closed"))
+	return err
+}
+
+// mcpTool proxies one server tool as mcp_<server>_<tool>.
+type mcpTool struct {
+	client *mcpClient
+	remote string
+	def    ToolDefinition
+}
+
+func newMCPTool(client *mcpClient, name, description string, schema map[string]any) *mcpTool {
+	local := mcpToolNameUnsafe.ReplaceAllString("mcp_"+client.server.Name+"_"+name, "_")
+	if len(local) > 64 {
+		local = local[:64]
+	}
+	if schema == nil {
+		schema = map[string]any{"type": "object", "properties": map[string]any{}}
+	}
+	description = strings.TrimSpace(description)
+	if description == "" {
+		description = name
+	}
+	return &mcpTool{
+		client: client,
+		remote: name,
+		def: ToolDefinition{
+			Type: "function",
+			Function: ToolFunction{
+				Name:        local,
+				Description: fmt.Sprintf("[MCP server %s] %s", client.server.Name, description),
+				Parameters:  schema,
+			},
+		},
+	}
+}
+
+func (t *mcpTool) Definition() ToolDefinition {
+	return t.def
+}
+
+func (t *mcpTool) Call(ctx context.Context, args map[string]any) (string, error) {
+	if args == nil {
+		args = map[string]any{}
+	}
+	callCtx, cancel := context.WithTimeout(ctx, t.client.timeout)
+	defer cancel()
+	var result struct {
+		Content []mcpContent `json:"content"`
+		IsError bool         `json:"isError"`
+	}
+	err := t.client.call(callCtx, "tools/call", map[string]any{"name": t.remote, "arguments": args}, &result)
+	if errors.Is(err, context.DeadlineExceeded) && ctx.Err() == nil {
+		return "", fmt.Errorf("MCP server %s did not finish %s within %s", t.client.server.Name, t.remote, t.client.timeout)
+	}
+	if err != nil {
+		return "", err
+	}
+	text := truncateMCPResult(mcpContentText(result.Content), t.client.maxResult)
+	if result.IsError {
+		return "", errors.New(text)
+	}
+	return text, nil
+}
+
+type mcpContent struct {
+	Type     string `json:"type"`
+	Text     string `json:"text"`
+	MimeType string `json:"mimeType"`
+	Data     string `json:"data"`
+	Resource *struct {
+		URI  string `json:"uri"`
+		Text string `json:"text"`
+	} `json:"resource"`
+}
+
+// mcpContentText flattens a tool result for the model. Binary parts are
+// described rather than inlined.
+func mcpContentText(content []mcpContent) string {
+	parts := make([]string, 0, len(content))
+	for _, c := range content {
+		switch {
+		case c.Type == "text":
+			parts = append(parts, c.Text)
+		case c.Type == "resource" && c.Resource != nil && c.Resource.Text != "":
+			parts = append(parts, c.Resource.Text)
+		case c.Type == "resource" && c.Resource != nil:
+			parts = append(parts, fmt.Sprintf("[resource %s]", c.Resource.URI))
+		default:
+			parts = append(parts, fmt.Sprintf("[%s content %s, %d bytes base64 omitted]", c.Type, c.MimeType, len(c.Data)))
+		}
+	}
+	return strings.Join(parts, "\n")
+}
+
+func truncateMCPResult(text string, limit int) string {
+	if len(text) <= limit {
+		return text
+	}
+	cut := limit
+	for cut > 0 && !utf8.RuneStart(text[cut]) {
+		cut--
+	}
+	return fmt.Sprintf("%s\n[truncated: result was %d bytes, limit %d]", text[:cut], len(text), limit)
+}
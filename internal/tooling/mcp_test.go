@@ -0,0 +1,178 @@
+package tooling
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"cando/internal/config"
+)
+
+// fakeMCPReply answers one request the way a small MCP server would. It
+// returns nil for notifications.
+func fakeMCPReply(data []byte) []byte {
+	var req struct {
+		ID     json.RawMessage `json:"id"`
+		Method string          `json:"method"`
+		Params struct {
+			Cursor    string         `json:"cursor"`
+			Name      string         `json:"name"`
+			Arguments map[string]any `json:"arguments"`
+		} `json:"params"`
+	}
+	if json.Unmarshal(data, &req) != nil || len(req.ID) == 0 {
+		return nil
+	}
+	var result any
+	text := func(s string, isError bool) any {
+		return map[string]any{"content": []any{map[string]any{"type": "text", "text": s}}, "isError": isError}
+	}
+	switch req.Method {
+	case "initialize":
+		result = map[string]any{"protocolVersion": mcpProtocolVersion, "serverInfo": map[string]any{"name": "fake", "version": "1"}}
+	case "tools/list":
+		if req.Params.Cursor == "" {
+			result = map[string]any{"tools": []any{map[string]any{"name": "echo", "description": "Echo text", "inputSchema": map[string]any{"type": "object"}}}, "nextCursor": "2"}
+		} else {
+			result = map[string]any{"tools": []any{map[string]any{"name": "big.dump"}, map[string]any{"name": "slow"}, map[string]any{"name": "fail"}}}
+		}
+	case "tools/call":
+		switch req.Params.Name {
+		case "echo":
+			result = text(fmt.Sprint(req.Params.Arguments["text"]), false)
+		case "big.dump":
+			result = text(strings.Repeat("x", 3000), false)
+		case "slow":
+			time.Sleep(2 * time.Second)
+			result = text("late", false)
+		default:
+			result = text("no such file", true)
+		}
+	default:
+		out, _ := json.Marshal(map[string]any{"jsonrpc": "2.0", "id": req.ID, "error": map[string]any{"code": -32601, "message": "unknown method"}})
+		return out
+	}
+	out, _ := json.Marshal(map[string]any{"jsonrpc": "2.0", "id": req.ID, "result": result})
+	return out
+}
+
+// TestMCPHelperProcess is the stdio server started by TestMCPStdio.
+func TestMCPHelperProcess(t *testing.T) {
+	if os.Getenv("CANDO_MCP_HELPER") != "1" {
+		t.Skip("helper process")
+	}
+	scanner := bufio.NewScanner(os.Stdin)
+	for scanner.Scan() {
+		line := append([]byte(nil), scanner.Bytes()...)
+		go func() {
+			if reply := fakeMCPReply(line); reply != nil {
+				fmt.Println(string(reply))
+			}
+		}()
+	}
+	os.Exit(0)
+}
+
+func checkMCPTools(t *testing.T, servers *MCPServers) {
+	t.Helper()
+	tools := servers.Tools()
+	var names []string
+	byName := map[string]Tool{}
+	for _, tool := range tools {
+		name := tool.Definition().Function.Name
+		names = append(names, name)
+		byName[name] = tool
+	}
+	if strings.Join(names, ",") != "mcp_fake_echo,mcp_fake_big_dump,mcp_fake_slow,mcp_fake_fail" {
+		t.Fatalf("tools = %v, status = %+v", names, servers.Status())
+	}
+	ctx := context.Background()
+	if out, err := byName["mcp_fake_echo"].Call(ctx, map[string]any{"text": "hello"}); err != nil || out != "hello" {
+		t.Errorf("echo = %q, %v", out, err)
+	}
+	out, err := byName["mcp_fake_big_dump"].Call(ctx, nil)
+	if err != nil || !strings.HasPrefix(out, strings.Repeat("x", 1024)+"\n[truncated: result was 3000 bytes, limit 1024]") {
+		t.Errorf("big = %.80q, %v", out, err)
+	}
+	if _, err := byName["mcp_fake_fail"].Call(ctx, nil); err == nil || err.Error() != "no such file" {
+		t.Errorf("fail = %v", err)
+	}
+	if _, err := byName["mcp_fake_slow"].Call(ctx, nil); err == nil || !strings.Contains(err.Error(), "within 1s") {
+		t.Errorf("slow = %v", err)
+	}
+}
+
+func TestMCPStdio(t *testing.T) {
+	t.Setenv("CANDO_MCP_HELPER", "1")
+	servers := ConnectMCPServers(context.Background(), []config.MCPServer{
+		{Name: "fake", Command: os.Args[0], Args: []string{"-test.run=TestMCPHelperProcess"}, TimeoutSeconds: 1, MaxResultKB: 1},
+		{Name: "missing", Command: "/nonexistent/mcp-server"},
+	}, t.TempDir(), "test", log.New(io.Discard, "", 0))
+	defer servers.Close()
+
+	checkMCPTools(t, servers)
+	status := servers.Status()
+	if !status[0].Connected || status[0].Transport != "stdio" || status[1].Connected || status[1].Error == "" {
+		t.Errorf("status = %+v", status)
+	}
+	if err := servers.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if servers.Status()[0].Connected {
+		t.Error("closed server still reported connected")
+	}
+}
+
+func TestMCPSSE(t *testing.T) {
+	messages := make(chan []byte, 16)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/sse":
+			w.Header().Set("Content-Type", "text/event-stream")
+			fmt.Fprint(w, ": hello\n\nevent: endpoint\ndata: /messages?session=1\n\n")
+			w.(http.Flusher).Flush()
+			for {
+				select {
+				case msg := <-messages:
+					fmt.Fprintf(w, "event: message\ndata: %s\n\n", msg)
+					w.(http.Flusher).Flush()
+				case <-r.Context().Done():
+					return
+				}
+			}
+		case "/messages":
+			body, _ := io.ReadAll(r.Body)
+			w.WriteHeader(http.StatusAccepted)
+			go func() {
+				if reply := fakeMCPReply(body); reply != nil {
+					messages <- reply
+				}
+			}()
+		}
+	}))
+	defer srv.Close()
+	t.Setenv("FAKE_MCP_TOKEN", "secret")
+
+	servers := ConnectMCPServers(context.Background(), []config.MCPServer{{
+		Name: "fake", URL: srv.URL + "/sse", Headers: map[string]string{"Authorization": "Bearer $FAKE_MCP_TOKEN"},
+		TimeoutSeconds: 1, MaxResultKB: 1,
+	}}, t.TempDir(), "test", log.New(io.Discard, "", 0))
+	defer servers.Close()
+	checkMCPTools(t, servers)
+	if status := servers.Status(); status[0].Transport != "sse" || !status[0].Connected {
+		t.Errorf("status = %+v", status)
+	}
+}
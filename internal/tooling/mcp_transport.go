@@ -0,0 +1,254 @@
+package tooling
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"cando/internal/config"
+)
+
+// mcpStopGrace is how long a stdio server gets to exit after its stdin is
+// closed before it is killed.
+const mcpStopGrace = 3 * time.Second
+
+// stdioConn runs a server as a child process speaking newline-delimited
+// JSON-RPC on stdin and stdout. Its stderr goes to the log.
+type stdioConn struct {
+	cmd     *exec.Cmd
+	stdin   io.WriteCloser
+	writeMu sync.Mutex
+	exited  chan struct{}
+}
+
+func startStdio(server config.MCPServer, workDir string, logger *log.Logger, deliver func([]byte), onClose func(error)) (*stdioConn, error) {
+	cmd := exec.Command(server.Command, server.Args...)
+	cmd.Dir = workDir
+	cmd.Env = os.Environ()
+	for key, value := range server.Env {
+		cmd.Env = append(cmd.Env, key+"="+os.ExpandEnv(value))
+	}
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("start %s: %w", server.Command, err)
+	}
+	c := &stdioConn{cmd: cmd, stdin: stdin, exited: make(chan struct{})}
+
+	go func() {
+		scanner := bufio.NewScanner(stderr)
+		for scanner.Scan() {
+			logger.Printf("MCP server %s: %s", server.Name, scanner.Text())
+		}
+	}()
+	go func() {
+		reader := bufio.NewReader(stdout)
+		for {
+			line, err := reader.ReadBytes('\n')
+			if len(bytes.TrimSpace(line)) > 0 {
+				deliver(line)
+			}
+			if err != nil {
+				break
+			}
+		}
+		waitErr := cmd.Wait()
+		close(c.exited)
+		if waitErr == nil {
+			waitErr = errors.New("exited")
+		} else {
+			waitErr = fmt.Errorf("exited: %w", waitErr)
+		}
+		onClose(waitErr)
+	}()
+	return c, nil
+}
+
+func (c *stdioConn) send(ctx context.Context, msg []byte) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	select {
+	case <-c.exited:
+		return errors.New("server has exited")
+	case <-ctx.Done():
+		return ctx.Err()
+	default:
+	}
+	_, err := c.stdin.Write(append(msg, '\n'))
+	return err
+}
+
+func (c *stdioConn) close() error {
+	_ = c.stdin.Close()
+	select {
+	case <-c.exited:
+		return nil
+	case <-time.After(mcpStopGrace):
+	}
+	if err := c.cmd.Process.Kill(); err != nil && !errors.Is(err, os.ErrProcessDone) {
+		return err
+	}
+	<-c.exited
+	return nil
+}
+
+// sseConn receives messages on a server-sent event stream and posts requests
+// to the endpoint the server announces in its first event.
+type sseConn struct {
+	endpoint string
+	headers  map[string]string
+	cancel   context.CancelFunc
+	client   *http.Client
+}
+
+func dialSSE(ctx context.Context, server config.MCPServer, deliver func([]byte), onClose func(error)) (*sseConn, error) {
+	headers := make(map[string]string, len(server.Headers))
+	for key, value := range server.Headers {
+		headers[key] = os.ExpandEnv(value)
+	}
+	// The stream outlives ctx, which only bounds the connect
+	streamCtx, cancel := context.WithCancel(context.Background())
+	req, err := http.NewRequestWithContext(streamCtx, http.MethodGet, server.URL, nil)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+
+	type dialResult struct {
+		resp *http.Response
+		err  error
+	}
+	dialed := make(chan dialResult, 1)
+	go func() {
+		resp, err := http.DefaultClient.Do(req)
+		dialed <- dialResult{resp, err}
+	}()
+	var resp *http.Response
+	select {
+	case r := <-dialed:
+		if r.err != nil {
+			cancel()
+			return nil, fmt.Errorf("connect: %w", r.err)
+		}
+		resp = r.resp
+	case <-ctx.Done():
+		cancel()
+		return nil, fmt.Errorf("connect: %w", ctx.Err())
+	}
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		resp.Body.Close()
+		cancel()
+		return nil, fmt.Errorf("connect: server returned %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	endpoint := make(chan string, 1)
+	go func() {
+		defer resp.Body.Close()
+		err := readSSE(resp.Body, func(event, data string) {
+			switch event {
+			case "endpoint":
+				select {
+				case endpoint <- data:
+				default:
+				}
+			case "message", "":
+				deliver([]byte(data))
+			}
+		})
+		if err == nil {
+			err = errors.New("event stream ended")
+		}
+		onClose(err)
+	}()
+
+	select {
+	case raw := <-endpoint:
+		base, _ := url.Parse(server.URL)
+		ref, err := url.Parse(strings.TrimSpace(raw))
+		if err != nil {
+			cancel()
+			return nil, fmt.Errorf("invalid endpoint event %q: %w", raw, err)
+		}
+		return &sseConn{endpoint: base.ResolveReference(ref).String(), headers: headers, cancel: cancel, client: &http.Client{Timeout: defaultMCPTimeout}}, nil
+	case <-ctx.Done():
+		cancel()
+		return nil, errors.New("no endpoint event from server")
+	}
+}
+
+// readSSE calls fn for each event on r until the stream ends.
+func readSSE(r io.Reader, fn func(event, data string)) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	var event string
+	var data []string
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case line == "":
+			if len(data) > 0 {
+				fn(event, strings.Join(data, "\n"))
+			}
+			event, data = "", nil
+		case strings.HasPrefix(line, ":"):
+		case strings.HasPrefix(line, "event:"):
+			event = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+		case strings.HasPrefix(line, "data:"):
+			data = append(data, strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " "))
+		}
+	}
+	return scanner.Err()
+}
+
+func (c *sseConn) send(ctx context.Context, msg []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.endpoint, bytes.NewReader(msg))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range c.headers {
+		req.Header.Set(key, value)
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("server returned %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	return nil
+}
+
+func (c *sseConn) close() error {
+	c.cancel()
+	return nil
+}
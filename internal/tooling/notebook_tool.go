@@ -0,0 +1,320 @@
+package tooling
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const (
+	maxNotebookOutputChars = 2000 // Per output, so large tracebacks or tables stay readable
+	maxNotebookOutputs     = 5    // Per cell
+)
+
+// NotebookTool reads and edits Jupyter notebooks cell by cell, so the model
+// never has to edit raw notebook JSON.
+type NotebookTool struct {
+	guard pathGuard
+}
+
+func NewNotebookTool(guard pathGuard) *NotebookTool {
+	return &NotebookTool{guard: guard}
+}
+
+// notebookCell is the structured view of a cell returned by "read".
+type notebookCell struct {
+	Index          int      `json:"index"`
+	Type           string   `json:"type"`
+	Source         string   `json:"source"`
+	ExecutionCount any      `json:"execution_count,omitempty"`
+	Outputs        []string `json:"outputs,omitempty"`
+}
+
+func (NotebookTool) Definition() ToolDefinition {
+	return ToolDefinition{
+		Type: "function",
+		Function: ToolFunction{
+			Name:        "notebook",
+			Description: "Read or edit a Jupyter notebook (.ipynb) by cell. Use this instead of read_file/edit_file for notebooks. action=read lists cells with their type, source and trimmed outputs; edit replaces a cell's source (clearing its outputs); insert adds a cell before index (index = cell count appends); delete removes a cell. Cell indexes are 0-based.",
+			Parameters: map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"action": map[string]any{
+						"type": "string",
+						"enum": []string{"read", "edit", "insert", "delete"},
+					},
+					"path": map[string]any{
+						"type":        "string",
+						"description": "Notebook path relative to workspace root.",
+					},
+					"index": map[string]any{
+						"type":        "integer",
+						"description": "Cell index for edit/insert/delete; for read, the first cell to show.",
+					},
+					"count": map[string]any{
+						"type":        "integer",
+						"description": "For read: number of cells to show (default all).",
+					},
+					"source": map[string]any{
+						"type":        "string",
+						"description": "New cell source for edit/insert.",
+					},
+					"cell_type": map[string]any{
+						"type":        "string",
+						"enum":        []string{"code", "markdown", "raw"},
+						"description": "Cell type for insert (default code) or to change it on edit.",
+					},
+				},
+				"required": []string{"action", "path"},
+			},
+		},
+	}
+}
+
+func (n *NotebookTool) Call(ctx context.Context, args map[string]any) (string, error) {
+	select {
+	case <-ctx.Done():
+		return "", ctx.Err()
+	default:
+	}
+
+	action, _ := stringArg(args, "action")
+	path, ok := stringArg(args, "path")
+	if !ok || path == "" {
+		return "", errors.New("path is required")
+	}
+	if !strings.EqualFold(filepath.Ext(path), ".ipynb") {
+		return "", errors.New("path must be a .ipynb notebook")
+	}
+	absPath, err := n.guard.Resolve(path)
+	if err != nil {
+		return "", err
+	}
+	data, err := os.ReadFile(absPath)
+	if err != nil {
+		return "", fmt.Errorf("read notebook: %w", err)
+	}
+	// Cells stay generic maps so fields this tool does not know survive edits
+	var nb map[string]any
+	if err := json.Unmarshal(data, &nb); err != nil {
+		return "", fmt.Errorf("parse notebook: %w", err)
+	}
+	cells, _ := nb["cells"].([]any)
+	index := intArg(args, "index", -1)
+
+	switch action {
+	case "read":
+		start := max(index, 0)
+		end := len(cells)
+		if count := intArg(args, "count", 0); count > 0 {
+			end = min(start+count, len(cells))
+		}
+		view := make([]notebookCell, 0, max(end-start, 0))
+		for i := start; i < end; i++ {
+			cell, _ := cells[i].(map[string]any)
+			view = append(view, describeNotebookCell(i, cell))
+		}
+		out, err := jsonMarshalNoEscape(map[string]any{
+			"path":       n.guard.Rel(absPath),
+			"cell_count": len(cells),
+			"language":   notebookLanguage(nb),
+			"cells":      view,
+		})
+		return string(out), err
+
+	case "edit":
+		if index < 0 || index >= len(cells) {
+			return "", fmt.Errorf("index %d out of range (notebook has %d cells)", index, len(cells))
+		}
+		source, ok := stringArg(args, "source")
+		if !ok {
+			return "", errors.New("source is required for edit")
+		}
+		cell, _ := cells[index].(map[string]any)
+		if cell == nil {
+			return "", fmt.Errorf("cell %d is malformed", index)
+		}
+		if cellType, ok := stringArg(args, "cell_type"); ok && cellType != "" {
+			if err := validCellType(cellType); err != nil {
+				return "", err
+			}
+			cell["cell_type"] = cellType
+		}
+		setNotebookCellSource(cell, source)
+
+	case "insert":
+		if index < 0 || index > len(cells) {
+			return "", fmt.Errorf("index %d out of range (0-%d)", index, len(cells))
+		}
+		source, _ := stringArg(args, "source")
+		cellType, _ := stringArg(args, "cell_type")
+		if cellType == "" {
+			cellType = "code"
+		}
+		if err := validCellType(cellType); err != nil {
+			return "", err
+		}
+		cell := map[string]any{"cell_type": cellType, "metadata": map[string]any{}}
+		setNotebookCellSource(cell, source)
+		cells = append(cells[:index], append([]any{cell}, cells[index:]...)...)
+
+	case "delete":
+		if index < 0 || index >= len(cells) {
+			return "", fmt.Errorf("index %d out of range (notebook has %d cells)", index, len(cells))
+		}
+		cells = append(cells[:index], cells[index+1:]...)
+
+	default:
+		return "", fmt.Errorf("unknown action %q (use read, edit, insert or delete)", action)
+	}
+
+	nb["cells"] = cells
+	if err := writeNotebook(absPath, nb); err != nil {
+		return "", err
+	}
+	out, err := jsonMarshalNoEscape(map[string]any{
+		"path":       n.guard.Rel(absPath),
+		"action":     action,
+		"index":      index,
+		"cell_count": len(cells),
+	})
+	return string(out), err
+}
+
+func validCellType(cellType string) error {
+	switch cellType {
+	case "code", "markdown", "raw":
+		return nil
+	}
+	return fmt.Errorf("invalid cell_type %q", cellType)
+}
+
+// setNotebookCellSource stores source as nbformat's list of lines. Code
+// cells lose their outputs, which no longer match the source.
+func setNotebookCellSource(cell map[string]any, source string) {
+	lines := strings.SplitAfter(source, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	list := make([]any, len(lines))
+	for i, line := range lines {
+		list[i] = line
+	}
+	cell["source"] = list
+	if cell["cell_type"] == "code" {
+		cell["outputs"] = []any{}
+		cell["execution_count"] = nil
+	} else {
+		delete(cell, "outputs")
+		delete(cell, "execution_count")
+	}
+}
+
+// notebookText joins nbformat multiline strings, which are either a string
+// or a list of strings.
+func notebookText(v any) string {
+	switch t := v.(type) {
+	case string:
+		return t
+	case []any:
+		var b strings.Builder
+		for _, part := range t {
+			if s, ok := part.(string); ok {
+				b.WriteString(s)
+			}
+		}
+		return b.String()
+	}
+	return ""
+}
+
+func describeNotebookCell(index int, cell map[string]any) notebookCell {
+	view := notebookCell{Index: index}
+	view.Type, _ = cell["cell_type"].(string)
+	view.Source = notebookText(cell["source"])
+	if view.Type != "code" {
+		return view
+	}
+	view.ExecutionCount = cell["execution_count"]
+	outputs, _ := cell["outputs"].([]any)
+	for i, raw := range outputs {
+		if i == maxNotebookOutputs {
+			view.Outputs = append(view.Outputs, fmt.Sprintf("[%d more outputs]", len(outputs)-i))
+			break
+		}
+		output, _ := raw.(map[string]any)
+		if text := describeNotebookOutput(output); text != "" {
+			view.Outputs = append(view.Outputs, text)
+		}
+	}
+	return view
+}
+
+func describeNotebookOutput(output map[string]any) string {
+	var text string
+	switch output["output_type"] {
+	case "stream":
+		text = notebookText(output["text"])
+	case "error":
+		ename, _ := output["ename"].(string)
+		evalue, _ := output["evalue"].(string)
+		text = ename + ": " + evalue
+	case "execute_result", "display_data":
+		data, _ := output["data"].(map[string]any)
+		if plain, ok := data["text/plain"]; ok {
+			text = notebookText(plain)
+		}
+		// Rich outputs cannot be shown as text; name them instead
+		var kinds []string
+		for mime := range data {
+			if mime != "text/plain" {
+				kinds = append(kinds, mime)
+			}
+		}
+		sort.Strings(kinds)
+		if len(kinds) > 0 {
+			text = strings.TrimSpace(text + "\n[" + strings.Join(kinds, ", ") + " output]")
+		}
+	}
+	if len(text) > maxNotebookOutputChars {
+		text = text[:maxNotebookOutputChars] + fmt.Sprintf("… [%d chars trimmed]", len(text)-maxNotebookOutputChars)
+	}
+	return text
+}
+
+func notebookLanguage(nb map[string]any) string {
+	meta, _ := nb["metadata"].(map[string]any)
+	if info, ok := meta["language_info"].(map[string]any); ok {
+		if name, ok := info["name"].(string); ok {
+			return name
+		}
+	}
+	if spec, ok := meta["kernelspec"].(map[string]any); ok {
+		if lang, ok := spec["language"].(string); ok {
+			return lang
+		}
+	}
+	return ""
+}
+
+// writeNotebook writes nb the way Jupyter does: one-space indentation,
+// sorted keys and a trailing newline, keeping diffs small.
+func writeNotebook(path string, nb map[string]any) error {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", " ")
+	if err := enc.Encode(nb); err != nil {
+		return fmt.Errorf("encode notebook: %w", err)
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0o644); err != nil {
+		return fmt.Errorf("write notebook: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package tooling
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testNotebook = `{
+ "cells": [
+  {"cell_type": "markdown", "metadata": {}, "source": ["# Title\n", "intro"]},
+  {"cell_type": "code", "execution_count": 3, "metadata": {"tags": ["keep"]}, "source": "print(1)",
+   "outputs": [
+    {"output_type": "stream", "name": "stdout", "text": ["1\n"]},
+    {"output_type": "display_data", "data": {"image/png": "iVBOR", "text/plain": ["<Figure>"]}, "metadata": {}}
+   ]}
+ ],
+ "metadata": {"language_info": {"name": "python"}},
+ "nbformat": 4,
+ "nbformat_minor": 5
+}`
+
+func TestNotebookTool(t *testing.T) {
+	dir := t.TempDir()
+	guard, err := newPathGuard(dir)
+	if err != nil {
+		t.Fatalf("guard: %v", err)
+	}
+	path := filepath.Join(dir, "analysis.ipynb")
+	if err := os.WriteFile(path, []byte(testNotebook), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	tool := NewNotebookTool(guard)
+	call := func(args map[string]any) string {
+		t.Helper()
+		args["path"] = "analysis.ipynb"
+		out, err := tool.Call(context.Background(), args)
+		if err != nil {
+			t.Fatalf("%v: %v", args["action"], err)
+		}
+		return out
+	}
+
+	var read struct {
+		CellCount int            `json:"cell_count"`
+		Language  string         `json:"language"`
+		Cells     []notebookCell `json:"cells"`
+	}
+	if err := json.Unmarshal([]byte(call(map[string]any{"action": "read"})), &read); err != nil {
+		t.Fatal(err)
+	}
+	if read.CellCount != 2 || read.Language != "python" || read.Cells[0].Source != "# Title\nintro" {
+		t.Fatalf("unexpected read: %+v", read)
+	}
+	if outs := read.Cells[1].Outputs; len(outs) != 2 || outs[0] != "1\n" || outs[1] != "<Figure>\n[image/png output]" {
+		t.Errorf("outputs = %q", outs)
+	}
+
+	call(map[string]any{"action": "edit", "index": float64(1), "source": "x = 2\nprint(x)\n"})
+	call(map[string]any{"action": "insert", "index": float64(2), "source": "done", "cell_type": "markdown"})
+	call(map[string]any{"action": "delete", "index": float64(0)})
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var nb struct {
+		Cells []map[string]any `json:"cells"`
+	}
+	if err := json.Unmarshal(data, &nb); err != nil {
+		t.Fatalf("rewritten notebook is invalid: %v", err)
+	}
+	if len(nb.Cells) != 2 {
+		t.Fatalf("cells = %d, want 2", len(nb.Cells))
+	}
+	code := nb.Cells[0]
+	if got := notebookText(code["source"]); got != "x = 2\nprint(x)\n" {
+		t.Errorf("edited source = %q", got)
+	}
+	if outs, _ := code["outputs"].([]any); len(outs) != 0 || code["execution_count"] != nil {
+		t.Errorf("edit should clear outputs: %v", code)
+	}
+	if !strings.Contains(string(data), `"keep"`) {
+		t.Error("cell metadata was lost")
+	}
+	if nb.Cells[1]["cell_type"] != "markdown" || notebookText(nb.Cells[1]["source"]) != "done" {
+		t.Errorf("inserted cell = %v", nb.Cells[1])
+	}
+
+	if _, err := tool.Call(context.Background(), map[string]any{"action": "edit", "path": "analysis.ipynb", "index": float64(9), "source": "x"}); err == nil {
+		t.Error("expected out-of-range error")
+	}
+}
@@ -0,0 +1,140 @@
+package tooling
+
+import (
+	"bytes"
+	"context"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// OutputFunc receives the output of a running command in chunks. stream is
+// "stdout" or "stderr".
+type OutputFunc func(stream, chunk string)
+
+type outputCtxKey struct{}
+
+// WithOutputStream makes emit receive the output of shell commands while
+// they run, so long builds and test runs can be watched live.
+func WithOutputStream(ctx context.Context, emit OutputFunc) context.Context {
+	return context.WithValue(ctx, outputCtxKey{}, emit)
+}
+
+func outputStreamFromContext(ctx context.Context) (OutputFunc, bool) {
+	emit, ok := ctx.Value(outputCtxKey{}).(OutputFunc)
+	return emit, ok && emit != nil
+}
+
+// Output is forwarded once this many bytes are pending, and otherwise every
+// outputFlushInterval.
+var (
+	outputChunkBytes    = 4096
+	outputFlushInterval = time.Second
+)
+
+// outputStreamer forwards what a command writes to emit in chunks. emit is
+// called from one goroutine at a time, and not after stop returns.
+type outputStreamer struct {
+	emit    OutputFunc
+	mu      sync.Mutex
+	pending map[string][]byte
+	order   []string // Streams in the order they first wrote
+	done    chan struct{}
+	wg      sync.WaitGroup
+	once    sync.Once
+}
+
+func newOutputStreamer(emit OutputFunc) *outputStreamer {
+	s := &outputStreamer{emit: emit, pending: map[string][]byte{}, done: make(chan struct{})}
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		ticker := time.NewTicker(outputFlushInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-s.done:
+				return
+			case <-ticker.C:
+				s.mu.Lock()
+				for _, stream := range s.order {
+					s.flushLocked(stream, false)
+				}
+				s.mu.Unlock()
+			}
+		}
+	}()
+	return s
+}
+
+// writer returns a writer that keeps everything in buf and streams it as
+// stream.
+func (s *outputStreamer) writer(stream string, buf *bytes.Buffer) *streamWriter {
+	return &streamWriter{streamer: s, stream: stream, buf: buf}
+}
+
+func (s *outputStreamer) add(stream string, buf *bytes.Buffer, p []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	buf.Write(p)
+	if _, seen := s.pending[stream]; !seen {
+		s.order = append(s.order, stream)
+	}
+	s.pending[stream] = append(s.pending[stream], p...)
+	if len(s.pending[stream]) >= outputChunkBytes {
+		s.flushLocked(stream, false)
+	}
+}
+
+// flushLocked emits the pending output of stream. Unless final, a rune cut
+// off at the end waits for the next write.
+func (s *outputStreamer) flushLocked(stream string, final bool) {
+	pending := s.pending[stream]
+	n := len(pending)
+	if !final {
+		n = completeRunes(pending)
+	}
+	if n == 0 {
+		return
+	}
+	s.emit(stream, string(pending[:n]))
+	s.pending[stream] = append(pending[:0], pending[n:]...)
+}
+
+// stop emits what is left and returns once emit is no longer called.
+func (s *outputStreamer) stop() {
+	s.once.Do(func() {
+		close(s.done)
+		s.wg.Wait()
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		for _, stream := range s.order {
+			s.flushLocked(stream, true)
+		}
+	})
+}
+
+// completeRunes returns the length of p without a trailing partial UTF-8
+// sequence.
+func completeRunes(p []byte) int {
+	for i := len(p) - 1; i >= 0 && i >= len(p)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(p[i]) {
+			if utf8.FullRune(p[i:]) {
+				return len(p)
+			}
+			return i
+		}
+	}
+	return len(p)
+}
+
+type streamWriter struct {
+	streamer *outputStreamer
+	stream   string
+	buf      *bytes.Buffer
+}
+
+func (w *streamWriter) Write(p []byte) (int, error) {
+	w.streamer.add(w.stream, w.buf, p)
+	return len(p), nil
+}
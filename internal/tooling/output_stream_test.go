@@ -0,0 +1,67 @@
+package tooling
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"sync"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestShellToolStreamsOutput(t *testing.T) {
+	guard, err := newPathGuard(t.TempDir())
+	if err != nil {
+		t.Fatalf("newPathGuard: %v", err)
+	}
+	defer func(n int) { outputChunkBytes = n }(outputChunkBytes)
+	outputChunkBytes = 4
+
+	var mu sync.Mutex
+	streamed := map[string][]string{}
+	ctx := WithOutputStream(context.Background(), func(stream, chunk string) {
+		mu.Lock()
+		defer mu.Unlock()
+		streamed[stream] = append(streamed[stream], chunk)
+	})
+	tool := &ShellTool{guard: guard}
+	resp, err := tool.Call(ctx, map[string]any{"command": []string{"/bin/sh", "-c", "printf 'héllo wörld ✓'; printf oops >&2"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var result struct {
+		Stdout string `json:"stdout"`
+		Stderr string `json:"stderr"`
+	}
+	if err := json.Unmarshal([]byte(resp), &result); err != nil {
+		t.Fatal(err)
+	}
+	if result.Stdout != "héllo wörld ✓" || result.Stderr != "oops" {
+		t.Fatalf("result = %+v", result)
+	}
+	for _, chunk := range streamed["stdout"] {
+		// Chunks never split a rune
+		if !utf8.ValidString(chunk) {
+			t.Errorf("chunk %q is not valid UTF-8", chunk)
+		}
+	}
+	if got := strings.Join(streamed["stdout"], ""); got != result.Stdout {
+		t.Errorf("stdout chunks = %q", streamed["stdout"])
+	}
+	if got := strings.Join(streamed["stderr"], ""); got != "oops" {
+		t.Errorf("stderr chunks = %q", streamed["stderr"])
+	}
+}
+
+func TestCompleteRunesHoldsBackSplitRune(t *testing.T) {
+	check := []byte("wörld ✓")
+	for cut := 0; cut <= len(check); cut++ {
+		n := completeRunes(check[:cut])
+		if !utf8.Valid(check[:n]) || cut-n >= utf8.UTFMax {
+			t.Errorf("completeRunes(%q) = %d", check[:cut], n)
+		}
+	}
+	if n := completeRunes(check[:len(check)-1]); n != len(check)-3 {
+		t.Errorf("cut check mark kept %d bytes", n)
+	}
+}
@@ -0,0 +1,72 @@
+package tooling
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestResolveWithinSymlinks(t *testing.T) {
+	root := t.TempDir()
+	outside := t.TempDir()
+	os.WriteFile(filepath.Join(outside, "secret.txt"), []byte("secret"), 0o644)
+	os.Mkdir(filepath.Join(root, "src"), 0o755)
+	os.WriteFile(filepath.Join(root, "src", "main.go"), []byte("package main\n"), 0o644)
+	links := map[string]string{
+		"escape":   outside,                                // Directory link leaving the workspace
+		"dangling": filepath.Join(outside, "new", "x.txt"), // Broken link whose target would be created outside
+		"internal": filepath.Join(root, "src"),             // Link that stays inside
+	}
+	for name, target := range links {
+		if err := os.Symlink(target, filepath.Join(root, name)); err != nil {
+			t.Skipf("symlinks unavailable: %v", err)
+		}
+	}
+
+	tests := []struct {
+		path    string
+		refused string
+	}{
+		{"src/main.go", ""},
+		{"internal/main.go", ""},
+		{"src/new/file.go", ""},
+		{"../x", "outside workspace root"},
+		{"escape/secret.txt", "follows a symlink"},
+		{"escape/missing/deep.txt", "follows a symlink"}, // Parent does not exist yet
+		{"dangling", "follows a symlink"},
+	}
+	for _, tt := range tests {
+		got, err := ResolveWithin(root, tt.path, false)
+		switch {
+		case tt.refused == "" && err != nil:
+			t.Errorf("%s: unexpected error %v", tt.path, err)
+		case tt.refused == "" && !within(mustEval(t, root), got):
+			t.Errorf("%s resolved outside root: %s", tt.path, got)
+		case tt.refused != "" && (err == nil || !strings.Contains(err.Error(), tt.refused)):
+			t.Errorf("%s: got %q, %v; want error %q", tt.path, got, err, tt.refused)
+		}
+	}
+
+	if _, err := ResolveWithin(root, "escape/secret.txt", true); err != nil {
+		t.Errorf("allowExternalSymlinks still refused: %v", err)
+	}
+	if _, err := ResolveWithin(root, "../x", true); err == nil {
+		t.Error("allowExternalSymlinks permitted a lexical escape")
+	}
+
+	// Deleting or renaming a link acts on the link, not its target
+	entry, err := ResolveEntryWithin(root, "escape", false)
+	if err != nil || entry != filepath.Join(mustEval(t, root), "escape") {
+		t.Errorf("ResolveEntryWithin(escape) = %q, %v", entry, err)
+	}
+}
+
+func mustEval(t *testing.T, path string) string {
+	t.Helper()
+	resolved, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resolved
+}
@@ -0,0 +1,134 @@
+package tooling
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// Tool permissions, set per workspace under tool_permissions.
+const (
+	PermissionAllow = "allow"
+	PermissionAsk   = "ask"
+	PermissionDeny  = "deny"
+)
+
+// ApprovalRequest describes a tool call waiting for the user's approval.
+type ApprovalRequest struct {
+	ID        string         // Provider tool call ID
+	Tool      string         // Tool name
+	Arguments map[string]any // Parsed call arguments
+	Summary   string         // One line shown to the user, e.g. the shell command
+}
+
+// ApprovalDecision is the user's answer to an ApprovalRequest.
+type ApprovalDecision struct {
+	Approved bool
+	Reason   string // Optional note passed back to the model on rejection
+}
+
+// Approver asks the user about a tool call and blocks until they answer or
+// ctx ends.
+type Approver func(ctx context.Context, req ApprovalRequest) (ApprovalDecision, error)
+
+type approverCtxKey struct{}
+
+// WithApprover makes approve the way tool calls with the "ask" permission
+// are put to the user.
+func WithApprover(ctx context.Context, approve Approver) context.Context {
+	return context.WithValue(ctx, approverCtxKey{}, approve)
+}
+
+func approverFromContext(ctx context.Context) (Approver, bool) {
+	approve, ok := ctx.Value(approverCtxKey{}).(Approver)
+	return approve, ok && approve != nil
+}
+
+// Authorize applies permission to a tool call. It returns nil when the call
+// may run, and an error explaining the refusal otherwise; the error is meant
+// to be returned to the model as the tool result.
+func Authorize(ctx context.Context, permission string, req ApprovalRequest) error {
+	switch permission {
+	case PermissionDeny:
+		return fmt.Errorf("%s is denied in this workspace by tool_permissions; do not retry it, find another way or ask the user", req.Tool)
+	case PermissionAsk:
+	default:
+		return nil
+	}
+	approve, ok := approverFromContext(ctx)
+	if !ok {
+		return fmt.Errorf("%s needs the user's approval, which cannot be asked for in this session; it is set to ask in tool_permissions", req.Tool)
+	}
+	decision, err := approve(ctx, req)
+	if err != nil {
+		return fmt.Errorf("approval for %s failed: %w", req.Tool, err)
+	}
+	if decision.Approved {
+		return nil
+	}
+	msg := fmt.Sprintf("the user rejected this %s call", req.Tool)
+	if reason := strings.TrimSpace(decision.Reason); reason != "" {
+		msg += ": " + reason
+	}
+	return errors.New(msg)
+}
+
+// maxSummaryLen bounds ApprovalRequest.Summary.
+const maxSummaryLen = 300
+
+// SummarizeCall renders a tool call as one line for an approval prompt: the
+// command for shell, the files touched for edits, the arguments otherwise.
+func SummarizeCall(tool string, args map[string]any) string {
+	var summary string
+	switch tool {
+	case "shell":
+		switch v := args["command"].(type) {
+		case string:
+			summary = v
+		case []any:
+			parts := make([]string, 0, len(v))
+			for _, part := range v {
+				parts = append(parts, fmt.Sprint(part))
+			}
+			summary = strings.Join(parts, " ")
+		}
+		if dir, ok := stringArg(args, "workdir"); ok && dir != "" {
+			summary += " (in " + dir + ")"
+		}
+	case "apply_patch":
+		patch, _ := stringArg(args, "patch")
+		var files []string
+		for _, line := range strings.Split(patch, "\n") {
+			if rest, ok := strings.CutPrefix(line, "+++ "); ok {
+				rest = strings.TrimPrefix(strings.TrimSpace(rest), "b/")
+				if rest != "/dev/null" {
+					files = append(files, rest)
+				}
+			}
+		}
+		if len(files) > 0 {
+			summary = "patch " + strings.Join(files, ", ")
+		}
+	default:
+		if path, ok := stringArg(args, "path"); ok && path != "" {
+			summary = path
+		}
+	}
+	if summary == "" {
+		out, err := jsonMarshalNoEscape(args)
+		if err == nil {
+			summary = strings.TrimSpace(string(out))
+		}
+	}
+	summary = strings.Join(strings.Fields(summary), " ")
+	if len(summary) > maxSummaryLen {
+		cut := maxSummaryLen
+		for cut > 0 && !utf8.RuneStart(summary[cut]) {
+			cut--
+		}
+		summary = summary[:cut] + "…"
+	}
+	return summary
+}
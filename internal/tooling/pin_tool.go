@@ -0,0 +1,216 @@
+package tooling
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"sync"
+)
+
+// PinFileToolName is the tool that adds a file to the turn's working set.
+const PinFileToolName = "pin_file"
+
+const (
+	// MaxPinnedFiles is how many files a turn can pin.
+	MaxPinnedFiles = 8
+	// MaxPinnedFileBytes is the largest file that can be pinned. A pinned
+	// file that grows past it is shown truncated.
+	MaxPinnedFileBytes = 32 * 1024
+	// MaxPinnedTotalBytes caps the whole working set, which is resent with
+	// every provider call.
+	MaxPinnedTotalBytes = 96 * 1024
+)
+
+// PinnedFiles is a turn's working set: files whose current content is sent
+// with every provider call until the turn ends.
+type PinnedFiles struct {
+	mu    sync.Mutex
+	files []pinnedPath
+}
+
+type pinnedPath struct {
+	abs, rel string
+}
+
+// PinnedFile is a pinned file as read from disk.
+type PinnedFile struct {
+	Path    string
+	Content string
+	Note    string // Set when the content is missing or cut, e.g. "deleted"
+}
+
+// NewPinnedFiles returns an empty working set.
+func NewPinnedFiles() *PinnedFiles {
+	return &PinnedFiles{}
+}
+
+type pinnedFilesCtxKey struct{}
+
+// WithPinnedFiles makes pins the working set pin_file adds to.
+func WithPinnedFiles(ctx context.Context, pins *PinnedFiles) context.Context {
+	return context.WithValue(ctx, pinnedFilesCtxKey{}, pins)
+}
+
+// PinnedFilesFromContext returns the working set set by WithPinnedFiles.
+func PinnedFilesFromContext(ctx context.Context) (*PinnedFiles, bool) {
+	pins, ok := ctx.Value(pinnedFilesCtxKey{}).(*PinnedFiles)
+	return pins, ok && pins != nil
+}
+
+// Pin adds the file at abs, shown as rel. It must be a text file of at most
+// MaxPinnedFileBytes; pinning a file twice is a no-op.
+func (p *PinnedFiles) Pin(abs, rel string) error {
+	info, err := os.Stat(abs)
+	if err != nil {
+		return err
+	}
+	if !info.Mode().IsRegular() {
+		return fmt.Errorf("%s is not a regular file", rel)
+	}
+	if info.Size() > MaxPinnedFileBytes {
+		return fmt.Errorf("%s is %d bytes; only files up to %d bytes can be pinned, use read_file with offsets or analyze_large_file instead", rel, info.Size(), MaxPinnedFileBytes)
+	}
+	data, err := os.ReadFile(abs)
+	if err != nil {
+		return err
+	}
+	if bytes.IndexByte(data, 0) >= 0 {
+		return fmt.Errorf("%s looks binary", rel)
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, f := range p.files {
+		if f.abs == abs {
+			return nil
+		}
+	}
+	if len(p.files) >= MaxPinnedFiles {
+		return fmt.Errorf("%d files are already pinned; unpin one first", MaxPinnedFiles)
+	}
+	total := int64(len(data))
+	for _, f := range p.files {
+		if info, err := os.Stat(f.abs); err == nil {
+			total += info.Size()
+		}
+	}
+	if total > MaxPinnedTotalBytes {
+		return fmt.Errorf("pinning %s would make the working set %d bytes (limit %d); unpin a file first", rel, total, MaxPinnedTotalBytes)
+	}
+	p.files = append(p.files, pinnedPath{abs: abs, rel: rel})
+	return nil
+}
+
+// Unpin removes the file at abs and reports whether it was pinned.
+func (p *PinnedFiles) Unpin(abs string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	n := len(p.files)
+	p.files = slices.DeleteFunc(p.files, func(f pinnedPath) bool { return f.abs == abs })
+	return len(p.files) < n
+}
+
+// Paths lists the pinned files in the order they were pinned.
+func (p *PinnedFiles) Paths() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	paths := make([]string, len(p.files))
+	for i, f := range p.files {
+		paths[i] = f.rel
+	}
+	return paths
+}
+
+// Contents reads every pinned file from disk, so edits made during the turn
+// are always reflected.
+func (p *PinnedFiles) Contents() []PinnedFile {
+	p.mu.Lock()
+	files := slices.Clone(p.files)
+	p.mu.Unlock()
+	out := make([]PinnedFile, 0, len(files))
+	for _, f := range files {
+		pinned := PinnedFile{Path: f.rel}
+		data, err := os.ReadFile(f.abs)
+		switch {
+		case errors.Is(err, os.ErrNotExist):
+			pinned.Note = "deleted"
+		case err != nil:
+			pinned.Note = err.Error()
+		case len(data) > MaxPinnedFileBytes:
+			pinned.Content = string(data[:MaxPinnedFileBytes])
+			pinned.Note = fmt.Sprintf("truncated: now %d bytes, showing the first %d", len(data), MaxPinnedFileBytes)
+		default:
+			pinned.Content = string(data)
+		}
+		out = append(out, pinned)
+	}
+	return out
+}
+
+// PinFileTool adds files to or removes them from the turn's working set.
+type PinFileTool struct {
+	guard pathGuard
+}
+
+// NewPinFileTool constructs the working set tool.
+func NewPinFileTool(guard pathGuard) *PinFileTool {
+	return &PinFileTool{guard: guard}
+}
+
+func (t *PinFileTool) Definition() ToolDefinition {
+	return ToolDefinition{
+		Type: "function",
+		Function: ToolFunction{
+			Name:        PinFileToolName,
+			Description: fmt.Sprintf("Pin a file you will keep reading or editing during this task. Its current content is included with every request until your turn ends, refreshed from disk each time, so you never need to read_file it again or work from a stale copy. Up to %d files of %d KB each.", MaxPinnedFiles, MaxPinnedFileBytes/1024),
+			Parameters: map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"path": map[string]any{
+						"type":        "string",
+						"description": "Path to the file, relative to the workspace root.",
+					},
+					"unpin": map[string]any{
+						"type":        "boolean",
+						"description": "Remove the file from the working set instead.",
+					},
+				},
+				"required": []string{"path"},
+			},
+		},
+	}
+}
+
+func (t *PinFileTool) Call(ctx context.Context, args map[string]any) (string, error) {
+	path, ok := stringArg(args, "path")
+	if !ok || path == "" {
+		return "", errors.New("path is required")
+	}
+	pins, ok := PinnedFilesFromContext(ctx)
+	if !ok {
+		return "", errors.New("pinning is not available in this session")
+	}
+	abs, err := t.guard.Resolve(path)
+	if err != nil {
+		return "", err
+	}
+	rel := t.guard.Rel(abs)
+	unpin, _ := args["unpin"].(bool)
+	payload := map[string]any{"path": rel}
+	if unpin {
+		payload["unpinned"] = pins.Unpin(abs)
+	} else {
+		if err := pins.Pin(abs, rel); err != nil {
+			return "", err
+		}
+		payload["note"] = "The current content is in the pinned files section of every request for the rest of this turn."
+	}
+	payload["pinned"] = pins.Paths()
+	out, err := jsonMarshalNoEscape(payload)
+	if err != nil {
+		return "", err
+	}
+	return string(out), nil
+}
@@ -15,6 +15,9 @@ import (
 	"strings"
 	"sync"
 	"time"
+
+	"cando/internal/safefile"
+	"cando/internal/timefmt"
 )
 
 type BackgroundProcessTool struct {
@@ -23,7 +26,40 @@ type BackgroundProcessTool struct {
 	binDir  string
 	mu      sync.Mutex
 	running map[string]*exec.Cmd
+	killed  map[string]bool // Running jobs a kill was sent to
 	rand    *rand.Rand
+	sandbox shellSandbox
+	rules   shellRules
+}
+
+// ErrProcessNotRunning is returned when killing a job that has ended or
+// was started by an earlier run of Cando.
+var ErrProcessNotRunning = errors.New("process is not running")
+
+// ProcessInfo describes a background job. Status is running, exited,
+// failed, failed_start, killed, or orphaned for a job left running by an
+// earlier run of Cando, which can no longer be managed.
+type ProcessInfo struct {
+	ID        string    `json:"job_id"`
+	Command   []string  `json:"command"`
+	WorkDir   string    `json:"workdir"`
+	Status    string    `json:"status"`
+	StartedAt time.Time `json:"started_at"`
+	EndedAt   time.Time `json:"ended_at,omitzero"`
+	ExitCode  int       `json:"exit_code"`
+	PID       int       `json:"pid,omitempty"`
+}
+
+// MarshalJSON writes the timestamps as UTC RFC 3339 with Unix millis.
+func (p ProcessInfo) MarshalJSON() ([]byte, error) {
+	type info ProcessInfo
+	return json.Marshal(struct {
+		info
+		StartedAt   timefmt.Time `json:"started_at"`
+		StartedAtMs int64        `json:"started_at_ms"`
+		EndedAt     timefmt.Time `json:"ended_at,omitzero"`
+		EndedAtMs   int64        `json:"ended_at_ms,omitempty"`
+	}{info(p), timefmt.Time(p.StartedAt), timefmt.Millis(p.StartedAt), timefmt.Time(p.EndedAt), timefmt.Millis(p.EndedAt)})
 }
 
 func NewBackgroundProcessTool(guard pathGuard, root string, binDir string) *BackgroundProcessTool {
@@ -44,10 +80,18 @@ func NewBackgroundProcessTool(guard pathGuard, root string, binDir string) *Back
 		root:    root,
 		binDir:  binDir,
 		running: make(map[string]*exec.Cmd),
+		killed:  make(map[string]bool),
 		rand:    rand.New(rand.NewSource(time.Now().UnixNano())),
 	}
 }
 
+// Running returns the number of background processes still running.
+func (t *BackgroundProcessTool) Running() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return len(t.running)
+}
+
 func (t *BackgroundProcessTool) Definition() ToolDefinition {
 	return ToolDefinition{
 		Type: "function",
@@ -122,13 +166,8 @@ func (t *BackgroundProcessTool) handleStart(ctx context.Context, args map[string
 		return "", errors.New("command must not be empty")
 	}
 
-	// Block commands that require user input
-	blockedCommands := []string{"sudo", "su", "passwd"}
-	cmdName := filepath.Base(cmdArgs[0])
-	for _, blocked := range blockedCommands {
-		if cmdName == blocked {
-			return "", fmt.Errorf("command '%s' requires interactive input and is not allowed. Use alternative approaches that don't require user interaction", blocked)
-		}
+	if err := t.rules.check(ctx, "background_process", cmdArgs); err != nil {
+		return "", err
 	}
 
 	workdir := ""
@@ -139,6 +178,10 @@ func (t *BackgroundProcessTool) handleStart(ctx context.Context, args map[string
 	if err != nil {
 		return "", err
 	}
+	run, err := t.sandbox.wrap(cmdArgs, dir, injectPath(os.Environ(), t.binDir), false)
+	if err != nil {
+		return "", err
+	}
 
 	jobID := t.generateJobID()
 	jobDir := filepath.Join(t.root, jobID)
@@ -159,10 +202,8 @@ func (t *BackgroundProcessTool) handleStart(ctx context.Context, args map[string
 		return "", fmt.Errorf("open stderr file: %w", err)
 	}
 
-	execCtx := context.Background()
-	cmd := exec.CommandContext(execCtx, cmdArgs[0], cmdArgs[1:]...)
+	cmd := run.command(context.Background())
 	cmd.Dir = dir
-	cmd.Env = injectPath(os.Environ(), t.binDir)
 
 	// Close stdin to prevent commands from hanging waiting for user input
 	cmd.Stdin = nil
@@ -193,19 +234,27 @@ func (t *BackgroundProcessTool) handleStart(ctx context.Context, args map[string
 		t.saveMeta(metaPath, &meta)
 		return "", fmt.Errorf("start command: %w", err)
 	}
-	meta.PID = cmd.Process.Pid
-	t.saveMeta(metaPath, &meta)
-
 	t.mu.Lock()
 	t.running[jobID] = cmd
 	t.mu.Unlock()
+	meta.PID = cmd.Process.Pid
+	t.saveMeta(metaPath, &meta)
 
-	go func() {
+	// The goroutine updates its own copy so the response below can read meta
+	go func(meta processMeta) {
 		err := cmd.Wait()
 		stdoutFile.Close()
 		stderrFile.Close()
 		meta.EndedAt = time.Now()
-		if err != nil {
+		t.mu.Lock()
+		killed := t.killed[jobID]
+		t.mu.Unlock()
+		if killed {
+			meta.Status = "killed"
+			if exitErr, ok := err.(*exec.ExitError); ok {
+				meta.ExitCode = exitErr.ExitCode()
+			}
+		} else if err != nil {
 			meta.Status = "failed"
 			meta.Error = err.Error()
 			if exitErr, ok := err.(*exec.ExitError); ok {
@@ -218,14 +267,16 @@ func (t *BackgroundProcessTool) handleStart(ctx context.Context, args map[string
 		t.saveMeta(metaPath, &meta)
 		t.mu.Lock()
 		delete(t.running, jobID)
+		delete(t.killed, jobID)
 		t.mu.Unlock()
-	}()
+	}(meta)
 
 	resp, err := jsonMarshalNoEscape(map[string]any{
-		"job_id":     jobID,
-		"status":     meta.Status,
-		"pid":        meta.PID,
-		"started_at": meta.StartedAt.Format(time.RFC3339),
+		"job_id":        jobID,
+		"status":        meta.Status,
+		"pid":           meta.PID,
+		"started_at":    timefmt.Format(meta.StartedAt),
+		"started_at_ms": timefmt.Millis(meta.StartedAt),
 	})
 	if err != nil {
 		return "", err
@@ -234,24 +285,27 @@ func (t *BackgroundProcessTool) handleStart(ctx context.Context, args map[string
 }
 
 func (t *BackgroundProcessTool) handleList(args map[string]any) (string, error) {
+	list, err := t.List()
+	if err != nil {
+		return "", err
+	}
+	resp, err := jsonMarshalNoEscape(list)
+	if err != nil {
+		return "", err
+	}
+	return string(resp), nil
+}
+
+// List returns the jobs started in this workspace, newest first.
+func (t *BackgroundProcessTool) List() ([]ProcessInfo, error) {
 	entries, err := os.ReadDir(t.root)
 	if err != nil {
 		if os.IsNotExist(err) {
-			return "[]", nil
+			return []ProcessInfo{}, nil
 		}
-		return "", err
+		return nil, err
 	}
-	type view struct {
-		ID        string    `json:"job_id"`
-		Command   []string  `json:"command"`
-		WorkDir   string    `json:"workdir"`
-		Status    string    `json:"status"`
-		StartedAt time.Time `json:"started_at"`
-		EndedAt   time.Time `json:"ended_at,omitempty"`
-		ExitCode  int       `json:"exit_code"`
-		PID       int       `json:"pid,omitempty"`
-	}
-	list := make([]view, 0, len(entries))
+	list := make([]ProcessInfo, 0, len(entries))
 	for _, entry := range entries {
 		if !entry.IsDir() {
 			continue
@@ -260,26 +314,35 @@ func (t *BackgroundProcessTool) handleList(args map[string]any) (string, error)
 		if err != nil {
 			continue
 		}
-		list = append(list, view{
-			ID:        meta.ID,
-			Command:   meta.Command,
-			WorkDir:   meta.WorkDir,
-			Status:    meta.Status,
-			StartedAt: meta.StartedAt,
-			EndedAt:   meta.EndedAt,
-			ExitCode:  meta.ExitCode,
-			PID:       meta.PID,
-		})
+		list = append(list, t.info(meta))
 	}
 	// sort by start desc
 	sort.Slice(list, func(i, j int) bool {
 		return list[i].StartedAt.After(list[j].StartedAt)
 	})
-	resp, err := jsonMarshalNoEscape(list)
-	if err != nil {
-		return "", err
+	return list, nil
+}
+
+func (t *BackgroundProcessTool) info(meta *processMeta) ProcessInfo {
+	status := meta.Status
+	if status == "running" && meta.PID != 0 {
+		t.mu.Lock()
+		_, tracked := t.running[meta.ID]
+		t.mu.Unlock()
+		if !tracked {
+			status = "orphaned"
+		}
+	}
+	return ProcessInfo{
+		ID:        meta.ID,
+		Command:   meta.Command,
+		WorkDir:   meta.WorkDir,
+		Status:    status,
+		StartedAt: meta.StartedAt,
+		EndedAt:   meta.EndedAt,
+		ExitCode:  meta.ExitCode,
+		PID:       meta.PID,
 	}
-	return string(resp), nil
 }
 
 func (t *BackgroundProcessTool) handleLogs(args map[string]any) (string, error) {
@@ -287,29 +350,48 @@ func (t *BackgroundProcessTool) handleLogs(args map[string]any) (string, error)
 	if !ok || strings.TrimSpace(jobID) == "" {
 		return "", errors.New("job_id is required")
 	}
-	meta, err := t.loadMeta(filepath.Join(t.root, jobID, "meta.json"))
-	if err != nil {
-		return "", err
-	}
 	stream := "stdout"
 	if s, ok := stringArg(args, "stream"); ok && strings.TrimSpace(s) != "" {
 		stream = strings.ToLower(strings.TrimSpace(s))
 	}
+	pattern, _ := stringArg(args, "grep")
+	lines, err := t.Logs(jobID, stream, intArg(args, "tail_lines", 50), pattern)
+	if err != nil {
+		return "", err
+	}
+	resp, err := jsonMarshalNoEscape(map[string]any{
+		"job_id": jobID,
+		"stream": stream,
+		"lines":  lines,
+	})
+	if err != nil {
+		return "", err
+	}
+	return string(resp), nil
+}
+
+// Logs returns the last tail lines (all when tail <= 0) a job wrote to
+// stream, "stdout" or "stderr", keeping only those containing pattern when
+// it is set.
+func (t *BackgroundProcessTool) Logs(jobID, stream string, tail int, pattern string) ([]string, error) {
+	meta, err := t.meta(jobID)
+	if err != nil {
+		return nil, err
+	}
 	logPath := meta.Stdout
 	if stream == "stderr" {
 		logPath = meta.Stderr
 	}
 	data, err := os.ReadFile(logPath)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 	lines := splitLines(string(data))
-	tail := intArg(args, "tail_lines", 50)
 	if tail <= 0 || tail > len(lines) {
 		tail = len(lines)
 	}
 	lines = lines[len(lines)-tail:]
-	if pattern, ok := stringArg(args, "grep"); ok && strings.TrimSpace(pattern) != "" {
+	if strings.TrimSpace(pattern) != "" {
 		filtered := lines[:0]
 		for _, line := range lines {
 			if strings.Contains(line, pattern) {
@@ -318,10 +400,23 @@ func (t *BackgroundProcessTool) handleLogs(args map[string]any) (string, error)
 		}
 		lines = filtered
 	}
+	return lines, nil
+}
+
+func (t *BackgroundProcessTool) handleKill(args map[string]any) (string, error) {
+	jobID, ok := stringArg(args, "job_id")
+	if !ok || strings.TrimSpace(jobID) == "" {
+		return "", errors.New("job_id is required")
+	}
+	if err := t.Kill(jobID); err != nil {
+		if errors.Is(err, ErrProcessNotRunning) {
+			return "", fmt.Errorf("job %s is not running", jobID)
+		}
+		return "", err
+	}
 	resp, err := jsonMarshalNoEscape(map[string]any{
 		"job_id": jobID,
-		"stream": stream,
-		"lines":  lines,
+		"status": "killed",
 	})
 	if err != nil {
 		return "", err
@@ -329,28 +424,40 @@ func (t *BackgroundProcessTool) handleLogs(args map[string]any) (string, error)
 	return string(resp), nil
 }
 
-func (t *BackgroundProcessTool) handleKill(args map[string]any) (string, error) {
-	jobID, ok := stringArg(args, "job_id")
-	if !ok || strings.TrimSpace(jobID) == "" {
-		return "", errors.New("job_id is required")
+// Kill stops a running job. It returns an error wrapping os.ErrNotExist
+// for unknown jobs and ErrProcessNotRunning for jobs it cannot stop.
+func (t *BackgroundProcessTool) Kill(jobID string) error {
+	if _, err := t.meta(jobID); err != nil {
+		return err
 	}
 	t.mu.Lock()
 	cmd := t.running[jobID]
+	if cmd != nil && cmd.Process != nil {
+		t.killed[jobID] = true
+	}
 	t.mu.Unlock()
 	if cmd == nil || cmd.Process == nil {
-		return "", fmt.Errorf("job %s is not running", jobID)
+		return ErrProcessNotRunning
 	}
-	if err := cmd.Process.Kill(); err != nil {
-		return "", fmt.Errorf("kill failed: %w", err)
+	// Cancel kills the process, or removes the container of a Docker sandbox
+	if err := cmd.Cancel(); err != nil {
+		return fmt.Errorf("kill failed: %w", err)
 	}
-	resp, err := jsonMarshalNoEscape(map[string]any{
-		"job_id": jobID,
-		"status": "killed",
-	})
-	if err != nil {
-		return "", err
+	return nil
+}
+
+// meta loads a job's metadata. Job IDs are single path elements, so a
+// caller cannot reach files outside the process directory.
+func (t *BackgroundProcessTool) meta(jobID string) (*processMeta, error) {
+	valid := jobID != "" && jobID == filepath.Base(jobID) && !strings.HasPrefix(jobID, ".")
+	if !valid {
+		return nil, fmt.Errorf("unknown job %q: %w", jobID, os.ErrNotExist)
 	}
-	return string(resp), nil
+	meta, err := t.loadMeta(filepath.Join(t.root, jobID, "meta.json"))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("unknown job %s: %w", jobID, os.ErrNotExist)
+	}
+	return meta, err
 }
 
 func (t *BackgroundProcessTool) generateJobID() string {
@@ -367,11 +474,12 @@ func (t *BackgroundProcessTool) saveMeta(path string, meta *processMeta) error {
 	if err != nil {
 		return err
 	}
-	return os.WriteFile(path, data, 0o644)
+	// The wait goroutine rewrites meta while List may be reading it
+	return safefile.Write(path, data, 0o644)
 }
 
 func (t *BackgroundProcessTool) loadMeta(path string) (*processMeta, error) {
-	data, err := os.ReadFile(path)
+	data, _, err := safefile.Read(path, safefile.ValidJSON)
 	if err != nil {
 		return nil, err
 	}
@@ -388,7 +496,7 @@ type processMeta struct {
 	WorkDir   string    `json:"workdir"`
 	Status    string    `json:"status"`
 	StartedAt time.Time `json:"started_at"`
-	EndedAt   time.Time `json:"ended_at,omitempty"`
+	EndedAt   time.Time `json:"ended_at,omitzero"`
 	ExitCode  int       `json:"exit_code"`
 	Error     string    `json:"error,omitempty"`
 	PID       int       `json:"pid,omitempty"`
@@ -396,6 +504,17 @@ type processMeta struct {
 	Stderr    string    `json:"stderr"`
 }
 
+func (m processMeta) MarshalJSON() ([]byte, error) {
+	type meta processMeta
+	return json.Marshal(struct {
+		meta
+		StartedAt   timefmt.Time `json:"started_at"`
+		StartedAtMs int64        `json:"started_at_ms"`
+		EndedAt     timefmt.Time `json:"ended_at,omitzero"`
+		EndedAtMs   int64        `json:"ended_at_ms,omitempty"`
+	}{meta(m), timefmt.Time(m.StartedAt), timefmt.Millis(m.StartedAt), timefmt.Time(m.EndedAt), timefmt.Millis(m.EndedAt)})
+}
+
 func splitLines(s string) []string {
 	scanner := bufio.NewScanner(strings.NewReader(s))
 	lines := make([]string, 0)
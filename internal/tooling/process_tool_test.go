@@ -44,6 +44,13 @@ func TestBackgroundProcessToolStartListLogs(t *testing.T) {
 	if !strings.Contains(listResp, jobID) {
 		t.Fatalf("list output missing job: %s", listResp)
 	}
+	var listed []map[string]any
+	if err := json.Unmarshal([]byte(listResp), &listed); err != nil || len(listed) != 1 {
+		t.Fatalf("list output = %s", listResp)
+	}
+	if started, _ := listed[0]["started_at"].(string); !strings.HasSuffix(started, "Z") || listed[0]["started_at_ms"] == nil || listed[0]["ended_at_ms"] == nil {
+		t.Errorf("list timestamps = %v", listed[0])
+	}
 
 	logResp, err := tool.Call(context.Background(), map[string]any{
 		"action":     "logs",
@@ -0,0 +1,364 @@
+package tooling
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// maxProjectTasksPerSource keeps huge generated Makefiles from flooding the context.
+const maxProjectTasksPerSource = 100
+
+// ProjectTasksTool lists the tasks a project defines (Makefile targets,
+// Taskfile tasks, package.json scripts, ...) so the agent runs the
+// project's own workflows instead of guessing build commands.
+type ProjectTasksTool struct {
+	guard pathGuard
+}
+
+func NewProjectTasksTool(guard pathGuard) *ProjectTasksTool {
+	return &ProjectTasksTool{guard: guard}
+}
+
+type projectTask struct {
+	Name        string `json:"name"`
+	Command     string `json:"command,omitempty"`
+	Description string `json:"description,omitempty"`
+}
+
+type projectTaskSource struct {
+	File   string        `json:"file"`
+	Runner string        `json:"runner"` // How to run a task: "<runner> <name>"
+	Tasks  []projectTask `json:"tasks"`
+}
+
+// taskFileParsers maps task file names to parsers returning the runner
+// prefix and the tasks defined.
+var taskFileParsers = []struct {
+	name  string
+	parse func(dir string, data []byte) (string, []projectTask, error)
+}{
+	{"Makefile", parseMakefileTasks},
+	{"makefile", parseMakefileTasks},
+	{"GNUmakefile", parseMakefileTasks},
+	{"Taskfile.yml", parseTaskfileTasks},
+	{"Taskfile.yaml", parseTaskfileTasks},
+	{"justfile", parseJustfileTasks},
+	{"Justfile", parseJustfileTasks},
+	{"package.json", parsePackageJSONTasks},
+	{"deno.json", parseDenoTasks},
+	{"composer.json", parseComposerTasks},
+}
+
+func (ProjectTasksTool) Definition() ToolDefinition {
+	return ToolDefinition{
+		Type: "function",
+		Function: ToolFunction{
+			Name:        "project_tasks",
+			Description: "List the tasks the project defines (Makefile targets, Taskfile tasks, justfile recipes, package.json/deno.json/composer.json scripts) with their commands and how to run them. Call this before guessing build, test or lint commands.",
+			Parameters: map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"path": map[string]any{
+						"type":        "string",
+						"description": "Directory to inspect, relative to workspace root (default: workspace root).",
+					},
+				},
+			},
+		},
+	}
+}
+
+func (p *ProjectTasksTool) Call(ctx context.Context, args map[string]any) (string, error) {
+	select {
+	case <-ctx.Done():
+		return "", ctx.Err()
+	default:
+	}
+
+	dir := p.guard.root
+	if rel, ok := stringArg(args, "path"); ok && strings.TrimSpace(rel) != "" {
+		resolved, err := p.guard.Resolve(rel)
+		if err != nil {
+			return "", err
+		}
+		dir = resolved
+	}
+
+	sources := []projectTaskSource{}
+	var problems []string
+	seen := make(map[string]bool) // Case-insensitive filesystems list Makefile twice
+	for _, parser := range taskFileParsers {
+		path := filepath.Join(dir, parser.name)
+		info, err := os.Stat(path)
+		if err != nil || info.IsDir() {
+			continue
+		}
+		key := strings.ToLower(parser.name)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		data, err := os.ReadFile(path)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v", parser.name, err))
+			continue
+		}
+		runner, tasks, err := parser.parse(dir, data)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v", parser.name, err))
+			continue
+		}
+		if len(tasks) == 0 {
+			continue
+		}
+		if len(tasks) > maxProjectTasksPerSource {
+			tasks = tasks[:maxProjectTasksPerSource]
+		}
+		sources = append(sources, projectTaskSource{File: p.guard.Rel(path), Runner: runner, Tasks: tasks})
+	}
+
+	payload := map[string]any{"directory": p.guard.Rel(dir), "sources": sources}
+	if len(problems) > 0 {
+		payload["errors"] = problems
+	}
+	if len(sources) == 0 {
+		payload["note"] = "no task definitions found; check README or CI config for build commands"
+	}
+	data, err := jsonMarshalNoEscape(payload)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+var (
+	makeTargetPattern = regexp.MustCompile(`^([A-Za-z0-9][A-Za-z0-9_./-]*(?:\s+[A-Za-z0-9][A-Za-z0-9_./-]*)*)\s*:([^=]|$)`)
+	makeHelpPattern   = regexp.MustCompile(`##\s*(.+)$`)
+)
+
+// parseMakefileTasks lists explicit targets with their first recipe line.
+// "## text" after a target is taken as its description (the common
+// self-documenting Makefile convention).
+func parseMakefileTasks(_ string, data []byte) (string, []projectTask, error) {
+	var tasks []projectTask
+	index := make(map[string]int)
+	var current []int
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "\t") {
+			recipe := strings.TrimLeft(strings.TrimSpace(line), "@-+")
+			for _, i := range current {
+				if tasks[i].Command == "" && recipe != "" {
+					tasks[i].Command = recipe
+				}
+			}
+			continue
+		}
+		current = nil
+		m := makeTargetPattern.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		desc := ""
+		if h := makeHelpPattern.FindStringSubmatch(line); h != nil {
+			desc = strings.TrimSpace(h[1])
+		}
+		for _, name := range strings.Fields(m[1]) {
+			if strings.HasPrefix(name, ".") {
+				continue
+			}
+			if i, ok := index[name]; ok {
+				current = append(current, i)
+				continue
+			}
+			index[name] = len(tasks)
+			current = append(current, len(tasks))
+			tasks = append(tasks, projectTask{Name: name, Description: desc})
+		}
+	}
+	return "make", tasks, scanner.Err()
+}
+
+// parseTaskfileTasks reads go-task's Taskfile.yml.
+func parseTaskfileTasks(_ string, data []byte) (string, []projectTask, error) {
+	var file struct {
+		Tasks yaml.Node `yaml:"tasks"`
+	}
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return "", nil, err
+	}
+	var tasks []projectTask
+	node := file.Tasks
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		name := node.Content[i].Value
+		var def struct {
+			Desc     string    `yaml:"desc"`
+			Summary  string    `yaml:"summary"`
+			Internal bool      `yaml:"internal"`
+			Cmds     yaml.Node `yaml:"cmds"`
+		}
+		body := node.Content[i+1]
+		task := projectTask{Name: name}
+		switch body.Kind {
+		case yaml.ScalarNode: // task: "command"
+			task.Command = body.Value
+		case yaml.SequenceNode: // task: [cmd, cmd]
+			task.Command = firstTaskfileCommand(body)
+		default:
+			if err := body.Decode(&def); err != nil {
+				continue
+			}
+			if def.Internal {
+				continue
+			}
+			task.Description = def.Desc
+			if task.Description == "" {
+				task.Description = def.Summary
+			}
+			task.Command = firstTaskfileCommand(&def.Cmds)
+		}
+		tasks = append(tasks, task)
+	}
+	return "task", tasks, nil
+}
+
+func firstTaskfileCommand(cmds *yaml.Node) string {
+	if cmds.Kind != yaml.SequenceNode || len(cmds.Content) == 0 {
+		return ""
+	}
+	first := cmds.Content[0]
+	if first.Kind == yaml.ScalarNode {
+		return first.Value
+	}
+	var entry struct {
+		Cmd  string `yaml:"cmd"`
+		Task string `yaml:"task"`
+	}
+	if first.Decode(&entry) == nil {
+		if entry.Cmd != "" {
+			return entry.Cmd
+		}
+		if entry.Task != "" {
+			return "task " + entry.Task
+		}
+	}
+	return ""
+}
+
+var justRecipePattern = regexp.MustCompile(`^@?([A-Za-z_][A-Za-z0-9_-]*)(\s[^:]*)?:([^=]|$)`)
+
+// parseJustfileTasks lists justfile recipes; a comment line directly above
+// a recipe is its description.
+func parseJustfileTasks(_ string, data []byte) (string, []projectTask, error) {
+	var tasks []projectTask
+	comment := ""
+	var last *projectTask
+	for _, line := range strings.Split(string(data), "\n") {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t") {
+			if last != nil && last.Command == "" && trimmed != "" && !strings.HasPrefix(trimmed, "#") {
+				last.Command = strings.TrimLeft(trimmed, "@-")
+			}
+			continue
+		}
+		last = nil
+		if strings.HasPrefix(trimmed, "#") {
+			comment = strings.TrimSpace(strings.TrimPrefix(trimmed, "#"))
+			continue
+		}
+		if m := justRecipePattern.FindStringSubmatch(line); m != nil && !strings.HasPrefix(m[1], "_") {
+			tasks = append(tasks, projectTask{Name: m[1], Description: comment})
+			last = &tasks[len(tasks)-1]
+		}
+		comment = ""
+	}
+	return "just", tasks, nil
+}
+
+// parsePackageJSONTasks lists npm scripts, run with the package manager
+// whose lockfile is present.
+func parsePackageJSONTasks(dir string, data []byte) (string, []projectTask, error) {
+	var pkg struct {
+		Scripts        map[string]string `json:"scripts"`
+		PackageManager string            `json:"packageManager"`
+	}
+	if err := json.Unmarshal(data, &pkg); err != nil {
+		return "", nil, err
+	}
+	runner := "npm run"
+	switch {
+	case strings.HasPrefix(pkg.PackageManager, "pnpm"), fileExists(filepath.Join(dir, "pnpm-lock.yaml")):
+		runner = "pnpm run"
+	case strings.HasPrefix(pkg.PackageManager, "yarn"), fileExists(filepath.Join(dir, "yarn.lock")):
+		runner = "yarn run"
+	case fileExists(filepath.Join(dir, "bun.lockb")), fileExists(filepath.Join(dir, "bun.lock")):
+		runner = "bun run"
+	}
+	return runner, sortedScriptTasks(pkg.Scripts), nil
+}
+
+func parseDenoTasks(_ string, data []byte) (string, []projectTask, error) {
+	var cfg struct {
+		Tasks map[string]any `json:"tasks"`
+	}
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return "", nil, err
+	}
+	scripts := make(map[string]string, len(cfg.Tasks))
+	for name, def := range cfg.Tasks {
+		switch d := def.(type) {
+		case string:
+			scripts[name] = d
+		case map[string]any: // {"command": "...", "description": "..."}
+			scripts[name], _ = d["command"].(string)
+		}
+	}
+	return "deno task", sortedScriptTasks(scripts), nil
+}
+
+func parseComposerTasks(_ string, data []byte) (string, []projectTask, error) {
+	var cfg struct {
+		Scripts map[string]any `json:"scripts"`
+	}
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return "", nil, err
+	}
+	scripts := make(map[string]string, len(cfg.Scripts))
+	for name, def := range cfg.Scripts {
+		switch d := def.(type) {
+		case string:
+			scripts[name] = d
+		case []any:
+			if len(d) > 0 {
+				scripts[name], _ = d[0].(string)
+			}
+		}
+	}
+	return "composer run", sortedScriptTasks(scripts), nil
+}
+
+func sortedScriptTasks(scripts map[string]string) []projectTask {
+	tasks := make([]projectTask, 0, len(scripts))
+	for name, command := range scripts {
+		tasks = append(tasks, projectTask{Name: name, Command: command})
+	}
+	sort.Slice(tasks, func(i, j int) bool { return tasks[i].Name < tasks[j].Name })
+	return tasks
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
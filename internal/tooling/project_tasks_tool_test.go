@@ -0,0 +1,81 @@
+package tooling
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestProjectTasksTool(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"Makefile":       "GO ?= go\nVERSION := 1.0\n.PHONY: build test\n\nbuild: ## Build the binary\n\t@$(GO) build ./...\n\ntest lint:\n\t$(GO) test ./...\n\n%.o: %.c\n\tcc $<\n",
+		"Taskfile.yml":   "version: '3'\ntasks:\n  dev:\n    desc: Run dev server\n    cmds:\n      - go run .\n  fmt: gofmt -w .\n  helper:\n    internal: true\n    cmds: [echo]\n",
+		"package.json":   `{"scripts": {"test": "vitest", "build": "vite build"}}`,
+		"pnpm-lock.yaml": "",
+		"justfile":       "# Deploy to prod\ndeploy env='prod':\n    ./deploy.sh {{env}}\n_private:\n    echo\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	guard, err := newPathGuard(dir)
+	if err != nil {
+		t.Fatalf("guard: %v", err)
+	}
+	out, err := NewProjectTasksTool(guard).Call(context.Background(), map[string]any{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var result struct {
+		Sources []projectTaskSource `json:"sources"`
+	}
+	if err := json.Unmarshal([]byte(out), &result); err != nil {
+		t.Fatal(err)
+	}
+	got := make(map[string]projectTaskSource)
+	for _, src := range result.Sources {
+		got[src.File] = src
+	}
+
+	want := map[string][]projectTask{
+		"Makefile": {
+			{Name: "build", Command: "$(GO) build ./...", Description: "Build the binary"},
+			{Name: "test", Command: "$(GO) test ./..."},
+			{Name: "lint", Command: "$(GO) test ./..."},
+		},
+		"Taskfile.yml": {
+			{Name: "dev", Command: "go run .", Description: "Run dev server"},
+			{Name: "fmt", Command: "gofmt -w ."},
+		},
+		"package.json": {
+			{Name: "build", Command: "vite build"},
+			{Name: "test", Command: "vitest"},
+		},
+		"justfile": {
+			{Name: "deploy", Command: "./deploy.sh {{env}}", Description: "Deploy to prod"},
+		},
+	}
+	for file, tasks := range want {
+		src, ok := got[file]
+		if !ok {
+			t.Errorf("%s not reported; got %v", file, result.Sources)
+			continue
+		}
+		if len(src.Tasks) != len(tasks) {
+			t.Errorf("%s tasks = %+v, want %+v", file, src.Tasks, tasks)
+			continue
+		}
+		for i := range tasks {
+			if src.Tasks[i] != tasks[i] {
+				t.Errorf("%s task %d = %+v, want %+v", file, i, src.Tasks[i], tasks[i])
+			}
+		}
+	}
+	if runner := got["package.json"].Runner; runner != "pnpm run" {
+		t.Errorf("package.json runner = %q, want pnpm run", runner)
+	}
+}
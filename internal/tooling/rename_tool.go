@@ -0,0 +1,256 @@
+package tooling
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"cando/internal/repomap"
+)
+
+const (
+	maxReferenceResults  = 100
+	maxReferenceFileSize = 1 << 20
+	maxReferenceLineLen  = 200
+)
+
+// importLinePattern matches lines that load other files: imports, includes,
+// requires, module declarations and shell sourcing.
+var importLinePattern = regexp.MustCompile(`\b(import|from|require|include|use|mod|source|load)\b|@import|<script|<link|href=|src=`)
+
+// RenamePathTool moves files and directories within the workspace and
+// reports the places that still refer to the old path.
+type RenamePathTool struct {
+	guard pathGuard
+}
+
+func NewRenamePathTool(guard pathGuard) *RenamePathTool {
+	return &RenamePathTool{guard: guard}
+}
+
+func (RenamePathTool) Definition() ToolDefinition {
+	return ToolDefinition{
+		Type: "function",
+		Function: ToolFunction{
+			Name:        "rename_path",
+			Description: "Move or rename a file or directory within the workspace, creating parent directories as needed. By default it then searches for references to the old path (imports, includes, requires, links) and lists the lines to update; it does not edit them.",
+			Parameters: map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"from": map[string]any{
+						"type":        "string",
+						"description": "Existing file or directory, relative to the workspace root.",
+					},
+					"to": map[string]any{
+						"type":        "string",
+						"description": "New path, relative to the workspace root.",
+					},
+					"overwrite": map[string]any{
+						"type":        "boolean",
+						"description": "Replace an existing file at the destination (default false). Directories are never overwritten.",
+					},
+					"find_references": map[string]any{
+						"type":        "boolean",
+						"description": "Search the workspace for references to the old path (default true).",
+					},
+				},
+				"required": []string{"from", "to"},
+			},
+		},
+	}
+}
+
+// pathReference is a line that mentions a moved path.
+type pathReference struct {
+	Path string `json:"path"`
+	Line int    `json:"line"`
+	Text string `json:"text"`
+}
+
+func (t *RenamePathTool) Call(ctx context.Context, args map[string]any) (string, error) {
+	select {
+	case <-ctx.Done():
+		return "", ctx.Err()
+	default:
+	}
+
+	from, _ := stringArg(args, "from")
+	to, _ := stringArg(args, "to")
+	if strings.TrimSpace(from) == "" || strings.TrimSpace(to) == "" {
+		return "", errors.New("from and to are required")
+	}
+	src, err := t.guard.ResolveEntry(from)
+	if err != nil {
+		return "", err
+	}
+	dst, err := t.guard.ResolveEntry(to)
+	if err != nil {
+		return "", err
+	}
+	if src == t.guard.root || dst == t.guard.root {
+		return "", errors.New("cannot move the workspace root")
+	}
+	if src == dst {
+		return "", errors.New("from and to are the same path")
+	}
+	info, err := os.Lstat(src)
+	if err != nil {
+		return "", fmt.Errorf("stat %s: %w", from, err)
+	}
+	if info.IsDir() && strings.HasPrefix(dst, src+string(os.PathSeparator)) {
+		return "", errors.New("cannot move a directory into itself")
+	}
+	if existing, err := os.Lstat(dst); err == nil {
+		switch {
+		case existing.IsDir():
+			return "", fmt.Errorf("%s already exists and is a directory", to)
+		case info.IsDir() || !boolArg(args, "overwrite", false):
+			return "", fmt.Errorf("%s already exists; set overwrite=true to replace it", to)
+		}
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+		return "", err
+	}
+	if err := os.Rename(src, dst); err != nil {
+		return "", fmt.Errorf("rename: %w", err)
+	}
+
+	oldRel := filepath.ToSlash(t.guard.Rel(src))
+	newRel := filepath.ToSlash(t.guard.Rel(dst))
+	payload := map[string]any{
+		"from": oldRel,
+		"to":   newRel,
+		"type": typeOf(info.IsDir()),
+	}
+	if boolArg(args, "find_references", true) {
+		refs, truncated, err := findPathReferences(ctx, t.guard.root, oldRel, info.IsDir())
+		if err != nil {
+			return "", err
+		}
+		payload["references"] = refs
+		if truncated {
+			payload["references_truncated"] = true
+		}
+		if len(refs) > 0 {
+			payload["note"] = fmt.Sprintf("These lines may still refer to %s; update them to %s where needed.", oldRel, newRel)
+		}
+	}
+	data, err := jsonMarshalNoEscape(payload)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// referenceTerms returns the spellings of a moved path to look for. Full
+// paths match anywhere; the bare name only on import-like lines, since it is
+// usually also an ordinary word.
+func referenceTerms(oldRel string, isDir bool) (paths []string, name string) {
+	noExt := oldRel
+	if !isDir {
+		noExt = strings.TrimSuffix(oldRel, path.Ext(oldRel))
+	}
+	paths = []string{oldRel}
+	if noExt != oldRel {
+		paths = append(paths, noExt)
+	}
+	if strings.Contains(noExt, "/") {
+		paths = append(paths, strings.ReplaceAll(noExt, "/", ".")) // Python-style module path
+	}
+	return paths, path.Base(noExt)
+}
+
+func findPathReferences(ctx context.Context, root, oldRel string, isDir bool) ([]pathReference, bool, error) {
+	paths, name := referenceTerms(oldRel, isDir)
+	refs := []pathReference{}
+	truncated := false
+	errStop := errors.New("stop")
+	err := filepath.WalkDir(root, func(abs string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if d.IsDir() {
+			if abs != root && repomap.SkipDir(d.Name()) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		if info, err := d.Info(); err != nil || info.Size() > maxReferenceFileSize {
+			return nil
+		}
+		data, err := os.ReadFile(abs)
+		if err != nil || bytes.IndexByte(data[:min(len(data), 8000)], 0) >= 0 {
+			return nil
+		}
+		rel, _ := filepath.Rel(root, abs)
+		for i, line := range strings.Split(string(data), "\n") {
+			if !lineReferences(line, paths, name) {
+				continue
+			}
+			if len(refs) == maxReferenceResults {
+				truncated = true
+				return errStop
+			}
+			text := strings.TrimSpace(line)
+			if len(text) > maxReferenceLineLen {
+				text = text[:maxReferenceLineLen] + "…"
+			}
+			refs = append(refs, pathReference{Path: filepath.ToSlash(rel), Line: i + 1, Text: text})
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, errStop) {
+		return nil, false, err
+	}
+	return refs, truncated, nil
+}
+
+func lineReferences(line string, paths []string, name string) bool {
+	for _, term := range paths {
+		if containsTerm(line, term, "") {
+			return true
+		}
+	}
+	return importLinePattern.MatchString(line) && containsTerm(line, name, `/'"<.`)
+}
+
+// containsTerm reports whether term occurs in line as a whole path: not
+// followed by a name character, and preceded by one of before (any non-name
+// character when before is empty).
+func containsTerm(line, term, before string) bool {
+	for offset := 0; ; {
+		i := strings.Index(line[offset:], term)
+		if i < 0 {
+			return false
+		}
+		start := offset + i
+		end := start + len(term)
+		okBefore := start == 0 && before == ""
+		if start > 0 {
+			prev := line[start-1]
+			okBefore = (before == "" && !isPathNameChar(prev)) || strings.IndexByte(before, prev) >= 0
+		}
+		okAfter := end == len(line) || !isPathNameChar(line[end])
+		if okBefore && okAfter {
+			return true
+		}
+		offset = start + 1
+	}
+}
+
+func isPathNameChar(c byte) bool {
+	return c == '_' || c == '-' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
@@ -0,0 +1,65 @@
+package tooling
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRenamePathTool(t *testing.T) {
+	guard, err := newPathGuard(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		"src/utils/date.ts": "export const today = () => new Date()\n",
+		"src/app.ts":        "import { today } from './utils/date'\nconst date = today()\n",
+		"src/other.ts":      "import { x } from './utils/dates'\n",
+		"docs/notes.md":     "See src/utils/date.ts for helpers.\n",
+		"existing.ts":       "\n",
+	}
+	for rel, content := range files {
+		abs := filepath.Join(guard.root, rel)
+		os.MkdirAll(filepath.Dir(abs), 0o755)
+		if err := os.WriteFile(abs, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tool := NewRenamePathTool(guard)
+	ctx := context.Background()
+	if _, err := tool.Call(ctx, map[string]any{"from": "src/utils/date.ts", "to": "existing.ts"}); err == nil {
+		t.Fatal("expected refusal to overwrite without overwrite=true")
+	}
+	if _, err := tool.Call(ctx, map[string]any{"from": "src", "to": "src/nested"}); err == nil {
+		t.Fatal("expected refusal to move a directory into itself")
+	}
+
+	out, err := tool.Call(ctx, map[string]any{"from": "src/utils/date.ts", "to": "src/lib/time/date.ts"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(guard.root, "src/lib/time/date.ts")); err != nil {
+		t.Fatalf("moved file missing: %v", err)
+	}
+	var result struct {
+		To         string          `json:"to"`
+		References []pathReference `json:"references"`
+	}
+	if err := json.Unmarshal([]byte(out), &result); err != nil {
+		t.Fatal(err)
+	}
+	if result.To != "src/lib/time/date.ts" {
+		t.Errorf("to = %q", result.To)
+	}
+	found := map[string]int{}
+	for _, ref := range result.References {
+		found[ref.Path] = ref.Line
+	}
+	// The import and the doc mention match; "const date" and "./utils/dates" do not
+	if found["src/app.ts"] != 1 || found["docs/notes.md"] != 1 || len(found) != 2 {
+		t.Errorf("references = %+v", result.References)
+	}
+}
@@ -0,0 +1,87 @@
+package tooling
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"cando/internal/repomap"
+)
+
+const (
+	defaultRepoMapTokens = 2048
+	maxRepoMapTokens     = 16384
+)
+
+// RepoMapTool returns the ranked repository map: key files and the
+// signatures they define, within a token budget.
+type RepoMapTool struct {
+	guard pathGuard
+}
+
+func NewRepoMapTool(guard pathGuard) *RepoMapTool {
+	return &RepoMapTool{guard: guard}
+}
+
+func (RepoMapTool) Definition() ToolDefinition {
+	return ToolDefinition{
+		Type: "function",
+		Function: ToolFunction{
+			Name:        "repo_map",
+			Description: "Return a compressed map of the repository: the most referenced source files with the signatures of the functions, types and classes they define, ranked and cut to a token budget. Use it to orient in unfamiliar code before grepping or reading files.",
+			Parameters: map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"max_tokens": map[string]any{
+						"type":        "integer",
+						"description": fmt.Sprintf("Size budget in tokens (default %d, max %d).", defaultRepoMapTokens, maxRepoMapTokens),
+					},
+					"focus": map[string]any{
+						"type":        "string",
+						"description": "File names, symbols or a task description; matching files and symbols are ranked first.",
+					},
+					"path": map[string]any{
+						"type":        "string",
+						"description": "Only map files under this directory (relative to workspace root).",
+					},
+				},
+			},
+		},
+	}
+}
+
+func (r *RepoMapTool) Call(ctx context.Context, args map[string]any) (string, error) {
+	select {
+	case <-ctx.Done():
+		return "", ctx.Err()
+	default:
+	}
+
+	budget := min(intArg(args, "max_tokens", defaultRepoMapTokens), maxRepoMapTokens)
+	if budget <= 0 {
+		budget = defaultRepoMapTokens
+	}
+	focus, _ := stringArg(args, "focus")
+	prefix := ""
+	if rel, ok := stringArg(args, "path"); ok && strings.TrimSpace(rel) != "" {
+		resolved, err := r.guard.Resolve(rel)
+		if err != nil {
+			return "", err
+		}
+		prefix = r.guard.Rel(resolved)
+		if prefix == "." {
+			prefix = ""
+		}
+	}
+
+	m := repomap.ForRoot(r.guard.root)
+	if err := m.Refresh(); err != nil {
+		return "", fmt.Errorf("build repo map: %w", err)
+	}
+	out := m.Render(repomap.Options{MaxTokens: budget, Focus: focus, Path: prefix})
+	if out == "" {
+		return "No source files found to map.", nil
+	}
+	files, symbols := m.Stats()
+	return fmt.Sprintf("Repository map (%d files, %d symbols indexed):\n%s", files, symbols, out), nil
+}
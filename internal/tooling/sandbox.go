@@ -0,0 +1,279 @@
+package tooling
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"os/exec"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"cando/internal/config"
+)
+
+// sandboxStopWait is how long a sandboxed command may take to exit after it
+// was stopped before its process is killed.
+var sandboxStopWait = 5 * time.Second
+
+// shellBackend runs shell commands somewhere other than directly on the
+// host. wrap returns the command that runs argv in dir; tty is set for
+// commands handed to the user in a terminal.
+type shellBackend interface {
+	wrap(argv []string, dir string, env []string, tty bool) (sandboxedCommand, error)
+}
+
+// sandboxedCommand is a command line ready to start on the host.
+type sandboxedCommand struct {
+	args []string
+	env  []string
+	// stop ends the command when killing its process is not enough, such as
+	// the container behind a docker client. nil kills the process.
+	stop func() error
+}
+
+// command returns an exec.Cmd for c bound to ctx. Its Cancel ends the
+// command, container included.
+func (c sandboxedCommand) command(ctx context.Context) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, c.args[0], c.args[1:]...)
+	cmd.Env = c.env
+	if c.stop != nil {
+		cmd.Cancel = c.stop
+		cmd.WaitDelay = sandboxStopWait
+	}
+	return cmd
+}
+
+// shellSandbox picks the backend of shell commands in a workspace from the
+// config each time, so shell_sandbox changes apply without a restart.
+type shellSandbox struct {
+	root   string
+	config func() config.ShellSandbox // nil runs commands directly
+}
+
+func (s shellSandbox) settings() config.ShellSandbox {
+	if s.config == nil {
+		return config.ShellSandbox{}
+	}
+	return s.config()
+}
+
+// name returns the configured backend, "direct" when none is.
+func (s shellSandbox) name() string {
+	if backend := s.settings().Backend; backend != "" {
+		return backend
+	}
+	return "direct"
+}
+
+func (s shellSandbox) wrap(argv []string, dir string, env []string, tty bool) (sandboxedCommand, error) {
+	backend, err := newShellBackend(s.settings(), s.root)
+	if err != nil {
+		return sandboxedCommand{}, err
+	}
+	return backend.wrap(argv, dir, env, tty)
+}
+
+// SandboxedCommand returns a command that runs argv in dir under sb, the
+// shell_sandbox setting of workspace root, as the shell tool would. It fails
+// rather than run on the host when the sandbox program is not installed.
+func SandboxedCommand(ctx context.Context, sb config.ShellSandbox, root string, argv []string, dir string, env []string) (*exec.Cmd, error) {
+	return sandboxedCommandFor(ctx, sb, root, argv, dir, env, false)
+}
+
+// SandboxedTerminal is SandboxedCommand for a program the user drives
+// through a PTY, such as the web UI's terminal. Cancelling ctx ends it,
+// container included.
+func SandboxedTerminal(ctx context.Context, sb config.ShellSandbox, root string, argv []string, dir string, env []string) (*exec.Cmd, error) {
+	return sandboxedCommandFor(ctx, sb, root, argv, dir, env, true)
+}
+
+func sandboxedCommandFor(ctx context.Context, sb config.ShellSandbox, root string, argv []string, dir string, env []string, tty bool) (*exec.Cmd, error) {
+	backend, err := newShellBackend(sb, root)
+	if err != nil {
+		return nil, err
+	}
+	run, err := backend.wrap(argv, dir, env, tty)
+	if err != nil {
+		return nil, err
+	}
+	cmd := run.command(ctx)
+	cmd.Dir = dir
+	return cmd, nil
+}
+
+// newShellBackend returns the backend sb configures for workspace root. The
+// sandbox program must be installed; commands are refused rather than run
+// unsandboxed when it is not.
+func newShellBackend(sb config.ShellSandbox, root string) (shellBackend, error) {
+	var program string
+	switch sb.Backend {
+	case "", "direct":
+		return directBackend{}, nil
+	case "docker":
+		program = "docker"
+	case "bubblewrap":
+		program = "bwrap"
+	case "firejail":
+		program = "firejail"
+	default:
+		return nil, fmt.Errorf("unknown shell_sandbox backend %q", sb.Backend)
+	}
+	path, err := exec.LookPath(program)
+	if err != nil {
+		return nil, fmt.Errorf("shell_sandbox uses %s, but %s is not installed; install it or change shell_sandbox for this workspace", sb.Backend, program)
+	}
+	switch sb.Backend {
+	case "docker":
+		return dockerBackend{docker: path, root: root, sandbox: sb}, nil
+	case "bubblewrap":
+		return bubblewrapBackend{bwrap: path, root: root, sandbox: sb}, nil
+	default:
+		return firejailBackend{firejail: path, root: root, sandbox: sb}, nil
+	}
+}
+
+// directBackend runs commands on the host.
+type directBackend struct{}
+
+func (directBackend) wrap(argv []string, dir string, env []string, tty bool) (sandboxedCommand, error) {
+	return sandboxedCommand{args: argv, env: env}, nil
+}
+
+// dockerBackend runs each command in a new container of the configured
+// image, with the workspace mounted at its host path. The container runs as
+// the current user so files it writes keep their owner.
+type dockerBackend struct {
+	docker  string
+	root    string
+	sandbox config.ShellSandbox
+}
+
+func (b dockerBackend) wrap(argv []string, dir string, env []string, tty bool) (sandboxedCommand, error) {
+	name := "cando-" + randomHex(6)
+	args := []string{b.docker, "run", "--rm", "--init", "--name", name,
+		"-v", b.root + ":" + b.root, "-w", dir, "-e", "HOME=/tmp"}
+	if tty {
+		args = append(args, "-i", "-t", "-e", "TERM=xterm-256color")
+	}
+	if !b.sandbox.Network {
+		args = append(args, "--network", "none")
+	}
+	if uid, gid := os.Getuid(), os.Getgid(); uid >= 0 {
+		args = append(args, "--user", fmt.Sprintf("%d:%d", uid, gid))
+	}
+	for _, kv := range sandboxVars(b.sandbox.Env) {
+		args = append(args, "-e", kv)
+	}
+	args = append(args, b.sandbox.Args...)
+	args = append(args, b.sandbox.Image)
+	args = append(args, argv...)
+	stop := func() error {
+		return exec.Command(b.docker, "rm", "-f", name).Run()
+	}
+	// The docker client itself needs the host environment (DOCKER_HOST and
+	// the like); the container only gets the variables passed with -e.
+	return sandboxedCommand{args: args, env: env, stop: stop}, nil
+}
+
+// bubblewrapBackend runs commands in a bubblewrap namespace that sees the
+// host's system directories read-only, the workspace read-write, and an
+// empty /tmp.
+type bubblewrapBackend struct {
+	bwrap   string
+	root    string
+	sandbox config.ShellSandbox
+}
+
+func (b bubblewrapBackend) wrap(argv []string, dir string, env []string, tty bool) (sandboxedCommand, error) {
+	args := []string{b.bwrap, "--die-with-parent", "--unshare-all"}
+	if b.sandbox.Network {
+		args = append(args, "--share-net")
+	}
+	for _, sys := range []string{"/usr", "/bin", "/sbin", "/lib", "/lib64", "/etc", "/opt"} {
+		args = append(args, "--ro-bind-try", sys, sys)
+	}
+	args = append(args, "--proc", "/proc", "--dev", "/dev", "--tmpfs", "/tmp",
+		"--bind", b.root, b.root, "--chdir", dir, "--clearenv")
+	vars := append(hostVars(env, tty), "HOME=/tmp")
+	for _, kv := range append(vars, sandboxVars(b.sandbox.Env)...) {
+		key, value, _ := strings.Cut(kv, "=")
+		args = append(args, "--setenv", key, value)
+	}
+	args = append(args, b.sandbox.Args...)
+	args = append(args, "--")
+	args = append(args, argv...)
+	return sandboxedCommand{args: args, env: env}, nil
+}
+
+// firejailBackend runs commands under firejail with only the workspace
+// visible in the home directory. firejail can only hide the rest of home,
+// so the workspace should be inside it.
+type firejailBackend struct {
+	firejail string
+	root     string
+	sandbox  config.ShellSandbox
+}
+
+func (b firejailBackend) wrap(argv []string, dir string, env []string, tty bool) (sandboxedCommand, error) {
+	args := []string{b.firejail, "--quiet", "--noprofile", "--noroot", "--caps.drop=all",
+		"--seccomp", "--private-tmp", "--whitelist=" + b.root}
+	if !b.sandbox.Network {
+		args = append(args, "--net=none")
+	}
+	args = append(args, b.sandbox.Args...)
+	args = append(args, "--")
+	args = append(args, argv...)
+	vars := hostVars(env, tty)
+	if home, ok := lookupEnv(env, "HOME"); ok {
+		vars = append(vars, "HOME="+home)
+	}
+	return sandboxedCommand{args: args, env: append(vars, sandboxVars(b.sandbox.Env)...)}, nil
+}
+
+// hostVars keeps the variables of env that sandboxed commands need to find
+// programs and print text. Credentials and the rest stay outside.
+func hostVars(env []string, tty bool) []string {
+	keep := []string{"PATH", "LANG", "LC_ALL", "TERM"}
+	var out []string
+	for _, kv := range env {
+		key, _, _ := strings.Cut(kv, "=")
+		if slices.Contains(keep, key) {
+			out = append(out, kv)
+		}
+	}
+	if _, ok := lookupEnv(out, "TERM"); tty && !ok {
+		out = append(out, "TERM=xterm-256color")
+	}
+	return out
+}
+
+func lookupEnv(env []string, key string) (string, bool) {
+	for _, kv := range env {
+		if k, v, ok := strings.Cut(kv, "="); ok && k == key {
+			return v, true
+		}
+	}
+	return "", false
+}
+
+// sandboxVars returns vars as sorted KEY=value pairs.
+func sandboxVars(vars map[string]string) []string {
+	out := make([]string, 0, len(vars))
+	for key, value := range vars {
+		out = append(out, key+"="+value)
+	}
+	sort.Strings(out)
+	return out
+}
+
+func randomHex(n int) string {
+	buf := make([]byte, n)
+	if _, err := rand.Read(buf); err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(buf)
+}
@@ -0,0 +1,73 @@
+package tooling
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+
+	"cando/internal/config"
+)
+
+func TestSandboxBackendsWrapCommands(t *testing.T) {
+	root := "/work/app"
+	env := []string{"PATH=/work/app/bin:/usr/bin", "API_KEY=secret", "HOME=/home/me"}
+	argv := []string{"npm", "test"}
+	sb := config.ShellSandbox{Image: "node:20", Env: map[string]string{"CI": "1"}, Args: []string{"--memory=1g"}}
+
+	docker, err := dockerBackend{docker: "docker", root: root, sandbox: sb}.wrap(argv, root+"/web", env, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	line := strings.Join(docker.args, " ")
+	for _, want := range []string{"-v /work/app:/work/app", "-w /work/app/web", "--network none", "-e CI=1", "--memory=1g node:20 npm test"} {
+		if !strings.Contains(line, want) {
+			t.Errorf("docker command %q lacks %q", line, want)
+		}
+	}
+	if strings.Contains(line, "API_KEY") || docker.stop == nil {
+		t.Errorf("docker command %q leaks the host environment or cannot be stopped", line)
+	}
+
+	sb.Network = true
+	bwrap, err := bubblewrapBackend{bwrap: "bwrap", root: root, sandbox: sb}.wrap(argv, root, env, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	line = strings.Join(bwrap.args, " ")
+	for _, want := range []string{"--share-net", "--bind /work/app /work/app", "--clearenv", "--setenv PATH /work/app/bin:/usr/bin", "--setenv CI 1", "-- npm test"} {
+		if !strings.Contains(line, want) {
+			t.Errorf("bwrap command %q lacks %q", line, want)
+		}
+	}
+	if strings.Contains(line, "API_KEY") {
+		t.Errorf("bwrap command %q passes API_KEY", line)
+	}
+
+	firejail, err := firejailBackend{firejail: "firejail", root: root, sandbox: sb}.wrap(argv, root, env, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Contains(firejail.args, "--whitelist=/work/app") {
+		t.Errorf("firejail command %v does not whitelist the workspace", firejail.args)
+	}
+	if slices.Contains(firejail.env, "API_KEY=secret") || !slices.Contains(firejail.env, "TERM=xterm-256color") {
+		t.Errorf("firejail env = %v", firejail.env)
+	}
+}
+
+func TestShellToolRefusesMissingSandbox(t *testing.T) {
+	guard, err := newPathGuard(t.TempDir())
+	if err != nil {
+		t.Fatalf("newPathGuard: %v", err)
+	}
+	t.Setenv("PATH", t.TempDir())
+	tool := &ShellTool{guard: guard, sandbox: shellSandbox{
+		root:   guard.root,
+		config: func() config.ShellSandbox { return config.ShellSandbox{Backend: "bubblewrap"} },
+	}}
+	_, err = tool.Call(context.Background(), map[string]any{"command": []string{"/bin/echo", "hi"}})
+	if err == nil || !strings.Contains(err.Error(), "bwrap is not installed") {
+		t.Fatalf("err = %v, want the missing sandbox reported", err)
+	}
+}
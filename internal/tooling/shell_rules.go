@@ -0,0 +1,194 @@
+package tooling
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"cando/internal/config"
+	"cando/internal/logging"
+)
+
+// shellRules checks commands against the workspace's shell_commands rule,
+// read from the config each time so changes apply without a restart.
+type shellRules struct {
+	config func() config.ShellCommandRule // nil applies config.DefaultShellDeny
+}
+
+func (r shellRules) rule() config.ShellCommandRule {
+	if r.config == nil {
+		return config.ShellCommandRule{Deny: config.DefaultShellDeny}
+	}
+	return r.config()
+}
+
+// check returns nil when argv may run. A command the rule blocks is put to
+// the user through the turn's Approver, if there is one; otherwise, or
+// when the user rejects it, the error explains why to the model.
+func (r shellRules) check(ctx context.Context, tool string, argv []string) error {
+	why := r.blocked(argv)
+	if why == "" {
+		return nil
+	}
+	command := strings.Join(argv, " ")
+	logging.ErrorLog("%s: %q %s", tool, command, why)
+	approve, ok := approverFromContext(ctx)
+	if !ok {
+		return fmt.Errorf("command %q %s in shell_commands for this workspace; do not retry it, find another way or ask the user to run it", command, why)
+	}
+	args := map[string]any{"command": argv}
+	decision, err := approve(ctx, ApprovalRequest{
+		Tool:      tool,
+		Arguments: args,
+		Summary:   fmt.Sprintf("%s (%s)", SummarizeCall("shell", map[string]any{"command": command}), why),
+	})
+	if err != nil {
+		return fmt.Errorf("approval for %q failed: %w", command, err)
+	}
+	if decision.Approved {
+		logging.UserLog("%s: user approved %q", tool, command)
+		return nil
+	}
+	msg := fmt.Sprintf("command %q %s in shell_commands for this workspace, and the user rejected running it", command, why)
+	if reason := strings.TrimSpace(decision.Reason); reason != "" {
+		msg += ": " + reason
+	}
+	return errors.New(msg)
+}
+
+// blocked returns why the rule blocks argv, or "" when it may run. Scripts
+// passed to sh -c and the like are checked command by command.
+func (r shellRules) blocked(argv []string) string {
+	rule := r.rule()
+	for _, cmd := range shellCommands(argv) {
+		for _, pattern := range rule.Deny {
+			if matchCommand(pattern, cmd) {
+				return fmt.Sprintf("matches the deny pattern %q", pattern)
+			}
+		}
+		if len(rule.Allow) == 0 {
+			continue
+		}
+		allowed := false
+		for _, pattern := range rule.Allow {
+			if matchCommand(pattern, cmd) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return fmt.Sprintf("runs %s, which is not on the allow list", cmd[0])
+		}
+	}
+	return ""
+}
+
+// matchCommand reports whether pattern matches cmd. The first word matches
+// the program, by name or path; every further word must match one of the
+// arguments. Short flag clusters are split and the long options in
+// longFlags are read as their short form, on both sides, so "rm -rf /"
+// also matches rm -r -f /, rm -fr / and rm --recursive --force /. Other
+// long options and flag values (-C dir, --opt=value) match only as written.
+func matchCommand(pattern string, cmd []string) bool {
+	words := strings.Fields(pattern)
+	if len(words) == 0 || len(cmd) == 0 {
+		return false
+	}
+	if !globMatch(words[0], cmd[0]) && !globMatch(words[0], filepath.Base(cmd[0])) {
+		return false
+	}
+	program := filepath.Base(cmd[0])
+	args := make([]string, 0, len(cmd))
+	for _, arg := range cmd[1:] {
+		args = append(args, arg)
+		args = append(args, flagWords(program, arg)...)
+	}
+	for _, word := range words[1:] {
+		for _, part := range flagWords(program, word) {
+			found := false
+			for _, arg := range args {
+				if globMatch(part, arg) {
+					found = true
+					break
+				}
+			}
+			if !found {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// longFlags maps options of common programs to the short flag they mean.
+var longFlags = map[string]map[string]string{
+	"rm":    {"--recursive": "-r", "-R": "-r", "--force": "-f"},
+	"chmod": {"--recursive": "-R"},
+	"chown": {"--recursive": "-R"},
+	"chgrp": {"--recursive": "-R"},
+	"git":   {"--force": "-f"},
+}
+
+// flagWords returns the flags arg stands for when program reads it: -rf
+// gives -r and -f, and an option in longFlags its short form. Other words
+// are returned unchanged.
+func flagWords(program, arg string) []string {
+	if short, ok := longFlags[program][arg]; ok {
+		return []string{short}
+	}
+	if len(arg) < 3 || arg[0] != '-' {
+		return []string{arg}
+	}
+	for _, c := range arg[1:] {
+		if (c < 'a' || c > 'z') && (c < 'A' || c > 'Z') {
+			return []string{arg}
+		}
+	}
+	flags := make([]string, 0, len(arg)-1)
+	for _, c := range arg[1:] {
+		flags = append(flags, flagWords(program, "-"+string(c))...)
+	}
+	return flags
+}
+
+func globMatch(pattern, s string) bool {
+	ok, err := path.Match(pattern, s)
+	return err == nil && ok
+}
+
+// shellSeparators split a shell script into the commands it runs.
+var shellSeparators = strings.NewReplacer("&&", "\n", "||", "\n", ";", "\n", "|", "\n", "&", "\n", "$(", "\n", "`", "\n", "(", "\n", ")", "\n")
+
+// shellCommands returns argv, followed by the commands of its script when
+// argv runs one with a shell's -c, such as bash -c "cd web && npm i".
+func shellCommands(argv []string) [][]string {
+	cmds := [][]string{argv}
+	if len(argv) < 3 {
+		return cmds
+	}
+	switch filepath.Base(argv[0]) {
+	case "sh", "bash", "zsh", "dash", "ksh", "fish":
+	default:
+		return cmds
+	}
+	for i, arg := range argv[1 : len(argv)-1] {
+		if strings.HasPrefix(arg, "--") || !strings.HasPrefix(arg, "-") || !strings.Contains(arg, "c") {
+			continue
+		}
+		for _, line := range strings.Split(shellSeparators.Replace(argv[i+2]), "\n") {
+			cmd, err := parseShellCommand(line)
+			// Skip variable assignments in front of the program
+			for err == nil && len(cmd) > 1 && strings.Contains(cmd[0], "=") && !strings.ContainsRune(cmd[0], '/') {
+				cmd = cmd[1:]
+			}
+			if err == nil {
+				cmds = append(cmds, shellCommands(cmd)...)
+			}
+		}
+		break
+	}
+	return cmds
+}
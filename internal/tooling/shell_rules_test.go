@@ -0,0 +1,79 @@
+package tooling
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"cando/internal/config"
+)
+
+func TestShellRulesBlocked(t *testing.T) {
+	rules := shellRules{config: func() config.ShellCommandRule {
+		return config.ShellCommandRule{
+			Allow: []string{"git", "go", "npm", "bash", "cd", "rm"},
+			Deny:  []string{"git push --force*", "git push --force", "rm -rf /", "sudo"},
+		}
+	}}
+	tests := []struct {
+		argv []string
+		want string // Substring of the reason; "" = runs
+	}{
+		{[]string{"git", "push", "origin", "main"}, ""},
+		{[]string{"git", "push", "origin", "main", "--force-with-lease"}, `deny pattern "git push --force*"`},
+		{[]string{"/bin/rm", "-rf", "/"}, `deny pattern "rm -rf /"`},
+		{[]string{"rm", "-rf", "build"}, ""},
+		{[]string{"rm", "-r", "-f", "/"}, `deny pattern "rm -rf /"`},
+		{[]string{"rm", "-fr", "/"}, `deny pattern "rm -rf /"`},
+		{[]string{"rm", "-Rfv", "/"}, `deny pattern "rm -rf /"`},
+		{[]string{"rm", "--recursive", "--force", "/"}, `deny pattern "rm -rf /"`},
+		{[]string{"bash", "-c", "rm -f -r /"}, `deny pattern "rm -rf /"`},
+		{[]string{"rm", "-r", "/"}, ""},
+		{[]string{"git", "push", "-f"}, `deny pattern "git push --force"`},
+		{[]string{"curl", "https://example.com"}, "runs curl, which is not on the allow list"},
+		{[]string{"bash", "-c", "cd web && npm install"}, ""},
+		{[]string{"bash", "-lc", "go test ./... && CI=1 sudo make install"}, `deny pattern "sudo"`},
+		{[]string{"bash", "-c", "npm test | tee out.log"}, "runs tee"},
+	}
+	for _, tt := range tests {
+		got := rules.blocked(tt.argv)
+		if tt.want == "" && got != "" || !strings.Contains(got, tt.want) {
+			t.Errorf("blocked(%q) = %q, want %q", tt.argv, got, tt.want)
+		}
+	}
+
+	// Without a configured rule the default deny list applies
+	if got := (shellRules{}).blocked([]string{"sudo", "ls"}); got == "" {
+		t.Error("sudo ran without a configured rule")
+	}
+}
+
+func TestShellRulesAskForApproval(t *testing.T) {
+	rules := shellRules{config: func() config.ShellCommandRule {
+		return config.ShellCommandRule{Deny: []string{"git push --force"}}
+	}}
+	argv := []string{"git", "push", "--force"}
+
+	err := rules.check(context.Background(), "shell", argv)
+	if err == nil || !strings.Contains(err.Error(), `matches the deny pattern "git push --force"`) {
+		t.Fatalf("err = %v, want the deny pattern named", err)
+	}
+
+	var asked ApprovalRequest
+	answer := ApprovalDecision{Approved: true}
+	ctx := WithApprover(context.Background(), func(ctx context.Context, req ApprovalRequest) (ApprovalDecision, error) {
+		asked = req
+		return answer, nil
+	})
+	if err := rules.check(ctx, "shell", argv); err != nil {
+		t.Fatalf("approved command refused: %v", err)
+	}
+	if !strings.Contains(asked.Summary, "git push --force") || !strings.Contains(asked.Summary, "deny pattern") {
+		t.Errorf("approval summary = %q", asked.Summary)
+	}
+
+	answer = ApprovalDecision{Reason: "never force-push"}
+	if err := rules.check(ctx, "shell", argv); err == nil || !strings.Contains(err.Error(), "never force-push") {
+		t.Fatalf("err = %v, want the rejection reason", err)
+	}
+}
@@ -0,0 +1,121 @@
+package tooling
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// StatusReportToolName is the tool the agent calls to close a turn with a
+// structured status block.
+const StatusReportToolName = "report_status"
+
+// maxStatusItems bounds each list in a status report.
+const maxStatusItems = 10
+
+// StatusReport is the agent's own assessment of a finished turn, shown in
+// the UI next to the answer rather than inside it.
+type StatusReport struct {
+	Confidence    string   `json:"confidence"` // high | medium | low
+	Summary       string   `json:"summary,omitempty"`
+	Risks         []string `json:"risks,omitempty"`
+	OpenQuestions []string `json:"open_questions,omitempty"`
+	NextSteps     []string `json:"next_steps,omitempty"`
+}
+
+// ParseStatusReport decodes a report_status tool result.
+func ParseStatusReport(result string) (StatusReport, bool) {
+	var report StatusReport
+	if err := json.Unmarshal([]byte(result), &report); err != nil || report.Confidence == "" {
+		return StatusReport{}, false
+	}
+	return report, true
+}
+
+// StatusReportTool records the agent's confidence, risks, open questions
+// and suggested next steps at the end of a turn.
+type StatusReportTool struct{}
+
+func (StatusReportTool) Definition() ToolDefinition {
+	list := func(description string) map[string]any {
+		return map[string]any{
+			"type":        "array",
+			"items":       map[string]any{"type": "string"},
+			"description": description,
+		}
+	}
+	return ToolDefinition{
+		Type: "function",
+		Function: ToolFunction{
+			Name:        StatusReportToolName,
+			Description: "Report the status of your work at the end of a turn that changed code or left something uncertain: how confident you are, what could be wrong, what you need the user to decide, and what to do next. Shown to the user separately from your answer; do not repeat it in prose.",
+			Parameters: map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"confidence": map[string]any{
+						"type":        "string",
+						"enum":        []string{"high", "medium", "low"},
+						"description": "high: verified (e.g. tests pass). medium: done but not fully verified. low: partial, guessed or blocked.",
+					},
+					"summary":        map[string]any{"type": "string", "description": "One sentence on the state of the work."},
+					"risks":          list("Things that may be wrong or break, e.g. untested paths or assumptions."),
+					"open_questions": list("Questions the user needs to answer."),
+					"next_steps":     list("Suggested follow-up actions."),
+				},
+				"required": []string{"confidence"},
+			},
+		},
+	}
+}
+
+func (StatusReportTool) Call(ctx context.Context, args map[string]any) (string, error) {
+	select {
+	case <-ctx.Done():
+		return "", ctx.Err()
+	default:
+	}
+
+	confidence, _ := stringArg(args, "confidence")
+	confidence = strings.ToLower(strings.TrimSpace(confidence))
+	switch confidence {
+	case "high", "medium", "low":
+	default:
+		return "", fmt.Errorf("confidence must be high, medium or low")
+	}
+	summary, _ := stringArg(args, "summary")
+	report := StatusReport{
+		Confidence:    confidence,
+		Summary:       strings.TrimSpace(summary),
+		Risks:         statusItems(args["risks"]),
+		OpenQuestions: statusItems(args["open_questions"]),
+		NextSteps:     statusItems(args["next_steps"]),
+	}
+	data, err := jsonMarshalNoEscape(report)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// statusItems accepts a list or a single string and drops blank entries.
+func statusItems(raw any) []string {
+	var items []string
+	switch v := raw.(type) {
+	case string:
+		items = []string{v}
+	case []any:
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				items = append(items, s)
+			}
+		}
+	}
+	var out []string
+	for _, item := range items {
+		if item = strings.TrimSpace(item); item != "" && len(out) < maxStatusItems {
+			out = append(out, item)
+		}
+	}
+	return out
+}
@@ -0,0 +1,33 @@
+package tooling
+
+import (
+	"context"
+	"testing"
+)
+
+func TestStatusReportTool(t *testing.T) {
+	tool := StatusReportTool{}
+	result, err := tool.Call(context.Background(), map[string]any{
+		"confidence":     "Medium",
+		"summary":        " Parser rewritten ",
+		"risks":          []any{"no tests for unicode input", "  "},
+		"open_questions": "Keep the old flag?",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	report, ok := ParseStatusReport(result)
+	if !ok {
+		t.Fatalf("unparseable result %q", result)
+	}
+	if report.Confidence != "medium" || report.Summary != "Parser rewritten" {
+		t.Errorf("report = %+v", report)
+	}
+	if len(report.Risks) != 1 || len(report.OpenQuestions) != 1 || report.OpenQuestions[0] != "Keep the old flag?" || report.NextSteps != nil {
+		t.Errorf("lists = %+v", report)
+	}
+
+	if _, err := tool.Call(context.Background(), map[string]any{"confidence": "certain"}); err == nil {
+		t.Error("expected error for invalid confidence")
+	}
+}
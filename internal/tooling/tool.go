@@ -6,15 +6,17 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io/fs"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"strings"
 	"sync"
 	"time"
 
+	"cando/internal/config"
 	"cando/internal/credentials"
 	"cando/internal/logging"
+	"cando/internal/safefile"
 )
 
 var errEntryLimit = errors.New("entry limit reached")
@@ -50,24 +52,25 @@ type Tool interface {
 }
 
 type Registry struct {
-	tools       map[string]Tool
-	definitions []ToolDefinition
+	tools map[string]Tool
+	order []Tool
 }
 
 func NewRegistry(tools ...Tool) *Registry {
 	bucket := make(map[string]Tool, len(tools))
-	defs := make([]ToolDefinition, 0, len(tools))
 	for _, tool := range tools {
-		def := tool.Definition()
-		bucket[def.Function.Name] = tool
-		defs = append(defs, def)
+		bucket[tool.Definition().Function.Name] = tool
 	}
-	return &Registry{tools: bucket, definitions: defs}
+	return &Registry{tools: bucket, order: tools}
 }
 
+// Definitions describes the tools in registration order. They are built on
+// each call, since some depend on settings that can be reloaded.
 func (r *Registry) Definitions() []ToolDefinition {
-	out := make([]ToolDefinition, len(r.definitions))
-	copy(out, r.definitions)
+	out := make([]ToolDefinition, 0, len(r.order))
+	for _, tool := range r.order {
+		out = append(out, tool.Definition())
+	}
 	return out
 }
 
@@ -97,9 +100,25 @@ type Options struct {
 	BinDir              string
 	ExternalData        bool
 	ProcessDir          string
+	TrashDir            string // Where delete_path keeps deleted files
 	CredManager         CredentialManager
 	ZAIVisionURL        string
 	OpenRouterVisionURL string
+	LargeFileLimit      int64 // Bytes; 0 = DefaultLargeFileLimit, negative disables the guard
+	// AllowExternalSymlinks lets tools follow symlinks inside the workspace
+	// that point outside it.
+	AllowExternalSymlinks bool
+	// GitAuthor signs commits made by git_commit; empty uses git's config.
+	GitAuthor config.GitAuthor
+	// ShellInteractive reports whether the shell tool offers interactive
+	// mode; nil never does.
+	ShellInteractive func() bool
+	// ShellSandbox returns where shell and background commands run; nil
+	// runs them directly on the host.
+	ShellSandbox func() config.ShellSandbox
+	// ShellCommands returns the commands shell and background_process may
+	// run without asking; nil applies config.DefaultShellDeny.
+	ShellCommands func() config.ShellCommandRule
 }
 
 func DefaultTools(opts Options) []Tool {
@@ -107,6 +126,8 @@ func DefaultTools(opts Options) []Tool {
 	if err != nil {
 		panic(err)
 	}
+	guard.largeFileLimit = opts.LargeFileLimit
+	guard.allowExternalSymlinks = opts.AllowExternalSymlinks
 	planGuard := guard
 	binDir := opts.BinDir
 	switch {
@@ -151,32 +172,56 @@ func DefaultTools(opts Options) []Tool {
 	if err := os.MkdirAll(processDir, 0o755); err != nil {
 		panic(err)
 	}
+	trashDir := opts.TrashDir
+	if trashDir == "" {
+		trashDir = filepath.Join(guard.root, "trash")
+	}
 	shellTimeout := opts.ShellTimeout
 	if shellTimeout <= 0 {
 		shellTimeout = 60 * time.Second
 	}
 
 	// Create background process tool first so it can be passed to shell tool
+	sandbox := shellSandbox{root: guard.root, config: opts.ShellSandbox}
 	bgTool := NewBackgroundProcessTool(guard, processDir, binDir)
+	rules := shellRules{config: opts.ShellCommands}
+	bgTool.sandbox = sandbox
+	bgTool.rules = rules
 
 	return []Tool{
 		DateTimeTool{},
 		WorkingDirectoryTool{root: guard.root},
 		ListFilesTool{guard: guard},
 		ReadFileTool{guard: guard},
+		NewAnalyzeFileTool(guard),
+		NewPinFileTool(guard),
 		&ShellTool{
-			guard:   guard,
-			timeout: shellTimeout,
-			binDir:  binDir,
-			history: make(map[string]int),
-			bgTool:  bgTool,
+			guard:       guard,
+			timeout:     shellTimeout,
+			binDir:      binDir,
+			history:     make(map[string]int),
+			bgTool:      bgTool,
+			interactive: opts.ShellInteractive,
+			sandbox:     sandbox,
+			rules:       rules,
 		},
 
 		NewPlanToolWithGuard(planPath, planGuard),
+		StatusReportTool{},
 		NewWebFetchJSONTool(shellTimeout),
 		NewWriteFileTool(guard),
 		NewEditFileTool(guard),
 		NewApplyPatchTool(guard),
+		NewRenamePathTool(guard),
+		NewDeletePathTool(guard, trashDir),
+		NewNotebookTool(guard),
+		NewProjectTasksTool(guard),
+		NewRepoMapTool(guard),
+		NewGitHistoryTool(guard),
+		NewGitStatusTool(guard),
+		NewGitDiffTool(guard),
+		NewGitLogTool(guard),
+		NewGitCommitTool(guard, opts.GitAuthor),
 		NewGlobTool(guard),
 		NewGrepTool(guard),
 		NewVisionToolWithConfig(guard, opts.CredManager, opts.ZAIVisionURL, opts.OpenRouterVisionURL),
@@ -460,9 +505,33 @@ type ShellTool struct {
 	history map[string]int
 	hmu     sync.Mutex
 	bgTool  *BackgroundProcessTool
+	// interactive reports whether commands may be handed to the user
+	interactive func() bool
+	sandbox     shellSandbox
+	rules       shellRules
+}
+
+func (s *ShellTool) interactiveEnabled() bool {
+	return s.interactive != nil && s.interactive()
 }
 
 func (s *ShellTool) Definition() ToolDefinition {
+	def := s.definition()
+	if s.interactiveEnabled() {
+		props := def.Function.Parameters["properties"].(map[string]any)
+		props["interactive"] = map[string]any{
+			"type":        "boolean",
+			"description": "Run the command in a terminal shown to the user, who answers its prompts (npm init, installers, logins). Only for commands that cannot be made non-interactive with flags. Returns the terminal output once the command exits or the user ends it.",
+		}
+		props["instructions"] = map[string]any{
+			"type":        "string",
+			"description": "With interactive: what the user should do in the terminal, e.g. \"Pick the TypeScript template\".",
+		}
+	}
+	return def
+}
+
+func (s *ShellTool) definition() ToolDefinition {
 	return ToolDefinition{
 		Type: "function",
 		Function: ToolFunction{
@@ -536,12 +605,10 @@ func (s *ShellTool) Call(ctx context.Context, args map[string]any) (string, erro
 		return "", errors.New("command must not be empty")
 	}
 
-	blockedCommands := []string{"sudo", "su", "passwd"}
-	cmdName := filepath.Base(rawCmd[0])
-	for _, blocked := range blockedCommands {
-		if cmdName == blocked {
-			logging.ErrorLog("shell: blocked command '%s' - interactive commands not allowed", blocked)
-			return "", fmt.Errorf("command '%s' requires interactive input and is not allowed. Use alternative approaches that don't require user interaction", blocked)
+	// Background commands are checked by background_process
+	if bg, _ := args["background"].(bool); !bg {
+		if err := s.rules.check(ctx, "shell", rawCmd); err != nil {
+			return "", err
 		}
 	}
 
@@ -557,6 +624,10 @@ func (s *ShellTool) Call(ctx context.Context, args map[string]any) (string, erro
 	// Log command for debugging
 	logging.DevLog("shell: executing command %v in %s", rawCmd, workdir)
 
+	if interactive, ok := args["interactive"].(bool); ok && interactive {
+		return s.callInteractive(ctx, rawCmd, resolvedDir, args)
+	}
+
 	if bg, ok := args["background"].(bool); ok && bg {
 		if s.bgTool == nil {
 			return "", errors.New("background mode not available")
@@ -598,19 +669,31 @@ func (s *ShellTool) Call(ctx context.Context, args map[string]any) (string, erro
 	}
 	defer cancel()
 
-	cmd := exec.CommandContext(ctxWithTimeout, rawCmd[0], rawCmd[1:]...)
+	run, err := s.sandbox.wrap(rawCmd, resolvedDir, injectPath(os.Environ(), s.binDir), false)
+	if err != nil {
+		return "", err
+	}
+	cmd := run.command(ctxWithTimeout)
 	cmd.Dir = resolvedDir
-	cmd.Env = injectPath(os.Environ(), s.binDir)
 
 	cmd.Stdin = nil // prevent hangs on interactive input
 
 	var stdout, stderr bytes.Buffer
 	cmd.Stdout = &stdout
 	cmd.Stderr = &stderr
+	var streamer *outputStreamer
+	if emit, ok := outputStreamFromContext(ctx); ok {
+		streamer = newOutputStreamer(emit)
+		cmd.Stdout = streamer.writer("stdout", &stdout)
+		cmd.Stderr = streamer.writer("stderr", &stderr)
+	}
 
 	start := time.Now()
 	runErr := cmd.Run()
 	duration := time.Since(start)
+	if streamer != nil {
+		streamer.stop()
+	}
 	exitCode := 0
 	if ps := cmd.ProcessState; ps != nil {
 		exitCode = ps.ExitCode()
@@ -625,6 +708,9 @@ func (s *ShellTool) Call(ctx context.Context, args map[string]any) (string, erro
 		"exit_code":   exitCode,
 		"duration_ms": duration.Milliseconds(),
 	}
+	if backend := s.sandbox.name(); backend != "direct" {
+		result["sandbox"] = backend
+	}
 	if runErr != nil {
 		if errors.Is(runErr, context.DeadlineExceeded) {
 			logging.ErrorLog("shell: command timed out after %d seconds", int(timeout.Seconds()))
@@ -652,6 +738,49 @@ func (s *ShellTool) Call(ctx context.Context, args map[string]any) (string, erro
 	return string(data), nil
 }
 
+// callInteractive hands the command to the user through the turn's
+// InteractiveRunner. timeout_seconds does not apply: the user decides when
+// the step is done.
+func (s *ShellTool) callInteractive(ctx context.Context, rawCmd []string, dir string, args map[string]any) (string, error) {
+	if !s.interactiveEnabled() {
+		return "", errors.New("interactive commands are disabled (shell_interactive in the config); use non-interactive flags instead")
+	}
+	run, ok := interactiveRunnerFromContext(ctx)
+	if !ok {
+		return "", ErrNoInteractiveRunner
+	}
+	sandboxed, err := s.sandbox.wrap(rawCmd, dir, injectPath(os.Environ(), s.binDir), true)
+	if err != nil {
+		return "", err
+	}
+	instructions, _ := stringArg(args, "instructions")
+	logging.DevLog("shell: handing %v to the user", rawCmd)
+	start := time.Now()
+	res, err := run(ctx, InteractiveRequest{
+		Command:      rawCmd,
+		Args:         sandboxed.args,
+		Dir:          dir,
+		Env:          sandboxed.env,
+		Stop:         sandboxed.stop,
+		Instructions: strings.TrimSpace(instructions),
+	})
+	if err != nil {
+		return "", err
+	}
+	data, err := jsonMarshalNoEscape(map[string]any{
+		"workdir":     dir,
+		"interactive": true,
+		"output":      res.Output,
+		"exit_code":   res.ExitCode,
+		"ended_by":    res.EndedBy,
+		"duration_ms": time.Since(start).Milliseconds(),
+	})
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
 func (s *ShellTool) commandKey(workdir string, cmd []string) string {
 	return workdir + "|" + strings.Join(cmd, "\x00")
 }
@@ -814,7 +943,7 @@ func (p *PlanTool) saveToPath(path string, plan planState) error {
 	if err != nil {
 		return err
 	}
-	return os.WriteFile(path, data, 0o644)
+	return safefile.Write(path, data, 0o644)
 }
 
 func (p *PlanTool) load() (planState, error) {
@@ -824,7 +953,8 @@ func (p *PlanTool) load() (planState, error) {
 func (p *PlanTool) loadFromPath(path string) (planState, error) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
-	data, err := os.ReadFile(path)
+	// A plan damaged by a crash falls back to the version before it
+	data, _, err := safefile.Read(path, safefile.ValidJSON)
 	if err != nil {
 		if os.IsNotExist(err) {
 			return planState{UpdatedAt: time.Time{}, Steps: []planStep{}}, nil
@@ -974,6 +1104,12 @@ func parsePlanSteps(raw any) ([]planStep, error) {
 
 type pathGuard struct {
 	root string
+	// largeFileLimit is the edit size guard in bytes: 0 uses
+	// DefaultLargeFileLimit, negative disables the guard.
+	largeFileLimit int64
+	// allowExternalSymlinks lets paths inside root follow symlinks that
+	// point outside it.
+	allowExternalSymlinks bool
 }
 
 func newPathGuard(root string) (pathGuard, error) {
@@ -994,33 +1130,106 @@ func newPathGuard(root string) (pathGuard, error) {
 }
 
 func (p pathGuard) Resolve(path string) (string, error) {
-	var target string
+	return ResolveWithin(p.root, path, p.allowExternalSymlinks)
+}
+
+// ResolveWithin resolves path (absolute or relative to root) and rejects
+// results outside root. Symlinks are resolved before the containment check,
+// including for paths that do not exist yet, whose nearest existing ancestor
+// is resolved instead. A path inside root that a symlink leads outside of is
+// only accepted with allowExternalSymlinks; paths that cannot be resolved,
+// for example for lack of permission, are rejected.
+func ResolveWithin(root, path string, allowExternalSymlinks bool) (string, error) {
+	rootAbs, err := filepath.Abs(root)
+	if err != nil {
+		return "", err
+	}
+	if resolved, err := filepath.EvalSymlinks(rootAbs); err == nil {
+		rootAbs = resolved
+	}
+	target := path
 	if path == "" {
-		target = p.root
-	} else if filepath.IsAbs(path) {
-		target = path
-	} else {
-		target = filepath.Join(p.root, path)
+		target = rootAbs
+	} else if !filepath.IsAbs(path) {
+		target = filepath.Join(rootAbs, path)
 	}
 	cleaned, err := filepath.Abs(target)
 	if err != nil {
 		return "", err
 	}
-	// Try to resolve symlinks for accurate comparison (important on macOS)
-	resolved, err := filepath.EvalSymlinks(cleaned)
+	resolved, err := resolveExisting(cleaned)
 	if err != nil {
-		// File doesn't exist yet - try immediate parent only (no chain walking)
-		parent := filepath.Dir(cleaned)
-		if resolvedParent, err := filepath.EvalSymlinks(parent); err == nil {
-			resolved = filepath.Join(resolvedParent, filepath.Base(cleaned))
-		} else {
-			resolved = cleaned
+		return "", fmt.Errorf("cannot resolve %s: %w", path, err)
+	}
+	if within(rootAbs, resolved) {
+		return resolved, nil
+	}
+	if within(rootAbs, cleaned) {
+		if allowExternalSymlinks {
+			return cleaned, nil
 		}
+		return "", fmt.Errorf("path %s follows a symlink to %s, outside workspace root %s - set allow_external_symlinks to permit this", path, resolved, rootAbs)
+	}
+	return "", fmt.Errorf("path %s is outside workspace root %s - add this directory as a workspace first", path, rootAbs)
+}
+
+// ResolveEntryWithin is ResolveWithin for operations on a directory entry
+// itself, such as delete or rename: the parent is resolved but a symlink in
+// the final component is not followed, so the link is acted on rather than
+// its target.
+func ResolveEntryWithin(root, path string, allowExternalSymlinks bool) (string, error) {
+	cleaned := filepath.Clean(path)
+	base := filepath.Base(cleaned)
+	if base == "." || base == ".." || base == string(os.PathSeparator) {
+		return ResolveWithin(root, path, allowExternalSymlinks)
+	}
+	parent, err := ResolveWithin(root, filepath.Dir(cleaned), allowExternalSymlinks)
+	if err != nil {
+		return "", err
 	}
-	if resolved != p.root && !strings.HasPrefix(resolved, p.root+string(os.PathSeparator)) {
-		return "", fmt.Errorf("path %s is outside workspace root %s - add this directory as a workspace first", path, p.root)
+	return filepath.Join(parent, base), nil
+}
+
+func (p pathGuard) ResolveEntry(path string) (string, error) {
+	return ResolveEntryWithin(p.root, path, p.allowExternalSymlinks)
+}
+
+// resolveExisting evaluates the symlinks of the longest existing prefix of
+// path and appends the components that do not exist yet.
+func resolveExisting(path string) (string, error) {
+	var missing []string
+	for current := path; ; {
+		resolved, err := filepath.EvalSymlinks(current)
+		if err == nil {
+			for i := len(missing) - 1; i >= 0; i-- {
+				resolved = filepath.Join(resolved, missing[i])
+			}
+			return resolved, nil
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return "", err
+		}
+		if info, lerr := os.Lstat(current); lerr == nil && info.Mode()&fs.ModeSymlink != 0 {
+			// Writing through a dangling link would create its target
+			target, _ := os.Readlink(current)
+			if !filepath.IsAbs(target) {
+				target = filepath.Join(filepath.Dir(current), target)
+			}
+			missing = append(missing, filepath.Base(target))
+			current = filepath.Dir(filepath.Clean(target))
+			continue
+		}
+		parent := filepath.Dir(current)
+		if parent == current {
+			return path, nil
+		}
+		missing = append(missing, filepath.Base(current))
+		current = parent
 	}
-	return resolved, nil
+}
+
+func within(root, path string) bool {
+	return path == root || strings.HasPrefix(path, root+string(os.PathSeparator))
 }
 
 func (p pathGuard) Rel(path string) string {
@@ -1031,6 +1240,12 @@ func (p pathGuard) Rel(path string) string {
 	return rel
 }
 
+// CommandEnv returns the process environment used for shell commands, with
+// binDir prepended to PATH exactly as ShellTool does.
+func CommandEnv(binDir string) []string {
+	return injectPath(os.Environ(), binDir)
+}
+
 func injectPath(env []string, binDir string) []string {
 	if binDir == "" {
 		return env
@@ -51,6 +51,7 @@ func (t *WriteFileTool) Definition() ToolDefinition {
 						"type":        "string",
 						"description": "Text to write. Use \n for new lines.",
 					},
+					"confirm": confirmParam,
 				},
 				"required": []string{"path", "content"},
 			},
@@ -65,18 +66,77 @@ func (t *WriteFileTool) Call(ctx context.Context, args map[string]any) (string,
 	default:
 	}
 
+	req, err := t.parseRequest(args)
+	if err != nil {
+		return "", err
+	}
+	switch req.mode {
+	case "append":
+		return t.append(req.abs, req.content)
+	case "insert":
+		return t.insert(req.abs, req.line, req.content)
+	default:
+		return t.replaceRange(req.abs, req.start, req.end, req.content)
+	}
+}
+
+// PreviewChanges works out the file write_file would leave, without writing it.
+func (t *WriteFileTool) PreviewChanges(args map[string]any) ([]FileChange, error) {
+	req, err := t.parseRequest(args)
+	if err != nil {
+		return nil, err
+	}
+	before, existed, err := readForPreview(req.abs)
+	if err != nil {
+		return nil, err
+	}
+	var after string
+	switch req.mode {
+	case "append":
+		after = string(before) + req.content
+	case "insert":
+		lines, trailing := parseLines(before)
+		updated, _ := insertLines(lines, req.line, splitContent(req.content))
+		after = joinLines(updated, trailing)
+	default:
+		lines, trailing := parseLines(before)
+		updated, _, _ := replaceLines(lines, req.start, req.end, splitContent(req.content))
+		after = joinLines(updated, trailing)
+	}
+	return []FileChange{{
+		Path:    filepath.ToSlash(t.guard.Rel(req.abs)),
+		Before:  before,
+		After:   []byte(after),
+		Existed: existed,
+		Exists:  true,
+		abs:     req.abs,
+	}}, nil
+}
+
+type writeRequest struct {
+	abs        string
+	content    string
+	mode       string // append, insert or replace
+	line       int
+	start, end int
+}
+
+func (t *WriteFileTool) parseRequest(args map[string]any) (writeRequest, error) {
 	path, ok := stringArg(args, "path")
 	if !ok || strings.TrimSpace(path) == "" {
-		return "", errors.New("path is required")
+		return writeRequest{}, errors.New("path is required")
 	}
 	abs, err := t.guard.Resolve(path)
 	if err != nil {
-		return "", err
+		return writeRequest{}, err
 	}
 
 	content, ok := stringArg(args, "content")
 	if !ok {
-		return "", errors.New("content is required")
+		return writeRequest{}, errors.New("content is required")
+	}
+	if err := t.guard.checkEditable(abs, len(content), boolArg(args, "confirm", false)); err != nil {
+		return writeRequest{}, err
 	}
 
 	mode, _ := stringArg(args, "mode")
@@ -84,29 +144,28 @@ func (t *WriteFileTool) Call(ctx context.Context, args map[string]any) (string,
 	if mode == "" {
 		mode = "append"
 	}
+	req := writeRequest{abs: abs, content: content, mode: mode}
 
 	switch mode {
 	case "append":
-		return t.append(abs, content)
 	case "insert":
-		line := intArg(args, "line", -1)
-		if line == 0 {
-			return "", errors.New("line numbers are 1-based")
+		req.line = intArg(args, "line", -1)
+		if req.line == 0 {
+			return writeRequest{}, errors.New("line numbers are 1-based")
 		}
-		return t.insert(abs, line, content)
 	case "replace":
-		start := intArg(args, "start_line", 0)
-		end := intArg(args, "end_line", 0)
-		if start <= 0 || end <= 0 {
-			return "", errors.New("start_line and end_line must be positive for replace")
+		req.start = intArg(args, "start_line", 0)
+		req.end = intArg(args, "end_line", 0)
+		if req.start <= 0 || req.end <= 0 {
+			return writeRequest{}, errors.New("start_line and end_line must be positive for replace")
 		}
-		if end < start {
-			start, end = end, start
+		if req.end < req.start {
+			req.start, req.end = req.end, req.start
 		}
-		return t.replaceRange(abs, start, end, content)
 	default:
-		return "", fmt.Errorf("unsupported mode %s", mode)
+		return writeRequest{}, fmt.Errorf("unsupported mode %s", mode)
 	}
+	return req, nil
 }
 
 func (t *WriteFileTool) append(abs string, content string) (string, error) {
@@ -131,15 +190,8 @@ func (t *WriteFileTool) insert(abs string, line int, content string) (string, er
 	if err != nil {
 		return "", err
 	}
-	insertAt := len(lines)
-	if line > 0 && line-1 < len(lines) {
-		insertAt = line - 1
-	}
-	if line <= 1 {
-		insertAt = 0
-	}
 	newLines := splitContent(content)
-	updated := append(lines[:insertAt], append(newLines, lines[insertAt:]...)...)
+	updated, insertAt := insertLines(lines, line, newLines)
 	if err := writeLines(abs, updated, trailing); err != nil {
 		return "", err
 	}
@@ -158,6 +210,38 @@ func (t *WriteFileTool) replaceRange(abs string, start, end int, content string)
 	if err != nil {
 		return "", err
 	}
+	newLines := splitContent(content)
+	updated, start, end := replaceLines(lines, start, end, newLines)
+	if err := writeLines(abs, updated, trailing); err != nil {
+		return "", err
+	}
+	payload := map[string]any{
+		"path":         t.guard.Rel(abs),
+		"mode":         "replace",
+		"start_line":   start,
+		"end_line":     end,
+		"linesWritten": len(newLines),
+	}
+	data, _ := jsonMarshalNoEscape(payload)
+	return string(data), nil
+}
+
+// insertLines inserts newLines before the 1-based line, or at the end when
+// line is past it, and returns the 0-based index they landed at.
+func insertLines(lines []string, line int, newLines []string) ([]string, int) {
+	insertAt := len(lines)
+	if line > 0 && line-1 < len(lines) {
+		insertAt = line - 1
+	}
+	if line <= 1 {
+		insertAt = 0
+	}
+	return append(lines[:insertAt], append(newLines, lines[insertAt:]...)...), insertAt
+}
+
+// replaceLines replaces lines start..end (1-based, inclusive) with newLines,
+// clamping the range to the file. It returns the clamped range.
+func replaceLines(lines []string, start, end int, newLines []string) ([]string, int, int) {
 	if start > len(lines) {
 		start = len(lines) + 1
 	}
@@ -175,20 +259,8 @@ func (t *WriteFileTool) replaceRange(abs string, start, end int, content string)
 	if endIdx > len(lines) {
 		endIdx = len(lines)
 	}
-	newLines := splitContent(content)
 	updated := append(append([]string{}, lines[:startIdx]...), append(newLines, lines[endIdx:]...)...)
-	if err := writeLines(abs, updated, trailing); err != nil {
-		return "", err
-	}
-	payload := map[string]any{
-		"path":         t.guard.Rel(abs),
-		"mode":         "replace",
-		"start_line":   start,
-		"end_line":     end,
-		"linesWritten": len(newLines),
-	}
-	data, _ := jsonMarshalNoEscape(payload)
-	return string(data), nil
+	return updated, start, end
 }
 
 func readLines(path string) ([]string, bool, error) {
@@ -199,21 +271,29 @@ func readLines(path string) ([]string, bool, error) {
 	if err != nil {
 		return nil, false, err
 	}
+	lines, trailing := parseLines(data)
+	return lines, trailing, nil
+}
+
+// parseLines splits file content into lines and reports whether it ended
+// with a newline.
+func parseLines(data []byte) ([]string, bool) {
 	trailing := len(data) > 0 && data[len(data)-1] == '\n'
 	text := strings.TrimRight(string(data), "\n")
 	if text == "" {
-		if len(data) == 0 {
-			return []string{}, false, nil
-		}
-		return []string{}, true, nil
+		return []string{}, len(data) > 0
 	}
-	return strings.Split(text, "\n"), trailing, nil
+	return strings.Split(text, "\n"), trailing
 }
 
 func writeLines(path string, lines []string, trailing bool) error {
 	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
 		return err
 	}
+	return os.WriteFile(path, []byte(joinLines(lines, trailing)), 0o644)
+}
+
+func joinLines(lines []string, trailing bool) string {
 	var b strings.Builder
 	for i, line := range lines {
 		if i > 0 {
@@ -224,7 +304,7 @@ func writeLines(path string, lines []string, trailing bool) error {
 	if trailing {
 		b.WriteByte('\n')
 	}
-	return os.WriteFile(path, []byte(b.String()), 0o644)
+	return b.String()
 }
 
 func splitContent(content string) []string {
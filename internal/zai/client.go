@@ -8,6 +8,7 @@ import (
 	"io"
 	"log"
 	"net/http"
+	"net/url"
 	"regexp"
 	"strings"
 	"time"
@@ -156,6 +157,17 @@ func convertZAIMessageToStandard(zaiMsg ZAIMessage) state.Message {
 
 // Chat satisfies the llm.Client interface.
 func (c *Client) Chat(ctx context.Context, reqPayload llm.ChatRequest) (llm.ChatResponse, error) {
+	return c.complete(ctx, reqPayload, nil)
+}
+
+// ChatStream satisfies llm.Streamer, passing content and thinking to onDelta
+// as Z.AI generates them.
+func (c *Client) ChatStream(ctx context.Context, reqPayload llm.ChatRequest, onDelta func(llm.Delta)) (llm.ChatResponse, error) {
+	reqPayload.Stream = true
+	return c.complete(ctx, reqPayload, onDelta)
+}
+
+func (c *Client) complete(ctx context.Context, reqPayload llm.ChatRequest, onDelta func(llm.Delta)) (llm.ChatResponse, error) {
 	var respPayload llm.ChatResponse
 
 	body, err := json.Marshal(reqPayload)
@@ -181,6 +193,23 @@ func (c *Client) Chat(ctx context.Context, reqPayload llm.ChatRequest) (llm.Chat
 	}
 	defer resp.Body.Close()
 
+	// Errors arrive as plain JSON even when streaming was asked for
+	if resp.StatusCode < 300 && llm.IsEventStream(resp) {
+		c.logger.Printf("[z.ai] Response status: %d, streaming", resp.StatusCode)
+		streamed, err := llm.ReadStream(resp.Body, "zai", onDelta)
+		if err != nil {
+			return respPayload, err
+		}
+		choice := streamed.Choices[0]
+		return c.parseZAIResponse(&ZAIResponse{
+			Choices: []ZAIChoice{{
+				Message:      ZAIMessage{Content: choice.Message.Content, ReasoningContent: choice.Message.Thinking, ToolCalls: choice.Message.ToolCalls},
+				FinishReason: choice.FinishReason,
+			}},
+			Usage: streamed.Usage,
+		})
+	}
+
 	respBody, err := io.ReadAll(resp.Body)
 	if err != nil {
 		return respPayload, fmt.Errorf("read response: %w", err)
@@ -199,7 +228,9 @@ func (c *Client) Chat(ctx context.Context, reqPayload llm.ChatRequest) (llm.Chat
 	var nestedErr nestedErrorResponse
 	if err := json.Unmarshal(respBody, &nestedErr); err == nil && nestedErr.Error.Code != "" {
 		c.logger.Printf("[z.ai] API returned nested error: code=%s msg=%s", nestedErr.Error.Code, nestedErr.Error.Message)
-		return respPayload, parseZAIError(nestedErr.Error.Code, nestedErr.Error.Message)
+		pe := parseZAIError(nestedErr.Error.Code, nestedErr.Error.Message)
+		pe.ApplyRetryAfter(resp.Header)
+		return respPayload, pe
 	}
 
 	// Check for Z.AI flat error format (returns 200 with error object)
@@ -212,12 +243,16 @@ func (c *Client) Chat(ctx context.Context, reqPayload llm.ChatRequest) (llm.Chat
 	var flatErr flatErrorResponse
 	if err := json.Unmarshal(respBody, &flatErr); err == nil && flatErr.Code != 0 && flatErr.Msg != "" {
 		c.logger.Printf("[z.ai] API returned flat error: code=%d msg=%s", flatErr.Code, flatErr.Msg)
-		return respPayload, parseZAIError(fmt.Sprintf("%d", flatErr.Code), flatErr.Msg)
+		pe := parseZAIError(fmt.Sprintf("%d", flatErr.Code), flatErr.Msg)
+		pe.ApplyRetryAfter(resp.Header)
+		return respPayload, pe
 	}
 
 	if resp.StatusCode >= 300 {
 		// HTTP-level error - classify by status code
-		return respPayload, parseZAIHTTPError(resp.StatusCode, respBody)
+		pe := parseZAIHTTPError(resp.StatusCode, respBody)
+		pe.ApplyRetryAfter(resp.Header)
+		return respPayload, pe
 	}
 
 	// Try to parse as Z.AI enhanced response first
@@ -357,3 +392,60 @@ func parseZAIHTTPError(statusCode int, body []byte) *llm.ProviderError {
 
 	return pe
 }
+
+// quotaPath is the coding plan usage endpoint, relative to the API host.
+const quotaPath = "/api/monitor/usage/quota/limit"
+
+// AccountStatus reports how much of the coding plan's token quota has been
+// used in the current window.
+func (c *Client) AccountStatus(ctx context.Context) (*llm.AccountStatus, error) {
+	base, err := url.Parse(c.endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("parse endpoint: %w", err)
+	}
+	quotaURL := base.Scheme + "://" + base.Host + quotaPath
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, quotaURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("build request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+c.apiKey)
+	req.Header.Set("Accept-Language", c.acceptLanguage)
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("read response: %w", err)
+	}
+	if resp.StatusCode >= 300 {
+		return nil, parseZAIHTTPError(resp.StatusCode, body)
+	}
+
+	var payload struct {
+		Data struct {
+			Limits []struct {
+				Type          string  `json:"type"`
+				Percentage    float64 `json:"percentage"`
+				NextResetTime int64   `json:"nextResetTime"` // Unix milliseconds
+			} `json:"limits"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, fmt.Errorf("parse response: %w", err)
+	}
+	for _, limit := range payload.Data.Limits {
+		if limit.Type != "TOKENS_LIMIT" {
+			continue
+		}
+		status := &llm.AccountStatus{Provider: "zai", Unit: "percent", FetchedAt: time.Now()}
+		status.SetLimit(100, limit.Percentage)
+		if limit.NextResetTime > 0 {
+			reset := time.UnixMilli(limit.NextResetTime)
+			status.ResetAt = &reset
+		}
+		return status, nil
+	}
+	return nil, fmt.Errorf("quota response has no token limit")
+}